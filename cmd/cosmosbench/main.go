@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+	"github.com/vippsas/go-cosmosdb/cosmosbench"
+)
+
+const (
+	CosmosDbKeyEnvVarName = "COSMOSDB_KEY"
+)
+
+// This tool runs a read/write/query load against a collection and reports latency percentiles, RU consumption
+// and throttle rates. The master key is read from the environment variable COSMOSDB_KEY.
+func main() {
+	var (
+		url          = flag.String("url", "", "URL of the CosmosDB account, e.g. https://myaccount.documents.azure.com:443")
+		dbName       = flag.String("db", "", "Database name")
+		collection   = flag.String("collection", "", "Collection name. It is recommended to use a dedicated collection")
+		partitionKey = flag.String("partitionKey", "", "Name of the partition key field of the collection")
+		duration     = flag.Duration("duration", 10*time.Second, "Duration of the benchmark")
+		concurrency  = flag.Int("concurrency", 10, "Number of concurrent workers")
+		mix          = flag.String("mix", "read=80,write=15,query=5", "Relative weights of the operations")
+		documents    = flag.Int("documents", 1000, "Number of distinct documents to spread the operations over")
+		partitions   = flag.Int("partitionKeys", 100, "Number of distinct partition key values")
+		size         = flag.Int("size", 1000, "Payload size in bytes of written documents")
+		query        = flag.String("query", "", "Query to run, with @pk set to a partition key value (default: all documents in the partition)")
+		maxRetries   = flag.Int("maxRetries", 0, "Number of client retries on throttling; 0 reports every 429")
+	)
+	flag.Parse()
+
+	if *url == "" || *dbName == "" || *collection == "" || *partitionKey == "" {
+		fmt.Println("Missing parameters. Use -h to see usage")
+		os.Exit(1)
+	}
+	masterKey, ok := os.LookupEnv(CosmosDbKeyEnvVarName)
+	if !ok {
+		fmt.Printf("Environment var. '%s' is not set\n", CosmosDbKeyEnvVarName)
+		os.Exit(1)
+	}
+	parsedMix, err := cosmosbench.ParseMix(*mix)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	client := cosmosapi.New(*url, cosmosapi.Config{MasterKey: masterKey, MaxRetries: *maxRetries}, nil, nil)
+	report, err := cosmosbench.Run(context.Background(), client, cosmosbench.Config{
+		DbName:        *dbName,
+		Collection:    *collection,
+		PartitionKey:  *partitionKey,
+		Duration:      *duration,
+		Concurrency:   *concurrency,
+		Mix:           parsedMix,
+		Documents:     *documents,
+		PartitionKeys: *partitions,
+		DocumentSize:  *size,
+		Query:         *query,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	report.Print(os.Stdout)
+}
@@ -289,10 +289,16 @@ func createCollection(def collectionDefinition, client *cosmosapi.Client) {
 		Id:                def.CollectionID,
 		IndexingPolicy:    def.IndexingPolicy,
 		PartitionKey:      def.PartitionKey,
+		UniqueKeyPolicy:   def.UniqueKeyPolicy,
 		DefaultTimeToLive: def.DefaultTimeToLive,
 		OfferType:         cosmosapi.OfferType(def.Offer.Type),
 		OfferThroughput:   cosmosapi.OfferThroughput(def.Offer.Throughput),
 	}
+	if def.Offer.AutoscaleMaxThroughput > 0 {
+		colCreateOpts.OfferThroughput = 0
+		colCreateOpts.OfferType = ""
+		colCreateOpts.AutoscaleMaxThroughput = cosmosapi.OfferThroughput(def.Offer.AutoscaleMaxThroughput)
+	}
 
 	_, err := client.CreateCollection(context.Background(), def.DatabaseID, colCreateOpts)
 	if err != nil {
@@ -307,6 +313,7 @@ func replaceCollection(def collectionDefinition, existingCol *cosmosapi.Collecti
 		Id:                def.CollectionID,
 		IndexingPolicy:    def.IndexingPolicy,
 		PartitionKey:      existingCol.PartitionKey,
+		UniqueKeyPolicy:   existingCol.UniqueKeyPolicy,
 		DefaultTimeToLive: def.DefaultTimeToLive,
 	}
 
@@ -399,6 +406,23 @@ func replaceOffers(def collectionDefinition, dbCol *cosmosapi.Collection, client
 		if off.OfferResourceId == dbCol.Rid {
 			// offer applies to this resource
 
+			// Replacing the offer can not migrate between manual and autoscale throughput
+			if wantAutoscale := def.Offer.AutoscaleMaxThroughput > 0; wantAutoscale != off.IsAutoscale() {
+				panicf("Offer '%s' of collection '%s' has %s throughput, but the definition has %s throughput; "+
+					"migrating between them is not supported, so migrate the collection in Azure first",
+					off.Id, def.CollectionID, throughputMode(off.IsAutoscale()), throughputMode(wantAutoscale))
+			}
+
+			if off.IsAutoscale() {
+				maxThroughput := cosmosapi.OfferThroughput(def.Offer.AutoscaleMaxThroughput)
+				_, err := client.ReplaceThroughput(context.Background(), off, maxThroughput, true)
+				if err != nil {
+					panicef("Could not update offer '%s'", err, off.Id)
+				}
+				fmt.Printf("Updated offer '%s'. AutoscaleMaxThroughput=%d\n", off.Id, maxThroughput)
+				continue
+			}
+
 			offReplOpts := cosmosapi.OfferReplaceOptions{
 				Rid:              off.Rid,
 				OfferResourceId:  off.OfferResourceId,
@@ -420,6 +444,13 @@ func replaceOffers(def collectionDefinition, dbCol *cosmosapi.Collection, client
 	}
 }
 
+func throughputMode(autoscale bool) string {
+	if autoscale {
+		return "autoscale"
+	}
+	return "manual"
+}
+
 // --- Inline types used to deserialize the input
 
 type collectionDefinition struct {
@@ -431,12 +462,16 @@ type collectionDefinition struct {
 	Offer             struct {
 		Throughput int    `json:"throughput"`
 		Type       string `json:"type"`
+		// AutoscaleMaxThroughput provisions autoscale throughput instead of Throughput, if set
+		AutoscaleMaxThroughput int `json:"autoscaleMaxThroughput"`
 	} `json:"offer"`
 	IndexingPolicy *cosmosapi.IndexingPolicy `json:"indexingPolicy,omitempty"`
 	PartitionKey   *cosmosapi.PartitionKey   `json:"partitionKey,omitempty"`
-	Triggers       []trigger                 `json:"triggers"`
-	Udfs           []interface{}             `json:"udfs"`
-	Sprocs         []interface{}             `json:"sprocs"`
+	// UniqueKeyPolicy is only used when the collection is created
+	UniqueKeyPolicy *cosmosapi.UniqueKeyPolicy `json:"uniqueKeyPolicy,omitempty"`
+	Triggers        []trigger                  `json:"triggers"`
+	Udfs            []interface{}              `json:"udfs"`
+	Sprocs          []interface{}              `json:"sprocs"`
 }
 
 type trigger struct {
@@ -0,0 +1,65 @@
+package cosmos
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+var AccessDeniedError = errors.New("Access denied")
+
+// WithPrincipal returns a context carrying the principal, e.g. the authenticated user, on whose behalf the
+// operations done with the context are done; it is passed to the AccessPolicy of collections with
+// WithAccessControl
+func WithPrincipal(ctx context.Context, principal interface{}) context.Context {
+	return context.WithValue(ctx, ckPrincipal, principal)
+}
+
+// PrincipalFromContext returns the principal set on the context with WithPrincipal, or nil
+func PrincipalFromContext(ctx context.Context) interface{} {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Value(ckPrincipal)
+}
+
+// AccessPolicy decides whether principal, as returned by PrincipalFromContext for the context of the operation
+// (nil if none is set), may do op on entity, which is op.Entity:
+//
+// For OperationGet, the policy is checked after the document has been read, with entity populated (or
+// zero-initialized if the document does not exist). For OperationPut and OperationDelete, it is checked
+// before the write, with the entity to be written or deleted; for a transaction, that is the entity as
+// modified by the transaction, the version read having been checked by the get. For OperationPatch,
+// OperationQuery, OperationList and OperationSproc entity is nil, so the decision is on op.Id, op.Query or
+// op.Sproc alone; the documents a query or listing returns are not checked.
+type AccessPolicy func(op Operation, entity Model, principal interface{}) bool
+
+// WithAccessControl returns a Collection where policy is checked on all operations, also through sessions
+// and transactions created from it, so that row-level security is enforced in one place rather than in
+// every handler. Operations that are denied fail with an error with cause AccessDeniedError; for a get,
+// the target is zeroed, so that what was read is not exposed.
+func (c Collection) WithAccessControl(policy AccessPolicy) Collection {
+	return c.WithInterceptor(func(op Operation, next func() error) error {
+		principal := PrincipalFromContext(op.Context)
+		if op.Kind != OperationGet {
+			if !policy(op, op.Entity, principal) {
+				return accessDenied(op)
+			}
+			return next()
+		}
+		if err := next(); err != nil {
+			return err
+		}
+		if !policy(op, op.Entity, principal) {
+			target := reflect.ValueOf(op.Entity).Elem()
+			target.Set(reflect.Zero(target.Type()))
+			return accessDenied(op)
+		}
+		return nil
+	})
+}
+
+func accessDenied(op Operation) error {
+	return errors.Wrapf(AccessDeniedError, "%s id='%s' partitionValue='%v'", op.Kind, op.Id, op.PartitionKey)
+}
@@ -0,0 +1,73 @@
+package cosmos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessControl(t *testing.T) {
+	mock := mockCosmos{}
+	var checked []OperationKind
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithAccessControl(
+		func(op Operation, entity Model, principal interface{}) bool {
+			checked = append(checked, op.Kind)
+			if entity == nil {
+				return principal == "admin"
+			}
+			return principal == "admin" || principal == entity.(*MyModel).UserId
+		})
+	alice := WithPrincipal(context.Background(), "alice")
+
+	// Reads are checked on the document read
+	mock.ReturnEtag = "etag-1"
+	mock.ReturnUserId = "alice"
+	mock.ReturnX = 42
+	var entity MyModel
+	require.NoError(t, c.StaleGetContext(alice, "alice", "id1", &entity))
+	require.Equal(t, 42, entity.X)
+	mock.ReturnUserId = "bob"
+	err := c.StaleGetContext(alice, "bob", "id2", &entity)
+	require.Equal(t, AccessDeniedError, errors.Cause(err))
+	require.Equal(t, MyModel{}, entity)
+	require.Equal(t, []OperationKind{OperationGet, OperationGet}, checked)
+
+	// Writes are checked before writing
+	mock.reset()
+	entity = MyModel{BaseModel: BaseModel{Id: "id2"}, UserId: "bob"}
+	require.Equal(t, AccessDeniedError, errors.Cause(c.WithContext(alice).RacingPut(&entity)))
+	require.Equal(t, "", mock.GotMethod)
+	require.NoError(t, c.WithContext(WithPrincipal(context.Background(), "admin")).RacingPut(&entity))
+	require.Equal(t, "create", mock.GotMethod)
+
+	// Also in transactions, with the principal of the session
+	mock.reset()
+	mock.ReturnUserId = "alice"
+	checked = nil
+	err = c.Session().WithContext(alice).Transaction(func(txn *Transaction) error {
+		var entity MyModel
+		if err := txn.Get("alice", "id1", &entity); err != nil {
+			return err
+		}
+		entity.UserId = "bob"
+		txn.Put(&entity)
+		return nil
+	})
+	require.Equal(t, AccessDeniedError, errors.Cause(err))
+	require.Equal(t, []OperationKind{OperationGet, OperationPut}, checked)
+	require.Equal(t, "get", mock.GotMethod)
+
+	// Without a principal, everything is denied by this policy
+	require.Equal(t, AccessDeniedError, errors.Cause(c.StaleGet("alice", "id1", &entity)))
+
+	// Stored procedures and listings are checked too
+	checked = nil
+	var ret interface{}
+	require.Equal(t, AccessDeniedError, errors.Cause(c.WithContext(alice).ExecuteSproc("sproc", "alice", &ret)))
+	var entities []MyModel
+	_, err = c.WithContext(alice).ReadFeed("", "0", 10, &entities)
+	require.Equal(t, AccessDeniedError, errors.Cause(err))
+	require.Equal(t, []OperationKind{OperationSproc, OperationList}, checked)
+}
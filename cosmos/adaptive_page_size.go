@@ -0,0 +1,124 @@
+package cosmos
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// AdaptivePageSizeConfig configures an AdaptivePageSize; zero values give the defaults
+type AdaptivePageSizeConfig struct {
+	// TargetBytes is the size of the pages aimed for (default 1 MiB); documents of 100 KiB then give pages
+	// of 10 items, and documents of 1 KiB pages of 1000 items
+	TargetBytes int
+	// TargetLatency is the time a page should take at most (default 1s); slower pages make the page size
+	// smaller in proportion
+	TargetLatency time.Duration
+	// MinItems and MaxItems bound the page size (defaults 10 and 1000)
+	MinItems int
+	MaxItems int
+	// InitialItems is the page size until a page has been observed (default 100)
+	InitialItems int
+}
+
+// AdaptivePageSize chooses the page size (x-ms-max-item-count) of queries from the observed size of the
+// documents and the latency of the pages, instead of the fixed default of Cosmos: small pages for huge
+// documents, to bound memory use and latency, and large pages for small documents, to save round trips
+// and RUs. Attach it to collections with WithAdaptivePageSize; as it learns the size of the documents,
+// use one AdaptivePageSize per collection, or per query with documents of a different size (e.g.
+// projections).
+//
+// Without the size of the responses (e.g. from fakes), the page size is doubled after each full page that
+// took less than half of TargetLatency.
+type AdaptivePageSize struct {
+	config AdaptivePageSizeConfig
+
+	mu       sync.Mutex
+	docBytes float64 // moving average of the document size
+	pageSize int
+}
+
+func NewAdaptivePageSize(config AdaptivePageSizeConfig) *AdaptivePageSize {
+	if config.TargetBytes == 0 {
+		config.TargetBytes = 1 << 20
+	}
+	if config.TargetLatency == 0 {
+		config.TargetLatency = time.Second
+	}
+	if config.MinItems == 0 {
+		config.MinItems = 10
+	}
+	if config.MaxItems == 0 {
+		config.MaxItems = 1000
+	}
+	if config.InitialItems == 0 {
+		config.InitialItems = 100
+	}
+	return &AdaptivePageSize{config: config, pageSize: config.InitialItems}
+}
+
+// PageSize returns the page size to use for the next page
+func (a *AdaptivePageSize) PageSize() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pageSize
+}
+
+// Observe adjusts the page size after a page of items documents, of size bytes in total (or -1 if not
+// known), was read in latency
+func (a *AdaptivePageSize) Observe(items int, size int64, latency time.Duration) {
+	if items <= 0 {
+		// Nothing to learn the document size from, and empty pages are fast anyway
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	next := a.pageSize
+	if size > 0 {
+		docBytes := float64(size) / float64(items)
+		if a.docBytes == 0 {
+			a.docBytes = docBytes
+		} else {
+			a.docBytes = 0.7*a.docBytes + 0.3*docBytes
+		}
+		next = int(float64(a.config.TargetBytes) / a.docBytes)
+	} else if items >= a.pageSize && latency < a.config.TargetLatency/2 {
+		next = 2 * a.pageSize
+	}
+	if latency > a.config.TargetLatency {
+		if byLatency := int(float64(items) * float64(a.config.TargetLatency) / float64(latency)); byLatency < next {
+			next = byLatency
+		}
+	}
+	if next < a.config.MinItems {
+		next = a.config.MinItems
+	}
+	if next > a.config.MaxItems {
+		next = a.config.MaxItems
+	}
+	a.pageSize = next
+}
+
+// WithAdaptivePageSize returns a collection where the queries reading results page by page (QueryAll,
+// QueryChan, VisitModels, QueryProjection, ChangedSince, Export and the like) have their page size chosen
+// by pageSize, unless given explicitly. Query, which returns a single page, is not affected.
+func (c Collection) WithAdaptivePageSize(pageSize *AdaptivePageSize) Collection {
+	c.pageSize = pageSize // note that c is not a pointer
+	return c
+}
+
+// queryPage reads a page of the query, with the page size of the collection's AdaptivePageSize, if any
+func (c Collection) queryPage(ctx context.Context, query cosmosapi.Query, out interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	if c.pageSize == nil || ops.MaxItemCount != 0 {
+		return c.Client.QueryDocuments(ctx, c.DbName, c.Name, query, out, ops)
+	}
+	ops.MaxItemCount = c.pageSize.PageSize()
+	started := time.Now()
+	response, err := c.Client.QueryDocuments(ctx, c.DbName, c.Name, query, out, ops)
+	if err == nil {
+		c.pageSize.Observe(response.Count, response.Size, time.Since(started))
+	}
+	return response, err
+}
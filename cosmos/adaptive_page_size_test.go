@@ -0,0 +1,76 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestAdaptivePageSize(t *testing.T) {
+	config := AdaptivePageSizeConfig{TargetBytes: 100000, TargetLatency: 100 * time.Millisecond}
+
+	// Huge documents give small pages, and small documents large ones
+	a := NewAdaptivePageSize(config)
+	require.Equal(t, 100, a.PageSize())
+	a.Observe(100, 100*50000, 10*time.Millisecond)
+	require.Equal(t, 10, a.PageSize()) // 2 by size, but at least MinItems
+	a = NewAdaptivePageSize(config)
+	a.Observe(100, 100*500, 10*time.Millisecond)
+	require.Equal(t, 200, a.PageSize())
+	a.Observe(200, 200*100, 10*time.Millisecond)
+	require.Equal(t, 263, a.PageSize()) // the moving average of the document size is 380 bytes
+
+	// Slow pages are made smaller, in proportion
+	a = NewAdaptivePageSize(config)
+	a.Observe(100, 100*10, 400*time.Millisecond)
+	require.Equal(t, 25, a.PageSize())
+
+	// Without sizes, fast full pages are doubled
+	a = NewAdaptivePageSize(config)
+	a.Observe(100, -1, 10*time.Millisecond)
+	require.Equal(t, 200, a.PageSize())
+	a.Observe(50, -1, 10*time.Millisecond)
+	require.Equal(t, 200, a.PageSize())
+	a.Observe(0, 0, time.Second)
+	require.Equal(t, 200, a.PageSize())
+}
+
+// mockCosmosPageSize returns pages of as many documents of 1000 bytes as asked for
+type mockCosmosPageSize struct {
+	Client
+	GotMaxItemCounts []int
+}
+
+func (mock *mockCosmosPageSize) QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	mock.GotMaxItemCounts = append(mock.GotMaxItemCounts, ops.MaxItemCount)
+	var page []map[string]interface{}
+	for i := 0; i != ops.MaxItemCount; i++ {
+		page = append(page, map[string]interface{}{"id": fmt.Sprint(i)})
+	}
+	response := cosmosapi.QueryDocumentsResponse{Count: len(page), Size: int64(1000 * len(page))}
+	if len(mock.GotMaxItemCounts) < 3 {
+		response.Continuation = "more"
+	}
+	data, _ := json.Marshal(page)
+	return response, json.Unmarshal(data, docs)
+}
+
+func TestWithAdaptivePageSize(t *testing.T) {
+	mock := mockCosmosPageSize{}
+	pageSize := NewAdaptivePageSize(AdaptivePageSizeConfig{TargetBytes: 500000})
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithAdaptivePageSize(pageSize)
+
+	items, errs := c.QueryChan(context.Background(), cosmosapi.Query{Query: "SELECT * FROM c"}, myModelListItem{})
+	count := 0
+	for range items {
+		count++
+	}
+	require.NoError(t, <-errs)
+	require.Equal(t, []int{100, 500, 500}, mock.GotMaxItemCounts)
+	require.Equal(t, 1100, count)
+}
@@ -0,0 +1,342 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+	"github.com/vippsas/go-cosmosdb/logging"
+)
+
+// ChangeFeedHandler processes a batch of documents changed in the partition key range rangeId, in the order
+// they were changed. If it returns an error, the batch is not checkpointed, and will be handled again.
+type ChangeFeedHandler func(ctx context.Context, rangeId string, docs []json.RawMessage) error
+
+// changeFeedLease is the lease document of a partition key range of the feed, stored in the lease collection
+type changeFeedLease struct {
+	BaseModel
+	Owner        string    `json:"owner"`
+	Expires      time.Time `json:"expires"`
+	Continuation string    `json:"continuation"`
+}
+
+// ChangeFeedProcessor reads the change feed of Feed and passes the changed documents to Handler, spreading the
+// partition key ranges over all the processes running a ChangeFeedProcessor with the same Name.
+//
+// Each partition key range has a lease document in the Leases collection, with the id "<Name>.<range id>" and
+// Name as partition value, which records the instance that owns the range and the position (etag) in the
+// change feed up to which the documents have been handled. An instance renews the leases it owns on every
+// poll; leases that are not renewed within LeaseDuration, e.g. because the instance stopped, are taken over
+// by the others. Instances take at most their fair share of the leases, and take leases from instances with
+// more than their share, so the ranges are rebalanced when instances come and go.
+//
+// The position is checkpointed after each batch has been handled, so documents are handled at least once:
+// a batch is handled again if the handler fails, or if the instance stops or loses the lease before
+// checkpointing. As with ReadFeed, deletes are not seen. When a range is split, the leases of the new ranges
+// start from the position of the old one.
+//
+// Run it with a Supervisor, so that it is restarted when the handler fails. A ChangeFeedProcessor is not
+// safe for concurrent use.
+type ChangeFeedProcessor struct {
+	Feed Collection
+	// Leases is the collection to store the lease documents in; it may be shared by several processors
+	// with different names. Required.
+	Leases Collection
+	// Name identifies the processor; the instances with the same Name share the work. Required.
+	Name string
+	// Owner identifies this instance in the leases (default a random UUID)
+	Owner   string
+	Handler ChangeFeedHandler
+	// PageSize is the maximum number of documents passed to Handler at a time (default 100)
+	PageSize int
+	// PollInterval is the time between reads of the change feed once it has been caught up with (default 5s)
+	PollInterval time.Duration
+	// LeaseDuration is how long a lease is held without being renewed (default 60s)
+	LeaseDuration time.Duration
+	// Log, if not nil, receives progress messages
+	Log logging.StdLogger
+}
+
+// Run polls the change feed every PollInterval until ctx is done, then releases the leases and returns nil.
+// If polling fails, the leases are left to expire and the error returned.
+func (p *ChangeFeedProcessor) Run(ctx context.Context) error {
+	for {
+		if err := p.Poll(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			// Release the leases with a fresh context, as ctx is done
+			return p.Release(context.Background())
+		case <-time.After(p.pollInterval()):
+		}
+	}
+}
+
+// Poll acquires and renews leases, then handles the changes in the ranges leased, until the change feed of
+// each range has been caught up with or half of LeaseDuration has passed, so that the leases are renewed in
+// time by the next poll
+func (p *ChangeFeedProcessor) Poll(ctx context.Context) error {
+	if p.Name == "" || p.Handler == nil {
+		return errors.New("ChangeFeedProcessor.Name and Handler are required")
+	}
+	if p.Owner == "" {
+		p.Owner = uuid.Must(uuid.NewV4()).String()
+	}
+	start := time.Now()
+	owned, err := p.balance(ctx)
+	if err != nil {
+		return err
+	}
+	for _, lease := range owned {
+		if err := p.process(ctx, lease, start.Add(p.leaseDuration()/2)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release gives up the leases owned by this instance, so that other instances can take them over at once
+func (p *ChangeFeedProcessor) Release(ctx context.Context) error {
+	if p.Owner == "" {
+		return nil
+	}
+	leases, err := p.readLeases(ctx)
+	if err != nil {
+		return err
+	}
+	for _, lease := range leases {
+		if lease.Owner != p.Owner {
+			continue
+		}
+		lease.Owner, lease.Expires = "", time.Time{}
+		if err := p.writeLease(ctx, lease); err != nil && errors.Cause(err) != cosmosapi.ErrPreconditionFailed {
+			return err
+		}
+	}
+	return nil
+}
+
+// balance creates the leases of new ranges, renews the leases owned, and takes leases up to the fair share of
+// this instance; it returns the leases owned, ordered by range id
+func (p *ChangeFeedProcessor) balance(ctx context.Context) ([]*changeFeedLease, error) {
+	leases, err := p.readLeases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	live := map[string]int{p.Owner: 0}
+	for _, lease := range leases {
+		if lease.Owner != "" && lease.Expires.After(now) {
+			live[lease.Owner]++
+		}
+	}
+	share := (len(leases) + len(live) - 1) / len(live)
+
+	var owned, free []*changeFeedLease
+	for _, lease := range leases {
+		if lease.Owner == p.Owner && lease.Expires.After(now) {
+			if p.acquire(ctx, lease) == nil {
+				owned = append(owned, lease)
+			}
+		} else if lease.Owner == "" || !lease.Expires.After(now) {
+			free = append(free, lease)
+		}
+	}
+	candidates := free
+	if len(owned)+len(free) < share {
+		// Take a lease from the instance with the most leases, if more than its share; one per poll, to
+		// give it time to notice
+		var busiest string
+		for owner, n := range live {
+			if owner != p.Owner && n > share && (busiest == "" || n > live[busiest]) {
+				busiest = owner
+			}
+		}
+		for _, lease := range leases {
+			if busiest != "" && lease.Owner == busiest {
+				candidates = append(candidates, lease)
+				break
+			}
+		}
+	}
+	for _, lease := range candidates {
+		if len(owned) >= share {
+			break
+		}
+		previous := lease.Owner
+		if p.acquire(ctx, lease) != nil {
+			continue
+		}
+		logging.Adapt(p.Log).Debugf("Change feed processor %s: %s took range %s from '%s'\n", p.Name, p.Owner, p.rangeId(lease), previous)
+		owned = append(owned, lease)
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].Id < owned[j].Id })
+	return owned, nil
+}
+
+// acquire sets this instance as the owner of the lease and renews it; the lease is lost, with
+// ErrPreconditionFailed, if it was written by someone else since it was read
+func (p *ChangeFeedProcessor) acquire(ctx context.Context, lease *changeFeedLease) error {
+	lease.Owner, lease.Expires = p.Owner, time.Now().Add(p.leaseDuration())
+	err := p.writeLease(ctx, lease)
+	if err != nil && errors.Cause(err) != cosmosapi.ErrPreconditionFailed {
+		logging.Adapt(p.Log).Printf("Change feed processor %s: failed to write lease of range %s: %v\n", p.Name, p.rangeId(lease), err)
+	}
+	return err
+}
+
+// process handles the changes in the range of the lease until caught up with, or until the deadline
+func (p *ChangeFeedProcessor) process(ctx context.Context, lease *changeFeedLease, deadline time.Time) error {
+	log := logging.Adapt(p.Log)
+	rangeId := p.rangeId(lease)
+	for time.Now().Before(deadline) {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		var docs []json.RawMessage
+		response, err := p.Feed.ReadFeedContext(ctx, lease.Continuation, rangeId, p.pageSize(), &docs)
+		if errors.Cause(err) == cosmosapi.ErrGone {
+			// The range has been split; the leases of the new ranges are created by the next poll
+			return nil
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(docs) == 0 {
+			// Not modified
+			return nil
+		}
+		if err := p.Handler(ctx, rangeId, docs); err != nil {
+			return errors.WithMessage(err, "Change feed handler failed on range "+rangeId)
+		}
+		lease.Continuation = response.Etag
+		if err := p.acquire(ctx, lease); errors.Cause(err) == cosmosapi.ErrPreconditionFailed {
+			log.Printf("Change feed processor %s: %s lost the lease of range %s\n", p.Name, p.Owner, rangeId)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		log.Debugf("Change feed processor %s: range %s at %s, %d documents handled\n", p.Name, rangeId, response.Etag, len(docs))
+	}
+	return nil
+}
+
+// readLeases reads the leases of the current ranges of the feed, creating those that are missing
+func (p *ChangeFeedProcessor) readLeases(ctx context.Context) ([]*changeFeedLease, error) {
+	ranges, err := p.Feed.GetPartitionKeyRangesContext(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	split := map[string]bool{}
+	for _, r := range ranges {
+		for _, parent := range r.Parents {
+			split[parent] = true
+		}
+	}
+	var leases []*changeFeedLease
+	for _, r := range ranges {
+		if split[r.Id] {
+			continue
+		}
+		lease, err := p.readLease(ctx, r.Id)
+		if err != nil {
+			return nil, err
+		}
+		if lease.Etag == "" {
+			// A new range; continue from where its parent was, if any
+			for _, parent := range r.Parents {
+				parentLease, err := p.readLease(ctx, parent)
+				if err != nil {
+					return nil, err
+				}
+				if parentLease.Continuation != "" {
+					lease.Continuation = parentLease.Continuation
+				}
+			}
+			err = p.writeLease(ctx, lease)
+			if errors.Cause(err) == cosmosapi.ErrPreconditionFailed {
+				// Created concurrently by another instance
+				lease, err = p.readLease(ctx, r.Id)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// readLease reads the lease of the range; if it does not exist, a lease without etag is returned
+func (p *ChangeFeedProcessor) readLease(ctx context.Context, rangeId string) (*changeFeedLease, error) {
+	c := p.Leases
+	lease := &changeFeedLease{BaseModel: BaseModel{Id: p.Name + "." + rangeId}}
+	opts := cosmosapi.GetDocumentOptions{PartitionKeyValue: p.Name}
+	_, err := c.Client.GetDocument(ctx, c.DbName, c.Name, lease.Id, opts, lease)
+	if errors.Cause(err) == cosmosapi.ErrNotFound {
+		return lease, nil
+	}
+	return lease, errors.WithStack(err)
+}
+
+// writeLease writes the lease if it has not changed since it was read, or creates it if it has no etag; a
+// write that loses the race fails with ErrPreconditionFailed
+func (p *ChangeFeedProcessor) writeLease(ctx context.Context, lease *changeFeedLease) error {
+	c := p.Leases
+	body := map[string]interface{}{
+		"id":           lease.Id,
+		"owner":        lease.Owner,
+		"expires":      lease.Expires,
+		"continuation": lease.Continuation,
+	}
+	body[c.PartitionKey] = p.Name
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var resource *cosmosapi.Resource
+	if lease.Etag == "" {
+		opts := cosmosapi.CreateDocumentOptions{PartitionKeyValue: p.Name}
+		resource, _, err = c.Client.CreateDocument(ctx, c.DbName, c.Name, data, opts)
+		if errors.Cause(err) == cosmosapi.ErrConflict {
+			err = cosmosapi.ErrPreconditionFailed
+		}
+	} else {
+		opts := cosmosapi.ReplaceDocumentOptions{PartitionKeyValue: p.Name, IfMatch: lease.Etag}
+		resource, _, err = c.Client.ReplaceDocument(ctx, c.DbName, c.Name, lease.Id, data, opts)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	lease.Etag = resource.Etag
+	return nil
+}
+
+func (p *ChangeFeedProcessor) rangeId(lease *changeFeedLease) string {
+	return lease.Id[len(p.Name)+1:]
+}
+
+func (p *ChangeFeedProcessor) pageSize() int {
+	if p.PageSize <= 0 {
+		return 100
+	}
+	return p.PageSize
+}
+
+func (p *ChangeFeedProcessor) pollInterval() time.Duration {
+	if p.PollInterval <= 0 {
+		return 5 * time.Second
+	}
+	return p.PollInterval
+}
+
+func (p *ChangeFeedProcessor) leaseDuration() time.Duration {
+	if p.LeaseDuration <= 0 {
+		return 60 * time.Second
+	}
+	return p.LeaseDuration
+}
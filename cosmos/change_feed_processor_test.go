@@ -0,0 +1,96 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFeedProcessor(t *testing.T) {
+	doc := func(id string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "userId": "u", "_etag": "etag", "_ts": 1}
+	}
+	feed := mockCosmosFeed{Pages: map[string][][]map[string]interface{}{
+		"0": {{doc("a"), doc("b")}, {doc("c")}},
+		"1": {{doc("d")}},
+	}}
+	leases := mockCosmosEtags{Documents: make(map[string]map[string]interface{})}
+	var handled []string
+	var handlerErr error
+	newProcessor := func(owner string) *ChangeFeedProcessor {
+		return &ChangeFeedProcessor{
+			Feed:   Collection{Client: &feed, DbName: "mydb", Name: "feed", PartitionKey: "userId"},
+			Leases: Collection{Client: &leases, DbName: "mydb", Name: "leases", PartitionKey: "processor"},
+			Name:   "orders",
+			Owner:  owner,
+			Handler: func(ctx context.Context, rangeId string, docs []json.RawMessage) error {
+				if handlerErr != nil {
+					return handlerErr
+				}
+				for _, raw := range docs {
+					var d struct {
+						Id string `json:"id"`
+					}
+					require.NoError(t, json.Unmarshal(raw, &d))
+					handled = append(handled, rangeId+":"+d.Id)
+				}
+				return nil
+			},
+		}
+	}
+	ctx := context.Background()
+
+	// Alone, an instance takes all the ranges
+	a := newProcessor("a")
+	require.NoError(t, a.Poll(ctx))
+	require.Equal(t, []string{"0:a", "0:b", "0:c", "1:d"}, handled)
+	require.Equal(t, "orders", leases.Documents["orders.0"]["processor"])
+	require.Equal(t, "0-2", leases.Documents["orders.0"]["continuation"])
+	require.Equal(t, "1-1", leases.Documents["orders.1"]["continuation"])
+	require.Equal(t, "a", leases.Documents["orders.0"]["owner"])
+	require.Equal(t, "a", leases.Documents["orders.1"]["owner"])
+
+	// A second instance takes a range from the first, which notices on its next poll
+	b := newProcessor("b")
+	require.NoError(t, b.Poll(ctx))
+	require.Equal(t, "b", leases.Documents["orders.0"]["owner"])
+	require.NoError(t, a.Poll(ctx))
+	require.Equal(t, "b", leases.Documents["orders.0"]["owner"])
+	require.Equal(t, "a", leases.Documents["orders.1"]["owner"])
+
+	// Changes are handled by the owner of the range
+	handled = nil
+	feed.Pages["0"] = append(feed.Pages["0"], []map[string]interface{}{doc("e")})
+	feed.Pages["1"] = append(feed.Pages["1"], []map[string]interface{}{doc("f")})
+	require.NoError(t, a.Poll(ctx))
+	require.Equal(t, []string{"1:f"}, handled)
+	require.NoError(t, b.Poll(ctx))
+	require.Equal(t, []string{"1:f", "0:e"}, handled)
+
+	// A batch the handler fails on is not checkpointed, and handled again
+	handled = nil
+	feed.Pages["1"] = append(feed.Pages["1"], []map[string]interface{}{doc("g")})
+	handlerErr = errors.New("handler failed")
+	require.Error(t, a.Poll(ctx))
+	require.Equal(t, "1-2", leases.Documents["orders.1"]["continuation"])
+	handlerErr = nil
+	require.NoError(t, a.Poll(ctx))
+	require.Equal(t, []string{"1:g"}, handled)
+	require.Equal(t, "1-3", leases.Documents["orders.1"]["continuation"])
+
+	// Released leases are taken over at once
+	require.NoError(t, a.Release(ctx))
+	require.Equal(t, "", leases.Documents["orders.1"]["owner"])
+	require.NoError(t, b.Poll(ctx))
+	require.Equal(t, "b", leases.Documents["orders.1"]["owner"])
+
+	// Run releases the leases when the context is done
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.NoError(t, b.Run(cancelled))
+	require.Equal(t, "", leases.Documents["orders.0"]["owner"])
+	require.Equal(t, "", leases.Documents["orders.1"]["owner"])
+}
@@ -0,0 +1,34 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedSince(t *testing.T) {
+	mock := mockCosmosQuery{Pages: []string{
+		`[{"id": "a", "_ts": 100, "userId": "u", "x": 1},
+		  {"id": "b", "_ts": 101, "userId": "u", "x": 2},
+		  {"id": "c", "_ts": 101, "userId": "u", "x": 3}]`,
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var entities []MyModel
+	watermark, err := c.ChangedSince("u", Watermark{Ts: 100, Ids: []string{"a"}}, &entities)
+	require.NoError(t, err)
+	require.Len(t, entities, 2)
+	require.Equal(t, "b", entities[0].Id)
+	require.Equal(t, Watermark{Ts: 101, Ids: []string{"b", "c"}}, watermark)
+	require.Equal(t, "SELECT * FROM c WHERE c.userId = @partitionValue AND c._ts >= @ts ORDER BY c._ts", mock.GotQueries[0].Query)
+	require.Equal(t, int64(100), mock.GotQueries[0].Params[1].Value)
+
+	// Nothing new
+	mock = mockCosmosQuery{Pages: []string{`[{"id": "b", "_ts": 101, "userId": "u"}, {"id": "c", "_ts": 101, "userId": "u"}]`}}
+	next, err := c.ChangedSince("u", watermark, &entities)
+	require.NoError(t, err)
+	require.Empty(t, entities)
+	require.Equal(t, watermark, next)
+
+	require.Equal(t, []string{"/userId/?", "/_ts/?"}, queryPropertyPaths(c.ChangedSinceQuery()))
+}
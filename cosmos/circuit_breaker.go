@@ -0,0 +1,190 @@
+package cosmos
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+var CircuitOpenError = errors.New("Circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets all operations through (the normal state)
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails operations fast, or passes them to the fallback
+	CircuitOpen
+	// CircuitHalfOpen lets a single probe operation through, to find out whether to close the circuit
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerConfig configures a CircuitBreaker; zero values give the defaults
+type CircuitBreakerConfig struct {
+	// ErrorRate is the fraction of failed operations that opens the circuit (default 0.5)
+	ErrorRate float64
+	// MinOperations is the number of operations needed within Window before the error rate is
+	// considered (default 20)
+	MinOperations int
+	// Window is the period the error rate is computed over (default 10s)
+	Window time.Duration
+	// OpenFor is how long the circuit stays open before an operation is let through as a probe
+	// (default 5s)
+	OpenFor time.Duration
+	// Fallback, if set, is called instead of gets and queries while the circuit is open, and its result
+	// returned; e.g. to populate op.Entity of a get from a stale cache. Writes, and reads when Fallback
+	// is not set, fail with CircuitOpenError, so that a write is never reported as done when it was not.
+	Fallback func(op Operation) error
+	// IsFailure decides which errors count as failures. By default, timeouts, network errors, 500 Internal
+	// Server Error, 503 Service Unavailable and running out of retries do; but not e.g. ErrNotFound,
+	// ErrPreconditionFailed, cancelled contexts, or errors returned by hooks and interceptors.
+	IsFailure func(err error) bool
+}
+
+// CircuitBreaker fails operations fast after many of them have failed, so that an unavailable Cosmos
+// does not tie up callers in timeouts. When the circuit has been open for a while, an operation is let
+// through as a probe, and if it succeeds the circuit is closed again. Attach it to collections with
+// WithCircuitBreaker; typically one CircuitBreaker is used per collection.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+	now    func() time.Time
+
+	mu          sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	operations  int
+	failures    int
+	openedAt    time.Time
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.ErrorRate == 0 {
+		config.ErrorRate = 0.5
+	}
+	if config.MinOperations == 0 {
+		config.MinOperations = 20
+	}
+	if config.Window == 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.OpenFor == 0 {
+		config.OpenFor = 5 * time.Second
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = isServiceFailure
+	}
+	return &CircuitBreaker{config: config, now: time.Now}
+}
+
+// isServiceFailure returns true for errors from Cosmos or the network that tell that the service is
+// struggling; errors from the application, e.g. returned by hooks or interceptors, do not count
+func isServiceFailure(err error) bool {
+	cause := errors.Cause(err)
+	switch cause {
+	case cosmosapi.ErrTimeout, cosmosapi.ErrInternalError, cosmosapi.ErrUnavailable, cosmosapi.ErrMaxRetriesExceeded,
+		context.DeadlineExceeded:
+		return true
+	}
+	_, isNetError := cause.(net.Error)
+	return isNetError
+}
+
+// State returns the current state of the circuit
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.config.OpenFor {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow returns whether an operation may be done, and whether it is a probe
+func (b *CircuitBreaker) allow() (allowed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitClosed:
+		return true, false
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) >= b.config.OpenFor {
+			b.state = CircuitHalfOpen
+			return true, true
+		}
+	}
+	// Open, or half-open with a probe in flight
+	return false, false
+}
+
+// record records the outcome of an operation that was let through
+func (b *CircuitBreaker) record(failed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if probe {
+		if failed {
+			b.state, b.openedAt = CircuitOpen, now
+		} else {
+			b.state, b.windowStart, b.operations, b.failures = CircuitClosed, now, 0, 0
+		}
+		return
+	}
+	if b.state != CircuitClosed {
+		// Operations let through before the circuit was opened
+		return
+	}
+	if now.Sub(b.windowStart) >= b.config.Window {
+		b.windowStart, b.operations, b.failures = now, 0, 0
+	}
+	b.operations++
+	if failed {
+		b.failures++
+	}
+	if b.operations >= b.config.MinOperations && float64(b.failures) >= b.config.ErrorRate*float64(b.operations) {
+		b.state, b.openedAt = CircuitOpen, now
+	}
+}
+
+func (b *CircuitBreaker) interceptor(op Operation, next func() error) error {
+	if op.batched {
+		// The request is already counted through the first operation of the batch
+		return next()
+	}
+	allowed, probe := b.allow()
+	if !allowed {
+		if b.config.Fallback != nil && (op.Kind == OperationGet || op.Kind == OperationQuery) {
+			return b.config.Fallback(op)
+		}
+		return errors.Wrapf(CircuitOpenError, "%s id='%s' partitionValue='%v'", op.Kind, op.Id, op.PartitionKey)
+	}
+	// Record the outcome even if next() panics, as a failure, so that a probe does not leave the circuit
+	// half-open forever
+	failed := true
+	defer func() { b.record(failed, probe) }()
+	err := next()
+	failed = err != nil && b.config.IsFailure(err)
+	return err
+}
+
+// WithCircuitBreaker returns a Collection where all operations pass through breaker, also through
+// sessions created from it
+func (c Collection) WithCircuitBreaker(breaker *CircuitBreaker) Collection {
+	return c.WithInterceptor(breaker.interceptor)
+}
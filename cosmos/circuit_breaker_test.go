@@ -0,0 +1,130 @@
+package cosmos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "partitionvalue"}
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{MinOperations: 4, OpenFor: time.Second})
+	breaker.now = func() time.Time { return now }
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithCircuitBreaker(breaker)
+	get := func() error {
+		var entity MyModel
+		return c.StaleGet("partitionvalue", "idvalue", &entity)
+	}
+
+	// Errors that are not service failures do not count
+	mock.ReturnError = cosmosapi.ErrPreconditionFailed
+	for i := 0; i < 4; i++ {
+		require.Error(t, get())
+	}
+	assert.Equal(t, CircuitClosed, breaker.State())
+
+	// 2 failures out of 4 within a window opens the circuit
+	now = now.Add(time.Minute)
+	mock.ReturnError = nil
+	require.NoError(t, get())
+	require.NoError(t, get())
+	mock.ReturnError = cosmosapi.ErrUnavailable
+	require.Error(t, get())
+	assert.Equal(t, CircuitClosed, breaker.State())
+	require.Error(t, get())
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	mock.ReturnError = nil
+	mock.GotMethod = ""
+	assert.Equal(t, CircuitOpenError, errors.Cause(get()))
+	assert.Equal(t, "", mock.GotMethod)
+
+	// A failing probe opens it again
+	now = now.Add(time.Second)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	mock.ReturnError = cosmosapi.ErrTimeout
+	assert.Equal(t, cosmosapi.ErrTimeout, errors.Cause(get()))
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// A successful probe closes it
+	now = now.Add(time.Second)
+	mock.ReturnError = nil
+	require.NoError(t, get())
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestCircuitBreakerFallback(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "partitionvalue", ReturnError: cosmosapi.ErrUnavailable}
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{MinOperations: 1, Fallback: func(op Operation) error {
+		op.Entity.(*MyModel).X = 42
+		return nil
+	}})
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithCircuitBreaker(breaker)
+
+	var entity MyModel
+	require.Error(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	require.NoError(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	assert.Equal(t, 42, entity.X)
+
+	// Writes are not passed to the fallback, as that would report them as done
+	entity.Etag = "etag"
+	assert.Equal(t, CircuitOpenError, errors.Cause(c.RacingPut(&entity)))
+}
+
+func TestCircuitBreakerProbePanic(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "partitionvalue", ReturnError: cosmosapi.ErrUnavailable}
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{MinOperations: 1, OpenFor: time.Second})
+	breaker.now = func() time.Time { return now }
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithCircuitBreaker(breaker)
+	var entity MyModel
+	require.Error(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	require.Equal(t, CircuitOpen, breaker.State())
+
+	// A probe that panics counts as a failure
+	now = now.Add(time.Second)
+	panicking := c.WithInterceptor(func(op Operation, next func() error) error { panic("boom") })
+	require.Panics(t, func() { _ = panicking.StaleGet("partitionvalue", "idvalue", &entity) })
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// so that another probe is let through later
+	now = now.Add(time.Second)
+	mock.ReturnError = nil
+	require.NoError(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+// invalidModel fails validation in its pre-put hook
+type invalidModel struct {
+	BaseModel
+	Model  string `json:"model" cosmosmodel:"invalidModel/1"`
+	UserId string `json:"userId"`
+}
+
+func (e *invalidModel) PrePut(txn *Transaction) error  { return errors.New("invalid") }
+func (e *invalidModel) PostGet(txn *Transaction) error { return nil }
+
+func TestCircuitBreakerApplicationErrors(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "partitionvalue"}
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{MinOperations: 1})
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithCircuitBreaker(breaker)
+
+	// Errors from hooks and inner interceptors are not failures of Cosmos
+	require.Error(t, c.RacingPut(&invalidModel{BaseModel: BaseModel{Id: "idvalue"}, UserId: "partitionvalue"}))
+	denying := c.WithInterceptor(func(op Operation, next func() error) error { return errors.New("denied") })
+	var entity MyModel
+	require.Error(t, denying.StaleGet("partitionvalue", "idvalue", &entity))
+	assert.Equal(t, CircuitClosed, breaker.State())
+
+	// but they count as operations, so it takes 2 failures of Cosmos to make half of them fail
+	mock.ReturnError = cosmosapi.ErrUnavailable
+	require.Error(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	assert.Equal(t, CircuitClosed, breaker.State())
+	require.Error(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	assert.Equal(t, CircuitOpen, breaker.State())
+}
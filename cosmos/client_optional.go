@@ -0,0 +1,52 @@
+package cosmos
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// notImplementedBy is returned when the Client of a collection does not implement an optional interface
+func notImplementedBy(client Client, method string) error {
+	return errors.Wrapf(cosmosapi.ErrorNotImplemented, "%T does not implement %s", client, method)
+}
+
+// upsertDocument calls UpsertDocument on the Client, if it implements DocumentUpserter
+func (c Collection) upsertDocument(ctx context.Context, doc interface{},
+	ops cosmosapi.UpsertDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	upserter, ok := c.Client.(DocumentUpserter)
+	if !ok {
+		return nil, cosmosapi.DocumentResponse{}, notImplementedBy(c.Client, "UpsertDocument")
+	}
+	return upserter.UpsertDocument(ctx, c.DbName, c.Name, doc, ops)
+}
+
+// deleteDocument calls DeleteDocument on the Client, if it implements DocumentDeleter
+func (c Collection) deleteDocument(ctx context.Context, id string, ops cosmosapi.DeleteDocumentOptions) (cosmosapi.DocumentResponse, error) {
+	deleter, ok := c.Client.(DocumentDeleter)
+	if !ok {
+		return cosmosapi.DocumentResponse{}, notImplementedBy(c.Client, "DeleteDocument")
+	}
+	return deleter.DeleteDocument(ctx, c.DbName, c.Name, id, ops)
+}
+
+// patchDocument calls PatchDocument on the Client, if it implements DocumentPatcher
+func (c Collection) patchDocument(ctx context.Context, id string, operations []cosmosapi.PatchOperation,
+	ops cosmosapi.PatchDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	patcher, ok := c.Client.(DocumentPatcher)
+	if !ok {
+		return cosmosapi.DocumentResponse{}, notImplementedBy(c.Client, "PatchDocument")
+	}
+	return patcher.PatchDocument(ctx, c.DbName, c.Name, id, operations, ops, out)
+}
+
+// executeBatch calls ExecuteBatch on the Client, if it implements BatchExecutor
+func (c Collection) executeBatch(ctx context.Context, operations []cosmosapi.BatchOperation,
+	ops cosmosapi.BatchOptions) (cosmosapi.BatchResponse, error) {
+	executor, ok := c.Client.(BatchExecutor)
+	if !ok {
+		return cosmosapi.BatchResponse{}, notImplementedBy(c.Client, "ExecuteBatch")
+	}
+	return executor.ExecuteBatch(ctx, c.DbName, c.Name, operations, ops)
+}
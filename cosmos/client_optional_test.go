@@ -0,0 +1,51 @@
+package cosmos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestOptionalClientInterfaces(t *testing.T) {
+	// mockCosmos only implements Client, as an implementation from before the optional interfaces would
+	mock := mockCosmos{ReturnUserId: "partitionvalue", ReturnEtag: "etag-1"}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	_, _, err := c.upsertDocument(context.Background(), map[string]interface{}{"id": "a"}, cosmosapi.UpsertDocumentOptions{})
+	require.Equal(t, cosmosapi.ErrorNotImplemented, errors.Cause(err))
+
+	err = c.Patch("partitionvalue", "idvalue", "", nil, cosmosapi.PatchSet("/x", 1))
+	require.Equal(t, cosmosapi.ErrorNotImplemented, errors.Cause(err))
+
+	// Transactions committed as patches fall back to replacing the document
+	require.NoError(t, c.Session().WithCommitMode(CommitPatch).Transaction(func(txn *Transaction) error {
+		var entity MyModel
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		entity.X = 2
+		txn.Put(&entity)
+		return nil
+	}))
+	require.Equal(t, "replace", mock.GotMethod)
+
+	err = c.Session().Transaction(func(txn *Transaction) error {
+		var entity MyModel
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Delete(&entity)
+		return nil
+	})
+	require.Equal(t, cosmosapi.ErrorNotImplemented, errors.Cause(err))
+
+	// Several writes are committed in a batch, which mockCosmos can not execute
+	err = c.Session().Transaction(func(txn *Transaction) error {
+		var a, b MyModel
+		require.NoError(t, txn.Get("partitionvalue", "a", &a))
+		require.NoError(t, txn.Get("partitionvalue", "b", &b))
+		txn.Put(&a)
+		txn.Put(&b)
+		return nil
+	})
+	require.Equal(t, cosmosapi.ErrorNotImplemented, errors.Cause(err))
+}
@@ -0,0 +1,98 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosBlockingGet struct {
+	mockCosmos
+	calls   int32
+	release chan struct{}
+}
+
+func (mock *mockCosmosBlockingGet) GetDocument(ctx context.Context,
+	dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	atomic.AddInt32(&mock.calls, 1)
+	<-mock.release
+	doc := `{"id": "` + id + `", "_etag": "etag-1", "model": "MyModel/1", "userId": "alice", "x": 42, "name": "Alice"}`
+	return cosmosapi.DocumentResponse{}, json.Unmarshal([]byte(doc), out)
+}
+
+// myModelSummary is another model type reading the same documents as MyModel, with a field that MyModel lacks
+type myModelSummary struct {
+	BaseModel
+	UserId string `json:"userId"`
+	Name   string `json:"name"`
+}
+
+func (e *myModelSummary) PrePut(txn *Transaction) error  { return nil }
+func (e *myModelSummary) PostGet(txn *Transaction) error { return nil }
+
+func TestRequestCoalescing(t *testing.T) {
+	mock := &mockCosmosBlockingGet{release: make(chan struct{})}
+	c := Collection{
+		Client:       mock,
+		DbName:       "mydb",
+		Name:         "mycollection",
+		PartitionKey: "userId"}.WithRequestCoalescing()
+
+	const n = 10
+	results := make([]MyModel, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	get := func(i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.StaleGet("alice", "id1", &results[i])
+		}()
+	}
+
+	// Once the first request is in flight, the other callers join it
+	get(0)
+	for atomic.LoadInt32(&mock.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i != n; i++ {
+		get(i)
+	}
+
+	// A caller with another model type gets the fields of its own type from the shared read
+	var summary myModelSummary
+	var summaryErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		summaryErr = c.StaleGet("alice", "id1", &summary)
+	}()
+
+	// A caller whose context is cancelled stops waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var cancelled MyModel
+	require.Equal(t, context.Canceled, errors.Cause(c.WithContext(ctx).StaleGet("alice", "id1", &cancelled)))
+
+	time.Sleep(10 * time.Millisecond)
+	close(mock.release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&mock.calls))
+	for i := 0; i != n; i++ {
+		require.NoError(t, errs[i])
+		require.Equal(t, 42, results[i].X)
+		require.Equal(t, 43, results[i].XPlusOne)
+	}
+	require.NoError(t, summaryErr)
+	require.Equal(t, "Alice", summary.Name)
+	require.Equal(t, "etag-1", summary.Etag)
+	require.Equal(t, 0, len(c.flights.calls))
+}
@@ -2,8 +2,10 @@ package cosmos
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/vippsas/go-cosmosdb/cosmosapi"
@@ -22,6 +24,15 @@ type Collection struct {
 	Context      context.Context
 
 	sessionSlotIndex int
+	entityCache      *entityCacheConfig
+	flights          *flightGroup
+	hooks            *registeredHooks
+	interceptors     []Interceptor
+	validation       *ValidationSpec
+	sanityChecks     *sanityCheckConfig
+	staleIfError     time.Duration
+	adapter          DocumentAdapter
+	pageSize         *AdaptivePageSize
 }
 
 func (c Collection) GetContext() context.Context {
@@ -32,6 +43,8 @@ func (c Collection) GetContext() context.Context {
 	}
 }
 
+// WithContext returns a collection doing its requests to Cosmos with ctx. The methods with a Context
+// suffix, e.g. StaleGetContext, are shorthands for this.
 func (c Collection) WithContext(ctx context.Context) Collection {
 	c.Context = ctx // note that c is not a pointer
 	return c
@@ -48,136 +61,204 @@ func (c Collection) Init() Collection {
 func (c Collection) get(ctx context.Context, partitionValue interface{}, id string, target Model, consistency cosmosapi.ConsistencyLevel, sessionToken string) (cosmosapi.DocumentResponse, error) {
 	docResp, err := c.getExisting(ctx, partitionValue, id, target, consistency, sessionToken)
 	if err != nil && errors.Cause(err) == cosmosapi.ErrNotFound {
-		err = nil
-		c.initializeEmptyDoc(partitionValue, id, target)
+		err = c.initializeEmptyDoc(partitionValue, id, target)
 	}
 	if err == nil {
-		res, partitionValueField := c.getEntityInfo(target)
-		if res.Id != id {
-			return docResp, errors.Errorf(fmtUnexpectedIdError, id, res.Id)
-		}
-		if partitionValueField.Interface() != partitionValue {
-			return docResp, errors.Errorf(fmtUnexpectedPartitionKeyValueError, partitionValue, partitionValueField.Interface())
-		}
+		err = c.checkFetched(partitionValue, id, target)
 	}
 	return docResp, err
 }
 
-func (c Collection) initializeEmptyDoc(partitionValue interface{}, id string, target Model) {
-	res, partitionValueField := c.getEntityInfo(target)
+// revalidate checks whether target, which holds a previously fetched version of the document, is still
+// current by fetching with If-None-Match. If the document has changed, target is overwritten with the
+// new version (or zero-initialized if it has been deleted) and modified is true.
+func (c Collection) revalidate(ctx context.Context, partitionValue interface{}, id string, target Model, sessionToken string) (
+	response cosmosapi.DocumentResponse, modified bool, err error) {
+
+	base, _, err := c.getEntityInfo(target)
+	if err != nil {
+		return response, false, err
+	}
+	// Fetch into a fresh instance, as unmarshalling into target would leave fields that are not
+	// present in the new version of the document untouched
+	fresh := reflect.New(reflect.TypeOf(target).Elem()).Interface().(Model)
+	opts := cosmosapi.GetDocumentOptions{
+		PartitionKeyValue: partitionValue,
+		ConsistencyLevel:  cosmosapi.ConsistencyLevelSession,
+		SessionToken:      sessionToken,
+		IfNoneMatch:       base.Etag,
+	}
+	out, unmarshal := c.adaptedOut(fresh)
+	response, err = c.Client.GetDocument(ctx, c.DbName, c.Name, id, opts, out)
+	if errors.Cause(err) == cosmosapi.ErrNotFound {
+		return response, true, c.initializeEmptyDoc(partitionValue, id, target)
+	} else if err != nil {
+		return response, false, errors.Wrap(err, fmt.Sprintf("id='%s' partitionValue='%v'", id, partitionValue))
+	} else if response.NotModified {
+		return response, false, nil
+	} else if err := unmarshal(); err != nil {
+		return response, false, err
+	}
+	if err := c.checkFetched(partitionValue, id, fresh); err != nil {
+		return response, false, err
+	}
+	reflect.ValueOf(target).Elem().Set(reflect.ValueOf(fresh).Elem())
+	return response, true, nil
+}
+
+func (c Collection) initializeEmptyDoc(partitionValue interface{}, id string, target Model) error {
+	res, _, err := c.getEntityInfo(target)
+	if err != nil {
+		return err
+	}
 	// To be bullet-proof, make sure to zero out the target. It could e.g. be used for other purposes in a loop,
 	// it is nice to be able to rely on zeroing out on not-found
 	val := reflect.ValueOf(target).Elem()
 	zero := reflect.Zero(val.Type())
 	val.Set(zero)
 	// Then write the ID information so that Put() will work after populating the entity
-	partitionValueField.Set(reflect.ValueOf(partitionValue))
 	res.Id = id
+	return c.setPartitionValue(target, partitionValue)
 }
 
 func (c Collection) getExisting(ctx context.Context, partitionValue interface{}, id string, target Model, consistency cosmosapi.ConsistencyLevel, sessionToken string) (cosmosapi.DocumentResponse, error) {
+	if c.flights != nil && consistency == cosmosapi.ConsistencyLevelEventual && sessionToken == "" {
+		return c.coalescedGetExisting(ctx, partitionValue, id, target)
+	}
+	return c.fetch(ctx, partitionValue, id, target, consistency, sessionToken)
+}
+
+func (c Collection) fetch(ctx context.Context, partitionValue interface{}, id string, target Model, consistency cosmosapi.ConsistencyLevel, sessionToken string) (cosmosapi.DocumentResponse, error) {
 	opts := cosmosapi.GetDocumentOptions{
 		PartitionKeyValue: partitionValue,
 		ConsistencyLevel:  consistency,
 		SessionToken:      sessionToken,
 	}
-	docResp, err := c.Client.GetDocument(ctx, c.DbName, c.Name, id, opts, target)
+	out, unmarshal := c.adaptedOut(target)
+	docResp, err := c.Client.GetDocument(ctx, c.DbName, c.Name, id, opts, out)
 	if err != nil {
-		return docResp, errors.Wrap(err, fmt.Sprintf("id='%s' partitionValue='%s'", id, partitionValue))
+		return docResp, errors.Wrap(err, fmt.Sprintf("id='%s' partitionValue='%v'", id, partitionValue))
 	}
-	return docResp, nil
+	return docResp, unmarshal()
 }
 
 // StaleGet reads an element from the database. `target` should be a pointer to a struct
 // that empeds BaseModel. If the document does not exist, the recipient
 // struct is filled with the zero-value, including Etag which will become an empty String.
 func (c Collection) StaleGet(partitionValue interface{}, id string, target Model) error {
-	_, err := c.get(c.GetContext(), partitionValue, id, target, cosmosapi.ConsistencyLevelEventual, "")
-	if err == nil {
-		err = postGet(target.(Model), nil)
-	}
+	_, err := c.StaleGetWithResponse(partitionValue, id, target)
 	return err
 }
 
+// StaleGetContext is like StaleGet, but does the request with ctx
+func (c Collection) StaleGetContext(ctx context.Context, partitionValue interface{}, id string, target Model) error {
+	return c.WithContext(ctx).StaleGet(partitionValue, id, target)
+}
+
+// StaleGetWithResponse is like StaleGet, but also returns the response from Cosmos, giving access to
+// e.g. the request charge. The response is empty if the entity was served from the entity cache.
+func (c Collection) StaleGetWithResponse(partitionValue interface{}, id string, target Model) (response cosmosapi.DocumentResponse, err error) {
+	info, err := c.cachedGet(partitionValue, id, target, false)
+	return info.Response, err
+}
+
 // StaleGetExisting is similar to StaleGet, but returns an error if
 // the document is not found instead of an empty document.  Test for
 // this condition using errors.Cause(e) == cosmosapi.ErrNotFound
 func (c Collection) StaleGetExisting(partitionValue interface{}, id string, target Model) error {
-	_, err := c.getExisting(c.GetContext(), partitionValue, id, target, cosmosapi.ConsistencyLevelEventual, "")
-	if err == nil {
-		err = postGet(target.(Model), nil)
-	}
+	_, err := c.StaleGetExistingWithResponse(partitionValue, id, target)
 	return err
 }
 
-// GetEntityInfo uses reflection to return information about the entity
-// without each entity having to implement getters. One should pass a pointer
-// to a struct that embeds "BaseModel" as well as a field having the partition field
-// name; failure to do so will panic.
-//
-// Note: GetEntityInfo will also always assert that the Model property is set to the declared
-// value
-func (c Collection) GetEntityInfo(entityPtr Model) (res BaseModel, partitionValue interface{}) {
-	resPtr, partitionValueField := c.getEntityInfo(entityPtr)
-	return *resPtr, partitionValueField.Interface()
+// StaleGetExistingContext is like StaleGetExisting, but does the request with ctx
+func (c Collection) StaleGetExistingContext(ctx context.Context, partitionValue interface{}, id string, target Model) error {
+	return c.WithContext(ctx).StaleGetExisting(partitionValue, id, target)
 }
 
-func (c Collection) getEntityInfo(entityPtr Model) (res *BaseModel, partitionValueField reflect.Value) {
-	if c.PartitionKey == "" {
-		panic(errors.Errorf("Please initialize PartitionKey in your Collection struct"))
-	}
-	defer func() {
-		if e := recover(); e != nil {
-			panic(errors.Errorf("Need to pass in a pointer to a struct with fields named 'BaseModel' and a tag 'json:\"%s\"', got: %s", c.PartitionKey, fmt.Sprintf("%v", entityPtr)))
+// StaleGetExistingWithResponse is like StaleGetExisting, but also returns the response from Cosmos.
+// The response is empty if the entity was served from the entity cache.
+func (c Collection) StaleGetExistingWithResponse(partitionValue interface{}, id string, target Model) (response cosmosapi.DocumentResponse, err error) {
+	info, err := c.cachedGet(partitionValue, id, target, true)
+	return info.Response, err
+}
+
+// cachedGet reads through the entity cache, for StaleGet (or StaleGetExisting if existing is true)
+func (c Collection) cachedGet(partitionValue interface{}, id string, target Model, existing bool) (info ReadInfo, err error) {
+	err = c.intercept(Operation{Kind: OperationGet, PartitionKey: partitionValue, Id: id, Entity: target}, func() error {
+		cached, age, found, err := c.entityCacheGet(partitionValue, id)
+		if err != nil {
+			return err
 		}
-	}()
-
-	v := reflect.ValueOf(entityPtr).Elem()
-	structT := v.Type()
-	res = v.FieldByName("BaseModel").Addr().Interface().(*BaseModel)
-	n := structT.NumField()
-	found := false
-	if c.PartitionKey == "id" {
-		partitionValueField = reflect.ValueOf(res).Elem().FieldByName("Id")
-		found = true
-	} else {
-		for i := 0; i != n; i++ {
-			field := structT.Field(i)
-			if field.Tag.Get("json") == c.PartitionKey {
-				partitionValueField = v.Field(i)
-				found = true
-				break
+		if found && (c.staleIfError == 0 || age < c.entityCache.ttl) {
+			info.FromCache, info.Age = true, age
+			err = errors.WithStack(json.Unmarshal(cached, target))
+		} else {
+			if existing {
+				info.Response, err = c.getExisting(c.GetContext(), partitionValue, id, target, cosmosapi.ConsistencyLevelEventual, "")
+			} else {
+				info.Response, err = c.get(c.GetContext(), partitionValue, id, target, cosmosapi.ConsistencyLevelEventual, "")
+			}
+			if err == nil {
+				err = c.entityCacheSet(partitionValue, id, target)
+			} else if found && isTemporaryReadError(err) {
+				info.FromCache, info.Stale, info.Age, info.Err = true, true, age, err
+				// The failed read may have filled in parts of target
+				val := reflect.ValueOf(target).Elem()
+				val.Set(reflect.Zero(val.Type()))
+				err = errors.WithStack(json.Unmarshal(cached, target))
 			}
 		}
-	}
-	if !found {
-		panic(errors.New(""))
-	}
+		if err == nil {
+			err = c.postGet(target.(Model), nil)
+		}
+		return err
+	})
 	return
 }
 
-func (c Collection) put(ctx context.Context, entityPtr Model, base BaseModel, partitionValue interface{}, consistent bool) (
+// GetEntityInfo uses reflection to return information about the entity
+// without each entity having to implement getters. One should pass a pointer
+// to a struct that embeds "BaseModel" as well as a field having the partition field
+// name; failure to do so will panic with an EntityInfoError. Use PartitionKeyOf to
+// get an error instead.
+func (c Collection) GetEntityInfo(entityPtr Model) (res BaseModel, partitionValue interface{}) {
+	resPtr, partitionValue, err := c.getEntityInfo(entityPtr)
+	if err != nil {
+		panic(err)
+	}
+	return *resPtr, partitionValue
+}
+
+func (c Collection) put(ctx context.Context, entityPtr Model, base BaseModel, partitionValue interface{}, match EtagMatch) (
 	resource *cosmosapi.Resource, response cosmosapi.DocumentResponse, err error) {
 
-	// if consistent = false, we always use the database upsert primitive (non-consistent put)
-	// Otherwise, we demand non-existence if entity.Etag==nil, and replace with Etag if entity.Etag!=nil
-	if !consistent || base.Etag == "" {
+	ifMatch, mustNotExist, err := match.ifMatch(base.Etag)
+	if err != nil {
+		return nil, response, err
+	}
+	// With MatchAny, we use the database upsert primitive (non-consistent put). Otherwise, we demand
+	// non-existence by creating, or replace with the etag.
+	if ifMatch == "" {
 		opts := cosmosapi.CreateDocumentOptions{
 			PartitionKeyValue: partitionValue,
-			IsUpsert:          !consistent,
+			IsUpsert:          !mustNotExist,
 		}
 		resource, response, err = c.Client.CreateDocument(ctx, c.DbName, c.Name, entityPtr, opts)
-		if consistent && errors.Cause(err) == cosmosapi.ErrConflict {
+		if mustNotExist && errors.Cause(err) == cosmosapi.ErrConflict {
 			// For consistent creation with Etag="" we translate ErrConflict on creation to ErrPreconditionFailed
 			err = errors.WithStack(cosmosapi.ErrPreconditionFailed)
 		}
 	} else {
 		opts := cosmosapi.ReplaceDocumentOptions{
 			PartitionKeyValue: partitionValue,
-			IfMatch:           base.Etag,
+			IfMatch:           ifMatch,
 		}
 		resource, response, err = c.Client.ReplaceDocument(ctx, c.DbName, c.Name, base.Id, entityPtr, opts)
 	}
+	if err != nil {
+		// The write may or may not have happened, so we can no longer trust what is in the entity cache
+		c.entityCacheDelete(partitionValue, base.Id)
+	}
 	err = errors.WithStack(err)
 	return
 }
@@ -185,25 +266,115 @@ func (c Collection) put(ctx context.Context, entityPtr Model, base BaseModel, pa
 // RacingPut simply does a raw write of document passed in without any considerations about races
 // or consistency. An "upsert" will be performed without any Etag checks. `entityPtr` should be a pointer to the struct
 func (c Collection) RacingPut(entityPtr Model) error {
-	base, partitionValue := c.GetEntityInfo(entityPtr)
+	_, err := c.RacingPutWithResponse(entityPtr)
+	return err
+}
 
-	if err := prePut(entityPtr.(Model), nil); err != nil {
+// RacingPutContext is like RacingPut, but does the request with ctx
+func (c Collection) RacingPutContext(ctx context.Context, entityPtr Model) error {
+	return c.WithContext(ctx).RacingPut(entityPtr)
+}
+
+// RacingPutWithResponse is like RacingPut, but also returns the response from Cosmos.
+func (c Collection) RacingPutWithResponse(entityPtr Model) (response cosmosapi.DocumentResponse, err error) {
+	basePtr, partitionValue, err := c.getEntityInfo(entityPtr)
+	if err != nil {
+		return response, err
+	}
+	base := *basePtr
+
+	err = c.intercept(Operation{Kind: OperationPut, PartitionKey: partitionValue, Id: base.Id, Entity: entityPtr}, func() error {
+		if err := c.prePut(entityPtr.(Model), nil); err != nil {
+			return err
+		}
+
+		var resource *cosmosapi.Resource
+		resource, response, err = c.put(c.GetContext(), entityPtr, base, partitionValue, MatchAny)
+		if err == nil && c.entityCache != nil {
+			// Cache the entity as written, including the new Etag, without modifying the callers copy
+			cached := reflect.New(reflect.ValueOf(entityPtr).Elem().Type())
+			cached.Elem().Set(reflect.ValueOf(entityPtr).Elem())
+			cachedBase, _, _ := c.getEntityInfo(cached.Interface().(Model))
+			*cachedBase = BaseModel(*resource)
+			c.entityCacheWritten(partitionValue, base.Id, cached.Interface().(Model))
+		}
 		return err
+	})
+	return
+}
+
+// Patch applies a partial update to a document server-side, without reading it first. If condition is
+// non-empty (e.g. "FROM c WHERE c.stock >= 5"), the patch is only applied if the document matches it, so
+// that e.g. "decrement stock only if there is enough in stock" can be done atomically without an etag retry
+// loop; if it does not match, an error with cause cosmosapi.ErrPreconditionFailed is returned.
+//
+// If target is not nil, it is populated with the updated document (and the post-get hook is called).
+func (c Collection) Patch(partitionValue interface{}, id string, condition string, target Model, operations ...cosmosapi.PatchOperation) error {
+	return c.patch(partitionValue, id, "", condition, target, operations)
+}
+
+// PatchContext is like Patch, but does the request with ctx
+func (c Collection) PatchContext(ctx context.Context, partitionValue interface{}, id string, condition string, target Model, operations ...cosmosapi.PatchOperation) error {
+	return c.WithContext(ctx).Patch(partitionValue, id, condition, target, operations...)
+}
+
+func (c Collection) patch(partitionValue interface{}, id string, etag string, condition string, target Model, operations []cosmosapi.PatchOperation) error {
+	opts := cosmosapi.PatchDocumentOptions{
+		PartitionKeyValue: partitionValue,
+		Condition:         condition,
+		IfMatch:           etag,
 	}
+	return c.intercept(Operation{Kind: OperationPatch, PartitionKey: partitionValue, Id: id, Entity: target}, func() error {
+		var out interface{}
+		if target != nil {
+			out = target // avoid passing a non-nil interface holding a nil Model
+		}
+		out, unmarshal := c.adaptedOut(out)
+		_, err := c.patchDocument(c.GetContext(), id, operations, opts, out)
+		// Whether or not it succeeded, the patch may have changed the document
+		c.entityCacheDelete(partitionValue, id)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("id='%s' partitionValue='%v'", id, partitionValue))
+		}
+		if target != nil {
+			if err := unmarshal(); err != nil {
+				return err
+			}
+			return c.postGet(target, nil)
+		}
+		return nil
+	})
+}
 
-	_, _, err := c.put(c.GetContext(), entityPtr, base, partitionValue, false)
-	return err
+func (c Collection) Query(query string, entities interface{}) (response cosmosapi.QueryDocumentsResponse, err error) {
+	err = c.intercept(Operation{Kind: OperationQuery, Query: query}, func() error {
+		out, unmarshal := c.adaptedQueryOut(entities)
+		response, err = c.Client.QueryDocuments(c.GetContext(), c.DbName, c.Name, cosmosapi.Query{Query: query}, out, cosmosapi.DefaultQueryDocumentOptions())
+		if err != nil {
+			return err
+		}
+		return unmarshal()
+	})
+	return
 }
 
-func (c Collection) Query(query string, entities interface{}) (cosmosapi.QueryDocumentsResponse, error) {
-	return c.Client.QueryDocuments(c.Context, c.DbName, c.Name, cosmosapi.Query{Query: query}, entities, cosmosapi.DefaultQueryDocumentOptions())
+// QueryContext is like Query, but does the request with ctx
+func (c Collection) QueryContext(ctx context.Context, query string, entities interface{}) (cosmosapi.QueryDocumentsResponse, error) {
+	return c.WithContext(ctx).Query(query, entities)
 }
 
 // Execute a StoredProcedure on the collection
 func (c Collection) ExecuteSproc(sprocName string, partitionKeyValue interface{}, ret interface{}, args ...interface{}) error {
 	opts := cosmosapi.ExecuteStoredProcedureOptions{PartitionKeyValue: partitionKeyValue}
-	return c.Client.ExecuteStoredProcedure(
-		c.GetContext(), c.DbName, c.Name, sprocName, opts, ret, args...)
+	return c.intercept(Operation{Kind: OperationSproc, PartitionKey: partitionKeyValue, Sproc: sprocName}, func() error {
+		return c.Client.ExecuteStoredProcedure(
+			c.GetContext(), c.DbName, c.Name, sprocName, opts, ret, args...)
+	})
+}
+
+// ExecuteSprocContext is like ExecuteSproc, but does the request with ctx
+func (c Collection) ExecuteSprocContext(ctx context.Context, sprocName string, partitionKeyValue interface{}, ret interface{}, args ...interface{}) error {
+	return c.WithContext(ctx).ExecuteSproc(sprocName, partitionKeyValue, ret, args...)
 }
 
 // Retrieve <maxItems> documents that have changed within the partition key range since <etag>. Note that according to
@@ -221,12 +392,26 @@ func (c Collection) ReadFeed(etag, partitionKeyRangeId string, maxItems int, doc
 		PartitionKeyRangeId: partitionKeyRangeId,
 		IfNoneMatch:         etag,
 	}
-	response, err := c.Client.ListDocuments(c.GetContext(), c.DbName, c.Name, &ops, documents)
+	var response cosmosapi.ListDocumentsResponse
+	err := c.intercept(Operation{Kind: OperationList}, func() (err error) {
+		response, err = c.Client.ListDocuments(c.GetContext(), c.DbName, c.Name, &ops, documents)
+		return err
+	})
 	return response, err
 }
 
+// ReadFeedContext is like ReadFeed, but does the request with ctx
+func (c Collection) ReadFeedContext(ctx context.Context, etag, partitionKeyRangeId string, maxItems int, documents interface{}) (cosmosapi.ListDocumentsResponse, error) {
+	return c.WithContext(ctx).ReadFeed(etag, partitionKeyRangeId, maxItems, documents)
+}
+
 func (c Collection) GetPartitionKeyRanges() ([]cosmosapi.PartitionKeyRange, error) {
 	ops := cosmosapi.GetPartitionKeyRangesOptions{}
 	response, err := c.Client.GetPartitionKeyRanges(c.GetContext(), c.DbName, c.Name, &ops)
 	return response.PartitionKeyRanges, err
 }
+
+// GetPartitionKeyRangesContext is like GetPartitionKeyRanges, but does the request with ctx
+func (c Collection) GetPartitionKeyRangesContext(ctx context.Context) ([]cosmosapi.PartitionKeyRange, error) {
+	return c.WithContext(ctx).GetPartitionKeyRanges()
+}
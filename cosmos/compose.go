@@ -0,0 +1,222 @@
+package cosmos
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// Compose returns a Client made from parts implementing some of its methods, typically capability
+// interfaces such as DocumentReader or QueryExecutor. Each call is made on the first part that has
+// the method; methods no part has return NotImplementedError. This lets fakes used in tests implement
+// only what the code under test needs:
+//
+//	c := cosmos.Collection{Client: cosmos.Compose(&myFakeReader{}), DbName: "db", Name: "coll", PartitionKey: "pk"}
+func Compose(parts ...interface{}) Client {
+	return composedClient{parts: parts}
+}
+
+type composedClient struct {
+	parts []interface{}
+}
+
+var (
+	_ Client           = composedClient{}
+	_ DocumentUpserter = composedClient{}
+	_ DocumentDeleter  = composedClient{}
+	_ DocumentPatcher  = composedClient{}
+	_ BatchExecutor    = composedClient{}
+)
+
+func notImplemented(method string) error {
+	return errors.Wrap(NotImplementedError, method+" is not implemented by any of the composed clients")
+}
+
+type documentGetter interface {
+	GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error)
+}
+
+func (c composedClient) GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(documentGetter); ok {
+			return part.GetDocument(ctx, dbName, colName, id, ops, out)
+		}
+	}
+	return cosmosapi.DocumentResponse{}, notImplemented("GetDocument")
+}
+
+type documentCreator interface {
+	CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error)
+}
+
+func (c composedClient) CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(documentCreator); ok {
+			return part.CreateDocument(ctx, dbName, colName, doc, ops)
+		}
+	}
+	return nil, cosmosapi.DocumentResponse{}, notImplemented("CreateDocument")
+}
+
+func (c composedClient) UpsertDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.UpsertDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(DocumentUpserter); ok {
+			return part.UpsertDocument(ctx, dbName, colName, doc, ops)
+		}
+	}
+	return nil, cosmosapi.DocumentResponse{}, notImplemented("UpsertDocument")
+}
+
+type documentReplacer interface {
+	ReplaceDocument(ctx context.Context, dbName, colName, id string, doc interface{}, ops cosmosapi.ReplaceDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error)
+}
+
+func (c composedClient) ReplaceDocument(ctx context.Context, dbName, colName, id string, doc interface{}, ops cosmosapi.ReplaceDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(documentReplacer); ok {
+			return part.ReplaceDocument(ctx, dbName, colName, id, doc, ops)
+		}
+	}
+	return nil, cosmosapi.DocumentResponse{}, notImplemented("ReplaceDocument")
+}
+
+func (c composedClient) PatchDocument(ctx context.Context, dbName, colName, id string, operations []cosmosapi.PatchOperation, ops cosmosapi.PatchDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(DocumentPatcher); ok {
+			return part.PatchDocument(ctx, dbName, colName, id, operations, ops, out)
+		}
+	}
+	return cosmosapi.DocumentResponse{}, notImplemented("PatchDocument")
+}
+
+func (c composedClient) DeleteDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.DeleteDocumentOptions) (cosmosapi.DocumentResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(DocumentDeleter); ok {
+			return part.DeleteDocument(ctx, dbName, colName, id, ops)
+		}
+	}
+	return cosmosapi.DocumentResponse{}, notImplemented("DeleteDocument")
+}
+
+type documentQuerier interface {
+	QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error)
+}
+
+func (c composedClient) QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(documentQuerier); ok {
+			return part.QueryDocuments(ctx, dbName, collName, qry, docs, ops)
+		}
+	}
+	return cosmosapi.QueryDocumentsResponse{}, notImplemented("QueryDocuments")
+}
+
+type documentLister interface {
+	ListDocuments(ctx context.Context, dbName, colName string, ops *cosmosapi.ListDocumentsOptions, docs interface{}) (cosmosapi.ListDocumentsResponse, error)
+}
+
+func (c composedClient) ListDocuments(ctx context.Context, dbName, colName string, ops *cosmosapi.ListDocumentsOptions, docs interface{}) (cosmosapi.ListDocumentsResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(documentLister); ok {
+			return part.ListDocuments(ctx, dbName, colName, ops, docs)
+		}
+	}
+	return cosmosapi.ListDocumentsResponse{}, notImplemented("ListDocuments")
+}
+
+func (c composedClient) GetPartitionKeyRanges(ctx context.Context, dbName, colName string, options *cosmosapi.GetPartitionKeyRangesOptions) (cosmosapi.GetPartitionKeyRangesResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(PartitionKeyRangeReader); ok {
+			return part.GetPartitionKeyRanges(ctx, dbName, colName, options)
+		}
+	}
+	return cosmosapi.GetPartitionKeyRangesResponse{}, notImplemented("GetPartitionKeyRanges")
+}
+
+type collectionGetter interface {
+	GetCollection(ctx context.Context, dbName, colName string) (*cosmosapi.Collection, error)
+}
+
+func (c composedClient) GetCollection(ctx context.Context, dbName, colName string) (*cosmosapi.Collection, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(collectionGetter); ok {
+			return part.GetCollection(ctx, dbName, colName)
+		}
+	}
+	return nil, notImplemented("GetCollection")
+}
+
+type collectionDeleter interface {
+	DeleteCollection(ctx context.Context, dbName, colName string) error
+}
+
+func (c composedClient) DeleteCollection(ctx context.Context, dbName, colName string) error {
+	for _, p := range c.parts {
+		if part, ok := p.(collectionDeleter); ok {
+			return part.DeleteCollection(ctx, dbName, colName)
+		}
+	}
+	return notImplemented("DeleteCollection")
+}
+
+type databaseDeleter interface {
+	DeleteDatabase(ctx context.Context, dbName string, ops *cosmosapi.RequestOptions) error
+}
+
+func (c composedClient) DeleteDatabase(ctx context.Context, dbName string, ops *cosmosapi.RequestOptions) error {
+	for _, p := range c.parts {
+		if part, ok := p.(databaseDeleter); ok {
+			return part.DeleteDatabase(ctx, dbName, ops)
+		}
+	}
+	return notImplemented("DeleteDatabase")
+}
+
+func (c composedClient) ExecuteBatch(ctx context.Context, dbName, colName string, operations []cosmosapi.BatchOperation, ops cosmosapi.BatchOptions) (cosmosapi.BatchResponse, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(BatchExecutor); ok {
+			return part.ExecuteBatch(ctx, dbName, colName, operations, ops)
+		}
+	}
+	return cosmosapi.BatchResponse{}, notImplemented("ExecuteBatch")
+}
+
+type storedProcedureExecutor interface {
+	ExecuteStoredProcedure(ctx context.Context, dbName, colName, sprocName string, ops cosmosapi.ExecuteStoredProcedureOptions, ret interface{}, args ...interface{}) error
+}
+
+func (c composedClient) ExecuteStoredProcedure(ctx context.Context, dbName, colName, sprocName string, ops cosmosapi.ExecuteStoredProcedureOptions, ret interface{}, args ...interface{}) error {
+	for _, p := range c.parts {
+		if part, ok := p.(storedProcedureExecutor); ok {
+			return part.ExecuteStoredProcedure(ctx, dbName, colName, sprocName, ops, ret, args...)
+		}
+	}
+	return notImplemented("ExecuteStoredProcedure")
+}
+
+type offerLister interface {
+	ListOffers(ctx context.Context, ops *cosmosapi.RequestOptions) (*cosmosapi.Offers, error)
+}
+
+func (c composedClient) ListOffers(ctx context.Context, ops *cosmosapi.RequestOptions) (*cosmosapi.Offers, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(offerLister); ok {
+			return part.ListOffers(ctx, ops)
+		}
+	}
+	return nil, notImplemented("ListOffers")
+}
+
+type offerReplacer interface {
+	ReplaceOffer(ctx context.Context, offerOps cosmosapi.OfferReplaceOptions, ops *cosmosapi.RequestOptions) (*cosmosapi.Offer, error)
+}
+
+func (c composedClient) ReplaceOffer(ctx context.Context, offerOps cosmosapi.OfferReplaceOptions, ops *cosmosapi.RequestOptions) (*cosmosapi.Offer, error) {
+	for _, p := range c.parts {
+		if part, ok := p.(offerReplacer); ok {
+			return part.ReplaceOffer(ctx, offerOps, ops)
+		}
+	}
+	return nil, notImplemented("ReplaceOffer")
+}
@@ -0,0 +1,45 @@
+package cosmos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type readerOnly struct {
+	gotId string
+}
+
+func (r *readerOnly) GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	r.gotId = id
+	t := out.(*MyModel)
+	t.Id, t.UserId, t.Etag, t.X = id, "alice", "etag", 1
+	return cosmosapi.DocumentResponse{}, nil
+}
+
+var _ DocumentReader = &readerOnly{}
+
+func TestCompose(t *testing.T) {
+	reader := &readerOnly{}
+	c := Collection{Client: Compose(reader), DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var entity MyModel
+	require.NoError(t, c.StaleGet("alice", "id1", &entity))
+	assert.Equal(t, "id1", reader.gotId)
+	assert.Equal(t, 1, entity.X)
+
+	err := c.RacingPut(&entity)
+	assert.Equal(t, NotImplementedError, errors.Cause(err))
+	assert.Contains(t, err.Error(), "CreateDocument")
+
+	// The first part having a method is used
+	mock := &mockCosmos{ReturnX: 2, ReturnUserId: "alice"}
+	c.Client = Compose(mock, reader)
+	require.NoError(t, c.StaleGet("alice", "id2", &entity))
+	assert.Equal(t, 2, entity.X)
+	assert.Equal(t, "id1", reader.gotId)
+}
@@ -0,0 +1,29 @@
+package cosmos
+
+import "github.com/pkg/errors"
+
+// WithMaxConcurrency returns a Session where at most n operations done on behalf of the session, i.e. its
+// transactions and the operations on its Collection, are in flight at the same time; further operations
+// wait for one to complete (or for their context to be cancelled). This keeps e.g. a single user request
+// that fans out over many goroutines from using all the RUs of the collection and getting other requests
+// throttled. The limit is shared by the sessions derived from the returned one, and an EntityGroup commit
+// counts as a single operation. If n <= 0 there is no limit, and the session is returned unchanged.
+func (session Session) WithMaxConcurrency(n int) Session {
+	if n <= 0 {
+		return session
+	}
+	slots := make(chan struct{}, n)
+	return session.WithInterceptor(func(op Operation, next func() error) error {
+		if op.batched {
+			// The request is already counted through the first operation of the batch
+			return next()
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-op.Context.Done():
+			return errors.WithStack(op.Context.Err())
+		}
+		defer func() { <-slots }()
+		return next()
+	})
+}
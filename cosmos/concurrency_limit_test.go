@@ -0,0 +1,81 @@
+package cosmos
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosSlow struct {
+	Client
+	inFlight, maxInFlight int32
+	// If set, GetDocument signals started and then waits for release instead of sleeping
+	started, release chan struct{}
+}
+
+func (mock *mockCosmosSlow) GetDocument(ctx context.Context,
+	dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	n := atomic.AddInt32(&mock.inFlight, 1)
+	defer atomic.AddInt32(&mock.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&mock.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&mock.maxInFlight, max, n) {
+			break
+		}
+	}
+	if mock.release != nil {
+		mock.started <- struct{}{}
+		<-mock.release
+	} else {
+		time.Sleep(10 * time.Millisecond)
+	}
+	t := out.(*MyModel)
+	t.Id, t.UserId = id, "partitionvalue"
+	return cosmosapi.DocumentResponse{}, nil
+}
+
+func TestSessionMaxConcurrency(t *testing.T) {
+	mock := mockCosmosSlow{}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	session := c.Session().WithMaxConcurrency(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var entity MyModel
+			require.NoError(t, session.Collection.StaleGet("partitionvalue", "idvalue", &entity))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(2), mock.maxInFlight)
+
+	// Waiting operations give up when their context is cancelled
+	mock.started, mock.release = make(chan struct{}), make(chan struct{})
+	session = c.Session().WithMaxConcurrency(1)
+	done := make(chan error)
+	go func() {
+		var entity MyModel
+		done <- session.Collection.StaleGet("partitionvalue", "idvalue", &entity)
+	}()
+	<-mock.started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var entity MyModel
+	err := session.Collection.WithContext(ctx).StaleGet("partitionvalue", "idvalue", &entity)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	close(mock.release)
+	require.NoError(t, <-done)
+
+	// A limit <= 0 means no limit
+	mock.started, mock.release = nil, nil
+	session = c.Session().WithMaxConcurrency(0)
+	require.NoError(t, session.Collection.StaleGet("partitionvalue", "idvalue", &entity))
+}
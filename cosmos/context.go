@@ -10,6 +10,7 @@ type contextKey int
 
 const (
 	ckStateContainer contextKey = iota + 1
+	ckPrincipal
 )
 
 var (
@@ -3,6 +3,7 @@ package cosmos
 import (
 	"context"
 	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
 	"net/http"
 	"testing"
 )
@@ -86,3 +87,51 @@ func TestSessionGetter(tt *testing.T) {
 		})
 	}
 }
+
+type ctxKey struct{}
+
+// contextRecorder records the value of ctxKey in the context of each request
+type contextRecorder struct {
+	mockCosmos
+	got []interface{}
+}
+
+func (r *contextRecorder) GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	r.got = append(r.got, ctx.Value(ctxKey{}))
+	return cosmosapi.DocumentResponse{}, cosmosapi.ErrNotFound
+}
+
+func (r *contextRecorder) CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	r.got = append(r.got, ctx.Value(ctxKey{}))
+	return &cosmosapi.Resource{Etag: "etag"}, cosmosapi.DocumentResponse{}, nil
+}
+
+func (r *contextRecorder) QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	r.got = append(r.got, ctx.Value(ctxKey{}))
+	return cosmosapi.QueryDocumentsResponse{}, nil
+}
+
+func TestContextVariants(t *testing.T) {
+	recorder := &contextRecorder{}
+	c := Collection{Client: recorder, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	entity := MyModel{BaseModel: BaseModel{Id: "id1"}, UserId: "alice", SetByPrePut: "set by pre-put, checked in mock"}
+
+	require.NoError(t, c.StaleGetContext(ctx, "alice", "id1", &MyModel{}))
+	require.NoError(t, c.RacingPutContext(ctx, &entity))
+	_, err := c.QueryContext(ctx, "SELECT * FROM c", &[]MyModel{})
+	require.NoError(t, err)
+	require.NoError(t, c.Session().GetContext(ctx, "alice", "id1", &MyModel{}))
+	require.NoError(t, c.Session().TransactionContext(ctx, func(txn *Transaction) error {
+		var e MyModel
+		return txn.Get("alice", "id2", &e)
+	}))
+	require.Equal(t, []interface{}{"value", "value", "value", "value", "value"}, recorder.got)
+
+	// The old methods use the context of the collection
+	recorder.got = nil
+	require.NoError(t, c.StaleGet("alice", "id1", &MyModel{}))
+	_, err = c.Query("SELECT * FROM c", &[]MyModel{})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{nil, nil}, recorder.got)
+}
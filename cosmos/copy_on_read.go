@@ -0,0 +1,20 @@
+package cosmos
+
+import "reflect"
+
+// WithCopyOnRead returns a session where Transaction.Get always hands back a fresh copy of the entity,
+// decoupled from the session cache and from earlier contents of the target: the target is reset to its zero
+// value before the document is decoded into it, so that e.g. map entries or fields not in the document do
+// not carry over. The session cache is only updated on commit, so that an entity read by a transaction that
+// ends without a Put is read from Cosmos again by the next transaction.
+func (session Session) WithCopyOnRead() Session {
+	session.copyOnRead = true // note: non-pointer receiver
+	return session
+}
+
+// resetEntity sets the entity pointed to by entityPtr to its zero value
+func resetEntity(entityPtr Model) {
+	if v := reflect.ValueOf(entityPtr); v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+}
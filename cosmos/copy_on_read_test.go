@@ -0,0 +1,45 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyOnRead(t *testing.T) {
+	mock := mockCosmos{ReturnEtag: "etag-1", ReturnUserId: "partitionvalue", ReturnX: 1}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	session := c.Session().WithCopyOnRead()
+
+	entity := MyModel{SetByPrePut: "left over"}
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		if err := txn.Get("partitionvalue", "idvalue", &entity); err != nil {
+			return err
+		}
+		entity.X = 100 // mutated, but not put
+		return nil
+	}))
+	assert.Equal(t, "", entity.SetByPrePut)
+	assert.Equal(t, 1, entity.PostGetCounter)
+
+	// The read did not populate the session cache, so the next transaction reads from Cosmos again
+	mock.GotMethod = ""
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		if err := txn.Get("partitionvalue", "idvalue", &entity); err != nil {
+			return err
+		}
+		assert.Equal(t, 1, entity.X)
+		entity.X = 2
+		txn.Put(&entity)
+		return nil
+	}))
+	assert.Equal(t, "replace", mock.GotMethod)
+
+	// The commit updated the session cache
+	mock.GotMethod = ""
+	var fresh MyModel
+	require.NoError(t, session.Get("partitionvalue", "idvalue", &fresh))
+	assert.Equal(t, "", mock.GotMethod)
+	assert.Equal(t, 2, fresh.X)
+}
@@ -0,0 +1,277 @@
+package cosmos_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+	"github.com/vippsas/go-cosmosdb/cosmostest"
+)
+
+// These tests script the calls to Cosmos with cosmostest.Script. They are in package cosmos_test, as
+// cosmostest imports cosmos.
+
+func newScriptedCollection(t *testing.T) (*cosmostest.Script, cosmos.Collection) {
+	script := cosmostest.NewScript(t)
+	return script, cosmos.Collection{Client: script, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+}
+
+// written returns the entity written by a call, after checking that the pre-put hook was called
+func written(t *testing.T, call cosmostest.ScriptCall) *cosmos.MyModel {
+	entity := call.Document.(*cosmos.MyModel)
+	require.Equal(t, "set by pre-put, checked in mock", entity.SetByPrePut)
+	return entity
+}
+
+func TestCollectionRacingPut(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+
+	// RacingPut just does upserts, whether the entity has an etag or not
+	for i := 0; i < 2; i++ {
+		script.ExpectCreate("id1").Inspect(func(call cosmostest.ScriptCall) {
+			require.Equal(t, 1, written(t, call).X)
+			ops := call.Options.(cosmosapi.CreateDocumentOptions)
+			require.Equal(t, "alice", ops.PartitionKeyValue)
+			require.True(t, ops.IsUpsert)
+		})
+	}
+	entity := cosmos.MyModel{BaseModel: cosmos.BaseModel{Id: "id1"}, X: 1, UserId: "alice"}
+	require.NoError(t, c.RacingPut(&entity))
+	entity.Etag = "has an etag"
+	require.NoError(t, c.RacingPut(&entity))
+}
+
+func TestTransactionCacheHappyDay(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+	session := c.Session()
+
+	// The entity does not exist, so the put is a create
+	script.ExpectGet("idvalue").ReturnError(cosmosapi.ErrNotFound)
+	script.ExpectCreate("idvalue").ReturnEtag("etag-1").ReturnSessionToken("session-token-1").
+		Inspect(func(call cosmostest.ScriptCall) {
+			require.Equal(t, 42, written(t, call).X)
+			require.Equal(t, "partitionvalue", call.Options.(cosmosapi.CreateDocumentOptions).PartitionKeyValue)
+		})
+	var entity cosmos.MyModel // in production code this should be declared inside closure, but want more control in this test
+	require.NoError(t, session.Transaction(func(txn *cosmos.Transaction) error {
+		entity.X = -20
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		// due to ErrNotFound, the Get() should zero-initialize to wipe the -20
+		require.Equal(t, 0, entity.X)
+		require.Equal(t, 1, entity.XPlusOne) // PostGetHook called
+		entity.X = 42
+		txn.Put(&entity)
+		return nil
+	}))
+	require.Equal(t, "session-token-1", session.Token())
+	// entity outside of scope should have updated etag (this should typically not be used by code,
+	// but by writing this test it is in the contract as an edge case)
+	require.Equal(t, "etag-1", entity.Etag)
+	// Modify entity here just to make sure it doesn't reflect what is served by cache.
+	entity.X = -10
+
+	// The get is served from the cache, which has the etag returned by the create, so the put is a replace
+	script.ExpectReplace("idvalue").ReturnEtag("etag-2").ReturnSessionToken("session-token-2").
+		Inspect(func(call cosmostest.ScriptCall) {
+			require.Equal(t, 43, written(t, call).X)
+			require.Equal(t, "etag-1", call.Options.(cosmosapi.ReplaceDocumentOptions).IfMatch)
+		})
+	require.NoError(t, session.Transaction(func(txn *cosmos.Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		require.Equal(t, 42, entity.X) // i.e., not the -10 value from above
+		entity.X = 43
+		txn.Put(&entity)
+		return nil
+	}))
+	require.Equal(t, "session-token-2", session.Token())
+
+	// The cache has the etag returned by the replace
+	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
+	require.Equal(t, "etag-2", entity.Etag)
+}
+
+func TestCachedGet(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+	session := c.Session()
+	var entity cosmos.MyModel
+
+	script.ExpectGet("idvalue").Return(map[string]interface{}{"userId": "partitionvalue", "x": 42}).
+		ReturnEtag("etag-1").ReturnSessionToken("session")
+	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
+	require.Equal(t, 42, entity.X)
+	require.Equal(t, 43, entity.XPlusOne) // PostGetHook called
+	require.Equal(t, 1, entity.PostGetCounter)
+
+	// The get hits the cache
+	script.ExpectReplace("idvalue").ReturnEtag("foobar")
+	require.NoError(t, session.Transaction(func(txn *cosmos.Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		require.Equal(t, 42, entity.X)
+		require.Equal(t, 1, entity.PostGetCounter)
+		entity.X = 43
+		txn.Put(&entity)
+		return nil
+	}))
+
+	// The put overwrote the cache
+	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
+	require.Equal(t, 2, entity.PostGetCounter)
+	require.Equal(t, 43, entity.X)
+}
+
+func TestTransactionCollisionAndSessionTracking(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+	session := c.Session()
+
+	// Every attempt reads with the session token returned by the failed commit of the one before
+	sessionTokens := []string{"", "after-0", "after-1"}
+	for i, token := range sessionTokens {
+		expectToken := token
+		script.ExpectGet("idvalue").ReturnError(cosmosapi.ErrNotFound).Inspect(func(call cosmostest.ScriptCall) {
+			require.Equal(t, expectToken, call.Options.(cosmosapi.GetDocumentOptions).SessionToken)
+		})
+		create := script.ExpectCreate("idvalue").ReturnSessionToken(fmt.Sprintf("after-%d", i))
+		if i < len(sessionTokens)-1 {
+			create.ReturnError(cosmosapi.ErrPreconditionFailed)
+		}
+	}
+	attempts := 0
+	require.NoError(t, session.WithRetries(3).WithContext(context.Background()).Transaction(func(txn *cosmos.Transaction) error {
+		attempts++
+		var entity cosmos.MyModel
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Put(&entity)
+		return nil
+	}))
+	require.Equal(t, 3, attempts)
+	require.Equal(t, "after-2", session.Token())
+}
+
+func TestTransactionRetriedCommit(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+
+	// The replace fails on its precondition after the client retried it. It may have been applied by the
+	// try before the retry, so the closure is not run again.
+	script.ExpectGet("idvalue").Return(map[string]interface{}{"userId": "partitionvalue"}).ReturnEtag("etag")
+	script.ExpectReplace("idvalue").ReturnRetryCount(1).ReturnError(cosmosapi.ErrPreconditionFailed)
+	attempts := 0
+	err := c.Session().WithRetries(3).WithCommitMode(cosmos.CommitReplace).Transaction(func(txn *cosmos.Transaction) error {
+		attempts++
+		var entity cosmos.MyModel
+		if err := txn.Get("partitionvalue", "idvalue", &entity); err != nil {
+			return err
+		}
+		entity.X++
+		txn.Put(&entity)
+		return nil
+	})
+	require.Equal(t, cosmos.AmbiguousCommitError, errors.Cause(err))
+	require.Equal(t, cosmosapi.OutcomeAmbiguous, cosmosapi.WriteOutcome(err))
+	require.Equal(t, 1, attempts)
+}
+
+func TestTransactionRollback(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+
+	// Nothing is written after the get
+	script.ExpectGet("idvalue").Return(map[string]interface{}{"userId": "partitionvalue"})
+	require.NoError(t, c.Session().Transaction(func(txn *cosmos.Transaction) error {
+		var entity cosmos.MyModel
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Put(&entity)
+		return cosmos.Rollback()
+	}))
+}
+
+func TestLastResponse(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+	doc := map[string]interface{}{"userId": "partitionvalue"}
+
+	script.ExpectGet("idvalue").Return(doc).ReturnSessionToken("session-1")
+	response, err := c.StaleGetWithResponse("partitionvalue", "idvalue", &cosmos.MyModel{})
+	require.NoError(t, err)
+	require.Equal(t, "session-1", response.SessionToken)
+
+	script.ExpectGet("idvalue").Return(doc).ReturnEtag("etag-1").ReturnSessionToken("session-1")
+	script.ExpectReplace("idvalue").ReturnSessionToken("session-2")
+	session := c.Session()
+	require.NoError(t, session.Transaction(func(txn *cosmos.Transaction) error {
+		var entity cosmos.MyModel
+		require.Equal(t, cosmosapi.DocumentResponse{}, txn.LastResponse())
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		require.Equal(t, "session-1", txn.LastResponse().SessionToken)
+		txn.Put(&entity)
+		return nil
+	}))
+	require.Equal(t, "session-2", session.LastResponse().SessionToken)
+
+	// Served from session cache, so the last response is still the one from the commit
+	require.NoError(t, session.Transaction(func(txn *cosmos.Transaction) error {
+		var entity cosmos.MyModel
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		require.Equal(t, cosmosapi.DocumentResponse{}, txn.LastResponse())
+		return nil
+	}))
+	require.Equal(t, "session-2", session.LastResponse().SessionToken)
+}
+
+func TestSessionCacheRevalidation(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+	session := c.Session().WithCacheRevalidation()
+	var entity cosmos.MyModel
+
+	ifNoneMatch := func(etag string) func(call cosmostest.ScriptCall) {
+		return func(call cosmostest.ScriptCall) {
+			require.Equal(t, etag, call.Options.(cosmosapi.GetDocumentOptions).IfNoneMatch)
+		}
+	}
+	script.ExpectGet("idvalue").Return(map[string]interface{}{"userId": "partitionvalue", "x": 1}).
+		ReturnEtag("etag-1").Inspect(ifNoneMatch(""))
+	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
+	require.Equal(t, 1, entity.X)
+
+	// Unchanged; the cached version is used
+	script.ExpectGet("idvalue").ReturnNotModified().Inspect(ifNoneMatch("etag-1"))
+	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
+	require.Equal(t, 1, entity.X)
+
+	// Changed; the new version is used and cached
+	script.ExpectGet("idvalue").Return(map[string]interface{}{"userId": "partitionvalue", "x": 2}).
+		ReturnEtag("etag-2").Inspect(ifNoneMatch("etag-1"))
+	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
+	require.Equal(t, 2, entity.X)
+	script.ExpectGet("idvalue").ReturnNotModified().Inspect(ifNoneMatch("etag-2"))
+	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
+	require.Equal(t, 2, entity.X)
+}
+
+func TestTransactionBatchMissingResults(t *testing.T) {
+	script, c := newScriptedCollection(t)
+	defer script.Verify()
+
+	// The batch reports success without the results of its operations
+	script.ExpectGet("a").Return(map[string]interface{}{"userId": "partitionvalue"}).ReturnEtag("etag-a")
+	script.ExpectGet("b").Return(map[string]interface{}{"userId": "partitionvalue"}).ReturnEtag("etag-b")
+	script.Expect("ExecuteBatch", "")
+	err := c.Session().Transaction(func(txn *cosmos.Transaction) error {
+		var a, b cosmos.MyModel
+		require.NoError(t, txn.Get("partitionvalue", "a", &a))
+		require.NoError(t, txn.Get("partitionvalue", "b", &b))
+		txn.Put(&a)
+		txn.Put(&b)
+		return nil
+	})
+	require.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package cosmos
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
@@ -9,7 +10,6 @@ import (
 	"net/http/httptest"
 	"testing"
 
-	"encoding/json"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/vippsas/go-cosmosdb/cosmosapi"
@@ -123,23 +123,6 @@ func (mock *mockCosmos) ReplaceDocument(ctx context.Context,
 	return &newBase, cosmosapi.DocumentResponse{SessionToken: mock.ReturnSession}, mock.ReturnError
 }
 
-func (mock *mockCosmos) ListDocuments(
-	ctx context.Context,
-	databaseName, collectionName string,
-	options *cosmosapi.ListDocumentsOptions,
-	documentList interface{},
-) (response cosmosapi.ListDocumentsResponse, err error) {
-	panic("implement me")
-}
-
-func (mock *mockCosmos) GetPartitionKeyRanges(
-	ctx context.Context,
-	databaseName, collectionName string,
-	options *cosmosapi.GetPartitionKeyRangesOptions,
-) (response cosmosapi.GetPartitionKeyRangesResponse, err error) {
-	panic("implement me")
-}
-
 type mockCosmosNotFound struct {
 	mockCosmos
 }
@@ -192,216 +175,6 @@ func TestCollectionStaleGet(t *testing.T) {
 	require.Equal(t, "", target.Etag)
 }
 
-func TestCollectionRacingPut(t *testing.T) {
-	mock := mockCosmos{}
-	c := Collection{
-		Client:       &mock,
-		DbName:       "mydb",
-		Name:         "mycollection",
-		PartitionKey: "userId"}
-
-	entity := MyModel{
-		BaseModel: BaseModel{
-			Id: "id1",
-		},
-		X:      1,
-		UserId: "alice",
-	}
-
-	require.NoError(t, c.RacingPut(&entity))
-	require.Equal(t, mockCosmos{
-		GotId:           "id1",
-		GotPartitionKey: "alice",
-		GotMethod:       "create",
-		GotUpsert:       true,
-		GotX:            1,
-	}, mock)
-
-	entity.Etag = "has an etag"
-
-	// Should not affect RacingPut at all, it just does upserts..
-	require.NoError(t, c.RacingPut(&entity))
-	require.Equal(t, mockCosmos{
-		GotId:           "id1",
-		GotPartitionKey: "alice",
-		GotMethod:       "create",
-		GotUpsert:       true,
-		GotX:            1,
-	}, mock)
-
-}
-
-func TestTransactionCacheHappyDay(t *testing.T) {
-	mock := mockCosmos{}
-	c := Collection{
-		Client:       &mock,
-		DbName:       "mydb",
-		Name:         "mycollection",
-		PartitionKey: "userId"}
-
-	session := c.Session()
-
-	checkCachedEtag := func(expect string) {
-		s := struct {
-			Etag string `json:"_etag"`
-		}{}
-		key, err := newUniqueKey("partitionvalue", "idvalue")
-		require.NoError(t, err)
-		json.Unmarshal([]byte(session.state.entityCache[key]), &s)
-		require.Equal(t, expect, s.Etag)
-	}
-
-	var entity MyModel // in production code this should be declared inside closure, but want more control in this test
-
-	require.NoError(t, session.Transaction(func(txn *Transaction) error {
-		entity.X = -20
-		mock.ReturnError = cosmosapi.ErrNotFound
-		require.Equal(t, 0, len(session.state.entityCache))
-		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
-		require.Equal(t, "get", mock.GotMethod)
-		// due to ErrNotFound, the Get() should zero-initialize to wipe the -20
-		require.Equal(t, 0, entity.X)
-		require.Equal(t, 1, entity.XPlusOne) // PostGetHook called
-
-		require.Equal(t, "idvalue", mock.GotId)
-		entity.X = 42
-		mock.reset()
-		txn.Put(&entity)
-		// *not* put yet, so mock not called yet, and not in cache
-		require.Equal(t, "", mock.GotMethod)
-		require.Equal(t, 1, len(session.state.entityCache))
-		checkCachedEtag("")
-		mock.ReturnEtag = "etag-1" // Etag returned by mock on commit; this needs to find its way into cache
-		mock.ReturnSession = "session-token-1"
-		return nil
-	}))
-	// now after exiting closure the X=42-entity was put
-	// also there was a create, not a replace, because entity.Etag was empty
-	require.Equal(t, "create", mock.GotMethod)
-	checkCachedEtag("etag-1")
-
-	// Session token should be set from the create call
-	require.Equal(t, "session-token-1", session.Token())
-
-	// entity outside of scope should have updated etag (this should typically not be used by code,
-	// but by writing this test it is in the contract as an edge case)
-	require.Equal(t, "etag-1", entity.Etag)
-	// Modify entity here just to make sure it doesn't reflect what is served by cache.
-	entity.X = -10
-
-	require.NoError(t, session.Transaction(func(txn *Transaction) error {
-		mock.reset()
-		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
-		// Get() above hit cache, so mock was not called
-		require.Equal(t, "", mock.GotMethod)
-		require.Equal(t, 42, entity.X) // i.e., not the -10 value from above
-		entity.X = 43
-		txn.Put(&entity)
-		mock.ReturnEtag = "etag-2"
-		mock.ReturnSession = "session-token-2"
-		return nil
-	}))
-	require.Equal(t, "replace", mock.GotMethod) // this time mock returned an etag on Get(), so we got a replace
-	checkCachedEtag("etag-2")
-
-	// Session token should be set from the create call
-	require.Equal(t, "session-token-2", session.Token())
-}
-
-func TestCachedGet(t *testing.T) {
-	mock := mockCosmos{}
-	c := Collection{
-		Client:       &mock,
-		DbName:       "mydb",
-		Name:         "mycollection",
-		PartitionKey: "userId"}
-
-	session := c.Session()
-	var entity MyModel
-
-	resetMock := func(x int) {
-		mock.reset()
-		mock.ReturnEtag = "etag-1"
-		mock.ReturnSession = "session"
-		mock.ReturnX = x
-		mock.ReturnUserId = "partitionvalue"
-	}
-
-	resetMock(42)
-	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
-	require.Equal(t, "get", mock.GotMethod)
-	// due to ErrNotFound, the Get() should zero-initialize to wipe the -20
-	require.Equal(t, 42, entity.X)
-	require.Equal(t, 43, entity.XPlusOne) // PostGetHook called
-	require.Equal(t, 1, entity.PostGetCounter)
-	require.Equal(t, "idvalue", mock.GotId)
-
-	resetMock(0)
-	require.NoError(t, session.Transaction(func(txn *Transaction) error {
-		mock.reset()
-		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
-		// Get() above hit cache, so mock was not called
-		require.Equal(t, "", mock.GotMethod)
-		require.Equal(t, 42, entity.X) // not the 0 value that we've set in the mock now
-		require.Equal(t, 1, entity.PostGetCounter)
-		entity.X = 43
-		entity.UserId = "partitionvalue"
-		mock.ReturnEtag = "foobar"
-		txn.Put(&entity)
-		return nil
-	}))
-
-	// Check that the above Put() overwrites the cache
-	resetMock(43)
-	require.NoError(t, session.Get("partitionvalue", "idvalue", &entity))
-	require.Equal(t, "", mock.GotMethod)
-	require.Equal(t, 2, entity.PostGetCounter)
-	require.Equal(t, 43, entity.X) // not the 0 value that we've set in the mock now
-}
-
-func TestTransactionCollisionAndSessionTracking(t *testing.T) {
-	mock := mockCosmos{}
-	c := Collection{
-		Client:       &mock,
-		DbName:       "mydb",
-		Name:         "mycollection",
-		PartitionKey: "userId"}
-
-	session := c.Session()
-
-	attempt := 0
-
-	require.NoError(t, session.WithRetries(3).WithContext(context.Background()).Transaction(func(txn *Transaction) error {
-		var entity MyModel
-		mock.reset()
-		mock.ReturnError = cosmosapi.ErrNotFound
-
-		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
-		require.Equal(t, "get", mock.GotMethod)
-
-		if attempt == 0 {
-			require.Equal(t, "", mock.GotSession)
-			mock.ReturnSession = "after-0"
-			mock.ReturnError = cosmosapi.ErrPreconditionFailed
-		} else if attempt == 1 {
-			require.Equal(t, "after-0", mock.GotSession)
-			mock.ReturnSession = "after-1"
-			mock.ReturnError = cosmosapi.ErrPreconditionFailed
-		} else if attempt == 2 {
-			require.Equal(t, "after-1", mock.GotSession)
-			mock.ReturnSession = "after-2"
-			mock.ReturnError = nil
-		}
-		attempt++
-
-		txn.Put(&entity)
-		return nil
-	}))
-
-	require.Equal(t, 3, attempt)
-	require.Equal(t, "after-2", session.Token())
-}
-
 func TestTransactionGetExisting(t *testing.T) {
 	mock := mockCosmos{}
 	c := Collection{
@@ -450,32 +223,6 @@ func TestTransactionNonExisting(t *testing.T) {
 	return
 }
 
-func TestTransactionRollback(t *testing.T) {
-	mock := mockCosmos{}
-	c := Collection{
-		Client:       &mock,
-		DbName:       "mydb",
-		Name:         "mycollection",
-		PartitionKey: "userId"}
-
-	session := c.Session()
-	mock.ReturnUserId = "partitionvalue"
-
-	require.NoError(t, session.Transaction(func(txn *Transaction) error {
-		var entity MyModel
-
-		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
-
-		mock.reset()
-		txn.Put(&entity)
-		return Rollback()
-	}))
-
-	// no api call done due to rollback
-	require.Equal(t, "", mock.GotMethod)
-
-}
-
 func TestIdAsPartitionKey_GetEntityInfo(t *testing.T) {
 	c := Collection{
 		Client:       &mockCosmosNotFound{},
@@ -624,3 +371,25 @@ func TestTransaction_IgnoreErrorOnGetThenPut(t *testing.T) {
 		t.Errorf("Expected error %v", PutWithoutGetError)
 	}
 }
+
+func TestSessionDiagnostics(t *testing.T) {
+	var logged bytes.Buffer
+	mock := mockCosmos{ReturnUserId: "partitionvalue", ReturnSession: "0:-1#120"}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	session := c.ResumeSession("0:-1#130").WithSessionDiagnostics(log.New(&logged, "", 0))
+
+	var entity MyModel
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		return txn.Get("partitionvalue", "idvalue", &entity)
+	}))
+	require.Equal(t, "0:-1#120", session.Token())
+	require.Contains(t, logged.String(), "range 0: LSN 120 is lower than the session's 130")
+
+	logged.Reset()
+	mock.ReturnSession = "0:-1#121"
+	session.Drop("partitionvalue", "idvalue")
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		return txn.Get("partitionvalue", "idvalue", &entity)
+	}))
+	require.Empty(t, logged.String())
+}
@@ -26,18 +26,63 @@ type Model interface {
 	IsNew() bool
 }
 
-// Client is an interface exposing the public API of the cosmosapi.Client struct
-type Client interface {
+// DocumentReader reads single documents
+type DocumentReader interface {
 	GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error)
+}
+
+// DocumentWriter writes single documents
+type DocumentWriter interface {
 	CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error)
 	ReplaceDocument(ctx context.Context, dbName, colName, id string, doc interface{}, ops cosmosapi.ReplaceDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error)
+}
+
+// QueryExecutor runs queries and lists the documents of a collection
+type QueryExecutor interface {
 	QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error)
 	ListDocuments(ctx context.Context, dbName, colName string, ops *cosmosapi.ListDocumentsOptions, docs interface{}) (cosmosapi.ListDocumentsResponse, error)
+}
+
+// PartitionKeyRangeReader reads the partition key ranges of a collection
+type PartitionKeyRangeReader interface {
+	GetPartitionKeyRanges(ctx context.Context, dbName, colName string, options *cosmosapi.GetPartitionKeyRangesOptions) (cosmosapi.GetPartitionKeyRangesResponse, error)
+}
+
+// Client is an interface exposing the public API of the cosmosapi.Client struct. Fakes that only
+// need some of it can implement the capability interfaces above and be turned into a Client by Compose.
+type Client interface {
+	DocumentReader
+	DocumentWriter
+	QueryExecutor
+	PartitionKeyRangeReader
 	GetCollection(ctx context.Context, dbName, colName string) (*cosmosapi.Collection, error)
 	DeleteCollection(ctx context.Context, dbName, colName string) error
 	DeleteDatabase(ctx context.Context, dbName string, ops *cosmosapi.RequestOptions) error
 	ExecuteStoredProcedure(ctx context.Context, dbName, colName, sprocName string, ops cosmosapi.ExecuteStoredProcedureOptions, ret interface{}, args ...interface{}) error
-	GetPartitionKeyRanges(ctx context.Context, dbName, colName string, options *cosmosapi.GetPartitionKeyRangesOptions) (cosmosapi.GetPartitionKeyRangesResponse, error)
 	ListOffers(ctx context.Context, ops *cosmosapi.RequestOptions) (*cosmosapi.Offers, error)
 	ReplaceOffer(ctx context.Context, offerOps cosmosapi.OfferReplaceOptions, ops *cosmosapi.RequestOptions) (*cosmosapi.Offer, error)
 }
+
+// The interfaces below are implemented by cosmosapi.Client, but are not part of Client, so that existing
+// implementations of Client keep compiling as the API grows. Collection uses them if its Client implements
+// them, and otherwise fails with cosmosapi.ErrorNotImplemented.
+
+// DocumentUpserter creates or replaces documents, optionally on the condition that the existing one is unchanged
+type DocumentUpserter interface {
+	UpsertDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.UpsertDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error)
+}
+
+// DocumentDeleter deletes documents; see Transaction.Delete
+type DocumentDeleter interface {
+	DeleteDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.DeleteDocumentOptions) (cosmosapi.DocumentResponse, error)
+}
+
+// DocumentPatcher patches documents; see Collection.Patch
+type DocumentPatcher interface {
+	PatchDocument(ctx context.Context, dbName, colName, id string, operations []cosmosapi.PatchOperation, ops cosmosapi.PatchDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error)
+}
+
+// BatchExecutor executes transactional batches, as transactions writing several entities and EntityGroup do
+type BatchExecutor interface {
+	ExecuteBatch(ctx context.Context, dbName, colName string, operations []cosmosapi.BatchOperation, ops cosmosapi.BatchOptions) (cosmosapi.BatchResponse, error)
+}
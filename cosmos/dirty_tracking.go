@@ -0,0 +1,156 @@
+package cosmos
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// CommitMode decides how a transaction writes an existing entity to Cosmos on commit
+type CommitMode int
+
+const (
+	// CommitReplace replaces the whole document, using If-Match on the etag (default)
+	CommitReplace CommitMode = iota
+	// CommitPatch computes the field-level difference between the entity as read by Transaction.Get() and
+	// as staged by Transaction.Put(), and only writes the changed fields. If-Match is still used on the
+	// etag, so concurrency control is unchanged, but the payload is smaller.
+	CommitPatch
+	// CommitPatchFieldLevel is like CommitPatch, but without If-Match. Concurrent writes to other fields of
+	// the document are neither lost nor cause contention; concurrent writes to the same fields are
+	// last-writer-wins. Only use this if the fields written do not depend on the values of other fields.
+	CommitPatchFieldLevel
+)
+
+// Cosmos does not allow more operations than this in a single patch; if the difference is larger we
+// fall back to a replace
+const maxPatchOperations = 10
+
+// Properties maintained by Cosmos, which should never be part of a patch
+var systemProperties = map[string]bool{
+	"_rid":         true,
+	"_self":        true,
+	"_etag":        true,
+	"_ts":          true,
+	"_attachments": true,
+}
+
+// patchCommit writes txn.toPut as a patch of the version that was read, and returns the document as
+// returned by Cosmos (or nil if there was nothing to write). patched=false is returned if a patch cannot be
+// used, and the caller should fall back to a regular put.
+func (txn *Transaction) patchCommit(base BaseModel, partitionValue interface{}) (
+	result Model, response cosmosapi.DocumentResponse, patched bool, err error) {
+
+	if _, ok := txn.session.Collection.Client.(DocumentPatcher); !ok {
+		// The client can not patch, so the document is replaced
+		return nil, response, false, nil
+	}
+	key, err := newUniqueKey(partitionValue, base.Id)
+	if err != nil {
+		return nil, response, false, err
+	}
+	original := txn.session.state.entityCache[key]
+	if original == nil {
+		return nil, response, false, nil
+	}
+	staged, err := json.Marshal(txn.toPut)
+	if err != nil {
+		return nil, response, false, errors.WithStack(err)
+	}
+	operations, err := diffDocuments(original, staged)
+	if err != nil {
+		return nil, response, false, err
+	}
+	if len(operations) > maxPatchOperations {
+		return nil, response, false, nil
+	}
+	if len(operations) == 0 {
+		// Nothing has changed, so there is nothing to write
+		return nil, response, true, nil
+	}
+
+	c := txn.session.Collection
+	opts := cosmosapi.PatchDocumentOptions{
+		PartitionKeyValue: partitionValue,
+		SessionToken:      txn.session.Token(),
+	}
+	if txn.session.CommitMode != CommitPatchFieldLevel {
+		opts.IfMatch = base.Etag
+	}
+	// Read the resulting document into a fresh instance; with CommitPatchFieldLevel it may contain changes
+	// made by others that we want in the session cache
+	result = reflect.New(reflect.TypeOf(txn.toPut).Elem()).Interface().(Model)
+	response, err = c.patchDocument(txn.session.Context, base.Id, operations, opts, result)
+	if err != nil {
+		c.entityCacheDelete(partitionValue, base.Id)
+		return nil, response, true, errors.WithStack(err)
+	}
+	return result, response, true, nil
+}
+
+// diffDocuments returns the patch operations needed to turn the JSON document original into updated.
+// Nested objects are diffed recursively; other values (including arrays) are set as a whole.
+func diffDocuments(original, updated []byte) ([]cosmosapi.PatchOperation, error) {
+	var from, to map[string]interface{}
+	if err := unmarshalUseNumber(original, &from); err != nil {
+		return nil, err
+	}
+	if err := unmarshalUseNumber(updated, &to); err != nil {
+		return nil, err
+	}
+	var operations []cosmosapi.PatchOperation
+	diffObjects("", from, to, true, &operations)
+	return operations, nil
+}
+
+func unmarshalUseNumber(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return errors.WithStack(dec.Decode(v))
+}
+
+func diffObjects(prefix string, from, to map[string]interface{}, root bool, operations *[]cosmosapi.PatchOperation) {
+	// Iterate in sorted order to get deterministic patches
+	keys := make([]string, 0, len(from)+len(to))
+	for k := range from {
+		keys = append(keys, k)
+	}
+	for k := range to {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if root && systemProperties[k] {
+			continue
+		}
+		path := prefix + "/" + escapeJsonPointer(k)
+		fromValue, inFrom := from[k]
+		toValue, inTo := to[k]
+		switch {
+		case !inTo:
+			*operations = append(*operations, cosmosapi.PatchRemove(path))
+		case !inFrom:
+			*operations = append(*operations, cosmosapi.PatchSet(path, toValue))
+		default:
+			fromObject, fromIsObject := fromValue.(map[string]interface{})
+			toObject, toIsObject := toValue.(map[string]interface{})
+			if fromIsObject && toIsObject {
+				diffObjects(path, fromObject, toObject, false, operations)
+			} else if !reflect.DeepEqual(fromValue, toValue) {
+				*operations = append(*operations, cosmosapi.PatchSet(path, toValue))
+			}
+		}
+	}
+}
+
+func escapeJsonPointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
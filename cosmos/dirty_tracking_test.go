@@ -0,0 +1,174 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestDiffDocuments(t *testing.T) {
+	original := `{"id": "a", "_etag": "1", "x": 1, "y": "foo", "removed": true, "nested": {"a": 1, "b": [1, 2]}, "a/b": 1}`
+	updated := `{"id": "a", "_etag": "2", "x": 2, "y": "foo", "added": null, "nested": {"a": 1, "b": [1, 3]}, "a/b": 2}`
+	operations, err := diffDocuments([]byte(original), []byte(updated))
+	require.NoError(t, err)
+	require.Equal(t, []cosmosapi.PatchOperation{
+		cosmosapi.PatchSet("/a~1b", json.Number("2")),
+		cosmosapi.PatchSet("/added", nil),
+		cosmosapi.PatchSet("/nested/b", []interface{}{json.Number("1"), json.Number("3")}),
+		cosmosapi.PatchRemove("/removed"),
+		cosmosapi.PatchSet("/x", json.Number("2")),
+	}, operations)
+
+	operations, err = diffDocuments([]byte(original), []byte(original))
+	require.NoError(t, err)
+	require.Empty(t, operations)
+}
+
+type patchModel struct {
+	BaseModel
+	Model  string `json:"model" cosmosmodel:"PatchModel/1"`
+	UserId string `json:"userId"`
+	X      int    `json:"x"`
+	Y      string `json:"y"`
+}
+
+func (e *patchModel) PrePut(txn *Transaction) error  { return nil }
+func (e *patchModel) PostGet(txn *Transaction) error { return nil }
+
+// mockCosmosPatch keeps a single document, and applies top-level patch operations to it
+type mockCosmosPatch struct {
+	Client
+	doc           map[string]interface{}
+	etag          int
+	GotMethod     string
+	GotOperations []cosmosapi.PatchOperation
+	GotIfMatch    string
+}
+
+func (mock *mockCosmosPatch) read(out interface{}) error {
+	mock.doc["_etag"] = fmt.Sprintf("etag-%d", mock.etag)
+	data, err := json.Marshal(mock.doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (mock *mockCosmosPatch) GetDocument(ctx context.Context,
+	dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	mock.GotMethod = "get"
+	return cosmosapi.DocumentResponse{}, mock.read(out)
+}
+
+func (mock *mockCosmosPatch) PatchDocument(ctx context.Context, dbName, colName, id string,
+	operations []cosmosapi.PatchOperation, ops cosmosapi.PatchDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	mock.GotMethod = "patch"
+	mock.GotOperations = operations
+	mock.GotIfMatch = ops.IfMatch
+	if ops.IfMatch != "" && ops.IfMatch != fmt.Sprintf("etag-%d", mock.etag) {
+		return cosmosapi.DocumentResponse{}, cosmosapi.ErrPreconditionFailed
+	}
+	for _, op := range operations {
+		switch op.Op {
+		case cosmosapi.PatchOpSet:
+			mock.doc[op.Path[1:]] = op.Value
+		case cosmosapi.PatchOpRemove:
+			delete(mock.doc, op.Path[1:])
+		}
+	}
+	mock.etag++
+	return cosmosapi.DocumentResponse{SessionToken: fmt.Sprintf("session-%d", mock.etag)}, mock.read(out)
+}
+
+func TestTransactionCommitPatch(t *testing.T) {
+	for _, mode := range []CommitMode{CommitPatch, CommitPatchFieldLevel} {
+		mock := mockCosmosPatch{
+			doc:  map[string]interface{}{"id": "idvalue", "userId": "partitionvalue", "model": "PatchModel/1", "x": 1, "y": "a"},
+			etag: 1,
+		}
+		c := Collection{
+			Client:       &mock,
+			DbName:       "mydb",
+			Name:         "mycollection",
+			PartitionKey: "userId"}
+		session := c.Session().WithCommitMode(mode)
+
+		var entity patchModel
+		concurrentWrite := true
+		require.NoError(t, session.Transaction(func(txn *Transaction) error {
+			require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+			entity.X = 2
+			txn.Put(&entity)
+			if concurrentWrite {
+				// Concurrent write to another field
+				mock.doc["y"] = "b"
+				mock.etag++
+				concurrentWrite = false
+			}
+			return nil
+		}))
+		require.Equal(t, "patch", mock.GotMethod)
+		require.Equal(t, []cosmosapi.PatchOperation{cosmosapi.PatchSet("/x", json.Number("2"))}, mock.GotOperations)
+		if mode == CommitPatch {
+			// The concurrent write caused a conflict, and the transaction was retried
+			require.Equal(t, "etag-2", mock.GotIfMatch)
+		} else {
+			require.Equal(t, "", mock.GotIfMatch)
+		}
+		require.Equal(t, "etag-3", entity.Etag)
+		require.Equal(t, "session-3", session.Token())
+
+		// The session cache contains the document as returned by Cosmos, and nothing changed, so nothing is written
+		mock.GotMethod = ""
+		require.NoError(t, session.Transaction(func(txn *Transaction) error {
+			require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+			require.Equal(t, 2, entity.X)
+			require.Equal(t, "b", entity.Y)
+			txn.Put(&entity)
+			return nil
+		}))
+		require.Equal(t, "", mock.GotMethod)
+	}
+}
+
+func TestTransactionPatch(t *testing.T) {
+	mock := mockCosmosPatch{
+		doc:  map[string]interface{}{"id": "idvalue", "userId": "partitionvalue", "model": "PatchModel/1", "x": 1, "y": "a"},
+		etag: 1,
+	}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	session := c.Session()
+
+	var entity patchModel
+	concurrentWrite := true
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Patch(&entity, cosmosapi.PatchSet("/y", "c"))
+		if concurrentWrite {
+			mock.doc["x"] = 5
+			mock.etag++
+			concurrentWrite = false
+		}
+		return nil
+	}))
+	require.Equal(t, "patch", mock.GotMethod)
+	require.Equal(t, "etag-2", mock.GotIfMatch) // retried after the concurrent write
+	require.Equal(t, []cosmosapi.PatchOperation{cosmosapi.PatchSet("/y", "c")}, mock.GotOperations)
+	// The entity is the patched document
+	require.Equal(t, "etag-3", entity.Etag)
+	require.Equal(t, 5, entity.X)
+	require.Equal(t, "c", entity.Y)
+
+	// The session cache has the patched document
+	mock.GotMethod = ""
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		require.Equal(t, "c", entity.Y)
+		return nil
+	}))
+	require.Equal(t, "", mock.GotMethod)
+}
@@ -0,0 +1,71 @@
+package cosmos
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// DocumentAdapter is given the JSON of a document read from Cosmos and returns the JSON to unmarshal
+// into the entity. It can be used to normalize documents written by legacy systems, e.g. renaming
+// fields with different casing or adding a missing "model" field.
+type DocumentAdapter func(doc json.RawMessage) (json.RawMessage, error)
+
+// WithDocumentAdapter returns a Collection where the documents fetched by point reads, patches, Query and
+// the queries and listings reading page by page (QueryAll, ListAll and QueryChan) are passed through adapter
+// before they are unmarshalled, and thus before the sanity checks on the id and partition key value. Field aliases given in `cosmosalias` tags are applied after the adapter.
+func (c Collection) WithDocumentAdapter(adapter DocumentAdapter) Collection {
+	c.adapter = adapter // note: non-pointer receiver
+	return c
+}
+
+// adaptedOut returns what to pass as the out argument of a Client method that would unmarshal a
+// document into target, and a function to call after a successful request to unmarshal the adapted
+// document into target
+func (c Collection) adaptedOut(target interface{}) (out interface{}, unmarshal func() error) {
+	if target == nil {
+		return target, func() error { return nil }
+	}
+	adapter := c.documentAdapterFor(reflect.TypeOf(target))
+	if adapter == nil {
+		return target, func() error { return nil }
+	}
+	var raw json.RawMessage
+	return &raw, func() error {
+		adapted, err := adapter(raw)
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(json.Unmarshal(adapted, target))
+	}
+}
+
+// adaptedQueryOut is like adaptedOut, but for the list of documents returned by a query
+func (c Collection) adaptedQueryOut(entities interface{}) (out interface{}, unmarshal func() error) {
+	adapter := c.adapter
+	if t := reflect.TypeOf(entities); t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
+		adapter = c.documentAdapterFor(t.Elem().Elem())
+	}
+	if adapter == nil {
+		return entities, func() error { return nil }
+	}
+	var raws []json.RawMessage
+	return &raws, func() error {
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, raw := range raws {
+			adapted, err := adapter(raw)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(adapted)
+		}
+		buf.WriteByte(']')
+		return errors.WithStack(json.Unmarshal(buf.Bytes(), entities))
+	}
+}
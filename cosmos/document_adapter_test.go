@@ -0,0 +1,45 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// legacyDocuments returns documents as written by a legacy system, with "user_id" instead of "userId"
+type legacyDocuments struct{}
+
+const legacyDocument = `{"id": "id1", "user_id": "alice", "x": 1, "_etag": "etag"}`
+
+func (legacyDocuments) GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	return cosmosapi.DocumentResponse{}, json.Unmarshal([]byte(legacyDocument), out)
+}
+
+func (legacyDocuments) QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	return cosmosapi.QueryDocumentsResponse{}, json.Unmarshal([]byte("["+legacyDocument+","+legacyDocument+"]"), docs)
+}
+
+func TestDocumentAdapter(t *testing.T) {
+	c := Collection{Client: Compose(legacyDocuments{}), DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	var e MyModel
+	require.Error(t, c.StaleGet("alice", "id1", &e))
+
+	c = c.WithDocumentAdapter(func(doc json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(strings.Replace(string(doc), `"user_id"`, `"userId"`, 1)), nil
+	})
+	require.NoError(t, c.StaleGet("alice", "id1", &e))
+	assert.Equal(t, "alice", e.UserId)
+	assert.Equal(t, 1, e.X)
+	assert.Equal(t, 2, e.XPlusOne)
+
+	var entities []MyModel
+	_, err := c.Query("SELECT * FROM c", &entities)
+	require.NoError(t, err)
+	require.Len(t, entities, 2)
+	assert.Equal(t, "alice", entities[1].UserId)
+}
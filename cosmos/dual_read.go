@@ -0,0 +1,224 @@
+package cosmos
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+	"github.com/vippsas/go-cosmosdb/logging"
+)
+
+// The maximum number of mismatches kept by a ReadVerifier
+const maxReadMismatches = 1000
+
+// ReadMismatch records a document that differed between the primary and the target collection
+type ReadMismatch struct {
+	PartitionValue interface{}
+	Id             string
+	Time           time.Time
+	// The JSON pointers of the properties that differ, or a description if the document is only found
+	// in one of the collections
+	Differences []string
+}
+
+// ReadVerificationReport summarizes the comparisons done by a ReadVerifier
+type ReadVerificationReport struct {
+	Compared   int
+	Mismatched int
+	// Failed counts the comparisons that could not be done, e.g. because reading the target failed or
+	// the queue was full
+	Failed int
+	// Mismatches lists the documents that differed (most recent last, capped at 1000 entries)
+	Mismatches []ReadMismatch
+}
+
+type readVerification struct {
+	partitionValue interface{}
+	id             string
+	document       []byte
+	found          bool
+	entityType     reflect.Type
+}
+
+// ReadVerifier compares reads from a primary collection against a migration target, to validate a
+// migration (e.g. a re-partitioning, see ShadowWriter) under real traffic. Reads are served from the
+// primary as normal; the target is read and compared asynchronously by a background goroutine, and
+// mismatches are logged and recorded in the report. Attach it to the primary collection with
+// WithReadVerification.
+type ReadVerifier struct {
+	target Collection
+	log    logging.ExtendedLogger
+	queue  chan readVerification
+	done   chan struct{}
+
+	// queueMu guards sending on queue against Close closing it
+	queueMu sync.Mutex
+	closed  bool
+
+	mu     sync.Mutex
+	report ReadVerificationReport
+}
+
+// NewReadVerifier starts a ReadVerifier reading from target. Up to queueSize comparisons are queued;
+// if the queue is full, reads are not compared. The partition key value in the target is taken from the
+// property target.PartitionKey of the document read from the primary. Mismatches are logged to log,
+// which may be nil.
+func NewReadVerifier(target Collection, queueSize int, log logging.StdLogger) *ReadVerifier {
+	v := &ReadVerifier{
+		target: target,
+		log:    logging.Adapt(log),
+		queue:  make(chan readVerification, queueSize),
+		done:   make(chan struct{}),
+	}
+	go v.run()
+	return v
+}
+
+// Close stops accepting reads, and waits until the queued comparisons are done. Reads done after Close
+// are not compared, but counted as failed.
+func (v *ReadVerifier) Close() {
+	v.queueMu.Lock()
+	if !v.closed {
+		v.closed = true
+		close(v.queue)
+	}
+	v.queueMu.Unlock()
+	<-v.done
+}
+
+// enqueue queues r to be compared, unless the queue is full or the verifier is closed
+func (v *ReadVerifier) enqueue(r readVerification) error {
+	v.queueMu.Lock()
+	defer v.queueMu.Unlock()
+	if v.closed {
+		return errors.New("ReadVerifier is closed")
+	}
+	select {
+	case v.queue <- r:
+		return nil
+	default:
+		return errors.New("Read verification queue is full")
+	}
+}
+
+// Report returns a snapshot of the report
+func (v *ReadVerifier) Report() ReadVerificationReport {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	report := v.report
+	report.Mismatches = append([]ReadMismatch(nil), v.report.Mismatches...)
+	return report
+}
+
+func (v *ReadVerifier) run() {
+	defer close(v.done)
+	for r := range v.queue {
+		differences, err := v.compare(r)
+		v.record(r.partitionValue, r.id, differences, err)
+	}
+}
+
+func (v *ReadVerifier) compare(r readVerification) ([]string, error) {
+	doc, err := decodeForTarget(r.document)
+	if err != nil {
+		return nil, err
+	}
+	partitionValue, err := targetPartitionValue(v.target, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var target json.RawMessage
+	opts := cosmosapi.GetDocumentOptions{PartitionKeyValue: partitionValue}
+	_, err = v.target.Client.GetDocument(v.target.GetContext(), v.target.DbName, v.target.Name, r.id, opts, &target)
+	targetFound := err == nil
+	if errors.Cause(err) == cosmosapi.ErrNotFound {
+		err = nil
+	}
+	switch {
+	case err != nil:
+		return nil, errors.WithStack(err)
+	case !r.found && !targetFound:
+		return nil, nil
+	case !r.found:
+		return []string{"found only in target"}, nil
+	case !targetFound:
+		return []string{"found only in primary"}, nil
+	}
+
+	// Round-trip the target document through the model, so that only properties the model knows about
+	// are compared, in the same serialization
+	entity := reflect.New(r.entityType).Interface()
+	if err := json.Unmarshal(target, entity); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if target, err = json.Marshal(entity); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	operations, err := diffDocuments(r.document, target)
+	if err != nil {
+		return nil, err
+	}
+	var differences []string
+	for _, op := range operations {
+		differences = append(differences, op.Path)
+	}
+	return differences, nil
+}
+
+func (v *ReadVerifier) record(partitionValue interface{}, id string, differences []string, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err != nil {
+		v.report.Failed++
+		return
+	}
+	v.report.Compared++
+	if len(differences) == 0 {
+		return
+	}
+	v.log.Warnf("Dual read mismatch for id='%s' partitionValue='%v': %s\n", id, partitionValue, strings.Join(differences, ", "))
+	v.report.Mismatched++
+	v.report.Mismatches = append(v.report.Mismatches, ReadMismatch{
+		PartitionValue: partitionValue,
+		Id:             id,
+		Time:           time.Now(),
+		Differences:    differences,
+	})
+	if len(v.report.Mismatches) > maxReadMismatches {
+		v.report.Mismatches = v.report.Mismatches[len(v.report.Mismatches)-maxReadMismatches:]
+	}
+}
+
+func (v *ReadVerifier) interceptor(op Operation, next func() error) error {
+	err := next()
+	if err != nil || op.Kind != OperationGet {
+		return err
+	}
+	document, snapshotErr := snapshotEntity(op.Entity)
+	if snapshotErr != nil {
+		v.record(op.PartitionKey, op.Id, nil, snapshotErr)
+		return nil
+	}
+	r := readVerification{
+		partitionValue: op.PartitionKey,
+		id:             op.Id,
+		document:       document,
+		found:          !op.Entity.IsNew(),
+		entityType:     reflect.TypeOf(op.Entity).Elem(),
+	}
+	if err := v.enqueue(r); err != nil {
+		v.record(op.PartitionKey, op.Id, nil, err)
+	}
+	return nil
+}
+
+// WithReadVerification returns a Collection where successful reads (StaleGet, StaleGetExisting and
+// Transaction.Get) are compared against the target collection of v
+func (c Collection) WithReadVerification(v *ReadVerifier) Collection {
+	return c.WithInterceptor(v.interceptor)
+}
@@ -0,0 +1,59 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosDocuments struct {
+	Client
+	Documents map[string]string
+}
+
+func (mock *mockCosmosDocuments) GetDocument(ctx context.Context,
+	dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	doc, ok := mock.Documents[id]
+	if !ok {
+		return cosmosapi.DocumentResponse{}, cosmosapi.ErrNotFound
+	}
+	return cosmosapi.DocumentResponse{}, json.Unmarshal([]byte(doc), out)
+}
+
+func TestReadVerification(t *testing.T) {
+	primary := mockCosmosDocuments{Documents: map[string]string{
+		"same":      `{"id": "same", "userId": "u", "model": "PatchModel/1", "x": 1, "_etag": "1"}`,
+		"different": `{"id": "different", "userId": "u", "model": "PatchModel/1", "x": 1, "y": "a", "_etag": "1"}`,
+		"primary":   `{"id": "primary", "userId": "u", "model": "PatchModel/1", "_etag": "1"}`,
+	}}
+	target := mockCosmosDocuments{Documents: map[string]string{
+		"same":      `{"id": "same", "userId": "u", "model": "PatchModel/1", "x": 1, "_etag": "2", "unknown": true}`,
+		"different": `{"id": "different", "userId": "u", "model": "PatchModel/1", "x": 2, "y": "a"}`,
+		"target":    `{"id": "target", "userId": "u", "model": "PatchModel/1"}`,
+	}}
+	verifier := NewReadVerifier(Collection{Client: &target, DbName: "mydb", Name: "target", PartitionKey: "userId"}, 10, nil)
+	c := Collection{Client: &primary, DbName: "mydb", Name: "primary", PartitionKey: "userId"}.WithReadVerification(verifier)
+
+	for _, id := range []string{"same", "different", "primary", "target", "neither"} {
+		var entity patchModel
+		require.NoError(t, c.StaleGet("u", id, &entity))
+	}
+	verifier.Close()
+
+	report := verifier.Report()
+	require.Equal(t, 5, report.Compared)
+	require.Equal(t, 3, report.Mismatched)
+	require.Equal(t, 0, report.Failed)
+	require.Equal(t, []string{"/x"}, report.Mismatches[0].Differences)
+	require.Equal(t, []string{"found only in primary"}, report.Mismatches[1].Differences)
+	require.Equal(t, []string{"found only in target"}, report.Mismatches[2].Differences)
+
+	// Reads after Close are served, but not compared
+	var entity patchModel
+	require.NoError(t, c.StaleGet("u", "same", &entity))
+	verifier.Close()
+	require.Equal(t, 1, verifier.Report().Failed)
+}
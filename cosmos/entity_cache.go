@@ -0,0 +1,193 @@
+package cosmos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/logging"
+)
+
+// EntityCache is a cache of serialized entities that can be shared between sessions, goroutines and (in the case
+// of an external cache such as Redis) processes. It is put in front of Collection.StaleGet() by calling
+// Collection.WithEntityCache(). Implementations must be thread-safe.
+type EntityCache interface {
+	// Get returns the value stored for key, or found=false if it does not exist or has expired.
+	Get(key string) (value []byte, found bool)
+	// Set stores a value for key, expiring after ttl.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes the key from the cache
+	Delete(key string)
+}
+
+type entityCacheConfig struct {
+	cache EntityCache
+	ttl   time.Duration
+	log   logging.ExtendedLogger
+}
+
+// WithEntityCache returns a copy of the collection where StaleGet() and StaleGetExisting() read through the given
+// cache, and where RacingPut() and transaction commits write through to it. Entities are cached for at most
+// ttl; this is the upper bound on how stale a read can be if the document is written by someone not using the
+// same cache.
+//
+// Only use this for documents where it is acceptable to read stale data, such as hot reference documents.
+// Transactions are unaffected and will still read from the database (or session cache).
+func (c Collection) WithEntityCache(cache EntityCache, ttl time.Duration) Collection {
+	c.entityCache = &entityCacheConfig{cache: cache, ttl: ttl, log: logging.Adapt(nil)} // note that c is not a pointer
+	return c
+}
+
+// WithEntityCacheLog returns a copy of the collection where failures to write an entity through to the cache
+// set with WithEntityCache are logged to log. Such failures do not fail the write, which has succeeded in
+// Cosmos; the entity is removed from the cache instead.
+func (c Collection) WithEntityCacheLog(log logging.StdLogger) Collection {
+	if c.entityCache != nil {
+		config := *c.entityCache
+		config.log = logging.Adapt(log)
+		c.entityCache = &config // note that c is not a pointer
+	}
+	return c
+}
+
+// MaxEntityCacheKeyLength is the maximum length of the keys passed to an EntityCache. Longer keys, e.g. for long
+// document ids, are replaced by a hash, as external caches limit the key length (Memcached to 250 bytes).
+const MaxEntityCacheKeyLength = 250
+
+func (c Collection) entityCacheKey(partitionValue interface{}, id string) (string, error) {
+	key, err := newUniqueKey(partitionValue, id)
+	if err != nil {
+		return "", err
+	}
+	// Include database and collection name, as the cache may be shared between several collections
+	prefix := c.DbName + "/" + c.Name + "/"
+	if len(prefix)+len(key) <= MaxEntityCacheKeyLength {
+		return prefix + string(key), nil
+	}
+	// Unique keys start with '[', so a hashed key can not be equal to an unhashed one
+	sum := sha256.Sum256([]byte(key))
+	return prefix + "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// entityCacheGet returns the serialized entity cached for the document, and how long ago it was cached if the
+// collection serves stale entities on errors (else age is 0)
+func (c Collection) entityCacheGet(partitionValue interface{}, id string) (serialized []byte, age time.Duration, found bool, err error) {
+	if c.entityCache == nil {
+		return nil, 0, false, nil
+	}
+	key, err := c.entityCacheKey(partitionValue, id)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	serialized, found = c.entityCache.cache.Get(key)
+	if !found || c.staleIfError == 0 {
+		return serialized, 0, found, nil
+	}
+	var entry staleCacheEntry
+	if err := json.Unmarshal(serialized, &entry); err != nil || entry.Entity == nil {
+		// Cached without WithStaleIfError; treat as expired
+		return nil, 0, false, nil
+	}
+	return entry.Entity, time.Since(entry.CachedAt), true, nil
+}
+
+func (c Collection) entityCacheSet(partitionValue interface{}, id string, entity Model) error {
+	if c.entityCache == nil {
+		return nil
+	}
+	key, err := c.entityCacheKey(partitionValue, id)
+	if err != nil {
+		return err
+	}
+	if entity.IsNew() {
+		// We do not cache non-existence; a document created by someone else should be visible right away
+		c.entityCache.cache.Delete(key)
+		return nil
+	}
+	serialized, err := json.Marshal(entity)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ttl := c.entityCache.ttl
+	if c.staleIfError != 0 {
+		// Keep the entity for serving stale after it expires, recording when it was cached
+		if serialized, err = json.Marshal(staleCacheEntry{CachedAt: time.Now(), Entity: serialized}); err != nil {
+			return errors.WithStack(err)
+		}
+		ttl += c.staleIfError
+	}
+	c.entityCache.cache.Set(key, serialized, ttl)
+	return nil
+}
+
+// entityCacheWritten writes an entity that has been written to Cosmos through to the entity cache. The write
+// has succeeded, so an error is logged rather than returned, and the entity is removed from the cache so that
+// a stale version is not served.
+func (c Collection) entityCacheWritten(partitionValue interface{}, id string, entity Model) {
+	if err := c.entityCacheSet(partitionValue, id, entity); err != nil {
+		c.entityCache.log.Printf("Failed to write entity id='%s' partitionValue='%v' of collection %s through to the entity cache: %v\n",
+			id, partitionValue, c.Name, err)
+		c.entityCacheDelete(partitionValue, id)
+	}
+}
+
+func (c Collection) entityCacheDelete(partitionValue interface{}, id string) {
+	if c.entityCache == nil {
+		return
+	}
+	key, err := c.entityCacheKey(partitionValue, id)
+	if err != nil {
+		// If we can't make the key, the entity can't have been cached in the first place
+		return
+	}
+	c.entityCache.cache.Delete(key)
+}
+
+// MemoryEntityCache is a process-local EntityCache. Expired entries are removed lazily on access; there is no
+// other eviction, so it should only be used for a bounded set of documents.
+type MemoryEntityCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntityCacheEntry
+	now     func() time.Time
+}
+
+type memoryEntityCacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func NewMemoryEntityCache() *MemoryEntityCache {
+	return &MemoryEntityCache{
+		entries: make(map[string]memoryEntityCacheEntry),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryEntityCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !m.now().Before(entry.expires) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (m *MemoryEntityCache) Set(key string, value []byte, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = memoryEntityCacheEntry{value: value, expires: m.now().Add(ttl)}
+}
+
+func (m *MemoryEntityCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
@@ -0,0 +1,133 @@
+package cosmos
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestEntityCacheReadThroughWriteThrough(t *testing.T) {
+	mock := mockCosmos{}
+	cache := NewMemoryEntityCache()
+	c := Collection{
+		Client:       &mock,
+		DbName:       "mydb",
+		Name:         "mycollection",
+		PartitionKey: "userId"}.WithEntityCache(cache, time.Minute)
+
+	mock.ReturnEtag = "etag-1"
+	mock.ReturnUserId = "alice"
+	mock.ReturnX = 42
+
+	var entity MyModel
+	require.NoError(t, c.StaleGet("alice", "id1", &entity))
+	require.Equal(t, "get", mock.GotMethod)
+	require.Equal(t, 42, entity.X)
+
+	// Second read is served from the cache
+	mock.reset()
+	entity = MyModel{}
+	require.NoError(t, c.StaleGet("alice", "id1", &entity))
+	require.Equal(t, "", mock.GotMethod)
+	require.Equal(t, 42, entity.X)
+	require.Equal(t, 43, entity.XPlusOne) // PostGetHook called also on cache hit
+
+	// RacingPut writes through to the cache
+	mock.ReturnEtag = "etag-2"
+	entity.X = 1
+	require.NoError(t, c.RacingPut(&entity))
+	mock.reset()
+	var fetched MyModel
+	require.NoError(t, c.StaleGet("alice", "id1", &fetched))
+	require.Equal(t, "", mock.GotMethod)
+	require.Equal(t, 1, fetched.X)
+	require.Equal(t, "etag-2", fetched.Etag)
+}
+
+func TestEntityCacheWriteThroughFailureIsLogged(t *testing.T) {
+	mock := mockCosmos{}
+	var logged bytes.Buffer
+	c := Collection{
+		Client:       &mock,
+		DbName:       "mydb",
+		Name:         "mycollection",
+		PartitionKey: "userId"}.WithEntityCache(NewMemoryEntityCache(), time.Minute).WithEntityCacheLog(log.New(&logged, "", 0))
+
+	// The id is not valid UTF-8, so no cache key can be made for it; the put has succeeded in Cosmos all the same
+	mock.ReturnEtag = "etag-1"
+	entity := MyModel{BaseModel: BaseModel{Id: "id\xff"}, UserId: "alice"}
+	require.NoError(t, c.RacingPut(&entity))
+	require.Equal(t, "create", mock.GotMethod)
+	require.Contains(t, logged.String(), "not valid UTF-8")
+}
+
+func TestMemoryEntityCacheExpiry(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryEntityCache()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("key", []byte("value"), time.Second)
+	value, found := cache.Get("key")
+	require.True(t, found)
+	require.Equal(t, "value", string(value))
+
+	now = now.Add(time.Second)
+	_, found = cache.Get("key")
+	require.False(t, found)
+}
+
+func TestStaleIfError(t *testing.T) {
+	mock := mockCosmos{}
+	c := Collection{
+		Client:       &mock,
+		DbName:       "mydb",
+		Name:         "mycollection",
+		PartitionKey: "userId"}.WithEntityCache(NewMemoryEntityCache(), time.Nanosecond).WithStaleIfError(time.Minute)
+
+	mock.ReturnEtag = "etag-1"
+	mock.ReturnUserId = "alice"
+	mock.ReturnX = 42
+	var entity MyModel
+	info, err := c.StaleGetWithInfo("alice", "id1", &entity)
+	require.NoError(t, err)
+	require.False(t, info.FromCache)
+
+	// The entity has expired, so it is read again, and served stale when that fails with a temporary error
+	mock.reset()
+	mock.ReturnError = cosmosapi.ErrUnavailable
+	entity = MyModel{}
+	info, err = c.StaleGetWithInfo("alice", "id1", &entity)
+	require.NoError(t, err)
+	require.Equal(t, "get", mock.GotMethod)
+	require.True(t, info.FromCache)
+	require.True(t, info.Stale)
+	require.True(t, info.Age > 0)
+	require.Equal(t, cosmosapi.ErrUnavailable, errors.Cause(info.Err))
+	require.Equal(t, 42, entity.X)
+	require.Equal(t, 43, entity.XPlusOne)
+
+	for _, temporary := range []error{context.DeadlineExceeded, &net.OpError{Op: "read", Err: errors.New("connection reset")}} {
+		mock.ReturnError = errors.WithStack(temporary)
+		info, err = c.StaleGetWithInfo("alice", "id1", &entity)
+		require.NoError(t, err)
+		require.True(t, info.Stale)
+	}
+
+	// Other errors are returned, also those that are not known to be permanent
+	mock.ReturnError = cosmosapi.ErrForbidden
+	require.Equal(t, cosmosapi.ErrForbidden, errors.Cause(c.StaleGet("alice", "id1", &entity)))
+	decodeErr := errors.New("invalid character")
+	mock.ReturnError = decodeErr
+	require.Equal(t, decodeErr, errors.Cause(c.StaleGet("alice", "id1", &entity)))
+
+	// Without a cached entity, the error is returned
+	mock.ReturnError = cosmosapi.ErrUnavailable
+	require.Equal(t, cosmosapi.ErrUnavailable, errors.Cause(c.StaleGet("alice", "id2", &entity)))
+}
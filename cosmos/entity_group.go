@@ -0,0 +1,154 @@
+package cosmos
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// EntityGroup holds all the entities of one logical partition, for models where a partition is an aggregate
+// (e.g. a user and their orders). The entities are loaded together, several of them can be modified, and the
+// changes are committed atomically with a transactional batch; so either all of them are written, or none.
+//
+// The entities must be of models registered with RegisterModel. Commit uses optimistic concurrency: if any
+// of the entities were changed by someone else since they were loaded, nothing is written and an error
+// with cause cosmosapi.ErrPreconditionFailed is returned; load the group again and retry.
+type EntityGroup struct {
+	collection     Collection
+	partitionValue interface{}
+	entities       []Model
+	toPut          []Model
+}
+
+// LoadEntityGroup loads all the entities with the given partition value. The post-get hooks are called on
+// each of them.
+func (c Collection) LoadEntityGroup(partitionValue interface{}) (*EntityGroup, error) {
+	g := &EntityGroup{collection: c, partitionValue: partitionValue}
+	ops := cosmosapi.DefaultQueryDocumentOptions()
+	ops.PartitionKeyValue = partitionValue
+	query := cosmosapi.Query{
+		Query:  "SELECT * FROM c WHERE c." + c.PartitionKey + " = @partitionValue",
+		Params: []cosmosapi.QueryParam{{Name: "@partitionValue", Value: partitionValue}},
+	}
+	err := c.visitModels(query, ops, func(entity Model) error {
+		if err := c.postGet(entity, nil); err != nil {
+			return err
+		}
+		g.entities = append(g.entities, entity)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// PartitionValue returns the partition value of the group
+func (g *EntityGroup) PartitionValue() interface{} {
+	return g.partitionValue
+}
+
+// Entities returns the entities of the group, as pointers to their registered types
+func (g *EntityGroup) Entities() []Model {
+	return append([]Model(nil), g.entities...)
+}
+
+// Get returns the entity with the given id, or nil if the group has no such entity
+func (g *EntityGroup) Get(id string) Model {
+	for _, entity := range g.entities {
+		if base, _ := g.collection.GetEntityInfo(entity); base.Id == id {
+			return entity
+		}
+	}
+	return nil
+}
+
+// Put queues an entity to be written on Commit. It can be an entity of the group that has been modified,
+// or a new entity (with an empty Etag), which must have the partition value of the group.
+func (g *EntityGroup) Put(entity Model) error {
+	base, partitionValue := g.collection.GetEntityInfo(entity)
+	groupKey, err := newUniqueKey(g.partitionValue, base.Id)
+	if err != nil {
+		return err
+	}
+	entityKey, err := newUniqueKey(partitionValue, base.Id)
+	if err != nil {
+		return err
+	}
+	if entityKey != groupKey {
+		return errors.Errorf("Entity id='%s' has partitionValue='%v', which is not that of the group ('%v')", base.Id, partitionValue, g.partitionValue)
+	}
+	for i, queued := range g.toPut {
+		if queuedBase, _ := g.collection.GetEntityInfo(queued); queuedBase.Id == base.Id {
+			g.toPut[i] = entity
+			return nil
+		}
+	}
+	g.toPut = append(g.toPut, entity)
+	return nil
+}
+
+// Commit writes the entities queued with Put in a single transactional batch. The pre-put hooks are called on
+// each of them first. On success the Etags of the entities are updated, and new entities become part of
+// the group.
+func (g *EntityGroup) Commit() error {
+	if len(g.toPut) == 0 {
+		return nil
+	}
+	c := g.collection
+	// Each entity passes through the interceptors as a put; the batch is executed innermost
+	var operations []Operation
+	for _, entity := range g.toPut {
+		base, _ := c.GetEntityInfo(entity)
+		operations = append(operations, Operation{Kind: OperationPut, PartitionKey: g.partitionValue, Id: base.Id, Entity: entity, batched: len(operations) > 0})
+	}
+	if err := c.interceptAll(operations, g.commit); err != nil {
+		return err
+	}
+	for _, entity := range g.toPut {
+		base, _ := c.GetEntityInfo(entity)
+		if g.Get(base.Id) == nil {
+			g.entities = append(g.entities, entity)
+		}
+	}
+	g.toPut = nil
+	return nil
+}
+
+func (g *EntityGroup) commit() error {
+	c := g.collection
+	var batch []cosmosapi.BatchOperation
+	for _, entity := range g.toPut {
+		if err := c.prePut(entity, nil); err != nil {
+			return err
+		}
+		base, _ := c.GetEntityInfo(entity)
+		batch = append(batch, putBatchOperation(base, entity))
+	}
+	response, err := c.executeWriteBatch(c.GetContext(), g.partitionValue, batch)
+	for _, entity := range g.toPut {
+		base, _ := c.GetEntityInfo(entity)
+		// The cached entities are no longer up to date, whether or not the batch succeeded
+		c.entityCacheDelete(g.partitionValue, base.Id)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for i, entity := range g.toPut {
+		base, _, _ := c.getEntityInfo(entity)
+		if err := setBatchResult(base, response.Results[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interceptAll passes each of the operations through the interceptors, nested, with fn innermost. As fn
+// does a single request, all operations but the first should be marked as batched.
+func (c Collection) interceptAll(operations []Operation, fn func() error) error {
+	if len(operations) == 0 {
+		return fn()
+	}
+	return c.intercept(operations[0], func() error {
+		return c.interceptAll(operations[1:], fn)
+	})
+}
@@ -0,0 +1,82 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosBatch struct {
+	mockCosmosQuery
+	GotOperations []cosmosapi.BatchOperation
+	ReturnError   error
+}
+
+func (mock *mockCosmosBatch) ExecuteBatch(ctx context.Context, dbName, colName string,
+	operations []cosmosapi.BatchOperation, ops cosmosapi.BatchOptions) (cosmosapi.BatchResponse, error) {
+	if ops.PartitionKeyValue != "u" {
+		panic("assertion failed")
+	}
+	mock.GotOperations = operations
+	if mock.ReturnError != nil {
+		return cosmosapi.BatchResponse{}, mock.ReturnError
+	}
+	var response cosmosapi.BatchResponse
+	for _, op := range operations {
+		body, _ := json.Marshal(op.ResourceBody)
+		var doc map[string]interface{}
+		_ = json.Unmarshal(body, &doc)
+		doc["_etag"] = "etag-2"
+		body, _ = json.Marshal(doc)
+		response.Results = append(response.Results, cosmosapi.BatchOperationResult{StatusCode: 200, ResourceBody: body})
+	}
+	return response, nil
+}
+
+func TestEntityGroup(t *testing.T) {
+	mock := mockCosmosBatch{mockCosmosQuery: mockCosmosQuery{Pages: []string{
+		`[{"id": "a", "_etag": "etag-1", "model": "MyModel/1", "userId": "u", "x": 1},
+		  {"id": "b", "_etag": "etag-1", "model": "PatchModel/1", "userId": "u", "x": 2}]`,
+	}}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	g, err := c.LoadEntityGroup("u")
+	require.NoError(t, err)
+	require.Len(t, g.Entities(), 2)
+	require.Equal(t, "@partitionValue", mock.GotQueries[0].Params[0].Name)
+	a := g.Get("a").(*MyModel)
+	require.Equal(t, 2, a.XPlusOne) // post-get hook was called
+	require.Nil(t, g.Get("c"))
+
+	a.X = 10
+	require.NoError(t, g.Put(a))
+	c2 := &MyModel{BaseModel: BaseModel{Id: "c"}, UserId: "u", X: 3}
+	require.NoError(t, g.Put(c2))
+	require.Error(t, g.Put(&MyModel{BaseModel: BaseModel{Id: "d"}, UserId: "other"}))
+
+	require.NoError(t, g.Commit())
+	require.Len(t, mock.GotOperations, 2)
+	require.Equal(t, cosmosapi.BatchReplace, mock.GotOperations[0].OperationType)
+	require.Equal(t, "etag-1", mock.GotOperations[0].IfMatch)
+	require.Equal(t, cosmosapi.BatchCreate, mock.GotOperations[1].OperationType)
+	require.Equal(t, "etag-2", a.Etag)
+	require.Equal(t, "set by pre-put, checked in mock", c2.SetByPrePut)
+	require.Len(t, g.Entities(), 3)
+
+	// Contention; nothing is written
+	mock.ReturnError = cosmosapi.BatchError{Index: 0, StatusCode: 409, Err: cosmosapi.ErrConflict}
+	require.NoError(t, g.Put(&MyModel{BaseModel: BaseModel{Id: "e"}, UserId: "u"}))
+	err = g.Commit()
+	require.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+
+	// The interceptors see each entity as a put
+	mock.GotQueries = nil
+	g, err = c.ReadOnly().LoadEntityGroup("u")
+	require.NoError(t, err)
+	require.NoError(t, g.Put(g.Get("a")))
+	require.Equal(t, cosmosapi.ErrReadOnly, errors.Cause(g.Commit()))
+}
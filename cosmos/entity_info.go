@@ -0,0 +1,221 @@
+package cosmos
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// EntityInfoError is returned when an entity does not have the fields needed by the collection: an embedded
+// BaseModel, and a field for the partition key. GetEntityInfo panics with it.
+type EntityInfoError struct {
+	Type         reflect.Type
+	PartitionKey string
+	Reason       string
+}
+
+func (e EntityInfoError) Error() string {
+	return fmt.Sprintf("Need to pass in a pointer to a struct with fields named 'BaseModel' and a tag 'json:\"%s\"', got %v: %s",
+		e.PartitionKey, e.Type, e.Reason)
+}
+
+// entityLayout locates the BaseModel and the partition key of a struct type. The partition key is found by
+// following partitionValue, a field index per level, dereferencing pointers between levels.
+type entityLayout struct {
+	baseModel      []int
+	partitionValue []int
+	err            error
+}
+
+type entityLayoutKey struct {
+	t            reflect.Type
+	partitionKey string
+}
+
+// entityLayouts caches the entityLayout per type and partition key
+var entityLayouts sync.Map
+
+func entityLayoutOf(t reflect.Type, partitionKey string) entityLayout {
+	key := entityLayoutKey{t: t, partitionKey: partitionKey}
+	if layout, ok := entityLayouts.Load(key); ok {
+		return layout.(entityLayout)
+	}
+	layout := newEntityLayout(t, partitionKey)
+	entityLayouts.Store(key, layout)
+	return layout
+}
+
+func newEntityLayout(t reflect.Type, partitionKey string) (layout entityLayout) {
+	fail := func(format string, args ...interface{}) entityLayout {
+		return entityLayout{err: EntityInfoError{Type: t, PartitionKey: partitionKey, Reason: fmt.Sprintf(format, args...)}}
+	}
+	if partitionKey == "" {
+		return fail("Please initialize PartitionKey in your Collection struct")
+	}
+	if t.Kind() != reflect.Struct {
+		return fail("not a pointer to a struct")
+	}
+	field, ok := t.FieldByName("BaseModel")
+	if !ok || field.Type != reflect.TypeOf(BaseModel{}) {
+		return fail("no BaseModel field")
+	}
+	for i := range field.Index[:len(field.Index)-1] {
+		if t.FieldByIndex(field.Index[:i+1]).Type.Kind() == reflect.Ptr {
+			return fail("BaseModel is embedded through a pointer")
+		}
+	}
+	layout.baseModel = field.Index
+
+	if partitionKey == "id" {
+		idField, _ := field.Type.FieldByName("Id")
+		layout.partitionValue = append(append([]int(nil), field.Index...), idField.Index...)
+		return layout
+	}
+	// The partition key may be a path into nested structs, e.g. "address.country" or "/address/country"
+	structT := t
+	for _, name := range strings.FieldsFunc(partitionKey, func(r rune) bool { return r == '.' || r == '/' }) {
+		for structT.Kind() == reflect.Ptr {
+			structT = structT.Elem()
+		}
+		if structT.Kind() != reflect.Struct {
+			return fail("%s is not a struct", name)
+		}
+		index, fieldT, ok := jsonField(structT, name)
+		if !ok {
+			return fail("no field with tag 'json:\"%s\"'", name)
+		}
+		layout.partitionValue = append(layout.partitionValue, index...)
+		structT = fieldT
+	}
+	return layout
+}
+
+// jsonField returns the path of field indices to the field that encoding/json maps the property name to,
+// including fields promoted from embedded structs
+func jsonField(t reflect.Type, name string) (index []int, fieldT reflect.Type, ok bool) {
+	var embedded []reflect.StructField
+	for i := 0; i != t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == name || (tag == "" && field.Name == name && !field.Anonymous) {
+			return []int{i}, field.Type, true
+		}
+		if field.Anonymous && tag == "" {
+			embedded = append(embedded, field)
+		}
+	}
+	for _, field := range embedded {
+		embeddedT := field.Type
+		if embeddedT.Kind() == reflect.Ptr {
+			embeddedT = embeddedT.Elem()
+		}
+		if embeddedT.Kind() != reflect.Struct {
+			continue
+		}
+		if index, fieldT, ok := jsonField(embeddedT, name); ok {
+			return append([]int{field.Index[0]}, index...), fieldT, true
+		}
+	}
+	return nil, nil, false
+}
+
+// getPartitionValue returns the partition key of the entity struct v, dereferencing pointers; it is nil if a
+// pointer on the way is nil
+func (layout entityLayout) getPartitionValue(v reflect.Value) interface{} {
+	for _, i := range layout.partitionValue {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
+
+// setPartitionValue sets the partition key of the entity struct v, allocating pointers on the way as needed.
+// Numeric values are converted to the type of the field.
+func (layout entityLayout) setPartitionValue(v reflect.Value, partitionValue interface{}) error {
+	for _, i := range layout.partitionValue {
+		v = allocated(v).Field(i)
+	}
+	if partitionValue == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	v = allocated(v)
+	value := reflect.ValueOf(partitionValue)
+	switch {
+	case value.Type().AssignableTo(v.Type()):
+	case isNumber(value.Kind()) && isNumber(v.Kind()):
+		value = value.Convert(v.Type())
+	default:
+		return errors.Errorf("Can not use partition key value %v (%T) for a field of type %v", partitionValue, partitionValue, v.Type())
+	}
+	v.Set(value)
+	return nil
+}
+
+func allocated(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func (c Collection) getEntityInfo(entityPtr Model) (*BaseModel, interface{}, error) {
+	v := reflect.ValueOf(entityPtr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, nil, errors.WithStack(EntityInfoError{Type: reflect.TypeOf(entityPtr), PartitionKey: c.PartitionKey, Reason: "not a pointer to a struct"})
+	}
+	layout := entityLayoutOf(v.Elem().Type(), c.PartitionKey)
+	if layout.err != nil {
+		return nil, nil, errors.WithStack(layout.err)
+	}
+	v = v.Elem()
+	return v.FieldByIndex(layout.baseModel).Addr().Interface().(*BaseModel), layout.getPartitionValue(v), nil
+}
+
+// setPartitionValue sets the partition key of the entity
+func (c Collection) setPartitionValue(entityPtr Model, partitionValue interface{}) error {
+	if _, _, err := c.getEntityInfo(entityPtr); err != nil {
+		return err
+	}
+	v := reflect.ValueOf(entityPtr).Elem()
+	return entityLayoutOf(v.Type(), c.PartitionKey).setPartitionValue(v, partitionValue)
+}
+
+// PartitionKeyOf returns the partition key value of the entity, or an EntityInfoError if the entity does not
+// have a field for the partition key. The field may be in a nested or embedded struct (with a PartitionKey
+// such as "address.country"), and may be a pointer; the value is then dereferenced, or nil if the pointer is
+// nil. The fields are looked up once per type.
+func (c Collection) PartitionKeyOf(entityPtr Model) (interface{}, error) {
+	_, partitionValue, err := c.getEntityInfo(entityPtr)
+	return partitionValue, err
+}
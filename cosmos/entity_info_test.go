@@ -0,0 +1,97 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type address struct {
+	Country *string `json:"country"`
+}
+
+type entityInfoModel struct {
+	BaseModel
+	Address *address `json:"address"`
+	Shard   int      `json:"shard"`
+	Active  *bool    `json:"active,omitempty"`
+}
+
+func (e *entityInfoModel) PrePut(txn *Transaction) error  { return nil }
+func (e *entityInfoModel) PostGet(txn *Transaction) error { return nil }
+
+type embeddingModel struct {
+	entityInfoModel
+	Extra string `json:"extra"`
+}
+
+func TestPartitionKeyOf(t *testing.T) {
+	country, active := "NO", true
+	e := entityInfoModel{BaseModel: BaseModel{Id: "id1"}, Address: &address{Country: &country}, Shard: 3, Active: &active}
+	c := Collection{PartitionKey: "address.country"}
+
+	pv, err := c.PartitionKeyOf(&e)
+	require.NoError(t, err)
+	require.Equal(t, "NO", pv)
+	c.PartitionKey = "/address/country"
+	pv, err = c.PartitionKeyOf(&entityInfoModel{})
+	require.NoError(t, err)
+	require.Nil(t, pv)
+
+	c.PartitionKey = "shard"
+	pv, err = c.PartitionKeyOf(&embeddingModel{entityInfoModel: e})
+	require.NoError(t, err)
+	require.Equal(t, 3, pv)
+	base, _ := c.GetEntityInfo(&embeddingModel{entityInfoModel: e})
+	require.Equal(t, "id1", base.Id)
+
+	c.PartitionKey = "active"
+	pv, err = c.PartitionKeyOf(&e)
+	require.NoError(t, err)
+	require.Equal(t, true, pv)
+
+	c.PartitionKey = "id"
+	pv, err = c.PartitionKeyOf(&e)
+	require.NoError(t, err)
+	require.Equal(t, "id1", pv)
+
+	c.PartitionKey = "missing"
+	_, err = c.PartitionKeyOf(&e)
+	require.IsType(t, EntityInfoError{}, errors.Cause(err))
+	require.Panics(t, func() { c.GetEntityInfo(&e) })
+}
+
+func TestInitializeEmptyDocNested(t *testing.T) {
+	c := Collection{PartitionKey: "address.country"}
+	var e entityInfoModel
+	require.NoError(t, c.initializeEmptyDoc("NO", "id1", &e))
+	require.Equal(t, "id1", e.Id)
+	require.Equal(t, "NO", *e.Address.Country)
+
+	// Numbers are converted to the type of the field, as they are decoded from JSON as float64
+	c.PartitionKey = "shard"
+	require.NoError(t, c.initializeEmptyDoc(float64(3), "id1", &e))
+	require.Equal(t, 3, e.Shard)
+	require.Error(t, c.initializeEmptyDoc("3", "id1", &e))
+}
+
+func TestNumericPartitionKey(t *testing.T) {
+	mock := mockCosmosEtags{Documents: map[string]map[string]interface{}{
+		"a": {"id": "a", "shard": 3.0, "_etag": "etag-0"},
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "shard"}
+
+	// The partition value may be given as any numeric type
+	var e entityInfoModel
+	require.NoError(t, c.StaleGetExisting(int64(3), "a", &e))
+	require.Equal(t, 3, e.Shard)
+	require.NoError(t, c.StaleGet(3.0, "b", &e))
+	require.Equal(t, "b", e.Id)
+	require.Equal(t, 3, e.Shard)
+
+	require.True(t, samePartitionValue(3, 3.0))
+	require.True(t, samePartitionValue(true, true))
+	require.False(t, samePartitionValue(3, "3"))
+	require.False(t, samePartitionValue(true, 1))
+}
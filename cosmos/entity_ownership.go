@@ -0,0 +1,39 @@
+package cosmos
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var EntityAliasingError = errors.New("The entity is already in use by another transaction that is still running")
+
+// entityOwners maps the entity pointers in use by transactions that are running to the transaction
+var entityOwners sync.Map // Model -> *Transaction
+
+// claimEntity marks the entity as in use by the transaction until it ends, or returns EntityAliasingError if
+// it is in use by another transaction. Using the same entity in two concurrent transactions gives undefined
+// results, as each transaction deserializes into it and commits it.
+func (txn *Transaction) claimEntity(entityPtr Model) error {
+	if entityPtr == nil || reflect.ValueOf(entityPtr).Kind() != reflect.Ptr {
+		return nil
+	}
+	owner, loaded := entityOwners.LoadOrStore(entityPtr, txn)
+	if !loaded {
+		txn.owned = append(txn.owned, entityPtr)
+		return nil
+	}
+	if owner != txn {
+		return errors.Wrapf(EntityAliasingError, "%T at %p", entityPtr, entityPtr)
+	}
+	return nil
+}
+
+// releaseEntities releases the entities claimed by the transaction, when it ends
+func (txn *Transaction) releaseEntities() {
+	for _, entityPtr := range txn.owned {
+		entityOwners.Delete(entityPtr)
+	}
+	txn.owned = nil
+}
@@ -0,0 +1,44 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityAliasing(t *testing.T) {
+	mock := mockCosmos{ReturnEtag: "etag-1", ReturnUserId: "partitionvalue"}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var shared MyModel
+	require.NoError(t, c.Session().Transaction(func(txn *Transaction) error {
+		if err := txn.Get("partitionvalue", "idvalue", &shared); err != nil {
+			return err
+		}
+		// Another transaction running at the same time can not use the entity
+		err := c.Session().Transaction(func(other *Transaction) error {
+			return other.Get("partitionvalue", "idvalue", &shared)
+		})
+		assert.Equal(t, EntityAliasingError, errors.Cause(err))
+
+		err = c.Session().Transaction(func(other *Transaction) error {
+			var entity MyModel
+			if err := other.Get("partitionvalue", "idvalue", &entity); err != nil {
+				return err
+			}
+			other.Put(&shared)
+			return nil
+		})
+		assert.Equal(t, EntityAliasingError, errors.Cause(err))
+
+		txn.Put(&shared)
+		return nil
+	}))
+
+	// Once the transaction is done, the entity can be used again
+	require.NoError(t, c.Session().Transaction(func(txn *Transaction) error {
+		return txn.Get("partitionvalue", "idvalue", &shared)
+	}))
+}
@@ -0,0 +1,116 @@
+package cosmos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+var MissingEtagError = errors.New("Entity has no etag; it must be read from the database before a conditional write")
+
+// EtagMatch is the concurrency control of a write, in terms of the etag of the entity written. When a
+// condition is not met, the write fails with an error with cause cosmosapi.ErrPreconditionFailed.
+type EtagMatch int
+
+const (
+	// MatchAny writes unconditionally, overwriting any changes made by others since the entity was read
+	MatchAny EtagMatch = iota
+	// MatchEtag writes only if the document still has the etag of the entity; an entity without an etag is
+	// rejected with MissingEtagError
+	MatchEtag
+	// MatchNotExists writes only if the document does not exist
+	MatchNotExists
+	// MatchCurrent is MatchEtag for entities with an etag, and MatchNotExists for entities without; i.e. the
+	// write succeeds only if the document is as it was when read. This is how transactions commit.
+	MatchCurrent
+)
+
+func (m EtagMatch) String() string {
+	switch m {
+	case MatchAny:
+		return "MatchAny"
+	case MatchEtag:
+		return "MatchEtag"
+	case MatchNotExists:
+		return "MatchNotExists"
+	case MatchCurrent:
+		return "MatchCurrent"
+	}
+	return fmt.Sprintf("EtagMatch(%d)", int(m))
+}
+
+// HasEtag returns true if the entity has an etag, i.e. it was read from (or written to) the database
+func (bm *BaseModel) HasEtag() bool {
+	return bm.Etag != ""
+}
+
+// RequireEtag returns MissingEtagError if the entity has no etag
+func (bm *BaseModel) RequireEtag() error {
+	if !bm.HasEtag() {
+		return errors.WithStack(MissingEtagError)
+	}
+	return nil
+}
+
+// ifMatch resolves the match for an entity with the given etag, returning the etag to make the write
+// conditional on, if any, and whether the document must not exist
+func (m EtagMatch) ifMatch(etag string) (ifMatch string, mustNotExist bool, err error) {
+	switch m {
+	case MatchAny:
+		return "", false, nil
+	case MatchEtag:
+		if etag == "" {
+			return "", false, errors.WithStack(MissingEtagError)
+		}
+		return etag, false, nil
+	case MatchNotExists:
+		return "", true, nil
+	case MatchCurrent:
+		return etag, etag == "", nil
+	}
+	return "", false, errors.Errorf("Unknown EtagMatch %v", m)
+}
+
+// PutMatching writes the entity with the given concurrency control; RacingPut is PutMatching with MatchAny.
+// On success, the etag of the entity is updated, so that it can be written again with MatchEtag.
+func (c Collection) PutMatching(entityPtr Model, match EtagMatch) (response cosmosapi.DocumentResponse, err error) {
+	basePtr, partitionValue, err := c.getEntityInfo(entityPtr)
+	if err != nil {
+		return response, err
+	}
+	base := *basePtr
+	err = c.intercept(Operation{Kind: OperationPut, PartitionKey: partitionValue, Id: base.Id, Entity: entityPtr}, func() error {
+		if err := c.prePut(entityPtr.(Model), nil); err != nil {
+			return err
+		}
+		var resource *cosmosapi.Resource
+		resource, response, err = c.put(c.GetContext(), entityPtr, base, partitionValue, match)
+		if err != nil {
+			return err
+		}
+		*basePtr = BaseModel(*resource)
+		c.entityCacheWritten(partitionValue, base.Id, entityPtr)
+		return nil
+	})
+	return
+}
+
+// PutMatchingContext is like PutMatching, but does the request with ctx
+func (c Collection) PutMatchingContext(ctx context.Context, entityPtr Model, match EtagMatch) (cosmosapi.DocumentResponse, error) {
+	return c.WithContext(ctx).PutMatching(entityPtr, match)
+}
+
+// PatchIfMatch is like Patch, but the patch is only applied if the document has the given etag
+func (c Collection) PatchIfMatch(partitionValue interface{}, id string, etag string, condition string, target Model, operations ...cosmosapi.PatchOperation) error {
+	if etag == "" {
+		return errors.WithStack(MissingEtagError)
+	}
+	return c.patch(partitionValue, id, etag, condition, target, operations)
+}
+
+// PatchIfMatchContext is like PatchIfMatch, but does the request with ctx
+func (c Collection) PatchIfMatchContext(ctx context.Context, partitionValue interface{}, id string, etag string, condition string, target Model, operations ...cosmosapi.PatchOperation) error {
+	return c.WithContext(ctx).PatchIfMatch(partitionValue, id, etag, condition, target, operations...)
+}
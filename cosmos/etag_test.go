@@ -0,0 +1,62 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestPutMatching(t *testing.T) {
+	mock := mockCosmos{ReturnEtag: "etag-1"}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	entity := MyModel{BaseModel: BaseModel{Id: "id"}, UserId: "u"}
+	assert.False(t, entity.HasEtag())
+	assert.Equal(t, MissingEtagError, errors.Cause(entity.RequireEtag()))
+
+	_, err := c.PutMatching(&entity, MatchEtag)
+	assert.Equal(t, MissingEtagError, errors.Cause(err))
+	assert.Equal(t, "", mock.GotMethod)
+
+	_, err = c.PutMatching(&entity, MatchCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, "create", mock.GotMethod)
+	assert.False(t, mock.GotUpsert)
+	assert.Equal(t, "etag-1", entity.Etag)
+	assert.NoError(t, entity.RequireEtag())
+
+	mock.ReturnEtag = "etag-2"
+	_, err = c.PutMatching(&entity, MatchEtag)
+	require.NoError(t, err)
+	assert.Equal(t, "replace", mock.GotMethod)
+	assert.Equal(t, "etag-2", entity.Etag)
+
+	_, err = c.PutMatching(&entity, MatchAny)
+	require.NoError(t, err)
+	assert.Equal(t, "create", mock.GotMethod)
+	assert.True(t, mock.GotUpsert)
+
+	mock.ReturnError = cosmosapi.ErrConflict
+	_, err = c.PutMatching(&entity, MatchNotExists)
+	assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+	assert.False(t, mock.GotUpsert)
+}
+
+func TestPatchIfMatch(t *testing.T) {
+	mock := mockCosmosPatch{doc: map[string]interface{}{"id": "id", "userId": "u"}, etag: 1}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	err := c.PatchIfMatch("u", "id", "", "", nil, cosmosapi.PatchSet("/x", 1))
+	assert.Equal(t, MissingEtagError, errors.Cause(err))
+
+	err = c.PatchIfMatch("u", "id", "etag-0", "", nil, cosmosapi.PatchSet("/x", 1))
+	assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+	assert.Equal(t, "etag-0", mock.GotIfMatch)
+
+	var target patchModel
+	require.NoError(t, c.PatchIfMatch("u", "id", "etag-1", "", &target, cosmosapi.PatchSet("/x", 1)))
+	assert.Equal(t, "etag-2", target.Etag)
+}
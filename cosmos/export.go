@@ -0,0 +1,172 @@
+package cosmos
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// ExportEncoder writes the documents exported by Collection.Export in some format. Encoders for formats
+// that need further dependencies, such as Parquet, can be implemented outside this module.
+type ExportEncoder interface {
+	// Encode writes a document, as returned by Cosmos
+	Encode(doc json.RawMessage) error
+	// Flush is called after each page of results, and once after the last
+	Flush() error
+}
+
+// Export runs the query and passes the results to enc, page by page. Only one page is held in memory at
+// a time, and the next page is not fetched until the current one has been encoded, so a slow writer (e.g.
+// an HTTP client reading an export) slows down the query rather than making it buffer.
+//
+// The documents are passed through the document adapter of the collection if one is set; no hooks are
+// called. The number of documents encoded is returned, also on errors. If ctx is cancelled, the query
+// stops and ctx.Err() is returned.
+func (c Collection) Export(ctx context.Context, query cosmosapi.Query, enc ExportEncoder) (count int, err error) {
+	pager := c.newQueryPager(ctx, query)
+	for {
+		var page []json.RawMessage
+		ok, err := pager.next(&page)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			return count, nil
+		}
+		for _, doc := range page {
+			if err := enc.Encode(doc); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if err := enc.Flush(); err != nil {
+			return count, err
+		}
+	}
+}
+
+// flushHTTP flushes w if it is an http.Flusher
+func flushHTTP(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+type ndjsonEncoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// NewNDJSONEncoder returns an ExportEncoder writing newline-delimited JSON, one document per line. If w
+// is an http.Flusher, it is flushed after each page.
+func NewNDJSONEncoder(w io.Writer) ExportEncoder {
+	return &ndjsonEncoder{w: w}
+}
+
+func (e *ndjsonEncoder) Encode(doc json.RawMessage) error {
+	e.buf.Reset()
+	if err := json.Compact(&e.buf, doc); err != nil {
+		return errors.WithStack(err)
+	}
+	e.buf.WriteByte('\n')
+	_, err := e.w.Write(e.buf.Bytes())
+	return errors.WithStack(err)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	flushHTTP(e.w)
+	return nil
+}
+
+type csvEncoder struct {
+	w             io.Writer
+	csv           *csv.Writer
+	columns       []string
+	headerWritten bool
+	record        []string
+}
+
+// NewCSVEncoder returns an ExportEncoder writing CSV with a header row and the given columns. Columns
+// are property names, with dots for nested properties (e.g. "address.city"). Missing and null values
+// are written as empty strings, and objects and arrays as JSON. If w is an http.Flusher, it is flushed
+// after each page.
+func NewCSVEncoder(w io.Writer, columns ...string) ExportEncoder {
+	return &csvEncoder{w: w, csv: csv.NewWriter(w), columns: columns, record: make([]string, len(columns))}
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	return errors.WithStack(e.csv.Write(e.columns))
+}
+
+func (e *csvEncoder) Encode(doc json.RawMessage) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := unmarshalUseNumber(doc, &fields); err != nil {
+		return err
+	}
+	for i, column := range e.columns {
+		value, err := csvValue(lookupPath(fields, column))
+		if err != nil {
+			return err
+		}
+		e.record[i] = value
+	}
+	return errors.WithStack(e.csv.Write(e.record))
+}
+
+func (e *csvEncoder) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.csv.Flush()
+	if err := e.csv.Error(); err != nil {
+		return errors.WithStack(err)
+	}
+	flushHTTP(e.w)
+	return nil
+}
+
+// lookupPath returns the value of the dotted property path in fields, or nil if it is missing
+func lookupPath(fields map[string]interface{}, path string) interface{} {
+	var value interface{} = fields
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+func csvValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		data, err := json.Marshal(v)
+		return string(data), errors.WithStack(err)
+	}
+}
@@ -0,0 +1,38 @@
+package cosmos
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestExportCSV(t *testing.T) {
+	mock := mockCosmosQuery{Pages: []string{
+		`[{"id": "a", "userId": "u", "x": 1, "address": {"city": "Oslo"}, "tags": ["t"]},
+		  {"id": "b,c", "userId": "u", "x": 2.5, "active": true, "address": null}]`,
+		`[{"id": "d", "userId": "u", "x": 12345678901234567890}]`,
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var buf bytes.Buffer
+	enc := NewCSVEncoder(&buf, "id", "x", "active", "address.city", "tags")
+	count, err := c.Export(context.Background(), cosmosapi.Query{Query: "SELECT * FROM c"}, enc)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+	require.Equal(t, `id,x,active,address.city,tags
+a,1,,Oslo,"[""t""]"
+"b,c",2.5,true,,
+d,12345678901234567890,,,
+`, buf.String())
+
+	// The header is written also when there are no results
+	mock = mockCosmosQuery{Pages: []string{`[]`}}
+	buf.Reset()
+	count, err = c.Export(context.Background(), cosmosapi.Query{Query: "SELECT * FROM c"}, NewCSVEncoder(&buf, "id"))
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	require.Equal(t, "id\n", buf.String())
+}
@@ -0,0 +1,153 @@
+package cosmos
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Fields of entities can be given previous names in a `cosmosalias:"..."` tag, so that documents written
+// before a field was renamed can still be read:
+//
+//	type User struct {
+//		cosmos.BaseModel
+//		UserId string `json:"userId" cosmosalias:"UserID,user_id"`
+//	}
+//
+// When a document read by a point read, patch or Collection.Query does not have the field under its JSON
+// name, the value of the first alias present is used instead. The entity is written back with the JSON
+// name only, so documents migrate as they are written. Aliases are matched exactly; note that JSON names
+// themselves are matched case-insensitively by encoding/json. Aliases are honored in nested structs, but
+// not in slices or maps.
+
+// aliasField is a field of a struct that has aliases, or a struct containing such fields
+type aliasField struct {
+	name    string
+	aliases []string
+	nested  fieldAliases
+}
+
+type fieldAliases []aliasField
+
+// fieldAliasesByType caches the fieldAliases per type
+var fieldAliasesByType sync.Map
+
+func fieldAliasesOf(t reflect.Type) fieldAliases {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if cached, ok := fieldAliasesByType.Load(t); ok {
+		return cached.(fieldAliases)
+	}
+	aliases := newFieldAliases(t, map[reflect.Type]bool{})
+	fieldAliasesByType.Store(t, aliases)
+	return aliases
+}
+
+func newFieldAliases(t reflect.Type, visiting map[reflect.Type]bool) (result fieldAliases) {
+	if t.Kind() != reflect.Struct || visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		fieldT := field.Type
+		for fieldT.Kind() == reflect.Ptr {
+			fieldT = fieldT.Elem()
+		}
+		nested := newFieldAliases(fieldT, visiting)
+		if field.Anonymous && name == "" {
+			// Fields of embedded structs are marshalled as fields of the outer struct
+			result = append(result, nested...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		var aliases []string
+		if tag := field.Tag.Get("cosmosalias"); tag != "" {
+			aliases = strings.Split(tag, ",")
+		}
+		if len(aliases) > 0 || len(nested) > 0 {
+			result = append(result, aliasField{name: name, aliases: aliases, nested: nested})
+		}
+	}
+	return result
+}
+
+// jsonFieldName returns the name given in the json tag of the field, if any; ok is false if the field is
+// not marshalled
+func jsonFieldName(field reflect.StructField) (name string, ok bool) {
+	if field.PkgPath != "" && !field.Anonymous {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	return strings.Split(tag, ",")[0], true
+}
+
+// apply renames aliased fields in doc to their JSON names
+func (aliases fieldAliases) apply(doc json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil || fields == nil {
+		// Not an object; leave it to the unmarshalling into the entity to complain
+		return doc, nil
+	}
+	changed := false
+	for _, field := range aliases {
+		if _, ok := fields[field.name]; !ok {
+			for _, alias := range field.aliases {
+				if value, ok := fields[alias]; ok {
+					fields[field.name] = value
+					delete(fields, alias)
+					changed = true
+					break
+				}
+			}
+		}
+		if value, ok := fields[field.name]; ok && len(field.nested) > 0 {
+			adapted, err := field.nested.apply(value)
+			if err != nil {
+				return nil, err
+			}
+			if string(adapted) != string(value) {
+				fields[field.name] = adapted
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return doc, nil
+	}
+	adapted, err := json.Marshal(fields)
+	return adapted, errors.WithStack(err)
+}
+
+// documentAdapterFor returns the adapter to use for documents unmarshalled into values of type t: the
+// adapter of the collection, if any, followed by renaming of aliased fields, if t has any
+func (c Collection) documentAdapterFor(t reflect.Type) DocumentAdapter {
+	aliases := fieldAliasesOf(t)
+	if len(aliases) == 0 {
+		return c.adapter
+	}
+	if c.adapter == nil {
+		return aliases.apply
+	}
+	return func(doc json.RawMessage) (json.RawMessage, error) {
+		doc, err := c.adapter(doc)
+		if err != nil {
+			return nil, err
+		}
+		return aliases.apply(doc)
+	}
+}
@@ -0,0 +1,76 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type aliasedAddress struct {
+	Country string `json:"country" cosmosalias:"land"`
+}
+
+type aliasedModel struct {
+	BaseModel
+	Model   string          `json:"model" cosmosmodel:"AliasedModel/1"`
+	UserId  string          `json:"userId" cosmosalias:"UserIdentifier,user_id"`
+	Name    string          `json:"name" cosmosalias:"fullName"`
+	Address *aliasedAddress `json:"address"`
+}
+
+func (e *aliasedModel) PrePut(txn *Transaction) error  { return nil }
+func (e *aliasedModel) PostGet(txn *Transaction) error { return nil }
+
+// rawDocument serves doc on reads and records what is written
+type rawDocument struct {
+	doc     string
+	written []byte
+}
+
+func (r *rawDocument) GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	return cosmosapi.DocumentResponse{}, json.Unmarshal([]byte(r.doc), out)
+}
+
+func (r *rawDocument) CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	var err error
+	r.written, err = json.Marshal(doc)
+	return &cosmosapi.Resource{Etag: "etag"}, cosmosapi.DocumentResponse{}, err
+}
+
+func TestFieldAliases(t *testing.T) {
+	raw := &rawDocument{doc: `{"id": "id1", "user_id": "alice", "fullName": "Alice", "address": {"land": "NO"}, "_etag": "etag"}`}
+	c := Collection{Client: Compose(raw), DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var e aliasedModel
+	require.NoError(t, c.StaleGet("alice", "id1", &e))
+	assert.Equal(t, "alice", e.UserId)
+	assert.Equal(t, "Alice", e.Name)
+	assert.Equal(t, "NO", e.Address.Country)
+
+	// Written back in the canonical form
+	require.NoError(t, c.RacingPut(&e))
+	var written map[string]interface{}
+	require.NoError(t, json.Unmarshal(raw.written, &written))
+	assert.Equal(t, "alice", written["userId"])
+	assert.Equal(t, map[string]interface{}{"country": "NO"}, written["address"])
+	assert.NotContains(t, written, "user_id")
+
+	// The JSON name takes precedence over aliases
+	raw.doc = `{"id": "id1", "userId": "alice", "user_id": "bob", "_etag": "etag"}`
+	require.NoError(t, c.StaleGet("alice", "id1", &e))
+	assert.Equal(t, "alice", e.UserId)
+}
+
+func TestFieldAliasesOf(t *testing.T) {
+	assert.Len(t, fieldAliasesOf(reflect.TypeOf(&MyModel{})), 0)
+	assert.Equal(t, fieldAliases{
+		{name: "userId", aliases: []string{"UserIdentifier", "user_id"}},
+		{name: "name", aliases: []string{"fullName"}},
+		{name: "address", nested: fieldAliases{{name: "country", aliases: []string{"land"}}}},
+	}, fieldAliasesOf(reflect.TypeOf(&aliasedModel{})))
+}
@@ -0,0 +1,82 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Healthy checks that the collection can be reached, by reading its metadata (a cheap request that
+// also verifies that the collection exists and the credentials are accepted). It returns the latency
+// of the request.
+func (c Collection) Healthy(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	_, err := c.Client.GetCollection(ctx, c.DbName, c.Name)
+	return time.Since(start), err
+}
+
+// HealthStatus is the result of a health check
+type HealthStatus struct {
+	Healthy   bool          `json:"healthy"`
+	Latency   time.Duration `json:"latency"`
+	CheckedAt time.Time     `json:"checkedAt"`
+	// The last error seen, which is kept after the collection becomes healthy again
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt"`
+}
+
+// HealthCheck runs Collection.Healthy and remembers the result. It implements http.Handler, responding
+// with the status as JSON and HTTP 200 if healthy and 503 otherwise, and is suitable as a Kubernetes
+// readiness probe:
+//
+//	http.Handle("/ready", collection.HealthCheck(2*time.Second))
+type HealthCheck struct {
+	collection Collection
+	timeout    time.Duration
+
+	mu     sync.Mutex
+	status HealthStatus
+}
+
+// HealthCheck returns a HealthCheck for the collection, where each check times out after timeout
+func (c Collection) HealthCheck(timeout time.Duration) *HealthCheck {
+	return &HealthCheck{collection: c, timeout: timeout}
+}
+
+// Check runs a health check and returns the result
+func (h *HealthCheck) Check(ctx context.Context) HealthStatus {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	latency, err := h.collection.Healthy(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.Healthy = err == nil
+	h.status.Latency = latency
+	h.status.CheckedAt = time.Now()
+	if err != nil {
+		h.status.LastError = err.Error()
+		h.status.LastErrorAt = h.status.CheckedAt
+	}
+	return h.status
+}
+
+// Status returns the result of the last check, without running a new one
+func (h *HealthCheck) Status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+func (h *HealthCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := h.Check(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if status.Healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
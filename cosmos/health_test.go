@@ -0,0 +1,49 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosHealth struct {
+	Client
+	ReturnError error
+}
+
+func (mock *mockCosmosHealth) GetCollection(ctx context.Context, dbName, colName string) (*cosmosapi.Collection, error) {
+	return &cosmosapi.Collection{}, mock.ReturnError
+}
+
+func TestHealthCheck(t *testing.T) {
+	mock := mockCosmosHealth{}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	check := c.HealthCheck(time.Second)
+
+	w := httptest.NewRecorder()
+	check.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var status HealthStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	require.True(t, status.Healthy)
+
+	mock.ReturnError = cosmosapi.ErrUnavailable
+	w = httptest.NewRecorder()
+	check.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.False(t, check.Status().Healthy)
+	require.Equal(t, cosmosapi.ErrUnavailable.Error(), check.Status().LastError)
+
+	// The last error is kept after recovering
+	mock.ReturnError = nil
+	status = check.Check(context.Background())
+	require.True(t, status.Healthy)
+	require.Equal(t, cosmosapi.ErrUnavailable.Error(), status.LastError)
+	require.False(t, status.LastErrorAt.IsZero())
+}
@@ -0,0 +1,137 @@
+package cosmos
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	transactionPtrType = reflect.TypeOf((*Transaction)(nil))
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// registeredHooks holds hooks registered on a Collection, by model type. It is copied on every
+// registration, so that Collection keeps its value semantics.
+type registeredHooks struct {
+	postGet map[reflect.Type][]reflect.Value
+	prePut  map[reflect.Type][]reflect.Value
+}
+
+// OnPostGet registers a hook that is called on entities of a given model type after a successful Get(),
+// right after the PostGet() method of the model. fn must have the signature
+//
+//	func(entity *MyModel, txn *Transaction) error
+//
+// where the type of the first argument decides which model the hook applies to. This makes it possible to
+// attach cross-cutting behaviour (metrics, validation, ...) to models in packages you do not own.
+// Several hooks can be registered for the same model; they are called in order of registration.
+// Hooks registered for an exported struct embedded by value in a model (e.g. a struct shared by several
+// models, which itself embeds BaseModel) also apply to the model, and are called before those of the model.
+// Passing a function of another signature panics.
+func (c Collection) OnPostGet(fn interface{}) Collection {
+	t, v := checkHook(fn)
+	c.hooks = c.hooks.with(func(h *registeredHooks) {
+		h.postGet[t] = append(h.postGet[t], v)
+	})
+	return c
+}
+
+// OnPrePut registers a hook that is called on entities of a given model type right before they are
+// written to the database, right after the PrePut() method of the model. See OnPostGet for the signature
+// of fn.
+func (c Collection) OnPrePut(fn interface{}) Collection {
+	t, v := checkHook(fn)
+	c.hooks = c.hooks.with(func(h *registeredHooks) {
+		h.prePut[t] = append(h.prePut[t], v)
+	})
+	return c
+}
+
+func checkHook(fn interface{}) (reflect.Type, reflect.Value) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 ||
+		!t.In(0).Implements(modelType) ||
+		t.In(1) != transactionPtrType || t.Out(0) != errorType {
+		panic(errors.Errorf("Hook must have the signature func(*MyModel, *cosmos.Transaction) error, got %s", t))
+	}
+	return t.In(0), v
+}
+
+func (h *registeredHooks) with(modify func(*registeredHooks)) *registeredHooks {
+	result := &registeredHooks{
+		postGet: make(map[reflect.Type][]reflect.Value),
+		prePut:  make(map[reflect.Type][]reflect.Value),
+	}
+	if h != nil {
+		for t, fns := range h.postGet {
+			result.postGet[t] = append([]reflect.Value(nil), fns...)
+		}
+		for t, fns := range h.prePut {
+			result.prePut[t] = append([]reflect.Value(nil), fns...)
+		}
+	}
+	modify(result)
+	return result
+}
+
+func runHooks(hooks []reflect.Value, entityPtr Model, txn *Transaction) error {
+	args := []reflect.Value{reflect.ValueOf(entityPtr), reflect.ValueOf(txn)}
+	for _, fn := range hooks {
+		if err, _ := fn.Call(args)[0].Interface().(error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *registeredHooks) runPostGet(entityPtr Model, txn *Transaction) error {
+	if h == nil {
+		return nil
+	}
+	return runHooksFor(h.postGet, entityPtr, txn)
+}
+
+func (h *registeredHooks) runPrePut(entityPtr Model, txn *Transaction) error {
+	if h == nil {
+		return nil
+	}
+	return runHooksFor(h.prePut, entityPtr, txn)
+}
+
+// runHooksFor runs the hooks registered for the type of the entity, after those registered for the
+// structs embedded in it (innermost first), so that hooks registered for a struct shared by several models
+// apply to all of them
+func runHooksFor(hooks map[reflect.Type][]reflect.Value, entityPtr Model, txn *Transaction) error {
+	for _, embeddedPtr := range embeddedModels(reflect.ValueOf(entityPtr)) {
+		if err := runHooks(hooks[embeddedPtr.Type()], embeddedPtr.Interface().(Model), txn); err != nil {
+			return err
+		}
+	}
+	return runHooks(hooks[reflect.TypeOf(entityPtr)], entityPtr, txn)
+}
+
+var modelType = reflect.TypeOf((*Model)(nil)).Elem()
+
+// embeddedModels returns pointers to the structs embedded (by value, at any depth) in the struct pointed
+// to by v that implement Model, innermost first
+func embeddedModels(v reflect.Value) []reflect.Value {
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	var result []reflect.Value
+	structV := v.Elem()
+	for i := 0; i != structV.NumField(); i++ {
+		field := structV.Type().Field(i)
+		if !field.Anonymous || field.Type.Kind() != reflect.Struct || field.Type == baseModelType {
+			continue
+		}
+		embeddedPtr := structV.Field(i).Addr()
+		result = append(result, embeddedModels(embeddedPtr)...)
+		if embeddedPtr.Type().Implements(modelType) && embeddedPtr.CanInterface() {
+			result = append(result, embeddedPtr)
+		}
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisteredHooks(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "partitionvalue"}
+	var calls []string
+	c := Collection{
+		Client:       &mock,
+		DbName:       "mydb",
+		Name:         "mycollection",
+		PartitionKey: "userId"}
+	withHooks := c.OnPostGet(func(e *MyModel, txn *Transaction) error {
+		require.Equal(t, 1, e.XPlusOne) // called after the PostGet method
+		calls = append(calls, "postGet 1")
+		return nil
+	}).OnPostGet(func(e *MyModel, txn *Transaction) error {
+		calls = append(calls, "postGet 2")
+		return nil
+	}).OnPrePut(func(e *MyModel, txn *Transaction) error {
+		require.NotNil(t, txn)
+		calls = append(calls, "prePut")
+		return nil
+	})
+
+	var entity MyModel
+	require.NoError(t, withHooks.StaleGet("partitionvalue", "idvalue", &entity))
+	require.Equal(t, []string{"postGet 1", "postGet 2"}, calls)
+
+	// The original collection is not affected
+	calls = nil
+	require.NoError(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	require.Empty(t, calls)
+
+	require.NoError(t, withHooks.Session().Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Put(&entity)
+		return nil
+	}))
+	require.Equal(t, []string{"postGet 1", "postGet 2", "prePut"}, calls)
+
+	// Errors are returned
+	hookErr := errors.New("hook error")
+	failing := c.OnPostGet(func(e *MyModel, txn *Transaction) error {
+		return hookErr
+	})
+	require.Equal(t, hookErr, errors.Cause(failing.StaleGet("partitionvalue", "idvalue", &entity)))
+
+	require.Panics(t, func() {
+		c.OnPostGet(func(e *MyModel) error { return nil })
+	})
+}
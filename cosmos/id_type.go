@@ -0,0 +1,127 @@
+package cosmos
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// IdTypeSeparator separates the type prefix from the key in a typed id
+const IdTypeSeparator = ":"
+
+// IdType is a document type prefix, for collections that store several types of documents and distinguish
+// them by id, e.g. "user:123" and "order:456". Declare one per model, e.g.
+//
+//	const UserIdType = cosmos.IdType("user")
+//
+// and use it to compose, parse and query ids, rather than concatenating strings by hand.
+type IdType string
+
+// Id returns the id of the document of this type with the given key, e.g. "user:123"
+func (t IdType) Id(key string) string {
+	return string(t) + IdTypeSeparator + key
+}
+
+// Key returns the key part of an id of this type, e.g. "123" for "user:123". It is an error if the
+// id is of another type.
+func (t IdType) Key(id string) (string, error) {
+	if !t.Matches(id) {
+		return "", errors.Errorf("Id '%s' is not of type '%s'", id, t)
+	}
+	return id[len(t)+len(IdTypeSeparator):], nil
+}
+
+// Matches returns whether id is of this type
+func (t IdType) Matches(id string) bool {
+	return strings.HasPrefix(id, string(t)+IdTypeSeparator)
+}
+
+// IdTypeOf returns the type of a typed id, or "" if the id has no type prefix
+func IdTypeOf(id string) IdType {
+	i := strings.Index(id, IdTypeSeparator)
+	if i < 0 {
+		return ""
+	}
+	return IdType(id[:i])
+}
+
+// Condition returns a condition selecting the documents of this type, for use in the WHERE clause of a query
+// over alias, together with the parameter it refers to, named @idType
+func (t IdType) Condition(alias string) (string, cosmosapi.QueryParam) {
+	return t.condition(alias, "@idType")
+}
+
+func (t IdType) condition(alias, paramName string) (string, cosmosapi.QueryParam) {
+	return "STARTSWITH(" + alias + ".id, " + paramName + ")", cosmosapi.QueryParam{Name: paramName, Value: string(t) + IdTypeSeparator}
+}
+
+// idTypeParamName returns a name for the parameter of an id type condition that is not used by params:
+// @idType, or if that is taken, @idType2 etc.
+func idTypeParamName(params []cosmosapi.QueryParam) string {
+	used := make(map[string]bool, len(params))
+	for _, param := range params {
+		used[strings.ToLower(param.Name)] = true
+	}
+	name := "@idType"
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("@idType%d", i)
+	}
+	return name
+}
+
+var queryClauseAfterWhereRegexp = regexp.MustCompile(`(?i)\b(ORDER\s+BY|GROUP\s+BY|OFFSET)\b`)
+var queryWhereRegexp = regexp.MustCompile(`(?i)\bWHERE\b`)
+
+// QueryIdType runs a query, such as
+//
+//	SELECT * FROM c WHERE c.active = true ORDER BY c.name
+//
+// restricted to the documents of type t; the condition of t is added to the WHERE clause, with a parameter
+// named so as not to clash with params (see Condition). Results are hydrated into entities, and all pages
+// are fetched, as for QueryProjection.
+func (c Collection) QueryIdType(t IdType, query string, entities interface{}, params ...cosmosapi.QueryParam) (cosmosapi.QueryDocumentsResponse, error) {
+	paramName := idTypeParamName(params)
+	scoped, err := scopeQuery(query, t, paramName)
+	if err != nil {
+		return cosmosapi.QueryDocumentsResponse{}, err
+	}
+	_, param := t.condition("", paramName)
+	return c.queryAllPages(cosmosapi.Query{Query: scoped, Params: append(params, param)}, entities)
+}
+
+// scopeQuery adds the condition of t, with the parameter paramName, to the WHERE clause of query. Only simple
+// queries on the form "SELECT ... FROM c [WHERE ...] [GROUP BY ...] [ORDER BY ...] [OFFSET ...]" are supported.
+func scopeQuery(query string, t IdType, paramName string) (string, error) {
+	from := queryFromRegexp.FindStringSubmatchIndex(query)
+	if from == nil {
+		return "", errors.Errorf("Can not scope query without FROM clause to an id type: %s", query)
+	}
+	alias, fromEnd := query[from[2]:from[3]], from[3]
+	if from[8] != -1 && !isSqlKeyword(query[from[8]:from[9]]) {
+		alias, fromEnd = query[from[8]:from[9]], from[9]
+	}
+	condition, _ := t.condition(alias, paramName)
+
+	rest := query[fromEnd:]
+	end := len(rest)
+	if m := queryClauseAfterWhereRegexp.FindStringIndex(rest); m != nil {
+		end = m[0]
+	}
+	if where := queryWhereRegexp.FindStringIndex(rest[:end]); where != nil {
+		filter := strings.TrimSpace(rest[where[1]:end])
+		rest = strings.TrimRight(rest[:where[0]], " \t\n") + " WHERE " + condition + " AND (" + filter + ")" + suffixWithSpace(rest[end:])
+	} else {
+		rest = strings.TrimRight(rest[:end], " \t\n") + " WHERE " + condition + suffixWithSpace(rest[end:])
+	}
+	return query[:fromEnd] + rest, nil
+}
+
+func suffixWithSpace(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " " + s
+}
@@ -0,0 +1,54 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestIdType(t *testing.T) {
+	const userIdType = IdType("user")
+	id := userIdType.Id("123:abc")
+	require.Equal(t, "user:123:abc", id)
+	require.True(t, userIdType.Matches(id))
+	require.False(t, IdType("use").Matches(id))
+	require.Equal(t, userIdType, IdTypeOf(id))
+	require.Equal(t, IdType(""), IdTypeOf("123"))
+
+	key, err := userIdType.Key(id)
+	require.NoError(t, err)
+	require.Equal(t, "123:abc", key)
+	_, err = IdType("order").Key(id)
+	require.Error(t, err)
+}
+
+func TestScopeQuery(t *testing.T) {
+	for _, tc := range []struct{ query, expected string }{
+		{"SELECT * FROM c", "SELECT * FROM c WHERE STARTSWITH(c.id, @idType)"},
+		{"SELECT * FROM root r WHERE r.x = 1 OR r.y = 2",
+			"SELECT * FROM root r WHERE STARTSWITH(r.id, @idType) AND (r.x = 1 OR r.y = 2)"},
+		{"SELECT * FROM c ORDER BY c.name", "SELECT * FROM c WHERE STARTSWITH(c.id, @idType) ORDER BY c.name"},
+		{"SELECT c.id FROM c where c.active = true order by c.name OFFSET 0 LIMIT 10",
+			"SELECT c.id FROM c WHERE STARTSWITH(c.id, @idType) AND (c.active = true) order by c.name OFFSET 0 LIMIT 10"},
+	} {
+		scoped, err := scopeQuery(tc.query, "user", "@idType")
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, scoped)
+	}
+
+	mock := mockCosmosQuery{Pages: []string{`[{"id": "user:a", "userId": "u", "x": 1}]`}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	var items []myModelListItem
+	_, err := c.QueryIdType("user", "SELECT * FROM c WHERE c.x = @x", &items, cosmosapi.QueryParam{Name: "@x", Value: 1})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, []cosmosapi.QueryParam{{Name: "@x", Value: 1}, {Name: "@idType", Value: "user:"}}, mock.GotQueries[0].Params)
+
+	// A parameter named @idType by the caller is left alone
+	mock.Pages = append(mock.Pages, `[]`)
+	_, err = c.QueryIdType("user", "SELECT * FROM c WHERE c.idType = @idType", &items, cosmosapi.QueryParam{Name: "@idType", Value: "x"})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM c WHERE STARTSWITH(c.id, @idType2) AND (c.idType = @idType)", mock.GotQueries[1].Query)
+	require.Equal(t, []cosmosapi.QueryParam{{Name: "@idType", Value: "x"}, {Name: "@idType2", Value: "user:"}}, mock.GotQueries[1].Params)
+}
@@ -0,0 +1,82 @@
+package cosmos
+
+import "context"
+
+type OperationKind string
+
+const (
+	OperationGet    = OperationKind("get")
+	OperationPut    = OperationKind("put")
+	OperationPatch  = OperationKind("patch")
+	OperationDelete = OperationKind("delete")
+	OperationQuery  = OperationKind("query")
+	OperationList   = OperationKind("list")
+	OperationSproc  = OperationKind("sproc")
+)
+
+// Operation describes an operation passed through the interceptors of a Collection
+type Operation struct {
+	Kind         OperationKind
+	DbName       string
+	Collection   string
+	PartitionKey interface{}
+	Id           string
+	// For OperationGet, Entity is the target, which is populated when next() returns successfully.
+	// For OperationPut and OperationPatch, Entity is the entity to be written (if any).
+	// For OperationDelete, Entity is the entity to be deleted.
+	Entity Model
+	// Query is set for OperationQuery
+	Query string
+	// Sproc is the name of the stored procedure for OperationSproc
+	Sproc string
+	// Transaction is set if the operation is done within a transaction
+	Transaction *Transaction
+	// Context is the context the operation is done with
+	Context context.Context
+	// batched is set on all but the first of the operations done in a single request, see interceptAll
+	batched bool
+}
+
+// Interceptor wraps operations on a Collection or Session. It should call next() to perform the
+// operation, and can do work before and after, refuse the operation by returning an error without
+// calling next(), or map the error returned by next(). This way cross-cutting concerns such as
+// authorization checks, data residency guards and logging can be implemented once rather than in
+// every model hook.
+type Interceptor func(op Operation, next func() error) error
+
+// WithInterceptor returns a Collection where interceptor wraps all Get, Put, Patch, Delete and Query operations,
+// as well as listings of the documents (OperationList, e.g. ReadFeed) and stored procedures (OperationSproc),
+// including those done through sessions and transactions created from it. Interceptors are called in the
+// order they are added; i.e. the first interceptor added is the outermost.
+func (c Collection) WithInterceptor(interceptor Interceptor) Collection {
+	interceptors := make([]Interceptor, 0, len(c.interceptors)+1)
+	interceptors = append(interceptors, c.interceptors...)
+	c.interceptors = append(interceptors, interceptor)
+	return c
+}
+
+// WithInterceptor returns a Session where interceptor wraps all operations in addition to the
+// interceptors of the Collection. See Collection.WithInterceptor.
+func (session Session) WithInterceptor(interceptor Interceptor) Session {
+	session.Collection = session.Collection.WithInterceptor(interceptor)
+	return session
+}
+
+func (c Collection) intercept(op Operation, fn func() error) error {
+	if len(c.interceptors) == 0 {
+		return fn()
+	}
+	op.DbName = c.DbName
+	op.Collection = c.Name
+	if op.Context == nil {
+		op.Context = c.GetContext()
+	}
+	next := fn
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := c.interceptors[i], next
+		next = func() error {
+			return interceptor(op, inner)
+		}
+	}
+	return next()
+}
@@ -0,0 +1,74 @@
+package cosmos
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptors(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "partitionvalue"}
+	c := Collection{
+		Client:       &mock,
+		DbName:       "mydb",
+		Name:         "mycollection",
+		PartitionKey: "userId"}
+
+	var log []string
+	logging := func(name string) Interceptor {
+		return func(op Operation, next func() error) error {
+			log = append(log, fmt.Sprintf("%s before %s %s/%s/%v/%s txn=%v", name, op.Kind, op.DbName, op.Collection, op.PartitionKey, op.Id, op.Transaction != nil))
+			err := next()
+			log = append(log, fmt.Sprintf("%s after %s err=%v", name, op.Kind, err))
+			return err
+		}
+	}
+	c = c.WithInterceptor(logging("outer")).WithInterceptor(logging("inner"))
+
+	var entity MyModel
+	require.NoError(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	require.Equal(t, []string{
+		"outer before get mydb/mycollection/partitionvalue/idvalue txn=false",
+		"inner before get mydb/mycollection/partitionvalue/idvalue txn=false",
+		"inner after get err=<nil>",
+		"outer after get err=<nil>",
+	}, log)
+
+	// Session interceptors are added to those of the collection
+	log = nil
+	session := c.Session().WithInterceptor(logging("session"))
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Put(&entity)
+		return nil
+	}))
+	require.Equal(t, []string{
+		"outer before get mydb/mycollection/partitionvalue/idvalue txn=true",
+		"inner before get mydb/mycollection/partitionvalue/idvalue txn=true",
+		"session before get mydb/mycollection/partitionvalue/idvalue txn=true",
+		"session after get err=<nil>",
+		"inner after get err=<nil>",
+		"outer after get err=<nil>",
+		"outer before put mydb/mycollection/partitionvalue/idvalue txn=true",
+		"inner before put mydb/mycollection/partitionvalue/idvalue txn=true",
+		"session before put mydb/mycollection/partitionvalue/idvalue txn=true",
+		"session after put err=<nil>",
+		"inner after put err=<nil>",
+		"outer after put err=<nil>",
+	}, log)
+	require.Equal(t, "create", mock.GotMethod)
+
+	// An interceptor can refuse an operation
+	refused := errors.New("refused")
+	mock.reset()
+	guarded := c.WithInterceptor(func(op Operation, next func() error) error {
+		if op.Kind == OperationPut {
+			return refused
+		}
+		return next()
+	})
+	require.Equal(t, refused, errors.Cause(guarded.RacingPut(&entity)))
+	require.Equal(t, "", mock.GotMethod)
+}
@@ -0,0 +1,61 @@
+package cosmos
+
+import "github.com/vippsas/go-cosmosdb/cosmosapi"
+
+// The interfaces below are small subsets of the API of Collection, Session and Transaction. Application
+// code can depend on these rather than the concrete types, so that tests can substitute fakes.
+
+// Txn is the API available inside a transaction; implemented by *Transaction
+type Txn interface {
+	Get(partitionValue interface{}, id string, target Model) error
+	Put(entityPtr Model)
+}
+
+// TxnDeleter is a Txn that can also delete entities; implemented by *Transaction
+type TxnDeleter interface {
+	Txn
+	Delete(entityPtr Model)
+}
+
+// Transactor runs transactions; implemented by Session
+type Transactor interface {
+	Transact(closure func(txn Txn) error) error
+}
+
+// StaleReader is implemented by Collection
+type StaleReader interface {
+	StaleGet(partitionValue interface{}, id string, target Model) error
+	StaleGetExisting(partitionValue interface{}, id string, target Model) error
+}
+
+// RacingWriter is implemented by Collection
+type RacingWriter interface {
+	RacingPut(entityPtr Model) error
+}
+
+// Querier is implemented by Collection
+type Querier interface {
+	Query(query string, entities interface{}) (cosmosapi.QueryDocumentsResponse, error)
+}
+
+// Repository is the non-transactional API of Collection
+type Repository interface {
+	StaleReader
+	RacingWriter
+	Querier
+}
+
+var (
+	_ Txn        = &Transaction{}
+	_ TxnDeleter = &Transaction{}
+	_ Transactor = Session{}
+	_ Repository = Collection{}
+)
+
+// Transact is like Transaction, but passes the transaction as the Txn interface, so that Session
+// implements Transactor
+func (session Session) Transact(closure func(txn Txn) error) error {
+	return session.Transaction(func(txn *Transaction) error {
+		return closure(txn)
+	})
+}
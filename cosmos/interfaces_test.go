@@ -0,0 +1,49 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// incrementX is an example of application code depending on the interfaces only
+func incrementX(sessions Transactor, userId, id string) error {
+	return sessions.Transact(func(txn Txn) error {
+		var entity MyModel
+		if err := txn.Get(userId, id, &entity); err != nil {
+			return err
+		}
+		entity.X++
+		txn.Put(&entity)
+		return nil
+	})
+}
+
+type fakeTransactor struct {
+	entities map[string]MyModel
+}
+
+func (f *fakeTransactor) Transact(closure func(txn Txn) error) error {
+	return closure(f)
+}
+
+func (f *fakeTransactor) Get(partitionValue interface{}, id string, target Model) error {
+	*target.(*MyModel) = f.entities[id]
+	return nil
+}
+
+func (f *fakeTransactor) Put(entityPtr Model) {
+	entity := entityPtr.(*MyModel)
+	f.entities[entity.Id] = *entity
+}
+
+func TestTransactor(t *testing.T) {
+	fake := &fakeTransactor{entities: map[string]MyModel{"idvalue": {BaseModel: BaseModel{Id: "idvalue"}, X: 1}}}
+	require.NoError(t, incrementX(fake, "partitionvalue", "idvalue"))
+	require.Equal(t, 2, fake.entities["idvalue"].X)
+
+	mock := mockCosmos{ReturnUserId: "partitionvalue", ReturnX: 1}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	require.NoError(t, incrementX(c.Session(), "partitionvalue", "idvalue"))
+	require.Equal(t, 2, mock.GotX)
+}
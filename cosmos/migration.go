@@ -1,17 +1,25 @@
 package cosmos
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
-// 'migrations' is indexed by a string "{fromModelName}|{toModelName}"
 type migrationFunc func(from, to interface{}) error
 
-var migrations = make(map[string]migrationFunc)
+type migration struct {
+	fromType, toType reflect.Type
+	convert          migrationFunc
+}
+
+// 'migrations' is indexed by a string "{fromModelName}|{toModelName}"
+var migrations = make(map[string]migration)
 
 // ModelNameRegexp defines the names that are accepted in the cosmosmodel:\"\" specifier (`^[a-zA-Z_]+/[0-9]+$`)
 var ModelNameRegexp = regexp.MustCompile(`^[a-zA-Z_]+/[0-9]+$`)
@@ -23,47 +31,42 @@ func checkModelName(modelName string) {
 	}
 }
 
-func syncModelField(entityPtr Model) {
+// modelField finds the Model field of the entity, which may be promoted from an embedded struct
+func modelField(entityPtr Model) (reflect.StructField, reflect.Value, bool) {
 	v := reflect.ValueOf(entityPtr).Elem()
-	structT := v.Type()
-	n := structT.NumField()
-	for i := 0; i != n; i++ {
-		field := structT.Field(i)
-		if field.Name == "Model" {
-			if field.Tag.Get("json") != "model" {
-				panic(errors.New("entity's Model does not have a `json:\"model\"` tag as required"))
-			}
-			modelName := field.Tag.Get("cosmosmodel")
-			checkModelName(modelName)
-			if modelName == "" {
-				panic(errors.New("Model field does not have `cosmosmodel:\"...\"` tag as required"))
-			}
+	field, ok := v.Type().FieldByName("Model")
+	if !ok {
+		return field, reflect.Value{}, false
+	}
+	if field.Tag.Get("json") != "model" {
+		panic(errors.New("entity's Model does not have a `json:\"model\"` tag as required"))
+	}
+	return field, v.FieldByIndex(field.Index), true
+}
 
-			v.Field(i).SetString(modelName)
-			break
-		}
+func syncModelField(entityPtr Model) {
+	field, value, ok := modelField(entityPtr)
+	if !ok {
+		return
 	}
+	modelName := field.Tag.Get("cosmosmodel")
+	checkModelName(modelName)
+	if modelName == "" {
+		panic(errors.New("Model field does not have `cosmosmodel:\"...\"` tag as required"))
+	}
+	value.SetString(modelName)
 }
 
 func lookupModelField(entityPtr Model) (tagVal, fieldVal string) {
-	v := reflect.ValueOf(entityPtr).Elem()
-	structT := v.Type()
-	n := structT.NumField()
-	for i := 0; i != n; i++ {
-		field := structT.Field(i)
-		if field.Name == "Model" {
-			if field.Tag.Get("json") != "model" {
-				panic(errors.New("entity's Model does not have a `json:\"model\"` tag as required"))
-			}
-			tagVal = field.Tag.Get("cosmosmodel")
-			if tagVal == "" {
-				panic(errors.New("Model field does not have `cosmosmodel:\"...\"` tag as required"))
-			}
-			fieldVal = v.Field(i).String()
-			return
-		}
+	field, value, ok := modelField(entityPtr)
+	if !ok {
+		panic(errors.New("No Model field"))
+	}
+	tagVal = field.Tag.Get("cosmosmodel")
+	if tagVal == "" {
+		panic(errors.New("Model field does not have `cosmosmodel:\"...\"` tag as required"))
 	}
-	panic(errors.New("No Model field"))
+	return tagVal, value.String()
 }
 
 // CheckModel will check that the Model attribute is correctly set; also return the value.
@@ -76,6 +79,10 @@ func CheckModel(entityPtr Model) string {
 	return tagVal
 }
 
+// AddMigration registers convFunc to convert entities of the model of fromPrototype to the model of
+// toPrototype; it is called with the entity as a value of the type of fromPrototype, and a pointer to a new
+// entity of the type of toPrototype to fill in. QueryModels and VisitModels use it for documents of a model
+// that is not registered with RegisterModel.
 func AddMigration(fromPrototype, toPrototype Model, convFunc migrationFunc) (dummyResult struct{}) {
 	fromTag, _ := lookupModelField(fromPrototype)
 	toTag, _ := lookupModelField(toPrototype)
@@ -84,18 +91,77 @@ func AddMigration(fromPrototype, toPrototype Model, convFunc migrationFunc) (dum
 	if ok {
 		panic(errors.Errorf("Several migrations from %s to %s", fromTag, toTag))
 	}
-	migrations[key] = convFunc
-	//panic(errors.New("not implemented"))
+	migrations[key] = migration{
+		fromType: reflect.TypeOf(fromPrototype).Elem(),
+		toType:   reflect.TypeOf(toPrototype).Elem(),
+		convert:  convFunc,
+	}
 	return
 }
 
-func postGet(entityPtr Model, txn *Transaction) error {
+// nextMigration returns the migration to apply to an entity of the model, and the model it converts to;
+// a migration to a registered model is preferred, and otherwise the one with the first name is used
+func nextMigration(modelName string) (m migration, toModelName string, ok bool) {
+	var candidates []string
+	for key := range migrations {
+		if strings.HasPrefix(key, modelName+"|") {
+			candidates = append(candidates, key)
+		}
+	}
+	sort.Strings(candidates)
+	for _, key := range candidates {
+		to := strings.TrimPrefix(key, modelName+"|")
+		if _, registered := modelTypes[to]; registered {
+			return migrations[key], to, true
+		}
+	}
+	if len(candidates) == 0 {
+		return m, "", false
+	}
+	return migrations[candidates[0]], strings.TrimPrefix(candidates[0], modelName+"|"), true
+}
+
+// migrateModel decodes a document of a model that is not registered, and converts it with the migrations
+// added with AddMigration until it is of a registered model
+func migrateModel(id, modelName string, doc json.RawMessage) (Model, error) {
+	var entity reflect.Value // a pointer to the entity
+	current := modelName
+	for steps := 0; steps < len(migrations); steps++ {
+		m, to, ok := nextMigration(current)
+		if !ok {
+			break
+		}
+		if !entity.IsValid() {
+			entity = reflect.New(m.fromType)
+			if err := json.Unmarshal(doc, entity.Interface()); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		converted := reflect.New(m.toType)
+		if err := m.convert(entity.Elem().Interface(), converted.Interface()); err != nil {
+			return nil, errors.WithMessage(err, fmt.Sprintf("Migration of document id='%s' from %s to %s failed", id, current, to))
+		}
+		syncModelField(converted.Interface().(Model))
+		entity, current = converted, to
+		if _, ok := modelTypes[current]; ok {
+			return entity.Interface().(Model), nil
+		}
+	}
+	return nil, errors.Errorf("Document id='%s' has model '%s', which is not registered", id, modelName)
+}
+
+func (c Collection) postGet(entityPtr Model, txn *Transaction) error {
 	// Always set Model to value in spec..
 	syncModelField(entityPtr)
-	return entityPtr.PostGet(txn)
+	if err := entityPtr.PostGet(txn); err != nil {
+		return err
+	}
+	return c.hooks.runPostGet(entityPtr, txn)
 }
 
-func prePut(entityPtr Model, txn *Transaction) error {
-	// This is not doing much but is a hook point for future additional code postPut
-	return entityPtr.PrePut(txn)
+func (c Collection) prePut(entityPtr Model, txn *Transaction) error {
+	if err := entityPtr.PrePut(txn); err != nil {
+		return err
+	}
+	return c.hooks.runPrePut(entityPtr, txn)
 }
@@ -0,0 +1,38 @@
+package cosmos
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// snapshotEntity serializes the entity of an operation to be processed in the background, as the caller
+// may modify the entity after the operation returns
+func snapshotEntity(entity Model) ([]byte, error) {
+	document, err := json.Marshal(entity)
+	return document, errors.WithStack(err)
+}
+
+// decodeForTarget decodes a document of one collection to be written to or compared with another
+// collection, without the properties maintained by Cosmos
+func decodeForTarget(document []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := unmarshalUseNumber(document, &doc); err != nil {
+		return nil, err
+	}
+	for property := range systemProperties {
+		delete(doc, property)
+	}
+	return doc, nil
+}
+
+// targetPartitionValue returns the partition value of doc in target, which may be partitioned differently
+// from the collection doc was read from
+func targetPartitionValue(target Collection, doc map[string]interface{}) (interface{}, error) {
+	partitionValue, ok := doc[target.PartitionKey]
+	if !ok {
+		return nil, errors.Errorf("Document id='%v' has no property '%s' to use as partition key in collection '%s'",
+			doc["id"], target.PartitionKey, target.Name)
+	}
+	return partitionValue, nil
+}
@@ -0,0 +1,95 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// AuditedBase is shared by several models, and embeds BaseModel itself. It is exported, as hooks can only
+// be run for exported embedded structs.
+type AuditedBase struct {
+	BaseModel
+	Model     string `json:"model" cosmosmodel:"Audited/1"`
+	UpdatedBy string `json:"updatedBy"`
+	Reads     int    `json:"-"`
+}
+
+func (e *AuditedBase) PrePut(txn *Transaction) error  { return nil }
+func (e *AuditedBase) PostGet(txn *Transaction) error { return nil }
+
+type auditedUser struct {
+	AuditedBase
+	UserId string `json:"userId"`
+	Name   string `json:"name"`
+}
+
+// mockCosmosJSON stores documents as JSON, for models of any type
+type mockCosmosJSON struct {
+	Client
+	Documents map[string][]byte
+}
+
+func (mock *mockCosmosJSON) GetDocument(ctx context.Context,
+	dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	doc, ok := mock.Documents[id]
+	if !ok {
+		return cosmosapi.DocumentResponse{}, cosmosapi.ErrNotFound
+	}
+	return cosmosapi.DocumentResponse{}, json.Unmarshal(doc, out)
+}
+
+func (mock *mockCosmosJSON) CreateDocument(ctx context.Context,
+	dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	var resource cosmosapi.Resource
+	data, _ := json.Marshal(doc)
+	_ = json.Unmarshal(data, &resource)
+	resource.Etag = "etag-1"
+	var m map[string]interface{}
+	_ = json.Unmarshal(data, &m)
+	m["_etag"] = resource.Etag
+	mock.Documents[resource.Id], _ = json.Marshal(m)
+	return &resource, cosmosapi.DocumentResponse{}, nil
+}
+
+func TestNestedBaseModel(t *testing.T) {
+	mock := mockCosmosJSON{Documents: make(map[string][]byte)}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.
+		OnPrePut(func(e *AuditedBase, txn *Transaction) error {
+			e.UpdatedBy = "hook"
+			return nil
+		}).
+		OnPostGet(func(e *AuditedBase, txn *Transaction) error {
+			e.Reads++
+			return nil
+		})
+
+	base, partitionValue := c.GetEntityInfo(&auditedUser{AuditedBase: AuditedBase{BaseModel: BaseModel{Id: "id"}}, UserId: "u"})
+	assert.Equal(t, "id", base.Id)
+	assert.Equal(t, "u", partitionValue)
+
+	var user auditedUser
+	require.NoError(t, c.Session().Transaction(func(txn *Transaction) error {
+		if err := txn.Get("u", "id", &user); err != nil {
+			return err
+		}
+		assert.True(t, user.IsNew())
+		assert.Equal(t, "Audited/1", user.Model)
+		user.Name = "Alice"
+		txn.Put(&user)
+		return nil
+	}))
+	assert.Equal(t, "etag-1", user.Etag)
+	assert.Equal(t, "Audited/1", CheckModel(&user))
+
+	var fetched auditedUser
+	require.NoError(t, c.StaleGet("u", "id", &fetched))
+	assert.Equal(t, "Alice", fetched.Name)
+	assert.Equal(t, "hook", fetched.UpdatedBy)
+	assert.Equal(t, 1, fetched.Reads)
+	assert.Equal(t, "etag-1", fetched.Etag)
+}
@@ -0,0 +1,326 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+	"github.com/vippsas/go-cosmosdb/logging"
+)
+
+// MigrationCheckpoint is the progress of a PartitionKeyMigration: the change feed position (etag) reached in
+// each partition key range of the source collection
+type MigrationCheckpoint struct {
+	Etags map[string]string `json:"etags"`
+}
+
+// MigrationCheckpointStore persists the checkpoint of a PartitionKeyMigration, so that it can be resumed
+// where it stopped. Load returns an empty checkpoint if none has been saved.
+type MigrationCheckpointStore interface {
+	Load() (MigrationCheckpoint, error)
+	Save(MigrationCheckpoint) error
+}
+
+// MemoryCheckpointStore keeps the checkpoint in memory; this allows delta passes within one process, but not
+// resuming after a restart
+type MemoryCheckpointStore struct {
+	mu         sync.Mutex
+	checkpoint MigrationCheckpoint
+}
+
+func (s *MemoryCheckpointStore) Load() (MigrationCheckpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyCheckpoint(s.checkpoint), nil
+}
+
+func (s *MemoryCheckpointStore) Save(checkpoint MigrationCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoint = copyCheckpoint(checkpoint)
+	return nil
+}
+
+// FileCheckpointStore keeps the checkpoint as JSON in the file at Path
+type FileCheckpointStore struct {
+	Path string
+}
+
+func (s FileCheckpointStore) Load() (MigrationCheckpoint, error) {
+	var checkpoint MigrationCheckpoint
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	} else if err != nil {
+		return checkpoint, errors.WithStack(err)
+	}
+	return checkpoint, errors.WithStack(json.Unmarshal(data, &checkpoint))
+}
+
+func (s FileCheckpointStore) Save(checkpoint MigrationCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Write and rename, so that a crash never leaves a truncated checkpoint
+	tmp := s.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, s.Path))
+}
+
+func copyCheckpoint(checkpoint MigrationCheckpoint) MigrationCheckpoint {
+	result := MigrationCheckpoint{Etags: make(map[string]string, len(checkpoint.Etags))}
+	for k, v := range checkpoint.Etags {
+		result.Etags[k] = v
+	}
+	return result
+}
+
+// MigrationReport summarizes a pass of a PartitionKeyMigration
+type MigrationReport struct {
+	// Read is the number of documents read from the source
+	Read int
+	// Written is the number of documents written to the target
+	Written int
+	// Skipped is the number of documents the transform function chose not to write
+	Skipped int
+	// RequestCharge is the sum of the RUs used reading the source
+	RequestCharge float64
+}
+
+// PartitionKeyMigration copies the documents of Source into Target, a collection with a different partition
+// key. The documents are read from the change feed of Source, one partition key range at a time, and the
+// position reached is checkpointed after each page; so a pass that fails or is stopped can be resumed by
+// running it again, and once the whole collection has been copied, another pass copies only the documents
+// changed since (the delta pass). When a range of Source is split, the migration continues with the ranges it
+// was split into, from the position reached in it.
+//
+// A typical migration is: Run a pass until it completes (resuming as needed); stop writes to Source (see
+// WriteFreeze); run a final delta pass; then switch the application over to Target. Note that deletes are
+// not seen by the change feed, so documents deleted from Source during the migration remain in Target.
+// The documents are written as upserts, so the Client of Target must implement DocumentUpserter.
+type PartitionKeyMigration struct {
+	Source Collection
+	Target Collection
+	// Transform, if not nil, is called with each source document (without system properties) and returns the
+	// document to write to Target, or nil to skip it. The partition key value is taken from the property
+	// Target.PartitionKey of the returned document.
+	Transform func(doc map[string]interface{}) (map[string]interface{}, error)
+	// Checkpoints stores the progress. Required.
+	Checkpoints MigrationCheckpointStore
+	// PageSize is the number of documents read from the change feed at a time (default 100)
+	PageSize int
+	// Concurrency is the number of documents written to Target in parallel (default 10)
+	Concurrency int
+	// AdaptiveConcurrency, if set, is used instead of Concurrency to limit the number of documents written in
+	// parallel, tuning the limit to the throttling seen on Target
+	AdaptiveConcurrency *cosmosapi.AdaptiveParallelism
+	// Log, if not nil, receives progress messages
+	Log logging.StdLogger
+}
+
+// Pass copies all documents changed in Source since the last checkpoint (initially: all documents) to Target.
+// It stops at the first error, with the progress up to the last completed page checkpointed.
+func (m PartitionKeyMigration) Pass(ctx context.Context) (MigrationReport, error) {
+	var report MigrationReport
+	if m.Checkpoints == nil {
+		return report, errors.New("PartitionKeyMigration.Checkpoints is required")
+	}
+	log := logging.Adapt(m.Log)
+	checkpoint, err := m.Checkpoints.Load()
+	if err != nil {
+		return report, err
+	}
+	checkpoint = copyCheckpoint(checkpoint)
+
+	source := m.Source.WithContext(ctx)
+	queue, err := m.readRanges(source, &checkpoint)
+	if err != nil {
+		return report, err
+	}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		for {
+			if err := ctx.Err(); err != nil {
+				return report, errors.WithStack(err)
+			}
+			var docs []json.RawMessage
+			response, err := source.ReadFeed(checkpoint.Etags[r.Id], r.Id, m.pageSize(), &docs)
+			report.RequestCharge += response.RequestCharge
+			if errors.Cause(err) == cosmosapi.ErrGone {
+				// The range has been split; continue with the ranges it was split into
+				ranges, err := m.readRanges(source, &checkpoint)
+				if err != nil {
+					return report, err
+				}
+				var children []string
+				for _, child := range ranges {
+					for _, parent := range child.Parents {
+						if parent == r.Id {
+							queue = append(queue, child)
+							children = append(children, child.Id)
+						}
+					}
+				}
+				log.Printf("Partition key migration of %s: range %s has been split into %v\n", m.Source.Name, r.Id, children)
+				break
+			} else if err != nil {
+				return report, errors.WithStack(err)
+			}
+			if len(docs) == 0 {
+				// Not modified; this range is up to date
+				break
+			}
+			report.Read += len(docs)
+			if err := m.writePage(ctx, docs, &report); err != nil {
+				return report, err
+			}
+			checkpoint.Etags[r.Id] = response.Etag
+			if err := m.Checkpoints.Save(checkpoint); err != nil {
+				return report, err
+			}
+			log.Debugf("Partition key migration of %s: range %s at %s, %d documents written\n", m.Source.Name, r.Id, response.Etag, report.Written)
+		}
+	}
+	log.Printf("Partition key migration of %s to %s: pass done, %d read, %d written, %d skipped\n", m.Source.Name, m.Target.Name, report.Read, report.Written, report.Skipped)
+	return report, nil
+}
+
+// readRanges returns the partition key ranges of the source that have not been split. The ranges that have
+// no checkpoint continue from the position reached in the range they were split from, if any; the checkpoint
+// is updated and saved accordingly.
+func (m PartitionKeyMigration) readRanges(source Collection, checkpoint *MigrationCheckpoint) ([]cosmosapi.PartitionKeyRange, error) {
+	ranges, err := source.GetPartitionKeyRanges()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	split := map[string]bool{}
+	for _, r := range ranges {
+		for _, parent := range r.Parents {
+			if etag, ok := checkpoint.Etags[parent]; ok {
+				if _, ok := checkpoint.Etags[r.Id]; !ok {
+					checkpoint.Etags[r.Id] = etag
+				}
+			}
+			split[parent] = true
+		}
+	}
+	var result []cosmosapi.PartitionKeyRange
+	for _, r := range ranges {
+		if !split[r.Id] {
+			result = append(result, r)
+		}
+	}
+	changed := false
+	for id := range split {
+		if _, ok := checkpoint.Etags[id]; ok {
+			delete(checkpoint.Etags, id)
+			changed = true
+		}
+	}
+	if changed {
+		if err := m.Checkpoints.Save(*checkpoint); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// writePage writes the documents to the target, Concurrency at a time, and returns the first error
+func (m PartitionKeyMigration) writePage(ctx context.Context, docs []json.RawMessage, report *MigrationReport) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, m.concurrency())
+	for _, raw := range docs {
+		done, err := m.acquire(ctx, slots)
+		if err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+			break
+		}
+		wg.Add(1)
+		go func(raw json.RawMessage) {
+			defer wg.Done()
+			written, retryCount, err := m.write(ctx, raw)
+			done(err, retryCount)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				if firstErr == nil {
+					firstErr = err
+				}
+			case written:
+				report.Written++
+			default:
+				report.Skipped++
+			}
+		}(raw)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// acquire waits until another document may be written, with AdaptiveConcurrency if set, and otherwise
+// with slots; done is to be called when the write is done
+func (m PartitionKeyMigration) acquire(ctx context.Context, slots chan struct{}) (done func(err error, retryCount int), err error) {
+	if m.AdaptiveConcurrency != nil {
+		return m.AdaptiveConcurrency.Acquire(ctx)
+	}
+	slots <- struct{}{}
+	return func(error, int) { <-slots }, nil
+}
+
+// write writes the document to the target, and returns whether it was written (not skipped), and the
+// number of times the client retried the write
+func (m PartitionKeyMigration) write(ctx context.Context, raw json.RawMessage) (written bool, retryCount int, err error) {
+	doc, err := decodeForTarget(raw)
+	if err != nil {
+		return false, 0, err
+	}
+	if m.Transform != nil {
+		if doc, err = m.Transform(doc); err != nil {
+			return false, 0, err
+		} else if doc == nil {
+			return false, 0, nil
+		}
+	}
+	partitionValue, err := targetPartitionValue(m.Target, doc)
+	if err != nil {
+		return false, 0, err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return false, 0, errors.WithStack(err)
+	}
+	opts := cosmosapi.UpsertDocumentOptions{PartitionKeyValue: partitionValue}
+	_, response, err := m.Target.upsertDocument(ctx, data, opts)
+	return err == nil, response.RetryCount, errors.WithStack(err)
+}
+
+func (m PartitionKeyMigration) pageSize() int {
+	if m.PageSize <= 0 {
+		return 100
+	}
+	return m.PageSize
+}
+
+func (m PartitionKeyMigration) concurrency() int {
+	if m.Concurrency <= 0 {
+		return 10
+	}
+	return m.Concurrency
+}
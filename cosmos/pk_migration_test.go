@@ -0,0 +1,161 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// mockCosmosFeed serves a change feed per partition key range; page i is returned for etag "<range>-<i>"
+// (or no etag for page 0), and has etag "<range>-<i+1>". A range in Splits is split into the ranges
+// given once all its pages have been read.
+type mockCosmosFeed struct {
+	Client
+	Pages  map[string][][]map[string]interface{}
+	Ranges []cosmosapi.PartitionKeyRange
+	Splits map[string][]cosmosapi.PartitionKeyRange
+}
+
+func (mock *mockCosmosFeed) GetPartitionKeyRanges(ctx context.Context,
+	databaseName, collectionName string, options *cosmosapi.GetPartitionKeyRangesOptions) (cosmosapi.GetPartitionKeyRangesResponse, error) {
+	if mock.Ranges == nil {
+		mock.Ranges = []cosmosapi.PartitionKeyRange{{Id: "0"}, {Id: "1"}}
+	}
+	return cosmosapi.GetPartitionKeyRangesResponse{PartitionKeyRanges: mock.Ranges}, nil
+}
+
+func (mock *mockCosmosFeed) ListDocuments(ctx context.Context,
+	databaseName, collectionName string, options *cosmosapi.ListDocumentsOptions, documentList interface{}) (cosmosapi.ListDocumentsResponse, error) {
+	if options.AIM != "Incremental feed" {
+		panic("assertion failed")
+	}
+	page := 0
+	if options.IfNoneMatch != "" {
+		_, err := fmt.Sscanf(options.IfNoneMatch[len(options.PartitionKeyRangeId)+1:], "%d", &page)
+		if err != nil {
+			panic(err)
+		}
+	}
+	pages := mock.Pages[options.PartitionKeyRangeId]
+	if children, ok := mock.Splits[options.PartitionKeyRangeId]; ok && page >= len(pages) {
+		mock.Ranges = append(mock.Ranges, children...)
+		delete(mock.Splits, options.PartitionKeyRangeId)
+		return cosmosapi.ListDocumentsResponse{}, cosmosapi.ErrGone
+	}
+	if page >= len(pages) {
+		// Not modified
+		return cosmosapi.ListDocumentsResponse{}, nil
+	}
+	data, _ := json.Marshal(pages[page])
+	if err := json.Unmarshal(data, documentList); err != nil {
+		return cosmosapi.ListDocumentsResponse{}, err
+	}
+	return cosmosapi.ListDocumentsResponse{Etag: fmt.Sprintf("%s-%d", options.PartitionKeyRangeId, page+1)}, nil
+}
+
+func TestPartitionKeyMigration(t *testing.T) {
+	doc := func(id, userId string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "userId": userId, "tenant": "t-" + userId, "_etag": "etag", "_ts": 1}
+	}
+	source := mockCosmosFeed{Pages: map[string][][]map[string]interface{}{
+		"0": {{doc("a", "1"), doc("b", "1")}, {doc("c", "2")}},
+		"1": {{doc("d", "3"), doc("skip", "3")}},
+	}}
+	target := mockCosmosShadow{Documents: make(map[string]map[string]interface{}), FailIds: map[string]bool{"d": true}}
+	store := &MemoryCheckpointStore{}
+	migration := PartitionKeyMigration{
+		Source:      Collection{Client: &source, DbName: "mydb", Name: "old", PartitionKey: "tenant"},
+		Target:      Collection{Client: &target, DbName: "mydb", Name: "new", PartitionKey: "userId"},
+		Checkpoints: store,
+		Transform: func(doc map[string]interface{}) (map[string]interface{}, error) {
+			if doc["id"] == "skip" {
+				return nil, nil
+			}
+			doc["migrated"] = true
+			return doc, nil
+		},
+	}
+
+	// The first pass fails on range 1, after having checkpointed range 0
+	report, err := migration.Pass(context.Background())
+	require.Error(t, err)
+	require.Equal(t, 3, report.Written)
+	checkpoint, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"0": "0-2"}, checkpoint.Etags)
+
+	// Resuming only reads range 1
+	target.FailIds = nil
+	report, err = migration.Pass(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, MigrationReport{Read: 2, Written: 1, Skipped: 1}, report)
+	require.Len(t, target.Documents, 4)
+	require.Equal(t, map[string]interface{}{"id": "a", "userId": "1", "tenant": "t-1", "migrated": true}, target.Documents["a"])
+
+	// The delta pass copies only the changes since
+	source.Pages["0"] = append(source.Pages["0"], []map[string]interface{}{doc("a", "1")})
+	delete(target.Documents, "a")
+	migration.AdaptiveConcurrency = cosmosapi.NewAdaptiveParallelism(cosmosapi.AdaptiveParallelismConfig{})
+	report, err = migration.Pass(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, MigrationReport{Read: 1, Written: 1}, report)
+	require.Contains(t, target.Documents, "a")
+}
+
+func TestPartitionKeyMigrationSplit(t *testing.T) {
+	doc := func(id string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "userId": id, "tenant": "t"}
+	}
+	// Range 1 is split after its first page has been read; the ranges it is split into continue from there,
+	// so their first page (with the same documents as the parent) is not read
+	source := mockCosmosFeed{
+		Pages: map[string][][]map[string]interface{}{
+			"0": {{doc("a")}},
+			"1": {{doc("b")}},
+			"2": {{doc("b")}, {doc("c")}},
+			"3": {{doc("b")}, {doc("d")}},
+		},
+		Splits: map[string][]cosmosapi.PartitionKeyRange{
+			"1": {{Id: "2", Parents: []string{"1"}}, {Id: "3", Parents: []string{"1"}}},
+		},
+	}
+	target := mockCosmosShadow{Documents: make(map[string]map[string]interface{})}
+	store := &MemoryCheckpointStore{}
+	migration := PartitionKeyMigration{
+		Source:      Collection{Client: &source, DbName: "mydb", Name: "old", PartitionKey: "tenant"},
+		Target:      Collection{Client: &target, DbName: "mydb", Name: "new", PartitionKey: "userId"},
+		Checkpoints: store,
+	}
+	report, err := migration.Pass(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Read)
+	require.Len(t, target.Documents, 4)
+	checkpoint, err := store.Load()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"0": "0-1", "2": "2-2", "3": "3-2"}, checkpoint.Etags)
+
+	// The next pass only reads the ranges that have not been split
+	report, err = migration.Pass(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, MigrationReport{}, report)
+}
+
+func TestFileCheckpointStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := FileCheckpointStore{Path: dir + "/checkpoint.json"}
+	checkpoint, err := store.Load()
+	require.NoError(t, err)
+	require.Empty(t, checkpoint.Etags)
+	require.NoError(t, store.Save(MigrationCheckpoint{Etags: map[string]string{"0": "etag"}}))
+	checkpoint, err = store.Load()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"0": "etag"}, checkpoint.Etags)
+}
@@ -0,0 +1,94 @@
+package cosmos
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// 'modelTypes' is indexed by the model name given in cosmosmodel:"..."
+var modelTypes = make(map[string]reflect.Type)
+
+// RegisterModel registers the type of prototype (a pointer to a model struct) under its model name, so that
+// QueryModels and VisitModels can hydrate documents of that model. Like AddMigration, it is meant to be
+// called at package initialization:
+//
+//	var _ = cosmos.RegisterModel(&User{})
+func RegisterModel(prototype Model) (dummyResult struct{}) {
+	modelName, _ := lookupModelField(prototype)
+	checkModelName(modelName)
+	if _, ok := modelTypes[modelName]; ok {
+		panic(errors.Errorf("Model %s registered several times", modelName))
+	}
+	modelTypes[modelName] = reflect.TypeOf(prototype).Elem()
+	return
+}
+
+// VisitModels runs a query over a collection storing several models, e.g. all the entities of one partition,
+// and calls visit with each result hydrated into the registered type given by its "model" property (see
+// RegisterModel); visit can then use a type switch on the entity. The results are processed page by page,
+// and the query stops at the first error returned by visit. As with Query, no hooks are called on the
+// entities. Documents of a model that is not registered are converted with the migrations added with
+// AddMigration; if there are none leading to a registered model, it is an error.
+func (c Collection) VisitModels(query string, visit func(entity Model) error, params ...cosmosapi.QueryParam) error {
+	return c.visitModels(cosmosapi.Query{Query: query, Params: params}, cosmosapi.DefaultQueryDocumentOptions(), visit)
+}
+
+func (c Collection) visitModels(qry cosmosapi.Query, ops cosmosapi.QueryDocumentsOptions, visit func(entity Model) error) error {
+	for {
+		var page []json.RawMessage
+		var response cosmosapi.QueryDocumentsResponse
+		err := c.intercept(Operation{Kind: OperationQuery, Query: qry.Query}, func() (err error) {
+			response, err = c.queryPage(c.GetContext(), qry, &page, ops)
+			return err
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, doc := range page {
+			entity, err := hydrateModel(doc)
+			if err != nil {
+				return err
+			}
+			if err := visit(entity); err != nil {
+				return err
+			}
+		}
+		if !response.HasMore() {
+			return nil
+		}
+		ops.Continuation = response.Continuation
+	}
+}
+
+// QueryModels is like VisitModels, but returns all the results. Each is a pointer to the registered type
+// of its model.
+func (c Collection) QueryModels(query string, params ...cosmosapi.QueryParam) ([]Model, error) {
+	var entities []Model
+	err := c.VisitModels(query, func(entity Model) error {
+		entities = append(entities, entity)
+		return nil
+	}, params...)
+	return entities, err
+}
+
+func hydrateModel(doc json.RawMessage) (Model, error) {
+	var header struct {
+		Id    string `json:"id"`
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(doc, &header); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t, ok := modelTypes[header.Model]
+	if !ok {
+		return migrateModel(header.Id, header.Model, doc)
+	}
+	entity := reflect.New(t).Interface().(Model)
+	if err := json.Unmarshal(doc, entity); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return entity, nil
+}
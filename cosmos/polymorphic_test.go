@@ -0,0 +1,53 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ = RegisterModel(&MyModel{})
+var _ = RegisterModel(&patchModel{})
+
+// patchModelV0 is an old version of patchModel, which is migrated when queried
+type patchModelV0 struct {
+	BaseModel
+	Model  string `json:"model" cosmosmodel:"PatchModel/0"`
+	UserId string `json:"userId"`
+	Count  int    `json:"count"`
+}
+
+func (e *patchModelV0) PrePut(txn *Transaction) error  { return nil }
+func (e *patchModelV0) PostGet(txn *Transaction) error { return nil }
+
+var _ = AddMigration(&patchModelV0{}, &patchModel{}, func(from, to interface{}) error {
+	v0, v1 := from.(patchModelV0), to.(*patchModel)
+	v1.BaseModel, v1.UserId, v1.X = v0.BaseModel, v0.UserId, v0.Count
+	return nil
+})
+
+func TestQueryModels(t *testing.T) {
+	mock := mockCosmosQuery{Pages: []string{
+		`[{"id": "a", "model": "MyModel/1", "userId": "u", "x": 1}]`,
+		`[{"id": "b", "model": "PatchModel/1", "userId": "u", "x": 2}]`,
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	entities, err := c.QueryModels("SELECT * FROM c WHERE c.userId = 'u'")
+	require.NoError(t, err)
+	require.Len(t, entities, 2)
+	require.Equal(t, 1, entities[0].(*MyModel).X)
+	require.Equal(t, 2, entities[1].(*patchModel).X)
+
+	// Documents of an old model are migrated
+	mock = mockCosmosQuery{Pages: []string{`[{"id": "d", "model": "PatchModel/0", "userId": "u", "count": 3}]`}}
+	entities, err = c.QueryModels("SELECT * FROM c")
+	require.NoError(t, err)
+	require.Equal(t, &patchModel{BaseModel: BaseModel{Id: "d"}, Model: "PatchModel/1", UserId: "u", X: 3}, entities[0])
+
+	mock = mockCosmosQuery{Pages: []string{`[{"id": "c", "model": "Other/1"}]`}}
+	_, err = c.QueryModels("SELECT * FROM c")
+	require.Error(t, err)
+
+	require.Panics(t, func() { RegisterModel(&MyModel{}) })
+}
@@ -0,0 +1,133 @@
+package cosmos
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+var baseModelType = reflect.TypeOf(BaseModel{})
+
+// QueryProjection runs a query selecting a subset of the document properties, such as
+//
+//	SELECT c.id, c.x FROM c WHERE c.userId = @userId
+//
+// and hydrates the result into projections, which should be a pointer to a slice of small dedicated
+// structs (not models). Since these are not full documents, no model checks are done and no post-get
+// hooks are called; this makes it suitable for list views that do not need the full documents. All pages
+// of the result are fetched; the returned response has the request charge summed over all of them.
+func (c Collection) QueryProjection(query string, projections interface{}, params ...cosmosapi.QueryParam) (cosmosapi.QueryDocumentsResponse, error) {
+	if err := checkProjectionType(projections); err != nil {
+		return cosmosapi.QueryDocumentsResponse{}, err
+	}
+	return c.queryAllPages(cosmosapi.Query{Query: query, Params: params}, projections)
+}
+
+// QueryProjectionForWrite is like QueryProjection, but for projections that will be used to locate the
+// documents in order to write them, e.g. with Transaction.Get(ProjectionKey(...)). In addition to the
+// checks done by QueryProjection, it is verified that the projection struct has fields for "id" and the
+// partition key, and that the query populated both for every result. This catches a projection that
+// silently drops the partition key, which would otherwise surface as documents not being found.
+func (c Collection) QueryProjectionForWrite(query string, projections interface{}, params ...cosmosapi.QueryParam) (cosmosapi.QueryDocumentsResponse, error) {
+	if err := checkProjectionType(projections); err != nil {
+		return cosmosapi.QueryDocumentsResponse{}, err
+	}
+	elemType := reflect.TypeOf(projections).Elem().Elem()
+	for _, name := range []string{"id", c.PartitionKey} {
+		if _, ok := projectionField(elemType, name); !ok {
+			return cosmosapi.QueryDocumentsResponse{}, errors.Errorf(
+				"Projection %s has no field with tag 'json:\"%s\"', which is required to write the documents", elemType, name)
+		}
+	}
+	response, err := c.queryAllPages(cosmosapi.Query{Query: query, Params: params}, projections)
+	if err != nil {
+		return response, err
+	}
+	slice := reflect.ValueOf(projections).Elem()
+	for i := 0; i != slice.Len(); i++ {
+		partitionValue, id := c.ProjectionKey(slice.Index(i).Addr().Interface())
+		if id == "" || partitionValue == nil || partitionValue == "" {
+			return response, errors.Errorf(
+				"Result %d of projection query is missing 'id' or '%s'; make sure both are selected: %s", i, c.PartitionKey, query)
+		}
+	}
+	return response, nil
+}
+
+// ProjectionKey returns the partition value and id of a projection returned by QueryProjectionForWrite.
+// projection should be a pointer to the projection struct. For numeric or boolean partition keys, use a
+// pointer field in the projection, so that a partition key missing from the results can be told apart from
+// zero or false.
+func (c Collection) ProjectionKey(projection interface{}) (partitionValue interface{}, id string) {
+	v := reflect.Indirect(reflect.ValueOf(projection))
+	if f, ok := projectionField(v.Type(), "id"); ok {
+		id, _ = v.FieldByIndex(f.Index).Interface().(string)
+	}
+	if f, ok := projectionField(v.Type(), c.PartitionKey); ok {
+		if field := v.FieldByIndex(f.Index); field.Kind() != reflect.Ptr || !field.IsNil() {
+			partitionValue = reflect.Indirect(field).Interface()
+		}
+	}
+	return
+}
+
+func checkProjectionType(projections interface{}) error {
+	t := reflect.TypeOf(projections)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice || t.Elem().Elem().Kind() != reflect.Struct {
+		return errors.Errorf("Projections must be a pointer to a slice of structs, got %v", t)
+	}
+	if _, isModel := t.Elem().Elem().FieldByName("BaseModel"); isModel {
+		return errors.Errorf("%s is a model; use Query() for full documents, or a dedicated struct for projections", t.Elem().Elem())
+	}
+	return nil
+}
+
+// projectionField finds the struct field that is serialized to the given JSON property
+func projectionField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i != t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type == baseModelType {
+			continue
+		}
+		tagName := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tagName == name || (tagName == "" && strings.EqualFold(f.Name, name)) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// queryAllPages runs the query, following continuation tokens, appending all results to the slice
+// pointed to by docs
+func (c Collection) queryAllPages(query cosmosapi.Query, docs interface{}) (response cosmosapi.QueryDocumentsResponse, err error) {
+	err = c.intercept(Operation{Kind: OperationQuery, Query: query.Query}, func() error {
+		response, err = c.fetchAllPages(query, docs)
+		return err
+	})
+	return
+}
+
+func (c Collection) fetchAllPages(query cosmosapi.Query, docs interface{}) (cosmosapi.QueryDocumentsResponse, error) {
+	slice := reflect.ValueOf(docs).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	var requestCharge float64
+	ops := cosmosapi.DefaultQueryDocumentOptions()
+	for {
+		page := reflect.New(slice.Type())
+		response, err := c.queryPage(c.GetContext(), query, page.Interface(), ops)
+		requestCharge += response.RequestCharge
+		if err != nil {
+			return response, errors.WithStack(err)
+		}
+		slice.Set(reflect.AppendSlice(slice, page.Elem()))
+		if !response.HasMore() {
+			response.RequestCharge = requestCharge
+			response.Documents = docs
+			response.Count = slice.Len()
+			return response, nil
+		}
+		ops.Continuation = response.Continuation
+	}
+}
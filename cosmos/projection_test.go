@@ -0,0 +1,74 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosQuery struct {
+	Client
+	Pages      []string
+	GotQueries []cosmosapi.Query
+}
+
+func (mock *mockCosmosQuery) QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	mock.GotQueries = append(mock.GotQueries, qry)
+	page := len(mock.GotQueries) - 1
+	response := cosmosapi.QueryDocumentsResponse{ResponseBase: cosmosapi.ResponseBase{RequestCharge: 1}}
+	if page+1 < len(mock.Pages) {
+		response.Continuation = "more"
+	}
+	return response, json.Unmarshal([]byte(mock.Pages[page]), docs)
+}
+
+type myModelListItem struct {
+	Id     string `json:"id"`
+	UserId string `json:"userId"`
+	X      int    `json:"x"`
+}
+
+func TestQueryProjection(t *testing.T) {
+	mock := mockCosmosQuery{Pages: []string{
+		`[{"id": "a", "userId": "u", "x": 1}]`,
+		`[{"id": "b", "userId": "u", "x": 2}]`,
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var items []myModelListItem
+	response, err := c.QueryProjectionForWrite("SELECT c.id, c.userId, c.x FROM c WHERE c.userId = @userId", &items,
+		cosmosapi.QueryParam{Name: "@userId", Value: "u"})
+	require.NoError(t, err)
+	require.Equal(t, []myModelListItem{{"a", "u", 1}, {"b", "u", 2}}, items)
+	require.Equal(t, 2.0, response.RequestCharge)
+	require.Equal(t, 2, len(mock.GotQueries))
+	require.Equal(t, "@userId", mock.GotQueries[0].Params[0].Name)
+
+	partitionValue, id := c.ProjectionKey(&items[1])
+	require.Equal(t, "u", partitionValue)
+	require.Equal(t, "b", id)
+
+	// The partition key was not selected
+	mock = mockCosmosQuery{Pages: []string{`[{"id": "a", "x": 1}]`}}
+	_, err = c.QueryProjectionForWrite("SELECT c.id, c.x FROM c", &items)
+	require.Error(t, err)
+	mock.GotQueries = nil
+	_, err = c.QueryProjection("SELECT c.id, c.x FROM c", &items)
+	require.NoError(t, err)
+	require.Equal(t, []myModelListItem{{Id: "a", X: 1}}, items)
+
+	// The projection struct cannot hold the partition key
+	var xs []struct {
+		Id string `json:"id"`
+	}
+	_, err = c.QueryProjectionForWrite("SELECT c.id FROM c", &xs)
+	require.Error(t, err)
+
+	// Models should not be used for projections
+	var models []MyModel
+	_, err = c.QueryProjection("SELECT * FROM c", &models)
+	require.Error(t, err)
+}
@@ -0,0 +1,117 @@
+package cosmos
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// PutIfNewer writes the entity unless the stored document has the same or a higher logical version, given
+// by the property versionField (e.g. "version" or "eventTime"), which must be a number, a string (compared
+// lexically, e.g. RFC 3339 timestamps in UTC) or a time.Time. This makes it safe to apply events that may
+// arrive out of order or more than once: an older event never overwrites the result of a newer one.
+//
+// It is implemented as a read followed by a write conditional on the etag of what was read, retried
+// (up to DefaultConflictRetries times) if the document is changed in between. written is false if the
+// stored document was as new as the entity; the entity is then left unchanged. On success, the etag of the
+// entity is updated.
+func (c Collection) PutIfNewer(entityPtr Model, versionField string) (written bool, err error) {
+	basePtr, partitionValue, err := c.getEntityInfo(entityPtr)
+	if err != nil {
+		return false, err
+	}
+	version, err := versionOf(entityPtr, versionField)
+	if err != nil {
+		return false, err
+	}
+	id := basePtr.Id
+	for i := 0; i != DefaultConflictRetries; i++ {
+		stored := reflect.New(reflect.TypeOf(entityPtr).Elem()).Interface().(Model)
+		if _, err = c.get(c.GetContext(), partitionValue, id, stored, "", ""); err != nil {
+			return false, err
+		}
+		storedBase, _, _ := c.getEntityInfo(stored)
+		if !storedBase.IsNew() {
+			storedVersion, err := versionOf(stored, versionField)
+			if err != nil {
+				return false, err
+			}
+			newer, err := isNewerVersion(version, storedVersion)
+			if err != nil {
+				return false, errors.WithMessage(err, fmt.Sprintf("id='%s' partitionValue='%v'", id, partitionValue))
+			}
+			if !newer {
+				return false, nil
+			}
+		}
+
+		base := *basePtr
+		base.Etag = storedBase.Etag
+		err = c.intercept(Operation{Kind: OperationPut, PartitionKey: partitionValue, Id: id, Entity: entityPtr}, func() error {
+			if err := c.prePut(entityPtr, nil); err != nil {
+				return err
+			}
+			resource, _, err := c.put(c.GetContext(), entityPtr, base, partitionValue, MatchCurrent)
+			if err != nil {
+				return err
+			}
+			*basePtr = BaseModel(*resource)
+			c.entityCacheWritten(partitionValue, id, entityPtr)
+			return nil
+		})
+		if errors.Cause(err) != cosmosapi.ErrPreconditionFailed {
+			return err == nil, err
+		}
+	}
+	return false, errors.WithStack(ContentionError)
+}
+
+// PutIfNewerContext is like PutIfNewer, but does the requests with ctx
+func (c Collection) PutIfNewerContext(ctx context.Context, entityPtr Model, versionField string) (bool, error) {
+	return c.WithContext(ctx).PutIfNewer(entityPtr, versionField)
+}
+
+// versionOf returns the value of the given JSON property of the entity
+func versionOf(entityPtr Model, versionField string) (interface{}, error) {
+	v := reflect.ValueOf(entityPtr).Elem()
+	index, _, ok := jsonField(v.Type(), versionField)
+	if !ok {
+		return nil, errors.Errorf("%T has no field with tag 'json:\"%s\"'", entityPtr, versionField)
+	}
+	field := v.FieldByIndex(index)
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return nil, nil
+		}
+		field = field.Elem()
+	}
+	return field.Interface(), nil
+}
+
+// isNewerVersion returns true if version is higher than stored. A missing (nil) stored version is older
+// than any version.
+func isNewerVersion(version, stored interface{}) (bool, error) {
+	if stored == nil {
+		return true, nil
+	} else if version == nil {
+		return false, nil
+	}
+	v, s := reflect.ValueOf(version), reflect.ValueOf(stored)
+	switch {
+	case v.Type() == reflect.TypeOf(time.Time{}):
+		return version.(time.Time).After(stored.(time.Time)), nil
+	case v.Kind() == reflect.String:
+		return v.String() > s.String(), nil
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		return v.Int() > s.Int(), nil
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		return v.Uint() > s.Uint(), nil
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return v.Float() > s.Float(), nil
+	}
+	return false, errors.Errorf("Can not compare versions of type %T", version)
+}
@@ -0,0 +1,79 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type versionedModel struct {
+	BaseModel
+	UserId  string `json:"userId"`
+	Version int    `json:"version"`
+	Data    string `json:"data"`
+}
+
+func (e *versionedModel) PrePut(txn *Transaction) error  { return nil }
+func (e *versionedModel) PostGet(txn *Transaction) error { return nil }
+
+func (mock *mockCosmosJSON) ReplaceDocument(ctx context.Context,
+	dbName, colName, id string, doc interface{}, ops cosmosapi.ReplaceDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	var existing cosmosapi.Resource
+	_ = json.Unmarshal(mock.Documents[id], &existing)
+	if existing.Etag != ops.IfMatch {
+		return nil, cosmosapi.DocumentResponse{}, cosmosapi.ErrPreconditionFailed
+	}
+	var m map[string]interface{}
+	data, _ := json.Marshal(doc)
+	_ = json.Unmarshal(data, &m)
+	etag := fmt.Sprintf("%s+", existing.Etag)
+	m["_etag"] = etag
+	mock.Documents[id], _ = json.Marshal(m)
+	return &cosmosapi.Resource{Id: id, Etag: etag}, cosmosapi.DocumentResponse{}, nil
+}
+
+func TestPutIfNewer(t *testing.T) {
+	mock := mockCosmosJSON{Documents: make(map[string][]byte)}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	event := func(version int, data string) *versionedModel {
+		return &versionedModel{BaseModel: BaseModel{Id: "id"}, UserId: "u", Version: version, Data: data}
+	}
+	stored := func() versionedModel {
+		var entity versionedModel
+		require.NoError(t, json.Unmarshal(mock.Documents["id"], &entity))
+		return entity
+	}
+
+	written, err := c.PutIfNewer(event(2, "second"), "version")
+	require.NoError(t, err)
+	assert.True(t, written)
+
+	// Older and repeated events are ignored
+	written, err = c.PutIfNewer(event(1, "first"), "version")
+	require.NoError(t, err)
+	assert.False(t, written)
+	written, err = c.PutIfNewer(event(2, "second again"), "version")
+	require.NoError(t, err)
+	assert.False(t, written)
+	assert.Equal(t, "second", stored().Data)
+
+	e := event(3, "third")
+	written, err = c.PutIfNewer(e, "version")
+	require.NoError(t, err)
+	assert.True(t, written)
+	assert.Equal(t, "third", stored().Data)
+	assert.Equal(t, stored().Etag, e.Etag)
+
+	_, err = c.PutIfNewer(event(4, ""), "missing")
+	assert.Error(t, err)
+	_, err = c.PutIfNewer(event(4, ""), "data")
+	require.NoError(t, err)
+	_, err = c.ReadOnly().PutIfNewer(event(5, ""), "version")
+	assert.Equal(t, cosmosapi.ErrReadOnly, errors.Cause(err))
+}
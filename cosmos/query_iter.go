@@ -0,0 +1,78 @@
+//go:build go1.23
+
+package cosmos
+
+import (
+	"context"
+	"iter"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// QueryAll runs the query and returns its results as an iterator, fetching further pages as the loop
+// proceeds:
+//
+//	for user, err := range cosmos.QueryAll[User](ctx, c, cosmosapi.Query{Query: "SELECT * FROM c"}) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// If a page cannot be fetched, the error is yielded (with the zero value of T) and the iteration stops.
+// Breaking out of the loop stops the fetching of pages. As with Query, no hooks are called on the items, but
+// they are passed through the document adapter and field aliases of the collection.
+// Only available when built with Go 1.23 or later; see QueryChan for older versions.
+func QueryAll[T any](ctx context.Context, c Collection, query cosmosapi.Query) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		pager := c.newQueryPager(ctx, query)
+		for {
+			var page []T
+			ok, err := pager.next(&page)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			if !ok {
+				return
+			}
+			for _, item := range page {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ListAll returns all documents of the collection as an iterator, reading them page by page with
+// ListDocuments; errors and stopping are as for QueryAll.
+func ListAll[T any](ctx context.Context, c Collection) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var ops cosmosapi.ListDocumentsOptions
+		for {
+			var page []T
+			var response cosmosapi.ListDocumentsResponse
+			err := ctx.Err()
+			if err == nil {
+				response, err = c.readListPage(ctx, &page, ops)
+			}
+			if err != nil {
+				var zero T
+				yield(zero, errors.WithStack(err))
+				return
+			}
+			for _, item := range page {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if !response.HasMore() {
+				return
+			}
+			ops.Continuation = response.Continuation
+		}
+	}
+}
@@ -0,0 +1,102 @@
+//go:build go1.23
+
+package cosmos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestQueryAll(t *testing.T) {
+	mock := mockCosmosQuery{Pages: []string{
+		`[{"id": "a", "userId": "u", "x": 1}, {"id": "b", "userId": "u", "x": 2}]`,
+		`[{"id": "c", "userId": "u", "x": 3}]`,
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var ids []string
+	for item, err := range QueryAll[myModelListItem](context.Background(), c, cosmosapi.Query{Query: "SELECT * FROM c"}) {
+		require.NoError(t, err)
+		ids = append(ids, item.Id)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, ids)
+	require.Equal(t, 2, len(mock.GotQueries))
+
+	// Breaking out of the loop stops fetching
+	mock.GotQueries = nil
+	for range QueryAll[myModelListItem](context.Background(), c, cosmosapi.Query{Query: "SELECT * FROM c"}) {
+		break
+	}
+	require.Equal(t, 1, len(mock.GotQueries))
+
+	// Cancelled context
+	mock.GotQueries = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var errs []error
+	for _, err := range QueryAll[myModelListItem](ctx, c, cosmosapi.Query{Query: "SELECT * FROM c"}) {
+		errs = append(errs, err)
+	}
+	require.Equal(t, 1, len(errs))
+	require.Equal(t, context.Canceled, errors.Cause(errs[0]))
+	require.Equal(t, 0, len(mock.GotQueries))
+}
+
+func TestListAllIntercepted(t *testing.T) {
+	c := Collection{Client: &mockCosmosQuery{}, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	c = c.WithAccessControl(func(op Operation, entity Model, principal interface{}) bool {
+		return op.Kind != OperationList
+	})
+	var errs []error
+	for _, err := range ListAll[myModelListItem](context.Background(), c) {
+		errs = append(errs, err)
+	}
+	require.Equal(t, 1, len(errs))
+	require.Equal(t, AccessDeniedError, errors.Cause(errs[0]))
+}
+
+type mockCosmosList struct {
+	Client
+	Page string
+}
+
+func (mock *mockCosmosList) ListDocuments(ctx context.Context, dbName, colName string, ops *cosmosapi.ListDocumentsOptions, docs interface{}) (cosmosapi.ListDocumentsResponse, error) {
+	return cosmosapi.ListDocumentsResponse{}, json.Unmarshal([]byte(mock.Page), docs)
+}
+
+type myModelAliasedListItem struct {
+	Id string `json:"id"`
+	X  int    `json:"x" cosmosalias:"legacyX"`
+}
+
+func TestQueryAllAndListAllAdapted(t *testing.T) {
+	adapter := func(doc json.RawMessage) (json.RawMessage, error) {
+		return bytes.Replace(doc, []byte(`"y"`), []byte(`"x"`), 1), nil
+	}
+
+	// Documents are passed through the adapter
+	query := mockCosmosQuery{Pages: []string{`[{"id": "a", "userId": "u", "y": 1}]`}}
+	c := Collection{Client: &query, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithDocumentAdapter(adapter)
+	var xs []int
+	for item, err := range QueryAll[myModelListItem](context.Background(), c, cosmosapi.Query{Query: "SELECT * FROM c"}) {
+		require.NoError(t, err)
+		xs = append(xs, item.X)
+	}
+	require.Equal(t, []int{1}, xs)
+
+	// And field aliases are applied after it
+	list := mockCosmosList{Page: `[{"id": "a", "y": 1}, {"id": "b", "legacyX": 2}]`}
+	c.Client = &list
+	xs = nil
+	for item, err := range ListAll[myModelAliasedListItem](context.Background(), c) {
+		require.NoError(t, err)
+		xs = append(xs, item.X)
+	}
+	require.Equal(t, []int{1, 2}, xs)
+}
@@ -0,0 +1,14 @@
+package cosmos
+
+import (
+	"context"
+	"io"
+
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// QueryNDJSON runs the query and writes the results to w as newline-delimited JSON, one document per line,
+// page by page. It is Export with NewNDJSONEncoder; see Export about memory use, backpressure and errors.
+func (c Collection) QueryNDJSON(ctx context.Context, query cosmosapi.Query, w io.Writer) (count int, err error) {
+	return c.Export(ctx, query, NewNDJSONEncoder(w))
+}
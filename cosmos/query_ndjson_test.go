@@ -0,0 +1,42 @@
+package cosmos
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestQueryNDJSON(t *testing.T) {
+	mock := mockCosmosQuery{Pages: []string{
+		`[{"id": "a", "userId": "u", "x": 1},
+		  {"id": "b", "userId": "u", "x": 2}]`,
+		`[{"id": "c", "userId": "u", "x": 3}]`,
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	recorder := httptest.NewRecorder()
+	count, err := c.QueryNDJSON(context.Background(), cosmosapi.Query{Query: "SELECT * FROM c"}, recorder)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+	require.Equal(t, `{"id":"a","userId":"u","x":1}
+{"id":"b","userId":"u","x":2}
+{"id":"c","userId":"u","x":3}
+`, recorder.Body.String())
+	require.True(t, recorder.Flushed)
+	require.Equal(t, 2, len(mock.GotQueries))
+
+	// Cancelled context
+	mock.GotQueries = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	count, err = c.QueryNDJSON(ctx, cosmosapi.Query{Query: "SELECT * FROM c"}, &buf)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	require.Equal(t, 0, count)
+	require.Equal(t, 0, len(mock.GotQueries))
+}
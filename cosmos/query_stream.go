@@ -0,0 +1,114 @@
+package cosmos
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// The number of items QueryChan buffers ahead of the consumer; this is also roughly what is needed to
+// keep the next page being fetched while the consumer processes the current one.
+const queryChanBuffer = 100
+
+// QueryChan runs the query and streams the results, page by page, so that consumers can process the items
+// concurrently with further pages being fetched; e.g. for large exports. itemType is a value of the type
+// of the items (e.g. MyModel{}); each item is sent on the channel as a pointer to a new value of that
+// type (*MyModel). As with Query, no hooks are called on the items.
+//
+// The item channel is closed when all results have been sent, or when an error occurs. After that, the
+// error channel receives at most one error, and is then closed. If ctx is cancelled, the query stops and
+// ctx.Err() is returned on the error channel; so cancel ctx if you stop consuming before the end.
+func (c Collection) QueryChan(ctx context.Context, query cosmosapi.Query, itemType interface{}) (<-chan interface{}, <-chan error) {
+	items := make(chan interface{}, queryChanBuffer)
+	errs := make(chan error, 1)
+	sliceType := reflect.SliceOf(reflect.TypeOf(itemType))
+
+	go func() {
+		defer close(errs)
+		defer close(items)
+		pager := c.newQueryPager(ctx, query)
+		for {
+			page := reflect.New(sliceType)
+			ok, err := pager.next(page.Interface())
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !ok {
+				return
+			}
+			for i := 0; i != page.Elem().Len(); i++ {
+				select {
+				case items <- page.Elem().Index(i).Addr().Interface():
+				case <-ctx.Done():
+					errs <- errors.WithStack(ctx.Err())
+					return
+				}
+			}
+		}
+	}()
+	return items, errs
+}
+
+// queryPager reads the pages of a query one at a time; it is the iterator shared by the queries reading
+// results page by page, such as QueryAll, QueryChan and Export
+type queryPager struct {
+	c     Collection
+	ctx   context.Context
+	query cosmosapi.Query
+	ops   cosmosapi.QueryDocumentsOptions
+	done  bool
+}
+
+func (c Collection) newQueryPager(ctx context.Context, query cosmosapi.Query) *queryPager {
+	ops := cosmosapi.DefaultQueryDocumentOptions()
+	ops.Continuation = query.Token
+	return &queryPager{c: c, ctx: ctx, query: query, ops: ops}
+}
+
+// next reads the next page into out, a pointer to a slice, with readQueryPage. It returns false when all
+// pages have been read. If ctx is cancelled, ctx.Err() is returned.
+func (p *queryPager) next(out interface{}) (bool, error) {
+	if p.done {
+		return false, nil
+	}
+	if err := p.ctx.Err(); err != nil {
+		return false, errors.WithStack(err)
+	}
+	response, err := p.c.readQueryPage(p.ctx, p.query, out, p.ops)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	p.done = !response.HasMore()
+	p.ops.Continuation = response.Continuation
+	return true, nil
+}
+
+// readQueryPage reads a page of the query into out, a pointer to a slice, through the interceptors and the
+// document adapter of the collection; it is shared by the queries reading results page by page
+func (c Collection) readQueryPage(ctx context.Context, query cosmosapi.Query, out interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	var response cosmosapi.QueryDocumentsResponse
+	err := c.intercept(Operation{Kind: OperationQuery, Query: query.Query, Context: ctx}, func() (err error) {
+		adapted, unmarshal := c.adaptedQueryOut(out)
+		if response, err = c.queryPage(ctx, query, adapted, ops); err != nil {
+			return err
+		}
+		return unmarshal()
+	})
+	return response, err
+}
+
+// readListPage is like readQueryPage, but reads a page of all the documents of the collection
+func (c Collection) readListPage(ctx context.Context, out interface{}, ops cosmosapi.ListDocumentsOptions) (cosmosapi.ListDocumentsResponse, error) {
+	var response cosmosapi.ListDocumentsResponse
+	err := c.intercept(Operation{Kind: OperationList, Context: ctx}, func() (err error) {
+		adapted, unmarshal := c.adaptedQueryOut(out)
+		if response, err = c.Client.ListDocuments(ctx, c.DbName, c.Name, &ops, adapted); err != nil {
+			return err
+		}
+		return unmarshal()
+	})
+	return response, err
+}
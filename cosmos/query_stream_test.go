@@ -0,0 +1,38 @@
+package cosmos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestQueryChan(t *testing.T) {
+	mock := mockCosmosQuery{Pages: []string{
+		`[{"id": "a", "userId": "u", "x": 1}, {"id": "b", "userId": "u", "x": 2}]`,
+		`[{"id": "c", "userId": "u", "x": 3}]`,
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	items, errs := c.QueryChan(context.Background(), cosmosapi.Query{Query: "SELECT * FROM c"}, myModelListItem{})
+	var ids []string
+	for item := range items {
+		ids = append(ids, item.(*myModelListItem).Id)
+	}
+	require.NoError(t, <-errs)
+	require.Equal(t, []string{"a", "b", "c"}, ids)
+	require.Equal(t, 2, len(mock.GotQueries))
+
+	// Cancelled context
+	mock.GotQueries = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	items, errs = c.QueryChan(ctx, cosmosapi.Query{Query: "SELECT * FROM c"}, myModelListItem{})
+	for range items {
+		t.Fatal("no items expected")
+	}
+	require.Equal(t, context.Canceled, errors.Cause(<-errs))
+	require.Equal(t, 0, len(mock.GotQueries))
+}
@@ -0,0 +1,19 @@
+package cosmos
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// ReadOnly returns a Collection that rejects all writes (Put, Patch, Delete and transaction commits, also through
+// sessions created from it) with an error with cause cosmosapi.ErrReadOnly. Reads and queries work as
+// normal. To also cover operations such as stored procedures, set cosmosapi.Config.ReadOnly on the client.
+func (c Collection) ReadOnly() Collection {
+	return c.WithInterceptor(func(op Operation, next func() error) error {
+		switch op.Kind {
+		case OperationPut, OperationPatch, OperationDelete:
+			return errors.Wrapf(cosmosapi.ErrReadOnly, "%s id='%s' partitionValue='%v'", op.Kind, op.Id, op.PartitionKey)
+		}
+		return next()
+	})
+}
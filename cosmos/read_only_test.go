@@ -0,0 +1,28 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestReadOnly(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "partitionvalue"}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.ReadOnly()
+
+	var entity MyModel
+	require.NoError(t, c.StaleGet("partitionvalue", "idvalue", &entity))
+	require.Equal(t, "get", mock.GotMethod)
+
+	mock.GotMethod = ""
+	require.Equal(t, cosmosapi.ErrReadOnly, errors.Cause(c.RacingPut(&entity)))
+	err := c.Session().Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Put(&entity)
+		return nil
+	})
+	require.Equal(t, cosmosapi.ErrReadOnly, errors.Cause(err))
+	require.Equal(t, "get", mock.GotMethod)
+}
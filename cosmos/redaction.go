@@ -0,0 +1,105 @@
+package cosmos
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var RedactedWriteError = errors.New("Can not write in a transaction where the entity read was redacted")
+
+// Fields of entities can be marked as sensitive with a `cosmosredact:"..."` tag naming a class of data:
+//
+//	type User struct {
+//		cosmos.BaseModel
+//		UserId string `json:"userId"`
+//		Email  string `json:"email" cosmosredact:"pii"`
+//		Salary int    `json:"salary" cosmosredact:"hr"`
+//	}
+//
+// A collection with WithRedaction zeroes these fields in the entities read by callers that may not read the
+// class, as decided by a RedactionPolicy for the principal of the context (see WithPrincipal), so that
+// sensitive fields are stripped without a separate DTO per role. Redaction is honored in embedded and nested
+// structs, but not through pointers, slices or maps.
+
+// RedactionPolicy returns whether principal (nil if none is set on the context) may read fields of class
+type RedactionPolicy func(principal interface{}, class string) bool
+
+// redactedField is the index path of a field with a cosmosredact tag
+type redactedField struct {
+	index []int
+	class string
+}
+
+// redactedFieldsByType caches the redacted fields per type
+var redactedFieldsByType sync.Map
+
+func redactedFieldsOf(t reflect.Type) []redactedField {
+	if cached, ok := redactedFieldsByType.Load(t); ok {
+		return cached.([]redactedField)
+	}
+	fields := newRedactedFields(t, nil, map[reflect.Type]bool{})
+	redactedFieldsByType.Store(t, fields)
+	return fields
+}
+
+func newRedactedFields(t reflect.Type, prefix []int, visiting map[reflect.Type]bool) (result []redactedField) {
+	if t.Kind() != reflect.Struct || visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// Unexported
+			continue
+		}
+		index := append(append([]int(nil), prefix...), i)
+		if class := field.Tag.Get("cosmosredact"); class != "" {
+			result = append(result, redactedField{index: index, class: class})
+		} else {
+			result = append(result, newRedactedFields(field.Type, index, visiting)...)
+		}
+	}
+	return result
+}
+
+// Redact zeroes the fields of the entity, a pointer to a struct, that principal may not read according to
+// policy, and returns whether there were any. It is done by WithRedaction on reads, and can be used on e.g.
+// query results.
+func Redact(entityPtr interface{}, principal interface{}, policy RedactionPolicy) (redacted bool) {
+	v := reflect.ValueOf(entityPtr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	v = v.Elem()
+	for _, field := range redactedFieldsOf(v.Type()) {
+		if !policy(principal, field.class) {
+			f := v.FieldByIndex(field.index)
+			f.Set(reflect.Zero(f.Type()))
+			redacted = true
+		}
+	}
+	return redacted
+}
+
+// WithRedaction returns a Collection where the entities read, also through sessions and transactions created
+// from it, are redacted with policy after PostGet, for the principal of the context of the read.
+//
+// As writing a redacted entity back would erase the redacted fields in the database, a transaction where the
+// entity read was redacted can not write; the commit fails with RedactedWriteError. Query results are not
+// redacted, but Redact can be applied to them.
+func (c Collection) WithRedaction(policy RedactionPolicy) Collection {
+	return c.WithInterceptor(func(op Operation, next func() error) error {
+		if op.Transaction != nil && op.Transaction.redacted && op.Kind != OperationGet {
+			return errors.Wrapf(RedactedWriteError, "%s id='%s' partitionValue='%v'", op.Kind, op.Id, op.PartitionKey)
+		}
+		err := next()
+		if err == nil && op.Kind == OperationGet && Redact(op.Entity, PrincipalFromContext(op.Context), policy) && op.Transaction != nil {
+			op.Transaction.redacted = true
+		}
+		return err
+	})
+}
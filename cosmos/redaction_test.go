@@ -0,0 +1,63 @@
+package cosmos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type redactedModel struct {
+	BaseModel
+	UserId string `json:"userId"`
+	Email  string `json:"email" cosmosredact:"pii"`
+	Job    struct {
+		Title  string `json:"title"`
+		Salary int    `json:"salary" cosmosredact:"hr"`
+	} `json:"job"`
+}
+
+func (e *redactedModel) PrePut(txn *Transaction) error  { return nil }
+func (e *redactedModel) PostGet(txn *Transaction) error { return nil }
+
+func TestRedaction(t *testing.T) {
+	mock := mockCosmosJSON{Documents: map[string][]byte{
+		"id1": []byte(`{"id": "id1", "userId": "u", "email": "u@example.com", "job": {"title": "CEO", "salary": 100}, "_etag": "etag-1"}`),
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithRedaction(
+		func(principal interface{}, class string) bool {
+			return principal == "hr" || class == "pii" && principal == "support"
+		})
+
+	var entity redactedModel
+	require.NoError(t, c.StaleGetContext(WithPrincipal(context.Background(), "support"), "u", "id1", &entity))
+	require.Equal(t, "u@example.com", entity.Email)
+	require.Equal(t, "CEO", entity.Job.Title)
+	require.Equal(t, 0, entity.Job.Salary)
+
+	entity = redactedModel{}
+	require.NoError(t, c.StaleGetContext(WithPrincipal(context.Background(), "hr"), "u", "id1", &entity))
+	require.Equal(t, "u@example.com", entity.Email)
+	require.Equal(t, 100, entity.Job.Salary)
+
+	// Without a principal, everything tagged is redacted, also in sessions
+	entity = redactedModel{}
+	require.NoError(t, c.Session().Get("u", "id1", &entity))
+	require.Equal(t, "", entity.Email)
+	require.Equal(t, 0, entity.Job.Salary)
+	require.Equal(t, "etag-1", entity.Etag)
+
+	// A redacted entity can not be written back in a transaction
+	err := c.Session().Transaction(func(txn *Transaction) error {
+		var entity redactedModel
+		if err := txn.Get("u", "id1", &entity); err != nil {
+			return err
+		}
+		entity.Job.Title = "CTO"
+		txn.Put(&entity)
+		return nil
+	})
+	require.Equal(t, RedactedWriteError, errors.Cause(err))
+	require.Contains(t, string(mock.Documents["id1"]), `"salary": 100`)
+}
@@ -0,0 +1,114 @@
+package cosmos
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/logging"
+)
+
+// SanityCheckMode decides what happens when a fetched document does not have the id or partition key
+// value it was fetched with, which usually means that it was written by something that does not agree
+// with the entity struct about the field names.
+type SanityCheckMode int
+
+const (
+	// SanityCheckError fails the Get with an UnexpectedIdError or UnexpectedPartitionValueError (the default)
+	SanityCheckError SanityCheckMode = iota
+	// SanityCheckWarn logs a warning and sets the id and partition key value on the entity
+	SanityCheckWarn
+	// SanityCheckOff returns the document as it is
+	SanityCheckOff
+)
+
+// UnexpectedIdError is returned when a fetched document has a different id than it was fetched with
+type UnexpectedIdError struct {
+	Expected, Got string
+}
+
+func (e UnexpectedIdError) Error() string {
+	return fmt.Sprintf(fmtUnexpectedIdError, e.Expected, e.Got)
+}
+
+// UnexpectedPartitionValueError is returned when a fetched document has a different partition key value
+// than it was fetched with
+type UnexpectedPartitionValueError struct {
+	Expected, Got interface{}
+}
+
+func (e UnexpectedPartitionValueError) Error() string {
+	return fmt.Sprintf(fmtUnexpectedPartitionKeyValueError, e.Expected, e.Got)
+}
+
+type sanityCheckConfig struct {
+	mode     SanityCheckMode
+	backfill bool
+	log      logging.ExtendedLogger
+}
+
+// WithSanityChecks returns a Collection where mismatching ids and partition key values on fetched
+// documents are handled according to mode; log receives the warnings of SanityCheckWarn.
+func (c Collection) WithSanityChecks(mode SanityCheckMode, log logging.StdLogger) Collection {
+	config := c.sanityCheckConfig()
+	config.mode, config.log = mode, logging.Adapt(log)
+	c.sanityChecks = &config // note: non-pointer receiver
+	return c
+}
+
+// WithPartitionKeyBackfill returns a Collection where fetched documents that lack the partition key field,
+// e.g. because they were written by a legacy system, get it set to the partition key value they were
+// fetched with, instead of failing the sanity check. The field is stored the next time the entity is put.
+func (c Collection) WithPartitionKeyBackfill() Collection {
+	config := c.sanityCheckConfig()
+	config.backfill = true
+	c.sanityChecks = &config // note: non-pointer receiver
+	return c
+}
+
+func (c Collection) sanityCheckConfig() sanityCheckConfig {
+	if c.sanityChecks == nil {
+		return sanityCheckConfig{}
+	}
+	return *c.sanityChecks
+}
+
+// checkFetched checks that target, which was fetched by id and partitionValue, has them
+func (c Collection) checkFetched(partitionValue interface{}, id string, target Model) error {
+	res, targetPartitionValue, err := c.getEntityInfo(target)
+	if err != nil {
+		return err
+	}
+	config := c.sanityCheckConfig()
+	if config.backfill && isMissingPartitionValue(targetPartitionValue) && !isMissingPartitionValue(partitionValue) {
+		if err := c.setPartitionValue(target, partitionValue); err != nil {
+			return err
+		}
+		targetPartitionValue = partitionValue
+	}
+	if config.mode == SanityCheckOff {
+		return nil
+	}
+	var problems []error
+	if res.Id != id {
+		problems = append(problems, UnexpectedIdError{Expected: id, Got: res.Id})
+	}
+	if !samePartitionValue(targetPartitionValue, partitionValue) {
+		problems = append(problems, UnexpectedPartitionValueError{Expected: partitionValue, Got: targetPartitionValue})
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if config.mode == SanityCheckError {
+		return errors.WithStack(problems[0])
+	}
+	for _, problem := range problems {
+		config.log.Warnf("Collection %s: %s; correcting it\n", c.Name, problem)
+	}
+	res.Id = id
+	return c.setPartitionValue(target, partitionValue)
+}
+
+func isMissingPartitionValue(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
@@ -0,0 +1,49 @@
+package cosmos
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanityCheckModes(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "other", ReturnEmptyId: true}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	err := c.StaleGet("partitionvalue", "idvalue", &MyModel{})
+	require.Equal(t, UnexpectedIdError{Expected: "idvalue", Got: ""}, errors.Cause(err))
+	mock.ReturnEmptyId = false
+	err = c.StaleGet("partitionvalue", "idvalue", &MyModel{})
+	require.Equal(t, UnexpectedPartitionValueError{Expected: "partitionvalue", Got: "other"}, errors.Cause(err))
+
+	var buf bytes.Buffer
+	var e MyModel
+	require.NoError(t, c.WithSanityChecks(SanityCheckWarn, log.New(&buf, "", 0)).StaleGet("partitionvalue", "idvalue", &e))
+	assert.Equal(t, "partitionvalue", e.UserId)
+	assert.Equal(t, "Collection mycollection: Unexpected partition key vaule on fetched document: expected 'partitionvalue', got: 'other'; correcting it\n", buf.String())
+
+	require.NoError(t, c.WithSanityChecks(SanityCheckOff, nil).StaleGet("partitionvalue", "idvalue", &e))
+	assert.Equal(t, "other", e.UserId)
+}
+
+func TestPartitionKeyBackfill(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: ""}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var e MyModel
+	err := c.StaleGet("partitionvalue", "idvalue", &e)
+	require.Equal(t, UnexpectedPartitionValueError{Expected: "partitionvalue", Got: ""}, errors.Cause(err))
+
+	c = c.WithPartitionKeyBackfill()
+	require.NoError(t, c.StaleGet("partitionvalue", "idvalue", &e))
+	assert.Equal(t, "partitionvalue", e.UserId)
+
+	// Only missing values are backfilled
+	mock.ReturnUserId = "other"
+	err = c.StaleGet("partitionvalue", "idvalue", &e)
+	require.Equal(t, UnexpectedPartitionValueError{Expected: "partitionvalue", Got: "other"}, errors.Cause(err))
+}
@@ -0,0 +1,136 @@
+package cosmos
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// The number of attempts Sequence makes at updating the sequence document before giving up with ContentionError
+const sequenceRetries = 10
+
+// Sequence hands out increasing numbers per partition value, e.g. for event versions or order numbers.
+// The next free number is kept in a document with id Id in each partition, which is updated with optimistic
+// concurrency (etag compare-and-swap); the first number handed out is 1.
+//
+// To cut contention on the sequence document, each Sequence can reserve blocks of BlockSize numbers at a time
+// and hand them out from memory. Numbers are then only increasing per Sequence instance; with several processes,
+// the numbers are unique but interleaved, and numbers of unused blocks are lost when the process stops. Use
+// BlockSize 1 (the default) where the numbers must be strictly increasing in the order they are handed out.
+type Sequence struct {
+	Collection Collection
+	Id         string
+	BlockSize  int
+
+	// mu guards blocks; each block has its own lock, held while reserving, so that partitions do not wait
+	// for each other
+	mu     sync.Mutex
+	blocks map[uniqueKey]*sequenceBlock
+}
+
+type sequenceBlock struct {
+	mu        sync.Mutex
+	next, end int64
+}
+
+// NewSequence returns a Sequence stored in documents with the given id in c, reserving blockSize numbers at a time
+func NewSequence(c Collection, id string, blockSize int) *Sequence {
+	return &Sequence{Collection: c, Id: id, BlockSize: blockSize}
+}
+
+// Next returns the next number of the sequence in the partition
+func (s *Sequence) Next(partitionValue interface{}) (int64, error) {
+	key, err := newUniqueKey(partitionValue, s.Id)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	if s.blocks == nil {
+		s.blocks = make(map[uniqueKey]*sequenceBlock)
+	}
+	block := s.blocks[key]
+	if block == nil {
+		block = &sequenceBlock{}
+		s.blocks[key] = block
+	}
+	s.mu.Unlock()
+
+	block.mu.Lock()
+	defer block.mu.Unlock()
+	if block.next == block.end {
+		blockSize := s.BlockSize
+		if blockSize < 1 {
+			blockSize = 1
+		}
+		first, err := s.Reserve(partitionValue, blockSize)
+		if err != nil {
+			return 0, err
+		}
+		block.next, block.end = first, first+int64(blockSize)
+	}
+	n := block.next
+	block.next++
+	return n, nil
+}
+
+// Reserve reserves n consecutive numbers of the sequence in the partition, and returns the first of them,
+// bypassing the block held in memory by Next
+func (s *Sequence) Reserve(partitionValue interface{}, n int) (first int64, err error) {
+	if n < 1 {
+		return 0, errors.Errorf("Can not reserve %d numbers", n)
+	}
+	c := s.Collection
+	op := Operation{Kind: OperationPut, PartitionKey: partitionValue, Id: s.Id}
+	err = c.intercept(op, func() error {
+		for i := 0; i != sequenceRetries; i++ {
+			first, err = s.reserve(partitionValue, n)
+			if errors.Cause(err) != cosmosapi.ErrPreconditionFailed {
+				return err
+			}
+			time.Sleep(time.Duration(10*(i+1)) * time.Millisecond)
+		}
+		return errors.WithStack(ContentionError)
+	})
+	return
+}
+
+func (s *Sequence) reserve(partitionValue interface{}, n int) (int64, error) {
+	c := s.Collection
+	ctx := c.GetContext()
+	var doc struct {
+		BaseModel
+		Next int64 `json:"next"`
+	}
+	_, err := c.Client.GetDocument(ctx, c.DbName, c.Name, s.Id, cosmosapi.GetDocumentOptions{PartitionKeyValue: partitionValue}, &doc)
+	if errors.Cause(err) == cosmosapi.ErrNotFound {
+		doc.Next = 1
+	} else if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	first := doc.Next
+	body := map[string]interface{}{"id": s.Id, "next": first + int64(n)}
+	body[c.PartitionKey] = partitionValue
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if doc.Etag == "" {
+		opts := cosmosapi.CreateDocumentOptions{PartitionKeyValue: partitionValue}
+		_, _, err = c.Client.CreateDocument(ctx, c.DbName, c.Name, data, opts)
+		if errors.Cause(err) == cosmosapi.ErrConflict {
+			// Created concurrently by someone else
+			err = cosmosapi.ErrPreconditionFailed
+		}
+	} else {
+		opts := cosmosapi.ReplaceDocumentOptions{PartitionKeyValue: partitionValue, IfMatch: doc.Etag}
+		_, _, err = c.Client.ReplaceDocument(ctx, c.DbName, c.Name, s.Id, data, opts)
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return first, nil
+}
@@ -0,0 +1,141 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// mockCosmosEtags stores raw documents and checks etags on replace
+type mockCosmosEtags struct {
+	Client
+	Documents map[string]map[string]interface{}
+	Etags     int
+	// ConcurrentWrites is the number of replaces that fail as if someone else wrote first
+	ConcurrentWrites int
+}
+
+func (mock *mockCosmosEtags) GetDocument(ctx context.Context,
+	dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	doc, ok := mock.Documents[id]
+	if !ok {
+		return cosmosapi.DocumentResponse{}, cosmosapi.ErrNotFound
+	}
+	data, _ := json.Marshal(doc)
+	return cosmosapi.DocumentResponse{}, json.Unmarshal(data, out)
+}
+
+func (mock *mockCosmosEtags) write(id string, doc interface{}) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(doc.([]byte), &m); err != nil {
+		return nil, cosmosapi.DocumentResponse{}, err
+	}
+	mock.Etags++
+	m["_etag"] = fmt.Sprintf("etag-%d", mock.Etags)
+	mock.Documents[id] = m
+	return &cosmosapi.Resource{Id: id, Etag: m["_etag"].(string)}, cosmosapi.DocumentResponse{}, nil
+}
+
+func (mock *mockCosmosEtags) CreateDocument(ctx context.Context,
+	dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	var m map[string]interface{}
+	_ = json.Unmarshal(doc.([]byte), &m)
+	if _, exists := mock.Documents[m["id"].(string)]; exists && !ops.IsUpsert {
+		return nil, cosmosapi.DocumentResponse{}, cosmosapi.ErrConflict
+	}
+	return mock.write(m["id"].(string), doc)
+}
+
+func (mock *mockCosmosEtags) ReplaceDocument(ctx context.Context,
+	dbName, colName, id string, doc interface{}, ops cosmosapi.ReplaceDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	if mock.ConcurrentWrites > 0 {
+		mock.ConcurrentWrites--
+		existing := mock.Documents[id]
+		existing["next"] = existing["next"].(float64) + 100
+		data, _ := json.Marshal(existing)
+		mock.write(id, data)
+	}
+	if mock.Documents[id]["_etag"] != ops.IfMatch {
+		return nil, cosmosapi.DocumentResponse{}, cosmosapi.ErrPreconditionFailed
+	}
+	return mock.write(id, doc)
+}
+
+// mockCosmosBlockedPartition blocks gets in one partition until released
+type mockCosmosBlockedPartition struct {
+	*mockCosmosEtags
+	partitionValue   interface{}
+	started, release chan struct{}
+}
+
+func (mock *mockCosmosBlockedPartition) GetDocument(ctx context.Context,
+	dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	if ops.PartitionKeyValue == mock.partitionValue {
+		mock.started <- struct{}{}
+		<-mock.release
+	}
+	return mock.mockCosmosEtags.GetDocument(ctx, dbName, colName, id, ops, out)
+}
+
+func TestSequence(t *testing.T) {
+	mock := mockCosmosEtags{Documents: make(map[string]map[string]interface{})}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	s := NewSequence(c, "sequence:orders", 1)
+	for expected := int64(1); expected <= 3; expected++ {
+		n, err := s.Next("u")
+		require.NoError(t, err)
+		require.Equal(t, expected, n)
+	}
+	require.Equal(t, map[string]interface{}{"id": "sequence:orders", "userId": "u", "next": 4.0, "_etag": "etag-3"}, mock.Documents["sequence:orders"])
+
+	// Someone else reserved 100 numbers concurrently; we retry and continue after them
+	mock.ConcurrentWrites = 1
+	n, err := s.Next("u")
+	require.NoError(t, err)
+	require.Equal(t, int64(104), n)
+
+	// Blocks are reserved with one write, and handed out from memory
+	s = NewSequence(c, "sequence:orders", 10)
+	etags := mock.Etags
+	for expected := int64(105); expected <= 114; expected++ {
+		n, err := s.Next("u")
+		require.NoError(t, err)
+		require.Equal(t, expected, n)
+	}
+	require.Equal(t, etags+1, mock.Etags)
+
+	_, err = NewSequence(c.ReadOnly(), "sequence:orders", 1).Next("u")
+	require.Equal(t, cosmosapi.ErrReadOnly, errors.Cause(err))
+}
+
+func TestSequencePartitionsDoNotWait(t *testing.T) {
+	mock := mockCosmosBlockedPartition{
+		mockCosmosEtags: &mockCosmosEtags{Documents: make(map[string]map[string]interface{})},
+		partitionValue:  "slow",
+		started:         make(chan struct{}),
+		release:         make(chan struct{}),
+	}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	s := NewSequence(c, "sequence:orders", 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := s.Next("slow")
+		done <- err
+	}()
+	<-mock.started
+
+	// While the slow partition reserves, the other one can still hand out numbers
+	n, err := s.Next("fast")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	close(mock.release)
+	require.NoError(t, <-done)
+}
@@ -3,8 +3,11 @@ package cosmos
 import (
 	"context"
 	"encoding/json"
-	"github.com/pkg/errors"
 	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+	"github.com/vippsas/go-cosmosdb/logging"
 )
 
 const DefaultConflictRetries = 3
@@ -12,6 +15,9 @@ const DefaultConflictRetries = 3
 type sessionState struct {
 	mu           sync.Mutex
 	sessionToken string
+	lastResponse cosmosapi.DocumentResponse
+	// requestUnits is the total request charge of the requests made within the session
+	requestUnits float64
 
 	// The entity cache is a map of string -> interface to json serialization.struct (not
 	// pointer-to-struct). All the structs are dedidcated copies owned
@@ -23,7 +29,22 @@ type Session struct {
 	Context         context.Context
 	ConflictRetries int
 	Collection      Collection
-	state           *sessionState
+	// If RevalidateCache is set, entities found in the session cache are revalidated against Cosmos using
+	// their etag. An unchanged document costs ~1 RU (304 Not Modified) instead of re-downloading it.
+	RevalidateCache bool
+	// CommitMode decides whether transactions replace the whole document or patch the changed fields
+	CommitMode CommitMode
+	state      *sessionState
+	// diagnostics, if set, receives warnings about session tokens that went backwards
+	diagnostics logging.ExtendedLogger
+	// trace is set by WithTransactionTrace
+	trace bool
+	// traceDocuments is set by WithTransactionTraceDocuments
+	traceDocuments bool
+	// strict is set by WithStrictMode
+	strict bool
+	// copyOnRead is set by WithCopyOnRead
+	copyOnRead bool
 }
 
 func (c Collection) Session() Session {
@@ -53,6 +74,57 @@ func (session Session) Token() string {
 	return session.state.sessionToken
 }
 
+// LastResponse returns the response of the last request made to Cosmos within the session, be it a Get()
+// that was not served from the session cache or a commit. This gives access to headers such as the request
+// charge and activity id without dropping down to cosmosapi.
+func (session Session) LastResponse() cosmosapi.DocumentResponse {
+	return session.state.lastResponse
+}
+
+// updateFromResponse is called with the response of every request made to Cosmos within the session
+func (session Session) updateFromResponse(response cosmosapi.DocumentResponse) {
+	// no matter what happened, if we got a session token we want to update to it
+	if response.SessionToken != "" {
+		if session.diagnostics != nil && session.state.sessionToken != "" {
+			session.checkSessionToken(session.state.sessionToken, response.SessionToken)
+		}
+		session.state.sessionToken = response.SessionToken
+	}
+	session.state.lastResponse = response
+	session.state.requestUnits += response.RUs
+}
+
+// RequestUnits returns the total request charge (RUs) of the requests made to Cosmos within the session,
+// including those of transaction attempts that were retried, e.g. to attribute the cost of an API request.
+func (session Session) RequestUnits() float64 {
+	return session.state.requestUnits
+}
+
+// WithSessionDiagnostics returns a session that logs a warning to log whenever Cosmos responds with a session
+// token that is behind the one the session already had; see cosmosapi.SessionToken.Regressions. This helps
+// debugging violations of read-your-writes.
+func (session Session) WithSessionDiagnostics(log logging.StdLogger) Session {
+	session.diagnostics = logging.Adapt(log) // note: non-pointer receiver
+	return session
+}
+
+func (session Session) checkSessionToken(previous, current string) {
+	previousToken, err := cosmosapi.ParseSessionToken(previous)
+	if err != nil {
+		session.diagnostics.Warnf("Session token diagnostics: %v\n", err)
+		return
+	}
+	currentToken, err := cosmosapi.ParseSessionToken(current)
+	if err != nil {
+		session.diagnostics.Warnf("Session token diagnostics: %v\n", err)
+		return
+	}
+	for _, regression := range currentToken.Regressions(previousToken) {
+		session.diagnostics.Warnf("Session token went backwards in collection %s: %s (session token '%s', response token '%s')\n",
+			session.Collection.Name, regression, previous, current)
+	}
+}
+
 func (session Session) WithContext(ctx context.Context) Session {
 	session.Context = ctx // note: non-pointer receiver
 	return session
@@ -63,6 +135,19 @@ func (session Session) WithRetries(n int) Session {
 	return session
 }
 
+// WithCacheRevalidation returns a session where Transaction.Get() revalidates cached entities against
+// Cosmos, see RevalidateCache.
+func (session Session) WithCacheRevalidation() Session {
+	session.RevalidateCache = true // note: non-pointer receiver
+	return session
+}
+
+// WithCommitMode returns a session where transactions commit existing entities using the given mode
+func (session Session) WithCommitMode(mode CommitMode) Session {
+	session.CommitMode = mode // note: non-pointer receiver
+	return session
+}
+
 // Drop removes an entity from the session cache, so that the next fetch will always go
 // out externally to fetch it.
 func (session Session) Drop(partitionValue interface{}, id string) {
@@ -88,6 +173,11 @@ func (session Session) Get(partitionValue interface{}, id string, target Model)
 	})
 }
 
+// GetContext is like Get, but does the request with ctx instead of the context of the session
+func (session Session) GetContext(ctx context.Context, partitionValue interface{}, id string, target Model) error {
+	return session.WithContext(ctx).Get(partitionValue, id, target)
+}
+
 func (session Session) cacheSet(partitionValue interface{}, id string, entity Model) error {
 	key, err := newUniqueKey(partitionValue, id)
 	if err != nil {
@@ -115,8 +205,7 @@ func (session Session) cacheGet(partitionKey interface{}, id string, entityPtr M
 	} else if serialized != nil {
 		return true, json.Unmarshal(serialized, entityPtr)
 	} else {
-		session.Collection.initializeEmptyDoc(partitionKey, id, entityPtr)
-		return true, nil
+		return true, session.Collection.initializeEmptyDoc(partitionKey, id, entityPtr)
 	}
 }
 
@@ -0,0 +1,66 @@
+package cosmos
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// SessionDump is a snapshot of the state of a session, see Session.DebugDump. It serializes to JSON, e.g. for
+// logging.
+type SessionDump struct {
+	Collection   string              `json:"collection"`
+	SessionToken string              `json:"sessionToken"`
+	Entries      []SessionCacheEntry `json:"entries"`
+}
+
+// SessionCacheEntry describes an entity in the session cache
+type SessionCacheEntry struct {
+	PartitionValue interface{} `json:"partitionValue"`
+	Id             string      `json:"id"`
+	// Exists is false if the entity was cached as not existing in the database
+	Exists bool   `json:"exists"`
+	Etag   string `json:"etag,omitempty"`
+	// Size is the size of the serialized entity in bytes
+	Size int `json:"size"`
+	// Document is the serialized entity; only included if requested
+	Document json.RawMessage `json:"document,omitempty"`
+}
+
+// DebugDump returns the session token and the entities in the session cache, ordered by partition value and id,
+// to troubleshoot e.g. why a transaction did not see a write. The serialized entities are only included if
+// includeDocuments is set; leave it unset in production, where they may contain personal data.
+func (session Session) DebugDump(includeDocuments bool) SessionDump {
+	session.state.mu.Lock()
+	defer session.state.mu.Unlock()
+	dump := SessionDump{
+		Collection:   session.Collection.Name,
+		SessionToken: session.state.sessionToken,
+		Entries:      []SessionCacheEntry{},
+	}
+	keys := make([]string, 0, len(session.state.entityCache))
+	for key := range session.state.entityCache {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		serialized := session.state.entityCache[uniqueKey(key)]
+		var entry SessionCacheEntry
+		var pair []interface{}
+		if err := json.Unmarshal([]byte(key), &pair); err == nil && len(pair) == 2 {
+			entry.PartitionValue = pair[0]
+			entry.Id, _ = pair[1].(string)
+		}
+		if serialized != nil {
+			var base BaseModel
+			_ = json.Unmarshal(serialized, &base)
+			entry.Exists = true
+			entry.Etag = base.Etag
+			entry.Size = len(serialized)
+			if includeDocuments {
+				entry.Document = json.RawMessage(serialized)
+			}
+		}
+		dump.Entries = append(dump.Entries, entry)
+	}
+	return dump
+}
@@ -0,0 +1,35 @@
+package cosmos
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionDebugDump(t *testing.T) {
+	mock := mockCosmosEtags{Documents: map[string]map[string]interface{}{
+		"a": {"id": "a", "userId": "u", "x": 1.0, "_etag": "etag-a"},
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	session := c.Session()
+	var entity MyModel
+	require.NoError(t, session.Get("u", "b", &entity))
+	require.NoError(t, session.Get("u", "a", &entity))
+
+	dump := session.DebugDump(false)
+	require.Equal(t, "mycollection", dump.Collection)
+	require.Len(t, dump.Entries, 2)
+	require.Equal(t, "a", dump.Entries[0].Id)
+	require.Equal(t, "u", dump.Entries[0].PartitionValue)
+	require.True(t, dump.Entries[0].Exists)
+	require.Equal(t, "etag-a", dump.Entries[0].Etag)
+	require.True(t, dump.Entries[0].Size > 0)
+	require.Nil(t, dump.Entries[0].Document)
+	require.Equal(t, SessionCacheEntry{PartitionValue: "u", Id: "b"}, dump.Entries[1])
+
+	dump = session.DebugDump(true)
+	var document map[string]interface{}
+	require.NoError(t, json.Unmarshal(dump.Entries[0].Document, &document))
+	require.Equal(t, 1.0, document["x"])
+}
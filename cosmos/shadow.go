@@ -0,0 +1,180 @@
+package cosmos
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// The maximum number of drift entries kept by a ShadowWriter
+const maxShadowDrift = 1000
+
+// ShadowDrift records a write to the primary collection that was not mirrored to the shadow collection
+type ShadowDrift struct {
+	PartitionValue interface{}
+	Id             string
+	Time           time.Time
+	Err            error
+}
+
+// ShadowReport summarizes the mirrored writes of a ShadowWriter
+type ShadowReport struct {
+	Mirrored int
+	Failed   int
+	// Drift lists the writes that were not mirrored (most recent last, capped at 1000 entries). These
+	// documents differ between the collections and need to be reconciled before cutting reads over.
+	Drift []ShadowDrift
+}
+
+type shadowWrite struct {
+	partitionValue interface{}
+	id             string
+	document       []byte
+	deleted        bool
+}
+
+// ShadowWriter mirrors writes to a shadow collection, e.g. a new collection with a different partition
+// key that is being migrated to. Writes are mirrored asynchronously by a background goroutine, so that the
+// shadow collection does not add latency or failures to the primary; writes that could not be mirrored
+// are recorded in the report instead. Attach it to the primary collection with WithShadowWrites.
+type ShadowWriter struct {
+	target Collection
+	queue  chan shadowWrite
+	done   chan struct{}
+
+	// queueMu guards sending on queue against Close closing it
+	queueMu sync.Mutex
+	closed  bool
+
+	mu     sync.Mutex
+	report ShadowReport
+}
+
+// NewShadowWriter starts a ShadowWriter writing to target, which may be in another account. Up to queueSize
+// writes are queued; if the queue is full, writes are not mirrored but recorded as drift.
+// The documents are written as upserts, without calling any hooks, and with the partition key value taken
+// from the property target.PartitionKey of the document; so the Client of target must implement
+// DocumentUpserter, and DocumentDeleter to mirror deletes.
+func NewShadowWriter(target Collection, queueSize int) *ShadowWriter {
+	s := &ShadowWriter{
+		target: target,
+		queue:  make(chan shadowWrite, queueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Close stops accepting writes, and waits until the queued writes have been mirrored. Writes done after
+// Close are not mirrored, but recorded as drift.
+func (s *ShadowWriter) Close() {
+	s.queueMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.queueMu.Unlock()
+	<-s.done
+}
+
+// enqueue queues w to be mirrored, unless the queue is full or the writer is closed
+func (s *ShadowWriter) enqueue(w shadowWrite) error {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if s.closed {
+		return errors.New("ShadowWriter is closed")
+	}
+	select {
+	case s.queue <- w:
+		return nil
+	default:
+		return errors.New("Shadow write queue is full")
+	}
+}
+
+// Report returns a snapshot of the report
+func (s *ShadowWriter) Report() ShadowReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.report
+	report.Drift = append([]ShadowDrift(nil), s.report.Drift...)
+	return report
+}
+
+func (s *ShadowWriter) run() {
+	defer close(s.done)
+	for w := range s.queue {
+		s.record(w.partitionValue, w.id, s.mirror(w))
+	}
+}
+
+func (s *ShadowWriter) mirror(w shadowWrite) error {
+	doc, err := decodeForTarget(w.document)
+	if err != nil {
+		return err
+	}
+	partitionValue, err := targetPartitionValue(s.target, doc)
+	if err != nil {
+		return err
+	}
+	if w.deleted {
+		opts := cosmosapi.DeleteDocumentOptions{PartitionKeyValue: partitionValue}
+		_, err := s.target.deleteDocument(s.target.GetContext(), w.id, opts)
+		if errors.Cause(err) == cosmosapi.ErrNotFound {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	opts := cosmosapi.UpsertDocumentOptions{PartitionKeyValue: partitionValue}
+	_, _, err = s.target.upsertDocument(s.target.GetContext(), data, opts)
+	return errors.WithStack(err)
+}
+
+func (s *ShadowWriter) record(partitionValue interface{}, id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.report.Mirrored++
+		return
+	}
+	s.report.Failed++
+	s.report.Drift = append(s.report.Drift, ShadowDrift{PartitionValue: partitionValue, Id: id, Time: time.Now(), Err: err})
+	if len(s.report.Drift) > maxShadowDrift {
+		s.report.Drift = s.report.Drift[len(s.report.Drift)-maxShadowDrift:]
+	}
+}
+
+func (s *ShadowWriter) interceptor(op Operation, next func() error) error {
+	err := next()
+	if err != nil || (op.Kind != OperationPut && op.Kind != OperationPatch && op.Kind != OperationDelete) {
+		return err
+	}
+	if op.Entity == nil {
+		// A patch without a target; we do not know the resulting document
+		s.record(op.PartitionKey, op.Id, errors.New("Patch without target can not be mirrored"))
+		return nil
+	}
+	document, snapshotErr := snapshotEntity(op.Entity)
+	if snapshotErr != nil {
+		s.record(op.PartitionKey, op.Id, snapshotErr)
+		return nil
+	}
+	w := shadowWrite{partitionValue: op.PartitionKey, id: op.Id, document: document, deleted: op.Kind == OperationDelete}
+	if err := s.enqueue(w); err != nil {
+		s.record(op.PartitionKey, op.Id, err)
+	}
+	return nil
+}
+
+// WithShadowWrites returns a Collection where successful writes (Put, Patch with a target, Delete and
+// transaction commits) are mirrored to the shadow collection of s
+func (c Collection) WithShadowWrites(s *ShadowWriter) Collection {
+	return c.WithInterceptor(s.interceptor)
+}
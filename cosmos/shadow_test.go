@@ -0,0 +1,103 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosShadow struct {
+	Client
+	mu        sync.Mutex
+	Documents map[string]map[string]interface{}
+	FailIds   map[string]bool
+}
+
+func (mock *mockCosmosShadow) UpsertDocument(ctx context.Context,
+	dbName, colName string, doc interface{}, ops cosmosapi.UpsertDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	var m map[string]interface{}
+	if err := json.Unmarshal(doc.([]byte), &m); err != nil {
+		return nil, cosmosapi.DocumentResponse{}, err
+	}
+	if mock.FailIds[m["id"].(string)] {
+		return nil, cosmosapi.DocumentResponse{}, cosmosapi.ErrUnavailable
+	}
+	if ops.PartitionKeyValue != m["userId"] {
+		panic("assertion failed")
+	}
+	mock.Documents[m["id"].(string)] = m
+	return &cosmosapi.Resource{}, cosmosapi.DocumentResponse{}, nil
+}
+
+func (mock *mockCosmosShadow) DeleteDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.DeleteDocumentOptions) (cosmosapi.DocumentResponse, error) {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	if _, ok := mock.Documents[id]; !ok {
+		return cosmosapi.DocumentResponse{}, cosmosapi.ErrNotFound
+	}
+	delete(mock.Documents, id)
+	return cosmosapi.DocumentResponse{}, nil
+}
+
+func TestShadowWrites(t *testing.T) {
+	primary := mockCosmos{ReturnUserId: "partitionvalue", ReturnEtag: "etag"}
+	shadow := mockCosmosShadow{Documents: make(map[string]map[string]interface{}), FailIds: map[string]bool{"c": true}}
+	shadowWriter := NewShadowWriter(Collection{Client: &shadow, DbName: "mydb", Name: "shadow", PartitionKey: "userId"}, 10)
+	c := Collection{Client: &primary, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithShadowWrites(shadowWriter)
+
+	entity := MyModel{BaseModel: BaseModel{Id: "a"}, UserId: "partitionvalue", X: 1}
+	require.NoError(t, c.RacingPut(&entity))
+	require.NoError(t, c.Session().Transaction(func(txn *Transaction) error {
+		var entity MyModel
+		require.NoError(t, txn.Get("partitionvalue", "b", &entity))
+		entity.X = 2
+		txn.Put(&entity)
+		return nil
+	}))
+
+	entity.Id = "c"
+	require.NoError(t, c.RacingPut(&entity)) // the primary write succeeds, regardless of the shadow
+	shadowWriter.Close()
+
+	report := shadowWriter.Report()
+	require.Equal(t, 2, report.Mirrored)
+	require.Equal(t, 1, report.Failed)
+	require.Equal(t, "c", report.Drift[0].Id)
+	require.Equal(t, float64(2), shadow.Documents["b"]["x"])
+	_, hasEtag := shadow.Documents["b"]["_etag"]
+	require.False(t, hasEtag)
+
+	// Writes after Close are not mirrored, but recorded as drift
+	entity.Id = "d"
+	require.NoError(t, c.RacingPut(&entity))
+	shadowWriter.Close()
+	report = shadowWriter.Report()
+	require.Equal(t, 2, report.Failed)
+	require.Equal(t, "d", report.Drift[1].Id)
+}
+
+func TestShadowDeletes(t *testing.T) {
+	primary := mockCosmosDelete{mockCosmos: mockCosmos{ReturnUserId: "partitionvalue", ReturnEtag: "etag"}}
+	shadow := mockCosmosShadow{Documents: map[string]map[string]interface{}{"a": {"id": "a"}}}
+	shadowWriter := NewShadowWriter(Collection{Client: &shadow, DbName: "mydb", Name: "shadow", PartitionKey: "userId"}, 10)
+	c := Collection{Client: &primary, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}.WithShadowWrites(shadowWriter)
+
+	for _, id := range []string{"a", "b"} { // b is not in the shadow collection
+		require.NoError(t, c.Session().Transaction(func(txn *Transaction) error {
+			var entity MyModel
+			require.NoError(t, txn.Get("partitionvalue", id, &entity))
+			txn.Delete(&entity)
+			return nil
+		}))
+	}
+	shadowWriter.Close()
+
+	require.Equal(t, 2, shadowWriter.Report().Mirrored)
+	require.Empty(t, shadow.Documents)
+}
@@ -0,0 +1,64 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// ReadInfo tells where StaleGetWithInfo got the entity from
+type ReadInfo struct {
+	// Response is the response from Cosmos; empty if the entity was served from the entity cache
+	Response cosmosapi.DocumentResponse
+	// FromCache is true if the entity was served from the entity cache
+	FromCache bool
+	// Stale is true if the entity was served from the entity cache after it expired, because reading it
+	// from Cosmos failed with Err
+	Stale bool
+	Err   error
+	// Age is how long ago the entity was cached; only known with WithStaleIfError
+	Age time.Duration
+}
+
+// staleCacheEntry is how entities are cached by collections with WithStaleIfError
+type staleCacheEntry struct {
+	CachedAt time.Time       `json:"_cachedAt"`
+	Entity   json.RawMessage `json:"_entity"`
+}
+
+// WithStaleIfError returns a copy of the collection where StaleGet() and StaleGetExisting() serve an entity
+// from the entity cache for up to maxStale after it has expired, if reading it from Cosmos fails with an
+// error that may be temporary: timeouts, network errors, 500 Internal Server Error, 503 Service Unavailable,
+// 429 Too Many Requests and running out of retries. This keeps read paths available during Cosmos incidents.
+// Use StaleGetWithInfo to find out whether an entity was served stale, and how old it is.
+//
+// Entities are kept in the cache for the ttl given to WithEntityCache plus maxStale, together with the time
+// they were cached; so entities cached by collections without WithStaleIfError, e.g. in other processes
+// sharing the cache, are not used, and vice versa. It has no effect without WithEntityCache.
+func (c Collection) WithStaleIfError(maxStale time.Duration) Collection {
+	c.staleIfError = maxStale // note that c is not a pointer
+	return c
+}
+
+// StaleGetWithInfo is like StaleGet, but also tells whether the entity was served from the entity cache,
+// and whether it was stale
+func (c Collection) StaleGetWithInfo(partitionValue interface{}, id string, target Model) (ReadInfo, error) {
+	return c.cachedGet(partitionValue, id, target, false)
+}
+
+// isTemporaryReadError returns true for errors on which a stale entity may be served; other errors, e.g.
+// failing to decode the document, are not helped by waiting
+func isTemporaryReadError(err error) bool {
+	cause := errors.Cause(err)
+	switch cause {
+	case cosmosapi.ErrTimeout, cosmosapi.ErrInternalError, cosmosapi.ErrUnavailable, cosmosapi.ErrMaxRetriesExceeded,
+		cosmosapi.ErrTooManyRequests, context.DeadlineExceeded:
+		return true
+	}
+	_, isNetError := cause.(net.Error)
+	return isNetError
+}
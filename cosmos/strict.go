@@ -0,0 +1,36 @@
+package cosmos
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// StrictModeError is returned by a transaction in a strict session (see Session.WithStrictMode) that puts an
+// entity other than the one returned by its Get
+type StrictModeError struct {
+	PartitionValue interface{}
+	Id             string
+}
+
+func (e StrictModeError) Error() string {
+	return fmt.Sprintf("Strict mode: the entity put for id='%s' partitionValue='%v' is not the one fetched by Get in the same transaction; "+
+		"entities from StaleGet, other sessions or other transactions must not be put", e.Id, e.PartitionValue)
+}
+
+// WithStrictMode returns a session where a transaction can only put the very entity (the same pointer) that
+// it fetched with Get. Without strict mode, an entity fetched elsewhere (e.g. with StaleGet, or in another
+// transaction) can be put as long as the transaction fetched an entity with the same id, which silently
+// writes data that the transaction did not read, bypassing the session cache and etag bookkeeping.
+func (session Session) WithStrictMode() Session {
+	session.strict = true // note: non-pointer receiver
+	return session
+}
+
+// checkStrict returns a StrictModeError if the session is strict and the entity to put is not the one fetched
+func (txn *Transaction) checkStrict(toPut, fetched Model, partitionValue interface{}, id string) error {
+	if !txn.session.strict || toPut == fetched {
+		return nil
+	}
+	return errors.WithStack(StrictModeError{PartitionValue: partitionValue, Id: id})
+}
@@ -0,0 +1,50 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictMode(t *testing.T) {
+	mock := mockCosmos{ReturnEtag: "etag-1", ReturnUserId: "partitionvalue"}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+
+	var stale MyModel
+	require.NoError(t, c.StaleGet("partitionvalue", "idvalue", &stale))
+	putStale := func(txn *Transaction) error {
+		var entity MyModel
+		if err := txn.Get("partitionvalue", "idvalue", &entity); err != nil {
+			return err
+		}
+		stale.X = 10
+		txn.Put(&stale)
+		return nil
+	}
+
+	// Without strict mode, the stale entity is written
+	require.NoError(t, c.Session().Transaction(putStale))
+	assert.Equal(t, "replace", mock.GotMethod)
+
+	mock.GotMethod = ""
+	err := c.Session().WithStrictMode().Transaction(putStale)
+	require.Error(t, err)
+	strictErr, ok := errors.Cause(err).(StrictModeError)
+	require.True(t, ok)
+	assert.Equal(t, "idvalue", strictErr.Id)
+	assert.Equal(t, "get", mock.GotMethod) // nothing written
+
+	// Putting the entity that was fetched is fine
+	require.NoError(t, c.Session().WithStrictMode().Transaction(func(txn *Transaction) error {
+		var entity MyModel
+		if err := txn.Get("partitionvalue", "idvalue", &entity); err != nil {
+			return err
+		}
+		entity.X = 10
+		txn.Put(&entity)
+		return nil
+	}))
+	assert.Equal(t, "replace", mock.GotMethod)
+}
@@ -0,0 +1,200 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vippsas/go-cosmosdb/logging"
+)
+
+// ComponentState is the state of a component run by a Supervisor
+type ComponentState string
+
+const (
+	ComponentRunning = ComponentState("running")
+	// ComponentBackoff is the state of a component that failed, waiting to be restarted
+	ComponentBackoff = ComponentState("backoff")
+	// ComponentStopped is the state of a component that returned without error, or was stopped
+	ComponentStopped = ComponentState("stopped")
+)
+
+// ComponentHealth is the health of a component run by a Supervisor
+type ComponentHealth struct {
+	Name     string         `json:"name"`
+	State    ComponentState `json:"state"`
+	Since    time.Time      `json:"since"`
+	Restarts int            `json:"restarts"`
+	// The last error returned by the component, which is kept after it has been restarted
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt"`
+}
+
+// Supervisor runs background components, such as change feed processors, in goroutines: a component
+// that fails (returns an error or panics) is restarted with exponential backoff, and the health of the
+// components is available with Health. Stop stops all components, and can be registered with
+// cosmosapi.Client.OnClose to stop them when the client is closed.
+//
+// Supervisor implements http.Handler, responding with the health of the components as JSON, and HTTP 200
+// if all are running and 503 otherwise.
+type Supervisor struct {
+	// The delay before the first restart of a failed component, doubled for every consecutive failure up
+	// to MaxBackoff. A component that has run for longer than MaxBackoff before failing is restarted after
+	// InitialBackoff again. They default to 1 second and 1 minute.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	log    logging.ExtendedLogger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	components map[string]*ComponentHealth
+}
+
+// NewSupervisor returns a Supervisor that logs failures of components to log, which may be nil
+func NewSupervisor(log logging.StdLogger) *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{
+		log:        logging.Adapt(log),
+		ctx:        ctx,
+		cancel:     cancel,
+		components: make(map[string]*ComponentHealth),
+	}
+}
+
+// Go starts running a component. run should return when ctx is done. The name identifies the component
+// in the health report and must be unique.
+func (s *Supervisor) Go(name string, run func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.components[name]; exists {
+		panic(fmt.Sprintf("cosmos.Supervisor: component %s already started", name))
+	}
+	s.components[name] = &ComponentHealth{Name: name, State: ComponentRunning, Since: time.Now()}
+	s.wg.Add(1)
+	go s.supervise(name, run)
+}
+
+func (s *Supervisor) supervise(name string, run func(ctx context.Context) error) {
+	defer s.wg.Done()
+	initialBackoff, maxBackoff := s.InitialBackoff, s.MaxBackoff
+	if initialBackoff == 0 {
+		initialBackoff = time.Second
+	}
+	if maxBackoff == 0 {
+		maxBackoff = time.Minute
+	}
+	backoff := initialBackoff
+	for {
+		started := time.Now()
+		err := runComponent(s.ctx, run)
+		if s.ctx.Err() != nil || err == nil {
+			s.setState(name, ComponentStopped, nil)
+			return
+		}
+		if time.Since(started) > maxBackoff {
+			backoff = initialBackoff
+		}
+		s.log.Warnf("Background component %s failed, restarting in %v: %v\n", name, backoff, err)
+		s.setState(name, ComponentBackoff, err)
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-s.ctx.Done():
+			t.Stop()
+			s.setState(name, ComponentStopped, nil)
+			return
+		case <-t.C:
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		s.setState(name, ComponentRunning, nil)
+	}
+}
+
+// runComponent runs a component, turning a panic into an error
+func runComponent(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx)
+}
+
+func (s *Supervisor) setState(name string, state ComponentState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.components[name]
+	if state == ComponentRunning && h.State == ComponentBackoff {
+		h.Restarts++
+	}
+	h.State = state
+	h.Since = time.Now()
+	if err != nil {
+		h.LastError = err.Error()
+		h.LastErrorAt = h.Since
+	}
+}
+
+// Health returns the health of the components, ordered by name
+func (s *Supervisor) Health() []ComponentHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []ComponentHealth
+	for _, h := range s.components {
+		result = append(result, *h)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Healthy returns true if all components are running
+func (s *Supervisor) Healthy() bool {
+	return allRunning(s.Health())
+}
+
+func allRunning(health []ComponentHealth) bool {
+	for _, h := range health {
+		if h.State != ComponentRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// Stop stops all components, and waits for them to return until ctx is done
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Supervisor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	health := s.Health()
+	w.Header().Set("Content-Type", "application/json")
+	if allRunning(health) {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,60 @@
+package cosmos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervisor(t *testing.T) {
+	s := NewSupervisor(nil)
+	s.InitialBackoff = time.Millisecond
+	s.MaxBackoff = 10 * time.Millisecond
+
+	var runs int32
+	s.Go("flaky", func(ctx context.Context) error {
+		if atomic.AddInt32(&runs, 1) < 3 {
+			return errors.New("failed")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.Go("panicking", func(ctx context.Context) error {
+		panic("oops")
+	})
+	s.Go("done", func(ctx context.Context) error {
+		return nil
+	})
+
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&runs) < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	health := s.Health()
+	require.Len(t, health, 3)
+	assert.Equal(t, "done", health[0].Name)
+	assert.Equal(t, ComponentStopped, health[0].State)
+	assert.Equal(t, "flaky", health[1].Name)
+	assert.Equal(t, ComponentRunning, health[1].State)
+	assert.Equal(t, 2, health[1].Restarts)
+	assert.Equal(t, "failed", health[1].LastError)
+	assert.Equal(t, "panicking", health[2].Name)
+	assert.Equal(t, "panic: oops", health[2].LastError)
+	assert.False(t, s.Healthy())
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	require.NoError(t, s.Stop(context.Background()))
+	for _, h := range s.Health() {
+		assert.Equal(t, ComponentStopped, h.State)
+	}
+}
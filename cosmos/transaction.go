@@ -1,6 +1,9 @@
 package cosmos
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"reflect"
 	"time"
 
@@ -11,9 +14,27 @@ import (
 // Transaction is simply a wrapper around Session which unlocks some of
 // the methods that should only be called inside an idempotent closure
 type Transaction struct {
-	fetchedId uniqueKey // the id that was fetched in the single allowed Get()
-	toPut     Model     // the entity that was queued for put in the single allowed Put()
-	session   Session
+	fetched        map[uniqueKey]Model // the entities fetched by Get(), checked against those put in strict mode
+	partitionValue interface{}         // the partition value of the entities fetched; all must be in the same partition
+	writes         []transactionWrite  // the entities queued by Put() and Delete(), in order
+	toPut          Model               // the entity committed by commit() or commitDelete(), if a single one was queued
+	toDelete       bool                // set if toPut is to be deleted rather than written
+	owned          []Model             // the entities claimed by this transaction, see claimEntity
+	aliasingErr    error               // set if Put() was given an entity owned by another transaction
+	session        Session
+	lastResponse   cosmosapi.DocumentResponse
+	trace          *TransactionTrace // set if tracing is enabled
+	redacted       bool              // set if an entity fetched by Get() was redacted, see WithRedaction
+	requestUnits   float64           // the request units of the session when the transaction started
+	committing     bool              // set while the writes are committed
+	commitRetried  bool              // set if the client retried a request of the commit, see attempt
+}
+
+// transactionWrite is an entity queued by Put(), Delete() or Patch()
+type transactionWrite struct {
+	entity Model
+	kind   OperationKind              // OperationPut, OperationDelete or OperationPatch
+	patch  []cosmosapi.PatchOperation // for OperationPatch
 }
 
 var rollbackError = errors.New("__rollback__")
@@ -21,6 +42,12 @@ var rollbackError = errors.New("__rollback__")
 var ContentionError = errors.New("Contention error; optimistic concurrency control did not succeed after all the retries")
 var NotImplementedError = errors.New("Not implemented")
 var PutWithoutGetError = errors.New("Attempting to put an entity that has not been get first")
+var PatchNewEntityError = errors.New("Attempting to patch an entity that does not exist")
+
+// AmbiguousCommitError is returned by Transaction if the client retried the commit (e.g. after a 503) and it
+// then failed on its precondition; this may be because an earlier try was applied. Read the entities to
+// find out. cosmosapi.WriteOutcome classifies it as OutcomeAmbiguous.
+var AmbiguousCommitError = errors.New("Commit failed on its precondition after being retried, so an earlier try may have been applied")
 
 func Rollback() error {
 	return rollbackError
@@ -28,71 +55,164 @@ func Rollback() error {
 
 // Transaction <todo rest of docs>. Note: On commit, the Etag is updated on all relevant
 // entities (but normally these should never be used outside)
+//
+// Several entities can be fetched with Get and written with Put or Delete in the same transaction, as long as
+// they are all in the same partition. If more than one entity is written, they are committed atomically in a
+// single transactional batch; so either all of the writes are applied, or none of them. The batch always
+// replaces whole documents, regardless of the CommitMode of the session.
+//
+// The transaction is retried on contention only. If the commit fails in a way where the write may have
+// been applied (see cosmosapi.WriteOutcome), the error is returned rather than running the closure again,
+// as that would e.g. increment a counter twice. This includes a commit that the client retried and that
+// then failed on its precondition, for which AmbiguousCommitError is returned.
 func (session Session) Transaction(closure func(*Transaction) error) error {
 	session.state.mu.Lock()
 	defer session.state.mu.Unlock()
 	if session.ConflictRetries == 0 {
 		return errors.Errorf("Number of retries set to 0")
 	}
+	var trace *TransactionTrace
+	if session.trace {
+		trace = &TransactionTrace{Collection: session.Collection.Name}
+	}
+	err := session.transaction(closure, trace)
+	if err != nil && trace != nil {
+		return TransactionError{Err: err, Trace: trace}
+	}
+	return err
+}
+
+// TransactionContext is like Transaction, but does the requests of the transaction with ctx instead
+// of the context of the session
+func (session Session) TransactionContext(ctx context.Context, closure func(*Transaction) error) error {
+	return session.WithContext(ctx).Transaction(closure)
+}
+
+func (session Session) transaction(closure func(*Transaction) error, trace *TransactionTrace) error {
+	requestUnits := session.state.requestUnits
 	for i := 0; i != session.ConflictRetries; i++ {
-		txn := Transaction{session: session}
-
-		closureErr := closure(&txn)
-		if closureErr == nil && txn.toPut != nil {
-			putErr := txn.commit()
-			if errors.Cause(putErr) == cosmosapi.ErrPreconditionFailed {
-				// contention, loop around
-				time.Sleep(100 * time.Millisecond) // TODO: randomization; use scaled put walltime
-				continue
-			}
-			return putErr
-		} else {
-			// Implement Rollback() -- do not commit but do not return error either
-			if errors.Cause(closureErr) == rollbackError {
-				closureErr = nil
-			}
-			return closureErr
+		txn := Transaction{session: session, trace: trace, requestUnits: requestUnits}
+		if trace != nil {
+			trace.Attempts = i + 1
+		}
+		if retry, err := session.attempt(&txn, closure); !retry {
+			return err
 		}
 	}
 	return errors.WithStack(ContentionError)
 }
 
-func (txn *Transaction) commit() error {
+// attempt runs the closure and commits its writes; retry is true on contention
+func (session Session) attempt(txn *Transaction, closure func(*Transaction) error) (retry bool, err error) {
+	defer txn.releaseEntities()
+	closureErr := closure(txn)
+	if closureErr == nil {
+		closureErr = txn.aliasingErr
+	}
+	if closureErr == nil && len(txn.writes) > 0 {
+		// Each entity passes through the interceptors; if there are several, the batch is executed innermost
+		var operations []Operation
+		for _, write := range txn.writes {
+			base, partitionValue := session.Collection.GetEntityInfo(write.entity)
+			operations = append(operations, Operation{Kind: write.kind, PartitionKey: partitionValue, Id: base.Id, Entity: write.entity, Transaction: txn, Context: session.Context, batched: len(operations) > 0})
+		}
+		commit := txn.commitBatch
+		if write := txn.writes[0]; len(txn.writes) == 1 {
+			txn.toPut, txn.toDelete = write.entity, write.kind == OperationDelete
+			switch write.kind {
+			case OperationDelete:
+				commit = txn.commitDelete
+			case OperationPatch:
+				commit = func() error { return txn.commitPatch(write.patch) }
+			default:
+				commit = txn.commit
+			}
+		}
+		txn.committing = true
+		putErr := session.Collection.interceptAll(operations, commit)
+		txn.committing = false
+		if errors.Cause(putErr) == cosmosapi.ErrPreconditionFailed && txn.commitRetried {
+			// An earlier try of the commit may have been applied, and then the closure must not run again
+			return false, errors.WithStack(AmbiguousCommitError)
+		}
+		if errors.Cause(putErr) == cosmosapi.ErrPreconditionFailed {
+			// contention, loop around
+			time.Sleep(100 * time.Millisecond) // TODO: randomization; use scaled put walltime
+			return true, nil
+		}
+		return false, putErr
+	}
+	// Implement Rollback() -- do not commit but do not return error either
+	if errors.Cause(closureErr) == rollbackError {
+		closureErr = nil
+	}
+	return false, closureErr
+}
+
+func (txn *Transaction) commit() (err error) {
 	// Sanity check -- help the poor developer out by not allowing put without get
 	base, partitionValue := txn.session.Collection.GetEntityInfo(txn.toPut)
-	uk, err := newUniqueKey(partitionValue, base.Id)
-	if err != nil {
-		return err
+	var response cosmosapi.DocumentResponse
+	patched := false
+	if txn.trace != nil {
+		started := time.Now()
+		defer func() {
+			kind := OperationPut
+			if patched {
+				kind = OperationPatch
+			}
+			txn.traceEvent(kind, partitionValue, base.Id, "", base.Etag, txn.toPut, response, started, err)
+		}()
 	}
-	if uk != txn.fetchedId {
-		return errors.WithStack(PutWithoutGetError)
+	if err = txn.checkWrite(txn.toPut, partitionValue, base.Id); err != nil {
+		return err
 	}
 
-	if err = prePut(txn.toPut.(Model), txn); err != nil {
+	if err = txn.session.Collection.prePut(txn.toPut.(Model), txn); err != nil {
 		return err
 	}
 
 	// Execute the put
-	newBase, response, err := txn.session.Collection.put(txn.session.Context, txn.toPut, base, partitionValue, true)
-
-	// no matter what happened, if we got a session token we want to update to it
-	if response.SessionToken != "" {
-		txn.session.state.sessionToken = response.SessionToken
+	var newBase *cosmosapi.Resource
+	toCache := txn.toPut
+	if txn.session.CommitMode != CommitReplace && !base.IsNew() {
+		var result Model
+		result, response, patched, err = txn.patchCommit(base, partitionValue)
+		if err != nil && !patched {
+			return err
+		}
+		if err == nil && patched {
+			resource := cosmosapi.Resource(base)
+			if result != nil {
+				// Cache the document as returned by Cosmos, which may include changes made by others
+				toCache = result
+				resultBase, _ := txn.session.Collection.GetEntityInfo(result)
+				resource = cosmosapi.Resource(resultBase)
+			}
+			newBase = &resource
+		}
+	}
+	if !patched {
+		newBase, response, err = txn.session.Collection.put(txn.session.Context, txn.toPut, base, partitionValue, MatchCurrent)
 	}
 
+	txn.updateFromResponse(response)
+
 	if err == nil {
 		// Successful PUT, so
 		// a) update Etag on the entity (this intentionally affects callers copy if caller still has one, which should
 		//    not usually be the case..)
-		// below reflect is doing: txn.toPut.BaseModel = newBase
-		reflect.ValueOf(txn.toPut).Elem().FieldByName("BaseModel").Set(reflect.ValueOf(BaseModel(*newBase)))
+		basePtr, _, _ := txn.session.Collection.getEntityInfo(txn.toPut)
+		*basePtr = BaseModel(*newBase)
 
 		// b) add updated entity to the session's entity cache.
 		// If there is an error here it would be in JSON serialized; in that case panic, it should
 		// never happen since we just serialized in the same way above...
-		if jsonSerializationErr := txn.session.cacheSet(partitionValue, base.Id, txn.toPut); jsonSerializationErr != nil {
+		if jsonSerializationErr := txn.session.cacheSet(partitionValue, base.Id, toCache); jsonSerializationErr != nil {
 			panic(errors.Errorf("This should never happen: The entity successfully serialized to JSON the first time, but not the second ... %s", jsonSerializationErr))
 		}
+		// c) write through to the collection's entity cache, if any
+		txn.session.Collection.entityCacheWritten(partitionValue, base.Id, toCache)
 
 	} else if errors.Cause(err) == cosmosapi.ErrPreconditionFailed {
 		// We know that this object is staled, make sure to remove it from cache
@@ -103,26 +223,66 @@ func (txn *Transaction) commit() error {
 
 }
 
-func (txn *Transaction) Get(partitionValue interface{}, id string, target Model) (err error) {
+func (txn *Transaction) Get(partitionValue interface{}, id string, target Model) error {
+	op := Operation{Kind: OperationGet, PartitionKey: partitionValue, Id: id, Entity: target, Transaction: txn, Context: txn.session.Context}
+	return txn.session.Collection.intercept(op, func() error {
+		return txn.get(partitionValue, id, target)
+	})
+}
+
+func (txn *Transaction) get(partitionValue interface{}, id string, target Model) (err error) {
+	var source string
+	var response cosmosapi.DocumentResponse
+	if txn.trace != nil {
+		started := time.Now()
+		defer func() {
+			var etag string
+			if base, _, infoErr := txn.session.Collection.getEntityInfo(target); infoErr == nil {
+				etag = base.Etag
+			}
+			txn.traceEvent(OperationGet, partitionValue, id, source, etag, target, response, started, err)
+		}()
+	}
+	if err = txn.claimEntity(target); err != nil {
+		return err
+	}
 	uk, err := newUniqueKey(partitionValue, id)
 	if err != nil {
 		return err
 	}
-	if txn.fetchedId != "" && txn.fetchedId != uk {
-		return errors.Wrap(NotImplementedError, "Fetching more than one entity in transaction not supported yet")
+	if len(txn.fetched) > 0 && !samePartitionValue(txn.partitionValue, partitionValue) {
+		return errors.Wrap(NotImplementedError, "Fetching entities of more than one partition in a transaction not supported")
 	}
 
+	if txn.session.copyOnRead {
+		resetEntity(target)
+	}
 	var found bool
 	found, err = txn.session.cacheGet(partitionValue, id, target)
 	if err != nil {
 		// Trouble in JSON deserialization from cache; a bug in deserialization hooks or similar... return it
 		return err
 	}
-	if found {
+	if found && txn.session.RevalidateCache && !target.IsNew() {
+		// cacheGet unserialized to target; check with Cosmos whether it is still current
+		source = TraceSourceRevalidated
+		var modified bool
+		response, modified, err = txn.session.Collection.revalidate(
+			txn.session.Context,
+			partitionValue,
+			id,
+			target,
+			txn.session.Token())
+		txn.updateFromResponse(response)
+		if err == nil && modified && !txn.session.copyOnRead {
+			err = txn.session.cacheSet(partitionValue, id, target)
+		}
+	} else if found {
 		// do nothing, cacheGet already unserialized to target
+		source = TraceSourceCache
 	} else {
 		// post-get hook will be done by Collection.get()
-		var response cosmosapi.DocumentResponse
+		source = TraceSourceDatabase
 		response, err = txn.session.Collection.get(
 			txn.session.Context,
 			partitionValue,
@@ -130,21 +290,190 @@ func (txn *Transaction) Get(partitionValue interface{}, id string, target Model)
 			target,
 			cosmosapi.ConsistencyLevelSession,
 			txn.session.Token())
-		if response.SessionToken != "" {
-			txn.session.state.sessionToken = response.SessionToken
-		}
-		if err == nil {
+		txn.updateFromResponse(response)
+		if err == nil && !txn.session.copyOnRead {
 			err = txn.session.cacheSet(partitionValue, id, target)
 		}
 	}
 
 	if err == nil {
-		txn.fetchedId = uk
-		err = postGet(target, txn)
+		if txn.fetched == nil {
+			txn.fetched = make(map[uniqueKey]Model)
+		}
+		txn.fetched[uk] = target
+		txn.partitionValue = partitionValue
+		err = txn.session.Collection.postGet(target, txn)
 	}
 	return
 }
 
+// LastResponse returns the response of the last request made to Cosmos within the transaction, or an empty
+// response if no requests have been made (e.g. Get() was served from the session cache).
+// The response of the commit is available through Session.LastResponse() after the transaction returns.
+func (txn *Transaction) LastResponse() cosmosapi.DocumentResponse {
+	return txn.lastResponse
+}
+
+// RequestUnits returns the total request charge (RUs) of the requests made by the transaction so far, across
+// all its attempts
+func (txn *Transaction) RequestUnits() float64 {
+	return txn.session.state.requestUnits - txn.requestUnits
+}
+
+func (txn *Transaction) updateFromResponse(response cosmosapi.DocumentResponse) {
+	if txn.committing && response.RetryCount > 0 {
+		txn.commitRetried = true
+	}
+	txn.lastResponse = response
+	txn.session.updateFromResponse(response)
+}
+
+// Put queues the entity to be written on commit. The entity must have been fetched with Get in the
+// transaction. Putting an entity with the same id as one already queued replaces it in the queue.
 func (txn *Transaction) Put(entityPtr Model) {
-	txn.toPut = entityPtr
+	txn.queue(transactionWrite{entity: entityPtr, kind: OperationPut})
+}
+
+func (txn *Transaction) queue(write transactionWrite) {
+	if err := txn.claimEntity(write.entity); err != nil && txn.aliasingErr == nil {
+		txn.aliasingErr = err
+	}
+	base, _ := txn.session.Collection.GetEntityInfo(write.entity)
+	for i, queued := range txn.writes {
+		if queuedBase, _ := txn.session.Collection.GetEntityInfo(queued.entity); queued.entity == write.entity || queuedBase.Id == base.Id {
+			txn.writes[i] = write
+			return
+		}
+	}
+	txn.writes = append(txn.writes, write)
+}
+
+// checkWrite returns an error if the entity can not be written by the transaction, because it was not
+// fetched with Get, or in strict mode is not the very entity that was
+func (txn *Transaction) checkWrite(entityPtr Model, partitionValue interface{}, id string) error {
+	uk, err := newUniqueKey(partitionValue, id)
+	if err != nil {
+		return err
+	}
+	fetched, ok := txn.fetched[uk]
+	if !ok {
+		return errors.WithStack(PutWithoutGetError)
+	}
+	return txn.checkStrict(entityPtr, fetched, partitionValue, id)
+}
+
+// Delete queues the entity for deletion on commit, instead of a Put. As with Put, the entity must have
+// been fetched with Get in the transaction. The delete is conditional on the etag that was read, so
+// that the transaction is retried if the document was changed in the meantime. An entity that did not
+// exist when it was read is not deleted. On success, the entity is removed from the session and entity
+// caches, and its etag is cleared. The Client of the collection must implement DocumentDeleter.
+func (txn *Transaction) Delete(entityPtr Model) {
+	txn.queue(transactionWrite{entity: entityPtr, kind: OperationDelete})
+}
+
+func (txn *Transaction) commitDelete() (err error) {
+	base, partitionValue := txn.session.Collection.GetEntityInfo(txn.toPut)
+	var response cosmosapi.DocumentResponse
+	if txn.trace != nil {
+		started := time.Now()
+		defer func() {
+			txn.traceEvent(OperationDelete, partitionValue, base.Id, "", base.Etag, txn.toPut, response, started, err)
+		}()
+	}
+	if err = txn.checkWrite(txn.toPut, partitionValue, base.Id); err != nil {
+		return err
+	}
+
+	c := txn.session.Collection
+	if !base.IsNew() {
+		opts := cosmosapi.DeleteDocumentOptions{
+			PartitionKeyValue: partitionValue,
+			IfMatch:           base.Etag,
+		}
+		response, err = c.deleteDocument(txn.session.Context, base.Id, opts)
+		txn.updateFromResponse(response)
+		if errors.Cause(err) == cosmosapi.ErrNotFound {
+			// Deleted by someone else since it was read, which is what we wanted
+			err = nil
+		}
+	}
+	// Whether or not the delete succeeded, the cached versions can no longer be trusted
+	txn.session.drop(partitionValue, base.Id)
+	c.entityCacheDelete(partitionValue, base.Id)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("id='%s' partitionValue='%v'", base.Id, partitionValue))
+	}
+	basePtr, _, _ := c.getEntityInfo(txn.toPut)
+	basePtr.Etag = ""
+	return nil
+}
+
+// Patch queues a partial update of the entity on commit, instead of a Put, so that a small change does not
+// require writing the whole document. As with Put, the entity must have been fetched with Get in the
+// transaction, and the patch is conditional on the etag that was read, so that the transaction is retried
+// if the document was changed in the meantime. The operations are applied by Cosmos, not to the entity in
+// memory; on success, the entity is updated with the patched document (and the post-get hook is called).
+// The pre-put hook is not called, as the entity is not written. The entity must exist. Without operations,
+// Patch does nothing.
+func (txn *Transaction) Patch(entityPtr Model, operations ...cosmosapi.PatchOperation) {
+	if len(operations) == 0 {
+		return
+	}
+	txn.queue(transactionWrite{entity: entityPtr, kind: OperationPatch, patch: operations})
+}
+
+func (txn *Transaction) commitPatch(operations []cosmosapi.PatchOperation) (err error) {
+	base, partitionValue := txn.session.Collection.GetEntityInfo(txn.toPut)
+	var response cosmosapi.DocumentResponse
+	if txn.trace != nil {
+		started := time.Now()
+		defer func() {
+			txn.traceEvent(OperationPatch, partitionValue, base.Id, "", base.Etag, txn.toPut, response, started, err)
+		}()
+	}
+	if err = txn.checkWrite(txn.toPut, partitionValue, base.Id); err != nil {
+		return err
+	}
+	if base.IsNew() {
+		return errors.Wrap(PatchNewEntityError, fmt.Sprintf("id='%s' partitionValue='%v'", base.Id, partitionValue))
+	}
+
+	c := txn.session.Collection
+	opts := cosmosapi.PatchDocumentOptions{
+		PartitionKeyValue: partitionValue,
+		IfMatch:           base.Etag,
+		SessionToken:      txn.session.Token(),
+	}
+	var patched json.RawMessage
+	response, err = c.patchDocument(txn.session.Context, base.Id, operations, opts, &patched)
+	txn.updateFromResponse(response)
+	if err != nil {
+		// The document may have been changed since it was read, so the cached versions can not be trusted
+		txn.session.drop(partitionValue, base.Id)
+		c.entityCacheDelete(partitionValue, base.Id)
+		return errors.Wrap(err, fmt.Sprintf("id='%s' partitionValue='%v'", base.Id, partitionValue))
+	}
+	if err = txn.setPatched(txn.toPut, patched); err != nil {
+		return err
+	}
+	if err = txn.session.cacheSet(partitionValue, base.Id, txn.toPut); err != nil {
+		return err
+	}
+	c.entityCacheWritten(partitionValue, base.Id, txn.toPut)
+	return nil
+}
+
+// setPatched sets the entity to the patched document returned by Cosmos, and calls the post-get hook
+func (txn *Transaction) setPatched(entityPtr Model, document json.RawMessage) error {
+	c := txn.session.Collection
+	result := reflect.New(reflect.TypeOf(entityPtr).Elem())
+	out, unmarshal := c.adaptedOut(result.Interface())
+	if err := json.Unmarshal(document, out); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := unmarshal(); err != nil {
+		return err
+	}
+	reflect.ValueOf(entityPtr).Elem().Set(result.Elem())
+	return c.postGet(entityPtr, txn)
 }
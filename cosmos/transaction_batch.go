@@ -0,0 +1,152 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// commitBatch commits the entities queued by the transaction, which are all in the partition of the entities
+// fetched, in a single transactional batch; so either all of them are written or deleted, or none are.
+// As for a single entity, new entities are created, others replaced on the condition that their etag is
+// still the one that was read, and entities that did not exist when read are not deleted.
+func (txn *Transaction) commitBatch() (err error) {
+	c := txn.session.Collection
+	var batch []cosmosapi.BatchOperation
+	var writes []transactionWrite // the writes in batch, in the same order
+	var etags []string            // the etags the entities in batch were read with
+	for _, write := range txn.writes {
+		base, partitionValue := c.GetEntityInfo(write.entity)
+		if err = txn.checkWrite(write.entity, partitionValue, base.Id); err != nil {
+			return err
+		}
+		switch {
+		case write.kind == OperationDelete && base.IsNew():
+			// Nothing to delete, but the cached versions are dropped below
+			txn.session.drop(partitionValue, base.Id)
+			c.entityCacheDelete(partitionValue, base.Id)
+			continue
+		case write.kind == OperationDelete:
+			batch = append(batch, cosmosapi.BatchOperation{OperationType: cosmosapi.BatchDelete, Id: base.Id, IfMatch: base.Etag})
+		case write.kind == OperationPatch:
+			if base.IsNew() {
+				return errors.Wrap(PatchNewEntityError, fmt.Sprintf("id='%s' partitionValue='%v'", base.Id, partitionValue))
+			}
+			body := cosmosapi.BatchPatchBody{Operations: write.patch}
+			batch = append(batch, cosmosapi.BatchOperation{OperationType: cosmosapi.BatchPatch, Id: base.Id, ResourceBody: body, IfMatch: base.Etag})
+		default:
+			if err = c.prePut(write.entity, txn); err != nil {
+				return err
+			}
+			batch = append(batch, putBatchOperation(base, write.entity))
+		}
+		writes = append(writes, write)
+		etags = append(etags, base.Etag)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	started := time.Now()
+	response, err := c.executeWriteBatch(txn.session.Context, txn.partitionValue, batch)
+	txn.updateFromResponse(response.DocumentResponse)
+	if txn.trace != nil {
+		for i, write := range writes {
+			resultResponse := cosmosapi.DocumentResponse{ActivityId: response.ActivityId}
+			if i < len(response.Results) {
+				resultResponse.StatusCode = response.Results[i].StatusCode
+				resultResponse.RUs = response.Results[i].RequestCharge
+			}
+			base, partitionValue := c.GetEntityInfo(write.entity)
+			txn.traceEvent(write.kind, partitionValue, base.Id, "", etags[i], write.entity, resultResponse, started, err)
+		}
+	}
+	if err != nil {
+		if errors.Cause(err) == cosmosapi.ErrPreconditionFailed {
+			// We do not know which of the entities are stale, so remove all of them from the cache
+			for _, write := range writes {
+				base, partitionValue := c.GetEntityInfo(write.entity)
+				txn.session.drop(partitionValue, base.Id)
+			}
+		}
+		return errors.WithStack(err)
+	}
+	if len(response.Results) != len(batch) {
+		return errors.Errorf("The batch of %d operations returned %d results", len(batch), len(response.Results))
+	}
+
+	for i, write := range writes {
+		basePtr, partitionValue, _ := c.getEntityInfo(write.entity)
+		if write.kind == OperationDelete {
+			txn.session.drop(partitionValue, basePtr.Id)
+			c.entityCacheDelete(partitionValue, basePtr.Id)
+			basePtr.Etag = ""
+			continue
+		}
+		// Update the Etag on the entity, as for a single put
+		result := response.Results[i]
+		switch {
+		case write.kind == OperationPatch && len(result.ResourceBody) == 0:
+			// The patched document is not known, so the cached versions can no longer be trusted
+			basePtr.Etag = result.Etag
+			txn.session.drop(partitionValue, basePtr.Id)
+			c.entityCacheDelete(partitionValue, basePtr.Id)
+			continue
+		case write.kind == OperationPatch:
+			if err = txn.setPatched(write.entity, result.ResourceBody); err != nil {
+				return err
+			}
+		default:
+			if err = setBatchResult(basePtr, result); err != nil {
+				return err
+			}
+		}
+		if err = txn.session.cacheSet(partitionValue, basePtr.Id, write.entity); err != nil {
+			return err
+		}
+		c.entityCacheWritten(partitionValue, basePtr.Id, write.entity)
+	}
+	return nil
+}
+
+// putBatchOperation returns the batch operation writing entity: a create if it is new, and otherwise a
+// replace on the condition that its etag is still the one that was read
+func putBatchOperation(base BaseModel, entity Model) cosmosapi.BatchOperation {
+	if base.IsNew() {
+		return cosmosapi.BatchOperation{OperationType: cosmosapi.BatchCreate, ResourceBody: entity}
+	}
+	return cosmosapi.BatchOperation{OperationType: cosmosapi.BatchReplace, Id: base.Id, ResourceBody: entity, IfMatch: base.Etag}
+}
+
+// executeWriteBatch executes a transactional batch of writes in the partition partitionValue. As for single
+// entities, creating an entity that already exists is contention; and so is deleting one that has been
+// deleted since it was read, as the whole batch is rolled back. Both fail with cosmosapi.ErrPreconditionFailed.
+func (c Collection) executeWriteBatch(ctx context.Context, partitionValue interface{}, batch []cosmosapi.BatchOperation) (cosmosapi.BatchResponse, error) {
+	response, err := c.executeBatch(ctx, batch, cosmosapi.BatchOptions{PartitionKeyValue: partitionValue})
+	if batchErr, ok := err.(cosmosapi.BatchError); ok {
+		deleted := batchErr.Index < len(batch) && batch[batchErr.Index].OperationType == cosmosapi.BatchDelete
+		if batchErr.Err == cosmosapi.ErrConflict || (batchErr.Err == cosmosapi.ErrNotFound && deleted) {
+			batchErr.Err = cosmosapi.ErrPreconditionFailed
+			err = batchErr
+		}
+	}
+	return response, err
+}
+
+// setBatchResult updates the BaseModel of an entity that was created or replaced in a batch
+func setBatchResult(base *BaseModel, result cosmosapi.BatchOperationResult) error {
+	if len(result.ResourceBody) == 0 {
+		base.Etag = result.Etag
+		return nil
+	}
+	var resource cosmosapi.Resource
+	if err := json.Unmarshal(result.ResourceBody, &resource); err != nil {
+		return errors.WithStack(err)
+	}
+	*base = BaseModel(resource)
+	return nil
+}
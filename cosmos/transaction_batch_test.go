@@ -0,0 +1,182 @@
+package cosmos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// mockCosmosEtagsBatch executes transactional batches atomically against the documents of mockCosmosEtags
+type mockCosmosEtagsBatch struct {
+	mockCosmosEtags
+	Batches [][]cosmosapi.BatchOperation
+}
+
+func (mock *mockCosmosEtagsBatch) ExecuteBatch(ctx context.Context, dbName, colName string,
+	operations []cosmosapi.BatchOperation, ops cosmosapi.BatchOptions) (cosmosapi.BatchResponse, error) {
+	if ops.PartitionKeyValue != "u" {
+		panic("assertion failed")
+	}
+	mock.Batches = append(mock.Batches, operations)
+	if mock.ConcurrentWrites > 0 {
+		mock.ConcurrentWrites--
+		existing := mock.Documents[operations[0].Id]
+		data, _ := json.Marshal(existing)
+		mock.write(operations[0].Id, data)
+	}
+	bodies := make([][]byte, len(operations))
+	for i, op := range operations {
+		bodies[i], _ = json.Marshal(op.ResourceBody)
+		existing, exists := mock.Documents[op.Id]
+		status := http.StatusOK
+		switch {
+		case op.OperationType == cosmosapi.BatchCreate:
+			var m map[string]interface{}
+			_ = json.Unmarshal(bodies[i], &m)
+			if _, exists := mock.Documents[m["id"].(string)]; exists {
+				status = http.StatusConflict
+			}
+		case !exists:
+			status = http.StatusNotFound
+		case existing["_etag"] != op.IfMatch:
+			status = http.StatusPreconditionFailed
+		}
+		if status != http.StatusOK {
+			return cosmosapi.BatchResponse{}, cosmosapi.BatchError{Index: i, StatusCode: status, Err: cosmosapi.CosmosHTTPErrors[status]}
+		}
+	}
+	var response cosmosapi.BatchResponse
+	for i, op := range operations {
+		switch op.OperationType {
+		case cosmosapi.BatchDelete:
+			delete(mock.Documents, op.Id)
+			response.Results = append(response.Results, cosmosapi.BatchOperationResult{StatusCode: http.StatusNoContent})
+			continue
+		case cosmosapi.BatchPatch:
+			// Top-level sets only
+			patched := mock.Documents[op.Id]
+			for _, patchOp := range op.ResourceBody.(cosmosapi.BatchPatchBody).Operations {
+				patched[patchOp.Path[1:]] = patchOp.Value
+			}
+			bodies[i], _ = json.Marshal(patched)
+		}
+		var m map[string]interface{}
+		_ = json.Unmarshal(bodies[i], &m)
+		resource, _, _ := mock.write(m["id"].(string), bodies[i])
+		response.Results = append(response.Results, cosmosapi.BatchOperationResult{StatusCode: http.StatusOK, Etag: resource.Etag})
+	}
+	return response, nil
+}
+
+func (mock *mockCosmosEtagsBatch) ReplaceDocument(ctx context.Context,
+	dbName, colName, id string, doc interface{}, ops cosmosapi.ReplaceDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	data, _ := json.Marshal(doc)
+	return mock.mockCosmosEtags.ReplaceDocument(ctx, dbName, colName, id, data, ops)
+}
+
+func TestTransactionBatch(t *testing.T) {
+	mock := mockCosmosEtagsBatch{mockCosmosEtags: mockCosmosEtags{Documents: make(map[string]map[string]interface{})}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	for _, id := range []string{"a", "b"} {
+		data, _ := json.Marshal(MyModel{BaseModel: BaseModel{Id: id}, UserId: "u", X: 1})
+		mock.write(id, data)
+	}
+
+	// Several writes in the same partition are committed in one batch
+	session := c.Session()
+	var a, b, n MyModel
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("u", "a", &a))
+		require.NoError(t, txn.Get("u", "b", &b))
+		require.NoError(t, txn.Get("u", "n", &n))
+		a.X = 2
+		txn.Put(&a)
+		txn.Put(&n)
+		txn.Delete(&b)
+		return nil
+	}))
+	require.Len(t, mock.Batches, 1)
+	require.Equal(t, []cosmosapi.BatchOperationType{cosmosapi.BatchReplace, cosmosapi.BatchCreate, cosmosapi.BatchDelete},
+		[]cosmosapi.BatchOperationType{mock.Batches[0][0].OperationType, mock.Batches[0][1].OperationType, mock.Batches[0][2].OperationType})
+	require.Equal(t, "etag-1", mock.Batches[0][0].IfMatch)
+	require.Equal(t, "etag-3", a.Etag)
+	require.Equal(t, "etag-4", n.Etag)
+	require.Equal(t, "", b.Etag)
+	require.Equal(t, 2.0, mock.Documents["a"]["x"])
+	require.Equal(t, "set by pre-put, checked in mock", mock.Documents["n"]["setByPrePut"])
+	require.NotContains(t, mock.Documents, "b")
+
+	// On contention nothing is written, and the transaction is retried
+	mock.ConcurrentWrites = 1
+	attempts := 0
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		attempts++
+		require.NoError(t, txn.Get("u", "a", &a))
+		require.NoError(t, txn.Get("u", "n", &n))
+		a.X, n.X = a.X+1, n.X+1
+		txn.Put(&a)
+		txn.Put(&n)
+		return nil
+	}))
+	require.Equal(t, 2, attempts)
+	require.Len(t, mock.Batches, 3)
+	require.Equal(t, 3.0, mock.Documents["a"]["x"])
+	require.Equal(t, 1.0, mock.Documents["n"]["x"])
+
+	// A single write does not use a batch
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("u", "a", &a))
+		a.X = 10
+		txn.Put(&a)
+		return nil
+	}))
+	require.Len(t, mock.Batches, 3)
+	require.Equal(t, 10.0, mock.Documents["a"]["x"])
+
+	// Patches are batched too, and the entity is updated with the patched document
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("u", "a", &a))
+		require.NoError(t, txn.Get("u", "n", &n))
+		txn.Patch(&a, cosmosapi.PatchSet("/setByPrePut", "patched"))
+		n.X = 20
+		txn.Put(&n)
+		return nil
+	}))
+	require.Len(t, mock.Batches, 4)
+	require.Equal(t, cosmosapi.BatchPatch, mock.Batches[3][0].OperationType)
+	require.Equal(t, "patched", mock.Documents["a"]["setByPrePut"])
+	require.Equal(t, 20.0, mock.Documents["n"]["x"])
+
+	// Entities that do not exist can not be patched
+	err := session.Transaction(func(txn *Transaction) error {
+		var missing MyModel
+		require.NoError(t, txn.Get("u", "missing", &missing))
+		txn.Patch(&missing, cosmosapi.PatchSet("/x", 1))
+		return nil
+	})
+	require.Equal(t, PatchNewEntityError, errors.Cause(err))
+
+	// A patch without operations writes nothing, so only the put is committed, without a batch
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("u", "a", &a))
+		require.NoError(t, txn.Get("u", "n", &n))
+		txn.Patch(&a)
+		n.X = 30
+		txn.Put(&n)
+		return nil
+	}))
+	require.Len(t, mock.Batches, 4)
+	require.Equal(t, 30.0, mock.Documents["n"]["x"])
+
+	// The entities must be in the same partition
+	err = session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("u", "a", &a))
+		return txn.Get("other", "a", &b)
+	})
+	require.Equal(t, NotImplementedError, errors.Cause(err))
+}
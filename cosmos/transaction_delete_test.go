@@ -0,0 +1,80 @@
+package cosmos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosDelete struct {
+	mockCosmos
+	DeleteErrors []error
+	GotIfMatch   []string
+}
+
+func (mock *mockCosmosDelete) DeleteDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.DeleteDocumentOptions) (cosmosapi.DocumentResponse, error) {
+	mock.GotMethod = "delete"
+	mock.GotId = id
+	mock.GotPartitionKey = ops.PartitionKeyValue
+	mock.GotIfMatch = append(mock.GotIfMatch, ops.IfMatch)
+	var err error
+	if len(mock.DeleteErrors) > 0 {
+		err, mock.DeleteErrors = mock.DeleteErrors[0], mock.DeleteErrors[1:]
+	}
+	return cosmosapi.DocumentResponse{SessionToken: mock.ReturnSession}, err
+}
+
+func TestTransactionDelete(t *testing.T) {
+	mock := mockCosmosDelete{mockCosmos: mockCosmos{ReturnUserId: "partitionvalue", ReturnEtag: "etag-1"}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	session := c.Session()
+
+	// The first delete loses a race and is retried with a freshly read etag
+	mock.DeleteErrors = []error{cosmosapi.ErrPreconditionFailed}
+	var entity MyModel
+	attempts := 0
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		attempts++
+		if attempts == 2 {
+			mock.ReturnEtag = "etag-2"
+		}
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Delete(&entity)
+		return nil
+	}))
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, "delete", mock.GotMethod)
+	assert.Equal(t, "idvalue", mock.GotId)
+	assert.Equal(t, "partitionvalue", mock.GotPartitionKey)
+	assert.Equal(t, []string{"etag-1", "etag-2"}, mock.GotIfMatch)
+	assert.Equal(t, "", entity.Etag)
+
+	// The deleted entity is no longer in the session cache, so it is fetched again
+	mock.GotMethod = ""
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		return txn.Get("partitionvalue", "idvalue", &entity)
+	}))
+	assert.Equal(t, "get", mock.GotMethod)
+
+	// Documents deleted by someone else count as deleted
+	mock.DeleteErrors = []error{cosmosapi.ErrNotFound}
+	require.NoError(t, session.Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Delete(&entity)
+		return nil
+	}))
+
+	// Read-only collections reject deletes
+	mock.GotMethod = ""
+	err := c.ReadOnly().Session().Transaction(func(txn *Transaction) error {
+		require.NoError(t, txn.Get("partitionvalue", "idvalue", &entity))
+		txn.Delete(&entity)
+		return nil
+	})
+	assert.Equal(t, cosmosapi.ErrReadOnly, errors.Cause(err))
+	assert.Equal(t, "get", mock.GotMethod)
+}
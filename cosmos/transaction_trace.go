@@ -0,0 +1,116 @@
+package cosmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// Sources of the entity in a TraceEvent for a get
+const (
+	TraceSourceCache       = "cache"
+	TraceSourceRevalidated = "revalidated"
+	TraceSourceDatabase    = "database"
+)
+
+// TransactionTrace records what a transaction did, across all its attempts. See Session.WithTransactionTrace.
+type TransactionTrace struct {
+	Collection string       `json:"collection"`
+	Attempts   int          `json:"attempts"`
+	Events     []TraceEvent `json:"events"`
+}
+
+// TraceEvent is a Get or a commit done by a transaction
+type TraceEvent struct {
+	// Attempt is the number of the attempt, starting at 1; a transaction is retried on contention
+	Attempt        int           `json:"attempt"`
+	Kind           OperationKind `json:"kind"`
+	PartitionValue interface{}   `json:"partitionValue"`
+	Id             string        `json:"id"`
+	// Source is where a get found the entity, one of the TraceSource constants
+	Source string `json:"source,omitempty"`
+	// Etag is the etag of the entity after the get, or the etag a commit was conditional on
+	Etag string `json:"etag,omitempty"`
+	// Size is the size of the serialized entity in bytes
+	Size          int           `json:"size"`
+	StatusCode    int           `json:"statusCode,omitempty"`
+	RequestCharge float64       `json:"requestCharge,omitempty"`
+	ActivityId    string        `json:"activityId,omitempty"`
+	Duration      time.Duration `json:"duration"`
+	Error         string        `json:"error,omitempty"`
+	// Document is the serialized entity found by a get; only included if requested, see
+	// WithTransactionTraceDocuments
+	Document json.RawMessage `json:"document,omitempty"`
+}
+
+// TransactionError is returned by Session.Transaction on failure when tracing is enabled. The underlying error
+// is available with errors.Cause.
+type TransactionError struct {
+	Err   error
+	Trace *TransactionTrace
+}
+
+func (e TransactionError) Error() string {
+	trace, _ := json.Marshal(e.Trace)
+	return fmt.Sprintf("%v (transaction trace: %s)", e.Err, trace)
+}
+
+func (e TransactionError) Cause() error {
+	return e.Err
+}
+
+func (e TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// WithTransactionTrace returns a session where transactions record every Get and commit (keys, etags, sizes and
+// outcomes) in a TransactionTrace. If a transaction fails, its error is wrapped in a TransactionError holding
+// the trace, so that it can be understood from a single log entry. Since every entity is serialized an extra
+// time to find its size, use it for debugging rather than by default.
+func (session Session) WithTransactionTrace() Session {
+	session.trace = true // note: non-pointer receiver
+	return session
+}
+
+// WithTransactionTraceDocuments is like WithTransactionTrace, but the trace also includes the documents found
+// by every Get, so that a failed transaction can be re-executed locally with cosmostest.ReplayTransaction. Leave
+// it unset in production unless needed, as the documents may contain personal data.
+func (session Session) WithTransactionTraceDocuments() Session {
+	session.trace = true // note: non-pointer receiver
+	session.traceDocuments = true
+	return session
+}
+
+// traceEvent records an event, if tracing is enabled
+func (txn *Transaction) traceEvent(kind OperationKind, partitionValue interface{}, id, source, etag string, entity Model,
+	response cosmosapi.DocumentResponse, started time.Time, err error) {
+	if txn.trace == nil {
+		return
+	}
+	event := TraceEvent{
+		Attempt:        txn.trace.Attempts,
+		Kind:           kind,
+		PartitionValue: partitionValue,
+		Id:             id,
+		Source:         source,
+		Etag:           etag,
+		StatusCode:     response.StatusCode,
+		RequestCharge:  response.RUs,
+		ActivityId:     response.ActivityId,
+		Duration:       time.Since(started),
+	}
+	if entity != nil && !entity.IsNew() {
+		if serialized, marshalErr := json.Marshal(entity); marshalErr == nil {
+			event.Size = len(serialized)
+			if kind == OperationGet && txn.session.traceDocuments {
+				event.Document = json.RawMessage(serialized)
+			}
+		}
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	txn.trace.Events = append(txn.trace.Events, event)
+}
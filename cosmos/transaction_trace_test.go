@@ -0,0 +1,62 @@
+package cosmos
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestTransactionTrace(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "u", ReturnEtag: "etag-1", ReturnX: 1}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	session := c.Session().WithRetries(2).WithTransactionTrace()
+
+	err := session.Transaction(func(txn *Transaction) error {
+		var entity MyModel
+		if err := txn.Get("u", "a", &entity); err != nil {
+			return err
+		}
+		// The commit fails, and so does the get of the next attempt
+		mock.ReturnError = cosmosapi.ErrPreconditionFailed
+		txn.Put(&entity)
+		return nil
+	})
+	require.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+	txnErr, ok := err.(TransactionError)
+	require.True(t, ok)
+	trace := txnErr.Trace
+	require.Equal(t, "mycollection", trace.Collection)
+	require.Equal(t, 2, trace.Attempts)
+	require.Len(t, trace.Events, 3)
+
+	get := trace.Events[0]
+	require.Equal(t, 1, get.Attempt)
+	require.Equal(t, OperationGet, get.Kind)
+	require.Equal(t, "a", get.Id)
+	require.Equal(t, "u", get.PartitionValue)
+	require.Equal(t, TraceSourceDatabase, get.Source)
+	require.Equal(t, "etag-1", get.Etag)
+	require.True(t, get.Size > 0)
+	require.Nil(t, get.Document) // only with WithTransactionTraceDocuments
+	require.Empty(t, get.Error)
+
+	put := trace.Events[1]
+	require.Equal(t, OperationPut, put.Kind)
+	require.Equal(t, "etag-1", put.Etag)
+	require.Equal(t, cosmosapi.ErrPreconditionFailed.Error(), put.Error)
+
+	require.Equal(t, 2, trace.Events[2].Attempt)
+	require.Equal(t, OperationGet, trace.Events[2].Kind)
+	require.Contains(t, err.Error(), `"source":"database"`)
+
+	// Without tracing, errors are not wrapped
+	err = c.Session().Transaction(func(txn *Transaction) error {
+		var entity MyModel
+		return txn.Get("u", "a", &entity)
+	})
+	require.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+	_, ok = err.(TransactionError)
+	require.False(t, ok)
+}
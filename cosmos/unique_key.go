@@ -2,6 +2,8 @@ package cosmos
 
 import (
 	"encoding/json"
+	"unicode/utf8"
+
 	"github.com/pkg/errors"
 )
 
@@ -9,9 +11,18 @@ import (
 // identifier, such as caching, `uniqueKey` can be used.
 // Documents also have the _rid property which is also globally unique, but not always practical to use as it requires
 // fetching an existing document.
+//
+// The key is the JSON array [partitionKeyValue, id], so separators or other special characters in either can not
+// make two keys collide. Strings that are not valid UTF-8 are rejected, as JSON would replace the invalid bytes.
 type uniqueKey string
 
 func newUniqueKey(partitionKeyValue interface{}, id string) (uniqueKey, error) {
+	if !utf8.ValidString(id) {
+		return "", errors.Errorf("Document id %q is not valid UTF-8", id)
+	}
+	if s, ok := partitionKeyValue.(string); ok && !utf8.ValidString(s) {
+		return "", errors.Errorf("Partition key value %q is not valid UTF-8", s)
+	}
 	// Use JSON for the cache key to match how Cosmos represents values
 	d, err := json.Marshal([]interface{}{partitionKeyValue, id})
 	if err != nil {
@@ -19,3 +30,14 @@ func newUniqueKey(partitionKeyValue interface{}, id string) (uniqueKey, error) {
 	}
 	return uniqueKey(d), nil
 }
+
+// samePartitionValue compares partition key values as Cosmos does; i.e. numbers are equal if they have the
+// same value, regardless of their Go type
+func samePartitionValue(a, b interface{}) bool {
+	if a == b {
+		return true
+	}
+	keyA, errA := newUniqueKey(a, "")
+	keyB, errB := newUniqueKey(b, "")
+	return errA == nil && errB == nil && keyA == keyB
+}
@@ -0,0 +1,32 @@
+//go:build go1.18
+// +build go1.18
+
+package cosmos
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzUniqueKey(f *testing.F) {
+	f.Add("a", "b/c", "a/b", "c")
+	f.Add(`a","`, "b", "a", `","b`)
+	f.Add("æøå", "🙂", "æøå", "🙂x")
+	c := Collection{DbName: "mydb", Name: "mycollection"}
+	f.Fuzz(func(t *testing.T, pv1, id1, pv2, id2 string) {
+		key1, err1 := c.entityCacheKey(pv1, id1)
+		key2, err2 := c.entityCacheKey(pv2, id2)
+		if (err1 == nil) != (utf8.ValidString(pv1) && utf8.ValidString(id1)) {
+			t.Fatalf("unexpected error for %q, %q: %v", pv1, id1, err1)
+		}
+		if err1 != nil || err2 != nil {
+			return
+		}
+		if (key1 == key2) != (pv1 == pv2 && id1 == id2) {
+			t.Fatalf("keys for (%q, %q) and (%q, %q): %q, %q", pv1, id1, pv2, id2, key1, key2)
+		}
+		if len(key1) > MaxEntityCacheKeyLength {
+			t.Fatalf("key too long: %q", key1)
+		}
+	})
+}
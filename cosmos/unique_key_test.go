@@ -0,0 +1,39 @@
+package cosmos
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniqueKeySpecialCharacters(t *testing.T) {
+	keys := map[uniqueKey]bool{}
+	for _, pair := range [][2]string{
+		{"a", "b/c"}, {"a/b", "c"}, {`a","`, "b"}, {"a", `","b`}, {"æøå", "🙂"}, {"", "a"}, {"a", ""},
+	} {
+		key, err := newUniqueKey(pair[0], pair[1])
+		require.NoError(t, err)
+		require.False(t, keys[key], "collision for %v", pair)
+		keys[key] = true
+	}
+	_, err := newUniqueKey("a", "invalid\xff")
+	require.Error(t, err)
+	_, err = newUniqueKey("invalid\xff", "a")
+	require.Error(t, err)
+}
+
+func TestEntityCacheKeyLength(t *testing.T) {
+	c := Collection{DbName: "mydb", Name: "mycollection"}
+	key, err := c.entityCacheKey("p", "short")
+	require.NoError(t, err)
+	require.Equal(t, `mydb/mycollection/["p","short"]`, key)
+
+	long1, err := c.entityCacheKey("p", strings.Repeat("x", 300)+"1")
+	require.NoError(t, err)
+	long2, err := c.entityCacheKey("p", strings.Repeat("x", 300)+"2")
+	require.NoError(t, err)
+	require.True(t, len(long1) <= MaxEntityCacheKeyLength)
+	require.True(t, strings.HasPrefix(long1, "mydb/mycollection/sha256:"))
+	require.NotEqual(t, long1, long2)
+}
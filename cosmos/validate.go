@@ -0,0 +1,159 @@
+package cosmos
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// ValidationSpec describes what the code expects of the collection, to be checked by Validate
+type ValidationSpec struct {
+	// Queries used against the collection. The properties they filter or sort on must be indexed.
+	Queries []string
+	// DefaultTimeToLive, if not nil, is the expected default TTL in seconds; -1 means TTL is enabled
+	// without a default, and 0 means TTL is disabled
+	DefaultTimeToLive *int
+}
+
+// ValidationError lists the ways the collection differs from what is expected
+type ValidationError struct {
+	Collection string
+	Problems   []string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("Collection %s does not match expectations: %s", e.Collection, strings.Join(e.Problems, "; "))
+}
+
+// WithValidation returns a Collection where Validate also checks spec
+func (c Collection) WithValidation(spec ValidationSpec) Collection {
+	c.validation = &spec
+	return c
+}
+
+// Validate reads the collection settings from Cosmos and checks them against what the code expects, so that
+// differences between environments can fail a deployment early rather than cause errors later:
+// The partition key path must match PartitionKey, and if WithValidation has been used, the properties
+// used by the queries must be indexed and the TTL setting must match. Differences are returned as a
+// ValidationError.
+func (c Collection) Validate(ctx context.Context) error {
+	coll, err := c.Client.GetCollection(ctx, c.DbName, c.Name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var problems []string
+
+	expectedPath := "/" + c.PartitionKey
+	if coll.PartitionKey == nil || len(coll.PartitionKey.Paths) == 0 {
+		problems = append(problems, fmt.Sprintf("expected partition key %s, but the collection is not partitioned", expectedPath))
+	} else if coll.PartitionKey.Paths[0] != expectedPath {
+		problems = append(problems, fmt.Sprintf("expected partition key %s, got %s", expectedPath, coll.PartitionKey.Paths[0]))
+	}
+
+	if spec := c.validation; spec != nil {
+		for _, query := range spec.Queries {
+			for _, path := range queryPropertyPaths(query) {
+				if !isIndexed(coll.IndexingPolicy, path) {
+					problems = append(problems, fmt.Sprintf("%s is not indexed, but is used in query: %s", path, query))
+				}
+			}
+		}
+		if spec.DefaultTimeToLive != nil {
+			actual := 0
+			if coll.DefaultTimeToLive != nil {
+				actual = *coll.DefaultTimeToLive
+			}
+			if actual != *spec.DefaultTimeToLive {
+				problems = append(problems, fmt.Sprintf("expected default TTL %d, got %d", *spec.DefaultTimeToLive, actual))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.WithStack(ValidationError{Collection: c.Name, Problems: problems})
+	}
+	return nil
+}
+
+var (
+	queryFromRegexp     = regexp.MustCompile(`(?i)\bFROM\s+(\w+)(\s+(AS\s+)?(\w+))?`)
+	queryPropertyRegexp = regexp.MustCompile(`\b(\w+)((\.\w+)+)`)
+)
+
+// queryPropertyPaths returns the index paths (e.g. /a/b/?) of the properties referenced after the FROM clause
+// of the query, i.e. those used for filtering and sorting. Only simple queries on the form
+// "SELECT ... FROM c [WHERE ...] [ORDER BY ...]" are understood.
+func queryPropertyPaths(query string) []string {
+	from := queryFromRegexp.FindStringSubmatchIndex(query)
+	if from == nil {
+		return nil
+	}
+	alias := query[from[2]:from[3]]
+	if from[8] != -1 && !isSqlKeyword(query[from[8]:from[9]]) {
+		alias = query[from[8]:from[9]]
+	}
+	seen := make(map[string]bool)
+	var paths []string
+	for _, m := range queryPropertyRegexp.FindAllStringSubmatch(query[from[1]:], -1) {
+		if m[1] != alias {
+			continue
+		}
+		path := strings.Replace(m[2], ".", "/", -1) + "/?"
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func isSqlKeyword(s string) bool {
+	switch strings.ToUpper(s) {
+	case "WHERE", "ORDER", "JOIN", "GROUP", "OFFSET":
+		return true
+	}
+	return false
+}
+
+// isIndexed returns whether a path (e.g. /a/b/?) is indexed by the policy. As in Cosmos, the most specific
+// matching included or excluded path decides.
+func isIndexed(policy *cosmosapi.IndexingPolicy, path string) bool {
+	if policy == nil {
+		// The default policy indexes everything
+		return true
+	}
+	if strings.EqualFold(string(policy.IndexingMode), "none") {
+		return false
+	}
+	bestLength, indexed := -1, false
+	for _, included := range policy.Included {
+		if l := indexPathMatch(included.Path, path); l > bestLength {
+			bestLength, indexed = l, true
+		}
+	}
+	for _, excluded := range policy.Excluded {
+		if l := indexPathMatch(excluded.Path, path); l >= bestLength && l >= 0 {
+			bestLength, indexed = l, false
+		}
+	}
+	return indexed
+}
+
+// indexPathMatch returns the specificity (length of the prefix) if pattern (e.g. /a/*, /a/b/?, /*)
+// matches path, and -1 otherwise
+func indexPathMatch(pattern, path string) int {
+	switch {
+	case pattern == path:
+		return len(pattern)
+	case strings.HasSuffix(pattern, "/*"):
+		prefix := strings.TrimSuffix(pattern, "*")
+		if strings.HasPrefix(path, prefix) {
+			return len(prefix)
+		}
+	}
+	return -1
+}
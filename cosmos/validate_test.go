@@ -0,0 +1,69 @@
+package cosmos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockCosmosCollection struct {
+	Client
+	Collection cosmosapi.Collection
+}
+
+func (mock *mockCosmosCollection) GetCollection(ctx context.Context, dbName, colName string) (*cosmosapi.Collection, error) {
+	return &mock.Collection, nil
+}
+
+func TestQueryPropertyPaths(t *testing.T) {
+	require.Equal(t, []string{"/userId/?", "/address/city/?", "/x/?"},
+		queryPropertyPaths("SELECT c.id, c.y FROM c WHERE c.userId = @userId AND c.address.city = 'Oslo' ORDER BY c.x"))
+	require.Equal(t, []string{"/x/?"}, queryPropertyPaths("SELECT * FROM root r WHERE r.x > 1.5"))
+	require.Empty(t, queryPropertyPaths("SELECT c.id FROM c"))
+}
+
+func TestIsIndexed(t *testing.T) {
+	policy := &cosmosapi.IndexingPolicy{
+		IndexingMode: "consistent",
+		Included:     []cosmosapi.IncludedPath{{Path: "/*"}, {Path: "/big/small/?"}},
+		Excluded:     []cosmosapi.ExcludedPath{{Path: "/big/*"}, {Path: "/\"_etag\"/?"}},
+	}
+	require.True(t, isIndexed(policy, "/x/?"))
+	require.True(t, isIndexed(policy, "/big/small/?"))
+	require.False(t, isIndexed(policy, "/big/other/?"))
+	require.True(t, isIndexed(nil, "/x/?"))
+	require.False(t, isIndexed(&cosmosapi.IndexingPolicy{IndexingMode: "none"}, "/x/?"))
+}
+
+func TestValidate(t *testing.T) {
+	ttl := 3600
+	mock := mockCosmosCollection{Collection: cosmosapi.Collection{
+		PartitionKey: &cosmosapi.PartitionKey{Paths: []string{"/userId"}, Kind: "Hash"},
+		IndexingPolicy: &cosmosapi.IndexingPolicy{
+			Included: []cosmosapi.IncludedPath{{Path: "/*"}},
+			Excluded: []cosmosapi.ExcludedPath{{Path: "/payload/*"}},
+		},
+		DefaultTimeToLive: &ttl,
+	}}
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	require.NoError(t, c.Validate(context.Background()))
+	require.NoError(t, c.WithValidation(ValidationSpec{
+		Queries:           []string{"SELECT * FROM c WHERE c.x = 1"},
+		DefaultTimeToLive: &ttl,
+	}).Validate(context.Background()))
+
+	noTtl := 0
+	err := c.WithValidation(ValidationSpec{
+		Queries:           []string{"SELECT * FROM c WHERE c.payload.x = 1"},
+		DefaultTimeToLive: &noTtl,
+	}).Validate(context.Background())
+	require.Error(t, err)
+	validationErr := errors.Cause(err).(ValidationError)
+	require.Equal(t, 2, len(validationErr.Problems))
+
+	c.PartitionKey = "otherKey"
+	require.Error(t, c.Validate(context.Background()))
+}
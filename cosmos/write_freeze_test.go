@@ -0,0 +1,49 @@
+package cosmos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFreeze(t *testing.T) {
+	mock := mockCosmos{ReturnUserId: "partitionvalue"}
+	freeze := NewWriteFreeze()
+	c := Collection{Client: &mock, DbName: "mydb", Name: "mycollection", PartitionKey: "userId"}
+	failFast := c.WithWriteFreeze(freeze, 0)
+	blocking := c.WithWriteFreeze(freeze, time.Minute)
+
+	entity := MyModel{BaseModel: BaseModel{Id: "idvalue"}, UserId: "partitionvalue"}
+	require.NoError(t, failFast.RacingPut(&entity))
+
+	freeze.Freeze("failover")
+	frozen, reason := freeze.Frozen()
+	require.True(t, frozen)
+	require.Equal(t, "failover", reason)
+
+	mock.GotMethod = ""
+	err := failFast.RacingPut(&entity)
+	require.Equal(t, WritesFrozenError, errors.Cause(err))
+	require.Contains(t, err.Error(), "failover")
+	require.Equal(t, "", mock.GotMethod)
+	// Reads are not affected
+	require.NoError(t, failFast.StaleGet("partitionvalue", "idvalue", &entity))
+
+	done := make(chan error)
+	go func() {
+		done <- blocking.RacingPut(&entity)
+	}()
+	select {
+	case <-done:
+		t.Fatal("write should block while frozen")
+	case <-time.After(10 * time.Millisecond):
+	}
+	freeze.Thaw()
+	require.NoError(t, <-done)
+
+	freeze.Freeze("again")
+	err = c.WithWriteFreeze(freeze, 10*time.Millisecond).RacingPut(&entity)
+	require.Equal(t, WritesFrozenError, errors.Cause(err))
+}
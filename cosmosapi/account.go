@@ -0,0 +1,106 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const HEADER_RETRY_AFTER_MS = "x-ms-retry-after-ms"
+
+var ErrServerless = errors.New("The operation is not supported by serverless accounts")
+
+type AccountLocation struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"databaseAccountEndpoint"`
+}
+
+// AccountCapabilities describes the database account a client is connected to
+type AccountCapabilities struct {
+	Id                      string
+	WritableLocations       []AccountLocation
+	ReadableLocations       []AccountLocation
+	MultipleWriteLocations  bool
+	DefaultConsistencyLevel ConsistencyLevel
+	// Serverless is set for serverless accounts, which have no provisioned throughput; offers can not be
+	// read or replaced
+	Serverless bool
+}
+
+type databaseAccount struct {
+	Id                           string            `json:"id"`
+	WritableLocations            []AccountLocation `json:"writableLocations"`
+	ReadableLocations            []AccountLocation `json:"readableLocations"`
+	EnableMultipleWriteLocations bool              `json:"enableMultipleWriteLocations"`
+	UserConsistencyPolicy        struct {
+		DefaultConsistencyLevel ConsistencyLevel `json:"defaultConsistencyLevel"`
+	} `json:"userConsistencyPolicy"`
+}
+
+// AccountCapabilities reads the properties of the database account, and detects whether it is serverless
+// (which is not among the properties; it is detected by the account refusing to list offers because it is
+// serverless). The result is cached by the client. Once a client knows that the account is serverless, the
+// offer operations fail with ErrServerless without making a request, and throttled requests are retried
+// after the delay suggested by Cosmos rather than with exponential backoff, since serverless throttling is
+// short-lived.
+func (c *Client) AccountCapabilities(ctx context.Context) (AccountCapabilities, error) {
+	if capabilities, ok := c.cachedCapabilities.Load().(AccountCapabilities); ok {
+		return capabilities, nil
+	}
+	var account databaseAccount
+	if _, err := c.get(ctx, "", &account, nil); err != nil {
+		return AccountCapabilities{}, err
+	}
+	capabilities := AccountCapabilities{
+		Id:                      account.Id,
+		WritableLocations:       account.WritableLocations,
+		ReadableLocations:       account.ReadableLocations,
+		MultipleWriteLocations:  account.EnableMultipleWriteLocations,
+		DefaultConsistencyLevel: account.UserConsistencyPolicy.DefaultConsistencyLevel,
+	}
+	var offers Offers
+	resp, err := c.get(ctx, createOfferLink(""), &offers, map[string]string{HEADER_MAX_ITEM_COUNT: "1"})
+	switch {
+	case err == nil:
+	case isServerlessError(resp, err):
+		capabilities.Serverless = true
+	default:
+		return AccountCapabilities{}, err
+	}
+	c.cachedCapabilities.Store(capabilities)
+	return capabilities, nil
+}
+
+// isServerlessError returns true if err is the error returned by serverless accounts for offer requests, e.g.
+// "Reading or replacing offers is not supported for serverless accounts"
+func isServerlessError(resp *cosmosResponse, err error) bool {
+	if errors.Cause(err) != ErrInvalidRequest {
+		return false
+	}
+	requestError, ok := resp.requestError()
+	return ok && strings.Contains(strings.ToLower(requestError.Message), "serverless")
+}
+
+// isServerless returns true if AccountCapabilities has found the account to be serverless
+func (c *Client) isServerless() bool {
+	capabilities, ok := c.cachedCapabilities.Load().(AccountCapabilities)
+	return ok && capabilities.Serverless
+}
+
+// retryDelay returns how long to wait before retry number retryCount, given the response to the previous attempt
+// and the time waited for the previous retries, or false if the request should not be retried again
+func (c *Client) retryDelay(retryCount int, waited time.Duration, previous *http.Response) (time.Duration, bool) {
+	if c.Config.RetryPolicy != nil {
+		return c.Config.RetryPolicy.delay(retryCount, waited, retryAfter(previous))
+	}
+	if retryCount > c.Config.MaxRetries {
+		return 0, false
+	}
+	if delay := retryAfter(previous); delay > 0 && c.isServerless() {
+		return delay, true
+	}
+	return backoffDelay(retryCount), true
+}
@@ -0,0 +1,86 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountCapabilities(t *testing.T) {
+	badRequest := ""
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`{"id": "account", "writableLocations": [{"name": "West Europe", "databaseAccountEndpoint": "https://account-westeurope.documents.azure.com:443/"}],
+				"userConsistencyPolicy": {"defaultConsistencyLevel": "Session"}}`))
+		case "/offers/":
+			if badRequest != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(badRequest))
+				return
+			}
+			w.Write([]byte(`{"Offers": []}`))
+		}
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	capabilities, err := c.AccountCapabilities(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, AccountCapabilities{
+		Id:                      "account",
+		WritableLocations:       []AccountLocation{{Name: "West Europe", Endpoint: "https://account-westeurope.documents.azure.com:443/"}},
+		DefaultConsistencyLevel: ConsistencyLevelSession,
+	}, capabilities)
+
+	// Other bad requests are not taken for serverless accounts
+	badRequest = `{"code": "BadRequest", "message": "The request is invalid"}`
+	c = New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	_, err = c.AccountCapabilities(context.Background())
+	assert.Equal(t, ErrInvalidRequest, errors.Cause(err))
+
+	badRequest = `{"code": "BadRequest", "message": "Reading or replacing offers is not supported for serverless accounts.\r\nActivityId: 1"}`
+	c = New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	capabilities, err = c.AccountCapabilities(context.Background())
+	require.NoError(t, err)
+	assert.True(t, capabilities.Serverless)
+
+	// Cached, and offers are not requested
+	requests = 0
+	_, err = c.AccountCapabilities(context.Background())
+	require.NoError(t, err)
+	_, err = c.ListOffers(context.Background(), nil)
+	assert.Equal(t, ErrServerless, err)
+	assert.Equal(t, 0, requests)
+
+	report, err := c.OfferReport(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, report)
+}
+
+func TestRetryDelay(t *testing.T) {
+	c := New("", Config{MasterKey: TestKey, MaxRetries: 1}, nil, nil)
+	retryDelay := func(previous *http.Response) time.Duration {
+		delay, retry := c.retryDelay(1, 0, previous)
+		require.True(t, retry)
+		return delay
+	}
+	throttled := &http.Response{Header: http.Header{}}
+	throttled.Header.Set(HEADER_RETRY_AFTER_MS, "5")
+	assert.True(t, retryDelay(throttled) >= 300*time.Millisecond)
+
+	c.cachedCapabilities.Store(AccountCapabilities{Serverless: true})
+	assert.Equal(t, 5*time.Millisecond, retryDelay(throttled))
+	assert.True(t, retryDelay(&http.Response{Header: http.Header{}}) >= 300*time.Millisecond)
+
+	_, retry := c.retryDelay(2, 0, throttled)
+	assert.False(t, retry)
+}
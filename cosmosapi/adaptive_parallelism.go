@@ -0,0 +1,121 @@
+package cosmosapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AdaptiveParallelismConfig configures an AdaptiveParallelism; zero values give the defaults
+type AdaptiveParallelismConfig struct {
+	// Initial is the number of requests allowed in parallel at first (default 4)
+	Initial int
+	// Min and Max bound the number of requests allowed in parallel (defaults 1 and 64)
+	Min int
+	Max int
+	// TargetLatency, if set, makes requests slower than it count as overload, as throttled requests do
+	TargetLatency time.Duration
+}
+
+// AdaptiveParallelism limits the number of requests done in parallel, e.g. by QueryDocumentsCrossPartition or
+// bulk writes, and tunes the limit to what the collection can take, so that the concurrency does not have to
+// be chosen by hand per environment. Like TCP congestion control it uses additive increase, multiplicative
+// decrease: when as many requests as the limit have succeeded in a row, the limit is increased by one, and
+// when a request is overloaded the limit is halved. A request is overloaded if it was throttled (429 Too
+// Many Requests or 503 Service Unavailable, also if the retries of the client then succeeded), or slower
+// than TargetLatency. Requests started before the limit was last halved do not halve it again, so that a
+// burst of throttling halves it only once.
+//
+// As the throughput of a collection is shared, share one AdaptiveParallelism between the operations on the
+// same collection.
+type AdaptiveParallelism struct {
+	config AdaptiveParallelismConfig
+	now    func() time.Time
+
+	mu         sync.Mutex
+	limit      int
+	inFlight   int
+	successes  int           // successful requests since the limit was last changed
+	generation int           // incremented when the limit is halved
+	released   chan struct{} // closed and replaced when a request is done
+}
+
+func NewAdaptiveParallelism(config AdaptiveParallelismConfig) *AdaptiveParallelism {
+	if config.Min <= 0 {
+		config.Min = 1
+	}
+	if config.Max <= 0 {
+		config.Max = 64
+	}
+	if config.Initial <= 0 {
+		config.Initial = 4
+	}
+	if config.Initial < config.Min {
+		config.Initial = config.Min
+	}
+	if config.Initial > config.Max {
+		config.Initial = config.Max
+	}
+	return &AdaptiveParallelism{config: config, now: time.Now, limit: config.Initial, released: make(chan struct{})}
+}
+
+// Limit returns the number of requests currently allowed in parallel
+func (p *AdaptiveParallelism) Limit() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.limit
+}
+
+// Acquire waits until a request may be started, or ctx is done. On success it returns a function to call
+// when the request is done, with its error and the number of times the client retried it (RetryCount of
+// the response).
+func (p *AdaptiveParallelism) Acquire(ctx context.Context) (done func(err error, retryCount int), err error) {
+	for {
+		p.mu.Lock()
+		if p.inFlight < p.limit {
+			p.inFlight++
+			generation := p.generation
+			p.mu.Unlock()
+			started := p.now()
+			var once sync.Once
+			return func(err error, retryCount int) {
+				once.Do(func() { p.done(generation, started, err, retryCount) })
+			}, nil
+		}
+		released := p.released
+		p.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		}
+	}
+}
+
+func (p *AdaptiveParallelism) done(generation int, started time.Time, err error, retryCount int) {
+	cause := errors.Cause(err)
+	overloaded := retryCount > 0 || cause == ErrTooManyRequests || cause == ErrUnavailable || cause == ErrMaxRetriesExceeded ||
+		(p.config.TargetLatency > 0 && p.now().Sub(started) > p.config.TargetLatency)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight--
+	switch {
+	case overloaded && generation == p.generation:
+		p.limit /= 2
+		if p.limit < p.config.Min {
+			p.limit = p.config.Min
+		}
+		p.generation++
+		p.successes = 0
+	case !overloaded && err == nil:
+		p.successes++
+		if p.successes >= p.limit && p.limit < p.config.Max {
+			p.limit++
+			p.successes = 0
+		}
+	}
+	close(p.released)
+	p.released = make(chan struct{})
+}
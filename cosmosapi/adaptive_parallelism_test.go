@@ -0,0 +1,65 @@
+package cosmosapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveParallelism(t *testing.T) {
+	p := NewAdaptiveParallelism(AdaptiveParallelismConfig{Initial: 2, Max: 3, TargetLatency: time.Second})
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	ctx := context.Background()
+	acquire := func() func(error, int) {
+		done, err := p.Acquire(ctx)
+		require.NoError(t, err)
+		return done
+	}
+
+	// At most Limit() requests at a time
+	done1, done2 := acquire(), acquire()
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := p.Acquire(timeout)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+	// A waiting request is started when another is done
+	started := make(chan func(error, int))
+	go func() {
+		done, _ := p.Acquire(ctx)
+		started <- done
+	}()
+	done1(nil, 0)
+	done3 := <-started
+
+	// The limit is increased by one when as many requests as the limit have succeeded, up to Max
+	done2(nil, 0)
+	assert.Equal(t, 3, p.Limit())
+	done3(nil, 0)
+	for i := 0; i != 4; i++ {
+		acquire()(nil, 0)
+	}
+	assert.Equal(t, 3, p.Limit())
+
+	// Throttling halves the limit once, also if the retries succeeded
+	done1, done2 = acquire(), acquire()
+	done1(ErrTooManyRequests, 3)
+	assert.Equal(t, 1, p.Limit())
+	done2(nil, 1)
+	assert.Equal(t, 1, p.Limit())
+
+	// Slow requests count as overloaded; other errors are neutral
+	p = NewAdaptiveParallelism(AdaptiveParallelismConfig{Initial: 4, TargetLatency: time.Second})
+	p.now = func() time.Time { return now }
+	done1, done2 = acquire(), acquire()
+	done1(ErrNotFound, 0)
+	assert.Equal(t, 4, p.Limit())
+	now = now.Add(2 * time.Second)
+	done2(nil, 0)
+	assert.Equal(t, 2, p.Limit())
+}
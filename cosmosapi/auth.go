@@ -4,8 +4,11 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"hash"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type AuthorizationPayload struct {
@@ -19,32 +22,131 @@ type AuthorizationPayload struct {
 // variables. The returned string can then be used to make the authentication
 // header using `authHeader`.
 func signedPayload(verb, link, date, key string) (string, error) {
+	s, err := newSigner(key)
+	if err != nil {
+		return "", err
+	}
+	return s.signedPayload(verb, link, date), nil
+}
+
+// The maximum number of signatures cached per second, see signer.authorization
+const maxCachedSignatures = 4096
+
+// signer holds the decoded master key and a pool of HMAC states, so that signing a request does not have
+// to decode the key and allocate a new hash every time.
+type signer struct {
+	key  string
+	pool sync.Pool
+	// signatures is the *signatureCache for the date of the last request signed
+	signatures atomic.Value
+}
+
+// signatureCache holds the Authorization headers computed for one date. As dates have a resolution of a
+// second, requests for the same resource within a second, e.g. point reads of a hot document, have the same
+// signature, which only needs to be computed once.
+type signatureCache struct {
+	date    string
+	headers sync.Map // string to sign -> Authorization header
+	size    int32
+}
+
+func newSigner(key string) (*signer, error) {
+	salt, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	s := &signer{key: key}
+	s.pool.New = func() interface{} {
+		return hmac.New(sha256.New, salt)
+	}
+	return s, nil
+}
+
+func (s *signer) signedPayload(verb, link, date string) string {
 	if strings.HasPrefix(link, "/") == true {
 		link = link[1:]
 	}
 
 	rLink, rType := resourceTypeFromLink(link)
+	return s.signResource(verb, rType, rLink, date)
+}
 
+func (s *signer) signResource(verb, resourceType, resourceLink, date string) string {
 	pl := AuthorizationPayload{
 		Verb:         verb,
-		ResourceType: rType,
-		ResourceLink: rLink,
+		ResourceType: resourceType,
+		ResourceLink: resourceLink,
 		Date:         date,
 	}
+	return s.sign(stringToSign(pl))
+}
+
+// Sign returns the value of the Authorization header for a request signed with the master key of the client,
+// for calling REST endpoints that are not wrapped by the client. resourceType is e.g. "docs", and
+// resourceLink is the link of the resource without leading slash (e.g. "dbs/db/colls/coll/docs/id"), or
+// of its parent for operations on a feed (e.g. "dbs/db/colls/coll" for creating a document). date must
+// be the value sent in the x-ms-date header, formatted with http.TimeFormat.
+func (c *Client) Sign(verb, resourceType, resourceLink, date string) (string, error) {
+	s, err := c.signer()
+	if err != nil {
+		return "", err
+	}
+	return authHeader(s.signResource(verb, resourceType, strings.TrimPrefix(resourceLink, "/"), date)), nil
+}
 
-	s := stringToSign(pl)
-	return sign(s, key)
+// SignWithKey is like Client.Sign, but signs with the given master key
+func SignWithKey(masterKey, verb, resourceType, resourceLink, date string) (string, error) {
+	s, err := newSigner(masterKey)
+	if err != nil {
+		return "", err
+	}
+	return authHeader(s.signResource(verb, resourceType, strings.TrimPrefix(resourceLink, "/"), date)), nil
+}
+
+// authorization returns the Authorization header for a request, from the cache if it has been computed for
+// the same request within the same second
+func (s *signer) authorization(verb, resourceType, resourceLink, date string) string {
+	cache, _ := s.signatures.Load().(*signatureCache)
+	if cache == nil || cache.date != date {
+		cache = &signatureCache{date: date}
+		s.signatures.Store(cache)
+	}
+	str := stringToSign(AuthorizationPayload{Verb: verb, ResourceType: resourceType, ResourceLink: resourceLink, Date: date})
+	if header, ok := cache.headers.Load(str); ok {
+		return header.(string)
+	}
+	header := authHeader(s.sign(str))
+	if atomic.AddInt32(&cache.size, 1) <= maxCachedSignatures {
+		cache.headers.Store(str, header)
+	}
+	return header
+}
+
+func (s *signer) sign(str string) string {
+	h := s.pool.Get().(hash.Hash)
+	defer s.pool.Put(h)
+	h.Reset()
+	h.Write([]byte(str))
+	var sum [sha256.Size]byte
+	return base64.StdEncoding.EncodeToString(h.Sum(sum[:0]))
 }
 
 // stringToSign constructs the string to be signed from an `AuthorizationPayload`
 // struct. The generated string only works with the addressing by user ids, as
 // we use in this package. Addressing with self links requires different capitalization.
 func stringToSign(p AuthorizationPayload) string {
-	return strings.ToLower(p.Verb) + "\n" +
-		strings.ToLower(p.ResourceType) + "\n" +
-		p.ResourceLink + "\n" +
-		strings.ToLower(p.Date) + "\n" +
-		"" + "\n"
+	var b strings.Builder
+	b.Grow(len(p.Verb) + len(p.ResourceType) + len(p.ResourceLink) + len(p.Date) + 5)
+	b.WriteString(strings.ToLower(p.Verb))
+	b.WriteByte('\n')
+	b.WriteString(strings.ToLower(p.ResourceType))
+	b.WriteByte('\n')
+	b.WriteString(p.ResourceLink)
+	b.WriteByte('\n')
+	b.WriteString(strings.ToLower(p.Date))
+	b.WriteByte('\n')
+	b.WriteByte('\n')
+	return b.String()
 }
 
 // authHeader consructs the authentication header expected by the comsosdb API.
@@ -55,18 +157,3 @@ func authHeader(sPayload string) string {
 		"type=" + masterToken + "&ver=" + tokenVersion + "&sig=" + sPayload,
 	)
 }
-
-func sign(str, key string) (string, error) {
-	var ret string
-	enc := base64.StdEncoding
-	salt, err := enc.DecodeString(key)
-	if err != nil {
-		return ret, err
-	}
-	hmac := hmac.New(sha256.New, salt)
-	hmac.Write([]byte(str))
-	b := hmac.Sum(nil)
-
-	ret = enc.EncodeToString(b)
-	return ret, nil
-}
@@ -1,6 +1,7 @@
 package cosmosapi
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,3 +34,72 @@ func TestMakeAuthHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestSignerMatchesSignedPayload(t *testing.T) {
+	s, err := newSigner(TestKey)
+	require.NoError(t, err)
+	for i := 0; i != 3; i++ {
+		expected, err := signedPayload("GET", "dbs/ToDoList", "Thu, 27 Apr 2017 00:51:12 GMT", TestKey)
+		require.NoError(t, err)
+		assert.Equal(t, expected, s.signedPayload("GET", "dbs/ToDoList", "Thu, 27 Apr 2017 00:51:12 GMT"))
+	}
+}
+
+func TestClientSignerFollowsMasterKey(t *testing.T) {
+	c := New("https://example.com", Config{MasterKey: TestKey}, nil, nil)
+	s1, err := c.signer()
+	require.NoError(t, err)
+	s2, err := c.signer()
+	require.NoError(t, err)
+	assert.True(t, s1 == s2)
+
+	c.Config.MasterKey = "Zm9v"
+	s3, err := c.signer()
+	require.NoError(t, err)
+	assert.Equal(t, "Zm9v", s3.key)
+
+	c.Config.MasterKey = "not base64!"
+	_, err = c.signer()
+	assert.Error(t, err)
+}
+
+func BenchmarkSignedPayloadUncached(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		signedPayload("GET", "dbs/db/colls/coll/docs/doc", "Thu, 27 Apr 2017 00:51:12 GMT", TestKey)
+	}
+}
+
+func BenchmarkSignedPayloadCached(b *testing.B) {
+	s, _ := newSigner(TestKey)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.signedPayload("GET", "dbs/db/colls/coll/docs/doc", "Thu, 27 Apr 2017 00:51:12 GMT")
+	}
+}
+
+func BenchmarkSetDefaultHeaders(b *testing.B) {
+	c := New("https://example.com", Config{MasterKey: TestKey}, nil, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, _ := c.signer()
+		setDefaultHeaders(http.Header{}, "GET", "dbs/db/colls/coll/docs/doc", s)
+	}
+}
+
+func TestSign(t *testing.T) {
+	expected := "type%3Dmaster%26ver%3D1.0%26sig%3Dc09PEVJrgp2uQRkr934kFbTqhByc7TVr3OHyqlu%2Bc%2Bc%3D"
+	c := New("https://example.com", Config{MasterKey: TestKey}, nil, nil)
+	header, err := c.Sign("GET", "dbs", "/dbs/ToDoList", "Thu, 27 Apr 2017 00:51:12 GMT")
+	require.NoError(t, err)
+	assert.Equal(t, expected, header)
+
+	header, err = SignWithKey(TestKey, "GET", "dbs", "dbs/ToDoList", "Thu, 27 Apr 2017 00:51:12 GMT")
+	require.NoError(t, err)
+	assert.Equal(t, expected, header)
+
+	_, err = SignWithKey("not base64", "GET", "dbs", "dbs/ToDoList", "Thu, 27 Apr 2017 00:51:12 GMT")
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package cosmosapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	HEADER_IS_BATCH_REQUEST = "x-ms-cosmos-is-batch-request"
+	HEADER_BATCH_ATOMIC     = "x-ms-cosmos-batch-atomic"
+)
+
+// The maximum number of operations in a transactional batch
+const MaxBatchOperations = 100
+
+type BatchOperationType string
+
+const (
+	BatchCreate  = BatchOperationType("Create")
+	BatchUpsert  = BatchOperationType("Upsert")
+	BatchReplace = BatchOperationType("Replace")
+	BatchDelete  = BatchOperationType("Delete")
+	BatchRead    = BatchOperationType("Read")
+	// The ResourceBody of a patch operation is a BatchPatchBody
+	BatchPatch = BatchOperationType("Patch")
+)
+
+// BatchOperation is a single operation of a transactional batch
+type BatchOperation struct {
+	OperationType BatchOperationType `json:"operationType"`
+	// Id of the document; not used for Create and Upsert, which take it from ResourceBody
+	Id           string      `json:"id,omitempty"`
+	ResourceBody interface{} `json:"resourceBody,omitempty"`
+	IfMatch      string      `json:"ifMatch,omitempty"`
+}
+
+// BatchPatchBody is the ResourceBody of a BatchPatch operation
+type BatchPatchBody struct {
+	// Condition is a filter predicate, see PatchDocumentOptions.Condition
+	Condition  string           `json:"condition,omitempty"`
+	Operations []PatchOperation `json:"operations"`
+}
+
+// BatchOperationResult is the result of a single operation of a transactional batch
+type BatchOperationResult struct {
+	StatusCode    int     `json:"statusCode"`
+	RequestCharge float64 `json:"requestCharge"`
+	Etag          string  `json:"eTag"`
+	// ResourceBody is the document written or read, if any
+	ResourceBody json.RawMessage `json:"resourceBody,omitempty"`
+}
+
+type BatchOptions struct {
+	PartitionKeyValue interface{}
+	SessionToken      string
+}
+
+func (ops BatchOptions) AsHeaders() (map[string]string, error) {
+	headers := map[string]string{
+		HEADER_IS_BATCH_REQUEST: "True",
+		HEADER_BATCH_ATOMIC:     "True",
+	}
+	v, err := MarshalPartitionKeyHeader(ops.PartitionKeyValue)
+	if err != nil {
+		return nil, err
+	}
+	headers[HEADER_PARTITIONKEY] = v
+	if ops.SessionToken != "" {
+		headers[HEADER_SESSION_TOKEN] = ops.SessionToken
+	}
+	return headers, nil
+}
+
+type BatchResponse struct {
+	DocumentResponse
+	// Results has the result of each operation, in the order of the operations
+	Results []BatchOperationResult
+}
+
+// BatchError is returned when a transactional batch was rolled back because one of its operations failed
+type BatchError struct {
+	// Index of the operation that failed
+	Index      int
+	StatusCode int
+	// Err is the error corresponding to StatusCode, e.g. ErrPreconditionFailed; errors.Cause returns it
+	Err error
+	// RetryCount is the number of times the client retried the batch before it failed; see RetriedError
+	RetryCount int
+}
+
+func (e BatchError) Error() string {
+	return fmt.Sprintf("Batch operation %d failed with status %d: %v", e.Index, e.StatusCode, e.Err)
+}
+
+func (e BatchError) Cause() error {
+	return e.Err
+}
+
+// ExecuteBatch executes the operations, which must all be on documents in the same partition, as a
+// transactional batch: either all of them succeed, or none of them take effect. If an operation fails,
+// a BatchError is returned together with the results of all operations (the others have status 424 Failed
+// Dependency).
+// https://docs.microsoft.com/en-us/azure/cosmos-db/sql/transactional-batch
+func (c *Client) ExecuteBatch(ctx context.Context, dbName, colName string,
+	operations []BatchOperation, ops BatchOptions) (BatchResponse, error) {
+	if len(operations) == 0 || len(operations) > MaxBatchOperations {
+		return BatchResponse{}, errors.Errorf("A batch must have between 1 and %d operations, got %d", MaxBatchOperations, len(operations))
+	}
+	headers, err := ops.AsHeaders()
+	if err != nil {
+		return BatchResponse{}, err
+	}
+	for _, op := range operations {
+		if op.OperationType == BatchPatch {
+			headers[HEADER_VER] = PatchAPIVersion
+		}
+	}
+
+	var results []BatchOperationResult
+	resp, err := c.create(ctx, createDocsLink(dbName, colName), operations, &results, headers)
+	if err != nil {
+		return BatchResponse{DocumentResponse: parseDocumentResponse(resp)}, err
+	}
+	response := BatchResponse{DocumentResponse: parseDocumentResponse(resp), Results: results}
+	if resp.StatusCode == http.StatusMultiStatus {
+		for i, result := range results {
+			if result.StatusCode == http.StatusFailedDependency || result.StatusCode < 300 {
+				continue
+			}
+			err, ok := CosmosHTTPErrors[result.StatusCode]
+			if !ok || err == nil {
+				err = errUnexpectedHTTPStatus
+			}
+			return response, BatchError{Index: i, StatusCode: result.StatusCode, Err: err, RetryCount: response.RetryCount}
+		}
+		return response, errors.New("Batch failed, but no operation reported an error")
+	}
+	return response, nil
+}
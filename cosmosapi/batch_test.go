@@ -0,0 +1,129 @@
+package cosmosapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteBatch(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/dbs/db/colls/coll/docs", r.URL.Path)
+		assert.Equal(t, "True", r.Header.Get(HEADER_IS_BATCH_REQUEST))
+		assert.Equal(t, "True", r.Header.Get(HEADER_BATCH_ATOMIC))
+		assert.Equal(t, `["pk"]`, r.Header.Get(HEADER_PARTITIONKEY))
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `[
+			{"operationType": "Create", "resourceBody": {"id": "a"}},
+			{"operationType": "Replace", "id": "b", "resourceBody": {"id": "b"}, "ifMatch": "etag-b"},
+			{"operationType": "Delete", "id": "c"}
+		]`, string(b))
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`[{"statusCode": 201, "eTag": "etag-a2", "resourceBody": {"id": "a"}}, {"statusCode": 200, "eTag": "etag-b2"}, {"statusCode": 204}]`))
+		} else {
+			w.Write([]byte(`[{"statusCode": 424}, {"statusCode": 412}, {"statusCode": 424}]`))
+		}
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	operations := []BatchOperation{
+		{OperationType: BatchCreate, ResourceBody: map[string]string{"id": "a"}},
+		{OperationType: BatchReplace, Id: "b", ResourceBody: map[string]string{"id": "b"}, IfMatch: "etag-b"},
+		{OperationType: BatchDelete, Id: "c"},
+	}
+	response, err := c.ExecuteBatch(context.Background(), "db", "coll", operations, BatchOptions{PartitionKeyValue: "pk"})
+	require.NoError(t, err)
+	require.Len(t, response.Results, 3)
+	assert.Equal(t, "etag-a2", response.Results[0].Etag)
+	assert.JSONEq(t, `{"id": "a"}`, string(response.Results[0].ResourceBody))
+
+	status = http.StatusMultiStatus
+	_, err = c.ExecuteBatch(context.Background(), "db", "coll", operations, BatchOptions{PartitionKeyValue: "pk"})
+	require.Error(t, err)
+	assert.Equal(t, ErrPreconditionFailed, errors.Cause(err))
+	assert.Equal(t, 1, err.(BatchError).Index)
+
+	_, err = c.ExecuteBatch(context.Background(), "db", "coll", nil, BatchOptions{PartitionKeyValue: "pk"})
+	require.Error(t, err)
+}
+
+func TestTransactionalBatch(t *testing.T) {
+	failed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, PatchAPIVersion, r.Header.Get(HEADER_VER))
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `[
+			{"operationType": "Read", "id": "a"},
+			{"operationType": "Upsert", "resourceBody": {"id": "b"}, "ifMatch": "etag-b"},
+			{"operationType": "Patch", "id": "c", "resourceBody": {"condition": "FROM c WHERE c.n > 0", "operations": [{"op": "incr", "path": "/n", "value": 1}]}},
+			{"operationType": "Delete", "id": "d"}
+		]`, string(b))
+		if failed {
+			w.WriteHeader(http.StatusMultiStatus)
+			w.Write([]byte(`[{"statusCode": 424}, {"statusCode": 424}, {"statusCode": 412}, {"statusCode": 424}]`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`[{"statusCode": 200, "resourceBody": {"id": "a", "n": 1}}, {"statusCode": 200}, {"statusCode": 200}, {"statusCode": 204}]`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	batch := c.NewTransactionalBatch("db", "coll", BatchOptions{PartitionKeyValue: "pk"}).
+		ReadItem("a").
+		UpsertItem(map[string]string{"id": "b"}).IfMatch("etag-b").
+		PatchItem("c", PatchIncrement("/n", 1)).PatchCondition("FROM c WHERE c.n > 0").
+		DeleteItem("d")
+	response, err := batch.Execute(context.Background())
+	require.NoError(t, err)
+	require.Len(t, response.Results, 4)
+	var doc struct {
+		Id string `json:"id"`
+		N  int    `json:"n"`
+	}
+	require.NoError(t, response.Results[0].Decode(&doc))
+	assert.Equal(t, 1, doc.N)
+	assert.Error(t, response.Results[3].Decode(&doc))
+
+	failed = true
+	response, err = batch.Execute(context.Background())
+	assert.Equal(t, ErrPreconditionFailed, errors.Cause(err))
+	require.Len(t, response.Results, 4)
+	assert.Equal(t, ErrFailedDependency, response.Results[0].Err)
+	assert.Equal(t, ErrPreconditionFailed, response.Results[2].Err)
+	assert.Equal(t, "c", response.Results[2].Id)
+	assert.Equal(t, BatchPatch, response.Results[2].OperationType)
+}
+
+func TestTransactionalBatchReads(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`[{"statusCode": 200, "resourceBody": {"id": "a", "n": 1}}, {"statusCode": 200, "resourceBody": {"id": "b", "n": 2}}, {"statusCode": 201}]`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	type doc struct {
+		Id string `json:"id"`
+		N  int    `json:"n"`
+	}
+	var a, b doc
+	_, err := c.NewTransactionalBatch("db", "coll", BatchOptions{PartitionKeyValue: "pk"}).
+		ReadItemInto("a", &a).
+		ReadItemInto("b", &b).
+		CreateItem(doc{Id: "c", N: 3}).
+		Execute(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, doc{Id: "a", N: 1}, a)
+	assert.Equal(t, doc{Id: "b", N: 2}, b)
+}
@@ -0,0 +1,90 @@
+package cosmosapi
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// ChaosRequest is an attempt of a request about to be sent, as passed to Config.Chaos
+type ChaosRequest struct {
+	Method string
+	// Link is the resource link, e.g. dbs/mydb/colls/mycoll/docs/mydoc
+	Link string
+	// Headers are the signed headers of the request; modifications are sent
+	Headers http.Header
+	// Body is a copy of the serialized request body, or nil if there is none. If it is modified or replaced,
+	// the modified body is sent in this attempt; retries start from the original body again.
+	Body []byte
+	// Attempt is 0 for the first attempt of the request, and the number of the retry for retries
+	Attempt int
+}
+
+// Chaos injects faults into the requests of a Client, to test how the client and the code using it handle
+// throttling, unavailability, network errors and malformed requests, through the real serialization and
+// retry code; see Config.Chaos. It is called with every attempt of a request after it has been serialized
+// and signed, and returns either a response to use instead of sending the request (e.g. one made by
+// ChaosResponse), an error to fail the attempt with as if the request could not be sent, or neither to send
+// the request with the modifications made to req, if any.
+//
+// Chaos is only called in binaries built with the cosmoschaos build tag (go test -tags cosmoschaos).
+type Chaos func(req *ChaosRequest) (*http.Response, error)
+
+// chaosRandom returns a pseudo-random number in [0, 1) deciding if a fault is injected; replaced in tests
+var chaosRandom = rand.Float64
+
+// ChaosResponse returns an empty response with the given status code, e.g. http.StatusTooManyRequests
+func ChaosResponse(statusCode int) *http.Response {
+	return &http.Response{
+		Status:     http.StatusText(statusCode),
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+}
+
+// ChaosStatus returns a Chaos responding with statusCode, instead of sending the request, to the given
+// fraction of attempts. E.g. ChaosStatus(0.1, http.StatusTooManyRequests) throttles 10% of the attempts,
+// which exercises the retries of the client.
+func ChaosStatus(probability float64, statusCode int) Chaos {
+	return func(req *ChaosRequest) (*http.Response, error) {
+		if chaosRandom() < probability {
+			return ChaosResponse(statusCode), nil
+		}
+		return nil, nil
+	}
+}
+
+// ChaosError returns a Chaos failing the given fraction of attempts with err, as if the connection failed
+func ChaosError(probability float64, err error) Chaos {
+	return func(req *ChaosRequest) (*http.Response, error) {
+		if chaosRandom() < probability {
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+// ChaosMutate returns a Chaos calling mutate with the given fraction of attempts, to e.g. remove a header
+// or corrupt the body, before they are sent
+func ChaosMutate(probability float64, mutate func(req *ChaosRequest)) Chaos {
+	return func(req *ChaosRequest) (*http.Response, error) {
+		if chaosRandom() < probability {
+			mutate(req)
+		}
+		return nil, nil
+	}
+}
+
+// ChaosChain returns a Chaos calling each of chaos in turn, until one of them returns a response or an error
+func ChaosChain(chaos ...Chaos) Chaos {
+	return func(req *ChaosRequest) (*http.Response, error) {
+		for _, c := range chaos {
+			if resp, err := c(req); resp != nil || err != nil {
+				return resp, err
+			}
+		}
+		return nil, nil
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !cosmoschaos
+// +build !cosmoschaos
+
+package cosmosapi
+
+import "net/http"
+
+// chaosEnabled is true if Config.Chaos is called
+const chaosEnabled = false
+
+// send sends an attempt of a request. Config.Chaos is ignored, as the binary is not built with the
+// cosmoschaos build tag.
+func (c *Client) send(cli *http.Client, r *http.Request, body *requestBody, attempt int) (*http.Response, error) {
+	return cli.Do(r)
+}
@@ -0,0 +1,40 @@
+//go:build cosmoschaos
+// +build cosmoschaos
+
+package cosmosapi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// chaosEnabled is true if Config.Chaos is called
+const chaosEnabled = true
+
+// send sends an attempt of a request, through Config.Chaos if it is set
+func (c *Client) send(cli *http.Client, r *http.Request, body *requestBody, attempt int) (*http.Response, error) {
+	if c.Config.Chaos == nil {
+		return cli.Do(r)
+	}
+	req := &ChaosRequest{Method: r.Method, Link: strings.TrimPrefix(r.URL.Path, "/"), Headers: r.Header, Attempt: attempt}
+	if body != nil {
+		req.Body = append([]byte(nil), body.buf.Bytes()...)
+	}
+	resp, err := c.Config.Chaos(req)
+	if resp != nil || err != nil {
+		// Not sent, so release the body as the transport would have
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return resp, err
+	}
+	if body != nil && !bytes.Equal(req.Body, body.buf.Bytes()) {
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(req.Body))
+		r.ContentLength = int64(len(req.Body))
+		defer func() { r.ContentLength = body.len() }()
+	}
+	return cli.Do(r)
+}
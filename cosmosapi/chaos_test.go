@@ -0,0 +1,94 @@
+package cosmosapi
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaos(t *testing.T) {
+	var bodies, chaosHeaders []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		chaosHeaders = append(chaosHeaders, r.Header.Get("x-chaos"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "a"}`))
+	}))
+	defer ts.Close()
+
+	var attempts []int
+	c := New(ts.URL, Config{MasterKey: TestKey, MaxRetries: 3}, nil, nil)
+	c.Config.Chaos = func(req *ChaosRequest) (*http.Response, error) {
+		attempts = append(attempts, req.Attempt)
+		assert.Equal(t, "dbs/db/colls/coll/docs", req.Link)
+		if req.Attempt == 0 {
+			return ChaosResponse(http.StatusServiceUnavailable), nil
+		}
+		req.Headers.Set("x-chaos", "1")
+		return nil, nil
+	}
+	ctx := context.Background()
+	create := func() (DocumentResponse, error) {
+		_, response, err := c.CreateDocument(ctx, "db", "coll", map[string]interface{}{"id": "a"}, CreateDocumentOptions{PartitionKeyValue: "a"})
+		return response, err
+	}
+
+	// The injected status is retried, and the modified headers sent
+	response, err := create()
+	require.NoError(t, err)
+	if !chaosEnabled {
+		// Not built with the cosmoschaos tag, so Chaos is ignored
+		assert.Empty(t, attempts)
+		assert.Equal(t, 0, response.RetryCount)
+		assert.Equal(t, []string{""}, chaosHeaders)
+		return
+	}
+	assert.Equal(t, []int{0, 1}, attempts)
+	assert.Equal(t, 1, response.RetryCount)
+	assert.Equal(t, []string{"1"}, chaosHeaders)
+
+	// A modified body is sent
+	c.Config.Chaos = ChaosMutate(1, func(req *ChaosRequest) { req.Body = []byte(`{"id": "corrupted"}`) })
+	_, err = create()
+	require.NoError(t, err)
+	assert.Equal(t, `{"id": "corrupted"}`, bodies[1])
+
+	// Injected errors fail the request
+	c.Config.Chaos = ChaosError(1, errors.New("connection reset"))
+	_, err = create()
+	assert.EqualError(t, errors.Cause(err), "connection reset")
+	assert.Len(t, bodies, 2)
+}
+
+func TestChaosFaults(t *testing.T) {
+	defer func() { chaosRandom = rand.Float64 }()
+	chaosRandom = func() float64 { return 0.5 }
+	req := &ChaosRequest{Headers: http.Header{}}
+
+	resp, err := ChaosStatus(0.4, http.StatusTooManyRequests)(req)
+	assert.Nil(t, resp)
+	assert.NoError(t, err)
+	resp, err = ChaosStatus(0.6, http.StatusTooManyRequests)(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	failed := errors.New("connection reset")
+	chaos := ChaosChain(
+		ChaosMutate(0.6, func(req *ChaosRequest) { req.Headers.Set("x-chaos", "1") }),
+		ChaosError(0.4, failed),
+		ChaosError(0.6, failed),
+		ChaosStatus(1, http.StatusServiceUnavailable),
+	)
+	resp, err = chaos(req)
+	assert.Nil(t, resp)
+	assert.Equal(t, failed, err)
+	assert.Equal(t, "1", req.Headers.Get("x-chaos"))
+}
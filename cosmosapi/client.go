@@ -1,22 +1,29 @@
 package cosmosapi
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/vippsas/go-cosmosdb/logging"
 )
 
+// Versions of the Cosmos REST API, sent in the x-ms-version header. Newer features require a minimum
+// version; operations that need one send it, unless Config.APIVersion or WithAPIVersion asks for a
+// newer one.
 const (
-	apiVersion = "2018-12-31"
+	// DefaultAPIVersion is used when Config.APIVersion is not set
+	DefaultAPIVersion = "2018-12-31"
+	// PatchAPIVersion is the minimum for PatchDocument and for patch operations in ExecuteBatch
+	PatchAPIVersion = "2020-07-15"
 )
 
 var (
@@ -29,10 +36,12 @@ var (
 
 type ResponseBase struct {
 	RequestCharge float64
+	// StatusCode is the HTTP status of the response
+	StatusCode int
 }
 
-func parseHttpResponse(httpResponse *http.Response) (ResponseBase, error) {
-	response := ResponseBase{}
+func parseHttpResponse(httpResponse *cosmosResponse) (ResponseBase, error) {
+	response := ResponseBase{StatusCode: httpResponse.StatusCode}
 	if header := httpResponse.Header.Get(HEADER_REQUEST_CHARGE); header != "" {
 		if requestCharge, err := strconv.ParseFloat(header, 64); err != nil {
 			return response, errors.WithStack(err)
@@ -46,8 +55,36 @@ func parseHttpResponse(httpResponse *http.Response) (ResponseBase, error) {
 // Config is required as input parameter for the constructor creating a new
 // cosmosdb client.
 type Config struct {
-	MasterKey  string
+	MasterKey string
+	// MaxRetries is the number of times throttled (429) and unavailable (503) requests are retried, with
+	// exponential backoff. It is ignored if RetryPolicy is set.
 	MaxRetries int
+	// RetryPolicy, if set, governs which requests are retried, how many times and after which delay,
+	// honoring the delay suggested by Cosmos. See RetryPolicy.
+	RetryPolicy *RetryPolicy
+	// Policy, if set, is consulted before every request and can reject it. See Policy.
+	Policy Policy
+	// ReadOnly makes the client reject all requests that may modify data with ErrReadOnly, without
+	// sending them. Use it for e.g. reporting services and disaster recovery read replicas.
+	ReadOnly bool
+	// RUMeter, if set, records the request charge of every response. See OfferReport.
+	RUMeter *RUMeter
+	// Now, if set, is used instead of time.Now to date requests
+	Now func() time.Time
+	// OnClockSkew, if set, is called when a request is rejected because the local clock differs from that of
+	// Cosmos, with the difference; see adjustForClockSkew. Use it to log a warning.
+	OnClockSkew func(skew time.Duration)
+	// UseNumber makes numbers in response bodies that are decoded into interface{} values (e.g. in a
+	// map[string]interface{}) json.Number rather than float64, which keeps the exact value of e.g. monetary
+	// amounts. Fields declared as json.Number keep the exact value regardless.
+	UseNumber bool
+	// APIVersion, if set, is the REST API version to use instead of DefaultAPIVersion, to use features
+	// that require a newer version. Operations requiring a version newer than this still get it.
+	APIVersion string
+	// Chaos, if set, is called before every attempt of a request is sent, and can modify or fail it, for
+	// chaos testing. It is only called in binaries built with the cosmoschaos build tag, and is ignored
+	// otherwise, so that faults can not be injected in production by mistake. See Chaos.
+	Chaos Chaos
 }
 
 type Client struct {
@@ -55,6 +92,11 @@ type Client struct {
 	Config Config
 	Client *http.Client
 	Log    logging.ExtendedLogger
+
+	cachedSigner       atomic.Value // *signer
+	cachedCapabilities atomic.Value // AccountCapabilities
+	clockOffset        int64        // nanoseconds to add to the local clock, accessed atomically
+	shutdown           shutdown
 }
 
 // New makes a new client to communicate to a cosmosdb instance.
@@ -77,62 +119,137 @@ func New(url string, cfg Config, cl *http.Client, log logging.StdLogger) *Client
 	return client
 }
 
-func (c *Client) get(ctx context.Context, link string, ret interface{}, headers map[string]string) (*http.Response, error) {
+// signer returns the signer for the configured master key. The decoded key is cached, and re-computed only
+// if Config.MasterKey is changed.
+func (c *Client) signer() (*signer, error) {
+	if s, ok := c.cachedSigner.Load().(*signer); ok && s.key == c.Config.MasterKey {
+		return s, nil
+	}
+	s, err := newSigner(c.Config.MasterKey)
+	if err != nil {
+		return nil, err
+	}
+	c.cachedSigner.Store(s)
+	return s, nil
+}
+
+func (c *Client) get(ctx context.Context, link string, ret interface{}, headers map[string]string) (*cosmosResponse, error) {
 	return c.method(ctx, "GET", link, ret, nil, headers)
 }
 
-func (c *Client) create(ctx context.Context, link string, body, ret interface{}, headers map[string]string) (*http.Response, error) {
-	data, err := stringify(body)
+func (c *Client) create(ctx context.Context, link string, body, ret interface{}, headers map[string]string) (*cosmosResponse, error) {
+	b, err := newRequestBody(body)
 	if err != nil {
 		return nil, err
 	}
-	buf := bytes.NewBuffer(data)
+	defer b.release()
 
-	return c.method(ctx, "POST", link, ret, buf, headers)
+	return c.method(ctx, "POST", link, ret, b, headers)
 }
 
-func (c *Client) replace(ctx context.Context, link string, body, ret interface{}, headers map[string]string) (*http.Response, error) {
-	data, err := stringify(body)
+func (c *Client) replace(ctx context.Context, link string, body, ret interface{}, headers map[string]string) (*cosmosResponse, error) {
+	b, err := newRequestBody(body)
 	if err != nil {
 		return nil, err
 	}
-	buf := bytes.NewBuffer(data)
+	defer b.release()
 
-	return c.method(ctx, "PUT", link, ret, buf, headers)
+	return c.method(ctx, "PUT", link, ret, b, headers)
 }
 
-func (c *Client) delete(ctx context.Context, link string, headers map[string]string) (*http.Response, error) {
+func (c *Client) patch(ctx context.Context, link string, body, ret interface{}, headers map[string]string) (*cosmosResponse, error) {
+	b, err := newRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	defer b.release()
+
+	return c.method(ctx, "PATCH", link, ret, b, headers)
+}
+
+func (c *Client) delete(ctx context.Context, link string, headers map[string]string) (*cosmosResponse, error) {
 	return c.method(ctx, "DELETE", link, nil, nil, headers)
 }
 
-func (c *Client) query(ctx context.Context, link string, body, ret interface{}, headers map[string]string) (*http.Response, error) {
+func (c *Client) query(ctx context.Context, link string, body, ret interface{}, headers map[string]string) (*cosmosResponse, error) {
 	return c.create(ctx, link, body, ret, headers)
 }
 
-func (c *Client) method(ctx context.Context, method, link string, ret interface{}, body io.Reader, headers map[string]string) (*http.Response, error) {
-	req, err := http.NewRequest(method, path(c.Url, link), body)
+func (c *Client) method(ctx context.Context, method, link string, ret interface{}, body *requestBody, headers map[string]string) (*cosmosResponse, error) {
+	rLink, rType := resourceTypeFromLink(strings.TrimPrefix(link, "/"))
+	return c.methodForResource(ctx, method, link, rType, rLink, ret, body, headers)
+}
+
+// Do sends a request to an arbitrary Cosmos REST endpoint, for operations that are not wrapped by the client.
+// It is signed and retried, and its status is mapped to errors, as for the other operations. link is the path
+// of the request, e.g. "dbs/mydb/colls/mycoll/docs" to create a document; resourceType is the type of
+// the resource the request is for (e.g. "docs"), used in the signature. body, if not nil, is serialized as
+// JSON, and a successful response body is deserialized into out, if not nil. The returned response can be
+// used to read the response headers; its body has already been consumed.
+func (c *Client) Do(ctx context.Context, method, resourceType, link string, headers map[string]string, body, out interface{}) (*http.Response, error) {
+	var b *requestBody
+	if body != nil {
+		var err error
+		if b, err = newRequestBody(body); err != nil {
+			return nil, err
+		}
+		defer b.release()
+	}
+	rLink, _ := resourceTypeFromLink(strings.TrimPrefix(link, "/"))
+	resp, err := c.methodForResource(ctx, method, link, resourceType, rLink, out, b, headers)
+	if resp == nil {
+		return nil, err
+	}
+	return resp.Response, err
+}
+
+func (c *Client) methodForResource(ctx context.Context, method, link, rType, rLink string, ret interface{}, body *requestBody, headers map[string]string) (*cosmosResponse, error) {
+	if err := c.shutdown.begin(); err != nil {
+		return nil, err
+	}
+	defer c.shutdown.end()
+	req, err := http.NewRequest(method, path(c.Url, link), nil)
 	if err != nil {
 		c.Log.Errorln(err)
 		return nil, err
 	}
-	defaultHeaders, err := defaultHeaders(method, link, c.Config.MasterKey)
-	if err != nil {
-		return nil, errors.WithMessage(err, "Failed to create request headers")
+	if len(headers) > 0 {
+		req.Header = make(http.Header, len(headers)+3)
 	}
-	if headers == nil {
-		headers = map[string]string{}
+	for k, v := range headers {
+		addHeader(req.Header, k, v)
 	}
-	for k, v := range defaultHeaders {
-		// insert if not already present
-		headers[k] = v
+	// API versions are dates, so the newest sorts last
+	if version := c.Config.APIVersion; version != "" && version > req.Header.Get(HEADER_VER) {
+		req.Header.Set(HEADER_VER, version)
 	}
-	for k, v := range headers {
-		req.Header.Add(k, v)
+	for k, v := range ContextHeaders(ctx) {
+		req.Header[k] = v
+	}
+	if id := CorrelationId(ctx); id != "" && req.Header.Get(HEADER_CORRELATION_ID) == "" {
+		req.Header.Set(HEADER_CORRELATION_ID, id)
+	}
+	if err := c.checkPolicy(method, link, req.Header, body); err != nil {
+		return nil, err
+	}
+	s, err := c.signer()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to create request headers")
+	}
+	setDefaultHeadersForResource(req.Header, method, rType, rLink, s, c.now())
+	resp, err := c.do(ctx, req, body, ret)
+	if errors.Cause(err) == ErrUnautorized && resp != nil && c.adjustForClockSkew(resp.Response) {
+		// Sign the request again with the adjusted clock
+		setDefaultHeadersForResource(req.Header, method, rType, rLink, s, c.now())
+		resp, err = c.do(ctx, req, body, ret)
 	}
-	return c.do(ctx, req, ret)
+	return resp, err
 }
 
-func retriable(code int) bool {
+func (c *Client) retriable(code int) bool {
+	if c.Config.RetryPolicy != nil {
+		return c.Config.RetryPolicy.retriable(code)
+	}
 	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
 }
 
@@ -148,7 +265,7 @@ func (e RequestError) Error() string {
 }
 
 func (c *Client) checkResponse(resp *http.Response) error {
-	if retriable(resp.StatusCode) {
+	if c.retriable(resp.StatusCode) {
 		return errRetry
 	}
 	if cosmosError, ok := CosmosHTTPErrors[resp.StatusCode]; ok {
@@ -158,8 +275,26 @@ func (c *Client) checkResponse(resp *http.Response) error {
 
 }
 
+// cosmosResponse is an HTTP response from Cosmos, together with the number of times the client retried the
+// request before it, because of throttling or unavailability
+type cosmosResponse struct {
+	*http.Response
+	retryCount int
+	// errorBody is the body of an error response
+	errorBody []byte
+}
+
+// requestError returns the error described by the body of an error response, if any
+func (resp *cosmosResponse) requestError() (RequestError, bool) {
+	var requestError RequestError
+	if resp == nil || len(resp.errorBody) == 0 || json.Unmarshal(resp.errorBody, &requestError) != nil {
+		return requestError, false
+	}
+	return requestError, true
+}
+
 // Private Do function, DRY
-func (c *Client) do(ctx context.Context, r *http.Request, data interface{}) (*http.Response, error) {
+func (c *Client) do(ctx context.Context, r *http.Request, body *requestBody, data interface{}) (*cosmosResponse, error) {
 	cli := c.Client
 	if cli == nil {
 		cli = http.DefaultClient
@@ -167,48 +302,56 @@ func (c *Client) do(ctx context.Context, r *http.Request, data interface{}) (*ht
 	if !IgnoreContext {
 		r = r.WithContext(ctx)
 	}
-	// save body to be able to retry the request
-	b := []byte{}
-	if r.Body != nil {
-		var err error
-		b, err = ioutil.ReadAll(r.Body)
-		if err != nil {
-			return nil, err
+	if body != nil {
+		// keep the body around to be able to retry the request
+		r.ContentLength = body.len()
+		r.GetBody = func() (io.ReadCloser, error) {
+			return body.reader(), nil
 		}
 	}
 
 	var resp *http.Response
-	for retryCount := 0; retryCount <= c.Config.MaxRetries; retryCount++ {
+	var waited time.Duration
+	var retryCount int
+	for ; ; retryCount++ {
 		var err error
 		if retryCount > 0 {
-			delay := backoffDelay(retryCount)
+			delay, retry := c.retryDelay(retryCount, waited, resp)
+			if !retry {
+				break
+			}
+			waited += delay
 			t := time.NewTimer(delay)
 			select {
 			case <-ctx.Done():
 				t.Stop()
-				return nil, ctx.Err()
+				return nil, withCorrelationId(ctx, retried(ctx.Err(), retryCount-1))
 			case <-t.C:
 			}
 		}
 
-		r.Body = ioutil.NopCloser(bytes.NewReader(b))
-		c.Log.Debugf("Cosmos request: %s %s (headers: %s) (attempt: %d/%d)\n", r.Method, r.URL, r.Header, retryCount+1, c.Config.MaxRetries)
-		resp, err = cli.Do(r)
+		if body != nil {
+			r.Body = body.reader()
+		}
+		c.Log.Debugf("Cosmos request: %s %s (headers: %s) (attempt: %d)\n", r.Method, r.URL, r.Header, retryCount+1)
+		resp, err = c.send(cli, r, body, retryCount)
 		if err != nil {
-			return nil, err
+			return nil, withCorrelationId(ctx, retried(err, retryCount))
 		}
-		c.Log.Debugf("Cosmos response: %s (headers: %s)", resp.Status, resp.Header)
-		err = c.handleResponse(ctx, r, resp, data)
+		c.Log.Debugf("Cosmos response: %s (correlation id: %s) (headers: %s)", resp.Status, CorrelationId(ctx), resp.Header)
+		errorBody, err := c.handleResponse(ctx, r, resp, data)
 		if err == errRetry {
 			continue
 		}
-		return resp, err
+		return &cosmosResponse{Response: resp, retryCount: retryCount, errorBody: errorBody}, withCorrelationId(ctx, retried(err, retryCount))
 	}
-	return resp, ErrMaxRetriesExceeded
+	return &cosmosResponse{Response: resp, retryCount: retryCount - 1}, withCorrelationId(ctx, retried(ErrMaxRetriesExceeded, retryCount-1))
 }
 
-func (c *Client) handleResponse(ctx context.Context, req *http.Request, resp *http.Response, ret interface{}) error {
+// handleResponse reads the response into ret; if the response is an error, its body is returned with the error
+func (c *Client) handleResponse(ctx context.Context, req *http.Request, resp *http.Response, ret interface{}) ([]byte, error) {
 	defer resp.Body.Close()
+	c.recordRequestCharge(req, resp)
 	if ResponseHook != nil {
 		ResponseHook(ctx, req.Method, resp.Header)
 	}
@@ -217,20 +360,42 @@ func (c *Client) handleResponse(ctx context.Context, req *http.Request, resp *ht
 	if err != nil {
 		b, readErr := ioutil.ReadAll(resp.Body)
 		if readErr == nil {
-			c.Log.Debugln("Error response from Cosmos DB: " + string(b))
+			c.Log.Debugf("Error response from Cosmos DB (correlation id: %s): %s\n", CorrelationId(ctx), string(b))
 		}
-		return err
+		return b, err
 	}
 
-	if ret == nil {
-		return nil
+	if ret == nil || resp.StatusCode == http.StatusNotModified {
+		return nil, nil
 	}
 	if resp.ContentLength == 0 {
-		return nil
+		return nil, nil
 	}
-	err = readJson(resp.Body, ret)
+	var body io.Reader = resp.Body
+	var counter *countingReader
+	if resp.ContentLength < 0 {
+		// E.g. chunked or transparently decompressed; count the bytes so that the size is known to callers
+		counter = &countingReader{r: resp.Body}
+		body = counter
+	}
+	err = readJson(body, ret, c.Config.UseNumber)
 	// even if JSON parsing failed, we still want to consume all bytes from Body
 	// in order to reuse the connection.
-	io.Copy(ioutil.Discard, resp.Body)
-	return err
+	io.Copy(ioutil.Discard, body)
+	if counter != nil {
+		resp.ContentLength = counter.n
+	}
+	return nil, err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
 }
@@ -2,10 +2,12 @@ package cosmosapi
 
 import (
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,3 +31,64 @@ func TestOne(t *testing.T) {
 	_, err := c.GetDatabase(context.Background(), "ToDoList", nil)
 	assert.NotNil(t, err)
 }
+
+func TestRequestAndResponseBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(b)), r.ContentLength)
+		assert.JSONEq(t, `{"id":"MyDb"}`, string(b))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"MyDb","_rid":"rid"}`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	for i := 0; i != 3; i++ {
+		db, err := c.CreateDatabase(context.Background(), "MyDb", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "rid", db.Rid)
+	}
+}
+
+func TestRequestBodyRelease(t *testing.T) {
+	b, err := newRequestBody(map[string]string{"id": "foo"})
+	assert.NoError(t, err)
+	r1, r2 := b.reader(), b.reader()
+	b.release()
+	assert.Equal(t, int32(2), b.refs)
+	r1.Close()
+	r1.Close() // closing twice must not release twice
+	assert.Equal(t, int32(1), b.refs)
+	r2.Close()
+	assert.Equal(t, int32(0), b.refs)
+}
+
+func TestDo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/dbs/db/colls/coll/udfs", r.URL.Path)
+		assert.Equal(t, "value", r.Header.Get("x-ms-custom"))
+		c := New("", Config{MasterKey: TestKey}, nil, nil)
+		expected, _ := c.Sign("POST", "udfs", "dbs/db/colls/coll", r.Header.Get(HEADER_XDATE))
+		assert.Equal(t, expected, r.Header.Get(HEADER_AUTH))
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"id": "udf"}`, string(b))
+		w.Header().Set(HEADER_REQUEST_CHARGE, "2")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "udf", "_etag": "etag"}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	var out Resource
+	resp, err := c.Do(context.Background(), "POST", "udfs", "dbs/db/colls/coll/udfs",
+		map[string]string{"x-ms-custom": "value"}, map[string]string{"id": "udf"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "etag", out.Etag)
+	assert.Equal(t, "2", resp.Header.Get(HEADER_REQUEST_CHARGE))
+
+	_, err = New(ts.URL, Config{MasterKey: TestKey, ReadOnly: true}, nil, nil).
+		Do(context.Background(), "POST", "udfs", "dbs/db/colls/coll/udfs", nil, nil, nil)
+	assert.Equal(t, ErrReadOnly, errors.Cause(err))
+}
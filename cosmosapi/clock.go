@@ -0,0 +1,49 @@
+package cosmosapi
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// clockSkewTolerance is how far the local clock may be from that of Cosmos before it is adjusted. Cosmos
+// rejects requests dated more than 15 minutes from its own time.
+const clockSkewTolerance = time.Minute
+
+// now returns the time to date requests with, i.e. the local time adjusted for the clock skew found
+func (c *Client) now() time.Time {
+	now := time.Now
+	if c.Config.Now != nil {
+		now = c.Config.Now
+	}
+	return now().Add(time.Duration(atomic.LoadInt64(&c.clockOffset)))
+}
+
+// adjustForClockSkew is called with a response to a request that was rejected as unauthorized. If the Date
+// header of the response shows that the local clock differs from that of Cosmos, which makes Cosmos reject
+// the request date, the clock used for dating requests is adjusted, OnClockSkew is called, and true is
+// returned to retry the request.
+func (c *Client) adjustForClockSkew(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return false
+	}
+	if remaining := serverTime.Sub(c.now()); remaining > -clockSkewTolerance && remaining < clockSkewTolerance {
+		// Already in sync, so the request was rejected for some other reason
+		return false
+	}
+	now := time.Now
+	if c.Config.Now != nil {
+		now = c.Config.Now
+	}
+	skew := serverTime.Sub(now())
+	atomic.StoreInt64(&c.clockOffset, int64(skew))
+	c.Log.Warnf("Local clock is %v off from that of Cosmos; adjusting the request date\n", -skew)
+	if c.Config.OnClockSkew != nil {
+		c.Config.OnClockSkew(skew)
+	}
+	return true
+}
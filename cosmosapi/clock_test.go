@@ -0,0 +1,59 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockSkew(t *testing.T) {
+	serverTime := time.Now().Add(time.Hour)
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+		date, err := http.ParseTime(r.Header.Get(HEADER_XDATE))
+		require.NoError(t, err)
+		if d := serverTime.Sub(date); d > 15*time.Minute || d < -15*time.Minute {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	var skews []time.Duration
+	c := New(ts.URL, Config{MasterKey: TestKey, OnClockSkew: func(skew time.Duration) {
+		skews = append(skews, skew)
+	}}, nil, nil)
+
+	// The request is retried with the adjusted clock
+	_, err := c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, nil)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 2, requests)
+	require.Len(t, skews, 1)
+	assert.InDelta(t, time.Hour.Seconds(), skews[0].Seconds(), 2)
+
+	// Later requests use the adjusted clock right away
+	_, err = c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, nil)
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 3, requests)
+
+	// A 401 when the clocks agree is not retried
+	requests = 0
+	ts401 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts401.Close()
+	c = New(ts401.URL, Config{MasterKey: TestKey}, nil, nil)
+	_, err = c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, nil)
+	assert.Equal(t, ErrUnautorized, err)
+	assert.Equal(t, 1, requests)
+}
@@ -19,6 +19,11 @@ type Collection struct {
 	Triggers       string          `json:"_triggers,omitempty"`
 	Conflicts      string          `json:"_conflicts,omitempty"`
 	PartitionKey   *PartitionKey   `json:"partitionKey,omitempty"`
+	// UniqueKeyPolicy is nil if the collection has no unique keys
+	UniqueKeyPolicy *UniqueKeyPolicy `json:"uniqueKeyPolicy,omitempty"`
+	// DefaultTimeToLive is nil if TTL is disabled, -1 if enabled without a default, and otherwise the
+	// default TTL in seconds
+	DefaultTimeToLive *int `json:"defaultTtl,omitempty"`
 }
 
 type DocumentCollection struct {
@@ -33,15 +38,17 @@ type IndexingPolicy struct {
 	Included     []IncludedPath   `json:"includedPaths,omitempty"`
 	Excluded     []ExcludedPath   `json:"excludedPaths,omitempty"`
 	Composite    []CompositeIndex `json:"compositeIndexes,omitempty"`
+	Spatial      []SpatialIndex   `json:"spatialIndexes,omitempty"`
 }
 
 type IndexingMode string
 
-//const (
-//	Consistent = IndexingMode("Consistent")
-//	Lazy       = IndexingMode("Lazy")
-//)
-//
+const (
+	IndexingModeConsistent = IndexingMode("consistent")
+	// IndexingModeNone disables indexing; Automatic must then be false
+	IndexingModeNone = IndexingMode("none")
+)
+
 //const (
 //	OfferTypeS1 = OfferType("S1")
 //	OfferTypeS2 = OfferType("S2")
@@ -51,14 +58,35 @@ type IndexingMode string
 type PartitionKey struct {
 	Paths []string `json:"paths"`
 	Kind  string   `json:"kind"`
+	// Version 2 hashes the whole value of the partition key, rather than its first 100 bytes; it is needed for
+	// partition key values longer than that. 0 leaves the default of the service.
+	Version int `json:"version,omitempty"`
 }
 
+// CollectionReplaceOptions is the new definition of a collection. The partition key and unique key policy of
+// a collection can not be changed, so they must be the ones it has; see Collection.ReplaceOptions.
 type CollectionReplaceOptions struct {
 	Resource
-	Id                string          `json:"id"`
-	IndexingPolicy    *IndexingPolicy `json:"indexingPolicy,omitempty"`
-	PartitionKey      *PartitionKey   `json:"partitionKey,omitempty"`
-	DefaultTimeToLive int             `json:"defaultTtl,omitempty"`
+	Id              string           `json:"id"`
+	IndexingPolicy  *IndexingPolicy  `json:"indexingPolicy,omitempty"`
+	PartitionKey    *PartitionKey    `json:"partitionKey,omitempty"`
+	UniqueKeyPolicy *UniqueKeyPolicy `json:"uniqueKeyPolicy,omitempty"`
+	// DefaultTimeToLive is -1 to enable TTL without a default, the default TTL in seconds, or 0 to disable TTL
+	DefaultTimeToLive int `json:"defaultTtl,omitempty"`
+}
+
+// ReplaceOptions returns the current definition of the collection, to modify and pass to ReplaceCollection
+func (c Collection) ReplaceOptions() CollectionReplaceOptions {
+	ops := CollectionReplaceOptions{
+		Id:              c.Id,
+		IndexingPolicy:  c.IndexingPolicy,
+		PartitionKey:    c.PartitionKey,
+		UniqueKeyPolicy: c.UniqueKeyPolicy,
+	}
+	if c.DefaultTimeToLive != nil {
+		ops.DefaultTimeToLive = *c.DefaultTimeToLive
+	}
+	return ops
 }
 
 func (c *Client) GetCollection(ctx context.Context, dbName, colName string) (*Collection, error) {
@@ -0,0 +1,93 @@
+package cosmosapi
+
+import (
+	"context"
+	"sort"
+)
+
+// CollectionStatistics is a collection read with GetCollectionStatistics
+type CollectionStatistics struct {
+	Collection *Collection
+	// Partitions has the statistics of each partition key range (physical partition) of the collection
+	Partitions []PartitionKeyRangeStatistics
+	// ResourceQuota and ResourceUsage are the quota and usage of the collection, as semicolon-separated
+	// key=value pairs, e.g. "documentsSize=1024;documentsCount=10"
+	ResourceQuota string
+	ResourceUsage string
+}
+
+// PartitionKeyRangeStatistics is the size of a partition key range, with the largest logical partitions in it.
+// The statistics are sampled by the service, so they are estimates.
+type PartitionKeyRangeStatistics struct {
+	// Id is the id of the partition key range, see GetPartitionKeyRanges
+	Id                               string `json:"id"`
+	SizeInKB                         int64  `json:"sizeInKB"`
+	DocumentCount                    int64  `json:"documentCount"`
+	SampledDistinctPartitionKeyCount int64  `json:"sampledDistinctPartitionKeyCount,omitempty"`
+	// PartitionKeys has the largest logical partitions of the range
+	PartitionKeys []PartitionKeyStatistics `json:"partitionKeys,omitempty"`
+}
+
+// PartitionKeyStatistics is the size of a logical partition
+type PartitionKeyStatistics struct {
+	// PartitionKey is the partition key value, as an array of one element like in HEADER_PARTITIONKEY
+	PartitionKey []interface{} `json:"partitionKey"`
+	SizeInKB     int64         `json:"sizeInKB"`
+	// PartitionKeyRangeId is the id of the partition key range the logical partition is in; it is set by
+	// LargestPartitionKeys
+	PartitionKeyRangeId string `json:"-"`
+}
+
+// Value returns the partition key value
+func (s PartitionKeyStatistics) Value() interface{} {
+	if len(s.PartitionKey) == 0 {
+		return nil
+	}
+	return s.PartitionKey[0]
+}
+
+// collectionWithStatistics is the body of a collection read with HEADER_POPULATE_PARTITION_STATISTICS
+type collectionWithStatistics struct {
+	Collection
+	Statistics []PartitionKeyRangeStatistics `json:"statistics"`
+}
+
+// GetCollectionStatistics reads a collection together with its quota and usage, and the size of each of its
+// partition key ranges and of the largest logical partitions in them; these are otherwise only shown in the
+// portal. The read is more expensive than GetCollection, so use it for tooling rather than on every request.
+func (c *Client) GetCollectionStatistics(ctx context.Context, dbName, colName string) (*CollectionStatistics, error) {
+	var collection collectionWithStatistics
+	headers := map[string]string{
+		HEADER_POPULATE_QUOTA_INFO:           "true",
+		HEADER_POPULATE_PARTITION_STATISTICS: "true",
+	}
+	resp, err := c.get(ctx, CreateCollLink(dbName, colName), &collection, headers)
+	if err != nil {
+		return nil, err
+	}
+	return &CollectionStatistics{
+		Collection:    &collection.Collection,
+		Partitions:    collection.Statistics,
+		ResourceQuota: getHeader(resp.Header, HEADER_RESOURCE_QUOTA),
+		ResourceUsage: getHeader(resp.Header, HEADER_RESOURCE_USAGE),
+	}, nil
+}
+
+// LargestPartitionKeys returns the n largest logical partitions across all the partition key ranges, largest
+// first; or all of them if n is 0
+func (s CollectionStatistics) LargestPartitionKeys(n int) []PartitionKeyStatistics {
+	var result []PartitionKeyStatistics
+	for _, partition := range s.Partitions {
+		for _, pk := range partition.PartitionKeys {
+			pk.PartitionKeyRangeId = partition.Id
+			result = append(result, pk)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].SizeInKB > result[j].SizeInKB
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,124 @@
+package cosmosapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCollectionJson = `{
+	"id": "coll",
+	"indexingPolicy": {
+		"indexingMode": "consistent",
+		"automatic": true,
+		"includedPaths": [{"path": "/*"}],
+		"excludedPaths": [{"path": "/blob/*"}],
+		"compositeIndexes": [[{"path": "/name", "order": "ascending"}, {"path": "/age", "order": "descending"}]],
+		"spatialIndexes": [{"path": "/location/*", "types": ["Point", "Polygon"]}]
+	},
+	"partitionKey": {"paths": ["/userId"], "kind": "Hash", "version": 2},
+	"uniqueKeyPolicy": {"uniqueKeys": [{"paths": ["/email"]}]},
+	"defaultTtl": -1
+}`
+
+func TestCollections(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/dbs/db/colls/":
+			b, _ := ioutil.ReadAll(r.Body)
+			assert.JSONEq(t, testCollectionJson, string(b))
+			assert.Equal(t, `{"maxThroughput":4000}`, r.Header.Get(HEADER_OFFER_AUTOPILOT_SETTINGS))
+			w.WriteHeader(http.StatusCreated)
+			w.Write(b)
+		case r.Method == "GET" && r.URL.Path == "/dbs/db/colls/coll":
+			w.Write([]byte(testCollectionJson))
+		case r.Method == "PUT" && r.URL.Path == "/dbs/db/colls/coll":
+			b, _ := ioutil.ReadAll(r.Body)
+			assert.Contains(t, string(b), `"uniqueKeyPolicy":{"uniqueKeys":[{"paths":["/email"]}]}`)
+			assert.Contains(t, string(b), `"excludedPaths":[{"path":"/blob/*"},{"path":"/other/*"}]`)
+			assert.NotContains(t, string(b), `"defaultTtl"`)
+			w.Write(b)
+		case r.Method == "DELETE" && r.URL.Path == "/dbs/db/colls/coll":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	ctx := context.Background()
+
+	created, err := c.CreateCollection(ctx, "db", CreateCollectionOptions{
+		Id: "coll",
+		IndexingPolicy: &IndexingPolicy{
+			IndexingMode: IndexingModeConsistent,
+			Automatic:    true,
+			Included:     []IncludedPath{{Path: "/*"}},
+			Excluded:     []ExcludedPath{{Path: "/blob/*"}},
+			Composite:    []CompositeIndex{{{Path: "/name", Order: Ascending}, {Path: "/age", Order: Descending}}},
+			Spatial:      []SpatialIndex{{Path: "/location/*", Types: []DataType{PointType, PolygonType}}},
+		},
+		PartitionKey:           &PartitionKey{Paths: []string{"/userId"}, Kind: "Hash", Version: 2},
+		UniqueKeyPolicy:        &UniqueKeyPolicy{UniqueKeys: []UniqueKey{{Paths: []string{"/email"}}}},
+		AutoscaleMaxThroughput: 4000,
+		DefaultTimeToLive:      -1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, created.Collection.PartitionKey.Version)
+
+	_, err = c.CreateCollection(ctx, "db", CreateCollectionOptions{Id: "coll", OfferThroughput: 400, AutoscaleMaxThroughput: 4000})
+	assert.Equal(t, ErrThroughputAndAutoscale, err)
+
+	coll, err := c.GetCollection(ctx, "db", "coll")
+	require.NoError(t, err)
+	require.NotNil(t, coll.DefaultTimeToLive)
+	assert.Equal(t, -1, *coll.DefaultTimeToLive)
+	assert.Equal(t, []DataType{PointType, PolygonType}, coll.IndexingPolicy.Spatial[0].Types)
+
+	// Add an excluded path and disable TTL, keeping the rest of the definition
+	replaceOps := coll.ReplaceOptions()
+	replaceOps.IndexingPolicy.Excluded = append(replaceOps.IndexingPolicy.Excluded, ExcludedPath{Path: "/other/*"})
+	replaceOps.DefaultTimeToLive = 0
+	replaced, err := c.ReplaceCollection(ctx, "db", replaceOps)
+	require.NoError(t, err)
+	assert.Nil(t, replaced.DefaultTimeToLive)
+	assert.Len(t, replaced.IndexingPolicy.Excluded, 2)
+
+	require.NoError(t, c.DeleteCollection(ctx, "db", "coll"))
+}
+
+func TestCollectionStatistics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/dbs/db/colls/coll", r.URL.Path)
+		assert.Equal(t, "true", r.Header.Get(HEADER_POPULATE_QUOTA_INFO))
+		assert.Equal(t, "true", r.Header.Get(HEADER_POPULATE_PARTITION_STATISTICS))
+		w.Header().Set(HEADER_RESOURCE_QUOTA, "documentsSize=52428800;documentsCount=-1")
+		w.Header().Set(HEADER_RESOURCE_USAGE, "documentsSize=2345;documentsCount=120")
+		w.Write([]byte(`{"id": "coll", "partitionKey": {"paths": ["/userId"], "kind": "Hash"}, "statistics": [
+			{"id": "0", "sizeInKB": 1200, "documentCount": 100, "partitionKeys": [
+				{"partitionKey": ["u1"], "sizeInKB": 300}, {"partitionKey": ["u2"], "sizeInKB": 100}]},
+			{"id": "1", "sizeInKB": 1145, "documentCount": 20, "partitionKeys": [{"partitionKey": ["u3"], "sizeInKB": 900}]}
+		]}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	stats, err := c.GetCollectionStatistics(context.Background(), "db", "coll")
+	require.NoError(t, err)
+	assert.Equal(t, "coll", stats.Collection.Id)
+	assert.Equal(t, "documentsSize=2345;documentsCount=120", stats.ResourceUsage)
+	require.Len(t, stats.Partitions, 2)
+	assert.Equal(t, int64(100), stats.Partitions[0].DocumentCount)
+
+	largest := stats.LargestPartitionKeys(2)
+	require.Len(t, largest, 2)
+	assert.Equal(t, "u3", largest[0].Value())
+	assert.Equal(t, "1", largest[0].PartitionKeyRangeId)
+	assert.Equal(t, int64(300), largest[1].SizeInKB)
+	assert.Len(t, stats.LargestPartitionKeys(0), 3)
+}
@@ -0,0 +1,91 @@
+package cosmosapi
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The well-known endpoint and master key of the local Cosmos DB emulator
+const (
+	EmulatorEndpoint = "https://localhost:8081"
+	EmulatorKey      = "C2y6yDjf5/R+ob0N8A7Cgv30VRDJIWEHLM+4QDU5DE2nQ9nDuVTqobD4b8mGGyPMbIZnqyMsEcaGQy67XIw/Jw=="
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	EnvConnectionString = "COSMOSDB_CONNECTION_STRING"
+	EnvUrl              = "COSMOSDB_URL"
+	EnvKey              = "COSMOSDB_KEY"
+	EnvMaxRetries       = "COSMOSDB_MAX_RETRIES"
+	EnvEmulator         = "COSMOSDB_EMULATOR"
+)
+
+// ParseConnectionString parses a Cosmos connection string on the form
+//
+//	AccountEndpoint=https://myaccount.documents.azure.com:443/;AccountKey=<key>;
+//
+// as found in the Azure portal, and returns the endpoint to pass to New() and a Config with the master key.
+// Keys are case-insensitive and unknown keys are ignored. The connection string
+// "UseDevelopmentEmulator=true" gives the emulator endpoint and key.
+func ParseConnectionString(connectionString string) (endpoint string, cfg Config, err error) {
+	for _, part := range strings.Split(connectionString, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		// The key is base64 and may itself contain '='
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return "", Config{}, errors.Errorf("Invalid connection string element '%s', expected <key>=<value>", part)
+		}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "accountendpoint":
+			endpoint = strings.TrimSpace(kv[1])
+		case "accountkey":
+			cfg.MasterKey = strings.TrimSpace(kv[1])
+		case "usedevelopmentemulator":
+			if strings.EqualFold(strings.TrimSpace(kv[1]), "true") {
+				endpoint, cfg.MasterKey = EmulatorEndpoint, EmulatorKey
+			}
+		}
+	}
+	if endpoint == "" || cfg.MasterKey == "" {
+		return "", Config{}, errors.New("Connection string must contain both AccountEndpoint and AccountKey")
+	}
+	return strings.TrimRight(endpoint, "/"), cfg, nil
+}
+
+// ConfigFromEnv returns the endpoint and Config given by the environment. If COSMOSDB_CONNECTION_STRING is
+// set it is parsed with ParseConnectionString; otherwise COSMOSDB_URL and COSMOSDB_KEY are used. If
+// COSMOSDB_EMULATOR=true, the emulator endpoint and key are used for those that are not set.
+// COSMOSDB_MAX_RETRIES optionally sets Config.MaxRetries.
+func ConfigFromEnv() (endpoint string, cfg Config, err error) {
+	if connectionString := os.Getenv(EnvConnectionString); connectionString != "" {
+		endpoint, cfg, err = ParseConnectionString(connectionString)
+		if err != nil {
+			return "", Config{}, errors.Wrap(err, EnvConnectionString)
+		}
+	} else {
+		endpoint, cfg.MasterKey = os.Getenv(EnvUrl), os.Getenv(EnvKey)
+		if emulator, _ := strconv.ParseBool(os.Getenv(EnvEmulator)); emulator {
+			if endpoint == "" {
+				endpoint = EmulatorEndpoint
+			}
+			if cfg.MasterKey == "" {
+				cfg.MasterKey = EmulatorKey
+			}
+		}
+		if endpoint == "" || cfg.MasterKey == "" {
+			return "", Config{}, errors.Errorf("Either %s, or both %s and %s, must be set", EnvConnectionString, EnvUrl, EnvKey)
+		}
+	}
+	if s := os.Getenv(EnvMaxRetries); s != "" {
+		if cfg.MaxRetries, err = strconv.Atoi(s); err != nil {
+			return "", Config{}, errors.Errorf("Invalid %s: '%s'", EnvMaxRetries, s)
+		}
+	}
+	return strings.TrimRight(endpoint, "/"), cfg, nil
+}
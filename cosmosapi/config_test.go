@@ -0,0 +1,75 @@
+package cosmosapi
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	endpoint, cfg, err := ParseConnectionString("AccountEndpoint=https://myaccount.documents.azure.com:443/;AccountKey=a2V5==;")
+	require.NoError(t, err)
+	assert.Equal(t, "https://myaccount.documents.azure.com:443", endpoint)
+	assert.Equal(t, "a2V5==", cfg.MasterKey)
+
+	endpoint, cfg, err = ParseConnectionString("accountkey=a2V5; ACCOUNTENDPOINT=https://myaccount.documents.azure.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://myaccount.documents.azure.com", endpoint)
+	assert.Equal(t, "a2V5", cfg.MasterKey)
+
+	endpoint, cfg, err = ParseConnectionString("UseDevelopmentEmulator=true")
+	require.NoError(t, err)
+	assert.Equal(t, EmulatorEndpoint, endpoint)
+	assert.Equal(t, EmulatorKey, cfg.MasterKey)
+
+	_, _, err = ParseConnectionString("AccountEndpoint=https://myaccount.documents.azure.com")
+	assert.Error(t, err)
+	_, _, err = ParseConnectionString("AccountEndpoint")
+	assert.Error(t, err)
+}
+
+var configEnvVars = []string{EnvConnectionString, EnvUrl, EnvKey, EnvMaxRetries, EnvEmulator}
+
+func setEnv(env map[string]string) {
+	for _, name := range configEnvVars {
+		if value, ok := env[name]; ok {
+			os.Setenv(name, value)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	saved := map[string]string{}
+	for _, name := range configEnvVars {
+		if value, ok := os.LookupEnv(name); ok {
+			saved[name] = value
+		}
+	}
+	defer setEnv(saved)
+
+	setEnv(map[string]string{EnvUrl: "https://myaccount.documents.azure.com/", EnvKey: "a2V5", EnvMaxRetries: "3"})
+	endpoint, cfg, err := ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "https://myaccount.documents.azure.com", endpoint)
+	assert.Equal(t, Config{MasterKey: "a2V5", MaxRetries: 3}, cfg)
+
+	setEnv(map[string]string{EnvConnectionString: "AccountEndpoint=https://other.documents.azure.com;AccountKey=b3RoZXI=", EnvUrl: "ignored"})
+	endpoint, cfg, err = ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "https://other.documents.azure.com", endpoint)
+	assert.Equal(t, "b3RoZXI=", cfg.MasterKey)
+
+	setEnv(map[string]string{EnvEmulator: "true"})
+	endpoint, cfg, err = ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, EmulatorEndpoint, endpoint)
+	assert.Equal(t, EmulatorKey, cfg.MasterKey)
+
+	setEnv(map[string]string{EnvUrl: "https://myaccount.documents.azure.com"})
+	_, _, err = ConfigFromEnv()
+	assert.Error(t, err)
+}
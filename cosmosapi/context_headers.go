@@ -0,0 +1,36 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+)
+
+type headersKey struct{}
+
+// WithHeader returns a context with an extra request header. Requests made with the context send it, in
+// addition to the headers given by the options of the operation; this gives access to preview features
+// and diagnostics flags for which there are no options yet. It takes precedence over a header with the
+// same name set from the options, but not over the date and authorization headers, which are set when
+// the request is signed. Calling WithHeader again with the same key replaces the value.
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	headers := http.Header{}
+	for k, v := range ContextHeaders(ctx) {
+		headers[k] = v
+	}
+	headers.Set(key, value)
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// ContextHeaders returns the headers added to the context by WithHeader, or nil if there are none. The
+// returned value must not be modified.
+func ContextHeaders(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(headersKey{}).(http.Header)
+	return headers
+}
+
+// WithAPIVersion returns a context making requests use the given REST API version (see Config.APIVersion),
+// e.g. to try a preview feature on some requests only. Unlike Config.APIVersion, it is used even when the
+// operation requires a newer version.
+func WithAPIVersion(ctx context.Context, version string) context.Context {
+	return WithHeader(ctx, HEADER_VER, version)
+}
@@ -0,0 +1,65 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithHeader(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	ctx := WithHeader(context.Background(), "x-ms-cosmos-preview", "true")
+	ctx = WithHeader(ctx, HEADER_CONSISTENCY_LEVEL, "Eventual")
+	other := WithHeader(ctx, "x-ms-cosmos-preview", "false")
+	_, _ = c.GetDocument(ctx, "db", "coll", "doc", GetDocumentOptions{ConsistencyLevel: ConsistencyLevelSession}, nil)
+	assert.Equal(t, "true", got.Get("x-ms-cosmos-preview"))
+	assert.Equal(t, []string{"Eventual"}, got[http.CanonicalHeaderKey(HEADER_CONSISTENCY_LEVEL)])
+	assert.NotEmpty(t, got.Get(HEADER_AUTH))
+
+	// Contexts derived with WithHeader do not affect their parents
+	assert.Equal(t, "false", ContextHeaders(other).Get("x-ms-cosmos-preview"))
+	assert.Equal(t, "true", ContextHeaders(ctx).Get("x-ms-cosmos-preview"))
+
+	_, _ = c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, nil)
+	assert.Empty(t, got.Get("x-ms-cosmos-preview"))
+}
+
+func TestAPIVersion(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(HEADER_VER)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	get := func(c *Client, ctx context.Context) string {
+		_, _ = c.GetDocument(ctx, "db", "coll", "doc", GetDocumentOptions{}, nil)
+		return got
+	}
+	patch := func(c *Client, ctx context.Context) string {
+		_, _ = c.PatchDocument(ctx, "db", "coll", "doc", []PatchOperation{PatchSet("/x", 1)}, PatchDocumentOptions{}, nil)
+		return got
+	}
+
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	assert.Equal(t, DefaultAPIVersion, get(c, context.Background()))
+	assert.Equal(t, PatchAPIVersion, patch(c, context.Background()))
+	assert.Equal(t, "2024-01-01", get(c, WithAPIVersion(context.Background(), "2024-01-01")))
+
+	c = New(ts.URL, Config{MasterKey: TestKey, APIVersion: "2019-01-01"}, nil, nil)
+	assert.Equal(t, "2019-01-01", get(c, context.Background()))
+	assert.Equal(t, PatchAPIVersion, patch(c, context.Background()))
+
+	c = New(ts.URL, Config{MasterKey: TestKey, APIVersion: "2024-01-01"}, nil, nil)
+	assert.Equal(t, "2024-01-01", patch(c, context.Background()))
+	assert.Equal(t, "2018-12-31", patch(c, WithAPIVersion(context.Background(), "2018-12-31")))
+}
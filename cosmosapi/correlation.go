@@ -0,0 +1,51 @@
+package cosmosapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+)
+
+// HEADER_CORRELATION_ID is the request header the correlation id is sent in
+const HEADER_CORRELATION_ID = "x-ms-client-request-id"
+
+type correlationIdKey struct{}
+
+// WithCorrelationId returns a context carrying a correlation id, e.g. the request id of an inbound HTTP
+// request. Requests made with the context send it in the HEADER_CORRELATION_ID header, and it is included in
+// the client's log lines and in the errors it returns, so that Cosmos calls can be tied to the request that
+// caused them. As errors are then wrapped, compare them using errors.Cause.
+func WithCorrelationId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIdKey{}, id)
+}
+
+// CorrelationId returns the correlation id of the context, or "" if there is none
+func CorrelationId(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIdKey{}).(string)
+	return id
+}
+
+// CorrelationIdMiddleware puts the correlation id of inbound requests on the request context, see
+// WithCorrelationId. It is read from the given request header (e.g. "X-Request-Id"); if missing, a random id
+// is generated.
+func CorrelationIdMiddleware(header string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if id == "" {
+			id = uuid.Must(uuid.NewV4()).String()
+		}
+		next.ServeHTTP(w, r.WithContext(WithCorrelationId(r.Context(), id)))
+	})
+}
+
+// withCorrelationId adds the correlation id of the context, if any, to an error
+func withCorrelationId(ctx context.Context, err error) error {
+	id := CorrelationId(ctx)
+	if err == nil || id == "" {
+		return err
+	}
+	return errors.WithMessage(err, fmt.Sprintf("correlation id %s", id))
+}
@@ -0,0 +1,45 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrelationId(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(HEADER_CORRELATION_ID)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	var inbound context.Context
+	handler := CorrelationIdMiddleware("X-Request-Id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inbound = r.Context()
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-Id", "request-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, "request-1", CorrelationId(inbound))
+
+	_, err := c.GetDocument(inbound, "db", "coll", "doc", GetDocumentOptions{}, nil)
+	assert.Equal(t, "request-1", got)
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+	assert.Contains(t, err.Error(), "correlation id request-1")
+
+	// A correlation id is generated if the inbound request has none
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, CorrelationId(inbound))
+
+	// Without a correlation id, errors are returned as is
+	_, err = c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, nil)
+	assert.Equal(t, "", got)
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -2,21 +2,28 @@ package cosmosapi
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+
 	"github.com/pkg/errors"
-	"net/http"
 )
 
 type CreateCollectionOptions struct {
 	Id             string          `json:"id"`
 	IndexingPolicy *IndexingPolicy `json:"indexingPolicy,omitempty"`
 	PartitionKey   *PartitionKey   `json:"partitionKey,omitempty"`
+	// UniqueKeyPolicy can not be changed after the collection is created
+	UniqueKeyPolicy *UniqueKeyPolicy `json:"uniqueKeyPolicy,omitempty"`
 
 	// RTUs [400 - 250000]. Do not use in combination with OfferType
 	OfferThroughput OfferThroughput `json:"offerThroughput,omitempty"`
 	// S1,S2,S3. Do not use in combination with OfferThroughput
-	OfferType         OfferType `json:"offerType,omitempty"`
-	DefaultTimeToLive int       `json:"defaultTtl,omitempty"`
+	OfferType OfferType `json:"offerType,omitempty"`
+	// AutoscaleMaxThroughput provisions autoscale throughput, scaling between 10% of it and it. Do not use in
+	// combination with OfferThroughput or OfferType.
+	AutoscaleMaxThroughput OfferThroughput `json:"-"`
+	// DefaultTimeToLive is -1 to enable TTL without a default, the default TTL in seconds, or 0 to disable TTL
+	DefaultTimeToLive int `json:"defaultTtl,omitempty"`
 }
 
 type CreateCollectionResponse struct {
@@ -39,6 +46,17 @@ func (colOps CreateCollectionOptions) asHeaders() (map[string]string, error) {
 		headers[HEADER_OFFER_TYPE] = fmt.Sprintf("%s", colOps.OfferType)
 	}
 
+	if colOps.AutoscaleMaxThroughput > 0 {
+		if colOps.OfferThroughput > 0 || colOps.OfferType != "" {
+			return nil, ErrThroughputAndAutoscale
+		}
+		settings, err := json.Marshal(AutoscaleSettings{MaxThroughput: colOps.AutoscaleMaxThroughput})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		headers[HEADER_OFFER_AUTOPILOT_SETTINGS] = string(settings)
+	}
+
 	return headers, nil
 }
 
@@ -53,17 +71,8 @@ func (c *Client) CreateCollection(
 	if hErr != nil {
 		return response, hErr
 	}
-
-	if colOps.OfferThroughput > 0 {
-		headers[HEADER_OFFER_THROUGHPUT] = fmt.Sprintf("%d", colOps.OfferThroughput)
-	}
-
-	if colOps.OfferThroughput >= 10000 && colOps.PartitionKey == nil {
-		return response, errors.New(fmt.Sprintf("Must specify PartitionKey for collection '%s' when OfferThroughput is >= 10000", colOps.Id))
-	}
-
-	if colOps.OfferType != "" {
-		headers[HEADER_OFFER_TYPE] = fmt.Sprintf("%s", colOps.OfferType)
+	if len(headers) > 0 && c.isServerless() {
+		return response, ErrServerless
 	}
 
 	link := CreateCollLink(dbName, "")
@@ -77,7 +86,7 @@ func (c *Client) CreateCollection(
 	return response.parse(httpResponse)
 }
 
-func (r CreateCollectionResponse) parse(httpResponse *http.Response) (CreateCollectionResponse, error) {
+func (r CreateCollectionResponse) parse(httpResponse *cosmosResponse) (CreateCollectionResponse, error) {
 	responseBase, err := parseHttpResponse(httpResponse)
 	r.ResponseBase = responseBase
 	return r, err
@@ -2,8 +2,16 @@ package cosmosapi
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
 )
 
+const HEADER_OFFER_AUTOPILOT_SETTINGS = "x-ms-cosmos-offer-autopilot-settings"
+
+var ErrThroughputAndAutoscale = errors.New("Can not specify both OfferThroughput and AutoscaleMaxThroughput")
+
 // Database
 type Database struct {
 	Resource
@@ -13,17 +21,61 @@ type Database struct {
 
 type CreateDatabaseOptions struct {
 	ID string `json:"id"`
+	// OfferThroughput provisions throughput (RU/s) on the database, shared by its collections. If neither it
+	// nor AutoscaleMaxThroughput is set, throughput is provisioned per collection. Not supported by
+	// serverless accounts.
+	OfferThroughput OfferThroughput `json:"-"`
+	// AutoscaleMaxThroughput provisions autoscale throughput on the database instead, scaling between 10% of
+	// it and it. Do not use in combination with OfferThroughput.
+	AutoscaleMaxThroughput OfferThroughput `json:"-"`
+}
+
+// AutoscaleSettings is the value of the x-ms-cosmos-offer-autopilot-settings header
+type AutoscaleSettings struct {
+	MaxThroughput OfferThroughput `json:"maxThroughput"`
+}
+
+func (dbOps CreateDatabaseOptions) asHeaders() (map[string]string, error) {
+	headers := make(map[string]string)
+	if dbOps.OfferThroughput > 0 && dbOps.AutoscaleMaxThroughput > 0 {
+		return nil, ErrThroughputAndAutoscale
+	}
+	if dbOps.OfferThroughput > 0 {
+		headers[HEADER_OFFER_THROUGHPUT] = fmt.Sprintf("%d", dbOps.OfferThroughput)
+	}
+	if dbOps.AutoscaleMaxThroughput > 0 {
+		settings, err := json.Marshal(AutoscaleSettings{MaxThroughput: dbOps.AutoscaleMaxThroughput})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		headers[HEADER_OFFER_AUTOPILOT_SETTINGS] = string(settings)
+	}
+	return headers, nil
 }
 
 func createDatabaseLink(dbName string) string {
 	return "dbs/" + dbName
 }
 
+// requestOptionHeaders adds the headers of ops, if any, to headers
+func requestOptionHeaders(headers map[string]string, ops *RequestOptions) map[string]string {
+	if ops == nil {
+		return headers
+	}
+	if headers == nil {
+		headers = make(map[string]string, len(*ops))
+	}
+	for k, v := range *ops {
+		headers[string(k)] = v
+	}
+	return headers
+}
+
 // https://docs.microsoft.com/en-us/rest/api/cosmos-db/create-a-database
 func (c *Client) CreateDatabase(ctx context.Context, dbName string, ops *RequestOptions) (*Database, error) {
 	db := &Database{}
 
-	_, err := c.create(ctx, createDatabaseLink(""), CreateDatabaseOptions{dbName}, db, nil)
+	_, err := c.create(ctx, createDatabaseLink(""), CreateDatabaseOptions{ID: dbName}, db, requestOptionHeaders(nil, ops))
 	if err != nil {
 		return nil, err
 	}
@@ -31,23 +83,49 @@ func (c *Client) CreateDatabase(ctx context.Context, dbName string, ops *Request
 	return db, nil
 }
 
-func (c *Client) ListDatabases(ctx context.Context, ops *RequestOptions) ([]Database, error) {
-	return nil, ErrorNotImplemented
+// CreateDatabaseWithOptions is like CreateDatabase, but can provision throughput on the database
+func (c *Client) CreateDatabaseWithOptions(ctx context.Context, dbOps CreateDatabaseOptions) (*Database, error) {
+	headers, err := dbOps.asHeaders()
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) > 0 && c.isServerless() {
+		return nil, ErrServerless
+	}
+	db := &Database{}
+	if _, err = c.create(ctx, createDatabaseLink(""), dbOps, db, headers); err != nil {
+		return nil, err
+	}
+	return db, nil
 }
 
-func (c *Client) GetDatabase(ctx context.Context, dbName string, ops *RequestOptions) (*Database, error) {
-	// add optional headers
-	headers := map[string]string{}
-
-	if ops != nil {
-		for k, v := range *ops {
-			headers[string(k)] = v
+// ListDatabases returns all the databases of the account, reading as many pages as needed
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/list-databases
+func (c *Client) ListDatabases(ctx context.Context, ops *RequestOptions) ([]Database, error) {
+	headers := requestOptionHeaders(map[string]string{}, ops)
+	var databases []Database
+	for {
+		var list struct {
+			Databases []Database `json:"Databases"`
 		}
+		resp, err := c.get(ctx, createDatabaseLink(""), &list, headers)
+		if err != nil {
+			return nil, err
+		}
+		databases = append(databases, list.Databases...)
+		continuation := getHeader(resp.Header, HEADER_CONTINUATION)
+		if continuation == "" {
+			return databases, nil
+		}
+		headers[HEADER_CONTINUATION] = continuation
 	}
+}
 
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/get-a-database
+func (c *Client) GetDatabase(ctx context.Context, dbName string, ops *RequestOptions) (*Database, error) {
 	db := &Database{}
 
-	_, err := c.get(ctx, createDatabaseLink(dbName), db, nil)
+	_, err := c.get(ctx, createDatabaseLink(dbName), db, requestOptionHeaders(nil, ops))
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +133,8 @@ func (c *Client) GetDatabase(ctx context.Context, dbName string, ops *RequestOpt
 	return db, nil
 }
 
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/delete-a-database
 func (c *Client) DeleteDatabase(ctx context.Context, dbName string, ops *RequestOptions) error {
-	_, err := c.delete(ctx, createDatabaseLink(dbName), nil)
+	_, err := c.delete(ctx, createDatabaseLink(dbName), requestOptionHeaders(nil, ops))
 	return err
 }
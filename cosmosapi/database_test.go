@@ -0,0 +1,67 @@
+package cosmosapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/dbs/":
+			b, _ := ioutil.ReadAll(r.Body)
+			assert.JSONEq(t, `{"id": "db"}`, string(b))
+			switch r.Header.Get(HEADER_OFFER_THROUGHPUT) {
+			case "":
+				assert.Equal(t, `{"maxThroughput":4000}`, r.Header.Get(HEADER_OFFER_AUTOPILOT_SETTINGS))
+			default:
+				assert.Equal(t, "400", r.Header.Get(HEADER_OFFER_THROUGHPUT))
+				assert.Equal(t, "", r.Header.Get(HEADER_OFFER_AUTOPILOT_SETTINGS))
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": "db", "_rid": "rid"}`))
+		case r.Method == "GET" && r.URL.Path == "/dbs/":
+			if r.Header.Get(HEADER_CONTINUATION) == "" {
+				w.Header().Set(HEADER_CONTINUATION, "more")
+				w.Write([]byte(`{"Databases": [{"id": "a"}, {"id": "b"}]}`))
+			} else {
+				w.Write([]byte(`{"Databases": [{"id": "c"}]}`))
+			}
+		case r.Method == "GET" && r.URL.Path == "/dbs/db":
+			assert.Equal(t, "value", r.Header.Get("x-custom"))
+			w.Write([]byte(`{"id": "db", "_rid": "rid", "_colls": "colls/"}`))
+		case r.Method == "DELETE" && r.URL.Path == "/dbs/db":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	ctx := context.Background()
+
+	db, err := c.CreateDatabaseWithOptions(ctx, CreateDatabaseOptions{ID: "db", OfferThroughput: 400})
+	require.NoError(t, err)
+	assert.Equal(t, "rid", db.Rid)
+	_, err = c.CreateDatabaseWithOptions(ctx, CreateDatabaseOptions{ID: "db", AutoscaleMaxThroughput: 4000})
+	require.NoError(t, err)
+	_, err = c.CreateDatabaseWithOptions(ctx, CreateDatabaseOptions{ID: "db", OfferThroughput: 400, AutoscaleMaxThroughput: 4000})
+	assert.Equal(t, ErrThroughputAndAutoscale, err)
+
+	databases, err := c.ListDatabases(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, databases, 3)
+	assert.Equal(t, "c", databases[2].Id)
+
+	db, err = c.GetDatabase(ctx, "db", &RequestOptions{"x-custom": "value"})
+	require.NoError(t, err)
+	assert.Equal(t, "colls/", db.Colls)
+
+	require.NoError(t, c.DeleteDatabase(ctx, "db", nil))
+}
@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Document
@@ -27,24 +30,101 @@ const (
 )
 
 type CreateDocumentOptions struct {
-	PartitionKeyValue   interface{}
+	PartitionKeyValue interface{}
+	// IsUpsert replaces the document if it exists; see also UpsertDocument
 	IsUpsert            bool
 	IndexingDirective   IndexingDirective
 	PreTriggersInclude  []string
 	PostTriggersInclude []string
 }
 
+// DocumentResponse holds the response headers of a document operation. It is also returned together with an
+// error if the service responded, e.g. to log the ActivityId of failed requests.
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/common-cosmosdb-rest-response-headers
 type DocumentResponse struct {
+	StatusCode int
+	// RUs is the request charge
 	RUs          float64
 	SessionToken string
+	Etag         string
+	// ActivityId identifies the request, e.g. when contacting Azure support
+	ActivityId string
+	// LSN is the logical sequence number of the partition, and ItemLSN that of the last write of the document
+	LSN     int64
+	ItemLSN int64
+	// GlobalCommittedLSN is the LSN committed in all regions, and QuorumAckedLSN the LSN acknowledged by a
+	// write quorum of replicas in the region. They are -1 if not returned.
+	GlobalCommittedLSN int64
+	QuorumAckedLSN     int64
+	// CurrentWriteQuorum and CurrentReplicaSetSize describe the replica set that served the request
+	CurrentWriteQuorum    int
+	CurrentReplicaSetSize int
+	// ResourceQuota and ResourceUsage are the quota and usage of the collection, as semicolon-separated
+	// key=value pairs, e.g. "documentsSize=0;documentsCount=1"
+	ResourceQuota string
+	ResourceUsage string
+	// RequestDuration is the time the service spent on the request
+	RequestDuration time.Duration
+	// RetryCount is the number of times the client retried the request, because of throttling or unavailability
+	RetryCount int
+	// NotModified is set if a GetDocument with IfNoneMatch returned 304 Not Modified. In that case
+	// nothing is written to the output document.
+	NotModified bool
 }
 
-func parseDocumentResponse(resp *http.Response) (parsed DocumentResponse) {
-	parsed.SessionToken = resp.Header.Get(HEADER_SESSION_TOKEN)
-	parsed.RUs, _ = strconv.ParseFloat(resp.Header.Get(HEADER_REQUEST_CHARGE), 64)
+func parseDocumentResponse(resp *cosmosResponse) (parsed DocumentResponse) {
+	if resp == nil {
+		return
+	}
+	parsed.StatusCode = resp.StatusCode
+	parsed.SessionToken = getHeader(resp.Header, HEADER_SESSION_TOKEN)
+	parsed.NotModified = resp.StatusCode == http.StatusNotModified
+	parsed.RUs = parseFloatHeader(getHeader(resp.Header, HEADER_REQUEST_CHARGE))
+	parsed.Etag = getHeader(resp.Header, HEADER_ETAG)
+	parsed.ActivityId = getHeader(resp.Header, HEADER_ACTIVITY_ID)
+	parsed.LSN = parseIntHeader(getHeader(resp.Header, HEADER_LSN))
+	parsed.ItemLSN = parseIntHeader(getHeader(resp.Header, HEADER_ITEM_LSN))
+	parsed.GlobalCommittedLSN = parseLSNHeader(getHeader(resp.Header, HEADER_GLOBAL_COMMITTED_LSN))
+	parsed.QuorumAckedLSN = parseLSNHeader(getHeader(resp.Header, HEADER_QUORUM_ACKED_LSN))
+	parsed.CurrentWriteQuorum = int(parseIntHeader(getHeader(resp.Header, HEADER_CURRENT_WRITE_QUORUM)))
+	parsed.CurrentReplicaSetSize = int(parseIntHeader(getHeader(resp.Header, HEADER_CURRENT_REPLICA_SET_SIZE)))
+	parsed.ResourceQuota = getHeader(resp.Header, HEADER_RESOURCE_QUOTA)
+	parsed.ResourceUsage = getHeader(resp.Header, HEADER_RESOURCE_USAGE)
+	parsed.RequestDuration = time.Duration(parseFloatHeader(getHeader(resp.Header, HEADER_REQUEST_DURATION_MS)) * float64(time.Millisecond))
+	parsed.RetryCount = resp.retryCount
 	return
 }
 
+// parseIntHeader parses a numeric header, returning 0 if it is missing or invalid. Missing headers are not
+// parsed, as the error allocates.
+func parseIntHeader(value string) int64 {
+	if value == "" {
+		return 0
+	}
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+// parseFloatHeader is parseIntHeader for decimal numbers
+func parseFloatHeader(value string) float64 {
+	if value == "" {
+		return 0
+	}
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+func parseLSNHeader(value string) int64 {
+	if value == "" {
+		return -1
+	}
+	lsn, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return lsn
+}
+
 func (ops CreateDocumentOptions) AsHeaders() (map[string]string, error) {
 	headers := map[string]string{}
 
@@ -73,6 +153,19 @@ func (ops CreateDocumentOptions) AsHeaders() (map[string]string, error) {
 	return headers, nil
 }
 
+// CreateDocument creates a document, failing with ErrConflict if a document with the same id exists in the
+// partition.
+//
+// Creates are not idempotent, so retries need care. The client retries requests that were throttled or
+// found the service unavailable; the latter may happen after the document was written. If a retried create
+// fails with ErrConflict, the document is therefore read back, and if it has the body that was sent
+// (ignoring system properties), the create is considered successful and the response of the read is
+// returned. Otherwise, the outcome of a create that returns an error is:
+//   - ErrConflict and the other errors for 4xx statuses, except ErrTimeout: the document was not written
+//     by this call
+//   - ErrTimeout, ErrMaxRetriesExceeded, errors for 5xx statuses, and errors from the HTTP client such as
+//     timeouts and cancelled contexts: ambiguous; the document may or may not have been written. Read
+//     it, or retry the create with the same body, to find out
 func (c *Client) CreateDocument(ctx context.Context, dbName, colName string,
 	doc interface{}, ops CreateDocumentOptions) (*Resource, DocumentResponse, error) {
 
@@ -89,23 +182,78 @@ func (c *Client) CreateDocument(ctx context.Context, dbName, colName string,
 
 	response, err := c.create(ctx, link, doc, resource, headers)
 	if err != nil {
-		return nil, DocumentResponse{}, err
+		parsed := parseDocumentResponse(response)
+		if errors.Cause(err) == ErrConflict && parsed.RetryCount > 0 && !ops.IsUpsert {
+			if recovered, ok := c.recoverRetriedCreate(ctx, dbName, colName, doc, ops, parsed, resource); ok {
+				return resource, recovered, nil
+			}
+		}
+		return nil, parsed, err
 	}
 	return resource, parseDocumentResponse(response), nil
 }
 
 type UpsertDocumentOptions struct {
+	PartitionKeyValue interface{}
+	// If set, and the document exists, it is only replaced if its etag matches; otherwise
+	// ErrPreconditionFailed is returned. If the document does not exist, it is created regardless.
+	IfMatch             string
+	IndexingDirective   IndexingDirective
 	PreTriggersInclude  []string
 	PostTriggersInclude []string
-	/* TODO */
+	ConsistencyLevel    ConsistencyLevel
+	SessionToken        string
+}
+
+func (ops UpsertDocumentOptions) AsHeaders() (map[string]string, error) {
+	headers, err := CreateDocumentOptions{
+		PartitionKeyValue:   ops.PartitionKeyValue,
+		IsUpsert:            true,
+		IndexingDirective:   ops.IndexingDirective,
+		PreTriggersInclude:  ops.PreTriggersInclude,
+		PostTriggersInclude: ops.PostTriggersInclude,
+	}.AsHeaders()
+	if err != nil {
+		return nil, err
+	}
+
+	if ops.IfMatch != "" {
+		headers[HEADER_IF_MATCH] = ops.IfMatch
+	}
+
+	if ops.ConsistencyLevel != "" {
+		headers[HEADER_CONSISTENCY_LEVEL] = string(ops.ConsistencyLevel)
+	}
+
+	if ops.SessionToken != "" {
+		headers[HEADER_SESSION_TOKEN] = ops.SessionToken
+	}
+
+	return headers, nil
 }
 
-func (c *Client) UpsertDocument(ctx context.Context, link string,
-	doc interface{}, ops *RequestOptions) error {
-	return ErrorNotImplemented
+// UpsertDocument creates the document, or replaces it if a document with the same id exists in the partition.
+// Prefer it over CreateDocument with CreateDocumentOptions.IsUpsert, which does not support IfMatch.
+func (c *Client) UpsertDocument(ctx context.Context, dbName, colName string,
+	doc interface{}, ops UpsertDocumentOptions) (*Resource, DocumentResponse, error) {
+	headers, err := ops.AsHeaders()
+	if err != nil {
+		return nil, DocumentResponse{}, err
+	}
+
+	resource := &Resource{}
+	link := createDocsLink(dbName, colName)
+
+	response, err := c.create(ctx, link, doc, resource, headers)
+	if err != nil {
+		return nil, parseDocumentResponse(response), err
+	}
+	return resource, parseDocumentResponse(response), nil
 }
 
 type GetDocumentOptions struct {
+	// If set to the etag of a previously fetched version of the document, Cosmos returns 304 Not Modified
+	// (and charges less) if the document is unchanged. See DocumentResponse.NotModified.
 	IfNoneMatch       string
 	PartitionKeyValue interface{}
 	ConsistencyLevel  ConsistencyLevel
@@ -115,7 +263,9 @@ type GetDocumentOptions struct {
 func (ops GetDocumentOptions) AsHeaders() (map[string]string, error) {
 	headers := map[string]string{}
 
-	headers[HEADER_IF_NONE_MATCH] = ops.IfNoneMatch
+	if ops.IfNoneMatch != "" {
+		headers[HEADER_IF_NONE_MATCH] = ops.IfNoneMatch
+	}
 
 	if ops.PartitionKeyValue != nil {
 		v, err := MarshalPartitionKeyHeader(ops.PartitionKeyValue)
@@ -143,11 +293,12 @@ func (c *Client) GetDocument(ctx context.Context, dbName, colName, id string,
 		return DocumentResponse{}, err
 	}
 
+	// Point reads are the most frequent requests, so the resource type and link to sign are given directly
+	// rather than parsed from the link
 	link := createDocLink(dbName, colName, id)
-
-	resp, err := c.get(ctx, link, out, headers)
+	resp, err := c.methodForResource(ctx, http.MethodGet, link, "docs", link, out, nil, headers)
 	if err != nil {
-		return DocumentResponse{}, err
+		return parseDocumentResponse(resp), err
 	}
 	return parseDocumentResponse(resp), nil
 }
@@ -216,7 +367,7 @@ func (c *Client) ReplaceDocument(ctx context.Context, dbName, colName, id string
 
 	response, err := c.replace(ctx, link, doc, resource, headers)
 	if err != nil {
-		return nil, DocumentResponse{}, err
+		return nil, parseDocumentResponse(response), err
 	}
 
 	return resource, parseDocumentResponse(response), nil
@@ -225,10 +376,13 @@ func (c *Client) ReplaceDocument(ctx context.Context, dbName, colName, id string
 // DeleteDocumentOptions contains all options that can be used for deleting
 // documents.
 type DeleteDocumentOptions struct {
-	PartitionKeyValue   interface{}
+	PartitionKeyValue interface{}
+	// IfMatch, if set, makes the delete fail with ErrPreconditionFailed unless the document has this etag
+	IfMatch             string
 	PreTriggersInclude  []string
 	PostTriggersInclude []string
-	/* TODO */
+	ConsistencyLevel    ConsistencyLevel
+	SessionToken        string
 }
 
 func (ops DeleteDocumentOptions) AsHeaders() (map[string]string, error) {
@@ -243,6 +397,10 @@ func (ops DeleteDocumentOptions) AsHeaders() (map[string]string, error) {
 		headers[HEADER_PARTITIONKEY] = v
 	}
 
+	if ops.IfMatch != "" {
+		headers[HEADER_IF_MATCH] = ops.IfMatch
+	}
+
 	if ops.PreTriggersInclude != nil && len(ops.PreTriggersInclude) > 0 {
 		headers[HEADER_TRIGGER_PRE_INCLUDE] = strings.Join(ops.PreTriggersInclude, ",")
 	}
@@ -251,9 +409,19 @@ func (ops DeleteDocumentOptions) AsHeaders() (map[string]string, error) {
 		headers[HEADER_TRIGGER_POST_INCLUDE] = strings.Join(ops.PostTriggersInclude, ",")
 	}
 
+	if ops.ConsistencyLevel != "" {
+		headers[HEADER_CONSISTENCY_LEVEL] = string(ops.ConsistencyLevel)
+	}
+
+	if ops.SessionToken != "" {
+		headers[HEADER_SESSION_TOKEN] = ops.SessionToken
+	}
+
 	return headers, nil
 }
 
+// DeleteDocument deletes a document. The response is also returned on errors, e.g. with the status code
+// of ErrNotFound or ErrPreconditionFailed.
 func (c *Client) DeleteDocument(ctx context.Context, dbName, colName, id string, ops DeleteDocumentOptions) (DocumentResponse, error) {
 	headers, err := ops.AsHeaders()
 	if err != nil {
@@ -264,7 +432,7 @@ func (c *Client) DeleteDocument(ctx context.Context, dbName, colName, id string,
 
 	resp, err := c.delete(ctx, link, headers)
 	if err != nil {
-		return DocumentResponse{}, err
+		return parseDocumentResponse(resp), err
 	}
 
 	return parseDocumentResponse(resp), nil
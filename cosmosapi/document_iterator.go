@@ -0,0 +1,87 @@
+package cosmosapi
+
+import "context"
+
+// DocumentIterator reads the pages of a query or document listing one at a time, following the
+// continuation tokens:
+//
+//	it := client.NewQueryIterator(dbName, collName, qry, DefaultQueryDocumentOptions())
+//	for {
+//		var page []MyDoc
+//		ok, err := it.Next(ctx, &page)
+//		if err != nil {
+//			return err
+//		}
+//		if !ok {
+//			break
+//		}
+//		...
+//	}
+//
+// The position can be saved with Continuation, and resumed later by passing it as Query.Token or
+// ListDocumentsOptions.Continuation to a new iterator. A DocumentIterator is not safe for concurrent use.
+type DocumentIterator struct {
+	fetch        func(ctx context.Context, continuation string, page interface{}) (next string, requestCharge float64, err error)
+	continuation string
+	done         bool
+	charge       float64
+}
+
+// NewQueryIterator returns a DocumentIterator over the results of the query, starting at qry.Token.
+// ops.Continuation is ignored.
+func (c *Client) NewQueryIterator(dbName, collName string, qry Query, ops QueryDocumentsOptions) *DocumentIterator {
+	return &DocumentIterator{
+		continuation: qry.Token,
+		fetch: func(ctx context.Context, continuation string, page interface{}) (string, float64, error) {
+			ops.Continuation = continuation
+			response, err := c.QueryDocuments(ctx, dbName, collName, qry, page, ops)
+			return response.Continuation, response.RequestCharge, err
+		},
+	}
+}
+
+// NewListDocumentsIterator returns a DocumentIterator over all documents of the collection, starting at
+// ops.Continuation. It is not for reading the change feed; see ListDocuments.
+func (c *Client) NewListDocumentsIterator(dbName, collName string, ops ListDocumentsOptions) *DocumentIterator {
+	return &DocumentIterator{
+		continuation: ops.Continuation,
+		fetch: func(ctx context.Context, continuation string, page interface{}) (string, float64, error) {
+			ops.Continuation = continuation
+			response, err := c.ListDocuments(ctx, dbName, collName, &ops, page)
+			return response.Continuation, response.RequestCharge, err
+		},
+	}
+}
+
+// Next reads the next page into page, which must be a pointer to a slice, and returns true; or returns
+// false if all pages have been read. If reading the page fails, the error is returned, and the same page
+// is read on the next call to Next.
+func (it *DocumentIterator) Next(ctx context.Context, page interface{}) (ok bool, err error) {
+	if it.done {
+		return false, nil
+	}
+	next, requestCharge, err := it.fetch(ctx, it.continuation, page)
+	it.charge += requestCharge
+	if err != nil {
+		return false, err
+	}
+	it.continuation = next
+	it.done = next == ""
+	return true, nil
+}
+
+// Continuation returns the token to read the pages after those read so far, or "" if all pages have been
+// read (or none; see Done)
+func (it *DocumentIterator) Continuation() string {
+	return it.continuation
+}
+
+// Done returns true if all pages have been read
+func (it *DocumentIterator) Done() bool {
+	return it.done
+}
+
+// RequestCharge returns the total request charge of the pages read so far
+func (it *DocumentIterator) RequestCharge() float64 {
+	return it.charge
+}
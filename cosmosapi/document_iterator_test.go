@@ -0,0 +1,71 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentIterator(t *testing.T) {
+	fail := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_REQUEST_CHARGE, "1")
+		if fail {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get(HEADER_CONTINUATION) {
+		case "":
+			w.Header().Set(HEADER_CONTINUATION, "page-2")
+			w.Write([]byte(`{"Documents": [{"id": "a"}, {"id": "b"}]}`))
+		case "page-2":
+			w.Write([]byte(`{"Documents": [{"id": "c"}]}`))
+		}
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	for name, it := range map[string]*DocumentIterator{
+		"query": c.NewQueryIterator("db", "coll", Query{Query: "SELECT * FROM c"}, DefaultQueryDocumentOptions()),
+		"list":  c.NewListDocumentsIterator("db", "coll", ListDocumentsOptions{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ids []string
+			for {
+				var page []Resource
+				ok, err := it.Next(context.Background(), &page)
+				require.NoError(t, err)
+				if !ok {
+					break
+				}
+				for _, doc := range page {
+					ids = append(ids, doc.Id)
+				}
+				if len(ids) == 2 {
+					assert.Equal(t, "page-2", it.Continuation())
+					assert.False(t, it.Done())
+				}
+			}
+			assert.Equal(t, []string{"a", "b", "c"}, ids)
+			assert.True(t, it.Done())
+			assert.Equal(t, 2.0, it.RequestCharge())
+		})
+	}
+
+	// Resuming from a continuation; a failed page is read again on the next call
+	it := c.NewQueryIterator("db", "coll", Query{Query: "SELECT * FROM c", Token: "page-2"}, DefaultQueryDocumentOptions())
+	var page []Resource
+	fail = true
+	_, err := it.Next(context.Background(), &page)
+	require.Equal(t, ErrInvalidRequest, err)
+	assert.Equal(t, "page-2", it.Continuation())
+	fail = false
+	ok, err := it.Next(context.Background(), &page)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "c", page[0].Id)
+}
@@ -0,0 +1,253 @@
+package cosmosapi
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDocumentIfNoneMatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HEADER_IF_NONE_MATCH) == `"etag-1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set(HEADER_ETAG, `"etag-2"`)
+		w.Write([]byte(`{"id":"doc","_etag":"\"etag-2\""}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	doc := Resource{Id: "unchanged"}
+	resp, err := c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{IfNoneMatch: `"etag-1"`}, &doc)
+	require.NoError(t, err)
+	assert.True(t, resp.NotModified)
+	assert.Equal(t, "unchanged", doc.Id)
+
+	resp, err = c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{IfNoneMatch: `"etag-0"`}, &doc)
+	require.NoError(t, err)
+	assert.False(t, resp.NotModified)
+	assert.Equal(t, "doc", doc.Id)
+	assert.Equal(t, `"etag-2"`, doc.Etag)
+}
+
+func TestPatchDocument(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PATCH", r.Method)
+		assert.Equal(t, "/dbs/db/colls/coll/docs/doc", r.URL.Path)
+		assert.Equal(t, PatchAPIVersion, r.Header.Get(HEADER_VER))
+		assert.Equal(t, PATCH_CONTENT_TYPE, r.Header.Get(HEADER_CONTYPE))
+		assert.Equal(t, `["pk"]`, r.Header.Get(HEADER_PARTITIONKEY))
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{
+			"condition": "FROM c WHERE c.stock >= 2",
+			"operations": [
+				{"op": "incr", "path": "/stock", "value": -2},
+				{"op": "set", "path": "/reserved", "value": false},
+				{"op": "remove", "path": "/old"},
+				{"op": "move", "from": "/a", "path": "/b"}
+			]
+		}`, string(b))
+		w.Write([]byte(`{"id":"doc","_etag":"etag-2"}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	var doc Resource
+	_, err := c.PatchDocument(context.Background(), "db", "coll", "doc", []PatchOperation{
+		PatchIncrement("/stock", -2),
+		PatchSet("/reserved", false),
+		PatchRemove("/old"),
+		PatchMove("/a", "/b"),
+	}, PatchDocumentOptions{PartitionKeyValue: "pk", Condition: "FROM c WHERE c.stock >= 2"}, &doc)
+	require.NoError(t, err)
+	assert.Equal(t, "etag-2", doc.Etag)
+}
+
+func TestDocumentResponseHeaders(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set(HEADER_ACTIVITY_ID, "activity-1")
+		w.Header().Set(HEADER_REQUEST_CHARGE, "1.5")
+		if attempts == 1 {
+			w.Header().Set(HEADER_RETRY_AFTER_MS, "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(HEADER_ETAG, `"etag-1"`)
+		w.Header().Set(HEADER_SESSION_TOKEN, "0:1#12")
+		w.Header().Set(HEADER_LSN, "12")
+		w.Header().Set(HEADER_ITEM_LSN, "10")
+		w.Header().Set(HEADER_QUORUM_ACKED_LSN, "12")
+		w.Header().Set(HEADER_CURRENT_WRITE_QUORUM, "3")
+		w.Header().Set(HEADER_CURRENT_REPLICA_SET_SIZE, "4")
+		w.Header().Set(HEADER_RESOURCE_USAGE, "documentsSize=1;documentsCount=1")
+		w.Header().Set(HEADER_REQUEST_DURATION_MS, "0.5")
+		w.Write([]byte(`{"id":"doc"}`))
+	}))
+	defer ts.Close()
+	// The retry policy uses the retry delay given by the service, which makes the test fast
+	c := New(ts.URL, Config{MasterKey: TestKey, RetryPolicy: &RetryPolicy{MaxRetries: 1}}, nil, nil)
+
+	var doc Resource
+	resp, err := c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, &doc)
+	require.NoError(t, err)
+	assert.Equal(t, DocumentResponse{
+		StatusCode:            http.StatusOK,
+		RUs:                   1.5,
+		SessionToken:          "0:1#12",
+		Etag:                  `"etag-1"`,
+		ActivityId:            "activity-1",
+		LSN:                   12,
+		ItemLSN:               10,
+		GlobalCommittedLSN:    -1,
+		QuorumAckedLSN:        12,
+		CurrentWriteQuorum:    3,
+		CurrentReplicaSetSize: 4,
+		ResourceUsage:         "documentsSize=1;documentsCount=1",
+		RequestDuration:       500 * time.Microsecond,
+		RetryCount:            1,
+	}, resp)
+
+	// The response is also returned on errors
+	resp, err = c.DeleteDocument(context.Background(), "db", "coll", "doc", DeleteDocumentOptions{})
+	require.Equal(t, ErrNotFound, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "activity-1", resp.ActivityId)
+	assert.Equal(t, 0, resp.RetryCount)
+}
+
+func TestListDocumentsHasMore(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_SESSION_TOKEN, "0:12")
+		switch {
+		case r.Header.Get(HEADER_IF_NONE_MATCH) == `"2"`:
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case r.Header.Get(HEADER_A_IM) != "":
+			w.Header().Set(HEADER_ETAG, `"2"`)
+		case r.Header.Get(HEADER_CONTINUATION) == "":
+			w.Header().Set(HEADER_CONTINUATION, "page-2")
+		}
+		w.Write([]byte(`{"_count": 1, "Documents": [{"id": "doc"}]}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	ctx := context.Background()
+
+	var docs []Resource
+	resp, err := c.ListDocuments(ctx, "db", "coll", &ListDocumentsOptions{}, &docs)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resp.Count)
+	assert.Equal(t, "0:12", resp.SessionToken)
+	assert.True(t, resp.HasMore())
+	resp, err = c.ListDocuments(ctx, "db", "coll", &ListDocumentsOptions{Continuation: resp.Continuation}, &docs)
+	require.NoError(t, err)
+	assert.False(t, resp.HasMore())
+
+	// The change feed has more until it is not modified
+	resp, err = c.ListDocuments(ctx, "db", "coll", &ListDocumentsOptions{AIM: "Incremental feed"}, &docs)
+	require.NoError(t, err)
+	assert.True(t, resp.HasMore())
+	resp, err = c.ListDocuments(ctx, "db", "coll", &ListDocumentsOptions{AIM: "Incremental feed", IfNoneMatch: resp.Etag}, &docs)
+	require.NoError(t, err)
+	assert.True(t, resp.NotModified)
+	assert.Equal(t, 0, resp.Count)
+	assert.Equal(t, "0:12", resp.SessionToken)
+	assert.False(t, resp.HasMore())
+}
+
+func TestUpsertDocument(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get(HEADER_UPSERT))
+		assert.Equal(t, `["p"]`, r.Header.Get(HEADER_PARTITIONKEY))
+		if ifMatch := r.Header.Get(HEADER_IF_MATCH); ifMatch != "" && ifMatch != `"etag-1"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set(HEADER_ETAG, `"etag-2"`)
+		w.Write([]byte(`{"id":"doc","_etag":"\"etag-2\""}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	doc := map[string]string{"id": "doc", "pk": "p"}
+
+	resource, resp, err := c.UpsertDocument(context.Background(), "db", "coll", doc, UpsertDocumentOptions{PartitionKeyValue: "p"})
+	require.NoError(t, err)
+	assert.Equal(t, `"etag-2"`, resource.Etag)
+	assert.Equal(t, `"etag-2"`, resp.Etag)
+
+	_, _, err = c.UpsertDocument(context.Background(), "db", "coll", doc, UpsertDocumentOptions{PartitionKeyValue: "p", IfMatch: `"etag-1"`})
+	require.NoError(t, err)
+	_, _, err = c.UpsertDocument(context.Background(), "db", "coll", doc, UpsertDocumentOptions{PartitionKeyValue: "p", IfMatch: `"etag-0"`})
+	require.Equal(t, ErrPreconditionFailed, err)
+}
+
+func TestExactNumbers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PATCH" {
+			b, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, `{"operations":[{"op":"incr","path":"/balance","value":0.10},{"op":"incr","path":"/cents","value":10000000000000001}]}`, strings.TrimSpace(string(b)))
+		}
+		w.Write([]byte(`{"id": "doc", "balance": 12345678901234567.89, "cents": 10000000000000001}`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	var doc map[string]interface{}
+	_, err := c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, &doc)
+	require.NoError(t, err)
+	assert.IsType(t, float64(0), doc["balance"])
+
+	c = New(ts.URL, Config{MasterKey: TestKey, UseNumber: true}, nil, nil)
+	_, err = c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, &doc)
+	require.NoError(t, err)
+	assert.Equal(t, json.Number("12345678901234567.89"), doc["balance"])
+
+	_, err = c.PatchDocument(context.Background(), "db", "coll", "doc", []PatchOperation{
+		PatchIncrement("/balance", QueryParamAsNumber("0.10")),
+		PatchIncrement("/cents", json.Number("10000000000000001")),
+	}, PatchDocumentOptions{}, nil)
+	require.NoError(t, err)
+}
+
+func TestDeleteDocument(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "DELETE", r.Method)
+		assert.Equal(t, "/dbs/db/colls/coll/docs/doc", r.URL.Path)
+		assert.Equal(t, `["pk"]`, r.Header.Get(HEADER_PARTITIONKEY))
+		assert.Equal(t, "0:1#12", r.Header.Get(HEADER_SESSION_TOKEN))
+		if r.Header.Get(HEADER_IF_MATCH) != `"etag-1"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set(HEADER_SESSION_TOKEN, "0:1#13")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	ops := DeleteDocumentOptions{PartitionKeyValue: "pk", IfMatch: `"etag-0"`, SessionToken: "0:1#12"}
+	resp, err := c.DeleteDocument(context.Background(), "db", "coll", "doc", ops)
+	require.Equal(t, ErrPreconditionFailed, err)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	ops.IfMatch = `"etag-1"`
+	resp, err = c.DeleteDocument(context.Background(), "db", "coll", "doc", ops)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "0:1#13", resp.SessionToken)
+}
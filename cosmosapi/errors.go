@@ -17,6 +17,7 @@ var (
 	ErrWrongQueryContentType   = errors.New("Wrong content type. Must be " + QUERY_CONTENT_TYPE)
 	ErrMaxRetriesExceeded      = errors.New("Max retries exceeded")
 	ErrInvalidPartitionKeyType = errors.New("Partition key type must be a simple type (nil, string, int, float, etc.)")
+	ErrReadOnly                = errors.New("Write operation attempted through a read-only client")
 
 	// Map http codes to cosmos errors messages
 	// Description taken directly from https://docs.microsoft.com/en-us/rest/api/cosmos-db/http-status-codes-for-cosmosdb
@@ -35,11 +36,14 @@ var (
 	// Undocumented code. A known scenario where it is used is when doing a ListDocuments request with ReadFeed
 	// properties on a partition that was split by a repartition.
 	ErrGone = errors.New("Resource is gone")
+	// Returned for the operations of a transactional batch that were not done because another operation failed
+	ErrFailedDependency = errors.New("The operation was not done because another operation in the batch failed")
 
 	CosmosHTTPErrors = map[int]error{
 		http.StatusOK:                    nil,
 		http.StatusCreated:               nil,
 		http.StatusNoContent:             nil,
+		http.StatusMultiStatus:           nil,
 		http.StatusNotModified:           nil,
 		http.StatusBadRequest:            ErrInvalidRequest,
 		http.StatusUnauthorized:          ErrUnautorized,
@@ -50,6 +54,7 @@ var (
 		http.StatusGone:                  ErrGone,
 		http.StatusPreconditionFailed:    ErrPreconditionFailed,
 		http.StatusRequestEntityTooLarge: ErrTooLarge,
+		http.StatusFailedDependency:      ErrFailedDependency,
 		http.StatusTooManyRequests:       ErrTooManyRequests,
 		StatusRetryWith:                  ErrRetryWith,
 		http.StatusInternalServerError:   ErrInternalError,
@@ -2,7 +2,6 @@ package cosmosapi
 
 import (
 	"context"
-	"net/http"
 	"strconv"
 
 	"github.com/pkg/errors"
@@ -80,11 +79,11 @@ type GetPartitionKeyRangesResponse struct {
 	Etag               string
 }
 
-func (r *GetPartitionKeyRangesResponse) parseHeaders(httpResponse *http.Response) error {
+func (r *GetPartitionKeyRangesResponse) parseHeaders(httpResponse *cosmosResponse) error {
 	r.SessionToken = httpResponse.Header.Get(HEADER_SESSION_TOKEN)
 	r.Continuation = httpResponse.Header.Get(HEADER_CONTINUATION)
 	r.Etag = httpResponse.Header.Get(HEADER_ETAG)
-	if _, ok := httpResponse.Header[HEADER_REQUEST_CHARGE]; ok {
+	if httpResponse.Header.Get(HEADER_REQUEST_CHARGE) != "" {
 		requestCharge, err := strconv.ParseFloat(httpResponse.Header.Get(HEADER_REQUEST_CHARGE), 64)
 		if err != nil {
 			return errors.WithStack(err)
@@ -0,0 +1,25 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPartitionKeyRangesRequestCharge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_REQUEST_CHARGE, "1.5")
+		w.Write([]byte(`{"PartitionKeyRanges": [{"id": "0"}]}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	// The header is canonicalized in the response, so it must be read with Get
+	response, err := c.GetPartitionKeyRanges(context.Background(), "db", "coll", &GetPartitionKeyRangesOptions{MaxItemCount: -1})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, response.RequestCharge)
+}
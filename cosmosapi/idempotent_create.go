@@ -0,0 +1,72 @@
+package cosmosapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// Properties maintained by Cosmos, which are ignored when comparing a document with what was sent
+var systemProperties = []string{"_rid", "_self", "_etag", "_ts", "_attachments"}
+
+// recoverRetriedCreate is called when a create that was retried failed with ErrConflict. An earlier
+// attempt may have been applied although its response said otherwise (e.g. a 503 returned after the
+// write was committed), in which case the conflict is with our own document. The document is read back,
+// and if it has the body that was sent, ok=true is returned with resource populated and the response
+// of the read; the RUs of the create are added to it.
+func (c *Client) recoverRetriedCreate(ctx context.Context, dbName, colName string, doc interface{},
+	ops CreateDocumentOptions, createResponse DocumentResponse, resource *Resource) (response DocumentResponse, ok bool) {
+
+	sent, err := documentFields(doc)
+	if err != nil {
+		return DocumentResponse{}, false
+	}
+	id, _ := sent["id"].(string)
+	if id == "" {
+		return DocumentResponse{}, false
+	}
+	var existing json.RawMessage
+	getOps := GetDocumentOptions{PartitionKeyValue: ops.PartitionKeyValue, SessionToken: createResponse.SessionToken}
+	response, err = c.GetDocument(ctx, dbName, colName, id, getOps, &existing)
+	if err != nil {
+		return DocumentResponse{}, false
+	}
+	existingFields, err := documentFields([]byte(existing))
+	if err != nil || !reflect.DeepEqual(sent, existingFields) {
+		return DocumentResponse{}, false
+	}
+	if err := json.Unmarshal(existing, resource); err != nil {
+		return DocumentResponse{}, false
+	}
+	c.Log.Debugf("Create of document %s conflicted after %d retries, but it has the body that was sent; assuming an earlier attempt succeeded\n", id, createResponse.RetryCount)
+	response.RUs += createResponse.RUs
+	response.RetryCount = createResponse.RetryCount
+	return response, true
+}
+
+// documentFields returns the properties of the document as they are stored, without system properties
+func documentFields(doc interface{}) (map[string]interface{}, error) {
+	var data []byte
+	switch t := doc.(type) {
+	case string:
+		data = []byte(t)
+	case []byte:
+		data = t
+	default:
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	for _, property := range systemProperties {
+		delete(fields, property)
+	}
+	return fields, nil
+}
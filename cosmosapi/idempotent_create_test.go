@@ -0,0 +1,57 @@
+package cosmosapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateDocumentRetriedConflict(t *testing.T) {
+	var stored []byte
+	var concurrent []byte // if set, is what gets stored instead, as if written by someone else
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_REQUEST_CHARGE, "1")
+		switch {
+		case r.Method == http.MethodGet:
+			w.Write([]byte(`{"_etag":"etag-1","_ts":100,` + string(stored[1:])))
+		case stored == nil:
+			// The write is applied, but the response is lost
+			stored, _ = ioutil.ReadAll(r.Body)
+			if concurrent != nil {
+				stored = concurrent
+			}
+			w.Header().Set(HEADER_RETRY_AFTER_MS, "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer ts.Close()
+	// The retry policy uses the retry delay given by the service, which makes the test fast
+	c := New(ts.URL, Config{MasterKey: TestKey, RetryPolicy: &RetryPolicy{MaxRetries: 1}}, nil, nil)
+
+	doc := map[string]interface{}{"id": "doc", "pk": "p", "x": 1}
+	resource, resp, err := c.CreateDocument(context.Background(), "db", "coll", doc, CreateDocumentOptions{PartitionKeyValue: "p"})
+	require.NoError(t, err)
+	assert.Equal(t, "etag-1", resource.Etag)
+	assert.Equal(t, 1, resp.RetryCount)
+	assert.Equal(t, 2.0, resp.RUs)
+
+	// A conflict on the first attempt is not ours, even if the body matches
+	_, resp, err = c.CreateDocument(context.Background(), "db", "coll", doc, CreateDocumentOptions{PartitionKeyValue: "p"})
+	assert.Equal(t, ErrConflict, err)
+	assert.Equal(t, 0, resp.RetryCount)
+
+	// A conflict with a different document is not recovered
+	stored, concurrent = nil, []byte(`{"id":"doc","pk":"p","x":2}`)
+	_, resp, err = c.CreateDocument(context.Background(), "db", "coll", doc, CreateDocumentOptions{PartitionKeyValue: "p"})
+	assert.Equal(t, ErrConflict, errors.Cause(err))
+	assert.Equal(t, 1, resp.RetryCount)
+	assert.Equal(t, 1, RetryCountOf(err))
+}
@@ -28,6 +28,14 @@ func createSprocLink(dbName, collName, sprocName string) string {
 	return "dbs/" + dbName + "/colls/" + collName + "/sprocs/" + sprocName
 }
 
+func createUdfsLink(dbName, collName string) string {
+	return "dbs/" + dbName + "/colls/" + collName + "/udfs"
+}
+
+func createUdfLink(dbName, collName, udfName string) string {
+	return "dbs/" + dbName + "/colls/" + collName + "/udfs/" + udfName
+}
+
 // resourceTypeFromLink is used to extract the resource type link to use in the
 // payload of the authorization header.
 func resourceTypeFromLink(link string) (rLink, rType string) {
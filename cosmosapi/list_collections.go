@@ -2,7 +2,6 @@ package cosmosapi
 
 import (
 	"context"
-	"net/http"
 	"strconv"
 
 	"github.com/pkg/errors"
@@ -57,7 +56,7 @@ func (ops ListCollectionsOptions) asHeaders() (map[string]string, error) {
 	return headers, nil
 }
 
-func (r ListCollectionsResponse) parse(httpResponse *http.Response) (ListCollectionsResponse, error) {
+func (r ListCollectionsResponse) parse(httpResponse *cosmosResponse) (ListCollectionsResponse, error) {
 	r.SessionToken = httpResponse.Header.Get(HEADER_SESSION_TOKEN)
 	r.Continuation = httpResponse.Header.Get(HEADER_CONTINUATION)
 	r.Etag = httpResponse.Header.Get(HEADER_ETAG)
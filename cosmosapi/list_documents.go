@@ -23,21 +23,29 @@ func (c *Client) ListDocuments(
 	}
 	httpResponse, err := c.get(ctx, link, &responseBody, headers)
 	if err != nil {
+		if httpResponse != nil {
+			response.RequestCharge = parseFloatHeader(getHeader(httpResponse.Header, HEADER_REQUEST_CHARGE))
+			response.StatusCode = httpResponse.StatusCode
+		}
 		return response, err
-	} else if httpResponse.StatusCode == http.StatusNotModified {
-		return response, err
-	} else if err = unmarshalDocuments(responseBody.Documents, documentList); err != nil {
+	}
+	response.changeFeed = options.AIM != ""
+	if httpResponse.StatusCode == http.StatusNotModified {
+		r, err := response.parse(httpResponse)
+		return *r, err
+	} else if err = unmarshalDocuments(responseBody.Documents, documentList, c.Config.UseNumber); err != nil {
 		return response, err
 	}
+	response.Count = responseBody.Count
 	r, err := response.parse(httpResponse)
 	return *r, err
 }
 
-func unmarshalDocuments(bytes []byte, documentList interface{}) error {
+func unmarshalDocuments(bytes []byte, documentList interface{}, useNumber bool) error {
 	if len(bytes) == 0 {
 		return nil
 	}
-	return errors.Wrapf(json.Unmarshal(bytes, documentList), "Error unmarshaling <%s>", string(bytes))
+	return errors.Wrapf(unmarshalJson(bytes, documentList, useNumber), "Error unmarshaling <%s>", string(bytes))
 }
 
 type listDocumentsResponseBody struct {
@@ -79,9 +87,26 @@ type ListDocumentsResponse struct {
 	SessionToken string
 	Continuation string
 	Etag         string
+	// Count is the number of documents in the page
+	Count int
+	// NotModified is set when reading the change feed, if there were no changes after IfNoneMatch
+	NotModified bool
+
+	changeFeed bool
+}
+
+// HasMore returns true if there may be more documents to read. When listing documents, the next page is read
+// with Continuation. When reading the change feed, it is read with IfNoneMatch set to Etag, until there are
+// no more changes.
+func (r ListDocumentsResponse) HasMore() bool {
+	if r.changeFeed {
+		return !r.NotModified
+	}
+	return r.Continuation != ""
 }
 
-func (r *ListDocumentsResponse) parse(httpResponse *http.Response) (*ListDocumentsResponse, error) {
+func (r *ListDocumentsResponse) parse(httpResponse *cosmosResponse) (*ListDocumentsResponse, error) {
+	r.NotModified = httpResponse.StatusCode == http.StatusNotModified
 	r.SessionToken = httpResponse.Header.Get(HEADER_SESSION_TOKEN)
 	r.Continuation = httpResponse.Header.Get(HEADER_CONTINUATION)
 	r.Etag = httpResponse.Header.Get(HEADER_ETAG)
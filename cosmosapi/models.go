@@ -42,11 +42,30 @@ type ExcludedPath struct {
 	Path string `json:"path"`
 }
 
-type CompositeIndex []struct {
+// CompositeIndex is an index on several paths, needed by queries ordering by or filtering on several fields
+type CompositeIndex []CompositePath
+
+type CompositePath struct {
 	Path  string     `json:"path"`
 	Order IndexOrder `json:"order,omitempty"`
 }
 
+// SpatialIndex indexes the GeoJSON values of the given types found at Path
+type SpatialIndex struct {
+	Path  string     `json:"path"`
+	Types []DataType `json:"types"`
+}
+
+// UniqueKeyPolicy makes the combination of the values at the paths of each unique key unique within a logical
+// partition. It can only be set when the collection is created.
+type UniqueKeyPolicy struct {
+	UniqueKeys []UniqueKey `json:"uniqueKeys"`
+}
+
+type UniqueKey struct {
+	Paths []string `json:"paths"`
+}
+
 // Stored Procedure
 type Sproc struct {
 	Resource
@@ -2,8 +2,12 @@ package cosmosapi
 
 import (
 	"context"
+
+	"github.com/pkg/errors"
 )
 
+var ErrThroughputModeChange = errors.New("Can not change between manual and autoscale throughput by replacing the offer")
+
 type Offer struct {
 	Resource
 	OfferVersion    string                 `json:"offerVersion"`
@@ -16,7 +20,24 @@ type OfferThroughput int32
 type OfferType string
 
 type OfferThroughputContent struct {
-	Throughput OfferThroughput `json:"offerThroughput"`
+	// Throughput is the provisioned throughput in RU/s. For autoscale offers, it is the throughput the offer
+	// is currently scaled to.
+	Throughput OfferThroughput `json:"offerThroughput,omitempty"`
+	// AutoscaleSettings is set for autoscale offers
+	AutoscaleSettings *AutoscaleSettings `json:"offerAutopilotSettings,omitempty"`
+}
+
+// IsAutoscale returns true if the offer provisions autoscale throughput
+func (o Offer) IsAutoscale() bool {
+	return o.Content.AutoscaleSettings != nil && o.Content.AutoscaleSettings.MaxThroughput > 0
+}
+
+// MaxThroughput returns the throughput provisioned; for autoscale offers, the maximum it scales to
+func (o Offer) MaxThroughput() OfferThroughput {
+	if o.IsAutoscale() {
+		return o.Content.AutoscaleSettings.MaxThroughput
+	}
+	return o.Content.Throughput
 }
 
 type Offers struct {
@@ -42,8 +63,11 @@ func createOfferLink(offerId string) string {
 
 // https://docs.microsoft.com/en-us/rest/api/cosmos-db/get-an-offer
 func (c *Client) GetOffer(ctx context.Context, offerId string, ops *RequestOptions) (*Offer, error) {
+	if c.isServerless() {
+		return nil, ErrServerless
+	}
 	offer := &Offer{}
-	_, err := c.get(ctx, createOfferLink(offerId), offer, nil)
+	_, err := c.get(ctx, createOfferLink(offerId), offer, requestOptionHeaders(nil, ops))
 
 	if err != nil {
 		return nil, err
@@ -51,27 +75,44 @@ func (c *Client) GetOffer(ctx context.Context, offerId string, ops *RequestOptio
 	return offer, nil
 }
 
+// ListOffers returns all the offers of the account, reading as many pages as needed
 // https://docs.microsoft.com/en-us/rest/api/cosmos-db/list-offers
 func (c *Client) ListOffers(ctx context.Context, ops *RequestOptions) (*Offers, error) {
+	if c.isServerless() {
+		return nil, ErrServerless
+	}
 
 	url := createOfferLink("")
+	headers := requestOptionHeaders(map[string]string{}, ops)
 
 	offers := &Offers{}
-	_, err := c.get(ctx, url, offers, nil)
-	if err != nil {
-		return nil, err
+	for {
+		page := Offers{}
+		resp, err := c.get(ctx, url, &page, headers)
+		if err != nil {
+			return nil, err
+		}
+		offers.Rid = page.Rid
+		offers.Offers = append(offers.Offers, page.Offers...)
+		offers.Count = int32(len(offers.Offers))
+		continuation := getHeader(resp.Header, HEADER_CONTINUATION)
+		if continuation == "" {
+			return offers, nil
+		}
+		headers[HEADER_CONTINUATION] = continuation
 	}
-
-	return offers, nil
 }
 
 // https://docs.microsoft.com/en-us/rest/api/cosmos-db/replace-an-offer
 func (c *Client) ReplaceOffer(ctx context.Context, offerOps OfferReplaceOptions, ops *RequestOptions) (*Offer, error) {
+	if c.isServerless() {
+		return nil, ErrServerless
+	}
 
 	offer := &Offer{}
 	link := createOfferLink(offerOps.Rid)
 
-	_, err := c.replace(ctx, link, offerOps, offer, nil)
+	_, err := c.replace(ctx, link, offerOps, offer, requestOptionHeaders(nil, ops))
 	if err != nil {
 		return nil, err
 	}
@@ -79,3 +120,58 @@ func (c *Client) ReplaceOffer(ctx context.Context, offerOps OfferReplaceOptions,
 	return offer, nil
 
 }
+
+// GetOfferForResource returns the offer of the database or collection with the given _rid. It fails with
+// ErrNotFound if there is none, e.g. for a collection sharing the throughput of its database.
+func (c *Client) GetOfferForResource(ctx context.Context, resourceRid string) (*Offer, error) {
+	offers, err := c.ListOffers(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, offer := range offers.Offers {
+		if offer.OfferResourceId == resourceRid {
+			return &offer, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrNotFound, "No offer for resource %s", resourceRid)
+}
+
+// GetDatabaseOffer returns the offer of a database with throughput shared by its collections
+func (c *Client) GetDatabaseOffer(ctx context.Context, dbName string) (*Offer, error) {
+	db, err := c.GetDatabase(ctx, dbName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetOfferForResource(ctx, db.Rid)
+}
+
+// GetCollectionOffer returns the offer of a collection with its own throughput
+func (c *Client) GetCollectionOffer(ctx context.Context, dbName, colName string) (*Offer, error) {
+	coll, err := c.GetCollection(ctx, dbName, colName)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetOfferForResource(ctx, coll.Rid)
+}
+
+// ReplaceThroughput changes the throughput of an offer, as read by e.g. GetCollectionOffer. For offers with
+// manual throughput, throughput is the new throughput; for autoscale offers, it is the new maximum
+// throughput. The mode of the offer can not be changed this way.
+func (c *Client) ReplaceThroughput(ctx context.Context, offer Offer, throughput OfferThroughput, autoscale bool) (*Offer, error) {
+	if autoscale != offer.IsAutoscale() {
+		return nil, ErrThroughputModeChange
+	}
+	content := OfferThroughputContent{Throughput: throughput}
+	if autoscale {
+		content = OfferThroughputContent{AutoscaleSettings: &AutoscaleSettings{MaxThroughput: throughput}}
+	}
+	return c.ReplaceOffer(ctx, OfferReplaceOptions{
+		OfferVersion:     offer.OfferVersion,
+		OfferType:        offer.OfferType,
+		Content:          content,
+		ResourceSelfLink: offer.Self,
+		OfferResourceId:  offer.OfferResourceId,
+		Id:               offer.Id,
+		Rid:              offer.Rid,
+	}, nil)
+}
@@ -0,0 +1,78 @@
+package cosmosapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffers(t *testing.T) {
+	var replaced []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/offers/":
+			if r.Header.Get(HEADER_CONTINUATION) == "" {
+				w.Header().Set(HEADER_CONTINUATION, "more")
+				w.Write([]byte(`{"_rid": "", "Offers": [
+					{"id": "o1", "_rid": "o1", "_self": "offers/o1/", "offerVersion": "V2", "offerResourceId": "rid-db", "content": {"offerThroughput": 1000}}
+				]}`))
+			} else {
+				w.Write([]byte(`{"_rid": "", "Offers": [
+					{"id": "o2", "_rid": "o2", "_self": "offers/o2/", "offerVersion": "V2", "offerResourceId": "rid-coll",
+						"content": {"offerThroughput": 400, "offerAutopilotSettings": {"maxThroughput": 4000}}}
+				]}`))
+			}
+		case r.Method == "GET" && r.URL.Path == "/dbs/db":
+			w.Write([]byte(`{"id": "db", "_rid": "rid-db"}`))
+		case r.Method == "GET" && r.URL.Path == "/dbs/db/colls/coll":
+			w.Write([]byte(`{"id": "coll", "_rid": "rid-coll"}`))
+		case r.Method == "GET" && r.URL.Path == "/dbs/db/colls/shared":
+			w.Write([]byte(`{"id": "shared", "_rid": "rid-shared"}`))
+		case r.Method == "PUT" && (r.URL.Path == "/offers/o1" || r.URL.Path == "/offers/o2"):
+			b, _ := ioutil.ReadAll(r.Body)
+			replaced = append(replaced, string(b))
+			w.Write(b)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	ctx := context.Background()
+
+	offers, err := c.ListOffers(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, offers.Offers, 2)
+	assert.Equal(t, int32(2), offers.Count)
+
+	dbOffer, err := c.GetDatabaseOffer(ctx, "db")
+	require.NoError(t, err)
+	assert.False(t, dbOffer.IsAutoscale())
+	assert.Equal(t, OfferThroughput(1000), dbOffer.MaxThroughput())
+	collOffer, err := c.GetCollectionOffer(ctx, "db", "coll")
+	require.NoError(t, err)
+	assert.True(t, collOffer.IsAutoscale())
+	assert.Equal(t, OfferThroughput(4000), collOffer.MaxThroughput())
+	_, err = c.GetCollectionOffer(ctx, "db", "shared")
+	assert.Equal(t, ErrNotFound, errors.Cause(err))
+
+	// Scale down for the night
+	_, err = c.ReplaceThroughput(ctx, *dbOffer, 400, false)
+	require.NoError(t, err)
+	updated, err := c.ReplaceThroughput(ctx, *collOffer, 1000, true)
+	require.NoError(t, err)
+	assert.Equal(t, OfferThroughput(1000), updated.MaxThroughput())
+	require.Len(t, replaced, 2)
+	assert.JSONEq(t, `{"offerVersion": "V2", "offerType": "", "content": {"offerThroughput": 400}, "resource": "offers/o1/",
+		"offerResourceId": "rid-db", "id": "o1", "_rid": "o1"}`, replaced[0])
+	assert.Contains(t, replaced[1], `"content":{"offerAutopilotSettings":{"maxThroughput":1000}}`)
+
+	_, err = c.ReplaceThroughput(ctx, *dbOffer, 4000, true)
+	assert.Equal(t, ErrThroughputModeChange, err)
+}
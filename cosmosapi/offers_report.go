@@ -0,0 +1,186 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RUMeter records the request charges of the requests made by clients that have it set in Config.RUMeter,
+// per collection and per database, to compare consumption with provisioning; see OfferReport.
+type RUMeter struct {
+	mu     sync.Mutex
+	start  time.Time
+	meters map[string]*ruMeter
+}
+
+type ruMeter struct {
+	total        float64
+	second       int64
+	secondCharge float64
+	peak         float64
+}
+
+// RUConsumption is the consumption recorded by a RUMeter for one collection or database
+type RUConsumption struct {
+	// Total is the sum of the request charges
+	Total float64
+	// Average is Total divided by the length of the sampling window, in RU/s
+	Average float64
+	// Peak is the highest request charge within one second, in RU/s
+	Peak float64
+}
+
+// NewRUMeter returns a RUMeter starting its sampling window now
+func NewRUMeter() *RUMeter {
+	return &RUMeter{start: time.Now(), meters: make(map[string]*ruMeter)}
+}
+
+// Record records a request charge for the resource with the given link, at the given time. The charge counts
+// towards both the collection and the database of the resource. Charges should be recorded in time order, as
+// the peak is computed over consecutive whole seconds.
+func (m *RUMeter) Record(link string, charge float64, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	collection := meterKey(link, 4)
+	for _, key := range []string{collection, meterKey(link, 2)} {
+		meter := m.meters[key]
+		if meter == nil {
+			meter = &ruMeter{}
+			m.meters[key] = meter
+		}
+		meter.record(charge, at)
+		if key == meterKey(link, 2) {
+			// A database level request; the keys are the same
+			break
+		}
+	}
+}
+
+func (meter *ruMeter) record(charge float64, at time.Time) {
+	meter.total += charge
+	if second := at.Unix(); second != meter.second {
+		meter.second, meter.secondCharge = second, 0
+	}
+	meter.secondCharge += charge
+	if meter.secondCharge > meter.peak {
+		meter.peak = meter.secondCharge
+	}
+}
+
+// Consumption returns the consumption recorded for a collection (link "dbs/<db>/colls/<coll>") or a database
+// (link "dbs/<db>"), from the start of the sampling window until now
+func (m *RUMeter) Consumption(link string) RUConsumption {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	meter := m.meters[meterKey(link, 4)]
+	if meter == nil {
+		return RUConsumption{}
+	}
+	consumption := RUConsumption{Total: meter.total, Peak: meter.peak}
+	if window := time.Since(m.start).Seconds(); window > 0 {
+		consumption.Average = meter.total / window
+	}
+	return consumption
+}
+
+// meterKey returns the first (up to) n segments of a link; i.e. with n=4 the collection, and with n=2 the
+// database, that a resource belongs to
+func meterKey(link string, n int) string {
+	parts := strings.Split(strings.Trim(link, "/"), "/")
+	if len(parts) > n {
+		parts = parts[:n]
+	}
+	return strings.Join(parts, "/")
+}
+
+func (c *Client) recordRequestCharge(req *http.Request, resp *http.Response) {
+	if c.Config.RUMeter == nil {
+		return
+	}
+	charge, err := strconv.ParseFloat(resp.Header.Get(HEADER_REQUEST_CHARGE), 64)
+	if err != nil {
+		return
+	}
+	c.Config.RUMeter.Record(req.URL.Path, charge, time.Now())
+}
+
+// OfferUtilization is the provisioned and consumed throughput of one offer
+type OfferUtilization struct {
+	OfferId  string
+	Database string
+	// Collection is empty for offers on a database, with throughput shared by its collections
+	Collection string
+	// Throughput is the provisioned throughput; for autoscale offers, the maximum throughput
+	Throughput  OfferThroughput
+	Consumption RUConsumption
+	// Utilization is the peak consumption divided by the provisioned throughput
+	Utilization float64
+}
+
+// OfferReport lists the offers of the account with the database and collection they belong to, together with
+// the consumption recorded by meter (which may be nil), ordered by utilization; i.e. the most
+// over-provisioned first. For a meaningful report, let meter record the normal traffic of the account for a
+// while first, e.g. a day. For serverless accounts (see AccountCapabilities), the report is empty.
+func (c *Client) OfferReport(ctx context.Context, meter *RUMeter) ([]OfferUtilization, error) {
+	offers, err := c.ListOffers(ctx, nil)
+	if err == ErrServerless {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	databases, err := c.ListDatabases(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Offers refer to the _rid of their database or collection
+	type resource struct{ database, collection string }
+	resources := make(map[string]resource)
+	for _, db := range databases {
+		resources[db.Rid] = resource{database: db.Id}
+		options := ListCollectionsOptions{}
+		for {
+			response, err := c.ListCollections(ctx, db.Id, options)
+			if err != nil {
+				return nil, err
+			}
+			for _, coll := range response.Collections.DocumentCollections {
+				resources[coll.Rid] = resource{database: db.Id, collection: coll.Id}
+			}
+			if response.Continuation == "" {
+				break
+			}
+			options.Continuation = response.Continuation
+		}
+	}
+
+	var report []OfferUtilization
+	for _, offer := range offers.Offers {
+		r := resources[offer.OfferResourceId]
+		u := OfferUtilization{
+			OfferId:    offer.Id,
+			Database:   r.database,
+			Collection: r.collection,
+			Throughput: offer.MaxThroughput(),
+		}
+		if meter != nil && r.database != "" {
+			link := createDatabaseLink(r.database)
+			if r.collection != "" {
+				link = CreateCollLink(r.database, r.collection)
+			}
+			u.Consumption = meter.Consumption(link)
+		}
+		if u.Throughput > 0 {
+			u.Utilization = u.Consumption.Peak / float64(u.Throughput)
+		}
+		report = append(report, u)
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return report[i].Utilization < report[j].Utilization
+	})
+	return report, nil
+}
@@ -0,0 +1,73 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRUMeter(t *testing.T) {
+	m := NewRUMeter()
+	now := time.Now()
+	m.Record("/dbs/db/colls/a/docs/1", 5, now)
+	m.Record("dbs/db/colls/a/docs/2", 3, now)
+	m.Record("dbs/db/colls/b/docs/1", 10, now)
+	m.Record("dbs/db/colls/a/docs/3", 4, now.Add(time.Second))
+	m.Record("dbs/db", 1, now.Add(time.Second))
+
+	a := m.Consumption("dbs/db/colls/a")
+	assert.Equal(t, 12.0, a.Total)
+	assert.Equal(t, 8.0, a.Peak)
+	assert.True(t, a.Average > 0)
+	db := m.Consumption("dbs/db")
+	assert.Equal(t, 23.0, db.Total)
+	assert.Equal(t, 18.0, db.Peak)
+	assert.Equal(t, RUConsumption{}, m.Consumption("dbs/db/colls/c"))
+}
+
+func TestOfferReport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_REQUEST_CHARGE, "1")
+		switch r.URL.Path {
+		case "/offers/":
+			w.Write([]byte(`{"Offers": [
+				{"id": "o1", "offerResourceId": "rid-a", "content": {"offerThroughput": 400}},
+				{"id": "o2", "offerResourceId": "rid-b", "content": {"offerThroughput": 10000}},
+				{"id": "o3", "offerResourceId": "rid-db", "content": {"offerThroughput": 1000}}
+			]}`))
+		case "/dbs/":
+			w.Write([]byte(`{"Databases": [{"id": "db", "_rid": "rid-db"}]}`))
+		case "/dbs/db/colls":
+			w.Write([]byte(`{"DocumentCollections": [{"id": "a", "_rid": "rid-a"}, {"id": "b", "_rid": "rid-b"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	meter := NewRUMeter()
+	meter.Record("dbs/db/colls/a/docs/x", 200, time.Now())
+	meter.Record("dbs/db/colls/b/docs/x", 100, time.Now())
+	report, err := c.OfferReport(context.Background(), meter)
+	require.NoError(t, err)
+	require.Len(t, report, 3)
+	assert.Equal(t, "b", report[0].Collection)
+	assert.Equal(t, 0.01, report[0].Utilization)
+	assert.Equal(t, "", report[1].Collection)
+	assert.Equal(t, "db", report[1].Database)
+	assert.Equal(t, 0.3, report[1].Utilization)
+	assert.Equal(t, "a", report[2].Collection)
+	assert.Equal(t, 0.5, report[2].Utilization)
+
+	// The client records its own requests in the meter
+	c.Config.RUMeter = meter
+	_, err = c.OfferReport(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 301.0, meter.Consumption("dbs/db").Total)
+}
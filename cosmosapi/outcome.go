@@ -0,0 +1,123 @@
+package cosmosapi
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Outcome tells whether a write that returned an error may have been applied
+type Outcome int
+
+const (
+	// OutcomeFailed means that the write was definitely not applied, e.g. because Cosmos rejected it; it
+	// is safe to retry the same write
+	OutcomeFailed Outcome = iota
+	// OutcomeSucceeded means that the write was applied (the error was nil)
+	OutcomeSucceeded
+	// OutcomeAmbiguous means that the write may or may not have been applied, e.g. because the request
+	// timed out after it was sent. Read the document to find out before retrying writes that are not
+	// idempotent, such as creates, or transactions that increment a value.
+	OutcomeAmbiguous
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeFailed:
+		return "failed"
+	case OutcomeSucceeded:
+		return "succeeded"
+	case OutcomeAmbiguous:
+		return "ambiguous"
+	}
+	return "unknown"
+}
+
+// failedErrors are the errors for which the write was definitely not applied
+var failedErrors = map[error]bool{
+	ErrInvalidRequest:                 true,
+	ErrUnautorized:                    true,
+	ErrForbidden:                      true,
+	ErrNotFound:                       true,
+	ErrConflict:                       true,
+	ErrGone:                           true,
+	ErrPreconditionFailed:             true,
+	ErrTooLarge:                       true,
+	ErrFailedDependency:               true,
+	ErrTooManyRequests:                true,
+	ErrRetryWith:                      true,
+	ErrReadOnly:                       true,
+	ErrServerless:                     true,
+	ErrPolicyViolation:                true,
+	ErrClientClosed:                   true,
+	ErrWrongQueryContentType:          true,
+	ErrInvalidPartitionKeyType:        true,
+	ErrThroughputRequiresPartitionKey: true,
+	ErrorNotImplemented:               true,
+}
+
+// RetriedError is returned for a request that failed after the client retried it, because of throttling or
+// unavailability. errors.Cause returns the error of the last try, e.g. ErrConflict; since an earlier try
+// may have been applied, WriteOutcome classifies it as OutcomeAmbiguous also then.
+type RetriedError struct {
+	Err error
+	// RetryCount is the number of times the request was retried
+	RetryCount int
+}
+
+func (e RetriedError) Error() string {
+	return fmt.Sprintf("%v (after %d retries)", e.Err, e.RetryCount)
+}
+
+func (e RetriedError) Cause() error {
+	return e.Err
+}
+
+// retried wraps the error of a request that the client retried retryCount times in a RetriedError
+func retried(err error, retryCount int) error {
+	if err == nil || retryCount <= 0 {
+		return err
+	}
+	return RetriedError{Err: err, RetryCount: retryCount}
+}
+
+// RetryCountOf returns the number of times the client retried the request that failed with err, looking
+// through wrapped errors
+func RetryCountOf(err error) int {
+	for err != nil {
+		switch e := err.(type) {
+		case RetriedError:
+			return e.RetryCount
+		case BatchError:
+			return e.RetryCount
+		}
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			return 0
+		}
+		err = causer.Cause()
+	}
+	return 0
+}
+
+// WriteOutcome classifies the error returned by a write. Errors for responses in which Cosmos rejected
+// the request (4xx statuses, except 408 Request Timeout) and errors the client returns without sending
+// the request are OutcomeFailed. Everything else is OutcomeAmbiguous, notably ErrTimeout,
+// ErrInternalError, ErrUnavailable, ErrMaxRetriesExceeded, cancelled contexts and network errors, as the
+// request may have been applied although the client did not get a successful response. So is
+// ErrConflict, ErrPreconditionFailed or ErrNotFound after the client retried the request (see RetriedError),
+// as that is what a write gets if an earlier try was applied. Errors that are not known, e.g. from
+// marshalling the document, are also OutcomeAmbiguous, to be on the safe side. Errors are compared by
+// errors.Cause, so they may be wrapped.
+func WriteOutcome(err error) Outcome {
+	if err == nil {
+		return OutcomeSucceeded
+	}
+	switch cause := errors.Cause(err); {
+	case (cause == ErrConflict || cause == ErrPreconditionFailed || cause == ErrNotFound) && RetryCountOf(err) > 0:
+		return OutcomeAmbiguous
+	case failedErrors[cause]:
+		return OutcomeFailed
+	}
+	return OutcomeAmbiguous
+}
@@ -0,0 +1,56 @@
+package cosmosapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteOutcome(t *testing.T) {
+	assert.Equal(t, OutcomeSucceeded, WriteOutcome(nil))
+	assert.Equal(t, OutcomeFailed, WriteOutcome(ErrConflict))
+	assert.Equal(t, OutcomeFailed, WriteOutcome(errors.Wrap(ErrPreconditionFailed, "id='a'")))
+	assert.Equal(t, OutcomeFailed, WriteOutcome(withCorrelationId(WithCorrelationId(context.Background(), "c"), ErrTooManyRequests)))
+	assert.Equal(t, OutcomeAmbiguous, WriteOutcome(ErrTimeout))
+	assert.Equal(t, OutcomeAmbiguous, WriteOutcome(ErrUnavailable))
+	assert.Equal(t, OutcomeAmbiguous, WriteOutcome(ErrMaxRetriesExceeded))
+	assert.Equal(t, OutcomeAmbiguous, WriteOutcome(context.DeadlineExceeded))
+	assert.Equal(t, OutcomeAmbiguous, WriteOutcome(&net.OpError{Op: "read", Err: errors.New("connection reset")}))
+	assert.Equal(t, "ambiguous", OutcomeAmbiguous.String())
+
+	// Failing on the precondition after a retry may be because an earlier try was applied
+	assert.Equal(t, OutcomeAmbiguous, WriteOutcome(errors.WithStack(RetriedError{Err: ErrPreconditionFailed, RetryCount: 1})))
+	assert.Equal(t, OutcomeAmbiguous, WriteOutcome(BatchError{Index: 0, StatusCode: 409, Err: ErrConflict, RetryCount: 1}))
+	assert.Equal(t, OutcomeFailed, WriteOutcome(RetriedError{Err: ErrForbidden, RetryCount: 1}))
+}
+
+func TestWriteOutcomeRetried(t *testing.T) {
+	tries := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tries++
+		if tries == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusPreconditionFailed)
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey, RetryPolicy: &RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond}}, nil, nil)
+
+	// The replace was retried after a 503, which may have been applied, so the 412 is ambiguous
+	_, _, err := c.ReplaceDocument(context.Background(), "db", "coll", "a", map[string]string{"id": "a"}, ReplaceDocumentOptions{PartitionKeyValue: "p", IfMatch: "etag"})
+	assert.Equal(t, ErrPreconditionFailed, errors.Cause(err))
+	assert.Equal(t, 1, RetryCountOf(err))
+	assert.Equal(t, OutcomeAmbiguous, WriteOutcome(err))
+
+	// Without a retry, it is not
+	tries = 1
+	_, _, err = c.ReplaceDocument(context.Background(), "db", "coll", "a", map[string]string{"id": "a"}, ReplaceDocumentOptions{PartitionKeyValue: "p", IfMatch: "etag"})
+	assert.Equal(t, OutcomeFailed, WriteOutcome(err))
+}
@@ -0,0 +1,154 @@
+package cosmosapi
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+const PATCH_CONTENT_TYPE = "application/json_patch+json"
+
+type PatchOperationType string
+
+const (
+	PatchOpAdd       = PatchOperationType("add")
+	PatchOpSet       = PatchOperationType("set")
+	PatchOpReplace   = PatchOperationType("replace")
+	PatchOpRemove    = PatchOperationType("remove")
+	PatchOpIncrement = PatchOperationType("incr")
+	PatchOpMove      = PatchOperationType("move")
+)
+
+// PatchOperation is a single operation of a partial document update.
+// See https://docs.microsoft.com/en-us/azure/cosmos-db/partial-document-update
+//
+// To keep the exact value of e.g. a monetary amount, pass a json.Number as Value, or a decimal type wrapped in
+// QueryParamAsNumber, rather than a float64.
+type PatchOperation struct {
+	Op    PatchOperationType
+	Path  string
+	Value interface{}
+	// From is the source path of a move operation
+	From string
+}
+
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"op":   op.Op,
+		"path": op.Path,
+	}
+	switch op.Op {
+	case PatchOpRemove:
+	case PatchOpMove:
+		m["from"] = op.From
+	default:
+		// Value must always be present, also if it is e.g. 0, false or null
+		value := op.Value
+		if marshaler, ok := value.(QueryParamMarshaler); ok {
+			var err error
+			if value, err = marshaler.MarshalQueryParam(); err != nil {
+				return nil, err
+			}
+		}
+		m["value"] = value
+	}
+	return json.Marshal(m)
+}
+
+func PatchAdd(path string, value interface{}) PatchOperation {
+	return PatchOperation{Op: PatchOpAdd, Path: path, Value: value}
+}
+
+func PatchSet(path string, value interface{}) PatchOperation {
+	return PatchOperation{Op: PatchOpSet, Path: path, Value: value}
+}
+
+func PatchReplace(path string, value interface{}) PatchOperation {
+	return PatchOperation{Op: PatchOpReplace, Path: path, Value: value}
+}
+
+func PatchRemove(path string) PatchOperation {
+	return PatchOperation{Op: PatchOpRemove, Path: path}
+}
+
+func PatchIncrement(path string, value interface{}) PatchOperation {
+	return PatchOperation{Op: PatchOpIncrement, Path: path, Value: value}
+}
+
+func PatchMove(from, path string) PatchOperation {
+	return PatchOperation{Op: PatchOpMove, From: from, Path: path}
+}
+
+type PatchDocumentOptions struct {
+	PartitionKeyValue interface{}
+	// Condition is a filter predicate on the form "FROM c WHERE c.stock >= 5". If the document does not
+	// match the predicate, the patch is not applied and ErrPreconditionFailed is returned.
+	Condition           string
+	IfMatch             string
+	PreTriggersInclude  []string
+	PostTriggersInclude []string
+	ConsistencyLevel    ConsistencyLevel
+	SessionToken        string
+}
+
+func (ops PatchDocumentOptions) AsHeaders() (map[string]string, error) {
+	headers := map[string]string{}
+
+	if ops.PartitionKeyValue != nil {
+		v, err := MarshalPartitionKeyHeader(ops.PartitionKeyValue)
+		if err != nil {
+			return nil, err
+		}
+		headers[HEADER_PARTITIONKEY] = v
+	}
+
+	headers[HEADER_CONTYPE] = PATCH_CONTENT_TYPE
+	headers[HEADER_VER] = PatchAPIVersion
+
+	if ops.IfMatch != "" {
+		headers[HEADER_IF_MATCH] = ops.IfMatch
+	}
+
+	if ops.PreTriggersInclude != nil && len(ops.PreTriggersInclude) > 0 {
+		headers[HEADER_TRIGGER_PRE_INCLUDE] = strings.Join(ops.PreTriggersInclude, ",")
+	}
+
+	if ops.PostTriggersInclude != nil && len(ops.PostTriggersInclude) > 0 {
+		headers[HEADER_TRIGGER_POST_INCLUDE] = strings.Join(ops.PostTriggersInclude, ",")
+	}
+
+	if ops.ConsistencyLevel != "" {
+		headers[HEADER_CONSISTENCY_LEVEL] = string(ops.ConsistencyLevel)
+	}
+
+	if ops.SessionToken != "" {
+		headers[HEADER_SESSION_TOKEN] = ops.SessionToken
+	}
+
+	return headers, nil
+}
+
+type patchDocumentBody struct {
+	Condition  string           `json:"condition,omitempty"`
+	Operations []PatchOperation `json:"operations"`
+}
+
+// PatchDocument applies a partial update to a document. The updated document is written to out,
+// unless out is nil.
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/patch-a-document
+func (c *Client) PatchDocument(ctx context.Context, dbName, colName, id string,
+	operations []PatchOperation, ops PatchDocumentOptions, out interface{}) (DocumentResponse, error) {
+	headers, err := ops.AsHeaders()
+	if err != nil {
+		return DocumentResponse{}, err
+	}
+
+	link := createDocLink(dbName, colName, id)
+	body := patchDocumentBody{Condition: ops.Condition, Operations: operations}
+
+	resp, err := c.patch(ctx, link, body, out, headers)
+	if err != nil {
+		return parseDocumentResponse(resp), err
+	}
+	return parseDocumentResponse(resp), nil
+}
@@ -0,0 +1,17 @@
+package cosmosapi
+
+import (
+	"context"
+	"time"
+)
+
+// Ping does a cheap metadata read of the database account, to check that the endpoint is reachable and the
+// master key is accepted. It returns the round-trip time of the request.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	var account struct {
+		Id string `json:"id"`
+	}
+	start := time.Now()
+	_, err := c.get(ctx, "", &account, nil)
+	return time.Since(start), err
+}
@@ -0,0 +1,32 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPing(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/", r.URL.Path)
+		assert.NotEmpty(t, r.Header.Get(HEADER_AUTH))
+		w.WriteHeader(status)
+		w.Write([]byte(`{"id":"myaccount"}`))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	latency, err := c.Ping(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, latency > 0)
+
+	status = http.StatusUnauthorized
+	_, err = c.Ping(context.Background())
+	assert.Equal(t, ErrUnautorized, errors.Cause(err))
+}
@@ -0,0 +1,76 @@
+package cosmosapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cannedTransport answers every request with the same document, without a network round trip, so that
+// benchmarks measure the work done by the client
+type cannedTransport struct {
+	body []byte
+}
+
+func (t cannedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"X-Ms-Request-Charge": {"1"}, "X-Ms-Session-Token": {"0:1#2"}, "Etag": {`"etag-1"`}},
+		Body:          ioutil.NopCloser(bytes.NewReader(t.body)),
+		ContentLength: int64(len(t.body)),
+		Request:       r,
+	}, nil
+}
+
+func BenchmarkGetDocument(b *testing.B) {
+	body := []byte(`{"id": "doc", "pk": "p", "x": 1, "_etag": "etag-1", "_ts": 100}`)
+	c := New("https://example.com", Config{MasterKey: TestKey}, &http.Client{Transport: cannedTransport{body: body}}, nil)
+	ops := GetDocumentOptions{PartitionKeyValue: "p", ConsistencyLevel: ConsistencyLevelSession, SessionToken: "0:1#2"}
+	ctx := context.Background()
+	var doc struct {
+		Resource
+		X int `json:"x"`
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.GetDocument(ctx, "db", "coll", "doc", ops, &doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMarshalPartitionKeyHeaderString(t *testing.T) {
+	for _, value := range []string{"", "p", "user-1", `quo"te`, `back\slash`, "<html>", "a&b", "tab\t", "æøå", " "} {
+		expected, err := json.Marshal([]interface{}{value})
+		require.NoError(t, err)
+		header, err := MarshalPartitionKeyHeader(value)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), header, value)
+	}
+}
+
+func TestSignatureCache(t *testing.T) {
+	s, err := newSigner(TestKey)
+	require.NoError(t, err)
+	date := "Thu, 27 Apr 2017 00:51:12 GMT"
+	expected := authHeader(s.signResource("GET", "docs", "dbs/db/colls/coll/docs/doc", date))
+	assert.Equal(t, expected, s.authorization("GET", "docs", "dbs/db/colls/coll/docs/doc", date))
+	assert.Equal(t, expected, s.authorization("GET", "docs", "dbs/db/colls/coll/docs/doc", date))
+	assert.NotEqual(t, expected, s.authorization("GET", "docs", "dbs/db/colls/coll/docs/other", date))
+	assert.NotEqual(t, expected, s.authorization("GET", "docs", "dbs/db/colls/coll/docs/doc", "Thu, 27 Apr 2017 00:51:13 GMT"))
+}
+
+func TestParseDocumentResponseMissingHeaders(t *testing.T) {
+	parsed := parseDocumentResponse(&cosmosResponse{Response: &http.Response{StatusCode: http.StatusOK, Header: http.Header{"X-Ms-Request-Charge": {"1.5"}, "Lsn": {"7"}}}})
+	assert.Equal(t, 1.5, parsed.RUs)
+	assert.Equal(t, int64(7), parsed.LSN)
+	assert.Equal(t, int64(-1), parsed.GlobalCommittedLSN)
+	assert.Equal(t, 0, parsed.RetryCount)
+}
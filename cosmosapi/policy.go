@@ -0,0 +1,109 @@
+package cosmosapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrPolicyViolation = errors.New("The request was rejected by the client policy")
+
+// PolicyViolationError is returned when Config.Policy rejects a request
+type PolicyViolationError struct {
+	Method string
+	Link   string
+	// Err is the error returned by the policy
+	Err error
+}
+
+func (e PolicyViolationError) Error() string {
+	return fmt.Sprintf("%v: %s %s: %v", ErrPolicyViolation, e.Method, e.Link, e.Err)
+}
+
+// Cause returns ErrPolicyViolation, so that errors.Cause can be used to check for policy violations
+func (e PolicyViolationError) Cause() error {
+	return ErrPolicyViolation
+}
+
+// PolicyRequest describes a request that is about to be sent to Cosmos
+type PolicyRequest struct {
+	Method string
+	// Endpoint is the URL of the account endpoint the request is sent to (Client.Url), e.g.
+	// https://myaccount-westeurope.documents.azure.com:443
+	Endpoint string
+	// Link is the resource link, e.g. dbs/mydb/colls/mycoll/docs/mydoc
+	Link    string
+	Headers http.Header
+	// Body is the serialized request body, or nil if there is none. It must not be modified or retained.
+	Body []byte
+}
+
+// IsWrite returns true if the request may modify data; i.e. all requests except reads and queries
+func (r PolicyRequest) IsWrite() bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return false
+	case http.MethodPost:
+		return r.Headers.Get(HEADER_IS_QUERY) != "true"
+	default:
+		return true
+	}
+}
+
+// Policy is consulted before every request made by a Client that has Config.Policy set, and can reject
+// the request by returning an error; the request is then not sent, and a PolicyViolationError with cause
+// ErrPolicyViolation is returned. This enforces rules such as data residency centrally in the client,
+// rather than relying on every caller to check them.
+type Policy func(req PolicyRequest) error
+
+// RestrictWrites returns a Policy rejecting writes for which restricted returns true, unless they are sent
+// through one of allowedEndpoints. E.g. to ensure that EU customer data is only written through EU
+// endpoints:
+//
+//	cosmosapi.RestrictWrites([]string{"https://myaccount-westeurope.documents.azure.com:443"},
+//		func(req cosmosapi.PolicyRequest) bool { return bytes.Contains(req.Body, []byte(`"region":"eu"`)) })
+//
+// Endpoints are compared ignoring case and trailing slashes.
+func RestrictWrites(allowedEndpoints []string, restricted func(req PolicyRequest) bool) Policy {
+	allowed := make(map[string]bool)
+	for _, endpoint := range allowedEndpoints {
+		allowed[normalizeEndpoint(endpoint)] = true
+	}
+	return func(req PolicyRequest) error {
+		if !req.IsWrite() || allowed[normalizeEndpoint(req.Endpoint)] || !restricted(req) {
+			return nil
+		}
+		return errors.Errorf("Restricted write to %s through endpoint %s", req.Link, req.Endpoint)
+	}
+}
+
+func normalizeEndpoint(endpoint string) string {
+	return strings.ToLower(strings.TrimRight(endpoint, "/"))
+}
+
+func (c *Client) checkPolicy(method, link string, headers http.Header, body *requestBody) error {
+	if c.Config.Policy == nil && !c.Config.ReadOnly {
+		return nil
+	}
+	req := PolicyRequest{
+		Method:   method,
+		Endpoint: c.Url,
+		Link:     link,
+		Headers:  headers,
+	}
+	if c.Config.ReadOnly && req.IsWrite() {
+		return errors.Wrapf(ErrReadOnly, "%s %s", method, link)
+	}
+	if c.Config.Policy == nil {
+		return nil
+	}
+	if body != nil {
+		req.Body = body.buf.Bytes()
+	}
+	if err := c.Config.Policy(req); err != nil {
+		return PolicyViolationError{Method: method, Link: link, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package cosmosapi
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestrictWrites(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"doc"}`))
+	}))
+	defer ts.Close()
+
+	euOnly := func(req PolicyRequest) bool {
+		return bytes.Contains(req.Body, []byte(`"region":"eu"`))
+	}
+	ctx := context.Background()
+	ops := CreateDocumentOptions{PartitionKeyValue: "doc"}
+
+	// Writing through an allowed endpoint
+	c := New(ts.URL, Config{MasterKey: TestKey, Policy: RestrictWrites([]string{ts.URL + "/"}, euOnly)}, nil, nil)
+	_, _, err := c.CreateDocument(ctx, "db", "coll", map[string]string{"id": "doc", "region": "eu"}, ops)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	// Writing through another endpoint
+	c = New(ts.URL, Config{MasterKey: TestKey, Policy: RestrictWrites([]string{"https://eu.example.com"}, euOnly)}, nil, nil)
+	_, _, err = c.CreateDocument(ctx, "db", "coll", map[string]string{"id": "doc", "region": "eu"}, ops)
+	assert.Equal(t, ErrPolicyViolation, errors.Cause(err))
+	violation, ok := err.(PolicyViolationError)
+	require.True(t, ok)
+	assert.Equal(t, "Restricted write to dbs/db/colls/coll/docs through endpoint "+ts.URL, violation.Err.Error())
+	assert.Equal(t, 1, requests)
+
+	// Unrestricted documents, reads and queries are not affected
+	_, _, err = c.CreateDocument(ctx, "db", "coll", map[string]string{"id": "doc", "region": "us"}, ops)
+	require.NoError(t, err)
+	_, err = c.GetDocument(ctx, "db", "coll", "doc", GetDocumentOptions{PartitionKeyValue: "doc"}, &map[string]interface{}{})
+	require.NoError(t, err)
+	query := Query{Query: `SELECT * FROM c WHERE c.region = "eu"`}
+	_, err = c.QueryDocuments(ctx, "db", "coll", query, &[]interface{}{}, DefaultQueryDocumentOptions())
+	assert.NotEqual(t, ErrPolicyViolation, errors.Cause(err))
+	assert.Equal(t, 4, requests)
+}
+
+func TestReadOnly(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id":"doc"}`))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := New(ts.URL, Config{MasterKey: TestKey, ReadOnly: true}, nil, nil)
+	_, _, err := c.CreateDocument(ctx, "db", "coll", map[string]string{"id": "doc"}, CreateDocumentOptions{PartitionKeyValue: "doc"})
+	assert.Equal(t, ErrReadOnly, errors.Cause(err))
+	_, err = c.DeleteDocument(ctx, "db", "coll", "doc", DeleteDocumentOptions{PartitionKeyValue: "doc"})
+	assert.Equal(t, ErrReadOnly, errors.Cause(err))
+	assert.Equal(t, 0, requests)
+
+	_, err = c.GetDocument(ctx, "db", "coll", "doc", GetDocumentOptions{PartitionKeyValue: "doc"}, &map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+}
@@ -0,0 +1,108 @@
+package cosmosapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Buffers larger than this are not returned to the pool, so that a single huge document does not keep
+// memory allocated for the lifetime of the process.
+const maxPooledBufferSize = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// requestBody holds a serialized request body in a pooled buffer. The body is read once per attempt
+// (retries), and the http.Transport is allowed to close the body after Do() has returned, so the buffer
+// is reference counted and only returned to the pool once the caller and all readers are done with it.
+type requestBody struct {
+	buf  *bytes.Buffer
+	refs int32
+}
+
+// newRequestBody serializes body into a pooled buffer. The caller must call release() when done.
+func newRequestBody(body interface{}) (*requestBody, error) {
+	buf := getBuffer()
+	var err error
+	switch t := body.(type) {
+	case string:
+		_, err = buf.WriteString(t)
+	case []byte:
+		_, err = buf.Write(t)
+	default:
+		err = json.NewEncoder(buf).Encode(t)
+	}
+	if err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return &requestBody{buf: buf, refs: 1}, nil
+}
+
+func (b *requestBody) len() int64 {
+	return int64(b.buf.Len())
+}
+
+// reader returns a new reader over the body; the reference is released when the reader is closed.
+func (b *requestBody) reader() io.ReadCloser {
+	atomic.AddInt32(&b.refs, 1)
+	return &requestBodyReader{Reader: bytes.NewReader(b.buf.Bytes()), body: b}
+}
+
+func (b *requestBody) release() {
+	if atomic.AddInt32(&b.refs, -1) == 0 {
+		putBuffer(b.buf)
+	}
+}
+
+type requestBodyReader struct {
+	*bytes.Reader
+	body   *requestBody
+	closed int32
+}
+
+func (r *requestBodyReader) Close() error {
+	if atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		r.body.release()
+	}
+	return nil
+}
+
+// readJson reads a JSON response into the given interface (struct, map, ..) through a pooled buffer
+func readJson(reader io.Reader, data interface{}, useNumber bool) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(reader); err != nil {
+		return err
+	}
+	return unmarshalJson(buf.Bytes(), data, useNumber)
+}
+
+// unmarshalJson is json.Unmarshal, optionally decoding numbers into interface{} values as json.Number
+func unmarshalJson(data []byte, v interface{}, useNumber bool) error {
+	if !useNumber {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -2,8 +2,9 @@ package cosmosapi
 
 import (
 	"context"
-	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 type Query struct {
@@ -17,12 +18,40 @@ type QueryParam struct {
 	Value interface{} `json:"value"`
 }
 
-// TODO: add missing fields
+// NewQuery returns a Query with the named parameters, e.g.
+//
+//	NewQuery("SELECT * FROM c WHERE c.userId = @userId", map[string]interface{}{"userId": userId})
+//
+// The names may be given with or without the leading @. The parameters are sorted by name, so that the
+// same query always has the same body.
+func NewQuery(query string, params map[string]interface{}) Query {
+	qry := Query{Query: query}
+	for name, value := range params {
+		if !strings.HasPrefix(name, "@") {
+			name = "@" + name
+		}
+		qry.Params = append(qry.Params, QueryParam{Name: name, Value: value})
+	}
+	sort.Slice(qry.Params, func(i, j int) bool { return qry.Params[i].Name < qry.Params[j].Name })
+	return qry
+}
+
 type QueryDocumentsResponse struct {
 	ResponseBase
-	Documents    interface{}
+	Documents interface{}
+	// Count is the number of documents in the page
 	Count        int `json:"_count"`
 	Continuation string
+	SessionToken string
+	// Size is the size of the response body in bytes, or -1 if it is not known
+	Size int64
+	// RetryCount is the number of times the client retried the request, because of throttling or unavailability
+	RetryCount int
+}
+
+// HasMore returns true if there are more pages of results, to be read with Continuation
+func (r QueryDocumentsResponse) HasMore() bool {
+	return r.Continuation != ""
 }
 
 // QueryDocumentsOptions bundles all options supported by Cosmos DB when
@@ -34,8 +63,10 @@ type QueryDocumentsOptions struct {
 	MaxItemCount         int
 	Continuation         string
 	EnableCrossPartition bool
-	ConsistencyLevel     ConsistencyLevel
-	SessionToken         string
+	// PartitionKeyRangeId restricts the query to a partition key range; see QueryDocumentsCrossPartition
+	PartitionKeyRangeId string
+	ConsistencyLevel    ConsistencyLevel
+	SessionToken        string
 }
 
 const QUERY_CONTENT_TYPE = "application/query+json"
@@ -53,6 +84,12 @@ func (c *Client) QueryDocuments(ctx context.Context, dbName, collName string, qr
 	response.Documents = docs
 	httpResponse, err := c.query(ctx, link, qry, &response, headers)
 	if err != nil {
+		if httpResponse != nil {
+			// failed queries are charged too
+			response.RequestCharge = parseFloatHeader(getHeader(httpResponse.Header, HEADER_REQUEST_CHARGE))
+			response.StatusCode = httpResponse.StatusCode
+			response.RetryCount = httpResponse.retryCount
+		}
 		return response, err
 	}
 	return response.parse(httpResponse)
@@ -102,6 +139,10 @@ func (ops QueryDocumentsOptions) asHeaders() (map[string]string, error) {
 		headers[HEADER_CROSSPARTITION] = strconv.FormatBool(ops.EnableCrossPartition)
 	}
 
+	if ops.PartitionKeyRangeId != "" {
+		headers[HEADER_PARTITION_KEY_RANGE_ID] = ops.PartitionKeyRangeId
+	}
+
 	if ops.ConsistencyLevel != "" {
 		headers[HEADER_CONSISTENCY_LEVEL] = string(ops.ConsistencyLevel)
 	}
@@ -113,9 +154,12 @@ func (ops QueryDocumentsOptions) asHeaders() (map[string]string, error) {
 	return headers, nil
 }
 
-func (r QueryDocumentsResponse) parse(httpResponse *http.Response) (QueryDocumentsResponse, error) {
+func (r QueryDocumentsResponse) parse(httpResponse *cosmosResponse) (QueryDocumentsResponse, error) {
 	responseBase, err := parseHttpResponse(httpResponse)
 	r.ResponseBase = responseBase
 	r.Continuation = httpResponse.Header.Get(HEADER_CONTINUATION)
+	r.SessionToken = httpResponse.Header.Get(HEADER_SESSION_TOKEN)
+	r.Size = httpResponse.ContentLength
+	r.RetryCount = httpResponse.retryCount
 	return r, err
 }
@@ -0,0 +1,152 @@
+package cosmosapi
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The parallelism used by QueryDocumentsCrossPartition if none is given
+const DefaultCrossPartitionParallelism = 4
+
+// CrossPartitionQueryOptions are the options of QueryDocumentsCrossPartition
+type CrossPartitionQueryOptions struct {
+	// Parallelism is the maximum number of partition key ranges queried at the same time;
+	// DefaultCrossPartitionParallelism if 0
+	Parallelism int
+	// AdaptiveParallelism, if set, is used instead of Parallelism to limit the number of requests done at the
+	// same time, tuning the limit to the throttling seen
+	AdaptiveParallelism *AdaptiveParallelism
+	MaxItemCount        int
+	ConsistencyLevel    ConsistencyLevel
+	SessionToken        string
+}
+
+// QueryDocumentsCrossPartition runs the query on each of the partition key ranges of the collection, reading
+// all pages, and stores the results in docs, which must be a pointer to a slice. The ranges are queried
+// concurrently, with at most ops.Parallelism at the same time, and their results are merged in the order of
+// the ranges; so the results are not ordered across ranges even if the query has ORDER BY, and aggregates,
+// TOP, OFFSET/LIMIT and DISTINCT apply per range. The response has the sum of the request charges of all the
+// requests, and the number of documents. If a range fails, the others are cancelled and the error returned.
+func (c *Client) QueryDocumentsCrossPartition(ctx context.Context, dbName, collName string, qry Query, docs interface{}, ops CrossPartitionQueryOptions) (QueryDocumentsResponse, error) {
+	response := QueryDocumentsResponse{Documents: docs}
+	out := reflect.ValueOf(docs)
+	if out.Kind() != reflect.Ptr || out.Elem().Kind() != reflect.Slice {
+		return response, errors.New("QueryDocumentsCrossPartition: docs must be a pointer to a slice")
+	}
+	var ranges []PartitionKeyRange
+	p := c.NewPartitionKeyRangesPaginator(dbName, collName, &GetPartitionKeyRangesOptions{MaxItemCount: -1})
+	for p.Next() {
+		page, err := p.CurrentPage(ctx)
+		response.RequestCharge += page.RequestCharge
+		if err != nil {
+			return response, errors.WithMessage(err, "Failed to get partition key ranges for cross-partition query")
+		}
+		ranges = append(ranges, page.PartitionKeyRanges...)
+	}
+	rangeIds := currentPartitionKeyRangeIds(ranges)
+
+	parallelism := ops.Parallelism
+	if ops.AdaptiveParallelism != nil {
+		// All ranges are queried at once, with each request waiting for ops.AdaptiveParallelism
+		parallelism = len(rangeIds)
+	} else if parallelism <= 0 {
+		parallelism = DefaultCrossPartitionParallelism
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]reflect.Value, len(rangeIds))
+	charges := make([]float64, len(rangeIds))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error // the first range to fail cancels the others, which then fail too
+	for i, rangeId := range rangeIds {
+		wg.Add(1)
+		go func(i int, rangeId string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			var err error
+			results[i], charges[i], err = c.queryPartitionKeyRange(ctx, dbName, collName, qry, out.Elem().Type(), rangeId, ops)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(i, rangeId)
+	}
+	wg.Wait()
+
+	merged := reflect.MakeSlice(out.Elem().Type(), 0, 0)
+	for i := range rangeIds {
+		response.RequestCharge += charges[i]
+		if results[i].IsValid() {
+			merged = reflect.AppendSlice(merged, results[i])
+		}
+	}
+	if firstErr != nil {
+		return response, firstErr
+	}
+	out.Elem().Set(merged)
+	response.Count = merged.Len()
+	return response, nil
+}
+
+// queryPartitionKeyRange reads all pages of the query on a partition key range into a new slice of sliceType
+func (c *Client) queryPartitionKeyRange(ctx context.Context, dbName, collName string, qry Query, sliceType reflect.Type,
+	rangeId string, ops CrossPartitionQueryOptions) (result reflect.Value, requestCharge float64, err error) {
+
+	queryOps := DefaultQueryDocumentOptions()
+	queryOps.PartitionKeyRangeId = rangeId
+	queryOps.EnableCrossPartition = true
+	queryOps.MaxItemCount = ops.MaxItemCount
+	queryOps.ConsistencyLevel = ops.ConsistencyLevel
+	queryOps.SessionToken = ops.SessionToken
+	result = reflect.MakeSlice(sliceType, 0, 0)
+	for {
+		page := reflect.New(sliceType)
+		var done func(err error, retryCount int)
+		if ops.AdaptiveParallelism != nil {
+			if done, err = ops.AdaptiveParallelism.Acquire(ctx); err != nil {
+				return result, requestCharge, errors.WithMessage(err, "partition key range "+rangeId)
+			}
+		}
+		response, err := c.QueryDocuments(ctx, dbName, collName, qry, page.Interface(), queryOps)
+		if done != nil {
+			done(err, response.RetryCount)
+		}
+		requestCharge += response.RequestCharge
+		if err != nil {
+			return result, requestCharge, errors.WithMessage(err, "partition key range "+rangeId)
+		}
+		result = reflect.AppendSlice(result, page.Elem())
+		if !response.HasMore() {
+			return result, requestCharge, nil
+		}
+		queryOps.Continuation = response.Continuation
+	}
+}
+
+// currentPartitionKeyRangeIds returns the ids of the ranges that have not been split, i.e. that are not the
+// parents of other ranges
+func currentPartitionKeyRangeIds(ranges []PartitionKeyRange) []string {
+	parents := map[string]bool{}
+	for _, r := range ranges {
+		for _, parent := range r.Parents {
+			parents[parent] = true
+		}
+	}
+	var ids []string
+	for _, r := range ranges {
+		if !parents[r.Id] {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids
+}
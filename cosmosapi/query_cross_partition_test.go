@@ -0,0 +1,98 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryDocumentsCrossPartition(t *testing.T) {
+	var mu sync.Mutex
+	queried := map[string]int{}
+	failRange := ""
+	unavailableRange := "" // fails once with 503 Service Unavailable
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_REQUEST_CHARGE, "1")
+		if strings.HasSuffix(r.URL.Path, "/pkranges") {
+			// Range 0 has been split into 1 and 2, and the ranges come in two pages
+			if r.Header.Get(HEADER_CONTINUATION) == "" {
+				w.Header().Set(HEADER_CONTINUATION, "pkranges")
+				w.Write([]byte(`{"PartitionKeyRanges": [{"id": "0"}, {"id": "1", "parents": ["0"]}]}`))
+			} else {
+				w.Write([]byte(`{"PartitionKeyRanges": [{"id": "2", "parents": ["0"]}]}`))
+			}
+			return
+		}
+		rangeId := r.Header.Get(HEADER_PARTITION_KEY_RANGE_ID)
+		mu.Lock()
+		queried[rangeId]++
+		unavailable := rangeId == unavailableRange
+		if unavailable {
+			unavailableRange = ""
+		}
+		mu.Unlock()
+		switch {
+		case unavailable:
+			w.Header().Set(HEADER_RETRY_AFTER_MS, "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case rangeId == failRange:
+			w.WriteHeader(http.StatusBadRequest)
+		case rangeId == "1" && r.Header.Get(HEADER_CONTINUATION) == "":
+			w.Header().Set(HEADER_CONTINUATION, "more")
+			w.Write([]byte(`{"Documents": [{"id": "a"}]}`))
+		case rangeId == "1":
+			w.Write([]byte(`{"Documents": [{"id": "b"}]}`))
+		default:
+			w.Write([]byte(`{"Documents": [{"id": "c"}]}`))
+		}
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	var docs []Resource
+	resp, err := c.QueryDocumentsCrossPartition(context.Background(), "db", "coll", Query{Query: "SELECT * FROM c"}, &docs, CrossPartitionQueryOptions{Parallelism: 2})
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+	assert.Equal(t, []string{"a", "b", "c"}, []string{docs[0].Id, docs[1].Id, docs[2].Id})
+	assert.Equal(t, 3, resp.Count)
+	assert.Equal(t, 5.0, resp.RequestCharge)
+	assert.Equal(t, map[string]int{"1": 2, "2": 1}, queried)
+
+	docs = nil
+	parallelism := NewAdaptiveParallelism(AdaptiveParallelismConfig{Initial: 1})
+	_, err = c.QueryDocumentsCrossPartition(context.Background(), "db", "coll", Query{Query: "SELECT * FROM c"}, &docs, CrossPartitionQueryOptions{AdaptiveParallelism: parallelism})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, []string{docs[0].Id, docs[1].Id, docs[2].Id})
+	assert.Equal(t, 3, parallelism.Limit()) // increased after 1 and 2 more successful requests
+
+	// An unavailable range halves the limit, whether the client retried it or failed with ErrUnavailable
+	retrying := New(ts.URL, Config{MasterKey: TestKey, RetryPolicy: &RetryPolicy{MaxRetries: 1}}, nil, nil)
+	notRetrying := New(ts.URL, Config{MasterKey: TestKey, RetryPolicy: &RetryPolicy{StatusCodes: []int{http.StatusTooManyRequests}}}, nil, nil)
+	for _, client := range []*Client{retrying, notRetrying} {
+		mu.Lock()
+		unavailableRange = "2"
+		mu.Unlock()
+		docs = nil
+		parallelism = NewAdaptiveParallelism(AdaptiveParallelismConfig{Initial: 4, Max: 4})
+		_, err = client.QueryDocumentsCrossPartition(context.Background(), "db", "coll", Query{Query: "SELECT * FROM c"}, &docs, CrossPartitionQueryOptions{AdaptiveParallelism: parallelism})
+		if client == notRetrying {
+			assert.Equal(t, ErrUnavailable, errors.Cause(err))
+		} else {
+			require.NoError(t, err)
+		}
+		assert.True(t, parallelism.Limit() < 4)
+	}
+
+	failRange = "2"
+	docs = nil
+	_, err = c.QueryDocumentsCrossPartition(context.Background(), "db", "coll", Query{Query: "SELECT * FROM c"}, &docs, CrossPartitionQueryOptions{})
+	assert.Equal(t, ErrInvalidRequest, errors.Cause(err))
+	assert.Nil(t, docs)
+}
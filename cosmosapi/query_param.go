@@ -0,0 +1,86 @@
+package cosmosapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// QueryParamMarshaler is implemented by types that control how they are passed as query parameters.
+// MarshalQueryParam returns the value to pass instead, which is serialized as JSON.
+type QueryParamMarshaler interface {
+	MarshalQueryParam() (interface{}, error)
+}
+
+// QueryParamAsString passes v as a JSON string, e.g. to compare with numbers that are stored as strings
+func QueryParamAsString(v interface{}) QueryParamMarshaler {
+	return queryParamString{v}
+}
+
+// QueryParamAsNumber passes v as a JSON number, using the exact representation of fmt.Sprint(v); e.g. for
+// decimal types that would otherwise be serialized as strings. It fails if that is not a valid number.
+func QueryParamAsNumber(v interface{}) QueryParamMarshaler {
+	return queryParamNumber{v}
+}
+
+type queryParamString struct{ v interface{} }
+
+func (p queryParamString) MarshalQueryParam() (interface{}, error) {
+	switch v := p.v.(type) {
+	case string:
+		return v, nil
+	case time.Time:
+		return formatQueryTime(v), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	return fmt.Sprint(p.v), nil
+}
+
+type queryParamNumber struct{ v interface{} }
+
+func (p queryParamNumber) MarshalQueryParam() (interface{}, error) {
+	n := json.Number(fmt.Sprint(p.v))
+	if _, err := json.Marshal(n); err != nil {
+		return nil, errors.Errorf("Query parameter %v is not a number", p.v)
+	}
+	return n, nil
+}
+
+// formatQueryTime formats times the way encoding/json does, in UTC, so that they match (and sort like) times
+// stored in documents by encoding/json in UTC
+func formatQueryTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// queryParamValue returns the value to serialize for a query parameter
+func queryParamValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case QueryParamMarshaler:
+		return v.MarshalQueryParam()
+	case time.Time:
+		return formatQueryTime(v), nil
+	case *time.Time:
+		if v == nil {
+			return nil, nil
+		}
+		return formatQueryTime(*v), nil
+	}
+	return v, nil
+}
+
+// MarshalJSON serializes the parameter, with the value converted as follows: a QueryParamMarshaler is
+// replaced by the value it returns, and a time.Time is formatted as RFC 3339 in UTC. Other values are
+// serialized by encoding/json.
+func (p QueryParam) MarshalJSON() ([]byte, error) {
+	value, err := queryParamValue(p.Value)
+	if err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("Failed to marshal query parameter %s", p.Name))
+	}
+	return json.Marshal(struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}{p.Name, value})
+}
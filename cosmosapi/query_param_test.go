@@ -0,0 +1,51 @@
+package cosmosapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cents int64
+
+func (c cents) MarshalQueryParam() (interface{}, error) {
+	return float64(c) / 100, nil
+}
+
+type decimal string
+
+func (d decimal) String() string {
+	return string(d)
+}
+
+func TestQueryParamMarshalling(t *testing.T) {
+	at := time.Date(2023, 1, 2, 4, 4, 5, 600000000, time.FixedZone("CET", 3600))
+	var nilTime *time.Time
+	qry := Query{Query: "SELECT * FROM c", Params: []QueryParam{
+		{Name: "@time", Value: at},
+		{Name: "@timePtr", Value: &at},
+		{Name: "@nilTime", Value: nilTime},
+		{Name: "@cents", Value: cents(1250)},
+		{Name: "@string", Value: QueryParamAsString(42)},
+		{Name: "@number", Value: QueryParamAsNumber(decimal("12.10"))},
+		{Name: "@plain", Value: 1},
+	}}
+	b, err := json.Marshal(qry)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"query": "SELECT * FROM c", "parameters": [
+		{"name": "@time", "value": "2023-01-02T03:04:05.6Z"},
+		{"name": "@timePtr", "value": "2023-01-02T03:04:05.6Z"},
+		{"name": "@nilTime", "value": null},
+		{"name": "@cents", "value": 12.5},
+		{"name": "@string", "value": "42"},
+		{"name": "@number", "value": 12.10},
+		{"name": "@plain", "value": 1}
+	]}`, string(b))
+	assert.Contains(t, string(b), `12.10`)
+
+	_, err = json.Marshal(QueryParam{Name: "@x", Value: QueryParamAsNumber("abc")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package cosmosapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryDocuments(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/dbs/db/colls/coll/docs", r.URL.Path)
+		assert.Equal(t, "true", r.Header.Get(HEADER_IS_QUERY))
+		assert.Equal(t, QUERY_CONTENT_TYPE, r.Header.Get(HEADER_CONTYPE))
+		assert.Equal(t, `["u"]`, r.Header.Get(HEADER_PARTITIONKEY))
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{
+			"query": "SELECT * FROM c WHERE c.userId = @userId AND c.x > @x",
+			"parameters": [{"name": "@userId", "value": "u"}, {"name": "@x", "value": 1}]
+		}`, string(b))
+		w.Header().Set(HEADER_CONTINUATION, "more")
+		w.Write([]byte(`{"Documents": [{"id": "a", "x": 2}, {"id": "b", "x": 3}], "_count": 2}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	qry := NewQuery("SELECT * FROM c WHERE c.userId = @userId AND c.x > @x", map[string]interface{}{"@userId": "u", "x": 1})
+	ops := DefaultQueryDocumentOptions()
+	ops.PartitionKeyValue = "u"
+	var docs []struct {
+		Id string `json:"id"`
+		X  int    `json:"x"`
+	}
+	resp, err := c.QueryDocuments(context.Background(), "db", "coll", qry, &docs, ops)
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, 3, docs[1].X)
+	assert.Equal(t, 2, resp.Count)
+	assert.True(t, resp.HasMore())
+	assert.Equal(t, int64(len(`{"Documents": [{"id": "a", "x": 2}, {"id": "b", "x": 3}], "_count": 2}`)), resp.Size)
+}
+
+func TestQueryDocumentsChunkedSize(t *testing.T) {
+	body := `{"Documents": [{"id": "a"}], "_count": 1}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body[:10]))
+		w.(http.Flusher).Flush() // no Content-Length
+		w.Write([]byte(body[10:]))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	var docs []struct {
+		Id string `json:"id"`
+	}
+	resp, err := c.QueryDocuments(context.Background(), "db", "coll", Query{Query: "SELECT * FROM c"}, &docs, DefaultQueryDocumentOptions())
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, int64(len(body)), resp.Size)
+}
+
+func TestQueryDocumentsRequestCharge(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_REQUEST_CHARGE, "2.87")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"Documents": [], "_count": 0}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	var docs []struct{}
+	resp, err := c.QueryDocuments(context.Background(), "db", "coll", Query{Query: "SELECT * FROM c"}, &docs, DefaultQueryDocumentOptions())
+	require.NoError(t, err)
+	assert.Equal(t, 2.87, resp.RequestCharge)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Failed queries are charged too
+	status = http.StatusBadRequest
+	resp, err = c.QueryDocuments(context.Background(), "db", "coll", Query{Query: "SELECT * FROM"}, &docs, DefaultQueryDocumentOptions())
+	require.Error(t, err)
+	assert.Equal(t, 2.87, resp.RequestCharge)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -1,10 +1,11 @@
 package cosmosapi
 
 import (
-	"encoding/json"
-	"io"
 	"math/rand"
+	"net/http"
+	"net/textproto"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,14 +34,28 @@ const (
 	HEADER_TRIGGER_PRE_EXCLUDE    = "x-ms-documentdb-pre-trigger-exclude"
 	HEADER_TRIGGER_POST_INCLUDE   = "x-ms-documentdb-post-trigger-include"
 	HEADER_TRIGGER_POST_EXCLUDE   = "x-ms-documentdb-post-trigger-exclude"
+	// HEADER_POPULATE_QUOTA_INFO and HEADER_POPULATE_PARTITION_STATISTICS ask for the usage of a collection
+	// and the sizes of its partitions when reading it; see GetCollectionStatistics
+	HEADER_POPULATE_QUOTA_INFO           = "x-ms-documentdb-populatequotainfo"
+	HEADER_POPULATE_PARTITION_STATISTICS = "x-ms-documentdb-populatepartitionstatistics"
 
 	// Both request and response
 	HEADER_SESSION_TOKEN = "x-ms-session-token"
 	HEADER_CONTINUATION  = "x-ms-continuation"
 
 	// Response headers
-	HEADER_REQUEST_CHARGE = "x-ms-request-charge"
-	HEADER_ETAG           = "etag"
+	HEADER_REQUEST_CHARGE           = "x-ms-request-charge"
+	HEADER_ETAG                     = "etag"
+	HEADER_ACTIVITY_ID              = "x-ms-activity-id"
+	HEADER_LSN                      = "lsn"
+	HEADER_ITEM_LSN                 = "x-ms-item-lsn"
+	HEADER_GLOBAL_COMMITTED_LSN     = "x-ms-global-committed-lsn"
+	HEADER_QUORUM_ACKED_LSN         = "x-ms-quorum-acked-lsn"
+	HEADER_CURRENT_WRITE_QUORUM     = "x-ms-current-write-quorum"
+	HEADER_CURRENT_REPLICA_SET_SIZE = "x-ms-current-replica-set-size"
+	HEADER_RESOURCE_QUOTA           = "x-ms-resource-quota"
+	HEADER_RESOURCE_USAGE           = "x-ms-resource-usage"
+	HEADER_REQUEST_DURATION_MS      = "x-ms-request-duration-ms"
 )
 
 type RequestOptions map[RequestOption]string
@@ -52,21 +67,82 @@ var (
 	ReqOpPartitionKey        = RequestOption(HEADER_PARTITIONKEY)
 )
 
-// defaultHeaders returns a map containing the default headers required
-// for all requests to the cosmos db api.
-func defaultHeaders(method, link, key string) (map[string]string, error) {
-	h := map[string]string{}
-	h[HEADER_XDATE] = time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")
-	h[HEADER_VER] = apiVersion
+// setDefaultHeaders sets the default headers required for all requests to
+// the cosmos db api.
+func setDefaultHeaders(h http.Header, method, link string, s *signer) {
+	rLink, rType := resourceTypeFromLink(strings.TrimPrefix(link, "/"))
+	setDefaultHeadersForResource(h, method, rType, rLink, s, time.Now())
+}
+
+// setDefaultHeadersForResource is like setDefaultHeaders, with the resource type and link to sign, and the
+// time to sign the request at, given
+func setDefaultHeadersForResource(h http.Header, method, rType, rLink string, s *signer, now time.Time) {
+	date := formatDate(now)
+	h[HEADER_XDATE] = []string{date}
+	if h.Get(HEADER_VER) == "" {
+		// Some operations require a newer API version, and set it themselves
+		h[HEADER_VER] = []string{DefaultAPIVersion}
+	}
+	h[HEADER_AUTH] = []string{s.authorization(method, rType, rLink, date)}
+}
+
+type formattedDate struct {
+	unix int64
+	date string
+}
 
-	sign, err := signedPayload(method, link, h[HEADER_XDATE], key)
-	if err != nil {
-		return h, err
+// lastDate is the formattedDate of the last request
+var lastDate atomic.Value
+
+// formatDate formats the time for the x-ms-date header, reusing the string formatted for the last request
+// if it is within the same second
+func formatDate(now time.Time) string {
+	unix := now.Unix()
+	if last, ok := lastDate.Load().(formattedDate); ok && last.unix == unix {
+		return last.date
 	}
+	date := now.UTC().Format(http.TimeFormat)
+	lastDate.Store(formattedDate{unix: unix, date: date})
+	return date
+}
 
-	h[HEADER_AUTH] = authHeader(sign)
+// canonicalHeaderKeys are the canonical forms of the headers used by the client, so that they are not
+// canonicalized on every request and response
+var canonicalHeaderKeys = map[string]string{}
+
+func init() {
+	for _, key := range []string{
+		HEADER_IS_QUERY, HEADER_UPSERT, HEADER_IF_MATCH, HEADER_IF_NONE_MATCH, HEADER_CONSISTENCY_LEVEL,
+		HEADER_OFFER_THROUGHPUT, HEADER_OFFER_TYPE, HEADER_OFFER_AUTOPILOT_SETTINGS, HEADER_MAX_ITEM_COUNT, HEADER_A_IM, HEADER_PARTITION_KEY_RANGE_ID,
+		HEADER_CROSSPARTITION, HEADER_PARTITIONKEY, HEADER_INDEXINGDIRECTIVE, HEADER_TRIGGER_PRE_INCLUDE,
+		HEADER_TRIGGER_PRE_EXCLUDE, HEADER_TRIGGER_POST_INCLUDE, HEADER_TRIGGER_POST_EXCLUDE,
+		HEADER_SESSION_TOKEN, HEADER_CONTINUATION, HEADER_REQUEST_CHARGE, HEADER_ETAG, HEADER_ACTIVITY_ID, HEADER_LSN,
+		HEADER_ITEM_LSN, HEADER_GLOBAL_COMMITTED_LSN, HEADER_QUORUM_ACKED_LSN, HEADER_CURRENT_WRITE_QUORUM,
+		HEADER_CURRENT_REPLICA_SET_SIZE, HEADER_RESOURCE_QUOTA, HEADER_RESOURCE_USAGE, HEADER_REQUEST_DURATION_MS,
+	} {
+		canonicalHeaderKeys[key] = textproto.CanonicalMIMEHeaderKey(key)
+	}
+}
 
-	return h, nil
+func canonicalHeaderKey(key string) string {
+	if canonical, ok := canonicalHeaderKeys[key]; ok {
+		return canonical
+	}
+	return textproto.CanonicalMIMEHeaderKey(key)
+}
+
+// addHeader is http.Header.Add, without canonicalizing the keys of the headers used by the client
+func addHeader(h http.Header, key, value string) {
+	key = canonicalHeaderKey(key)
+	h[key] = append(h[key], value)
+}
+
+// getHeader is http.Header.Get, without canonicalizing the keys of the headers used by the client
+func getHeader(h http.Header, key string) string {
+	if values := h[canonicalHeaderKey(key)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
 }
 
 func backoffDelay(retryCount int) time.Duration {
@@ -84,25 +160,10 @@ func backoffDelay(retryCount int) time.Duration {
 
 // Generate link
 func path(url string, args ...string) (link string) {
+	if len(args) == 1 {
+		return url + "/" + args[0]
+	}
 	args = append([]string{url}, args...)
 	link = strings.Join(args, "/")
 	return
 }
-
-// Read json response to given interface(struct, map, ..)
-func readJson(reader io.Reader, data interface{}) error {
-	return json.NewDecoder(reader).Decode(data)
-}
-
-// Stringify body data
-func stringify(body interface{}) (bt []byte, err error) {
-	switch t := body.(type) {
-	case string:
-		bt = []byte(t)
-	case []byte:
-		bt = t
-	default:
-		bt, err = json.Marshal(t)
-	}
-	return
-}
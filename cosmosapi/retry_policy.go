@@ -0,0 +1,90 @@
+package cosmosapi
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy governs how a Client retries requests that fail with a transient status, such as throttled
+// requests (429 Too Many Requests); see Config.RetryPolicy. Zero values give the defaults.
+//
+// A request is retried after the delay Cosmos suggests in the x-ms-retry-after-ms header, if any, and
+// otherwise with exponential backoff with jitter: before retry number n, the client waits a random time
+// between half of and the whole of BaseDelay * 2^(n-1), but at most MaxDelay. When MaxRetries or MaxWait is
+// exceeded, the request fails with ErrMaxRetriesExceeded.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of retries of a request (default 9)
+	MaxRetries int
+	// MaxWait is the maximum total time to wait between the attempts of a request (default 30 seconds); a
+	// retry that would make the total exceed it is not made
+	MaxWait time.Duration
+	// StatusCodes are the status codes retried (default 429 Too Many Requests and 503 Service Unavailable)
+	StatusCodes []int
+	// BaseDelay is the delay before the first retry when Cosmos suggests none (default 100 milliseconds)
+	BaseDelay time.Duration
+	// MaxDelay is the maximum delay before a retry when Cosmos suggests none (default 5 seconds)
+	MaxDelay time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxRetries <= 0 {
+		p.MaxRetries = 9
+	}
+	if p.MaxWait <= 0 {
+		p.MaxWait = 30 * time.Second
+	}
+	if len(p.StatusCodes) == 0 {
+		p.StatusCodes = []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 100 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	return p
+}
+
+func (p RetryPolicy) retriable(statusCode int) bool {
+	for _, code := range p.withDefaults().StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before retry number retryCount, given the time already waited for the
+// previous retries and the delay suggested by Cosmos (0 if none), or false if the request should not be
+// retried again
+func (p RetryPolicy) delay(retryCount int, waited, retryAfter time.Duration) (time.Duration, bool) {
+	p = p.withDefaults()
+	if retryCount > p.MaxRetries {
+		return 0, false
+	}
+	delay := retryAfter
+	if delay <= 0 {
+		delay = p.MaxDelay
+		if retryCount < 32 && p.BaseDelay<<uint(retryCount-1) < p.MaxDelay {
+			delay = p.BaseDelay << uint(retryCount-1)
+		}
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	if waited+delay > p.MaxWait {
+		return 0, false
+	}
+	return delay, true
+}
+
+// retryAfter returns the delay Cosmos suggests before retrying a request, or 0 if none
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if ms, err := strconv.Atoi(resp.Header.Get(HEADER_RETRY_AFTER_MS)); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxRetries: 3, MaxWait: time.Second, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for retryCount, max := range []time.Duration{100, 200, 300} {
+		delay, retry := p.delay(retryCount+1, 0, 0)
+		require.True(t, retry)
+		assert.True(t, delay >= max*time.Millisecond/2 && delay <= max*time.Millisecond, "retry %d: %s", retryCount+1, delay)
+	}
+	_, retry := p.delay(4, 0, 0)
+	assert.False(t, retry)
+
+	// The delay suggested by Cosmos is used, as long as the total wait stays within MaxWait
+	delay, retry := p.delay(1, 0, 700*time.Millisecond)
+	assert.True(t, retry)
+	assert.Equal(t, 700*time.Millisecond, delay)
+	_, retry = p.delay(2, 700*time.Millisecond, 700*time.Millisecond)
+	assert.False(t, retry)
+
+	assert.True(t, RetryPolicy{}.retriable(http.StatusTooManyRequests))
+	assert.False(t, RetryPolicy{}.retriable(http.StatusRequestTimeout))
+	assert.True(t, RetryPolicy{StatusCodes: []int{http.StatusRequestTimeout}}.retriable(http.StatusRequestTimeout))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var attempts int
+	status := http.StatusTooManyRequests
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Header().Set(HEADER_RETRY_AFTER_MS, "10")
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"id": "a"}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey, RetryPolicy: &RetryPolicy{MaxRetries: 2}}, nil, nil)
+	get := func() (DocumentResponse, error) {
+		attempts = 0
+		var doc map[string]interface{}
+		return c.GetDocument(context.Background(), "db", "coll", "a", GetDocumentOptions{PartitionKeyValue: "a"}, &doc)
+	}
+
+	// Throttled requests are retried after the delay suggested
+	started := time.Now()
+	response, err := get()
+	require.NoError(t, err)
+	assert.Equal(t, 2, response.RetryCount)
+	assert.True(t, time.Since(started) >= 20*time.Millisecond)
+
+	// Other statuses are not retried, unless asked for
+	status = http.StatusRequestTimeout
+	_, err = get()
+	assert.Equal(t, ErrTimeout, errors.Cause(err))
+	assert.Equal(t, 1, attempts)
+	c.Config.RetryPolicy.StatusCodes = []int{http.StatusRequestTimeout}
+	_, err = get()
+	require.NoError(t, err)
+
+	// When the retries are exhausted, the request fails
+	c.Config.RetryPolicy.MaxRetries = 1
+	response, err = get()
+	assert.Equal(t, ErrMaxRetriesExceeded, errors.Cause(err))
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 1, response.RetryCount)
+
+	// Unavailable queries are retried, and report their retries as well
+	c.Config.RetryPolicy = &RetryPolicy{MaxRetries: 2}
+	status = http.StatusServiceUnavailable
+	attempts = 0
+	var docs []map[string]interface{}
+	queryResponse, err := c.QueryDocuments(context.Background(), "db", "coll", Query{Query: "SELECT * FROM c"}, &docs,
+		QueryDocumentsOptions{PartitionKeyValue: "a", IsQuery: true, ContentType: QUERY_CONTENT_TYPE})
+	require.NoError(t, err)
+	assert.Equal(t, 2, queryResponse.RetryCount)
+}
@@ -0,0 +1,115 @@
+package cosmosapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SessionTokenSegment is the part of a session token for one partition key range. Tokens come in two formats:
+// "<range>:<lsn>" (V1), and "<range>:<version>#<global lsn>[#<region>=<lsn>...]" (V2).
+type SessionTokenSegment struct {
+	PartitionKeyRangeId string
+	// Version is incremented on failover; -1 for V1 tokens
+	Version int64
+	// GlobalLSN is the logical sequence number of the last write seen in the range
+	GlobalLSN int64
+	// RegionLSNs has the LSNs per region id, for multi-region write accounts
+	RegionLSNs map[int]int64
+}
+
+// SessionToken is a parsed session token, as returned in the x-ms-session-token header
+type SessionToken []SessionTokenSegment
+
+// ParseSessionToken parses a session token. A token for several partition key ranges has one segment per
+// range, separated by commas.
+func ParseSessionToken(token string) (SessionToken, error) {
+	var result SessionToken
+	if token == "" {
+		return result, nil
+	}
+	for _, part := range strings.Split(token, ",") {
+		segment, err := parseSessionTokenSegment(part)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid session token '%s'", token)
+		}
+		result = append(result, segment)
+	}
+	return result, nil
+}
+
+func parseSessionTokenSegment(s string) (SessionTokenSegment, error) {
+	segment := SessionTokenSegment{Version: -1}
+	colon := strings.Index(s, ":")
+	if colon <= 0 {
+		return segment, errors.Errorf("missing partition key range id in '%s'", s)
+	}
+	segment.PartitionKeyRangeId = s[:colon]
+	parts := strings.Split(s[colon+1:], "#")
+	var err error
+	if len(parts) == 1 {
+		segment.GlobalLSN, err = strconv.ParseInt(parts[0], 10, 64)
+		return segment, errors.WithStack(err)
+	}
+	if segment.Version, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return segment, errors.WithStack(err)
+	}
+	if segment.GlobalLSN, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return segment, errors.WithStack(err)
+	}
+	for _, regionPart := range parts[2:] {
+		kv := strings.SplitN(regionPart, "=", 2)
+		if len(kv) != 2 {
+			return segment, errors.Errorf("invalid region LSN '%s'", regionPart)
+		}
+		region, err := strconv.Atoi(kv[0])
+		if err != nil {
+			return segment, errors.WithStack(err)
+		}
+		lsn, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil {
+			return segment, errors.WithStack(err)
+		}
+		if segment.RegionLSNs == nil {
+			segment.RegionLSNs = make(map[int]int64)
+		}
+		segment.RegionLSNs[region] = lsn
+	}
+	return segment, nil
+}
+
+// Segment returns the segment for the partition key range, if any
+func (t SessionToken) Segment(partitionKeyRangeId string) (SessionTokenSegment, bool) {
+	for _, segment := range t {
+		if segment.PartitionKeyRangeId == partitionKeyRangeId {
+			return segment, true
+		}
+	}
+	return SessionTokenSegment{}, false
+}
+
+// Regressions compares a token returned by the service with the token previously held by the session, and
+// describes each partition key range where the returned token is behind it: a lower global LSN in the same
+// version, or a lower version. This indicates that the request was served by a replica that had not seen
+// the writes of the session (e.g. after a failover, or because the token was not sent), i.e. that
+// read-your-writes may have been violated.
+func (t SessionToken) Regressions(previous SessionToken) []string {
+	var result []string
+	for _, segment := range t {
+		before, ok := previous.Segment(segment.PartitionKeyRangeId)
+		if !ok {
+			continue
+		}
+		switch {
+		case segment.Version < before.Version:
+			result = append(result, fmt.Sprintf("range %s: version %d is lower than the session's %d",
+				segment.PartitionKeyRangeId, segment.Version, before.Version))
+		case segment.Version == before.Version && segment.GlobalLSN < before.GlobalLSN:
+			result = append(result, fmt.Sprintf("range %s: LSN %d is lower than the session's %d",
+				segment.PartitionKeyRangeId, segment.GlobalLSN, before.GlobalLSN))
+		}
+	}
+	return result
+}
@@ -0,0 +1,38 @@
+package cosmosapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSessionToken(t *testing.T) {
+	token, err := ParseSessionToken("0:-1#120#1=110#3=100,4:512")
+	require.NoError(t, err)
+	assert.Equal(t, SessionToken{
+		{PartitionKeyRangeId: "0", Version: -1, GlobalLSN: 120, RegionLSNs: map[int]int64{1: 110, 3: 100}},
+		{PartitionKeyRangeId: "4", Version: -1, GlobalLSN: 512},
+	}, token)
+
+	empty, err := ParseSessionToken("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	for _, invalid := range []string{"120", "0:x", "0:1#", "0:1#2#3"} {
+		_, err := ParseSessionToken(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSessionTokenRegressions(t *testing.T) {
+	previous, _ := ParseSessionToken("0:1#120,1:1#50")
+	current, _ := ParseSessionToken("0:1#119,1:1#51,2:1#1")
+	assert.Equal(t, []string{"range 0: LSN 119 is lower than the session's 120"}, current.Regressions(previous))
+
+	current, _ = ParseSessionToken("0:0#500")
+	assert.Equal(t, []string{"range 0: version 0 is lower than the session's 1"}, current.Regressions(previous))
+
+	current, _ = ParseSessionToken("0:2#1")
+	assert.Empty(t, current.Regressions(previous))
+}
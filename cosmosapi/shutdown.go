@@ -0,0 +1,85 @@
+package cosmosapi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrClientClosed is returned for requests made after Client.Close has been called
+var ErrClientClosed = errors.New("Request attempted through a closed client")
+
+// shutdown tracks the requests in flight, and the background components to stop, for Client.Close
+type shutdown struct {
+	mu       sync.Mutex
+	closed   bool
+	inFlight int
+	drained  chan struct{} // closed when closed is set and inFlight reaches 0
+	closers  []func(ctx context.Context) error
+}
+
+// begin registers a request in flight, or returns ErrClientClosed
+func (s *shutdown) begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClientClosed
+	}
+	s.inFlight++
+	return nil
+}
+
+func (s *shutdown) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if s.closed && s.inFlight == 0 {
+		close(s.drained)
+	}
+}
+
+// OnClose registers a function to stop a background component using the client, such as a change feed
+// processor, when the client is closed. The function should return when the component has stopped, or when
+// ctx is done.
+func (c *Client) OnClose(stop func(ctx context.Context) error) {
+	c.shutdown.mu.Lock()
+	defer c.shutdown.mu.Unlock()
+	c.shutdown.closers = append(c.shutdown.closers, stop)
+}
+
+// Close shuts the client down gracefully, e.g. on termination of a Kubernetes pod: new requests fail with
+// ErrClientClosed, while the background components registered with OnClose are stopped and the requests in
+// flight are waited for, until ctx is done. Finally the idle connections of the http.Client are closed.
+// Close returns ctx.Err() if ctx was done before all requests completed, or else the first error returned by
+// a background component. It is safe to call Close more than once.
+func (c *Client) Close(ctx context.Context) error {
+	s := &c.shutdown
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		s.drained = make(chan struct{})
+		if s.inFlight == 0 {
+			close(s.drained)
+		}
+	}
+	closers := s.closers
+	s.closers = nil
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, stop := range closers {
+		if err := stop(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	select {
+	case <-s.drained:
+	case <-ctx.Done():
+		return errors.WithMessage(ctx.Err(), "Closing client with requests still in flight")
+	}
+	if c.Client != nil {
+		c.Client.CloseIdleConnections()
+	}
+	return firstErr
+}
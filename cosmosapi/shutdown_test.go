@@ -0,0 +1,56 @@
+package cosmosapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClose(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, &http.Client{}, nil)
+	stopped := false
+	c.OnClose(func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, nil)
+		done <- err
+	}()
+	<-started
+
+	// Close gives up when ctx is done before the request completes
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := c.Close(ctx)
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	assert.True(t, stopped)
+
+	// New requests are rejected
+	_, err = c.GetDocument(context.Background(), "db", "coll", "doc", GetDocumentOptions{}, nil)
+	assert.Equal(t, ErrClientClosed, err)
+
+	// Close waits for the request in flight
+	closed := make(chan error)
+	go func() {
+		closed <- c.Close(context.Background())
+	}()
+	close(release)
+	assert.Equal(t, ErrNotFound, <-done)
+	require.NoError(t, <-closed)
+}
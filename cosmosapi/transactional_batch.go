@@ -0,0 +1,165 @@
+package cosmosapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// TransactionalBatch builds a transactional batch of operations on documents in one partition, and executes
+// it with ExecuteBatch:
+//
+//	response, err := client.NewTransactionalBatch(db, coll, BatchOptions{PartitionKeyValue: pk}).
+//		ReadItemInto("a", &docA).
+//		ReplaceItem("b", docB).IfMatch(etagB).
+//		PatchItem("c", PatchIncrement("/count", 1)).
+//		Execute(ctx)
+type TransactionalBatch struct {
+	client     *Client
+	dbName     string
+	colName    string
+	options    BatchOptions
+	operations []BatchOperation
+	// outs has, for each operation, where to decode the document read, if anywhere
+	outs []interface{}
+}
+
+// NewTransactionalBatch returns an empty TransactionalBatch on the partition ops.PartitionKeyValue
+func (c *Client) NewTransactionalBatch(dbName, colName string, ops BatchOptions) *TransactionalBatch {
+	return &TransactionalBatch{client: c, dbName: dbName, colName: colName, options: ops}
+}
+
+func (b *TransactionalBatch) add(op BatchOperation) *TransactionalBatch {
+	b.operations = append(b.operations, op)
+	b.outs = append(b.outs, nil)
+	return b
+}
+
+// CreateItem adds the creation of a document, which fails with ErrConflict if it exists
+func (b *TransactionalBatch) CreateItem(doc interface{}) *TransactionalBatch {
+	return b.add(BatchOperation{OperationType: BatchCreate, ResourceBody: doc})
+}
+
+// UpsertItem adds the creation or replacement of a document
+func (b *TransactionalBatch) UpsertItem(doc interface{}) *TransactionalBatch {
+	return b.add(BatchOperation{OperationType: BatchUpsert, ResourceBody: doc})
+}
+
+// ReplaceItem adds the replacement of a document, which fails with ErrNotFound if it does not exist
+func (b *TransactionalBatch) ReplaceItem(id string, doc interface{}) *TransactionalBatch {
+	return b.add(BatchOperation{OperationType: BatchReplace, Id: id, ResourceBody: doc})
+}
+
+// DeleteItem adds the deletion of a document
+func (b *TransactionalBatch) DeleteItem(id string) *TransactionalBatch {
+	return b.add(BatchOperation{OperationType: BatchDelete, Id: id})
+}
+
+// ReadItem adds a point read of a document; decode it with BatchItemResult.Decode
+func (b *TransactionalBatch) ReadItem(id string) *TransactionalBatch {
+	return b.add(BatchOperation{OperationType: BatchRead, Id: id})
+}
+
+// ReadItemInto adds a point read of a document, which is decoded into out when the batch succeeds. The reads
+// of a batch see the same version of the partition as its writes, so that e.g. a few documents can be read
+// and a few others written atomically in a single round trip. If the document does not exist, the whole batch
+// fails, with ErrNotFound for the read.
+func (b *TransactionalBatch) ReadItemInto(id string, out interface{}) *TransactionalBatch {
+	b.ReadItem(id)
+	b.outs[len(b.outs)-1] = out
+	return b
+}
+
+// PatchItem adds a partial update of a document
+func (b *TransactionalBatch) PatchItem(id string, operations ...PatchOperation) *TransactionalBatch {
+	return b.add(BatchOperation{OperationType: BatchPatch, Id: id, ResourceBody: BatchPatchBody{Operations: operations}})
+}
+
+// IfMatch makes the last operation added conditional on the etag of the document; the batch fails with
+// ErrPreconditionFailed for that operation if the document has been changed
+func (b *TransactionalBatch) IfMatch(etag string) *TransactionalBatch {
+	if len(b.operations) > 0 {
+		b.operations[len(b.operations)-1].IfMatch = etag
+	}
+	return b
+}
+
+// PatchCondition sets the condition (see PatchDocumentOptions.Condition) of the last operation added, which
+// must be added by PatchItem
+func (b *TransactionalBatch) PatchCondition(condition string) *TransactionalBatch {
+	if len(b.operations) > 0 {
+		op := &b.operations[len(b.operations)-1]
+		if body, ok := op.ResourceBody.(BatchPatchBody); ok {
+			body.Condition = condition
+			op.ResourceBody = body
+		}
+	}
+	return b
+}
+
+// Operations returns the operations added so far
+func (b *TransactionalBatch) Operations() []BatchOperation {
+	return b.operations
+}
+
+// BatchItemResult is the result of one operation of a TransactionalBatch
+type BatchItemResult struct {
+	BatchOperationResult
+	OperationType BatchOperationType
+	Id            string
+	// Err is the error corresponding to StatusCode, e.g. ErrNotFound, or nil if the operation succeeded. If
+	// the batch failed, the operations that did not fail themselves have ErrFailedDependency.
+	Err error
+}
+
+// Decode deserializes the document written or read by the operation into out
+func (r BatchItemResult) Decode(out interface{}) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if len(r.ResourceBody) == 0 {
+		return errors.Errorf("Batch operation %s on '%s' returned no document", r.OperationType, r.Id)
+	}
+	return errors.WithStack(json.Unmarshal(r.ResourceBody, out))
+}
+
+type TransactionalBatchResponse struct {
+	DocumentResponse
+	// Results has the result of each operation, in the order they were added
+	Results []BatchItemResult
+}
+
+// Execute executes the batch; see ExecuteBatch. If the batch fails, a BatchError is returned for the failed
+// operation, together with the results of all the operations, each with its own Err. If it succeeds, the
+// documents read by ReadItemInto are decoded.
+func (b *TransactionalBatch) Execute(ctx context.Context) (TransactionalBatchResponse, error) {
+	response, err := b.client.ExecuteBatch(ctx, b.dbName, b.colName, b.operations, b.options)
+	result := TransactionalBatchResponse{DocumentResponse: response.DocumentResponse}
+	for i, r := range response.Results {
+		item := BatchItemResult{BatchOperationResult: r}
+		if i < len(b.operations) {
+			item.OperationType = b.operations[i].OperationType
+			item.Id = b.operations[i].Id
+		}
+		if itemErr, ok := CosmosHTTPErrors[r.StatusCode]; !ok {
+			item.Err = errUnexpectedHTTPStatus
+		} else {
+			item.Err = itemErr
+		}
+		result.Results = append(result.Results, item)
+	}
+	if err != nil {
+		return result, err
+	}
+	for i, out := range b.outs {
+		if out == nil || i >= len(result.Results) {
+			continue
+		}
+		if err := result.Results[i].Decode(out); err != nil {
+			return result, errors.WithMessage(err, fmt.Sprintf("Failed to decode document '%s' read in batch", b.operations[i].Id))
+		}
+	}
+	return result, nil
+}
@@ -21,15 +21,15 @@ type CollectionTriggers struct {
 	Triggers []Trigger `json:"Triggers"`
 }
 
-//const (
-//	TriggerTypePost = TriggerType("Post")
-//	TriggerTypePre  = TriggerType("Pre")
-//
-//	TriggerOpAll     = TriggerType("All")
-//	TriggerOpCreate  = TriggerType("Create")
-//	TriggerOpReplace = TriggerType("Replace")
-//	TriggerOpDelete  = TriggerType("Delete")
-//)
+const (
+	TriggerTypePost = TriggerType("Post")
+	TriggerTypePre  = TriggerType("Pre")
+
+	TriggerOpAll     = TriggerOperation("All")
+	TriggerOpCreate  = TriggerOperation("Create")
+	TriggerOpReplace = TriggerOperation("Replace")
+	TriggerOpDelete  = TriggerOperation("Delete")
+)
 
 // https://docs.microsoft.com/en-us/rest/api/cosmos-db/create-a-trigger
 type TriggerCreateOptions struct {
@@ -76,8 +76,20 @@ func (c *Client) ListTriggers(ctx context.Context, dbName string, colName string
 	return colTrigs, nil
 }
 
-func (c *Client) DeleteTrigger(ctx context.Context, dbName, colName string) error {
-	return ErrorNotImplemented
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/get-a-trigger
+func (c *Client) GetTrigger(ctx context.Context, dbName, colName, triggerName string) (*Trigger, error) {
+	trigger := &Trigger{}
+	_, err := c.get(ctx, CreateTriggerLink(dbName, colName, triggerName), trigger, nil)
+	if err != nil {
+		return nil, err
+	}
+	return trigger, nil
+}
+
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/delete-a-trigger
+func (c *Client) DeleteTrigger(ctx context.Context, dbName, colName, triggerName string) error {
+	_, err := c.delete(ctx, CreateTriggerLink(dbName, colName, triggerName), nil)
+	return err
 }
 
 // https://docs.microsoft.com/en-us/rest/api/cosmos-db/replace-a-trigger
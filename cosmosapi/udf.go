@@ -0,0 +1,63 @@
+package cosmosapi
+
+import (
+	"context"
+)
+
+type UserDefinedFunctions struct {
+	Resource
+	UserDefinedFunctions []UDF `json:"UserDefinedFunctions"`
+	Count                int   `json:"_count,omitempty"`
+}
+
+func newUdf(name, body string) *UDF {
+	return &UDF{
+		Resource{Id: name},
+		body,
+	}
+}
+
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/create-a-user-defined-function
+func (c *Client) CreateUserDefinedFunction(ctx context.Context, dbName, colName, udfName, body string) (*UDF, error) {
+	ret := &UDF{}
+	_, err := c.create(ctx, createUdfsLink(dbName, colName), newUdf(udfName, body), ret, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/replace-a-user-defined-function
+func (c *Client) ReplaceUserDefinedFunction(ctx context.Context, dbName, colName, udfName, body string) (*UDF, error) {
+	ret := &UDF{}
+	_, err := c.replace(ctx, createUdfLink(dbName, colName, udfName), newUdf(udfName, body), ret, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/delete-a-user-defined-function
+func (c *Client) DeleteUserDefinedFunction(ctx context.Context, dbName, colName, udfName string) error {
+	_, err := c.delete(ctx, createUdfLink(dbName, colName, udfName), nil)
+	return err
+}
+
+func (c *Client) GetUserDefinedFunction(ctx context.Context, dbName, colName, udfName string) (*UDF, error) {
+	ret := &UDF{}
+	_, err := c.get(ctx, createUdfLink(dbName, colName, udfName), ret, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// https://docs.microsoft.com/en-us/rest/api/cosmos-db/list-user-defined-functions
+func (c *Client) ListUserDefinedFunctions(ctx context.Context, dbName, colName string) (*UserDefinedFunctions, error) {
+	ret := &UserDefinedFunctions{}
+	_, err := c.get(ctx, createUdfsLink(dbName, colName), ret, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,78 @@
+package cosmosapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserDefinedFunctions(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body)))
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodGet && r.URL.Path == "/dbs/db/colls/coll/udfs":
+			w.Write([]byte(`{"_rid": "rid", "UserDefinedFunctions": [{"id": "tax", "body": "function tax(x) { return x * 0.25 }"}], "_count": 1}`))
+		default:
+			w.Write([]byte(`{"id": "tax", "body": "function tax(x) { return x * 0.25 }", "_etag": "etag-1"}`))
+		}
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+	ctx := context.Background()
+	body := "function tax(x) { return x * 0.25 }"
+
+	udf, err := c.CreateUserDefinedFunction(ctx, "db", "coll", "tax", body)
+	require.NoError(t, err)
+	assert.Equal(t, "tax", udf.Id)
+	assert.Equal(t, "etag-1", udf.Etag)
+	_, err = c.ReplaceUserDefinedFunction(ctx, "db", "coll", "tax", body)
+	require.NoError(t, err)
+	udf, err = c.GetUserDefinedFunction(ctx, "db", "coll", "tax")
+	require.NoError(t, err)
+	assert.Equal(t, body, udf.Body)
+	udfs, err := c.ListUserDefinedFunctions(ctx, "db", "coll")
+	require.NoError(t, err)
+	assert.Equal(t, 1, udfs.Count)
+	assert.Equal(t, "tax", udfs.UserDefinedFunctions[0].Id)
+	require.NoError(t, c.DeleteUserDefinedFunction(ctx, "db", "coll", "tax"))
+
+	assert.Equal(t, []string{
+		`POST /dbs/db/colls/coll/udfs {"id":"tax","body":"function tax(x) { return x * 0.25 }"}`,
+		`PUT /dbs/db/colls/coll/udfs/tax {"id":"tax","body":"function tax(x) { return x * 0.25 }"}`,
+		`GET /dbs/db/colls/coll/udfs/tax `,
+		`GET /dbs/db/colls/coll/udfs `,
+		`DELETE /dbs/db/colls/coll/udfs/tax `,
+	}, requests)
+}
+
+func TestTriggers(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"id": "stamp", "body": "function stamp() {}", "triggerOperation": "Create", "triggerType": "Pre"}`))
+	}))
+	defer ts.Close()
+	c := New(ts.URL, Config{MasterKey: TestKey}, nil, nil)
+
+	trigger, err := c.GetTrigger(context.Background(), "db", "coll", "stamp")
+	require.NoError(t, err)
+	assert.Equal(t, "stamp", trigger.Id)
+	assert.Equal(t, TriggerOpCreate, trigger.Operation)
+	assert.Equal(t, TriggerTypePre, trigger.Type)
+	require.NoError(t, c.DeleteTrigger(context.Background(), "db", "coll", "stamp"))
+	assert.Equal(t, []string{"GET /dbs/db/colls/coll/triggers/stamp", "DELETE /dbs/db/colls/coll/triggers/stamp"}, requests)
+}
@@ -2,15 +2,39 @@ package cosmosapi
 
 import (
 	"encoding/json"
+	"math"
 )
 
+// isPlainJSONString returns true if s is encoded in JSON as is, between quotes
+func isPlainJSONString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c < 0x20 || c >= 0x7f, c == '"', c == '\\', c == '<', c == '>', c == '&':
+			return false
+		}
+	}
+	return true
+}
+
 func MarshalPartitionKeyHeader(partitionKeyValue interface{}) (string, error) {
-	switch partitionKeyValue.(type) {
-	// for now we disallow float, as using floats as keys is conceptually flawed (floats are not exact values)
-	case nil, string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+	switch v := partitionKeyValue.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, json.Number:
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return "", ErrInvalidPartitionKeyType
+		}
+	case float64:
+		// Cosmos represents all numbers as float64, so these are the values read back from documents
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", ErrInvalidPartitionKeyType
+		}
 	default:
 		return "", ErrInvalidPartitionKeyType
 	}
+	if s, ok := partitionKeyValue.(string); ok && isPlainJSONString(s) {
+		// The common case, without the allocations of json.Marshal
+		return `["` + s + `"]`, nil
+	}
 	res, err := json.Marshal([]interface{}{partitionKeyValue})
 	if err != nil {
 		return "", err
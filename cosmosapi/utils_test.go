@@ -2,6 +2,7 @@ package cosmosapi
 
 import (
 	"github.com/stretchr/testify/require"
+	"math"
 	"testing"
 )
 
@@ -22,6 +23,9 @@ func TestMarshalPartitionKeyHeader(t *testing.T) {
 	checkMarshal(int32(1), `[1]`)
 	checkMarshal(17179869184, `[17179869184]`) // in > 2^32
 
-	checkMarshal(1234.0, ErrInvalidPartitionKeyType)
+	checkMarshal(true, `[true]`)
+	checkMarshal(1234.0, `[1234]`)
+	checkMarshal(12.5, `[12.5]`)
+	checkMarshal(math.NaN(), ErrInvalidPartitionKeyType)
 	checkMarshal(struct{}{}, ErrInvalidPartitionKeyType)
 }
@@ -0,0 +1,286 @@
+// Package cosmosarm reads Cosmos DB account metadata that is only available through Azure Resource Manager
+// (the management plane), such as the backup policy and point-in-time restore information. Unlike
+// cosmosapi, it authenticates with an Azure AD token rather than the account master key.
+package cosmosarm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultManagementEndpoint = "https://management.azure.com"
+	apiVersion                = "2023-04-15"
+)
+
+// TokenSource returns an Azure AD access token for the management endpoint
+// (scope https://management.azure.com/.default), e.g. obtained through the Azure SDK
+type TokenSource func(ctx context.Context) (string, error)
+
+// Client reads management plane metadata of one Cosmos DB account
+type Client struct {
+	SubscriptionId string
+	ResourceGroup  string
+	AccountName    string
+	Token          TokenSource
+	// Endpoint defaults to DefaultManagementEndpoint
+	Endpoint string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type BackupPolicyType string
+
+const (
+	BackupPolicyPeriodic   = BackupPolicyType("Periodic")
+	BackupPolicyContinuous = BackupPolicyType("Continuous")
+)
+
+// BackupPolicy is the backup configuration of an account
+type BackupPolicy struct {
+	Type BackupPolicyType
+	// ContinuousTier is "Continuous7Days" or "Continuous30Days" for continuous backup
+	ContinuousTier string
+	// The settings of periodic backup
+	BackupIntervalInMinutes        int
+	BackupRetentionIntervalInHours int
+	BackupStorageRedundancy        string
+}
+
+// RestorableAccount is an account (existing or deleted) that can be restored to a point in time
+type RestorableAccount struct {
+	// InstanceId identifies the account instance in the other restore APIs
+	InstanceId           string
+	AccountName          string
+	CreationTime         time.Time
+	DeletionTime         time.Time
+	OldestRestorableTime time.Time
+}
+
+// RestorableResourceEvent is an event in the history of a database or container that can be restored;
+// OperationType is "Create", "Delete", "Replace" or "SystemOperation"
+type RestorableResourceEvent struct {
+	OperationType string
+	EventTime     time.Time
+	// Id and Rid of the database or container
+	Id  string
+	Rid string
+}
+
+// BackupPolicy returns the backup policy of the account
+func (c Client) BackupPolicy(ctx context.Context) (BackupPolicy, error) {
+	var account struct {
+		Properties struct {
+			BackupPolicy struct {
+				Type                     BackupPolicyType `json:"type"`
+				ContinuousModeProperties struct {
+					Tier string `json:"tier"`
+				} `json:"continuousModeProperties"`
+				PeriodicModeProperties struct {
+					BackupIntervalInMinutes        int    `json:"backupIntervalInMinutes"`
+					BackupRetentionIntervalInHours int    `json:"backupRetentionIntervalInHours"`
+					BackupStorageRedundancy        string `json:"backupStorageRedundancy"`
+				} `json:"periodicModeProperties"`
+			} `json:"backupPolicy"`
+		} `json:"properties"`
+	}
+	if err := c.get(ctx, c.accountPath(), &account); err != nil {
+		return BackupPolicy{}, err
+	}
+	p := account.Properties.BackupPolicy
+	return BackupPolicy{
+		Type:                           p.Type,
+		ContinuousTier:                 p.ContinuousModeProperties.Tier,
+		BackupIntervalInMinutes:        p.PeriodicModeProperties.BackupIntervalInMinutes,
+		BackupRetentionIntervalInHours: p.PeriodicModeProperties.BackupRetentionIntervalInHours,
+		BackupStorageRedundancy:        p.PeriodicModeProperties.BackupStorageRedundancy,
+	}, nil
+}
+
+// VerifyContinuousBackup returns an error unless the account has continuous backup, with the given tier if
+// tier is not empty
+func (c Client) VerifyContinuousBackup(ctx context.Context, tier string) error {
+	policy, err := c.BackupPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if policy.Type != BackupPolicyContinuous {
+		return errors.Errorf("Account %s has backup policy %s, expected %s", c.AccountName, policy.Type, BackupPolicyContinuous)
+	}
+	if tier != "" && policy.ContinuousTier != tier {
+		return errors.Errorf("Account %s has continuous backup tier %s, expected %s", c.AccountName, policy.ContinuousTier, tier)
+	}
+	return nil
+}
+
+// RestorableAccounts lists the instances of the account (by name) that can be restored from the given
+// location, e.g. "West Europe"; there may be several if the account has been deleted and re-created
+func (c Client) RestorableAccounts(ctx context.Context, location string) ([]RestorableAccount, error) {
+	var list struct {
+		Value []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				AccountName          string    `json:"accountName"`
+				CreationTime         time.Time `json:"creationTime"`
+				DeletionTime         time.Time `json:"deletionTime"`
+				OldestRestorableTime time.Time `json:"oldestRestorableTime"`
+			} `json:"properties"`
+		} `json:"value"`
+		NextLink string `json:"nextLink"`
+	}
+	var result []RestorableAccount
+	path := c.locationPath(location) + "/restorableDatabaseAccounts"
+	for link := c.url(path); link != ""; link = list.NextLink {
+		list.Value, list.NextLink = nil, ""
+		if err := c.getURL(ctx, link, &list); err != nil {
+			return nil, err
+		}
+		for _, v := range list.Value {
+			if !strings.EqualFold(v.Properties.AccountName, c.AccountName) {
+				continue
+			}
+			result = append(result, RestorableAccount{
+				InstanceId:           v.Name,
+				AccountName:          v.Properties.AccountName,
+				CreationTime:         v.Properties.CreationTime,
+				DeletionTime:         v.Properties.DeletionTime,
+				OldestRestorableTime: v.Properties.OldestRestorableTime,
+			})
+		}
+	}
+	return result, nil
+}
+
+// RestorableDatabases lists the events of the SQL databases of a restorable account instance
+func (c Client) RestorableDatabases(ctx context.Context, location, instanceId string) ([]RestorableResourceEvent, error) {
+	path := c.locationPath(location) + "/restorableDatabaseAccounts/" + url.PathEscape(instanceId) + "/restorableSqlDatabases"
+	return c.restorableEvents(ctx, path, "", "database")
+}
+
+// RestorableContainers lists the events of the containers of a database (given by its _rid) of a restorable
+// account instance
+func (c Client) RestorableContainers(ctx context.Context, location, instanceId, databaseRid string) ([]RestorableResourceEvent, error) {
+	path := c.locationPath(location) + "/restorableDatabaseAccounts/" + url.PathEscape(instanceId) + "/restorableSqlContainers"
+	return c.restorableEvents(ctx, path, "restorableSqlDatabaseRid="+url.QueryEscape(databaseRid), "container")
+}
+
+type restorableResource struct {
+	Id  string `json:"id"`
+	Rid string `json:"_rid"`
+}
+
+func (c Client) restorableEvents(ctx context.Context, path, query, resourceProperty string) ([]RestorableResourceEvent, error) {
+	var list struct {
+		Value []struct {
+			Properties struct {
+				Resource struct {
+					OperationType string             `json:"operationType"`
+					EventTime     time.Time          `json:"eventTimestamp"`
+					Database      restorableResource `json:"database"`
+					Container     restorableResource `json:"container"`
+				} `json:"resource"`
+			} `json:"properties"`
+		} `json:"value"`
+		NextLink string `json:"nextLink"`
+	}
+	if query != "" {
+		path += "?" + query
+	}
+	var result []RestorableResourceEvent
+	for link := c.url(path); link != ""; link = list.NextLink {
+		list.Value, list.NextLink = nil, ""
+		if err := c.getURL(ctx, link, &list); err != nil {
+			return nil, err
+		}
+		for _, v := range list.Value {
+			r := v.Properties.Resource
+			resource := r.Database
+			if resourceProperty == "container" {
+				resource = r.Container
+			}
+			result = append(result, RestorableResourceEvent{
+				OperationType: r.OperationType,
+				EventTime:     r.EventTime,
+				Id:            resource.Id,
+				Rid:           resource.Rid,
+			})
+		}
+	}
+	return result, nil
+}
+
+func (c Client) accountPath() string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.DocumentDB/databaseAccounts/%s",
+		url.PathEscape(c.SubscriptionId), url.PathEscape(c.ResourceGroup), url.PathEscape(c.AccountName))
+}
+
+func (c Client) locationPath(location string) string {
+	return fmt.Sprintf("/subscriptions/%s/providers/Microsoft.DocumentDB/locations/%s",
+		url.PathEscape(c.SubscriptionId), url.PathEscape(location))
+}
+
+func (c Client) endpoint() string {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultManagementEndpoint
+	}
+	return strings.TrimRight(endpoint, "/")
+}
+
+// url returns the URL of the resource at path, with the API version
+func (c Client) url(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return c.endpoint() + path + separator + "api-version=" + apiVersion
+}
+
+func (c Client) get(ctx context.Context, path string, out interface{}) error {
+	return c.getURL(ctx, c.url(path), out)
+}
+
+// getURL gets a URL on the endpoint, e.g. the nextLink of a page of a list, which has the API version already
+func (c Client) getURL(ctx context.Context, u string, out interface{}) error {
+	if !strings.HasPrefix(u, c.endpoint()+"/") {
+		// Do not send the token elsewhere
+		return errors.Errorf("URL %s is not on the endpoint %s", u, c.endpoint())
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if c.Token == nil {
+		return errors.New("cosmosarm.Client.Token is required")
+	}
+	token, err := c.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("GET %s: %s: %s", req.URL.Path, resp.Status, string(body))
+	}
+	return errors.WithStack(json.Unmarshal(body, out))
+}
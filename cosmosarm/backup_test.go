@@ -0,0 +1,117 @@
+package cosmosarm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testClient returns a client of a server responding with responses, by path; a page after the first is
+// found by the path with "?$skiptoken=<token>", and {{server}} in a response is replaced by the server URL
+func testClient(t *testing.T, responses map[string]string) Client {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Unexpected Authorization header: %s", r.Header.Get("Authorization"))
+		}
+		if r.URL.Query().Get("api-version") != apiVersion {
+			t.Errorf("Unexpected api-version: %s", r.URL.Query().Get("api-version"))
+		}
+		key := r.URL.Path
+		if token := r.URL.Query().Get("$skiptoken"); token != "" {
+			key += "?$skiptoken=" + token
+		}
+		body, ok := responses[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(strings.Replace(body, "{{server}}", server.URL, -1)))
+	}))
+	t.Cleanup(server.Close)
+	return Client{
+		SubscriptionId: "sub",
+		ResourceGroup:  "rg",
+		AccountName:    "myaccount",
+		Endpoint:       server.URL,
+		Token: func(ctx context.Context) (string, error) {
+			return "token", nil
+		},
+	}
+}
+
+func TestBackupPolicy(t *testing.T) {
+	c := testClient(t, map[string]string{
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.DocumentDB/databaseAccounts/myaccount": `{
+			"properties": {"backupPolicy": {"type": "Continuous", "continuousModeProperties": {"tier": "Continuous7Days"}}}
+		}`,
+	})
+	policy, err := c.BackupPolicy(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, BackupPolicy{Type: BackupPolicyContinuous, ContinuousTier: "Continuous7Days"}, policy)
+	require.NoError(t, c.VerifyContinuousBackup(context.Background(), ""))
+	require.Error(t, c.VerifyContinuousBackup(context.Background(), "Continuous30Days"))
+
+	c.AccountName = "other"
+	_, err = c.BackupPolicy(context.Background())
+	require.Error(t, err)
+}
+
+func TestRestorableResources(t *testing.T) {
+	locations := "/subscriptions/sub/providers/Microsoft.DocumentDB/locations/West Europe/restorableDatabaseAccounts"
+	c := testClient(t, map[string]string{
+		locations: `{"value": [
+			{"name": "instance-1", "properties": {"accountName": "myaccount", "creationTime": "2023-01-01T00:00:00Z", "oldestRestorableTime": "2023-06-01T00:00:00Z"}},
+			{"name": "instance-2", "properties": {"accountName": "otheraccount"}}
+		]}`,
+		locations + "/instance-1/restorableSqlDatabases": `{"value": [
+			{"properties": {"resource": {"operationType": "Create", "eventTimestamp": "2023-01-02T00:00:00Z", "database": {"id": "mydb", "_rid": "AAAA"}}}}
+		]}`,
+		locations + "/instance-1/restorableSqlContainers": `{"value": [
+			{"properties": {"resource": {"operationType": "Delete", "eventTimestamp": "2023-01-03T00:00:00Z", "container": {"id": "mycoll", "_rid": "AAAABB"}}}}
+		]}`,
+	})
+	ctx := context.Background()
+	accounts, err := c.RestorableAccounts(ctx, "West Europe")
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	require.Equal(t, "instance-1", accounts[0].InstanceId)
+	require.Equal(t, 2023, accounts[0].OldestRestorableTime.Year())
+
+	databases, err := c.RestorableDatabases(ctx, "West Europe", "instance-1")
+	require.NoError(t, err)
+	require.Len(t, databases, 1)
+	require.Equal(t, "Create", databases[0].OperationType)
+	require.Equal(t, "mydb", databases[0].Id)
+	require.Equal(t, "AAAA", databases[0].Rid)
+
+	containers, err := c.RestorableContainers(ctx, "West Europe", "instance-1", "AAAA")
+	require.NoError(t, err)
+	require.Len(t, containers, 1)
+	require.Equal(t, "Delete", containers[0].OperationType)
+	require.Equal(t, "mycoll", containers[0].Id)
+}
+
+func TestRestorableAccountsPages(t *testing.T) {
+	locations := "/subscriptions/sub/providers/Microsoft.DocumentDB/locations/West Europe/restorableDatabaseAccounts"
+	c := testClient(t, map[string]string{
+		locations: `{"value": [{"name": "instance-1", "properties": {"accountName": "myaccount"}}],
+			"nextLink": "{{server}}/subscriptions/sub/providers/Microsoft.DocumentDB/locations/West%20Europe/restorableDatabaseAccounts?api-version=` + apiVersion + `&$skiptoken=2"}`,
+		locations + "?$skiptoken=2": `{"value": [{"name": "instance-2", "properties": {"accountName": "myaccount"}}]}`,
+	})
+	accounts, err := c.RestorableAccounts(context.Background(), "West Europe")
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	require.Equal(t, "instance-2", accounts[1].InstanceId)
+
+	// The token is not sent to links elsewhere
+	c = testClient(t, map[string]string{
+		locations: `{"value": [], "nextLink": "https://example.com/next"}`,
+	})
+	_, err = c.RestorableAccounts(context.Background(), "West Europe")
+	require.Error(t, err)
+}
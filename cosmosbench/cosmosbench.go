@@ -0,0 +1,273 @@
+// The cosmosbench package drives a configurable mix of point reads, writes and queries against a collection
+// and reports latency percentiles, request charge and throttling rates. It is used by cmd/cosmosbench, but
+// can also be used directly from Go code for capacity tests.
+//
+// The documents written by the benchmark have the form
+//
+//	{"id": "bench-<n>", "<PartitionKey>": "bench-<n % PartitionKeys>", "payload": "xxx..."}
+//
+// so it is recommended to run it against a dedicated collection.
+package cosmosbench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type Operation string
+
+const (
+	OperationRead  = Operation("read")
+	OperationWrite = Operation("write")
+	OperationQuery = Operation("query")
+)
+
+// Client is the subset of the cosmosapi.Client API used by the benchmark
+type Client interface {
+	GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error)
+	CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error)
+	QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error)
+}
+
+type Config struct {
+	DbName       string
+	Collection   string
+	PartitionKey string
+
+	// How long to run the benchmark, and how many concurrent workers to use
+	Duration    time.Duration
+	Concurrency int
+
+	// Relative weights of the operations in the mix. E.g. Mix{OperationRead: 8, OperationWrite: 2}
+	// gives 80% reads and 20% writes.
+	Mix map[Operation]int
+
+	// The number of distinct documents and partition key values operations are spread over
+	Documents     int
+	PartitionKeys int
+	// Size in bytes of the payload of written documents
+	DocumentSize int
+	// The query to run for OperationQuery. It is run within a single partition; the parameter @pk
+	// is set to a random partition key value.
+	Query string
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Duration == 0 {
+		cfg.Duration = 10 * time.Second
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 1
+	}
+	if len(cfg.Mix) == 0 {
+		cfg.Mix = map[Operation]int{OperationRead: 1}
+	}
+	if cfg.Documents == 0 {
+		cfg.Documents = 1000
+	}
+	if cfg.PartitionKeys == 0 {
+		cfg.PartitionKeys = cfg.Documents
+	}
+	if cfg.DocumentSize == 0 {
+		cfg.DocumentSize = 100
+	}
+	if cfg.Query == "" {
+		cfg.Query = "SELECT * FROM c WHERE c." + cfg.PartitionKey + " = @pk"
+	}
+}
+
+// ParseMix parses a mix specification on the form "read=80,write=15,query=5"
+func ParseMix(s string) (map[Operation]int, error) {
+	mix := make(map[Operation]int)
+	for _, part := range strings.Split(s, ",") {
+		var weight int
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("Invalid mix element '%s', expected <operation>=<weight>", part)
+		}
+		if _, err := fmt.Sscanf(kv[1], "%d", &weight); err != nil || weight < 0 {
+			return nil, errors.Errorf("Invalid weight in mix element '%s'", part)
+		}
+		op := Operation(kv[0])
+		switch op {
+		case OperationRead, OperationWrite, OperationQuery:
+		default:
+			return nil, errors.Errorf("Unknown operation '%s' in mix", kv[0])
+		}
+		mix[op] = weight
+	}
+	return mix, nil
+}
+
+// OperationStats contains the measurements for a single kind of operation
+type OperationStats struct {
+	Count         int
+	Errors        int
+	Throttled     int
+	RequestCharge float64
+	latencies     []time.Duration
+}
+
+// Percentile returns the latency at the given percentile (0-100) of successful operations
+func (s *OperationStats) Percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	idx := int(float64(len(s.latencies)-1) * p / 100)
+	return s.latencies[idx]
+}
+
+// ThrottleRate returns the fraction of operations that were throttled (HTTP 429)
+func (s *OperationStats) ThrottleRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Throttled) / float64(s.Count)
+}
+
+type Report struct {
+	Duration   time.Duration
+	Operations map[Operation]*OperationStats
+}
+
+// Print writes a human readable version of the report
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Duration: %s\n", r.Duration)
+	ops := make([]string, 0, len(r.Operations))
+	for op := range r.Operations {
+		ops = append(ops, string(op))
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		s := r.Operations[Operation(op)]
+		fmt.Fprintf(w, "%-6s count=%d rate=%.1f/s errors=%d throttled=%.2f%% RU=%.2f (%.2f/op) p50=%s p90=%s p99=%s max=%s\n",
+			op, s.Count, float64(s.Count)/r.Duration.Seconds(), s.Errors, 100*s.ThrottleRate(),
+			s.RequestCharge, s.RequestCharge/float64(maxInt(s.Count, 1)),
+			s.Percentile(50), s.Percentile(90), s.Percentile(99), s.Percentile(100))
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+type result struct {
+	op            Operation
+	latency       time.Duration
+	requestCharge float64
+	err           error
+}
+
+// Run runs the benchmark until cfg.Duration has passed or ctx is cancelled
+func Run(ctx context.Context, client Client, cfg Config) (Report, error) {
+	cfg.setDefaults()
+	if cfg.PartitionKey == "" {
+		return Report{}, errors.New("PartitionKey is required")
+	}
+	var ops []Operation
+	for op, weight := range cfg.Mix {
+		for i := 0; i != weight; i++ {
+			ops = append(ops, op)
+		}
+	}
+	if len(ops) == 0 {
+		return Report{}, errors.New("Mix must have at least one operation with a positive weight")
+	}
+	payload := strings.Repeat("x", cfg.DocumentSize)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	results := make(chan result, cfg.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i != cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for ctx.Err() == nil {
+				op := ops[rnd.Intn(len(ops))]
+				n := rnd.Intn(cfg.Documents)
+				results <- runOperation(ctx, client, cfg, op, n, payload)
+			}
+		}(start.UnixNano() + int64(i))
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	report := Report{Operations: make(map[Operation]*OperationStats)}
+	for r := range results {
+		if ctx.Err() != nil && errors.Cause(r.err) == context.DeadlineExceeded {
+			// Operation interrupted by the end of the benchmark
+			continue
+		}
+		s, ok := report.Operations[r.op]
+		if !ok {
+			s = &OperationStats{}
+			report.Operations[r.op] = s
+		}
+		s.Count++
+		s.RequestCharge += r.requestCharge
+		switch errors.Cause(r.err) {
+		case nil:
+			s.latencies = append(s.latencies, r.latency)
+		case cosmosapi.ErrTooManyRequests, cosmosapi.ErrMaxRetriesExceeded:
+			s.Throttled++
+		default:
+			s.Errors++
+		}
+	}
+	report.Duration = time.Since(start)
+	for _, s := range report.Operations {
+		sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	}
+	return report, nil
+}
+
+func runOperation(ctx context.Context, client Client, cfg Config, op Operation, n int, payload string) (r result) {
+	id := fmt.Sprintf("bench-%d", n)
+	pk := fmt.Sprintf("bench-%d", n%cfg.PartitionKeys)
+	r.op = op
+	t0 := time.Now()
+	switch op {
+	case OperationRead:
+		var doc map[string]interface{}
+		var resp cosmosapi.DocumentResponse
+		resp, r.err = client.GetDocument(ctx, cfg.DbName, cfg.Collection, id, cosmosapi.GetDocumentOptions{PartitionKeyValue: pk}, &doc)
+		if errors.Cause(r.err) == cosmosapi.ErrNotFound {
+			// The document has not been written yet; still a valid measurement
+			r.err = nil
+		}
+		r.requestCharge = resp.RUs
+	case OperationWrite:
+		doc := map[string]interface{}{"id": id, cfg.PartitionKey: pk, "payload": payload}
+		var resp cosmosapi.DocumentResponse
+		_, resp, r.err = client.CreateDocument(ctx, cfg.DbName, cfg.Collection, doc, cosmosapi.CreateDocumentOptions{PartitionKeyValue: pk, IsUpsert: true})
+		r.requestCharge = resp.RUs
+	case OperationQuery:
+		var docs []map[string]interface{}
+		ops := cosmosapi.DefaultQueryDocumentOptions()
+		ops.PartitionKeyValue = pk
+		qry := cosmosapi.Query{Query: cfg.Query, Params: []cosmosapi.QueryParam{{Name: "@pk", Value: pk}}}
+		var resp cosmosapi.QueryDocumentsResponse
+		resp, r.err = client.QueryDocuments(ctx, cfg.DbName, cfg.Collection, qry, &docs, ops)
+		r.requestCharge = resp.RequestCharge
+	}
+	r.latency = time.Since(t0)
+	return
+}
@@ -0,0 +1,63 @@
+package cosmosbench
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type mockClient struct {
+	writes int32
+}
+
+func (m *mockClient) GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	return cosmosapi.DocumentResponse{RUs: 1}, nil
+}
+
+func (m *mockClient) CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	if atomic.AddInt32(&m.writes, 1)%2 == 0 {
+		return nil, cosmosapi.DocumentResponse{}, cosmosapi.ErrTooManyRequests
+	}
+	return &cosmosapi.Resource{}, cosmosapi.DocumentResponse{RUs: 5}, nil
+}
+
+func (m *mockClient) QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	return cosmosapi.QueryDocumentsResponse{}, nil
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("read=80, write=15,query=5")
+	require.NoError(t, err)
+	require.Equal(t, map[Operation]int{OperationRead: 80, OperationWrite: 15, OperationQuery: 5}, mix)
+
+	_, err = ParseMix("read")
+	require.Error(t, err)
+	_, err = ParseMix("delete=1")
+	require.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	report, err := Run(context.Background(), &mockClient{}, Config{
+		PartitionKey: "pk",
+		Duration:     50 * time.Millisecond,
+		Concurrency:  4,
+		Mix:          map[Operation]int{OperationRead: 1, OperationWrite: 1},
+	})
+	require.NoError(t, err)
+	reads, writes := report.Operations[OperationRead], report.Operations[OperationWrite]
+	require.NotNil(t, reads)
+	require.NotNil(t, writes)
+	require.Equal(t, float64(reads.Count), reads.RequestCharge)
+	require.Equal(t, 0, reads.Throttled)
+	require.True(t, writes.Throttled > 0)
+	require.True(t, reads.Percentile(50) <= reads.Percentile(99))
+
+	var buf bytes.Buffer
+	report.Print(&buf)
+	require.Contains(t, buf.String(), "read ")
+}
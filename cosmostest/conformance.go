@@ -0,0 +1,182 @@
+package cosmostest
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// RunConformanceTests tests that a cosmos.Client behaves like Cosmos in the ways this module and its
+// users rely on: not-found and conflict errors, conditional writes with etags, upserts, patches, session
+// tokens and queries. Run it against the real API or the emulator (e.g. on a collection from
+// SetupCollection) and against fakes such as FakeClient, to keep them aligned:
+//
+//	func TestFakeConformance(t *testing.T) {
+//		cosmostest.RunConformanceTests(t, cosmos.Collection{Client: cosmostest.NewFakeClient(), DbName: "db", Name: "coll", PartitionKey: "pk"})
+//	}
+//
+// Documents are written with the partition key c.PartitionKey and unique ids, so that a shared collection
+// can be used.
+func RunConformanceTests(t *testing.T, c cosmos.Collection) {
+	ctx := c.GetContext()
+	run := uuid.Must(uuid.NewV4()).String()
+	newDoc := func(id string, fields map[string]interface{}) map[string]interface{} {
+		doc := map[string]interface{}{"id": run + "-" + id, c.PartitionKey: run}
+		for k, v := range fields {
+			doc[k] = v
+		}
+		return doc
+	}
+	get := func(id string, ops cosmosapi.GetDocumentOptions) (map[string]interface{}, cosmosapi.DocumentResponse, error) {
+		ops.PartitionKeyValue = run
+		var doc map[string]interface{}
+		response, err := c.Client.GetDocument(ctx, c.DbName, c.Name, run+"-"+id, ops, &doc)
+		return doc, response, err
+	}
+	create := func(doc map[string]interface{}) (*cosmosapi.Resource, error) {
+		resource, _, err := c.Client.CreateDocument(ctx, c.DbName, c.Name, doc, cosmosapi.CreateDocumentOptions{PartitionKeyValue: run})
+		return resource, err
+	}
+
+	t.Run("GetMissing", func(t *testing.T) {
+		_, _, err := get("missing", cosmosapi.GetDocumentOptions{})
+		assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+	})
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		resource, err := create(newDoc("create", map[string]interface{}{"x": 1}))
+		require.NoError(t, err)
+		assert.NotEmpty(t, resource.Etag)
+		doc, response, err := get("create", cosmosapi.GetDocumentOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, resource.Etag, doc["_etag"])
+		assert.Equal(t, resource.Etag, response.Etag)
+		assert.Equal(t, float64(1), doc["x"])
+		assert.NotZero(t, doc["_ts"])
+
+		_, err = create(newDoc("create", nil))
+		assert.Equal(t, cosmosapi.ErrConflict, errors.Cause(err))
+
+		// Documents with the same id in different partitions are different documents
+		other := newDoc("create", nil)
+		other[c.PartitionKey] = run + "-other"
+		_, _, err = c.Client.CreateDocument(ctx, c.DbName, c.Name, other, cosmosapi.CreateDocumentOptions{PartitionKeyValue: run + "-other"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("IfNoneMatch", func(t *testing.T) {
+		resource, err := create(newDoc("ifnonematch", nil))
+		require.NoError(t, err)
+		_, response, err := get("ifnonematch", cosmosapi.GetDocumentOptions{IfNoneMatch: resource.Etag})
+		require.NoError(t, err)
+		assert.True(t, response.NotModified)
+		_, response, err = get("ifnonematch", cosmosapi.GetDocumentOptions{IfNoneMatch: `"stale"`})
+		require.NoError(t, err)
+		assert.False(t, response.NotModified)
+	})
+
+	t.Run("ReplaceIfMatch", func(t *testing.T) {
+		created, err := create(newDoc("replace", map[string]interface{}{"x": 1}))
+		require.NoError(t, err)
+		replace := func(id, etag string) (*cosmosapi.Resource, error) {
+			resource, _, err := c.Client.ReplaceDocument(ctx, c.DbName, c.Name, run+"-"+id, newDoc(id, map[string]interface{}{"x": 2}),
+				cosmosapi.ReplaceDocumentOptions{PartitionKeyValue: run, IfMatch: etag})
+			return resource, err
+		}
+		replaced, err := replace("replace", created.Etag)
+		require.NoError(t, err)
+		assert.NotEqual(t, created.Etag, replaced.Etag)
+		_, err = replace("replace", created.Etag)
+		assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+		_, err = replace("replace-missing", "")
+		assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+		doc, _, err := get("replace", cosmosapi.GetDocumentOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, float64(2), doc["x"])
+	})
+
+	t.Run("Upsert", func(t *testing.T) {
+		upserter, ok := c.Client.(cosmos.DocumentUpserter)
+		if !ok {
+			t.Skip("The client does not implement UpsertDocument")
+		}
+		upsert := func(x int, etag string) (*cosmosapi.Resource, error) {
+			resource, _, err := upserter.UpsertDocument(ctx, c.DbName, c.Name, newDoc("upsert", map[string]interface{}{"x": x}),
+				cosmosapi.UpsertDocumentOptions{PartitionKeyValue: run, IfMatch: etag})
+			return resource, err
+		}
+		first, err := upsert(1, "")
+		require.NoError(t, err)
+		second, err := upsert(2, first.Etag)
+		require.NoError(t, err)
+		_, err = upsert(3, first.Etag)
+		assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+		_, _, err = c.Client.CreateDocument(ctx, c.DbName, c.Name, newDoc("upsert", map[string]interface{}{"x": 4}),
+			cosmosapi.CreateDocumentOptions{PartitionKeyValue: run, IsUpsert: true})
+		require.NoError(t, err)
+		doc, _, err := get("upsert", cosmosapi.GetDocumentOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, float64(4), doc["x"])
+		assert.NotEqual(t, second.Etag, doc["_etag"])
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		created, err := create(newDoc("patch", map[string]interface{}{"x": 1}))
+		require.NoError(t, err)
+		patcher, ok := c.Client.(cosmos.DocumentPatcher)
+		if !ok {
+			t.Skip("The client does not implement PatchDocument")
+		}
+		patch := func(ops cosmosapi.PatchDocumentOptions) (map[string]interface{}, error) {
+			ops.PartitionKeyValue = run
+			var doc map[string]interface{}
+			_, err := patcher.PatchDocument(ctx, c.DbName, c.Name, run+"-patch", []cosmosapi.PatchOperation{
+				cosmosapi.PatchIncrement("/x", 1),
+				cosmosapi.PatchSet("/y", "set"),
+			}, ops, &doc)
+			return doc, err
+		}
+		doc, err := patch(cosmosapi.PatchDocumentOptions{IfMatch: created.Etag})
+		require.NoError(t, err)
+		assert.Equal(t, float64(2), doc["x"])
+		assert.Equal(t, "set", doc["y"])
+		_, err = patch(cosmosapi.PatchDocumentOptions{IfMatch: created.Etag})
+		assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+		_, err = patch(cosmosapi.PatchDocumentOptions{Condition: "FROM c WHERE c.x > 5"})
+		assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+		doc, err = patch(cosmosapi.PatchDocumentOptions{Condition: "FROM c WHERE c.x = 2"})
+		require.NoError(t, err)
+		assert.Equal(t, float64(3), doc["x"])
+	})
+
+	t.Run("SessionToken", func(t *testing.T) {
+		_, response, err := c.Client.CreateDocument(ctx, c.DbName, c.Name, newDoc("session", nil), cosmosapi.CreateDocumentOptions{PartitionKeyValue: run})
+		require.NoError(t, err)
+		require.NotEmpty(t, response.SessionToken)
+		_, err = cosmosapi.ParseSessionToken(response.SessionToken)
+		require.NoError(t, err)
+		_, _, err = get("session", cosmosapi.GetDocumentOptions{ConsistencyLevel: cosmosapi.ConsistencyLevelSession, SessionToken: response.SessionToken})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			_, err := create(newDoc("query-"+string(rune('a'+i)), map[string]interface{}{"n": i, "kind": "query"}))
+			require.NoError(t, err)
+		}
+		ops := cosmosapi.DefaultQueryDocumentOptions()
+		ops.PartitionKeyValue = run
+		var ns []int
+		_, err := c.Client.QueryDocuments(ctx, c.DbName, c.Name, cosmosapi.Query{
+			Query:  "SELECT VALUE c.n FROM c WHERE c.kind = @kind AND c.n >= @min ORDER BY c.n DESC",
+			Params: []cosmosapi.QueryParam{{Name: "@kind", Value: "query"}, {Name: "@min", Value: 1}},
+		}, &ns, ops)
+		require.NoError(t, err)
+		assert.Equal(t, []int{2, 1}, ns)
+	})
+}
@@ -0,0 +1,11 @@
+package cosmostest
+
+import (
+	"testing"
+
+	"github.com/vippsas/go-cosmosdb/cosmos"
+)
+
+func TestFakeClientConformance(t *testing.T) {
+	RunConformanceTests(t, cosmos.Collection{Client: NewFakeClient(), DbName: "db", Name: "coll", PartitionKey: "pk"})
+}
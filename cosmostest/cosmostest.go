@@ -1,6 +1,8 @@
 // The cosmostest package contains utilities for writing tests with cosmos, using a real database
 // or the emulator as a backend, and with the option of multiple tests running side by side
-// in multiple namespaces in a single collection to save costs.
+// in multiple namespaces in a single collection to save costs. For unit tests that should not depend
+// on a database at all, FakeClient is an in-memory implementation of cosmos.Client, and Script a
+// mock of it that responds to a scripted sequence of calls.
 //
 //  Configuration
 //
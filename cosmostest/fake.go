@@ -0,0 +1,645 @@
+package cosmostest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// ErrNotSupported is returned by FakeClient for operations it does not simulate
+var ErrNotSupported = errors.New("Operation not supported by cosmostest.FakeClient")
+
+// maxDocumentSize is the largest document Cosmos accepts
+const maxDocumentSize = 2 * 1024 * 1024
+
+// FakeClient is an in-memory implementation of cosmos.Client, for unit tests that should not depend on
+// a database or the emulator. Collections are created on first use. Documents get an etag and _ts on
+// every write, and etags are checked the way Cosmos does, so that optimistic concurrency can be tested.
+//
+// The time of the fake is controlled by Now and Advance, and is used for _ts and to expire documents by
+// TTL (see EnableTtl), so that logic depending on expiry can be tested without waiting:
+//
+//	fake := cosmostest.NewFakeClient()
+//	fake.EnableTtl("db", "coll", 60)
+//	... write a document ...
+//	fake.Advance(time.Minute)
+//	... the document is gone ...
+type FakeClient struct {
+	// Now returns the current time; defaults to time.Now. Advance adds to it.
+	Now func() time.Time
+	// Charge returns the simulated request charge of an operation; defaults to DefaultCharge
+	Charge func(op FakeOperation) float64
+	// Latency returns the simulated latency of an operation, if set. Rather than sleeping, the fake adds
+	// the latency to its time and returns it as RequestDuration, so that tests stay fast and deterministic.
+	Latency func(op FakeOperation) time.Duration
+	// Throughput is the simulated provisioned throughput in RU/s, if set: an operation that would make the
+	// charge within a second (in the time of the fake) exceed it fails with ErrTooManyRequests
+	Throughput float64
+
+	mu               sync.Mutex
+	offset           time.Duration
+	consistency      cosmosapi.ConsistencyLevel
+	lag              time.Duration
+	totalCharge      float64
+	throughputSecond int64
+	throughputUsed   float64
+	lsn              int64
+	collections      map[string]*fakeCollection
+}
+
+var _ cosmos.Client = &FakeClient{}
+
+type fakeCollection struct {
+	id         string
+	defaultTtl *int
+	docs       map[fakeKey]fakeDocument
+	// history has the recent versions of documents, oldest first, when consistency is simulated
+	history map[fakeKey][]fakeDocument
+}
+
+// fakeKey identifies a document; partitionKey is the partition value serialized as JSON
+type fakeKey struct {
+	partitionKey string
+	id           string
+}
+
+type fakeDocument struct {
+	key fakeKey
+	// body is nil for a deleted document in the history
+	body map[string]interface{}
+	// lsn is the LSN of the last write, which orders documents by time of write
+	lsn     int64
+	written time.Time
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{collections: make(map[string]*fakeCollection)}
+}
+
+// Advance moves the time of the fake forward by d. Documents whose TTL has passed are no longer visible.
+func (f *FakeClient) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offset += d
+}
+
+// EnableTtl enables TTL on a collection, with defaultTtl the time to live in seconds of documents that
+// do not set the ttl property, or -1 for no default. Documents with ttl -1 never expire. Like in Cosmos,
+// the ttl property is ignored on collections where TTL is not enabled.
+func (f *FakeClient) EnableTtl(dbName, colName string, defaultTtl int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.collection(dbName, colName).defaultTtl = &defaultTtl
+}
+
+// SetTs sets the _ts (time of last write) of a stored document, e.g. to make it older than it is
+func (f *FakeClient) SetTs(dbName, colName string, partitionValue interface{}, id string, ts time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(dbName, colName)
+	key, err := newFakeKey(partitionValue, id)
+	if err != nil {
+		return err
+	}
+	doc, ok := f.lookup(coll, key)
+	if !ok {
+		return errors.WithStack(cosmosapi.ErrNotFound)
+	}
+	doc.body["_ts"] = json.Number(strconv.FormatInt(ts.Unix(), 10))
+	return nil
+}
+
+// Seed stores a document captured elsewhere, e.g. in a cosmos.TransactionTrace, keeping its _etag and _ts
+// so that the fake returns it exactly as it was read. A document without an _etag gets one as on any write.
+// If doc is nil, the document is removed.
+func (f *FakeClient) Seed(dbName, colName string, partitionValue interface{}, id string, doc json.RawMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(dbName, colName)
+	key, err := newFakeKey(partitionValue, id)
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		if _, ok := coll.docs[key]; ok {
+			delete(coll.docs, key)
+			f.lsn++
+			f.recordVersion(coll, fakeDocument{key: key, lsn: f.lsn, written: f.now()})
+		}
+		return nil
+	}
+	body, err := toBody(doc)
+	if err != nil {
+		return err
+	}
+	if body["id"] != id {
+		return errors.Wrap(cosmosapi.ErrInvalidRequest, "Document id does not match the id seeded")
+	}
+	if etag, _ := body["_etag"].(string); etag == "" {
+		f.write(coll, key, body)
+		return nil
+	}
+	f.lsn++
+	body["_rid"] = key.id
+	body["_self"] = "dbs/" + coll.id + "/docs/" + key.id
+	coll.docs[key] = fakeDocument{key: key, body: body, lsn: f.lsn, written: f.now()}
+	f.recordVersion(coll, coll.docs[key])
+	return nil
+}
+
+// contextErr returns the error of ctx, if any. ctx may be nil, e.g. from Collection.Query when
+// Collection.Context is not set.
+func contextErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return errors.WithStack(ctx.Err())
+}
+
+func (f *FakeClient) now() time.Time {
+	now := time.Now
+	if f.Now != nil {
+		now = f.Now
+	}
+	return now().Add(f.offset)
+}
+
+// collection returns the collection, creating it if needed. f.mu must be held.
+func (f *FakeClient) collection(dbName, colName string) *fakeCollection {
+	name := dbName + "/" + colName
+	coll, ok := f.collections[name]
+	if !ok {
+		coll = &fakeCollection{id: colName, docs: make(map[fakeKey]fakeDocument), history: make(map[fakeKey][]fakeDocument)}
+		f.collections[name] = coll
+	}
+	return coll
+}
+
+func newFakeKey(partitionValue interface{}, id string) (fakeKey, error) {
+	pk, err := json.Marshal(partitionValue)
+	if err != nil {
+		return fakeKey{}, errors.WithStack(err)
+	}
+	return fakeKey{partitionKey: string(pk), id: id}, nil
+}
+
+// lookup returns a document, unless it does not exist or has expired. f.mu must be held.
+func (f *FakeClient) lookup(coll *fakeCollection, key fakeKey) (fakeDocument, bool) {
+	doc, ok := coll.docs[key]
+	if ok && f.expired(coll, doc) {
+		delete(coll.docs, key)
+		return fakeDocument{}, false
+	}
+	return doc, ok
+}
+
+// expired returns true if the TTL of the document has passed
+func (f *FakeClient) expired(coll *fakeCollection, doc fakeDocument) bool {
+	if coll.defaultTtl == nil {
+		return false
+	}
+	ttl := int64(*coll.defaultTtl)
+	if n, ok := doc.body["ttl"].(json.Number); ok {
+		if v, err := n.Int64(); err == nil {
+			ttl = v
+		}
+	}
+	if ttl < 0 {
+		return false
+	}
+	ts, _ := doc.body["_ts"].(json.Number).Int64()
+	return f.now().Unix() >= ts+ttl
+}
+
+// documents returns the documents of the collection that have not expired, in the order they were last
+// written. f.mu must be held.
+func (f *FakeClient) documents(coll *fakeCollection) []fakeDocument {
+	var result []fakeDocument
+	for key := range coll.docs {
+		if doc, ok := f.lookup(coll, key); ok {
+			result = append(result, doc)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].lsn < result[j].lsn
+	})
+	return result
+}
+
+// toBody serializes a document into its stored form, keeping numbers exact
+func toBody(doc interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(data) > maxDocumentSize {
+		return nil, errors.WithStack(cosmosapi.ErrTooLarge)
+	}
+	var body map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if id, _ := body["id"].(string); id == "" {
+		return nil, errors.Wrap(cosmosapi.ErrInvalidRequest, "Document has no id")
+	}
+	return body, nil
+}
+
+func decodeBody(body interface{}, out interface{}) error {
+	if out == nil {
+		return nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(json.Unmarshal(data, out))
+}
+
+// write stores a document, setting its system properties. f.mu must be held.
+func (f *FakeClient) write(coll *fakeCollection, key fakeKey, body map[string]interface{}) (*cosmosapi.Resource, cosmosapi.DocumentResponse) {
+	f.lsn++
+	now := f.now()
+	ts := now.Unix()
+	etag := fmt.Sprintf("\"%08x-0000-0000-0000-000000000000\"", f.lsn)
+	body["_etag"] = etag
+	body["_ts"] = json.Number(strconv.FormatInt(ts, 10))
+	body["_rid"] = key.id
+	body["_self"] = "dbs/" + coll.id + "/docs/" + key.id
+	coll.docs[key] = fakeDocument{key: key, body: body, lsn: f.lsn, written: now}
+	f.recordVersion(coll, coll.docs[key])
+	resource := &cosmosapi.Resource{Id: key.id, Self: body["_self"].(string), Etag: etag, Rid: key.id, Ts: int(ts)}
+	return resource, f.response(http.StatusOK, etag)
+}
+
+// response returns the response of a request. f.mu must be held.
+func (f *FakeClient) response(statusCode int, etag string) cosmosapi.DocumentResponse {
+	return cosmosapi.DocumentResponse{
+		StatusCode:         statusCode,
+		Etag:               etag,
+		SessionToken:       fmt.Sprintf("0:%d", f.lsn),
+		LSN:                f.lsn,
+		GlobalCommittedLSN: -1,
+		QuorumAckedLSN:     -1,
+	}
+}
+
+func (f *FakeClient) GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	if err := contextErr(ctx); err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(dbName, colName)
+	key, err := newFakeKey(ops.PartitionKeyValue, id)
+	if err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	doc, ok := f.read(coll, key, ops.ConsistencyLevel, ops.SessionToken)
+	cost, err := f.charge(FakeOperation{Kind: FakeRead, DbName: dbName, ColName: colName, Id: id, Size: documentSize(doc.body)})
+	if err != nil {
+		return f.response(http.StatusTooManyRequests, ""), err
+	}
+	var response cosmosapi.DocumentResponse
+	switch {
+	case !ok:
+		response = f.response(http.StatusNotFound, "")
+		err = errors.WithStack(cosmosapi.ErrNotFound)
+	case ops.IfNoneMatch != "" && ops.IfNoneMatch == doc.body["_etag"]:
+		response = f.response(http.StatusNotModified, ops.IfNoneMatch)
+		response.NotModified = true
+	default:
+		response = f.response(http.StatusOK, doc.body["_etag"].(string))
+		err = decodeBody(doc.body, out)
+	}
+	cost.setOn(&response)
+	return response, err
+}
+
+func (f *FakeClient) CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	return f.put(ctx, dbName, colName, "", doc, ops.PartitionKeyValue, ops.IsUpsert, true, "")
+}
+
+func (f *FakeClient) UpsertDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.UpsertDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	return f.put(ctx, dbName, colName, "", doc, ops.PartitionKeyValue, true, true, ops.IfMatch)
+}
+
+func (f *FakeClient) ReplaceDocument(ctx context.Context, dbName, colName, id string, doc interface{}, ops cosmosapi.ReplaceDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	return f.put(ctx, dbName, colName, id, doc, ops.PartitionKeyValue, true, false, ops.IfMatch)
+}
+
+// put writes a document. It fails with ErrConflict if the document exists and !replace, and with
+// ErrNotFound if it does not exist and !create.
+func (f *FakeClient) put(ctx context.Context, dbName, colName, id string, doc, partitionValue interface{}, replace, create bool, ifMatch string) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	if err := contextErr(ctx); err != nil {
+		return nil, cosmosapi.DocumentResponse{}, err
+	}
+	body, err := toBody(doc)
+	if err != nil {
+		return nil, cosmosapi.DocumentResponse{}, err
+	}
+	if id == "" {
+		id = body["id"].(string)
+	} else if body["id"] != id {
+		return nil, cosmosapi.DocumentResponse{}, errors.Wrap(cosmosapi.ErrInvalidRequest, "Document id does not match the id replaced")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(dbName, colName)
+	key, err := newFakeKey(partitionValue, id)
+	if err != nil {
+		return nil, cosmosapi.DocumentResponse{}, err
+	}
+	kind := FakeUpsert
+	if !replace {
+		kind = FakeCreate
+	} else if !create {
+		kind = FakeReplace
+	}
+	cost, err := f.charge(FakeOperation{Kind: kind, DbName: dbName, ColName: colName, Id: id, Size: documentSize(body)})
+	if err != nil {
+		return nil, f.response(http.StatusTooManyRequests, ""), err
+	}
+	existing, exists := f.lookup(coll, key)
+	switch {
+	case exists && !replace:
+		return nil, cost.with(f.response(http.StatusConflict, "")), errors.WithStack(cosmosapi.ErrConflict)
+	case !exists && !create:
+		return nil, cost.with(f.response(http.StatusNotFound, "")), errors.WithStack(cosmosapi.ErrNotFound)
+	case exists && ifMatch != "" && existing.body["_etag"] != ifMatch:
+		return nil, cost.with(f.response(http.StatusPreconditionFailed, "")), errors.WithStack(cosmosapi.ErrPreconditionFailed)
+	}
+	resource, response := f.write(coll, key, body)
+	if !exists {
+		response.StatusCode = http.StatusCreated
+	}
+	cost.setOn(&response)
+	return resource, response, nil
+}
+
+// DeleteDocument deletes a document
+func (f *FakeClient) DeleteDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.DeleteDocumentOptions) (cosmosapi.DocumentResponse, error) {
+	if err := contextErr(ctx); err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(dbName, colName)
+	key, err := newFakeKey(ops.PartitionKeyValue, id)
+	if err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	cost, err := f.charge(FakeOperation{Kind: FakeDelete, DbName: dbName, ColName: colName, Id: id})
+	if err != nil {
+		return f.response(http.StatusTooManyRequests, ""), err
+	}
+	existing, exists := f.lookup(coll, key)
+	if !exists {
+		return cost.with(f.response(http.StatusNotFound, "")), errors.WithStack(cosmosapi.ErrNotFound)
+	}
+	if ops.IfMatch != "" && existing.body["_etag"] != ops.IfMatch {
+		return cost.with(f.response(http.StatusPreconditionFailed, "")), errors.WithStack(cosmosapi.ErrPreconditionFailed)
+	}
+	delete(coll.docs, key)
+	f.lsn++
+	f.recordVersion(coll, fakeDocument{key: key, lsn: f.lsn, written: f.now()})
+	response := f.response(http.StatusNoContent, "")
+	cost.setOn(&response)
+	return response, nil
+}
+
+func (f *FakeClient) PatchDocument(ctx context.Context, dbName, colName, id string, operations []cosmosapi.PatchOperation, ops cosmosapi.PatchDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	if err := contextErr(ctx); err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	var condition sqlExpr
+	if ops.Condition != "" {
+		var err error
+		if condition, err = parseCondition(ops.Condition); err != nil {
+			return cosmosapi.DocumentResponse{}, err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(dbName, colName)
+	key, err := newFakeKey(ops.PartitionKeyValue, id)
+	if err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	existing, exists := f.lookup(coll, key)
+	cost, err := f.charge(FakeOperation{Kind: FakePatch, DbName: dbName, ColName: colName, Id: id, Size: documentSize(existing.body)})
+	if err != nil {
+		return f.response(http.StatusTooManyRequests, ""), err
+	}
+	if !exists {
+		return cost.with(f.response(http.StatusNotFound, "")), errors.WithStack(cosmosapi.ErrNotFound)
+	}
+	if ops.IfMatch != "" && existing.body["_etag"] != ops.IfMatch {
+		return cost.with(f.response(http.StatusPreconditionFailed, "")), errors.WithStack(cosmosapi.ErrPreconditionFailed)
+	}
+	if condition != nil && condition(existing.body) != true {
+		return cost.with(f.response(http.StatusPreconditionFailed, "")), errors.WithStack(cosmosapi.ErrPreconditionFailed)
+	}
+	body, err := patchedBody(existing.body, id, operations)
+	if err != nil {
+		return f.response(http.StatusBadRequest, ""), err
+	}
+	_, response := f.write(coll, key, body)
+	cost.setOn(&response)
+	return response, decodeBody(body, out)
+}
+
+// patchedBody returns a copy of the body of document id with the patch operations applied, so that the
+// document is unchanged if an operation fails
+func patchedBody(existing map[string]interface{}, id string, operations []cosmosapi.PatchOperation) (map[string]interface{}, error) {
+	body, err := toBody(existing)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range operations {
+		if err := applyPatch(body, op); err != nil {
+			return nil, errors.Wrap(cosmosapi.ErrInvalidRequest, err.Error())
+		}
+	}
+	if body["id"] != id {
+		return nil, errors.Wrap(cosmosapi.ErrInvalidRequest, "The id can not be patched")
+	}
+	return body, nil
+}
+
+// QueryDocuments executes a query on the partition ops.PartitionKeyValue, or on all partitions if it is
+// nil. See fake_query.go for the subset of Cosmos SQL supported.
+func (f *FakeClient) QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	response := cosmosapi.QueryDocumentsResponse{Documents: docs}
+	if err := contextErr(ctx); err != nil {
+		return response, err
+	}
+	q, err := parseQuery(qry.Query, qry.Params)
+	if err != nil {
+		return response, err
+	}
+	var partitionKey *fakeKey
+	if ops.PartitionKeyValue != nil {
+		key, err := newFakeKey(ops.PartitionKeyValue, "")
+		if err != nil {
+			return response, err
+		}
+		partitionKey = &key
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var bodies []map[string]interface{}
+	for _, doc := range f.visibleDocuments(f.collection(dbName, collName), ops.ConsistencyLevel, ops.SessionToken) {
+		if partitionKey == nil || doc.key.partitionKey == partitionKey.partitionKey {
+			bodies = append(bodies, doc.body)
+		}
+	}
+	rows, err := q.run(bodies)
+	if err != nil {
+		return response, err
+	}
+	continuation := ops.Continuation
+	if continuation == "" {
+		continuation = qry.Token
+	}
+	page, continuation, err := paginate(len(rows), ops.MaxItemCount, continuation)
+	if err != nil {
+		return response, err
+	}
+	rows = rows[page.start:page.end]
+	size := documentSize(rows)
+	cost, err := f.charge(FakeOperation{Kind: FakeQuery, DbName: dbName, ColName: collName, Size: size, Count: len(rows)})
+	if err != nil {
+		response.StatusCode = http.StatusTooManyRequests
+		return response, err
+	}
+	response.StatusCode = http.StatusOK
+	response.RequestCharge = cost.rus
+	response.Count = len(rows)
+	response.Size = int64(size)
+	response.Continuation = continuation
+	response.SessionToken = fmt.Sprintf("0:%d", f.lsn)
+	return response, decodeBody(rows, docs)
+}
+
+// ListDocuments lists the documents of a collection, in the order they were last written. The change feed
+// (ListDocumentsOptions.AIM) is not supported.
+func (f *FakeClient) ListDocuments(ctx context.Context, dbName, colName string, ops *cosmosapi.ListDocumentsOptions, docs interface{}) (cosmosapi.ListDocumentsResponse, error) {
+	if ops == nil {
+		ops = &cosmosapi.ListDocumentsOptions{}
+	}
+	if err := contextErr(ctx); err != nil {
+		return cosmosapi.ListDocumentsResponse{}, err
+	}
+	if ops.AIM != "" {
+		return cosmosapi.ListDocumentsResponse{}, errors.Wrap(ErrNotSupported, "The change feed")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	all := f.documents(f.collection(dbName, colName))
+	page, continuation, err := paginate(len(all), ops.MaxItemCount, ops.Continuation)
+	if err != nil {
+		return cosmosapi.ListDocumentsResponse{}, err
+	}
+	var bodies []interface{}
+	for _, doc := range all[page.start:page.end] {
+		bodies = append(bodies, doc.body)
+	}
+	if bodies == nil {
+		bodies = []interface{}{}
+	}
+	cost, err := f.charge(FakeOperation{Kind: FakeList, DbName: dbName, ColName: colName, Size: documentSize(bodies), Count: len(bodies)})
+	if err != nil {
+		return cosmosapi.ListDocumentsResponse{ResponseBase: cosmosapi.ResponseBase{StatusCode: http.StatusTooManyRequests}}, err
+	}
+	response := cosmosapi.ListDocumentsResponse{
+		ResponseBase: cosmosapi.ResponseBase{RequestCharge: cost.rus, StatusCode: http.StatusOK},
+		SessionToken: fmt.Sprintf("0:%d", f.lsn),
+		Continuation: continuation,
+		Count:        len(bodies),
+	}
+	return response, decodeBody(bodies, docs)
+}
+
+type pageRange struct{ start, end int }
+
+// paginate returns the range of the page starting at continuation (an offset), and the continuation of
+// the next page, if any
+func paginate(count, maxItemCount int, continuation string) (pageRange, string, error) {
+	start := 0
+	if continuation != "" {
+		var err error
+		if start, err = strconv.Atoi(continuation); err != nil || start < 0 || start > count {
+			return pageRange{}, "", errors.Wrapf(cosmosapi.ErrInvalidRequest, "Invalid continuation '%s'", continuation)
+		}
+	}
+	end := count
+	if maxItemCount > 0 && start+maxItemCount < count {
+		end = start + maxItemCount
+	}
+	if end < count {
+		return pageRange{start, end}, strconv.Itoa(end), nil
+	}
+	return pageRange{start, end}, "", nil
+}
+
+func (f *FakeClient) GetCollection(ctx context.Context, dbName, colName string) (*cosmosapi.Collection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(dbName, colName)
+	return &cosmosapi.Collection{
+		Resource:          cosmosapi.Resource{Id: colName},
+		DefaultTimeToLive: coll.defaultTtl,
+	}, nil
+}
+
+func (f *FakeClient) DeleteCollection(ctx context.Context, dbName, colName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.collections, dbName+"/"+colName)
+	return nil
+}
+
+func (f *FakeClient) DeleteDatabase(ctx context.Context, dbName string, ops *cosmosapi.RequestOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name := range f.collections {
+		if strings.HasPrefix(name, dbName+"/") {
+			delete(f.collections, name)
+		}
+	}
+	return nil
+}
+
+func (f *FakeClient) ExecuteStoredProcedure(ctx context.Context, dbName, colName, sprocName string, ops cosmosapi.ExecuteStoredProcedureOptions, ret interface{}, args ...interface{}) error {
+	return errors.Wrap(ErrNotSupported, "Stored procedures")
+}
+
+// GetPartitionKeyRanges returns a single range covering all partition keys
+func (f *FakeClient) GetPartitionKeyRanges(ctx context.Context, dbName, colName string, options *cosmosapi.GetPartitionKeyRangesOptions) (cosmosapi.GetPartitionKeyRangesResponse, error) {
+	return cosmosapi.GetPartitionKeyRangesResponse{
+		Id:                 colName,
+		PartitionKeyRanges: []cosmosapi.PartitionKeyRange{{Id: "0", MinInclusive: "", MaxExclusive: "FF"}},
+	}, nil
+}
+
+func (f *FakeClient) ListOffers(ctx context.Context, ops *cosmosapi.RequestOptions) (*cosmosapi.Offers, error) {
+	return nil, errors.Wrap(ErrNotSupported, "Offers")
+}
+
+func (f *FakeClient) ReplaceOffer(ctx context.Context, offerOps cosmosapi.OfferReplaceOptions, ops *cosmosapi.RequestOptions) (*cosmosapi.Offer, error) {
+	return nil, errors.Wrap(ErrNotSupported, "Offers")
+}
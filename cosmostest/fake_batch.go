@@ -0,0 +1,184 @@
+package cosmostest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// ExecuteBatch executes the operations as a transactional batch in the partition ops.PartitionKeyValue. The
+// operations are applied in order, with the same checks as the corresponding single operations. If one
+// fails, the operations before it are rolled back, and a cosmosapi.BatchError is returned together with the
+// results of all operations; the others have status 424 Failed Dependency, as in Cosmos.
+func (f *FakeClient) ExecuteBatch(ctx context.Context, dbName, colName string, operations []cosmosapi.BatchOperation, ops cosmosapi.BatchOptions) (cosmosapi.BatchResponse, error) {
+	if err := contextErr(ctx); err != nil {
+		return cosmosapi.BatchResponse{}, err
+	}
+	if len(operations) == 0 || len(operations) > cosmosapi.MaxBatchOperations {
+		return cosmosapi.BatchResponse{}, errors.Errorf("A batch must have between 1 and %d operations, got %d", cosmosapi.MaxBatchOperations, len(operations))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	coll := f.collection(dbName, colName)
+	// The documents and their history before the batch, to roll back to if an operation fails. Written
+	// documents are replaced rather than changed in place, so copies of the maps are enough.
+	docs := make(map[fakeKey]fakeDocument, len(coll.docs))
+	for key, doc := range coll.docs {
+		docs[key] = doc
+	}
+	history := make(map[fakeKey][]fakeDocument, len(coll.history))
+	for key, versions := range coll.history {
+		history[key] = versions
+	}
+
+	results := make([]cosmosapi.BatchOperationResult, len(operations))
+	var rus float64
+	for i, op := range operations {
+		result, err := f.batchOperation(coll, dbName, colName, ops.PartitionKeyValue, op)
+		rus += result.RequestCharge
+		if err == nil {
+			results[i] = result
+			continue
+		}
+		coll.docs, coll.history = docs, history
+		if errors.Cause(err) == cosmosapi.ErrTooManyRequests {
+			// The batch as a whole is throttled
+			return cosmosapi.BatchResponse{DocumentResponse: f.response(http.StatusTooManyRequests, "")}, err
+		}
+		statusCode, ok := gatewayStatus[errors.Cause(err)]
+		if !ok {
+			statusCode = http.StatusBadRequest
+		}
+		for j := range results {
+			results[j] = cosmosapi.BatchOperationResult{StatusCode: http.StatusFailedDependency}
+		}
+		results[i] = cosmosapi.BatchOperationResult{StatusCode: statusCode, RequestCharge: result.RequestCharge}
+		response := cosmosapi.BatchResponse{DocumentResponse: f.response(http.StatusMultiStatus, ""), Results: results}
+		response.RUs = rus
+		return response, cosmosapi.BatchError{Index: i, StatusCode: statusCode, Err: errors.Cause(err)}
+	}
+	response := cosmosapi.BatchResponse{DocumentResponse: f.response(http.StatusOK, ""), Results: results}
+	response.RUs = rus
+	return response, nil
+}
+
+// batchOperation applies an operation of a batch. The result has the charge of the operation also if it
+// fails. f.mu must be held.
+func (f *FakeClient) batchOperation(coll *fakeCollection, dbName, colName string, partitionValue interface{}, op cosmosapi.BatchOperation) (cosmosapi.BatchOperationResult, error) {
+	var result cosmosapi.BatchOperationResult
+	var body map[string]interface{}
+	id := op.Id
+	kind := FakeRead
+	switch op.OperationType {
+	case cosmosapi.BatchCreate, cosmosapi.BatchUpsert, cosmosapi.BatchReplace:
+		var err error
+		if body, err = toBody(op.ResourceBody); err != nil {
+			return result, err
+		}
+		if op.OperationType != cosmosapi.BatchReplace {
+			id = body["id"].(string)
+		} else if body["id"] != id {
+			return result, errors.Wrap(cosmosapi.ErrInvalidRequest, "Document id does not match the id replaced")
+		}
+		switch op.OperationType {
+		case cosmosapi.BatchCreate:
+			kind = FakeCreate
+		case cosmosapi.BatchUpsert:
+			kind = FakeUpsert
+		default:
+			kind = FakeReplace
+		}
+	case cosmosapi.BatchDelete:
+		kind = FakeDelete
+	case cosmosapi.BatchPatch:
+		kind = FakePatch
+	case cosmosapi.BatchRead:
+	default:
+		return result, errors.Wrapf(cosmosapi.ErrInvalidRequest, "Unknown batch operation type '%s'", op.OperationType)
+	}
+	key, err := newFakeKey(partitionValue, id)
+	if err != nil {
+		return result, err
+	}
+	existing, exists := f.lookup(coll, key)
+	size := documentSize(body)
+	if body == nil {
+		size = documentSize(existing.body)
+	}
+	cost, err := f.charge(FakeOperation{Kind: kind, DbName: dbName, ColName: colName, Id: id, Size: size})
+	if err != nil {
+		return result, err
+	}
+	result.RequestCharge = cost.rus
+	switch {
+	case exists && op.OperationType == cosmosapi.BatchCreate:
+		return result, errors.WithStack(cosmosapi.ErrConflict)
+	case !exists && op.OperationType != cosmosapi.BatchCreate && op.OperationType != cosmosapi.BatchUpsert:
+		return result, errors.WithStack(cosmosapi.ErrNotFound)
+	case exists && op.IfMatch != "" && existing.body["_etag"] != op.IfMatch:
+		return result, errors.WithStack(cosmosapi.ErrPreconditionFailed)
+	}
+
+	result.StatusCode = http.StatusOK
+	switch op.OperationType {
+	case cosmosapi.BatchRead:
+		body = existing.body
+	case cosmosapi.BatchDelete:
+		delete(coll.docs, key)
+		f.lsn++
+		f.recordVersion(coll, fakeDocument{key: key, lsn: f.lsn, written: f.now()})
+		result.StatusCode = http.StatusNoContent
+		return result, nil
+	case cosmosapi.BatchPatch:
+		patch, err := batchPatchBody(op.ResourceBody)
+		if err != nil {
+			return result, err
+		}
+		if patch.Condition != "" {
+			condition, err := parseCondition(patch.Condition)
+			if err != nil {
+				return result, err
+			}
+			if condition(existing.body) != true {
+				return result, errors.WithStack(cosmosapi.ErrPreconditionFailed)
+			}
+		}
+		if body, err = patchedBody(existing.body, id, patch.Operations); err != nil {
+			return result, err
+		}
+		f.write(coll, key, body)
+	default:
+		f.write(coll, key, body)
+		if !exists {
+			result.StatusCode = http.StatusCreated
+		}
+	}
+	result.Etag = body["_etag"].(string)
+	if result.ResourceBody, err = json.Marshal(body); err != nil {
+		return result, errors.WithStack(err)
+	}
+	return result, nil
+}
+
+// batchPatchBody returns the ResourceBody of a patch operation, which is a cosmosapi.BatchPatchBody when
+// called directly, and a map when decoded by Gateway
+func batchPatchBody(resourceBody interface{}) (cosmosapi.BatchPatchBody, error) {
+	if patch, ok := resourceBody.(cosmosapi.BatchPatchBody); ok {
+		return patch, nil
+	}
+	var patch cosmosapi.BatchPatchBody
+	data, err := json.Marshal(resourceBody)
+	if err != nil {
+		return patch, errors.WithStack(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&patch); err != nil {
+		return patch, errors.Wrap(cosmosapi.ErrInvalidRequest, err.Error())
+	}
+	return patch, nil
+}
@@ -0,0 +1,114 @@
+package cosmostest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+var consistencyStrength = map[cosmosapi.ConsistencyLevel]int{
+	cosmosapi.ConsistencyLevelEventual: 0,
+	cosmosapi.ConsistencyLevelSession:  1,
+	cosmosapi.ConsistencyLevelBounded:  2,
+	cosmosapi.ConsistencyLevelStrong:   3,
+}
+
+// SimulateConsistency makes the fake behave like an account with a weaker consistency level than
+// ConsistencyLevelStrong (the default), so that tests catch code that depends on reading its own writes
+// without passing session tokens, or on immediately seeing the writes of others.
+//
+// Reads and queries see a write only once lag has passed since it (in the time of the fake; see Advance),
+// and until then see the previous version of the document, if any. With ConsistencyLevelSession, a
+// request that passes the session token of the write, or a later one, sees it immediately. A request
+// can ask for a weaker level than the account's, e.g. ConsistencyLevelEventual to ignore its session
+// token. Writes, etag checks and ListDocuments always see the latest version.
+func (f *FakeClient) SimulateConsistency(level cosmosapi.ConsistencyLevel, lag time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.consistency = level
+	f.lag = lag
+}
+
+// effectiveConsistency returns the consistency level of a request. f.mu must be held.
+func (f *FakeClient) effectiveConsistency(requested cosmosapi.ConsistencyLevel) cosmosapi.ConsistencyLevel {
+	level := f.consistency
+	if level == "" {
+		level = cosmosapi.ConsistencyLevelStrong
+	}
+	if requested != "" && consistencyStrength[requested] < consistencyStrength[level] {
+		return requested
+	}
+	return level
+}
+
+// recordVersion adds a version of a document to its history, forgetting versions that are no longer
+// visible to anyone. f.mu must be held.
+func (f *FakeClient) recordVersion(coll *fakeCollection, doc fakeDocument) {
+	if f.effectiveConsistency("") == cosmosapi.ConsistencyLevelStrong || f.lag <= 0 {
+		delete(coll.history, doc.key)
+		return
+	}
+	versions := append(coll.history[doc.key], doc)
+	now := f.now()
+	for len(versions) > 1 && !now.Before(versions[1].written.Add(f.lag)) {
+		versions = versions[1:]
+	}
+	coll.history[doc.key] = versions
+}
+
+// read returns the version of a document visible to a request with the given consistency level and
+// session token. f.mu must be held.
+func (f *FakeClient) read(coll *fakeCollection, key fakeKey, level cosmosapi.ConsistencyLevel, sessionToken string) (fakeDocument, bool) {
+	versions := coll.history[key]
+	level = f.effectiveConsistency(level)
+	if level == cosmosapi.ConsistencyLevelStrong || len(versions) == 0 {
+		return f.lookup(coll, key)
+	}
+	var sessionLsn int64
+	if level == cosmosapi.ConsistencyLevelSession {
+		if token, err := cosmosapi.ParseSessionToken(sessionToken); err == nil {
+			for _, segment := range token {
+				if segment.GlobalLSN > sessionLsn {
+					sessionLsn = segment.GlobalLSN
+				}
+			}
+		}
+	}
+	now := f.now()
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if v.lsn <= sessionLsn || !now.Before(v.written.Add(f.lag)) {
+			if v.body == nil || f.expired(coll, v) {
+				return fakeDocument{}, false
+			}
+			return v, true
+		}
+	}
+	return fakeDocument{}, false
+}
+
+// visibleDocuments returns the documents visible to a query, in the order they were last written. f.mu
+// must be held.
+func (f *FakeClient) visibleDocuments(coll *fakeCollection, level cosmosapi.ConsistencyLevel, sessionToken string) []fakeDocument {
+	if f.effectiveConsistency(level) == cosmosapi.ConsistencyLevelStrong {
+		return f.documents(coll)
+	}
+	keys := make(map[fakeKey]bool)
+	for key := range coll.docs {
+		keys[key] = true
+	}
+	for key := range coll.history {
+		keys[key] = true
+	}
+	var result []fakeDocument
+	for key := range keys {
+		if doc, ok := f.read(coll, key, level, sessionToken); ok {
+			result = append(result, doc)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].lsn < result[j].lsn
+	})
+	return result
+}
@@ -0,0 +1,85 @@
+package cosmostest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestFakeClientSessionConsistency(t *testing.T) {
+	fake, c := newFakeCollection()
+	fake.SimulateConsistency(cosmosapi.ConsistencyLevelSession, time.Second)
+
+	entity := fakeModel{BaseModel: cosmos.BaseModel{Id: "a"}, UserId: "u", Count: 1}
+	response, err := c.PutMatching(&entity, cosmos.MatchAny)
+	require.NoError(t, err)
+
+	get := func(level cosmosapi.ConsistencyLevel, token string) (fakeModel, error) {
+		var out fakeModel
+		_, err := fake.GetDocument(context.Background(), "db", "coll", "a",
+			cosmosapi.GetDocumentOptions{PartitionKeyValue: "u", ConsistencyLevel: level, SessionToken: token}, &out)
+		return out, err
+	}
+	_, err = get("", "")
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+	_, err = get("", response.SessionToken)
+	assert.NoError(t, err)
+	_, err = get(cosmosapi.ConsistencyLevelEventual, response.SessionToken)
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+
+	// A session carries its token between transactions, so it reads its own writes
+	session := c.Session()
+	require.NoError(t, session.Transaction(func(txn *cosmos.Transaction) error {
+		var e fakeModel
+		if err := txn.Get("u", "b", &e); err != nil {
+			return err
+		}
+		e.Count = 2
+		txn.Put(&e)
+		return nil
+	}))
+	require.NoError(t, session.Transaction(func(txn *cosmos.Transaction) error {
+		var e fakeModel
+		require.NoError(t, txn.Get("u", "b", &e))
+		assert.Equal(t, 2, e.Count)
+		return nil
+	}))
+	err = c.StaleGetExisting("u", "b", &fakeModel{})
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+
+	// Others see the previous version until the lag has passed
+	fake.Advance(time.Second)
+	entity.Count = 3
+	_, err = c.PutMatching(&entity, cosmos.MatchCurrent)
+	require.NoError(t, err)
+	fetched, err := get("", "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetched.Count)
+	var counts []int
+	_, err = c.Query("SELECT VALUE c.count FROM c", &counts)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, counts)
+
+	fake.Advance(time.Second)
+	fetched, err = get("", "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, fetched.Count)
+	_, err = c.Query("SELECT VALUE c.count FROM c", &counts)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, counts)
+
+	// Deletes are also seen late
+	_, err = fake.DeleteDocument(context.Background(), "db", "coll", "a", cosmosapi.DeleteDocumentOptions{PartitionKeyValue: "u"})
+	require.NoError(t, err)
+	_, err = get("", "")
+	assert.NoError(t, err)
+	fake.Advance(time.Second)
+	_, err = get("", "")
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+}
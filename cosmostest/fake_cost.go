@@ -0,0 +1,132 @@
+package cosmostest
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// FakeOperationKind is the kind of an operation done on a FakeClient
+type FakeOperationKind string
+
+const (
+	FakeRead    = FakeOperationKind("read")
+	FakeCreate  = FakeOperationKind("create")
+	FakeUpsert  = FakeOperationKind("upsert")
+	FakeReplace = FakeOperationKind("replace")
+	FakePatch   = FakeOperationKind("patch")
+	FakeDelete  = FakeOperationKind("delete")
+	FakeQuery   = FakeOperationKind("query")
+	FakeList    = FakeOperationKind("list")
+)
+
+// FakeOperation describes an operation done on a FakeClient, to simulate its cost
+type FakeOperation struct {
+	Kind    FakeOperationKind
+	DbName  string
+	ColName string
+	// Id is the id of the document, for operations on a single document
+	Id string
+	// Size is the size in bytes of the document read or written, or of the documents returned by a query
+	Size int
+	// Count is the number of documents returned by a query
+	Count int
+}
+
+// DefaultCharge approximates the request charge of an operation in Cosmos: 1 RU per KB read, 5 RUs per
+// KB written, and 2.5 RUs plus 1 RU per KB returned for queries. It is meant for testing logic that
+// depends on request charges, not for estimating costs.
+func DefaultCharge(op FakeOperation) float64 {
+	kb := math.Max(1, math.Ceil(float64(op.Size)/1024))
+	switch op.Kind {
+	case FakeRead:
+		return kb
+	case FakeQuery, FakeList:
+		return 2.5 + math.Ceil(float64(op.Size)/1024)
+	case FakeDelete:
+		return 5
+	}
+	return 5 * kb
+}
+
+// FixedLatency returns a FakeClient.Latency giving all operations the latency d
+func FixedLatency(d time.Duration) func(op FakeOperation) time.Duration {
+	return func(op FakeOperation) time.Duration {
+		return d
+	}
+}
+
+// UniformLatency returns a FakeClient.Latency giving operations latencies uniformly distributed between
+// min and max. The latencies are pseudo-random from seed, so that tests are repeatable. It panics if max is
+// less than min.
+func UniformLatency(min, max time.Duration, seed int64) func(op FakeOperation) time.Duration {
+	if max < min {
+		panic(errors.Errorf("UniformLatency: max %v is less than min %v", max, min))
+	}
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func(op FakeOperation) time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return min + time.Duration(r.Int63n(int64(max-min)+1))
+	}
+}
+
+// TotalCharge returns the sum of the request charges of all operations done
+func (f *FakeClient) TotalCharge() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.totalCharge
+}
+
+type fakeCost struct {
+	rus     float64
+	latency time.Duration
+}
+
+func (c fakeCost) setOn(response *cosmosapi.DocumentResponse) {
+	response.RUs = c.rus
+	response.RequestDuration = c.latency
+}
+
+// with returns response with the cost set on it; for failed operations, which are charged too
+func (c fakeCost) with(response cosmosapi.DocumentResponse) cosmosapi.DocumentResponse {
+	c.setOn(&response)
+	return response
+}
+
+// charge simulates the cost of an operation, failing with ErrTooManyRequests if it would exceed
+// Throughput. The latency of the operation is added to the time of the fake. f.mu must be held.
+func (f *FakeClient) charge(op FakeOperation) (fakeCost, error) {
+	chargeFunc := f.Charge
+	if chargeFunc == nil {
+		chargeFunc = DefaultCharge
+	}
+	cost := fakeCost{rus: chargeFunc(op)}
+	if f.Throughput > 0 {
+		second := f.now().Unix()
+		if second != f.throughputSecond {
+			f.throughputSecond, f.throughputUsed = second, 0
+		}
+		if f.throughputUsed+cost.rus > f.Throughput {
+			return fakeCost{}, errors.WithStack(cosmosapi.ErrTooManyRequests)
+		}
+		f.throughputUsed += cost.rus
+	}
+	f.totalCharge += cost.rus
+	if f.Latency != nil {
+		cost.latency = f.Latency(op)
+		f.offset += cost.latency
+	}
+	return cost, nil
+}
+
+func documentSize(doc interface{}) int {
+	data, _ := json.Marshal(doc)
+	return len(data)
+}
@@ -0,0 +1,110 @@
+package cosmostest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestFakeClientCharges(t *testing.T) {
+	fake, _ := newFakeCollection()
+	fake.Throughput = 12
+	fake.Latency = FixedLatency(10 * time.Millisecond)
+	ctx := context.Background()
+	started := fake.now()
+
+	create := func(id string) (cosmosapi.DocumentResponse, error) {
+		_, response, err := fake.CreateDocument(ctx, "db", "coll", map[string]string{"id": id}, cosmosapi.CreateDocumentOptions{PartitionKeyValue: id})
+		return response, err
+	}
+	response, err := create("a")
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, response.RUs)
+	assert.Equal(t, 10*time.Millisecond, response.RequestDuration)
+	_, err = create("b")
+	require.NoError(t, err)
+	_, err = create("c")
+	assert.Equal(t, cosmosapi.ErrTooManyRequests, errors.Cause(err))
+	response, err = fake.GetDocument(ctx, "db", "coll", "a", cosmosapi.GetDocumentOptions{PartitionKeyValue: "a"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, response.RUs)
+	assert.Equal(t, 11.0, fake.TotalCharge())
+	assert.Equal(t, 30*time.Millisecond, fake.now().Sub(started))
+
+	// The budget is renewed every second
+	fake.Advance(time.Second)
+	_, err = create("c")
+	require.NoError(t, err)
+
+	fake.Charge = func(op FakeOperation) float64 {
+		return float64(op.Count)
+	}
+	var docs []interface{}
+	queryResponse, err := fake.QueryDocuments(ctx, "db", "coll", cosmosapi.Query{Query: "SELECT * FROM c"}, &docs, cosmosapi.DefaultQueryDocumentOptions())
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, queryResponse.RequestCharge)
+	assert.Equal(t, http.StatusOK, queryResponse.StatusCode)
+
+	// Throttled queries and lists respond with 429
+	fake.Charge = func(op FakeOperation) float64 {
+		return 100
+	}
+	queryResponse, err = fake.QueryDocuments(ctx, "db", "coll", cosmosapi.Query{Query: "SELECT * FROM c"}, &docs, cosmosapi.DefaultQueryDocumentOptions())
+	assert.Equal(t, cosmosapi.ErrTooManyRequests, errors.Cause(err))
+	assert.Equal(t, http.StatusTooManyRequests, queryResponse.StatusCode)
+	listResponse, err := fake.ListDocuments(ctx, "db", "coll", nil, &docs)
+	assert.Equal(t, cosmosapi.ErrTooManyRequests, errors.Cause(err))
+	assert.Equal(t, http.StatusTooManyRequests, listResponse.StatusCode)
+}
+
+func TestUniformLatency(t *testing.T) {
+	a, b := UniformLatency(time.Millisecond, 5*time.Millisecond, 42), UniformLatency(time.Millisecond, 5*time.Millisecond, 42)
+	for i := 0; i < 100; i++ {
+		latency := a(FakeOperation{})
+		assert.Equal(t, latency, b(FakeOperation{}))
+		assert.True(t, latency >= time.Millisecond && latency <= 5*time.Millisecond)
+	}
+	assert.Panics(t, func() { UniformLatency(5*time.Millisecond, time.Millisecond, 42) })
+}
+
+func TestSessionRequestUnits(t *testing.T) {
+	fake, c := newFakeCollection()
+	require.NoError(t, c.RacingPut(&fakeModel{BaseModel: cosmos.BaseModel{Id: "a"}, UserId: "u", Count: 1}))
+	before := fake.TotalCharge()
+
+	// The charge of the attempt that met a conflict is included, but not that of the concurrent write
+	session := c.Session()
+	var concurrentCharge float64
+	err := session.Transaction(func(txn *cosmos.Transaction) error {
+		var entity fakeModel
+		if err := txn.Get("u", "a", &entity); err != nil {
+			return err
+		}
+		assert.Equal(t, fake.TotalCharge()-before-concurrentCharge, txn.RequestUnits())
+		if concurrentCharge == 0 {
+			concurrent := entity
+			response, err := c.RacingPutWithResponse(&concurrent)
+			require.NoError(t, err)
+			concurrentCharge = response.RUs
+		}
+		entity.Count++
+		txn.Put(&entity)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, session.RequestUnits() > 0)
+	assert.Equal(t, fake.TotalCharge()-before-concurrentCharge, session.RequestUnits())
+
+	// Gets served from the session cache are free
+	total := session.RequestUnits()
+	var entity fakeModel
+	require.NoError(t, session.Get("u", "a", &entity))
+	assert.Equal(t, total, session.RequestUnits())
+}
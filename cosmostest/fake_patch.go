@@ -0,0 +1,224 @@
+package cosmostest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// applyPatch applies a partial document update operation to a document the way Cosmos does; see
+// https://docs.microsoft.com/en-us/azure/cosmos-db/partial-document-update
+func applyPatch(body map[string]interface{}, op cosmosapi.PatchOperation) error {
+	value, err := patchValue(op)
+	if err != nil {
+		return err
+	}
+	var apply func(node interface{}, key string) (interface{}, error)
+	switch op.Op {
+	case cosmosapi.PatchOpAdd:
+		apply = func(node interface{}, key string) (interface{}, error) { return addAt(node, key, value, true) }
+	case cosmosapi.PatchOpSet:
+		apply = func(node interface{}, key string) (interface{}, error) { return addAt(node, key, value, false) }
+	case cosmosapi.PatchOpReplace:
+		apply = func(node interface{}, key string) (interface{}, error) {
+			if _, err := childOf(node, key); err != nil {
+				return nil, err
+			}
+			return addAt(node, key, value, false)
+		}
+	case cosmosapi.PatchOpRemove:
+		apply = removeAt
+	case cosmosapi.PatchOpIncrement:
+		apply = func(node interface{}, key string) (interface{}, error) {
+			current, err := childOf(node, key)
+			if err != nil {
+				return addAt(node, key, value, false)
+			}
+			sum, err := increment(current, value)
+			if err != nil {
+				return nil, errors.WithMessage(err, op.Path)
+			}
+			return addAt(node, key, sum, false)
+		}
+	case cosmosapi.PatchOpMove:
+		moved, err := lookupPath(body, op.From)
+		if err != nil {
+			return err
+		}
+		if err := patchPath(body, op.From, removeAt); err != nil {
+			return err
+		}
+		apply = func(node interface{}, key string) (interface{}, error) { return addAt(node, key, moved, false) }
+	default:
+		return errors.Errorf("Unknown patch operation '%s'", op.Op)
+	}
+	return patchPath(body, op.Path, apply)
+}
+
+// patchValue returns the value of the operation as it would be sent to Cosmos
+func patchValue(op cosmosapi.PatchOperation) (interface{}, error) {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m["value"], nil
+}
+
+func splitPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/") || path == "/" {
+		return nil, errors.Errorf("Invalid patch path '%s'", path)
+	}
+	segments := strings.Split(path[1:], "/")
+	for i, s := range segments {
+		segments[i] = strings.Replace(strings.Replace(s, "~1", "/", -1), "~0", "~", -1)
+	}
+	return segments, nil
+}
+
+// patchPath calls apply with the parent of the path and the last segment of the path, and replaces the
+// parent with the result
+func patchPath(body map[string]interface{}, path string, apply func(node interface{}, key string) (interface{}, error)) error {
+	segments, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	_, err = patchAt(body, segments, apply)
+	return errors.WithMessage(err, path)
+}
+
+func patchAt(node interface{}, segments []string, apply func(node interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(segments) == 1 {
+		return apply(node, segments[0])
+	}
+	child, err := childOf(node, segments[0])
+	if err != nil {
+		return nil, err
+	}
+	newChild, err := patchAt(child, segments[1:], apply)
+	if err != nil {
+		return nil, err
+	}
+	return addAt(node, segments[0], newChild, false)
+}
+
+func lookupPath(body map[string]interface{}, path string) (interface{}, error) {
+	segments, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	var node interface{} = body
+	for _, s := range segments {
+		if node, err = childOf(node, s); err != nil {
+			return nil, errors.WithMessage(err, path)
+		}
+	}
+	return node, nil
+}
+
+func arrayIndex(array []interface{}, key string, allowEnd bool) (int, error) {
+	if key == "-" && allowEnd {
+		return len(array), nil
+	}
+	i, err := strconv.Atoi(key)
+	max := len(array) - 1
+	if allowEnd {
+		max = len(array)
+	}
+	if err != nil || i < 0 || i > max {
+		return 0, errors.Errorf("Invalid array index '%s'", key)
+	}
+	return i, nil
+}
+
+func childOf(node interface{}, key string) (interface{}, error) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		child, ok := node[key]
+		if !ok {
+			return nil, errors.Errorf("Property '%s' does not exist", key)
+		}
+		return child, nil
+	case []interface{}:
+		i, err := arrayIndex(node, key, false)
+		if err != nil {
+			return nil, err
+		}
+		return node[i], nil
+	}
+	return nil, errors.Errorf("Can not access '%s' of a value that is not an object or array", key)
+}
+
+// addAt sets key of node to value. If insert is set and node is an array, value is inserted at the index
+// rather than replacing the element there.
+func addAt(node interface{}, key string, value interface{}, insert bool) (interface{}, error) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		node[key] = value
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(node, key, true)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(node) {
+			return append(node, value), nil
+		}
+		if !insert {
+			node[i] = value
+			return node, nil
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return node, nil
+	}
+	return nil, errors.Errorf("Can not set '%s' of a value that is not an object or array", key)
+}
+
+func removeAt(node interface{}, key string) (interface{}, error) {
+	if _, err := childOf(node, key); err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		delete(n, key)
+		return n, nil
+	case []interface{}:
+		i, _ := arrayIndex(n, key, false)
+		return append(n[:i], n[i+1:]...), nil
+	}
+	return node, nil
+}
+
+// increment adds two JSON numbers, keeping the result an integer if both are integers
+func increment(current, delta interface{}) (interface{}, error) {
+	a, ok1 := current.(json.Number)
+	b, ok2 := delta.(json.Number)
+	if !ok1 || !ok2 {
+		return nil, errors.New("Can only increment numbers by numbers")
+	}
+	if x, err := a.Int64(); err == nil {
+		if y, err := b.Int64(); err == nil {
+			return json.Number(strconv.FormatInt(x+y, 10)), nil
+		}
+	}
+	x, err := a.Float64()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	y, err := b.Float64()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return json.Number(strconv.FormatFloat(x+y, 'g', -1, 64)), nil
+}
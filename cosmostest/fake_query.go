@@ -0,0 +1,1239 @@
+package cosmostest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// The FakeClient executes a practical subset of the Cosmos SQL query language:
+//
+//	SELECT [DISTINCT] [TOP n] (* | VALUE expr | expr [AS name], ...)
+//	FROM c
+//	[WHERE expr]
+//	[ORDER BY expr [ASC|DESC], ...]
+//	[OFFSET n LIMIT m]
+//
+// Expressions are literals, @parameters, property paths (c.a.b, c["a"], c.list[0]), array literals,
+// the operators AND, OR, NOT, =, !=, <>, <, <=, >, >=, IN, BETWEEN, +, -, *, /, % and ||, and the
+// functions listed in sqlFunctions. The aggregates COUNT, SUM, MIN, MAX and AVG are supported at the top
+// level of SELECT, without GROUP BY. Like in Cosmos, a comparison of values of different types, or
+// involving an undefined property, is undefined, and only documents for which WHERE is true match.
+// JOIN, GROUP BY, subqueries and user-defined functions are not supported.
+
+// sqlUndefined is the value of a property that does not exist; nil is the JSON null
+type sqlUndefined struct{}
+
+var undefined = sqlUndefined{}
+
+type sqlExpr func(doc interface{}) interface{}
+
+type sqlSelectItem struct {
+	name string
+	expr sqlExpr
+	// aggregate is the name of the aggregate function of the item, if any, with expr its argument
+	aggregate string
+}
+
+type sqlOrderItem struct {
+	expr sqlExpr
+	desc bool
+}
+
+type fakeQuery struct {
+	distinct  bool
+	top       int
+	selectAll bool
+	value     bool
+	items     []sqlSelectItem
+	where     sqlExpr
+	orderBy   []sqlOrderItem
+	offset    int
+	limit     int
+}
+
+// parseQuery parses a query, with the values of the parameters
+func parseQuery(query string, params []cosmosapi.QueryParam) (*fakeQuery, error) {
+	p, err := newSqlParser(query, params)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.parseQuery()
+	if err != nil {
+		return nil, errors.Wrapf(cosmosapi.ErrInvalidRequest, "Invalid query '%s': %v", query, err)
+	}
+	return q, nil
+}
+
+// parseCondition parses a patch condition, on the form "FROM c WHERE expr"
+func parseCondition(condition string) (sqlExpr, error) {
+	q, err := parseQuery("SELECT * "+condition, nil)
+	if err != nil {
+		return nil, err
+	}
+	if q.where == nil {
+		return func(doc interface{}) interface{} { return true }, nil
+	}
+	return q.where, nil
+}
+
+// run returns the result of the query on the documents
+func (q *fakeQuery) run(docs []map[string]interface{}) ([]interface{}, error) {
+	var matches []interface{}
+	for _, doc := range docs {
+		if q.where == nil || q.where(doc) == true {
+			matches = append(matches, doc)
+		}
+	}
+	if len(q.orderBy) > 0 {
+		sort.SliceStable(matches, func(i, j int) bool {
+			for _, o := range q.orderBy {
+				c := sqlOrder(o.expr(matches[i]), o.expr(matches[j]))
+				if o.desc {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+	if len(q.items) > 0 && q.items[0].aggregate != "" {
+		return q.aggregate(matches), nil
+	}
+	if offset := q.offset; offset > 0 {
+		if offset > len(matches) {
+			offset = len(matches)
+		}
+		matches = matches[offset:]
+	}
+	if q.limit >= 0 && q.limit < len(matches) {
+		matches = matches[:q.limit]
+	}
+	if q.top >= 0 && q.top < len(matches) {
+		matches = matches[:q.top]
+	}
+	result := []interface{}{}
+	seen := make(map[string]bool)
+	for _, doc := range matches {
+		row := q.project(doc)
+		if row == undefined {
+			continue
+		}
+		if q.distinct {
+			key, _ := json.Marshal(row)
+			if seen[string(key)] {
+				continue
+			}
+			seen[string(key)] = true
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+func (q *fakeQuery) project(doc interface{}) interface{} {
+	switch {
+	case q.selectAll:
+		return doc
+	case q.value:
+		return q.items[0].expr(doc)
+	}
+	row := make(map[string]interface{})
+	for _, item := range q.items {
+		if v := item.expr(doc); v != undefined {
+			row[item.name] = v
+		}
+	}
+	return row
+}
+
+func (q *fakeQuery) aggregate(docs []interface{}) []interface{} {
+	row := make(map[string]interface{})
+	for _, item := range q.items {
+		var values []interface{}
+		for _, doc := range docs {
+			if v := item.expr(doc); v != undefined {
+				values = append(values, v)
+			}
+		}
+		v := aggregate(item.aggregate, values)
+		if q.value {
+			if v == undefined {
+				return []interface{}{}
+			}
+			return []interface{}{v}
+		}
+		if v != undefined {
+			row[item.name] = v
+		}
+	}
+	return []interface{}{row}
+}
+
+func aggregate(name string, values []interface{}) interface{} {
+	switch name {
+	case "COUNT":
+		return sqlNumber(float64(len(values)))
+	case "SUM", "AVG":
+		sum := 0.0
+		for _, v := range values {
+			f, ok := toFloat(v)
+			if !ok {
+				return undefined
+			}
+			sum += f
+		}
+		if name == "SUM" {
+			return sqlNumber(sum)
+		}
+		if len(values) == 0 {
+			return undefined
+		}
+		return sqlNumber(sum / float64(len(values)))
+	default: // MIN and MAX
+		var result interface{} = undefined
+		for _, v := range values {
+			c := sqlOrder(v, result)
+			if result == undefined || (name == "MIN" && c < 0) || (name == "MAX" && c > 0) {
+				result = v
+			}
+		}
+		return result
+	}
+}
+
+//
+// Values
+//
+
+func toFloat(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// sqlNumber returns f as a JSON number, formatted as an integer if it is one
+func sqlNumber(f float64) json.Number {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return json.Number(strconv.FormatInt(int64(f), 10))
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// typeRank orders values of different types the way ORDER BY does
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case sqlUndefined:
+		return 0
+	case nil:
+		return 1
+	case bool:
+		return 2
+	case json.Number:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+// sqlOrder compares two values for ORDER BY, MIN and MAX
+func sqlOrder(a, b interface{}) int {
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return ra - rb
+	}
+	c, _ := sqlCompare(a, b)
+	return c
+}
+
+// sqlCompare compares two values of the same type; ok is false if they can not be compared
+func sqlCompare(a, b interface{}) (c int, ok bool) {
+	switch a := a.(type) {
+	case nil:
+		return 0, b == nil
+	case bool:
+		b, ok := b.(bool)
+		switch {
+		case !ok:
+			return 0, false
+		case a == b:
+			return 0, true
+		case !a:
+			return -1, true
+		}
+		return 1, true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return 0, false
+		}
+		if x, err := a.Int64(); err == nil {
+			if y, err := b.Int64(); err == nil {
+				return compareOrdered(x < y, x > y), true
+			}
+		}
+		x, _ := a.Float64()
+		y, _ := b.Float64()
+		return compareOrdered(x < y, x > y), true
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	}
+	return 0, false
+}
+
+func compareOrdered(less, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return 1
+	}
+	return 0
+}
+
+// sqlEqual returns true, false or undefined
+func sqlEqual(a, b interface{}) interface{} {
+	if a == undefined || b == undefined {
+		return undefined
+	}
+	if c, ok := sqlCompare(a, b); ok {
+		return c == 0
+	}
+	if typeRank(a) != typeRank(b) {
+		return undefined
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+//
+// Functions
+//
+
+type sqlFunction struct {
+	minArgs, maxArgs int
+	call             func(args []interface{}) interface{}
+}
+
+var aggregateFunctions = map[string]bool{"COUNT": true, "SUM": true, "MIN": true, "MAX": true, "AVG": true}
+
+var sqlFunctions = map[string]sqlFunction{
+	"IS_DEFINED": {1, 1, func(args []interface{}) interface{} { return args[0] != undefined }},
+	"IS_NULL":    {1, 1, func(args []interface{}) interface{} { return args[0] == nil }},
+	"IS_BOOL":    {1, 1, func(args []interface{}) interface{} { return typeRank(args[0]) == 2 }},
+	"IS_NUMBER":  {1, 1, func(args []interface{}) interface{} { return typeRank(args[0]) == 3 }},
+	"IS_STRING":  {1, 1, func(args []interface{}) interface{} { return typeRank(args[0]) == 4 }},
+	"IS_ARRAY":   {1, 1, func(args []interface{}) interface{} { return typeRank(args[0]) == 5 }},
+	"IS_OBJECT":  {1, 1, func(args []interface{}) interface{} { return typeRank(args[0]) == 6 && args[0] != undefined }},
+	"STARTSWITH": {2, 3, stringPredicate(strings.HasPrefix)},
+	"ENDSWITH":   {2, 3, stringPredicate(strings.HasSuffix)},
+	"CONTAINS":   {2, 3, stringPredicate(strings.Contains)},
+	"LOWER":      {1, 1, stringFunction(strings.ToLower)},
+	"UPPER":      {1, 1, stringFunction(strings.ToUpper)},
+	"TRIM":       {1, 1, stringFunction(strings.TrimSpace)},
+	"LENGTH": {1, 1, func(args []interface{}) interface{} {
+		if s, ok := args[0].(string); ok {
+			return sqlNumber(float64(len([]rune(s))))
+		}
+		return undefined
+	}},
+	"CONCAT": {2, -1, func(args []interface{}) interface{} {
+		var b strings.Builder
+		for _, arg := range args {
+			s, ok := arg.(string)
+			if !ok {
+				return undefined
+			}
+			b.WriteString(s)
+		}
+		return b.String()
+	}},
+	"SUBSTRING": {3, 3, func(args []interface{}) interface{} {
+		s, ok := args[0].(string)
+		start, ok1 := toFloat(args[1])
+		length, ok2 := toFloat(args[2])
+		if !ok || !ok1 || !ok2 {
+			return undefined
+		}
+		runes := []rune(s)
+		from := int(math.Max(0, math.Min(start, float64(len(runes)))))
+		to := int(math.Max(float64(from), math.Min(start+length, float64(len(runes)))))
+		return string(runes[from:to])
+	}},
+	"ARRAY_CONTAINS": {2, 3, func(args []interface{}) interface{} {
+		array, ok := args[0].([]interface{})
+		if !ok {
+			return undefined
+		}
+		partial := len(args) == 3 && args[2] == true
+		for _, item := range array {
+			if sqlEqual(item, args[1]) == true || (partial && partialMatch(item, args[1])) {
+				return true
+			}
+		}
+		return false
+	}},
+	"ARRAY_LENGTH": {1, 1, func(args []interface{}) interface{} {
+		if array, ok := args[0].([]interface{}); ok {
+			return sqlNumber(float64(len(array)))
+		}
+		return undefined
+	}},
+	"ABS":     {1, 1, numberFunction(math.Abs)},
+	"FLOOR":   {1, 1, numberFunction(math.Floor)},
+	"CEILING": {1, 1, numberFunction(math.Ceil)},
+	"ROUND":   {1, 1, numberFunction(math.Round)},
+	"TOSTRING": {1, 1, func(args []interface{}) interface{} {
+		switch v := args[0].(type) {
+		case sqlUndefined:
+			return undefined
+		case string:
+			return v
+		}
+		data, _ := json.Marshal(args[0])
+		return string(data)
+	}},
+}
+
+func stringPredicate(f func(s, sub string) bool) func(args []interface{}) interface{} {
+	return func(args []interface{}) interface{} {
+		s, ok1 := args[0].(string)
+		sub, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return undefined
+		}
+		if len(args) == 3 && args[2] == true {
+			s, sub = strings.ToLower(s), strings.ToLower(sub)
+		}
+		return f(s, sub)
+	}
+}
+
+func stringFunction(f func(s string) string) func(args []interface{}) interface{} {
+	return func(args []interface{}) interface{} {
+		if s, ok := args[0].(string); ok {
+			return f(s)
+		}
+		return undefined
+	}
+}
+
+func numberFunction(f func(x float64) float64) func(args []interface{}) interface{} {
+	return func(args []interface{}) interface{} {
+		if x, ok := toFloat(args[0]); ok {
+			return sqlNumber(f(x))
+		}
+		return undefined
+	}
+}
+
+// partialMatch returns true if item is an object containing all the properties of pattern
+func partialMatch(item, pattern interface{}) bool {
+	obj, ok1 := item.(map[string]interface{})
+	pat, ok2 := pattern.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return false
+	}
+	for k, v := range pat {
+		if sqlEqual(obj[k], v) != true {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// Parser
+//
+
+type sqlTokenKind int
+
+const (
+	tokEOF sqlTokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokParam
+	tokSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+func tokenizeSql(s string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_' || c == '@':
+			j := i + 1
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			kind := tokIdent
+			if c == '@' {
+				kind = tokParam
+			}
+			tokens = append(tokens, sqlToken{kind, s[i:j]})
+			i = j
+		case unicode.IsDigit(c):
+			j := i + 1
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				((s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokNumber, s[i:j]})
+			i = j
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && rune(s[j]) != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j == len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, sqlToken{tokString, b.String()})
+			i = j + 1
+		default:
+			symbol := s[i : i+1]
+			if i+1 < len(s) {
+				switch s[i : i+2] {
+				case "!=", "<>", "<=", ">=", "||":
+					symbol = s[i : i+2]
+				}
+			}
+			if !strings.Contains("()[],.*+-/%=<>!|", symbol[:1]) {
+				return nil, errors.Errorf("unexpected character '%s'", symbol)
+			}
+			tokens = append(tokens, sqlToken{tokSymbol, symbol})
+			i += len(symbol)
+		}
+	}
+	return append(tokens, sqlToken{kind: tokEOF}), nil
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+	alias  string
+	params map[string]interface{}
+}
+
+func newSqlParser(query string, params []cosmosapi.QueryParam) (*sqlParser, error) {
+	tokens, err := tokenizeSql(query)
+	if err != nil {
+		return nil, errors.Wrapf(cosmosapi.ErrInvalidRequest, "Invalid query '%s': %v", query, err)
+	}
+	p := &sqlParser{tokens: tokens, params: make(map[string]interface{})}
+	// Pass the parameters through JSON, the way they are sent to Cosmos
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var decoded []struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, param := range decoded {
+		p.params[param.Name] = param.Value
+	}
+	return p, nil
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword returns true if the next token is the keyword
+func (p *sqlParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *sqlParser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) acceptSymbol(symbol string) bool {
+	if t := p.peek(); t.kind == tokSymbol && t.text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return errors.Errorf("expected %s at '%s'", keyword, p.peek().text)
+	}
+	return nil
+}
+
+func (p *sqlParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return errors.Errorf("expected '%s' at '%s'", symbol, p.peek().text)
+	}
+	return nil
+}
+
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "TOP": true, "VALUE": true, "FROM": true, "WHERE": true, "ORDER": true,
+	"BY": true, "ASC": true, "DESC": true, "AND": true, "OR": true, "NOT": true, "IN": true, "AS": true,
+	"OFFSET": true, "LIMIT": true, "BETWEEN": true, "JOIN": true, "GROUP": true,
+}
+
+func (p *sqlParser) parseQuery() (*fakeQuery, error) {
+	// The alias of the documents is needed to resolve paths in SELECT, which comes before FROM
+	for i, t := range p.tokens {
+		if t.kind == tokIdent && strings.EqualFold(t.text, "FROM") && p.tokens[i+1].kind == tokIdent {
+			p.alias = p.tokens[i+1].text
+			// The collection may be given an alias, as in "FROM root r" or "FROM root AS r"
+			next := i + 2
+			if strings.EqualFold(p.tokens[next].text, "AS") && p.tokens[next].kind == tokIdent {
+				next++
+			}
+			if t := p.tokens[next]; t.kind == tokIdent && !sqlKeywords[strings.ToUpper(t.text)] {
+				p.alias = t.text
+			}
+			break
+		}
+	}
+	q := &fakeQuery{top: -1, limit: -1}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	q.distinct = p.acceptKeyword("DISTINCT")
+	if p.acceptKeyword("TOP") {
+		n, err := p.parseCount()
+		if err != nil {
+			return nil, err
+		}
+		q.top = n
+	}
+	if err := p.parseSelection(q); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tokIdent || sqlKeywords[strings.ToUpper(t.text)] {
+		return nil, errors.Errorf("expected collection alias at '%s'", t.text)
+	}
+	if p.acceptKeyword("AS") || (p.peek().kind == tokIdent && !sqlKeywords[strings.ToUpper(p.peek().text)]) {
+		if t := p.next(); t.kind != tokIdent || sqlKeywords[strings.ToUpper(t.text)] {
+			return nil, errors.Errorf("expected collection alias at '%s'", t.text)
+		}
+	}
+	if p.isKeyword("JOIN") || p.isKeyword("GROUP") {
+		return nil, errors.Errorf("%s is not supported by the fake", strings.ToUpper(p.peek().text))
+	}
+	if p.acceptKeyword("WHERE") {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		q.where = where
+	}
+	if p.isKeyword("GROUP") {
+		return nil, errors.New("GROUP BY is not supported by the fake")
+	}
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := sqlOrderItem{expr: expr}
+			if p.acceptKeyword("DESC") {
+				item.desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			q.orderBy = append(q.orderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		var err error
+		if q.offset, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("LIMIT"); err != nil {
+			return nil, err
+		}
+		if q.limit, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errors.Errorf("unexpected '%s'", t.text)
+	}
+	return q, nil
+}
+
+// parseCount parses the argument of TOP, OFFSET or LIMIT
+func (p *sqlParser) parseCount() (int, error) {
+	t := p.next()
+	var v interface{} = json.Number(t.text)
+	if t.kind == tokParam {
+		v = p.params[t.text]
+	} else if t.kind != tokNumber {
+		return 0, errors.Errorf("expected number at '%s'", t.text)
+	}
+	f, ok := toFloat(v)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, errors.Errorf("invalid count '%s'", t.text)
+	}
+	return int(f), nil
+}
+
+func (p *sqlParser) parseSelection(q *fakeQuery) error {
+	if p.acceptSymbol("*") {
+		q.selectAll = true
+		return nil
+	}
+	q.value = p.acceptKeyword("VALUE")
+	if t := p.peek(); !q.value && t.kind == tokIdent && t.text == p.alias && p.tokens[p.pos+1].kind == tokIdent &&
+		strings.EqualFold(p.tokens[p.pos+1].text, "FROM") {
+		// Like in Cosmos, selecting the alias alone ("SELECT c FROM c") returns the documents themselves
+		p.pos++
+		q.selectAll = true
+		return nil
+	}
+	for i := 1; ; i++ {
+		item, err := p.parseSelectItem(i)
+		if err != nil {
+			return err
+		}
+		if len(q.items) > 0 && (item.aggregate == "") != (q.items[0].aggregate == "") {
+			return errors.New("aggregates can not be mixed with other values in SELECT")
+		}
+		q.items = append(q.items, item)
+		if q.value || !p.acceptSymbol(",") {
+			return nil
+		}
+	}
+}
+
+func (p *sqlParser) parseSelectItem(i int) (sqlSelectItem, error) {
+	item := sqlSelectItem{name: fmt.Sprintf("$%d", i)}
+	start := p.pos
+	if t := p.peek(); t.kind == tokIdent && aggregateFunctions[strings.ToUpper(t.text)] && p.tokens[p.pos+1].text == "(" {
+		item.aggregate = strings.ToUpper(t.text)
+		p.pos += 2
+		arg, err := p.parseExpr()
+		if err != nil {
+			return item, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return item, err
+		}
+		item.expr = arg
+	} else {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return item, err
+		}
+		item.expr = expr
+		// Like in Cosmos, a property path (c.a.b) is named by its last property
+		if isPropertyPath(p.tokens[start:p.pos]) {
+			item.name = p.tokens[p.pos-1].text
+		}
+	}
+	if p.acceptKeyword("AS") {
+		t := p.next()
+		if t.kind != tokIdent {
+			return item, errors.Errorf("expected name at '%s'", t.text)
+		}
+		item.name = t.text
+	}
+	return item, nil
+}
+
+func isPropertyPath(tokens []sqlToken) bool {
+	if len(tokens) < 3 || len(tokens)%2 == 0 {
+		return false
+	}
+	for i, t := range tokens {
+		if (i%2 == 0 && t.kind != tokIdent) || (i%2 == 1 && t.text != ".") {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *sqlParser) parseExpr() (sqlExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = sqlOr(left, right)
+	}
+	return left, nil
+}
+
+func sqlOr(left, right sqlExpr) sqlExpr {
+	return func(doc interface{}) interface{} {
+		a, b := left(doc), right(doc)
+		if a == true || b == true {
+			return true
+		}
+		if a == false && b == false {
+			return false
+		}
+		return undefined
+	}
+}
+
+func (p *sqlParser) parseAnd() (sqlExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = sqlAnd(left, right)
+	}
+	return left, nil
+}
+
+func sqlAnd(left, right sqlExpr) sqlExpr {
+	return func(doc interface{}) interface{} {
+		a, b := left(doc), right(doc)
+		if a == false || b == false {
+			return false
+		}
+		if a == true && b == true {
+			return true
+		}
+		return undefined
+	}
+}
+
+func sqlNot(expr sqlExpr) sqlExpr {
+	return func(doc interface{}) interface{} {
+		if v, ok := expr(doc).(bool); ok {
+			return !v
+		}
+		return undefined
+	}
+}
+
+func (p *sqlParser) parseNot() (sqlExpr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return sqlNot(expr), nil
+	}
+	return p.parseComparison()
+}
+
+func (p *sqlParser) parseComparison() (sqlExpr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokSymbol {
+		var test func(c int) bool
+		switch t.text {
+		case "=":
+			test = func(c int) bool { return c == 0 }
+		case "!=", "<>":
+			test = func(c int) bool { return c != 0 }
+		case "<":
+			test = func(c int) bool { return c < 0 }
+		case "<=":
+			test = func(c int) bool { return c <= 0 }
+		case ">":
+			test = func(c int) bool { return c > 0 }
+		case ">=":
+			test = func(c int) bool { return c >= 0 }
+		}
+		if test != nil {
+			p.pos++
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			equality := t.text == "=" || t.text == "!=" || t.text == "<>"
+			return func(doc interface{}) interface{} {
+				a, b := left(doc), right(doc)
+				if equality {
+					switch sqlEqual(a, b) {
+					case true:
+						return test(0)
+					case false:
+						return test(1)
+					}
+					return undefined
+				}
+				if c, ok := sqlCompare(a, b); ok && a != nil {
+					return test(c)
+				}
+				return undefined
+			}, nil
+		}
+	}
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		list, err := p.parseList(")")
+		if err != nil {
+			return nil, err
+		}
+		in := func(doc interface{}) interface{} {
+			v := left(doc)
+			result := interface{}(false)
+			for _, item := range list {
+				switch sqlEqual(v, item(doc)) {
+				case true:
+					return true
+				case undefined:
+					result = undefined
+				}
+			}
+			return result
+		}
+		if not {
+			return sqlNot(in), nil
+		}
+		return in, nil
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		between := func(doc interface{}) interface{} {
+			v := left(doc)
+			c1, ok1 := sqlCompare(v, low(doc))
+			c2, ok2 := sqlCompare(v, high(doc))
+			if !ok1 || !ok2 || v == nil {
+				return undefined
+			}
+			return c1 >= 0 && c2 <= 0
+		}
+		if not {
+			return sqlNot(between), nil
+		}
+		return between, nil
+	case not:
+		return nil, errors.Errorf("expected IN or BETWEEN at '%s'", p.peek().text)
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseList(end string) ([]sqlExpr, error) {
+	var list []sqlExpr
+	if p.acceptSymbol(end) {
+		return list, nil
+	}
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+		if p.acceptSymbol(end) {
+			return list, nil
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *sqlParser) parseAdditive() (sqlExpr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokSymbol || (t.text != "+" && t.text != "-" && t.text != "||") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = sqlArithmetic(t.text, left, right)
+	}
+}
+
+func (p *sqlParser) parseMultiplicative() (sqlExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokSymbol || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = sqlArithmetic(t.text, left, right)
+	}
+}
+
+func sqlArithmetic(op string, left, right sqlExpr) sqlExpr {
+	return func(doc interface{}) interface{} {
+		a, b := left(doc), right(doc)
+		if op == "||" {
+			s1, ok1 := a.(string)
+			s2, ok2 := b.(string)
+			if !ok1 || !ok2 {
+				return undefined
+			}
+			return s1 + s2
+		}
+		x, ok1 := toFloat(a)
+		y, ok2 := toFloat(b)
+		if !ok1 || !ok2 {
+			return undefined
+		}
+		switch op {
+		case "+":
+			return sqlNumber(x + y)
+		case "-":
+			return sqlNumber(x - y)
+		case "*":
+			return sqlNumber(x * y)
+		}
+		if y == 0 {
+			// Like in Cosmos, division by zero is undefined rather than infinite
+			return undefined
+		}
+		if op == "/" {
+			return sqlNumber(x / y)
+		}
+		return sqlNumber(math.Mod(x, y))
+	}
+}
+
+func (p *sqlParser) parseUnary() (sqlExpr, error) {
+	if p.acceptSymbol("-") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return sqlArithmetic("-", func(interface{}) interface{} { return json.Number("0") }, expr), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *sqlParser) parsePrimary() (sqlExpr, error) {
+	t := p.next()
+	var expr sqlExpr
+	switch t.kind {
+	case tokNumber:
+		if _, err := strconv.ParseFloat(t.text, 64); err != nil {
+			return nil, errors.Errorf("invalid number '%s'", t.text)
+		}
+		expr = sqlConstant(json.Number(t.text))
+	case tokString:
+		expr = sqlConstant(t.text)
+	case tokParam:
+		v, ok := p.params[t.text]
+		if !ok {
+			return nil, errors.Errorf("parameter %s is not given", t.text)
+		}
+		expr = sqlConstant(v)
+	case tokSymbol:
+		switch t.text {
+		case "(":
+			inner, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			expr = inner
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			expr = func(doc interface{}) interface{} {
+				array := []interface{}{}
+				for _, item := range items {
+					if v := item(doc); v != undefined {
+						array = append(array, v)
+					}
+				}
+				return array
+			}
+		default:
+			return nil, errors.Errorf("unexpected '%s'", t.text)
+		}
+	case tokIdent:
+		switch upper := strings.ToUpper(t.text); {
+		case upper == "TRUE":
+			expr = sqlConstant(true)
+		case upper == "FALSE":
+			expr = sqlConstant(false)
+		case upper == "NULL":
+			expr = sqlConstant(nil)
+		case upper == "UNDEFINED":
+			expr = sqlConstant(undefined)
+		case p.acceptSymbol("("):
+			call, err := p.parseCall(upper)
+			if err != nil {
+				return nil, err
+			}
+			expr = call
+		case t.text == p.alias:
+			expr = func(doc interface{}) interface{} { return doc }
+		default:
+			return nil, errors.Errorf("identifier '%s' could not be resolved", t.text)
+		}
+	default:
+		return nil, errors.New("unexpected end of query")
+	}
+	return p.parsePath(expr)
+}
+
+func sqlConstant(v interface{}) sqlExpr {
+	return func(interface{}) interface{} { return v }
+}
+
+func (p *sqlParser) parseCall(name string) (sqlExpr, error) {
+	if aggregateFunctions[name] {
+		return nil, errors.Errorf("the aggregate %s is only supported at the top level of SELECT", name)
+	}
+	f, ok := sqlFunctions[name]
+	if !ok {
+		return nil, errors.Errorf("the function %s is not supported by the fake", name)
+	}
+	args, err := p.parseList(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+		return nil, errors.Errorf("wrong number of arguments to %s", name)
+	}
+	return func(doc interface{}) interface{} {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			values[i] = arg(doc)
+		}
+		return f.call(values)
+	}, nil
+}
+
+// parsePath parses property accesses (.name or [expr]) following an expression
+func (p *sqlParser) parsePath(expr sqlExpr) (sqlExpr, error) {
+	for {
+		var key sqlExpr
+		switch {
+		case p.acceptSymbol("."):
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, errors.Errorf("expected property name at '%s'", t.text)
+			}
+			key = sqlConstant(t.text)
+		case p.acceptSymbol("["):
+			var err error
+			if key, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+		default:
+			return expr, nil
+		}
+		expr = sqlProperty(expr, key)
+	}
+}
+
+func sqlProperty(expr, key sqlExpr) sqlExpr {
+	return func(doc interface{}) interface{} {
+		switch v := expr(doc).(type) {
+		case map[string]interface{}:
+			if k, ok := key(doc).(string); ok {
+				if child, ok := v[k]; ok {
+					return child
+				}
+			}
+		case []interface{}:
+			if f, ok := toFloat(key(doc)); ok && f >= 0 && int(f) < len(v) && f == math.Trunc(f) {
+				return v[int(f)]
+			}
+		}
+		return undefined
+	}
+}
@@ -0,0 +1,124 @@
+package cosmostest
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestFakeClientQuery(t *testing.T) {
+	fake := NewFakeClient()
+	ctx := context.Background()
+	for _, doc := range []string{
+		`{"id": "1", "userId": "a", "name": "Ada", "age": 36, "tags": ["x", "y"], "address": {"city": "Oslo"}}`,
+		`{"id": "2", "userId": "a", "name": "bob", "age": 25, "tags": [], "address": {"city": "Bergen"}}`,
+		`{"id": "3", "userId": "b", "name": "Carol", "age": 41, "tags": ["y"], "nick": null}`,
+	} {
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(doc), &m))
+		_, _, err := fake.CreateDocument(ctx, "db", "coll", m, cosmosapi.CreateDocumentOptions{PartitionKeyValue: m["userId"]})
+		require.NoError(t, err)
+	}
+
+	query := func(q string, params ...cosmosapi.QueryParam) string {
+		var result []interface{}
+		_, err := fake.QueryDocuments(ctx, "db", "coll", cosmosapi.Query{Query: q, Params: params}, &result, cosmosapi.DefaultQueryDocumentOptions())
+		require.NoError(t, err, q)
+		data, _ := json.Marshal(result)
+		return string(data)
+	}
+
+	for _, tc := range []struct{ query, expected string }{
+		{`SELECT VALUE c.id FROM c`, `["1","2","3"]`},
+		{`SELECT VALUE c.id FROM c WHERE c.age > 30`, `["1","3"]`},
+		{`SELECT VALUE c.id FROM c WHERE c.age >= 25 AND c.address.city = "Bergen"`, `["2"]`},
+		{`SELECT VALUE c.id FROM c WHERE c.age < 30 OR c["name"] = 'Carol'`, `["2","3"]`},
+		{`SELECT VALUE c.id FROM c WHERE NOT (c.age < 30)`, `["1","3"]`},
+		{`SELECT VALUE c.id FROM c WHERE c.address.city != "Oslo"`, `["2"]`},
+		{`SELECT VALUE c.id FROM c WHERE c.age = "36"`, `[]`},
+		{`SELECT VALUE c.id FROM c WHERE c.id IN ("1", "3")`, `["1","3"]`},
+		{`SELECT VALUE c.id FROM c WHERE c.age BETWEEN 25 AND 36`, `["1","2"]`},
+		{`SELECT VALUE c.id FROM c WHERE IS_DEFINED(c.address)`, `["1","2"]`},
+		{`SELECT VALUE c.id FROM c WHERE IS_NULL(c.nick)`, `["3"]`},
+		{`SELECT VALUE c.id FROM c WHERE STARTSWITH(c.name, "b")`, `["2"]`},
+		{`SELECT VALUE c.id FROM c WHERE CONTAINS(c.name, "A", true)`, `["1","3"]`},
+		{`SELECT VALUE c.id FROM c WHERE ARRAY_CONTAINS(c.tags, "y")`, `["1","3"]`},
+		{`SELECT VALUE c.id FROM c WHERE ARRAY_LENGTH(c.tags) = 0`, `["2"]`},
+		{`SELECT VALUE c.id FROM c ORDER BY c.age DESC`, `["3","1","2"]`},
+		{`SELECT VALUE c.id FROM c ORDER BY c.userId DESC, c.name`, `["3","1","2"]`},
+		{`SELECT TOP 2 VALUE c.id FROM c ORDER BY c.age`, `["2","1"]`},
+		{`SELECT VALUE c.id FROM c ORDER BY c.age OFFSET 1 LIMIT 1`, `["1"]`},
+		{`SELECT c.id, c.address.city, UPPER(c.name) AS name FROM c WHERE c.id = "1"`, `[{"city":"Oslo","id":"1","name":"ADA"}]`},
+		{`SELECT VALUE c.age + 1 FROM c WHERE c.id = "2"`, `[26]`},
+		{`SELECT VALUE LOWER(c.name) || "!" FROM c WHERE c.id = "3"`, `["carol!"]`},
+		{`SELECT VALUE c.tags[0] FROM c`, `["x","y"]`},
+		{`SELECT DISTINCT VALUE c.userId FROM c`, `["a","b"]`},
+		{`SELECT VALUE COUNT(1) FROM c WHERE c.userId = "a"`, `[2]`},
+		{`SELECT SUM(c.age) AS total, MAX(c.name) AS last FROM c`, `[{"last":"bob","total":102}]`},
+		{`SELECT VALUE AVG(c.age) FROM c WHERE c.age > 100`, `[]`},
+		{`SELECT c.id, c.age / 0 AS x, c.age % 0 AS y FROM c WHERE c.id = "1"`, `[{"id":"1"}]`},
+		{`SELECT VALUE c.age / 0 FROM c WHERE c.id = "1"`, `[]`},
+		{`SELECT VALUE r.id FROM root r WHERE r.age > 30`, `["1","3"]`},
+		{`SELECT VALUE r.id FROM root AS r ORDER BY r.age`, `["2","1","3"]`},
+		{`SELECT VALUE root.id FROM root WHERE root.id = "2"`, `["2"]`},
+	} {
+		assert.Equal(t, tc.expected, query(tc.query), tc.query)
+	}
+
+	assert.Equal(t, `["1"]`, query(`SELECT VALUE c.id FROM c WHERE c.age = @age AND c.name = @name`,
+		cosmosapi.QueryParam{Name: "@age", Value: 36}, cosmosapi.QueryParam{Name: "@name", Value: "Ada"}))
+	assert.Equal(t, `["3"]`, query(`SELECT TOP @n VALUE c.id FROM c WHERE ARRAY_CONTAINS(@ids, c.id)`,
+		cosmosapi.QueryParam{Name: "@n", Value: 1}, cosmosapi.QueryParam{Name: "@ids", Value: []string{"3"}}))
+
+	// Selecting the alias returns the documents themselves
+	var docs []map[string]interface{}
+	_, err := fake.QueryDocuments(ctx, "db", "coll", cosmosapi.Query{Query: `SELECT r FROM root r WHERE r.id = "3"`}, &docs, cosmosapi.DefaultQueryDocumentOptions())
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "Carol", docs[0]["name"])
+
+	// Partition and pages
+	var page []map[string]interface{}
+	ops := cosmosapi.DefaultQueryDocumentOptions()
+	ops.PartitionKeyValue = "a"
+	ops.MaxItemCount = 1
+	response, err := fake.QueryDocuments(ctx, "db", "coll", cosmosapi.Query{Query: "SELECT * FROM c"}, &page, ops)
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.Count)
+	assert.True(t, response.HasMore())
+	assert.Equal(t, "1", page[0]["id"])
+	ops.Continuation = response.Continuation
+	response, err = fake.QueryDocuments(ctx, "db", "coll", cosmosapi.Query{Query: "SELECT * FROM c"}, &page, ops)
+	require.NoError(t, err)
+	assert.False(t, response.HasMore())
+	assert.Equal(t, "2", page[0]["id"])
+
+	for _, invalid := range []string{
+		`SELECT * FROM c WHERE`,
+		`SELECT * FROM c WHERE d.id = "1"`,
+		`SELECT * FROM c JOIN t IN c.tags`,
+		`SELECT * FROM c WHERE NOSUCHFUNCTION(c.id)`,
+		`SELECT VALUE c.id FROM c WHERE c.id = @missing`,
+		`SELECT c.id, COUNT(1) FROM c`,
+	} {
+		_, err := fake.QueryDocuments(ctx, "db", "coll", cosmosapi.Query{Query: invalid}, &page, cosmosapi.DefaultQueryDocumentOptions())
+		assert.Equal(t, cosmosapi.ErrInvalidRequest, errors.Cause(err), invalid)
+	}
+}
+
+func TestFakeClientPatchCondition(t *testing.T) {
+	fake := NewFakeClient()
+	ctx := context.Background()
+	_, _, err := fake.CreateDocument(ctx, "db", "coll", map[string]interface{}{"id": "a", "stock": 5}, cosmosapi.CreateDocumentOptions{PartitionKeyValue: "a"})
+	require.NoError(t, err)
+	ops := cosmosapi.PatchDocumentOptions{PartitionKeyValue: "a", Condition: "FROM c WHERE c.stock >= 3"}
+	_, err = fake.PatchDocument(ctx, "db", "coll", "a", []cosmosapi.PatchOperation{cosmosapi.PatchIncrement("/stock", -3)}, ops, nil)
+	require.NoError(t, err)
+	_, err = fake.PatchDocument(ctx, "db", "coll", "a", []cosmosapi.PatchOperation{cosmosapi.PatchIncrement("/stock", -3)}, ops, nil)
+	assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+}
@@ -0,0 +1,168 @@
+package cosmostest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type fakeModel struct {
+	cosmos.BaseModel
+	Model  string `json:"model" cosmosmodel:"fakeModel/1"`
+	UserId string `json:"userId"`
+	Count  int    `json:"count"`
+	Ttl    *int   `json:"ttl,omitempty"`
+}
+
+func (e *fakeModel) PrePut(txn *cosmos.Transaction) error  { return nil }
+func (e *fakeModel) PostGet(txn *cosmos.Transaction) error { return nil }
+
+func newFakeCollection() (*FakeClient, cosmos.Collection) {
+	fake := NewFakeClient()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake.Now = func() time.Time { return start }
+	return fake, cosmos.Collection{Client: fake, DbName: "db", Name: "coll", PartitionKey: "userId"}
+}
+
+func TestFakeClientEtags(t *testing.T) {
+	_, c := newFakeCollection()
+	entity := fakeModel{BaseModel: cosmos.BaseModel{Id: "a"}, UserId: "u", Count: 1}
+	_, err := c.PutMatching(&entity, cosmos.MatchAny)
+	require.NoError(t, err)
+	require.False(t, entity.IsNew())
+
+	stale := entity
+	_, err = c.PutMatching(&entity, cosmos.MatchCurrent)
+	require.NoError(t, err)
+	_, err = c.PutMatching(&stale, cosmos.MatchCurrent)
+	assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+	// The cosmos package reports creation conflicts as precondition failures
+	_, err = c.PutMatching(&fakeModel{BaseModel: cosmos.BaseModel{Id: "a"}, UserId: "u"}, cosmos.MatchNotExists)
+	assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+
+	var fetched fakeModel
+	require.NoError(t, c.StaleGetExisting("u", "a", &fetched))
+	assert.Equal(t, entity.Etag, fetched.Etag)
+	err = c.StaleGetExisting("other", "a", &fetched)
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+}
+
+func TestFakeClientPatch(t *testing.T) {
+	fake, _ := newFakeCollection()
+	ctx := context.Background()
+	doc := map[string]interface{}{"id": "a", "userId": "u", "count": 1, "tags": []string{"x"}}
+	_, _, err := fake.CreateDocument(ctx, "db", "coll", doc, cosmosapi.CreateDocumentOptions{PartitionKeyValue: "u"})
+	require.NoError(t, err)
+
+	var out map[string]interface{}
+	_, err = fake.PatchDocument(ctx, "db", "coll", "a", []cosmosapi.PatchOperation{
+		cosmosapi.PatchIncrement("/count", 2),
+		cosmosapi.PatchAdd("/tags/0", "w"),
+		cosmosapi.PatchSet("/nested", map[string]int{"n": 1}),
+		cosmosapi.PatchMove("/nested/n", "/moved"),
+	}, cosmosapi.PatchDocumentOptions{PartitionKeyValue: "u"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), out["count"])
+	assert.Equal(t, []interface{}{"w", "x"}, out["tags"])
+	assert.Equal(t, map[string]interface{}{}, out["nested"])
+	assert.Equal(t, float64(1), out["moved"])
+
+	// A failing operation leaves the document unchanged
+	_, err = fake.PatchDocument(ctx, "db", "coll", "a", []cosmosapi.PatchOperation{
+		cosmosapi.PatchIncrement("/count", 1),
+		cosmosapi.PatchRemove("/missing"),
+	}, cosmosapi.PatchDocumentOptions{PartitionKeyValue: "u"}, nil)
+	assert.Equal(t, cosmosapi.ErrInvalidRequest, errors.Cause(err))
+	_, err = fake.GetDocument(ctx, "db", "coll", "a", cosmosapi.GetDocumentOptions{PartitionKeyValue: "u"}, &out)
+	require.NoError(t, err)
+	assert.Equal(t, float64(3), out["count"])
+}
+
+func TestFakeClientTimeTravel(t *testing.T) {
+	fake, c := newFakeCollection()
+	fake.EnableTtl("db", "coll", 60)
+	never := -1
+
+	entity := fakeModel{BaseModel: cosmos.BaseModel{Id: "default"}, UserId: "u"}
+	_, err := c.PutMatching(&entity, cosmos.MatchAny)
+	require.NoError(t, err)
+	assert.Equal(t, fake.now().Unix(), int64(entity.Ts))
+	require.NoError(t, c.RacingPut(&fakeModel{BaseModel: cosmos.BaseModel{Id: "never"}, UserId: "u", Ttl: &never}))
+
+	fake.Advance(59 * time.Second)
+	require.NoError(t, c.StaleGetExisting("u", "default", &fakeModel{}))
+	fake.Advance(time.Second)
+	err = c.StaleGetExisting("u", "default", &fakeModel{})
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+
+	fake.Advance(24 * time.Hour)
+	var fetched fakeModel
+	require.NoError(t, c.StaleGetExisting("u", "never", &fetched))
+
+	// Backdating a document makes it expire
+	oneHour := 3600
+	fetched.Ttl = &oneHour
+	require.NoError(t, c.RacingPut(&fetched))
+	require.NoError(t, fake.SetTs("db", "coll", "u", "never", fake.now().Add(-time.Hour)))
+	err = c.StaleGetExisting("u", "never", &fakeModel{})
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+
+	var all []fakeModel
+	_, err = fake.ListDocuments(context.Background(), "db", "coll", nil, &all)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestFakeClientBatch(t *testing.T) {
+	fake, c := newFakeCollection()
+	ctx := context.Background()
+
+	// A transaction writing two entities commits them in one batch
+	require.NoError(t, c.Session().Transaction(func(txn *cosmos.Transaction) error {
+		for _, id := range []string{"a", "b"} {
+			var entity fakeModel
+			if err := txn.Get("u", id, &entity); err != nil {
+				return err
+			}
+			entity.Count = 1
+			txn.Put(&entity)
+		}
+		return nil
+	}))
+	var a, b fakeModel
+	require.NoError(t, c.StaleGetExisting("u", "a", &a))
+	require.NoError(t, c.StaleGetExisting("u", "b", &b))
+	assert.Equal(t, 1, a.Count)
+	assert.Equal(t, 1, b.Count)
+
+	// An operation failing on its etag rolls back the operations before it
+	response, err := fake.ExecuteBatch(ctx, "db", "coll", []cosmosapi.BatchOperation{
+		{OperationType: cosmosapi.BatchPatch, Id: "a", IfMatch: a.Etag, ResourceBody: cosmosapi.BatchPatchBody{
+			Operations: []cosmosapi.PatchOperation{cosmosapi.PatchIncrement("/count", 1)}}},
+		{OperationType: cosmosapi.BatchDelete, Id: "b", IfMatch: a.Etag},
+		{OperationType: cosmosapi.BatchRead, Id: "a"},
+	}, cosmosapi.BatchOptions{PartitionKeyValue: "u"})
+	require.Equal(t, cosmosapi.BatchError{Index: 1, StatusCode: 412, Err: cosmosapi.ErrPreconditionFailed}, err)
+	assert.Equal(t, []int{424, 412, 424}, []int{response.Results[0].StatusCode, response.Results[1].StatusCode, response.Results[2].StatusCode})
+	var fetched fakeModel
+	require.NoError(t, c.StaleGetExisting("u", "a", &fetched))
+	assert.Equal(t, a.Etag, fetched.Etag)
+	assert.Equal(t, 1, fetched.Count)
+
+	response, err = fake.ExecuteBatch(ctx, "db", "coll", []cosmosapi.BatchOperation{
+		{OperationType: cosmosapi.BatchPatch, Id: "a", IfMatch: a.Etag, ResourceBody: cosmosapi.BatchPatchBody{
+			Operations: []cosmosapi.PatchOperation{cosmosapi.PatchIncrement("/count", 1)}}},
+		{OperationType: cosmosapi.BatchDelete, Id: "b", IfMatch: b.Etag},
+		{OperationType: cosmosapi.BatchRead, Id: "a"},
+	}, cosmosapi.BatchOptions{PartitionKeyValue: "u"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{200, 204, 200}, []int{response.Results[0].StatusCode, response.Results[1].StatusCode, response.Results[2].StatusCode})
+	assert.Equal(t, response.Results[0].Etag, response.Results[2].Etag)
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(c.StaleGetExisting("u", "b", &fetched)))
+}
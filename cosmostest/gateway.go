@@ -0,0 +1,474 @@
+package cosmostest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// GatewayMasterKey is the master key NewGateway makes the gateway accept
+const GatewayMasterKey = "Z2F0ZXdheS1tYXN0ZXIta2V5LWZvci1jb3Ntb3N0ZXN0LWdhdGV3YXk="
+
+const headerItemCount = "x-ms-item-count"
+
+// Gateway is an in-process HTTP server implementing the part of the Cosmos REST protocol used for documents,
+// backed by a FakeClient. Unlike using the FakeClient directly, requests go through the real
+// cosmosapi.Client, so that tests also cover how requests are signed, how options are sent as headers, and
+// how bodies and response headers are serialized and parsed:
+//
+//	gateway := cosmostest.NewGateway(nil)
+//	defer gateway.Close()
+//	coll := cosmos.Collection{Client: gateway.Client(), DbName: "db", Name: "coll", PartitionKey: "pk"}
+//
+// Supported are reading, creating, upserting, replacing, patching and deleting documents, transactional
+// batches, queries (with the SQL subset of FakeClient), listing documents, getting and deleting collections
+// and deleting databases; other requests get 501 Not Implemented. Like Cosmos, the gateway rejects requests
+// that are not signed with MasterKey, queries without a partition key that do not enable cross-partition
+// queries, patches (also in batches) with an API version older than cosmosapi.PatchAPIVersion, and queries
+// and patches with the wrong content type.
+type Gateway struct {
+	// Fake holds the databases served, and can be used to control time, throughput and consistency
+	Fake *FakeClient
+	// MasterKey is the key requests must be signed with
+	MasterKey string
+	// URL is the base URL of the server, as passed to cosmosapi.New
+	URL string
+
+	server *httptest.Server
+}
+
+// NewGateway starts a Gateway serving fake, or a new FakeClient if fake is nil. Close it when done.
+func NewGateway(fake *FakeClient) *Gateway {
+	if fake == nil {
+		fake = NewFakeClient()
+	}
+	g := &Gateway{Fake: fake, MasterKey: GatewayMasterKey}
+	g.server = httptest.NewServer(g)
+	g.URL = g.server.URL
+	return g
+}
+
+// Client returns a client for the gateway
+func (g *Gateway) Client() *cosmosapi.Client {
+	return cosmosapi.New(g.URL, cosmosapi.Config{MasterKey: g.MasterKey}, g.server.Client(), nil)
+}
+
+// Close shuts the server down
+func (g *Gateway) Close() {
+	g.server.Close()
+}
+
+// gatewayRequest is a request parsed by Gateway.ServeHTTP
+type gatewayRequest struct {
+	*http.Request
+	dbName, colName, id string
+	partitionValue      interface{}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	req := gatewayRequest{Request: r}
+	if len(parts) >= 2 && parts[0] == "dbs" {
+		req.dbName = parts[1]
+	}
+	if len(parts) >= 4 && parts[2] == "colls" {
+		req.colName = parts[3]
+	}
+	if len(parts) == 6 && parts[4] == "docs" {
+		req.id = parts[5]
+	}
+	// The resource type and link signed, see cosmosapi.Client.Sign
+	var resourceType, resourceLink string
+	var handler func(w http.ResponseWriter, r gatewayRequest)
+	switch {
+	case len(parts) == 2 && req.dbName != "" && r.Method == http.MethodDelete:
+		resourceType, resourceLink, handler = "dbs", strings.Join(parts, "/"), g.deleteDatabase
+	case len(parts) == 4 && req.colName != "":
+		resourceType, resourceLink = "colls", strings.Join(parts, "/")
+		switch r.Method {
+		case http.MethodGet:
+			handler = g.getCollection
+		case http.MethodDelete:
+			handler = g.deleteCollection
+		}
+	case len(parts) == 5 && req.colName != "" && parts[4] == "pkranges":
+		resourceType, resourceLink = "pkranges", strings.Join(parts[:4], "/")
+		if r.Method == http.MethodGet {
+			handler = g.getPartitionKeyRanges
+		}
+	case len(parts) == 5 && req.colName != "" && parts[4] == "docs":
+		resourceType, resourceLink = "docs", strings.Join(parts[:4], "/")
+		switch {
+		case r.Method == http.MethodGet:
+			handler = g.listDocuments
+		case r.Method == http.MethodPost && strings.EqualFold(r.Header.Get(cosmosapi.HEADER_IS_BATCH_REQUEST), "true"):
+			handler = g.executeBatch
+		case r.Method == http.MethodPost && (strings.EqualFold(r.Header.Get(cosmosapi.HEADER_IS_QUERY), "true") ||
+			r.Header.Get(cosmosapi.HEADER_CONTYPE) == cosmosapi.QUERY_CONTENT_TYPE):
+			handler = g.queryDocuments
+		case r.Method == http.MethodPost:
+			handler = g.createDocument
+		}
+	case req.id != "":
+		resourceType, resourceLink = "docs", strings.Join(parts, "/")
+		switch r.Method {
+		case http.MethodGet:
+			handler = g.getDocument
+		case http.MethodPut:
+			handler = g.replaceDocument
+		case http.MethodDelete:
+			handler = g.deleteDocument
+		case http.MethodPatch:
+			handler = g.patchDocument
+		}
+	}
+	if handler == nil {
+		writeError(w, cosmosapi.DocumentResponse{}, errors.Wrap(ErrNotSupported, r.Method+" "+r.URL.Path))
+		return
+	}
+	expected, err := cosmosapi.SignWithKey(g.MasterKey, r.Method, resourceType, resourceLink, r.Header.Get(cosmosapi.HEADER_XDATE))
+	if err != nil || r.Header.Get(cosmosapi.HEADER_XDATE) == "" || r.Header.Get(cosmosapi.HEADER_AUTH) != expected {
+		writeError(w, cosmosapi.DocumentResponse{StatusCode: http.StatusUnauthorized}, errors.New("The input authorization token can't serve the request"))
+		return
+	}
+	if r.Header.Get(cosmosapi.HEADER_VER) == "" {
+		writeError(w, cosmosapi.DocumentResponse{StatusCode: http.StatusBadRequest}, errors.New("The x-ms-version header is missing"))
+		return
+	}
+	if req.partitionValue, err = parsePartitionKeyHeader(r.Header.Get(cosmosapi.HEADER_PARTITIONKEY)); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	handler(w, req)
+}
+
+// parsePartitionKeyHeader parses a partition key header made by cosmosapi.MarshalPartitionKeyHeader
+func parsePartitionKeyHeader(header string) (interface{}, error) {
+	if header == "" {
+		return nil, nil
+	}
+	var values []interface{}
+	dec := json.NewDecoder(strings.NewReader(header))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil || len(values) != 1 {
+		return nil, errors.Wrap(cosmosapi.ErrInvalidRequest, "Invalid partition key header "+header)
+	}
+	return values[0], nil
+}
+
+// readBody decodes the JSON request body into out, keeping numbers exact
+func readBody(r gatewayRequest, out interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(out); err != nil {
+		return errors.Wrap(cosmosapi.ErrInvalidRequest, err.Error())
+	}
+	return nil
+}
+
+func checkContentType(r gatewayRequest, contentType string) error {
+	if r.Header.Get(cosmosapi.HEADER_CONTYPE) != contentType {
+		return errors.Wrap(cosmosapi.ErrInvalidRequest, "The content type must be "+contentType)
+	}
+	return nil
+}
+
+// setHeaders sets the response headers Cosmos returns for a request on a document
+func setHeaders(h http.Header, response cosmosapi.DocumentResponse) {
+	h.Set(cosmosapi.HEADER_ACTIVITY_ID, uuid.Must(uuid.NewV4()).String())
+	h.Set(cosmosapi.HEADER_REQUEST_CHARGE, strconv.FormatFloat(response.RUs, 'f', -1, 64))
+	if response.SessionToken != "" {
+		h.Set(cosmosapi.HEADER_SESSION_TOKEN, response.SessionToken)
+	}
+	if response.Etag != "" {
+		h.Set(cosmosapi.HEADER_ETAG, response.Etag)
+	}
+	if response.LSN > 0 {
+		h.Set(cosmosapi.HEADER_LSN, strconv.FormatInt(response.LSN, 10))
+	}
+	if response.RequestDuration > 0 {
+		h.Set(cosmosapi.HEADER_REQUEST_DURATION_MS, strconv.FormatFloat(response.RequestDuration.Seconds()*1000, 'f', -1, 64))
+	}
+}
+
+func writeJson(w http.ResponseWriter, statusCode int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, errors.WithStack(err))
+		return
+	}
+	w.Header().Set(cosmosapi.HEADER_CONTYPE, "application/json")
+	w.Header().Set(cosmosapi.HEADER_CONLEN, strconv.Itoa(len(data)))
+	w.WriteHeader(statusCode)
+	io.Copy(w, bytes.NewReader(data))
+}
+
+// gatewayStatus maps the errors of FakeClient to the status codes Cosmos responds with
+var gatewayStatus = map[error]int{
+	ErrNotSupported:                      http.StatusNotImplemented,
+	cosmosapi.ErrInvalidPartitionKeyType: http.StatusBadRequest,
+}
+
+func init() {
+	for statusCode, err := range cosmosapi.CosmosHTTPErrors {
+		if err != nil {
+			gatewayStatus[err] = statusCode
+		}
+	}
+}
+
+// writeError writes the response to a failed request. The status code is that of response, if set, or
+// otherwise the one for the cause of err.
+func writeError(w http.ResponseWriter, response cosmosapi.DocumentResponse, err error) {
+	statusCode := response.StatusCode
+	if statusCode < http.StatusBadRequest {
+		var ok bool
+		if statusCode, ok = gatewayStatus[errors.Cause(err)]; !ok {
+			statusCode = http.StatusInternalServerError
+		}
+	}
+	response.Etag = ""
+	setHeaders(w.Header(), response)
+	if statusCode == http.StatusTooManyRequests {
+		w.Header().Set(cosmosapi.HEADER_RETRY_AFTER_MS, "1")
+	}
+	writeJson(w, statusCode, cosmosapi.RequestError{Code: strings.Replace(http.StatusText(statusCode), " ", "", -1), Message: err.Error()})
+}
+
+// feedBody is the body of a response with a page of documents
+type feedBody struct {
+	Rid       string            `json:"_rid"`
+	Documents []json.RawMessage `json:"Documents"`
+	Count     int               `json:"_count"`
+}
+
+func (g *Gateway) getDocument(w http.ResponseWriter, r gatewayRequest) {
+	var doc map[string]interface{}
+	response, err := g.Fake.GetDocument(r.Context(), r.dbName, r.colName, r.id, cosmosapi.GetDocumentOptions{
+		IfNoneMatch:       r.Header.Get(cosmosapi.HEADER_IF_NONE_MATCH),
+		PartitionKeyValue: r.partitionValue,
+		ConsistencyLevel:  cosmosapi.ConsistencyLevel(r.Header.Get(cosmosapi.HEADER_CONSISTENCY_LEVEL)),
+		SessionToken:      r.Header.Get(cosmosapi.HEADER_SESSION_TOKEN),
+	}, &doc)
+	switch {
+	case err != nil:
+		writeError(w, response, err)
+	case response.NotModified:
+		setHeaders(w.Header(), response)
+		w.WriteHeader(http.StatusNotModified)
+	default:
+		setHeaders(w.Header(), response)
+		writeJson(w, http.StatusOK, doc)
+	}
+}
+
+func (g *Gateway) createDocument(w http.ResponseWriter, r gatewayRequest) {
+	g.putDocument(w, r, strings.EqualFold(r.Header.Get(cosmosapi.HEADER_UPSERT), "true"), true)
+}
+
+func (g *Gateway) replaceDocument(w http.ResponseWriter, r gatewayRequest) {
+	g.putDocument(w, r, true, false)
+}
+
+func (g *Gateway) putDocument(w http.ResponseWriter, r gatewayRequest, replace, create bool) {
+	var doc map[string]interface{}
+	if err := readBody(r, &doc); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	resource, response, err := g.Fake.put(r.Context(), r.dbName, r.colName, r.id, doc, r.partitionValue, replace, create, r.Header.Get(cosmosapi.HEADER_IF_MATCH))
+	if err != nil {
+		writeError(w, response, err)
+		return
+	}
+	// The document as stored, with the system properties set by FakeClient.write
+	doc["_etag"] = resource.Etag
+	doc["_ts"] = resource.Ts
+	doc["_rid"] = resource.Rid
+	doc["_self"] = resource.Self
+	setHeaders(w.Header(), response)
+	writeJson(w, response.StatusCode, doc)
+}
+
+func (g *Gateway) deleteDocument(w http.ResponseWriter, r gatewayRequest) {
+	response, err := g.Fake.DeleteDocument(r.Context(), r.dbName, r.colName, r.id, cosmosapi.DeleteDocumentOptions{
+		PartitionKeyValue: r.partitionValue,
+		IfMatch:           r.Header.Get(cosmosapi.HEADER_IF_MATCH),
+	})
+	if err != nil {
+		writeError(w, response, err)
+		return
+	}
+	setHeaders(w.Header(), response)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) patchDocument(w http.ResponseWriter, r gatewayRequest) {
+	if err := checkContentType(r, cosmosapi.PATCH_CONTENT_TYPE); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	// API versions are dates, so they can be compared as strings
+	if r.Header.Get(cosmosapi.HEADER_VER) < cosmosapi.PatchAPIVersion {
+		writeError(w, cosmosapi.DocumentResponse{StatusCode: http.StatusBadRequest}, errors.New("Patch is not supported by API version "+r.Header.Get(cosmosapi.HEADER_VER)))
+		return
+	}
+	var body struct {
+		Condition  string `json:"condition"`
+		Operations []struct {
+			Op    cosmosapi.PatchOperationType `json:"op"`
+			Path  string                       `json:"path"`
+			Value interface{}                  `json:"value"`
+			From  string                       `json:"from"`
+		} `json:"operations"`
+	}
+	if err := readBody(r, &body); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	var operations []cosmosapi.PatchOperation
+	for _, op := range body.Operations {
+		operations = append(operations, cosmosapi.PatchOperation{Op: op.Op, Path: op.Path, Value: op.Value, From: op.From})
+	}
+	var doc map[string]interface{}
+	response, err := g.Fake.PatchDocument(r.Context(), r.dbName, r.colName, r.id, operations, cosmosapi.PatchDocumentOptions{
+		PartitionKeyValue: r.partitionValue,
+		Condition:         body.Condition,
+		IfMatch:           r.Header.Get(cosmosapi.HEADER_IF_MATCH),
+	}, &doc)
+	if err != nil {
+		writeError(w, response, err)
+		return
+	}
+	setHeaders(w.Header(), response)
+	writeJson(w, http.StatusOK, doc)
+}
+
+func (g *Gateway) executeBatch(w http.ResponseWriter, r gatewayRequest) {
+	var operations []cosmosapi.BatchOperation
+	if err := readBody(r, &operations); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	for _, op := range operations {
+		// API versions are dates, so they can be compared as strings
+		if op.OperationType == cosmosapi.BatchPatch && r.Header.Get(cosmosapi.HEADER_VER) < cosmosapi.PatchAPIVersion {
+			writeError(w, cosmosapi.DocumentResponse{StatusCode: http.StatusBadRequest}, errors.New("Patch is not supported by API version "+r.Header.Get(cosmosapi.HEADER_VER)))
+			return
+		}
+	}
+	response, err := g.Fake.ExecuteBatch(r.Context(), r.dbName, r.colName, operations, cosmosapi.BatchOptions{
+		PartitionKeyValue: r.partitionValue,
+		SessionToken:      r.Header.Get(cosmosapi.HEADER_SESSION_TOKEN),
+	})
+	if _, ok := err.(cosmosapi.BatchError); err != nil && !ok {
+		writeError(w, response.DocumentResponse, err)
+		return
+	}
+	// A failed batch has status 207 Multi-Status, with the status of each operation in the results
+	setHeaders(w.Header(), response.DocumentResponse)
+	writeJson(w, response.StatusCode, response.Results)
+}
+
+func (g *Gateway) queryDocuments(w http.ResponseWriter, r gatewayRequest) {
+	if err := checkContentType(r, cosmosapi.QUERY_CONTENT_TYPE); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	if r.partitionValue == nil && r.Header.Get(cosmosapi.HEADER_CROSSPARTITION) != "true" && r.Header.Get(cosmosapi.HEADER_PARTITION_KEY_RANGE_ID) == "" {
+		writeError(w, cosmosapi.DocumentResponse{}, errors.Wrap(cosmosapi.ErrInvalidRequest, "Cross partition query is required but disabled"))
+		return
+	}
+	var query cosmosapi.Query
+	if err := readBody(r, &query); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	maxItemCount, _ := strconv.Atoi(r.Header.Get(cosmosapi.HEADER_MAX_ITEM_COUNT))
+	var docs []json.RawMessage
+	response, err := g.Fake.QueryDocuments(r.Context(), r.dbName, r.colName, query, &docs, cosmosapi.QueryDocumentsOptions{
+		PartitionKeyValue: r.partitionValue,
+		MaxItemCount:      maxItemCount,
+		Continuation:      r.Header.Get(cosmosapi.HEADER_CONTINUATION),
+		ConsistencyLevel:  cosmosapi.ConsistencyLevel(r.Header.Get(cosmosapi.HEADER_CONSISTENCY_LEVEL)),
+		SessionToken:      r.Header.Get(cosmosapi.HEADER_SESSION_TOKEN),
+	})
+	if err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	g.writeFeed(w, r, docs, cosmosapi.DocumentResponse{RUs: response.RequestCharge, SessionToken: response.SessionToken}, response.Continuation)
+}
+
+func (g *Gateway) listDocuments(w http.ResponseWriter, r gatewayRequest) {
+	maxItemCount, _ := strconv.Atoi(r.Header.Get(cosmosapi.HEADER_MAX_ITEM_COUNT))
+	var docs []json.RawMessage
+	response, err := g.Fake.ListDocuments(r.Context(), r.dbName, r.colName, &cosmosapi.ListDocumentsOptions{
+		MaxItemCount: maxItemCount,
+		AIM:          r.Header.Get(cosmosapi.HEADER_A_IM),
+		Continuation: r.Header.Get(cosmosapi.HEADER_CONTINUATION),
+	}, &docs)
+	if err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	g.writeFeed(w, r, docs, cosmosapi.DocumentResponse{RUs: response.RequestCharge, SessionToken: response.SessionToken}, response.Continuation)
+}
+
+func (g *Gateway) writeFeed(w http.ResponseWriter, r gatewayRequest, docs []json.RawMessage, response cosmosapi.DocumentResponse, continuation string) {
+	if docs == nil {
+		docs = []json.RawMessage{}
+	}
+	setHeaders(w.Header(), response)
+	w.Header().Set(headerItemCount, strconv.Itoa(len(docs)))
+	if continuation != "" {
+		w.Header().Set(cosmosapi.HEADER_CONTINUATION, continuation)
+	}
+	writeJson(w, http.StatusOK, feedBody{Rid: r.colName, Documents: docs, Count: len(docs)})
+}
+
+func (g *Gateway) getCollection(w http.ResponseWriter, r gatewayRequest) {
+	coll, err := g.Fake.GetCollection(r.Context(), r.dbName, r.colName)
+	if err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	writeJson(w, http.StatusOK, coll)
+}
+
+func (g *Gateway) deleteCollection(w http.ResponseWriter, r gatewayRequest) {
+	if err := g.Fake.DeleteCollection(r.Context(), r.dbName, r.colName); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) deleteDatabase(w http.ResponseWriter, r gatewayRequest) {
+	if err := g.Fake.DeleteDatabase(r.Context(), r.dbName, nil); err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) getPartitionKeyRanges(w http.ResponseWriter, r gatewayRequest) {
+	ranges, err := g.Fake.GetPartitionKeyRanges(r.Context(), r.dbName, r.colName, nil)
+	if err != nil {
+		writeError(w, cosmosapi.DocumentResponse{}, err)
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"_rid":               r.colName,
+		"PartitionKeyRanges": ranges.PartitionKeyRanges,
+		"_count":             len(ranges.PartitionKeyRanges),
+	})
+}
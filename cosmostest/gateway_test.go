@@ -0,0 +1,86 @@
+package cosmostest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+func TestGatewayConformance(t *testing.T) {
+	gateway := NewGateway(nil)
+	defer gateway.Close()
+	RunConformanceTests(t, cosmos.Collection{Client: gateway.Client(), DbName: "db", Name: "coll", PartitionKey: "pk"})
+}
+
+func TestGateway(t *testing.T) {
+	gateway := NewGateway(nil)
+	defer gateway.Close()
+	client := gateway.Client()
+	ctx := context.Background()
+
+	resource, response, err := client.CreateDocument(ctx, "db", "coll", map[string]interface{}{"id": "a", "pk": 1, "amount": 12.5},
+		cosmosapi.CreateDocumentOptions{PartitionKeyValue: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 201, response.StatusCode)
+	assert.NotEmpty(t, resource.Etag)
+	assert.NotEmpty(t, response.SessionToken)
+	assert.NotEmpty(t, response.ActivityId)
+
+	// The document is stored in the fake, in the partition of the header
+	var doc map[string]interface{}
+	_, err = gateway.Fake.GetDocument(ctx, "db", "coll", "a", cosmosapi.GetDocumentOptions{PartitionKeyValue: 1}, &doc)
+	require.NoError(t, err)
+	assert.Equal(t, resource.Etag, doc["_etag"])
+
+	// Queries without a partition key must enable cross-partition queries
+	var docs []map[string]interface{}
+	_, err = client.QueryDocuments(ctx, "db", "coll", cosmosapi.Query{Query: "SELECT * FROM c"}, &docs, cosmosapi.DefaultQueryDocumentOptions())
+	assert.Equal(t, cosmosapi.ErrInvalidRequest, errors.Cause(err))
+	ops := cosmosapi.DefaultQueryDocumentOptions()
+	ops.EnableCrossPartition = true
+	queryResponse, err := client.QueryDocuments(ctx, "db", "coll", cosmosapi.NewQuery("SELECT * FROM c WHERE c.amount > @amount", map[string]interface{}{"@amount": 10}), &docs, ops)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, 1, queryResponse.Count)
+	assert.True(t, queryResponse.Size > 0)
+
+	// Requests not signed with the master key are rejected
+	other := cosmosapi.New(gateway.URL, cosmosapi.Config{MasterKey: "b3RoZXIta2V5"}, nil, nil)
+	_, err = other.GetDocument(ctx, "db", "coll", "a", cosmosapi.GetDocumentOptions{PartitionKeyValue: 1}, &doc)
+	assert.Equal(t, cosmosapi.ErrUnautorized, errors.Cause(err))
+
+	// Patches need a recent API version
+	_, err = client.PatchDocument(ctx, "db", "coll", "a", []cosmosapi.PatchOperation{cosmosapi.PatchIncrement("/amount", 1)},
+		cosmosapi.PatchDocumentOptions{PartitionKeyValue: 1}, &doc)
+	require.NoError(t, err)
+	assert.Equal(t, 13.5, doc["amount"])
+
+	// Batches are atomic
+	batch := []cosmosapi.BatchOperation{
+		{OperationType: cosmosapi.BatchCreate, ResourceBody: map[string]interface{}{"id": "b", "pk": 1}},
+		{OperationType: cosmosapi.BatchPatch, Id: "a", IfMatch: resource.Etag, ResourceBody: cosmosapi.BatchPatchBody{
+			Operations: []cosmosapi.PatchOperation{cosmosapi.PatchIncrement("/amount", 1)}}},
+	}
+	batchResponse, err := client.ExecuteBatch(ctx, "db", "coll", batch, cosmosapi.BatchOptions{PartitionKeyValue: 1})
+	assert.Equal(t, cosmosapi.ErrPreconditionFailed, errors.Cause(err))
+	require.Len(t, batchResponse.Results, 2)
+	assert.Equal(t, 424, batchResponse.Results[0].StatusCode)
+	_, err = client.GetDocument(ctx, "db", "coll", "b", cosmosapi.GetDocumentOptions{PartitionKeyValue: 1}, &doc)
+	assert.Equal(t, cosmosapi.ErrNotFound, errors.Cause(err))
+	_, err = client.GetDocument(ctx, "db", "coll", "a", cosmosapi.GetDocumentOptions{PartitionKeyValue: 1}, &doc)
+	require.NoError(t, err)
+	batch[1].IfMatch = doc["_etag"].(string)
+	batchResponse, err = client.ExecuteBatch(ctx, "db", "coll", batch, cosmosapi.BatchOptions{PartitionKeyValue: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []int{201, 200}, []int{batchResponse.Results[0].StatusCode, batchResponse.Results[1].StatusCode})
+	assert.Contains(t, string(batchResponse.Results[1].ResourceBody), `"amount":14.5`)
+
+	// Unsupported operations fail
+	err = client.ExecuteStoredProcedure(ctx, "db", "coll", "sproc", cosmosapi.ExecuteStoredProcedureOptions{PartitionKeyValue: 1}, nil)
+	assert.Error(t, err)
+}
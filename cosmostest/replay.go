@@ -0,0 +1,122 @@
+package cosmostest
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// ReplayTransaction re-executes a transaction traced with Session.WithTransactionTraceDocuments against a new
+// FakeClient, to reproduce and debug e.g. a conflict in production locally:
+//
+//	var txnErr cosmos.TransactionError // or the trace unmarshalled from the log entry
+//	fake, err := cosmostest.ReplayTransaction(collection, txnErr.Trace, func(txn *cosmos.Transaction) error {
+//		... the code of the failed transaction ...
+//	})
+//
+// c is the collection the transaction was done in; only its DbName, Name and PartitionKey are used, so that e.g.
+// its interceptors and entity cache do not interfere with the replay. The fake is seeded with
+// the documents found by the gets of the first attempt. Before the commit of every attempt that was retried,
+// it is seeded with the documents found by the next one, as if they had been written concurrently; and if the
+// commit of the last attempt met a conflict, the documents are written once more. This way closure sees the
+// same documents and meets the same conflicts as in the trace, with as many attempts.
+//
+// The replay is traced, so if it fails the error is a cosmos.TransactionError. The fake is returned to inspect
+// the documents written.
+func ReplayTransaction(c cosmos.Collection, trace *cosmos.TransactionTrace, closure func(*cosmos.Transaction) error) (*FakeClient, error) {
+	fake := NewFakeClient()
+	for _, event := range trace.Events {
+		if event.Kind == cosmos.OperationGet && event.Error == "" && event.Size > 0 && event.Document == nil {
+			return fake, errors.New("The transaction trace has no documents; record it with WithTransactionTraceDocuments")
+		}
+	}
+	c = cosmos.Collection{DbName: c.DbName, Name: c.Name, PartitionKey: c.PartitionKey, Client: fake}
+	replay := &transactionReplay{fake: fake, collection: c, trace: trace}
+	if err := replay.seed(1); err != nil {
+		return fake, err
+	}
+	session := c.WithInterceptor(replay.intercept).Session().WithRetries(trace.Attempts).WithTransactionTrace()
+	return fake, session.Transaction(func(txn *cosmos.Transaction) error {
+		replay.attempt++
+		return closure(txn)
+	})
+}
+
+type transactionReplay struct {
+	fake       *FakeClient
+	collection cosmos.Collection
+	trace      *cosmos.TransactionTrace
+	// attempt is the attempt being replayed, starting at 1
+	attempt int
+	// prepared is the last attempt whose commit has been prepared for, see beforeCommit
+	prepared int
+}
+
+func (r *transactionReplay) intercept(op cosmos.Operation, next func() error) error {
+	if op.Transaction != nil && op.Kind != cosmos.OperationGet && op.Kind != cosmos.OperationQuery && r.prepared < r.attempt {
+		r.prepared = r.attempt
+		if err := r.beforeCommit(); err != nil {
+			return err
+		}
+	}
+	return next()
+}
+
+// beforeCommit makes the documents change the way they did during the commit of the current attempt
+func (r *transactionReplay) beforeCommit() error {
+	if r.attempt < r.trace.Attempts {
+		return r.seed(r.attempt + 1)
+	}
+	conflict := false
+	for _, event := range r.trace.Events {
+		if event.Attempt == r.attempt && event.Kind != cosmos.OperationGet &&
+			strings.Contains(event.Error, cosmosapi.ErrPreconditionFailed.Error()) {
+			conflict = true
+		}
+	}
+	if !conflict {
+		return nil
+	}
+	for _, event := range r.gets(r.attempt) {
+		if event.Document == nil {
+			continue
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(event.Document, &body); err != nil {
+			return errors.WithStack(err)
+		}
+		delete(body, "_etag")
+		doc, err := json.Marshal(body)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := r.fake.Seed(r.collection.DbName, r.collection.Name, event.PartitionValue, event.Id, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seed stores the documents found by the gets of an attempt, and removes those that were not found
+func (r *transactionReplay) seed(attempt int) error {
+	for _, event := range r.gets(attempt) {
+		if err := r.fake.Seed(r.collection.DbName, r.collection.Name, event.PartitionValue, event.Id, event.Document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gets returns the successful gets of an attempt in the trace
+func (r *transactionReplay) gets(attempt int) []cosmos.TraceEvent {
+	var gets []cosmos.TraceEvent
+	for _, event := range r.trace.Events {
+		if event.Attempt == attempt && event.Kind == cosmos.OperationGet && event.Error == "" {
+			gets = append(gets, event)
+		}
+	}
+	return gets
+}
@@ -0,0 +1,122 @@
+package cosmostest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+)
+
+func TestReplayTransaction(t *testing.T) {
+	_, c := newFakeCollection()
+	require.NoError(t, c.RacingPut(&fakeModel{BaseModel: cosmos.BaseModel{Id: "a"}, UserId: "u", Count: 1}))
+
+	// In "production", another writer increments the count during every attempt
+	var seen []int
+	increment := func(txn *cosmos.Transaction) error {
+		var entity fakeModel
+		if err := txn.Get("u", "a", &entity); err != nil {
+			return err
+		}
+		seen = append(seen, entity.Count)
+		entity.Count++
+		txn.Put(&entity)
+		return nil
+	}
+	err := c.Session().WithRetries(2).WithTransactionTraceDocuments().Transaction(func(txn *cosmos.Transaction) error {
+		if err := increment(txn); err != nil {
+			return err
+		}
+		var other fakeModel
+		require.NoError(t, c.StaleGetExisting("u", "a", &other))
+		other.Count += 10
+		return c.RacingPut(&other)
+	})
+	require.Equal(t, cosmos.ContentionError, errors.Cause(err))
+	assert.Equal(t, []int{1, 11}, seen)
+
+	// The trace is logged, and read back to replay the transaction locally
+	logged, err := json.Marshal(err.(cosmos.TransactionError).Trace)
+	require.NoError(t, err)
+	var trace cosmos.TransactionTrace
+	require.NoError(t, json.Unmarshal(logged, &trace))
+	require.NotNil(t, trace.Events[0].Document)
+
+	// The interceptors etc. of the collection are not used in the replay
+	failing := c.WithInterceptor(func(op cosmos.Operation, next func() error) error {
+		return errors.New("Not in the replay")
+	})
+	seen = nil
+	fake, err := ReplayTransaction(failing, &trace, increment)
+	require.Equal(t, cosmos.ContentionError, errors.Cause(err))
+	assert.Equal(t, []int{1, 11}, seen)
+	replayTrace := err.(cosmos.TransactionError).Trace
+	assert.Equal(t, 2, replayTrace.Attempts)
+	assert.Equal(t, trace.Events[0].Etag, replayTrace.Events[0].Etag)
+	assert.Equal(t, trace.Events[2].Etag, replayTrace.Events[2].Etag)
+
+	// Without the conflict of the last attempt, the replay succeeds on the second attempt
+	trace.Events[3].Error = ""
+	seen = nil
+	fake, err = ReplayTransaction(c, &trace, increment)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 11}, seen)
+	var entity fakeModel
+	c.Client = fake
+	require.NoError(t, c.StaleGetExisting("u", "a", &entity))
+	assert.Equal(t, 12, entity.Count)
+
+	// A trace without documents cannot be replayed
+	trace.Events[0].Document = nil
+	_, err = ReplayTransaction(c, &trace, increment)
+	assert.Error(t, err)
+}
+
+func TestReplayTransactionBatch(t *testing.T) {
+	_, c := newFakeCollection()
+	require.NoError(t, c.RacingPut(&fakeModel{BaseModel: cosmos.BaseModel{Id: "a"}, UserId: "u", Count: 1}))
+
+	// The transaction writes two entities, so it commits them in a batch; another writer changes one of
+	// them before the commit
+	move := func(txn *cosmos.Transaction) error {
+		var a, b fakeModel
+		if err := txn.Get("u", "a", &a); err != nil {
+			return err
+		}
+		if err := txn.Get("u", "b", &b); err != nil {
+			return err
+		}
+		a.Count, b.Count = a.Count-1, b.Count+1
+		txn.Put(&a)
+		txn.Put(&b)
+		return nil
+	}
+	err := c.Session().WithRetries(1).WithTransactionTraceDocuments().Transaction(func(txn *cosmos.Transaction) error {
+		if err := move(txn); err != nil {
+			return err
+		}
+		return c.RacingPut(&fakeModel{BaseModel: cosmos.BaseModel{Id: "a"}, UserId: "u", Count: 10})
+	})
+	require.Equal(t, cosmos.ContentionError, errors.Cause(err))
+	trace := err.(cosmos.TransactionError).Trace
+
+	_, err = ReplayTransaction(c, trace, move)
+	require.Equal(t, cosmos.ContentionError, errors.Cause(err))
+
+	// Without the conflict, the replay writes both entities
+	for i := range trace.Events {
+		if trace.Events[i].Kind != cosmos.OperationGet {
+			trace.Events[i].Error = ""
+		}
+	}
+	fake, err := ReplayTransaction(c, trace, move)
+	require.NoError(t, err)
+	c.Client = fake
+	var a, b fakeModel
+	require.NoError(t, c.StaleGetExisting("u", "a", &a))
+	require.NoError(t, c.StaleGetExisting("u", "b", &b))
+	assert.Equal(t, []int{0, 1}, []int{a.Count, b.Count})
+}
@@ -0,0 +1,419 @@
+package cosmostest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+// ErrUnexpectedCall is returned by Script for calls that are not the next one expected
+var ErrUnexpectedCall = errors.New("Unexpected call to cosmostest.Script")
+
+// TestingT is the part of testing.TB used by Script
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Script is a cosmos.Client that expects a scripted sequence of calls, and gives each the scripted
+// response. This replaces mocks that keep state to respond differently to the same method over time:
+//
+//	script := cosmostest.NewScript(t)
+//	defer script.Verify()
+//	script.ExpectGet("id").ReturnError(cosmosapi.ErrNotFound)
+//	script.ExpectCreate("id").ReturnEtag("E1")
+//	script.ExpectGet("id").Return(doc).ReturnEtag("E1")
+//	collection := cosmos.Collection{Client: script, ...}
+//
+// A call that is not the next one expected fails the test, and returns ErrUnexpectedCall. Verify fails
+// the test unless all the calls expected have been made.
+type Script struct {
+	t     TestingT
+	mu    sync.Mutex
+	steps []*ScriptStep
+	next  int
+}
+
+var _ cosmos.Client = &Script{}
+
+// ScriptCall is a call made to a Script
+type ScriptCall struct {
+	// Method is the name of the cosmos.Client method called, e.g. "GetDocument"
+	Method string
+	// Id is the id of the document, if any
+	Id string
+	// Document is the document written, if any
+	Document interface{}
+	// Query is the query, for QueryDocuments
+	Query cosmosapi.Query
+	// Options has the options passed, e.g. a cosmosapi.GetDocumentOptions
+	Options interface{}
+}
+
+func (call ScriptCall) String() string {
+	return fmt.Sprintf("%s(%s)", call.Method, call.Id)
+}
+
+// ScriptStep is a call expected by a Script, and its response
+type ScriptStep struct {
+	method       string
+	id           string
+	result       interface{}
+	etag         string
+	sessionToken string
+	retryCount   int
+	notModified  bool
+	err          error
+	inspect      func(call ScriptCall)
+}
+
+func NewScript(t TestingT) *Script {
+	return &Script{t: t}
+}
+
+// Expect adds a call to the method of cosmos.Client with the given name to the script. If id is
+// non-empty, the call must be for the document with that id.
+func (s *Script) Expect(method, id string) *ScriptStep {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	step := &ScriptStep{method: method, id: id}
+	s.steps = append(s.steps, step)
+	return step
+}
+
+func (s *Script) ExpectGet(id string) *ScriptStep {
+	return s.Expect("GetDocument", id)
+}
+
+// ExpectCreate expects a CreateDocument; it also matches an upsert done by CreateDocument, see
+// ScriptCall.Options to tell them apart
+func (s *Script) ExpectCreate(id string) *ScriptStep {
+	return s.Expect("CreateDocument", id)
+}
+
+func (s *Script) ExpectUpsert(id string) *ScriptStep {
+	return s.Expect("UpsertDocument", id)
+}
+
+func (s *Script) ExpectReplace(id string) *ScriptStep {
+	return s.Expect("ReplaceDocument", id)
+}
+
+func (s *Script) ExpectPatch(id string) *ScriptStep {
+	return s.Expect("PatchDocument", id)
+}
+
+func (s *Script) ExpectDelete(id string) *ScriptStep {
+	return s.Expect("DeleteDocument", id)
+}
+
+func (s *Script) ExpectQuery() *ScriptStep {
+	return s.Expect("QueryDocuments", "")
+}
+
+// Return sets the result of the call: the document returned by GetDocument or PatchDocument (to which
+// the etag and id are added), the slice of documents returned by QueryDocuments or ListDocuments, the
+// return value of a stored procedure, or for other methods, the value returned, of the type the
+// method returns
+func (step *ScriptStep) Return(result interface{}) *ScriptStep {
+	step.result = result
+	return step
+}
+
+// ReturnEtag sets the etag of the document returned or written
+func (step *ScriptStep) ReturnEtag(etag string) *ScriptStep {
+	step.etag = etag
+	return step
+}
+
+func (step *ScriptStep) ReturnSessionToken(token string) *ScriptStep {
+	step.sessionToken = token
+	return step
+}
+
+// ReturnRetryCount sets the number of times the client retried the request before the response
+func (step *ScriptStep) ReturnRetryCount(n int) *ScriptStep {
+	step.retryCount = n
+	return step
+}
+
+// ReturnNotModified makes GetDocument respond that the document still has the etag in IfNoneMatch
+func (step *ScriptStep) ReturnNotModified() *ScriptStep {
+	step.notModified = true
+	return step
+}
+
+func (step *ScriptStep) ReturnError(err error) *ScriptStep {
+	step.err = err
+	return step
+}
+
+// Inspect sets a function called with the call, e.g. to check the document written
+func (step *ScriptStep) Inspect(f func(call ScriptCall)) *ScriptStep {
+	step.inspect = f
+	return step
+}
+
+// Verify fails the test unless all the calls expected have been made
+func (s *Script) Verify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next < len(s.steps) {
+		var missing []string
+		for _, step := range s.steps[s.next:] {
+			missing = append(missing, fmt.Sprintf("%s(%s)", step.method, step.id))
+		}
+		s.t.Errorf("cosmostest.Script: %d expected calls were not made: %s", len(missing), strings.Join(missing, ", "))
+	}
+}
+
+// call returns the step for a call, or fails if the call is not the next one expected
+func (s *Script) call(call ScriptCall) (*ScriptStep, error) {
+	s.mu.Lock()
+	if s.next == len(s.steps) {
+		s.mu.Unlock()
+		s.t.Errorf("cosmostest.Script: unexpected call %s after the end of the script", call)
+		return nil, errors.WithStack(ErrUnexpectedCall)
+	}
+	step := s.steps[s.next]
+	if step.method != call.Method || (step.id != "" && step.id != call.Id) {
+		s.mu.Unlock()
+		s.t.Errorf("cosmostest.Script: call %d: expected %s(%s), got %s", s.next+1, step.method, step.id, call)
+		return nil, errors.WithStack(ErrUnexpectedCall)
+	}
+	s.next++
+	s.mu.Unlock()
+	if step.inspect != nil {
+		step.inspect(call)
+	}
+	return step, nil
+}
+
+func (step *ScriptStep) response() cosmosapi.DocumentResponse {
+	response := cosmosapi.DocumentResponse{StatusCode: http.StatusOK, Etag: step.etag, SessionToken: step.sessionToken,
+		RetryCount: step.retryCount}
+	if step.notModified {
+		response.StatusCode, response.NotModified = http.StatusNotModified, true
+	}
+	for status, err := range cosmosapi.CosmosHTTPErrors {
+		if err != nil && errors.Cause(step.err) == err {
+			response.StatusCode = status
+		}
+	}
+	return response
+}
+
+// decodeDocument decodes the result into out as a document with the id and etag of the step
+func (step *ScriptStep) decodeDocument(id string, out interface{}) error {
+	body := make(map[string]interface{})
+	if step.result != nil {
+		var err error
+		if body, err = toBody(withId(step.result, id)); err != nil {
+			return err
+		}
+	} else {
+		body["id"] = id
+	}
+	if step.etag != "" {
+		body["_etag"] = step.etag
+	}
+	return decodeBody(body, out)
+}
+
+// withId returns the document with its id set, if it has none
+func withId(doc interface{}, id string) interface{} {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return doc
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil || m == nil {
+		return doc
+	}
+	if existing, _ := m["id"].(string); existing == "" {
+		m["id"] = id
+	}
+	return m
+}
+
+func (s *Script) write(method, id string, doc interface{}, ops interface{}) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	if id == "" {
+		if m, ok := withId(doc, "").(map[string]interface{}); ok {
+			id, _ = m["id"].(string)
+		}
+	}
+	step, err := s.call(ScriptCall{Method: method, Id: id, Document: doc, Options: ops})
+	if err != nil {
+		return nil, cosmosapi.DocumentResponse{}, err
+	}
+	if step.err != nil {
+		return nil, step.response(), step.err
+	}
+	return &cosmosapi.Resource{Id: id, Etag: step.etag}, step.response(), nil
+}
+
+func (s *Script) GetDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.GetDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	step, err := s.call(ScriptCall{Method: "GetDocument", Id: id, Options: ops})
+	if err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	if step.err != nil || step.notModified {
+		return step.response(), step.err
+	}
+	return step.response(), step.decodeDocument(id, out)
+}
+
+func (s *Script) CreateDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.CreateDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	return s.write("CreateDocument", "", doc, ops)
+}
+
+func (s *Script) UpsertDocument(ctx context.Context, dbName, colName string, doc interface{}, ops cosmosapi.UpsertDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	return s.write("UpsertDocument", "", doc, ops)
+}
+
+func (s *Script) ReplaceDocument(ctx context.Context, dbName, colName, id string, doc interface{}, ops cosmosapi.ReplaceDocumentOptions) (*cosmosapi.Resource, cosmosapi.DocumentResponse, error) {
+	return s.write("ReplaceDocument", id, doc, ops)
+}
+
+func (s *Script) PatchDocument(ctx context.Context, dbName, colName, id string, operations []cosmosapi.PatchOperation, ops cosmosapi.PatchDocumentOptions, out interface{}) (cosmosapi.DocumentResponse, error) {
+	step, err := s.call(ScriptCall{Method: "PatchDocument", Id: id, Document: operations, Options: ops})
+	if err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	if step.err != nil {
+		return step.response(), step.err
+	}
+	return step.response(), step.decodeDocument(id, out)
+}
+
+func (s *Script) DeleteDocument(ctx context.Context, dbName, colName, id string, ops cosmosapi.DeleteDocumentOptions) (cosmosapi.DocumentResponse, error) {
+	step, err := s.call(ScriptCall{Method: "DeleteDocument", Id: id, Options: ops})
+	if err != nil {
+		return cosmosapi.DocumentResponse{}, err
+	}
+	return step.response(), step.err
+}
+
+// decodeList decodes the result into the slice pointed to by docs, and returns its length
+func (step *ScriptStep) decodeList(docs interface{}) (int, error) {
+	if step.result == nil || docs == nil {
+		return 0, nil
+	}
+	if err := decodeBody(step.result, docs); err != nil {
+		return 0, err
+	}
+	if v := reflect.ValueOf(docs).Elem(); v.Kind() == reflect.Slice {
+		return v.Len(), nil
+	}
+	return 0, nil
+}
+
+func (s *Script) QueryDocuments(ctx context.Context, dbName, collName string, qry cosmosapi.Query, docs interface{}, ops cosmosapi.QueryDocumentsOptions) (cosmosapi.QueryDocumentsResponse, error) {
+	response := cosmosapi.QueryDocumentsResponse{Documents: docs}
+	step, err := s.call(ScriptCall{Method: "QueryDocuments", Query: qry, Options: ops})
+	if err != nil {
+		return response, err
+	}
+	response.SessionToken = step.sessionToken
+	if step.err != nil {
+		return response, step.err
+	}
+	response.Count, err = step.decodeList(docs)
+	return response, err
+}
+
+func (s *Script) ListDocuments(ctx context.Context, dbName, colName string, ops *cosmosapi.ListDocumentsOptions, docs interface{}) (cosmosapi.ListDocumentsResponse, error) {
+	var response cosmosapi.ListDocumentsResponse
+	step, err := s.call(ScriptCall{Method: "ListDocuments", Options: ops})
+	if err != nil {
+		return response, err
+	}
+	response.SessionToken = step.sessionToken
+	if step.err != nil {
+		return response, step.err
+	}
+	response.Count, err = step.decodeList(docs)
+	return response, err
+}
+
+func (s *Script) GetCollection(ctx context.Context, dbName, colName string) (*cosmosapi.Collection, error) {
+	step, err := s.call(ScriptCall{Method: "GetCollection", Id: colName})
+	if err != nil {
+		return nil, err
+	}
+	result, _ := step.result.(*cosmosapi.Collection)
+	return result, step.err
+}
+
+func (s *Script) DeleteCollection(ctx context.Context, dbName, colName string) error {
+	step, err := s.call(ScriptCall{Method: "DeleteCollection", Id: colName})
+	if err != nil {
+		return err
+	}
+	return step.err
+}
+
+func (s *Script) DeleteDatabase(ctx context.Context, dbName string, ops *cosmosapi.RequestOptions) error {
+	step, err := s.call(ScriptCall{Method: "DeleteDatabase", Id: dbName, Options: ops})
+	if err != nil {
+		return err
+	}
+	return step.err
+}
+
+func (s *Script) ExecuteBatch(ctx context.Context, dbName, colName string, operations []cosmosapi.BatchOperation, ops cosmosapi.BatchOptions) (cosmosapi.BatchResponse, error) {
+	step, err := s.call(ScriptCall{Method: "ExecuteBatch", Document: operations, Options: ops})
+	if err != nil {
+		return cosmosapi.BatchResponse{}, err
+	}
+	result, _ := step.result.(cosmosapi.BatchResponse)
+	return result, step.err
+}
+
+func (s *Script) ExecuteStoredProcedure(ctx context.Context, dbName, colName, sprocName string, ops cosmosapi.ExecuteStoredProcedureOptions, ret interface{}, args ...interface{}) error {
+	step, err := s.call(ScriptCall{Method: "ExecuteStoredProcedure", Id: sprocName, Document: args, Options: ops})
+	if err != nil {
+		return err
+	}
+	if step.err != nil {
+		return step.err
+	}
+	if step.result != nil && ret != nil {
+		return decodeBody(step.result, ret)
+	}
+	return nil
+}
+
+func (s *Script) GetPartitionKeyRanges(ctx context.Context, dbName, colName string, options *cosmosapi.GetPartitionKeyRangesOptions) (cosmosapi.GetPartitionKeyRangesResponse, error) {
+	step, err := s.call(ScriptCall{Method: "GetPartitionKeyRanges", Options: options})
+	if err != nil {
+		return cosmosapi.GetPartitionKeyRangesResponse{}, err
+	}
+	result, _ := step.result.(cosmosapi.GetPartitionKeyRangesResponse)
+	return result, step.err
+}
+
+func (s *Script) ListOffers(ctx context.Context, ops *cosmosapi.RequestOptions) (*cosmosapi.Offers, error) {
+	step, err := s.call(ScriptCall{Method: "ListOffers", Options: ops})
+	if err != nil {
+		return nil, err
+	}
+	result, _ := step.result.(*cosmosapi.Offers)
+	return result, step.err
+}
+
+func (s *Script) ReplaceOffer(ctx context.Context, offerOps cosmosapi.OfferReplaceOptions, ops *cosmosapi.RequestOptions) (*cosmosapi.Offer, error) {
+	step, err := s.call(ScriptCall{Method: "ReplaceOffer", Document: offerOps, Options: ops})
+	if err != nil {
+		return nil, err
+	}
+	result, _ := step.result.(*cosmosapi.Offer)
+	return result, step.err
+}
@@ -0,0 +1,64 @@
+package cosmostest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-cosmosdb/cosmos"
+	"github.com/vippsas/go-cosmosdb/cosmosapi"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestScript(t *testing.T) {
+	script := NewScript(t)
+	defer script.Verify()
+	script.ExpectGet("a").ReturnError(cosmosapi.ErrNotFound)
+	script.ExpectCreate("a").ReturnEtag("E1").Inspect(func(call ScriptCall) {
+		assert.Equal(t, 1, call.Document.(*fakeModel).Count)
+		assert.Equal(t, "u", call.Options.(cosmosapi.CreateDocumentOptions).PartitionKeyValue)
+	})
+	script.ExpectGet("a").Return(fakeModel{UserId: "u", Count: 1}).ReturnEtag("E1")
+	c := cosmos.Collection{Client: script, DbName: "db", Name: "coll", PartitionKey: "userId"}
+
+	require.NoError(t, c.Session().Transaction(func(txn *cosmos.Transaction) error {
+		var e fakeModel
+		if err := txn.Get("u", "a", &e); err != nil {
+			return err
+		}
+		e.Count = 1
+		txn.Put(&e)
+		return nil
+	}))
+	var fetched fakeModel
+	require.NoError(t, c.StaleGetExisting("u", "a", &fetched))
+	assert.Equal(t, "a", fetched.Id)
+	assert.Equal(t, "E1", fetched.Etag)
+	assert.Equal(t, 1, fetched.Count)
+}
+
+func TestScriptFailures(t *testing.T) {
+	var recorder recordingT
+	script := NewScript(&recorder)
+	script.ExpectGet("a").Return(fakeModel{UserId: "u"})
+	script.ExpectQuery()
+	c := cosmos.Collection{Client: script, DbName: "db", Name: "coll", PartitionKey: "userId"}
+
+	err := c.StaleGet("u", "b", &fakeModel{})
+	assert.Equal(t, ErrUnexpectedCall, errors.Cause(err))
+	require.NoError(t, c.StaleGet("u", "a", &fakeModel{}))
+	script.Verify()
+	assert.Equal(t, []string{
+		"cosmostest.Script: call 1: expected GetDocument(a), got GetDocument(b)",
+		"cosmostest.Script: 1 expected calls were not made: QueryDocuments()",
+	}, recorder.errors)
+}